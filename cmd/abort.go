@@ -0,0 +1,61 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	seed "ibu-imager/internal/seed_creator"
+)
+
+// abortDryRun lists what would be unwound
+var abortDryRun bool
+
+// abortCmd represents the abort command
+var abortCmd = &cobra.Command{
+	Use:     "abort",
+	Aliases: []string{"unwind"},
+	Short:   "Recover the node after an aborted seed creation, returning it to a running cluster.",
+	Long: `Recover the node after an aborted seed creation, returning it to a running cluster.
+
+The recert helper containers are killed, the partial artifacts of the interrupted step deleted, and
+CRI-O and kubelet enabled and started again. The artifacts of the completed steps are kept, so the
+run can be continued with create --resume, cleanup removes them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		abort()
+	},
+}
+
+func init() {
+
+	// Add abort command
+	rootCmd.AddCommand(abortCmd)
+
+	abortCmd.Flags().BoolVar(&abortDryRun, "dry-run", false, "List what would be unwound, without changing the host.")
+	addBackupDirFlag(abortCmd)
+}
+
+func abort() {
+
+	if err := seed.ValidateBackupDir(backupDir); err != nil {
+		log.Fatal(err)
+	}
+	op := newOps()
+	if err := seed.Abort(log, op, newRuntime(op), backupDir, abortDryRun); err != nil {
+		log.Fatal(err)
+	}
+}
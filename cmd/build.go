@@ -0,0 +1,122 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"ibu-imager/internal/ops"
+	oras "ibu-imager/internal/oras_client"
+	seed "ibu-imager/internal/seed_creator"
+)
+
+// fromBackupDir is the collected backup dir the seed image is built from
+var fromBackupDir string
+
+// buildCmd represents the build command
+var buildCmd = &cobra.Command{
+	Use:   "build",
+	Short: "Build the seed image from an existing backup dir and push it, without collecting anything.",
+	Long: `Build the seed image from an existing backup dir and push it, without collecting anything.
+
+The backup dir, e.g. collected by create --skip-steps build-and-push on another node or copied by a CI
+pipeline, must hold the artifacts of every restore step. Only the seed manifest, the content lint, the
+image build and the push run, so collection and packaging can be separate pipeline stages.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		build()
+	},
+}
+
+func init() {
+
+	// Add build command
+	rootCmd.AddCommand(buildCmd)
+
+	buildCmd.Flags().StringVar(&fromBackupDir, "from-backup-dir", "", "The fully-populated backup dir the seed image is built from.")
+	buildCmd.Flags().StringVarP(&authFile, "authfile", "a", imageRegistryAuthFile, "The path to the authentication file of the container registry.")
+	buildCmd.Flags().StringVarP(&containerRegistry, "registry", "r", "", "The container registry used to push the OCI image.")
+	buildCmd.Flags().StringVar(&seedTag, "tag", seed.DefaultTag, "The tag of the seed image, with the {ocp_version}, {arch} (uname -m) and {date} (UTC, YYYYMMDD) variables replaced, e.g. {ocp_version}-{arch}-{date}.")
+	buildCmd.Flags().StringSliceVar(&mirrorRegistries, "mirror-registry", nil, "Additional container registries the OCI image is pushed to concurrently, without failing the build.")
+	buildCmd.Flags().StringVar(&artifactMode, "artifact-mode", oras.ModeImage, "Push the seed as a container image (image) or as an ORAS artifact (oras).")
+	buildCmd.Flags().BoolVar(&skipPush, "skip-push", false, "Build the seed image without pushing it, leaving it in the local storage for the push command.")
+	buildCmd.Flags().StringVar(&outputArchive, "output", "", "Export the seed image to an OCI archive instead of pushing it, as oci-archive:/path/seed.tar.")
+	buildCmd.Flags().StringVar(&nodeRole, "node-role", seed.NodeRoleMaster, "The role of the node the backup dir was collected from.")
+	buildCmd.Flags().StringVar(&sshKeysPolicy, "include-ssh-keys", "", "Restore the collected core user's SSH keys and customizations with the given policy (seed, target or merge).")
+	buildCmd.Flags().StringVar(&auditLogPolicy, "audit-logs", seed.AuditLogPolicyExclude, "Whether the collected audit logs are restored (include or exclude).")
+	buildCmd.Flags().StringVar(&lintRulesFile, "lint-rules", "", "YAML file with the seed content lint rules (defaults to the built-in rules).")
+	buildCmd.Flags().BoolVar(&skipLint, "skip-lint", false, "Skip the seed content lint.")
+	addDiskGuardFlags(buildCmd)
+}
+
+func build() {
+
+	if fromBackupDir == "" {
+		log.Fatal("A backup dir to build the seed image from is required")
+	}
+	if containerRegistry == "" {
+		log.Fatal("A container registry naming the seed image is required")
+	}
+	// Nothing is read from the host, the ostree client isn't needed
+	options := seed.Options{
+		BackupDir:        fromBackupDir,
+		Kubeconfig:       kubeconfigFile,
+		Registry:         containerRegistry,
+		Tag:              seedTag,
+		AuthFile:         authFile,
+		NodeRole:         nodeRole,
+		SSHKeysPolicy:    sshKeysPolicy,
+		AuditLogPolicy:   auditLogPolicy,
+		MirrorRegistries: mirrorRegistries,
+		SkipPush:         skipPush,
+		FeatureGates:     featureGates,
+	}
+	err := oras.ValidateMode(artifactMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if artifactMode == oras.ModeORAS {
+		if skipPush || outputArchive != "" {
+			log.Fatal("--artifact-mode oras can't be used with --skip-push or --output, no image is built")
+		}
+		options.ORAS = oras.NewClient(log, ops.NewExecutor(log, true), authFile)
+	}
+	if err = options.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if outputArchive != "" {
+		if options.Output, err = seed.ParseOutput(outputArchive); err != nil {
+			log.Fatal(err)
+		}
+		if skipPush || len(mirrorRegistries) > 0 {
+			log.Fatal("--output can't be used with --skip-push or --mirror-registry, nothing is pushed")
+		}
+	}
+	if options.LintRules, err = loadLintRules(); err != nil {
+		log.Fatal(err)
+	}
+	if options.DiskGuard, err = newDiskGuard(); err != nil {
+		log.Fatal(err)
+	}
+
+	op := newOps()
+	options.Runtime = newRuntime(op)
+	seedCreator := seed.NewSeedCreator(log, op, options)
+	if err = seedCreator.BuildSeedImage(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("OCI image built successfully!")
+}
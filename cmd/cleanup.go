@@ -0,0 +1,59 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	seed "ibu-imager/internal/seed_creator"
+)
+
+// cleanupDryRun lists what would be cleaned up
+var cleanupDryRun bool
+
+// cleanupCmd represents the cleanup command
+var cleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Reset the host state left by a seed creation run, to re-run it from scratch.",
+	Long: `Reset the host state left by a seed creation run, to re-run it from scratch.
+
+The backup dir, the step markers and leftover imager containers are deleted, and CRI-O and kubelet
+enabled and started again. The built seed images are kept, delete-local removes them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cleanup()
+	},
+}
+
+func init() {
+
+	// Add cleanup command
+	rootCmd.AddCommand(cleanupCmd)
+
+	cleanupCmd.Flags().BoolVar(&cleanupDryRun, "dry-run", false, "List what would be cleaned up, without changing the host.")
+	addBackupDirFlag(cleanupCmd)
+}
+
+func cleanup() {
+
+	if err := seed.ValidateBackupDir(backupDir); err != nil {
+		log.Fatal(err)
+	}
+	op := newOps()
+	if err := seed.Cleanup(log, op, newRuntime(op), backupDir, cleanupDryRun); err != nil {
+		log.Fatal(err)
+	}
+}
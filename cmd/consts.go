@@ -17,12 +17,10 @@ limitations under the License.
 package cmd
 
 const (
-	// Default OCI image tag
-	backupTag = "oneimage"
 	// Pull secret. Written by the machine-config-operator
 	imageRegistryAuthFile = "/var/lib/kubelet/config.json"
-	// backupDir is the directory where the ostree backup will be
-	backupDir = "/var/tmp/backup"
 	// Default kubeconfigFile location
 	kubeconfigFile = "/etc/kubernetes/static-pod-resources/kube-apiserver-certs/secrets/node-kubeconfigs/lb-ext.kubeconfig"
+	// hostRoot is the host root filesystem, as seen from the imager container sharing the host PID namespace
+	hostRoot = "/proc/1/root"
 )
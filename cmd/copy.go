@@ -0,0 +1,91 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	registry "ibu-imager/internal/registry_client"
+)
+
+var (
+	// srcAuthFile is the authentication file of the registry the seed image is copied from
+	srcAuthFile string
+	// destAuthFile is the authentication file of the registry the seed image is copied to
+	destAuthFile string
+)
+
+// copyCmd represents the copy command
+var copyCmd = &cobra.Command{
+	Use:     "copy source-image destination-image",
+	Aliases: []string{"mirror"},
+	Short:   "Copy a seed image between container registries.",
+	Long: `Copy a seed image between container registries.
+
+The seed image manifest and all its blobs are streamed from the source registry to the destination one,
+e.g. from a lab registry to the registry of a disconnected site, without requiring skopeo nor storing the
+image locally. Blobs the destination repository already has are skipped and the manifest is copied
+verbatim, so the seed image keeps its digest and its signatures remain valid.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		copySeed(args[0], args[1])
+	},
+}
+
+func init() {
+
+	// Add copy command
+	rootCmd.AddCommand(copyCmd)
+
+	copyCmd.Flags().StringVar(&srcAuthFile, "src-authfile", imageRegistryAuthFile, "The path to the authentication file of the source container registry.")
+	copyCmd.Flags().StringVar(&destAuthFile, "dest-authfile", "", "The path to the authentication file of the destination container registry, the source one if empty.")
+}
+
+func copySeed(source, destination string) {
+
+	if destAuthFile == "" {
+		destAuthFile = srcAuthFile
+	}
+	from, err := registry.ParseReference(source)
+	if err != nil {
+		log.Fatal(err)
+	}
+	to, err := registry.ParseReference(destination)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if to.Digest != "" && to.Tag == "" {
+		log.Fatalf("The destination image %s must be tagged", destination)
+	}
+	src, err := registry.NewClient(srcAuthFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dst, err := registry.NewClient(destAuthFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Copying seed image %s to %s", from, to)
+	result, err := registry.CopyImage(src, from, dst, to)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Copied %d blobs (%d bytes), mounted %d and skipped %d already present",
+		len(result.Copied), result.CopiedBytes(), len(result.Mounted), len(result.Skipped))
+	log.Printf("Seed image %s@%s copied successfully!", to.Name(), result.Digest)
+}
@@ -17,16 +17,33 @@ limitations under the License.
 package cmd
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
-	cp "github.com/otiai10/copy"
 	"github.com/spf13/cobra"
 
+	cri "ibu-imager/internal/cri_client"
+	"ibu-imager/internal/host_mounts"
+	"ibu-imager/internal/notify"
 	"ibu-imager/internal/ops"
+	oras "ibu-imager/internal/oras_client"
 	ostree "ibu-imager/internal/ostree_client"
+	planner "ibu-imager/internal/precache_plan"
+	registry "ibu-imager/internal/registry_client"
+	"ibu-imager/internal/resource_usage"
+	"ibu-imager/internal/schedule"
+	seedconfig "ibu-imager/internal/seed_config"
 	seed "ibu-imager/internal/seed_creator"
+	lint "ibu-imager/internal/seed_lint"
+	signer "ibu-imager/internal/seed_sign"
+	support "ibu-imager/internal/support_bundle"
 )
 
 // authFile is the path to the registry credentials used to push the OCI image
@@ -35,12 +52,123 @@ var authFile string
 // containerRegistry is the registry to push the OCI image
 var containerRegistry string
 
+// seedTag is the tag of the seed image, a template of the {ocp_version}, {arch} and {date} variables
+var seedTag string
+
+// mirrorRegistries are the additional registries the OCI image is pushed to, best-effort
+var mirrorRegistries []string
+
+// nodeRole is the role of the node the seed is captured from
+var nodeRole string
+
+// notifyConfig holds the targets notified when the run finishes
+var notifyConfig notify.Config
+
+// imageFilter selects the images saved in containers.list
+var imageFilter cri.ImageFilter
+
+// startAt is the RFC3339 timestamp or cron expression of the maintenance window start
+var startAt string
+
+// recertConfig configures the recert dry-run
+var recertConfig seed.RecertConfig
+
+// sshKeysPolicy is the default restore policy of the core user's SSH keys, which are carried by the
+// dedicated core user artifact instead of var.tgz when set
+var sshKeysPolicy string
+
+// lintRulesFile is the YAML file with the seed content lint rules
+var lintRulesFile string
+
+// skipLint disables the seed content lint
+var skipLint bool
+
+// mcsConfig toggles the capture of the machine-config-server data
+var mcsConfig seed.MCSConfig
+
+// auditLogPolicy decides whether the audit logs and login records are carried in the seed
+var auditLogPolicy string
+
+// strict redoes the steps whose inputs changed since their artifacts were produced
+var strict bool
+
+// skipPush leaves the built seed image in the local storage, for the push command
+var skipPush bool
+
+// outputArchive is where the seed image is exported to instead of being pushed, e.g. oci-archive:/path/seed.tar
+var outputArchive string
+
+// signKey is the cosign key the pushed seed image is signed with
+var signKey string
+
+// includeUsrLocal archives the out-of-band /usr/local files var.tgz doesn't carry
+var includeUsrLocal bool
+
+// precachePlanConfig is how the precache plan of the seed is resolved
+var precachePlanConfig = planner.Config{Workers: planner.DefaultWorkers, RequestsPerSecond: planner.DefaultRequestsPerSecond}
+
+// skipPreflight doesn't check the host and cluster readiness before the seed creation
+var skipPreflight bool
+
+// resume continues an interrupted run after its last completed step
+var resume bool
+
+// onlySteps and skipSteps select the steps the run runs, by step or artifact name
+var onlySteps, skipSteps []string
+
+// keepCrio only stops kubelet and the containers, keeping CRI-O running
+var keepCrio bool
+
+// imageStore pushes the seed images as an additional image store image along the seed
+var imageStore bool
+
+// estimateDowntime prints the predicted kubelet/crio downtime before quiescing
+var estimateDowntime bool
+
+// confirm asks for confirmation after printing the predicted downtime
+var confirm bool
+
+// artifactMode is how the seed is stored in the registry, as a container image or an ORAS artifact
+var artifactMode string
+
+// extraArtifacts are the third-party files attached to the seed, as <namespace>=<file>
+var extraArtifacts []string
+
+// includePaths are the host paths archived each into a tarball of its own among the extra artifacts
+var includePaths []string
+
+// extraArtifactsMaxMiB limits the total size of the extra artifacts
+var extraArtifactsMaxMiB int64
+
+// createConfigFile is the seed config file with the create flag values, the given flags overriding it
+var createConfigFile string
+
+// varExclude are the paths excluded from the /var backup
+var varExclude []string
+
+// backupDir is where the artifacts are written and the seed image is built from
+var backupDir = seed.DefaultBackupDir
+
+// minFreePercent and maxWrittenGiB are the disk guard limits of the backup dir filesystem
+var minFreePercent, maxWrittenGiB float64
+
 // createCmd represents the create command
 var createCmd = &cobra.Command{
 	Use:   "create",
 	Short: "Create OCI image and push it to a container registry.",
+	Long: `Create OCI image and push it to a container registry.
+
+The flags can also be given by a YAML seed config file (--config) whose keys are the flag names, lists
+for the flags taking several values, e.g.:
+
+  registry: quay.io/org/seed
+  recert-image: quay.io/edge-infrastructure/recert:v0
+  exclude-namespaces: [openshift-logging]
+  skip-steps: [image-store]
+
+The flags given on the command line override the seed config.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		create()
+		create(cmd)
 	},
 }
 
@@ -49,34 +177,236 @@ func init() {
 	// Add create command
 	rootCmd.AddCommand(createCmd)
 
+	createCmd.Flags().StringVar(&createConfigFile, "config", "", "YAML seed config file with the values of the create flags, keyed by flag name (the given flags override it).")
+
 	// Add flags related to container registry
 	createCmd.Flags().StringVarP(&authFile, "authfile", "a", imageRegistryAuthFile, "The path to the authentication file of the container registry.")
 	createCmd.Flags().StringVarP(&containerRegistry, "registry", "r", "", "The container registry used to push the OCI image.")
+	createCmd.Flags().StringVar(&seedTag, "tag", seed.DefaultTag, "The tag of the seed image, with the {ocp_version}, {arch} (uname -m) and {date} (UTC, YYYYMMDD) variables replaced, e.g. {ocp_version}-{arch}-{date}.")
+	createCmd.Flags().StringSliceVar(&mirrorRegistries, "mirror-registry", nil, "Additional container registries the OCI image is pushed to concurrently, without failing the run.")
+	createCmd.Flags().StringVar(&artifactMode, "artifact-mode", oras.ModeImage, "Push the seed as a container image (image) or, for artifact registries refusing large image layers, as an ORAS artifact (oras).")
+	createCmd.Flags().BoolVar(&skipPush, "skip-push", false, "Build the seed image without pushing it, leaving it in the local storage for the push command.")
+	createCmd.Flags().StringVar(&outputArchive, "output", "", "Export the seed image to an OCI archive instead of pushing it, as oci-archive:/path/seed.tar (--registry still names the image).")
+	createCmd.Flags().StringVar(&signKey, "sign-key", "", "Sign the pushed seed image with this cosign private key or KMS URI (the key password is read from COSIGN_PASSWORD).")
+
+	// Add flags related to the pre-cached images
+	createCmd.Flags().StringSliceVar(&imageFilter.IncludeNamespaces, "include-namespaces", nil, "Only save the images used by containers in these namespaces (shell patterns).")
+	createCmd.Flags().StringSliceVar(&imageFilter.ExcludeNamespaces, "exclude-namespaces", nil, "Don't save the images used only by containers in these namespaces (shell patterns).")
+	createCmd.Flags().StringSliceVar(&imageFilter.IncludeRegistries, "include-registries", nil, "Only save the images from these registries.")
+	createCmd.Flags().StringSliceVar(&imageFilter.ExcludeRegistries, "exclude-registries", nil, "Don't save the images from these registries.")
+
+	// Add flags related to the recert dry-run
+	createCmd.Flags().StringVar(&recertConfig.Image, "recert-image", seed.DefaultRecertImage, "The recert container image used for the dry-run, pulled through the cluster image mirrors if any.")
+	createCmd.Flags().StringVar(&recertConfig.CPUs, "recert-cpus", "", "CPU limit of the recert and etcd containers (podman --cpus).")
+	createCmd.Flags().StringVar(&recertConfig.Memory, "recert-memory", "", "Memory limit of the recert and etcd containers (podman --memory).")
+	createCmd.Flags().StringVar(&recertConfig.CgroupParent, "recert-cgroup-parent", "", "Cgroup slice the recert and etcd containers run in (podman --cgroup-parent).")
+
+	createCmd.Flags().StringVar(&recertConfig.SignaturePolicy, "signature-policy", "", "The containers policy.json the recert and etcd images are verified against (defaults to the host's).")
+	createCmd.Flags().BoolVar(&recertConfig.Secure, "secure", false, "Refuse recert and etcd images not verified by the signature policy.")
+	createCmd.Flags().BoolVar(&recertConfig.CopyEtcd, "recert-etcd-copy", false, "Run the recert dry-run against a copy of the etcd data instead of the live data.")
+	createCmd.Flags().DurationVar(&recertConfig.Timeout, "recert-timeout", 0, "Cancel the recert dry-run when it takes longer, removing its containers (e.g. 20m, not limited by default).")
+
+	// Add flags related to sensitive artifacts
+	createCmd.Flags().StringVar(&sshKeysPolicy, "include-ssh-keys", "", "Include the core user's SSH keys and customizations, restored with the given policy (seed, target or merge).")
+
+	createCmd.Flags().BoolVar(&mcsConfig.IncludeServerCerts, "include-mcs-certs", false, "Include the machine-config-server serving certificate, to serve ignition to future add-on nodes.")
+	createCmd.Flags().BoolVar(&mcsConfig.IncludeRenderedConfigs, "include-rendered-configs", false, "Include the rendered master and worker machine configs served by the machine-config-server.")
+	createCmd.Flags().BoolVar(&includeUsrLocal, "include-usr-local", false, "Include the files added to /usr/local outside ostree, when /usr/local isn't carried by the /var backup.")
+	createCmd.Flags().StringSliceVar(&extraArtifacts, "attach-extra-artifact", nil, "Attach a third-party file (e.g. a vendor license blob) to the seed as extra/<namespace>/<name>, given as <namespace>=<file>.")
+	createCmd.Flags().StringSliceVar(&includePaths, "include-path", nil, "Back up a host path the seed doesn't carry (e.g. /opt custom agents, /usr/local/bin scripts) into a tarball of its own, stored as extra/host-paths/<path>.tgz.")
+	createCmd.Flags().Int64Var(&extraArtifactsMaxMiB, "extra-artifacts-max-mib", seed.DefaultExtraArtifactsMaxSize>>20, "The maximum total size of the extra artifacts, in MiB.")
+	createCmd.Flags().BoolVar(&precachePlanConfig.Enabled, "precache-plan", false, "Resolve the digests, sizes and availability of the images to precache into precache-plan.json, so the target doesn't resolve them again.")
+	createCmd.Flags().IntVar(&precachePlanConfig.Workers, "precache-plan-workers", planner.DefaultWorkers, "The number of images resolved concurrently for the precache plan.")
+	createCmd.Flags().Float64Var(&precachePlanConfig.RequestsPerSecond, "precache-plan-rate", planner.DefaultRequestsPerSecond, "The maximum number of registry requests per second made for the precache plan.")
+	createCmd.Flags().StringVar(&auditLogPolicy, "audit-logs", seed.AuditLogPolicyExclude, "Whether /var/log/audit and the login records are carried in the seed (include or exclude).")
+	createCmd.Flags().StringSliceVar(&varExclude, "var-exclude", seed.DefaultVarExcludePatterns, "The paths excluded from the /var backup, replacing the defaults (the imager state, scratch files and backup dir are always excluded, the core user's SSH keys with --include-ssh-keys).")
+	createCmd.Flags().BoolVar(&keepCrio, "keep-crio", false, "Only stop kubelet and the running containers, keeping CRI-O running (its live state is excluded from the /var backup).")
+	createCmd.Flags().BoolVar(&strict, "strict", false, "Redo the steps whose inputs (e.g. /etc diff, ostree checksums) changed since a previous run, even if their artifacts exist.")
+	createCmd.Flags().BoolVar(&skipPreflight, "skip-preflight", false, "Skip the host and cluster readiness checks of the preflight command.")
+	addBackupDirFlag(createCmd)
+	addDiskGuardFlags(createCmd)
+	createCmd.Flags().StringSliceVar(&onlySteps, "only-steps", nil, "Only run these steps, by step or artifact name (see the explain command), keeping the other artifacts as left by previous runs.")
+	createCmd.Flags().StringSliceVar(&skipSteps, "skip-steps", nil, "Run every step but these, by step or artifact name.")
+	createCmd.Flags().BoolVar(&resume, "resume", false, "Continue an interrupted run after its last completed step, instead of running every step again.")
+	createCmd.Flags().BoolVar(&imageStore, "image-store", false, "Also push the seed images as a <tag>-image-store image, to mount through CRI-O's additionalimagestores.")
+	createCmd.Flags().StringVar(&lintRulesFile, "lint-rules", "", "YAML file with the seed content lint rules (defaults to the built-in rules).")
+	createCmd.Flags().BoolVar(&skipLint, "skip-lint", false, "Skip the seed content lint.")
+
+	// Add flags related to scheduling
+	createCmd.Flags().StringVar(&startAt, "start-at", "", "Wait until the maintenance window opens (RFC3339 timestamp or cron expression) before quiescing services.")
+
+	createCmd.Flags().BoolVar(&estimateDowntime, "estimate-downtime", false, "Print the predicted kubelet/crio downtime before quiescing services.")
+	createCmd.Flags().BoolVar(&confirm, "confirm", false, "Ask for confirmation after printing the predicted downtime.")
+
+	// Add flags related to notifications
+	createCmd.Flags().StringSliceVar(&notifyConfig.WebhookURLs, "notify-webhook", nil, "Webhook URLs receiving the run report as JSON when the run finishes.")
+	createCmd.Flags().StringSliceVar(&notifyConfig.SlackURLs, "notify-slack", nil, "Slack incoming webhook URLs notified when the run finishes.")
+	createCmd.Flags().StringSliceVar(&notifyConfig.EmailTo, "notify-email", nil, "Email addresses receiving the run report when the run finishes.")
+	createCmd.Flags().StringVar(&notifyConfig.SMTPServer, "smtp-server", "", "The SMTP relay (host:port) used to send email notifications.")
+	createCmd.Flags().StringVar(&notifyConfig.EmailFrom, "smtp-from", "", "The sender address of email notifications.")
+
+	// Add experimental flags
+	createCmd.Flags().StringVar(&nodeRole, "node-role", seed.NodeRoleMaster, "The role of the node the seed is captured from, worker needs the workerSeeds feature gate.")
 }
 
-func create() {
+func create(cmd *cobra.Command) {
 
 	var err error
 	log.Printf("OCI image creation has started")
 
+	if createConfigFile != "" {
+		if err = applySeedConfig(cmd); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	// Check if containerRegistry was provided by the user
 	if containerRegistry == "" {
-		fmt.Printf(" *** Please provide a valid container registry to store the created OCI images *** \n")
+		fmt.Fprintf(log.Out, " *** Please provide a valid container registry to store the created OCI images *** \n")
 		log.Info("Skipping OCI image creation.")
 		return
 	}
 
-	op := ops.NewOps(log, ops.NewExecutor(log, true))
-	rpmOstreeClient := ostree.NewClient("ibu-imager", op)
+	options := seed.Options{
+		BackupDir:             backupDir,
+		Kubeconfig:            kubeconfigFile,
+		Registry:              containerRegistry,
+		Tag:                   seedTag,
+		AuthFile:              authFile,
+		NodeRole:              nodeRole,
+		ImageFilter:           imageFilter,
+		Recert:                recertConfig,
+		SSHKeysPolicy:         sshKeysPolicy,
+		MCS:                   mcsConfig,
+		ImageStore:            imageStore,
+		AuditLogPolicy:        auditLogPolicy,
+		Strict:                strict,
+		MirrorRegistries:      mirrorRegistries,
+		KeepCrio:              keepCrio,
+		Resume:                resume,
+		SkipPush:              skipPush,
+		IncludeUsrLocal:       includeUsrLocal,
+		VarExcludePatterns:    varExclude,
+		PrecachePlan:          precachePlanConfig,
+		ExtraArtifactsMaxSize: extraArtifactsMaxMiB << 20,
+		IncludePaths:          includePaths,
+		FeatureGates:          featureGates,
+	}
+	for _, spec := range extraArtifacts {
+		extra, err := seed.ParseExtraArtifact(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		options.ExtraArtifacts = append(options.ExtraArtifacts, extra)
+	}
+	if err = oras.ValidateMode(artifactMode); err != nil {
+		log.Fatal(err)
+	}
+	if artifactMode == oras.ModeORAS {
+		if skipPush || imageStore {
+			log.Fatal("--artifact-mode oras can't be used with --skip-push or --image-store, no image is built")
+		}
+		options.ORAS = oras.NewClient(log, ops.NewExecutor(log, true), authFile)
+	}
+
+	if err = options.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	if options.DiskGuard, err = newDiskGuard(); err != nil {
+		log.Fatal(err)
+	}
+
+	if len(onlySteps) > 0 || len(skipSteps) > 0 {
+		if options.Steps, err = seed.NewStepSelection(onlySteps, skipSteps); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if outputArchive != "" {
+		if options.Output, err = seed.ParseOutput(outputArchive); err != nil {
+			log.Fatal(err)
+		}
+		if skipPush || artifactMode == oras.ModeORAS || len(mirrorRegistries) > 0 || signKey != "" {
+			log.Fatal("--output can't be used with --skip-push, --artifact-mode oras, --mirror-registry or --sign-key, nothing is pushed")
+		}
+	}
+
+	if signKey != "" {
+		if skipPush {
+			log.Fatal("--sign-key can't be used with --skip-push, sign the seed image after pushing it with the sign command")
+		}
+		if err = signer.ValidateKey(signKey); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if host_mounts.IsContainerized() {
+		if err = host_mounts.ValidateHostMounts(requiredHostMounts()); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	err = copyConfigurationFiles(op)
+	// The transcript of the run is packaged by support-bundle upload
+	if transcript, err := support.OpenTranscript(support.TranscriptFile); err != nil {
+		log.Warnf("The run transcript won't be kept: %v", err)
+	} else {
+		log.AddHook(transcript)
+		defer transcript.Close()
+	}
+
+	notifiers, err := notify.NewNotifiers(notifyConfig)
 	if err != nil {
-		log.Fatal("Failed to add configuration files", err)
+		log.Fatal(err)
+	}
+
+	if startAt != "" {
+		if err = waitForMaintenanceWindow(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if options.LintRules, err = loadLintRules(); err != nil {
+		log.Fatal(err)
+	}
+
+	op := newOps()
+	options.OstreeClient = ostree.NewClient("ibu-imager", op)
+	options.Runtime = newRuntime(op)
+
+	if options.Meter, err = resource_usage.NewMeter(); err != nil {
+		log.Warnf("Stage resource usage won't be accounted: %v", err)
+	}
+
+	ctx, stop := runContext()
+	defer stop()
+	options.Context = ctx
+
+	seedCreator := seed.NewSeedCreator(log, op, options)
+	// A resumed run may have stopped the services already, the checks would fail
+	if !skipPreflight && !resume {
+		report := seedCreator.Preflight()
+		printPreflightReport(log.Out, report)
+		savePreflightReport(report)
+		if !report.Passed() {
+			log.Fatal("Preflight checks failed, fix them or run with --skip-preflight")
+		}
+	}
+	if estimateDowntime || confirm {
+		if !confirmDowntime(seedCreator) {
+			log.Info("Seed creation cancelled.")
+			return
+		}
 	}
 
-	seedCreator := seed.NewSeedCreator(log, op, rpmOstreeClient, backupDir, kubeconfigFile,
-		containerRegistry, backupTag, authFile)
 	err = seedCreator.CreateSeedImage()
+	if err == nil && signKey != "" {
+		err = signPushes(seedCreator.Report().Pushes)
+	}
+	notify.NotifyAll(log, notifiers, seedCreator.Report())
+	if jsonOutput(false) {
+		printJSON(createResult{RunReport: seedCreator.Report(), Digest: pushedDigest(seedCreator.Report().Pushes)})
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -84,36 +414,167 @@ func create() {
 	log.Printf("OCI image created successfully!")
 }
 
-// TODO: move those functions to seed creator and add cleanup
-func copyConfigurationFiles(ops ops.Ops) error {
-	// copy scripts
-	err := copyConfigurationScripts()
+// applySeedConfig sets the create flags not given on the command line out of the seed config
+func applySeedConfig(cmd *cobra.Command) error {
+	settings, err := seedconfig.Load(createConfigFile)
 	if err != nil {
 		return err
 	}
+	for _, setting := range settings {
+		if cmd.LocalFlags().Lookup(setting.Flag) == nil || setting.Flag == "config" {
+			return fmt.Errorf("Seed config %s: unknown create flag %q", createConfigFile, setting.Flag)
+		}
+		if cmd.Flags().Changed(setting.Flag) {
+			log.Debugf("--%s given on the command line overrides the seed config", setting.Flag)
+			continue
+		}
+		if err = cmd.Flags().Set(setting.Flag, setting.Value); err != nil {
+			return fmt.Errorf("Seed config %s: invalid %s: %w", createConfigFile, setting.Flag, err)
+		}
+	}
+	return nil
+}
 
-	return handleServices(ops)
+// requiredHostMounts returns the host mounts of the seed creation, with the backup dir when it's out of /var
+func requiredHostMounts() map[string]string {
+	if strings.HasPrefix(filepath.Clean(backupDir), "/var/") {
+		return host_mounts.RequiredHostMounts
+	}
+	mounts := map[string]string{backupDir: "the backup dir and the podman build context"}
+	for mount, reason := range host_mounts.RequiredHostMounts {
+		mounts[mount] = reason
+	}
+	return mounts
 }
 
-func copyConfigurationScripts() error {
-	log.Infof("Copying installation_configuration_files/scripts to local/bin")
-	return cp.Copy("installation_configuration_files/scripts", "/var/usrlocal/bin", cp.Options{AddPermission: os.FileMode(0777)})
+// addBackupDirFlag adds the flag of the backup dir the artifacts are written to
+func addBackupDirFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&backupDir, "backup-dir", seed.DefaultBackupDir, "The dir the artifacts are written to and the seed image is built from, e.g. on a larger filesystem than /var/tmp (excluded from the /var backup).")
 }
 
-func handleServices(ops ops.Ops) error {
-	dir := "installation_configuration_files/services"
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if info.IsDir() {
-			return nil
-		}
-		log.Infof("Creating service %s", info.Name())
-		errC := cp.Copy(filepath.Join(dir, info.Name()), filepath.Join("/etc/systemd/system/", info.Name()))
-		if errC != nil {
-			return errC
-		}
-		log.Infof("Enabling service %s", info.Name())
-		_, errC = ops.SystemctlAction("enable", info.Name())
-		return errC
-	})
-	return err
+// addDiskGuardFlags adds the flags of the disk guard aborting the run before it fills the backup dir filesystem
+func addDiskGuardFlags(cmd *cobra.Command) {
+	cmd.Flags().Float64Var(&minFreePercent, "min-free-percent", seed.DefaultMinFreePercent, "Abort and roll back the run when the free space of the backup dir filesystem falls below this percentage (0 disables it).")
+	cmd.Flags().Float64Var(&maxWrittenGiB, "max-written-gib", 0, "Abort and roll back the run when it grew the backup dir filesystem usage by more than this many GiB (0 is unlimited).")
+}
+
+// newDiskGuard returns the disk guard of the flags, nil when it's disabled
+func newDiskGuard() (*seed.DiskGuard, error) {
+	if minFreePercent == 0 && maxWrittenGiB == 0 {
+		return nil, nil
+	}
+	if maxWrittenGiB < 0 {
+		return nil, fmt.Errorf("--max-written-gib can't be negative")
+	}
+	guard := &seed.DiskGuard{MinFreePercent: minFreePercent, MaxWrittenBytes: uint64(maxWrittenGiB * (1 << 30))}
+	return guard, guard.Validate()
+}
+
+// signPushes signs the seed image in every registry it was pushed to, failing only when the primary
+// registry one fails like the push itself
+func signPushes(pushes []seed.PushStatus) error {
+	client, err := registry.NewClient(authFile)
+	if err != nil {
+		return err
+	}
+	seedSigner := signer.NewSigner(log, ops.NewExecutor(log, true), client, signKey, authFile)
+	for i, push := range pushes {
+		if push.Error != "" {
+			continue
+		}
+		signed, err := seedSigner.Sign(push.Image)
+		if err != nil {
+			if push.Primary {
+				return err
+			}
+			log.Warnf("Failed to sign the seed image in mirror %s: %v", push.Image, err)
+			continue
+		}
+		pushes[i].Signature = signed
+	}
+	return nil
+}
+
+// createResult is the create result printed as JSON: the run report with the digest of the pushed seed image
+type createResult struct {
+	*seed.RunReport
+	// Digest is the digest of the seed image in the primary registry, empty when it wasn't pushed
+	Digest string `json:"digest,omitempty"`
+}
+
+// pushedDigest returns the digest of the seed image pushed to the primary registry, empty when it wasn't
+func pushedDigest(pushes []seed.PushStatus) string {
+	for _, push := range pushes {
+		if !push.Primary || push.Error != "" {
+			continue
+		}
+		ref, err := registry.ParseReference(push.Image)
+		if err != nil {
+			log.Warnf("Failed to resolve the digest of %s: %v", push.Image, err)
+			return ""
+		}
+		client, err := registry.NewClient(authFile)
+		if err == nil {
+			var digest string
+			if digest, err = client.ResolveDigest(ref); err == nil {
+				return digest
+			}
+		}
+		log.Warnf("Failed to resolve the digest of %s: %v", push.Image, err)
+	}
+	return ""
+}
+
+// confirmDowntime prints the predicted downtime and, with --confirm, asks whether to proceed
+func confirmDowntime(seedCreator *seed.SeedCreator) bool {
+	estimate, err := seedCreator.EstimateDowntime()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintln(log.Out, estimate)
+	if !confirm {
+		return true
+	}
+
+	fmt.Fprint(log.Out, "Proceed with stopping kubelet and crio? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// loadLintRules returns the seed content lint rules, or nil when the lint is skipped
+func loadLintRules() (*lint.RuleSet, error) {
+	if skipLint {
+		return nil, nil
+	}
+	rules := lint.DefaultRuleSet()
+	if lintRulesFile != "" {
+		var err error
+		if rules, err = lint.LoadRuleSet(lintRulesFile); err != nil {
+			return nil, err
+		}
+	}
+	return rules, rules.Compile()
+}
+
+// runContext returns the context of the run, cancelled by the first SIGINT or SIGTERM so the run stops and
+// removes its helper containers. The signals after it terminate the imager as usual.
+func runContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+// waitForMaintenanceWindow blocks until --start-at, unless interrupted
+func waitForMaintenanceWindow() error {
+	at, err := schedule.NextStart(startAt, time.Now())
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return schedule.WaitUntil(ctx, log, at)
 }
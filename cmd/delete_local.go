@@ -0,0 +1,60 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	seed "ibu-imager/internal/seed_creator"
+)
+
+// deleteLocalDryRun lists the images that would be deleted
+var deleteLocalDryRun bool
+
+// deleteLocalCmd represents the delete-local command
+var deleteLocalCmd = &cobra.Command{
+	Use:   "delete-local",
+	Short: "Delete the seed images built by the imager from the local container storage.",
+	Long: `Delete the seed images built by the imager from the local container storage.
+
+The image store build dirs and the cached layer digests go with them. With --ssh-host, delete-local
+runs against a remote node from an admin workstation.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		deleteLocal()
+	},
+}
+
+func init() {
+
+	// Add delete-local command
+	rootCmd.AddCommand(deleteLocalCmd)
+
+	deleteLocalCmd.Flags().BoolVar(&deleteLocalDryRun, "dry-run", false, "List the images that would be deleted, without deleting them.")
+	addBackupDirFlag(deleteLocalCmd)
+	addSSHFlags(deleteLocalCmd)
+}
+
+func deleteLocal() {
+
+	if err := seed.ValidateBackupDir(backupDir); err != nil {
+		log.Fatal(err)
+	}
+	op := newOps()
+	if err := seed.DeleteLocal(log, op, newRuntime(op), backupDir, deleteLocalDryRun); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	registry "ibu-imager/internal/registry_client"
+	differ "ibu-imager/internal/seed_diff"
+)
+
+// diffJSON prints the diff as JSON
+var diffJSON bool
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff imageA imageB",
+	Short: "Print what changed between two seed images in the registry.",
+	Long: `Print what changed between two seed images in the registry.
+
+The seed manifests and artifacts, the booted rpm-ostree deployment, the MCO currentconfig and the /etc
+content and deletions of imageA and imageB are compared, e.g. to validate a refreshed seed against the
+previous one. Artifacts with the same digest in both images aren't downloaded.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		diff(args[0], args[1])
+	},
+}
+
+func init() {
+
+	// Add diff command
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().StringVarP(&authFile, "authfile", "a", imageRegistryAuthFile, "The path to the authentication file of the container registry.")
+	diffCmd.Flags().BoolVar(&diffJSON, "json", false, "Print the diff as JSON, like --output-format json.")
+}
+
+func diff(imageA, imageB string) {
+
+	client, err := registry.NewClient(authFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var seeds []*differ.Seed
+	for _, image := range []string{imageA, imageB} {
+		ref, err := registry.ParseReference(image)
+		if err != nil {
+			log.Fatal(err)
+		}
+		seed, err := differ.RemoteSeed(client, ref)
+		if err != nil {
+			log.Fatal(err)
+		}
+		seeds = append(seeds, seed)
+	}
+	result, err := differ.Diff(seeds[0], seeds[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if jsonOutput(diffJSON) {
+		printJSON(result)
+		return
+	}
+	if result.Identical() {
+		fmt.Printf("%s and %s are identical\n", result.Old, result.New)
+		return
+	}
+	fmt.Printf("--- %s\n+++ %s\n", result.Old, result.New)
+	for _, section := range result.Sections {
+		if len(section.Changes) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s:\n", section.Name)
+		for _, change := range section.Changes {
+			switch change.Kind {
+			case differ.Added:
+				fmt.Printf("  + %s %s\n", change.Name, change.New)
+			case differ.Removed:
+				fmt.Printf("  - %s %s\n", change.Name, change.Old)
+			default:
+				fmt.Printf("  ~ %s: %s -> %s\n", change.Name, change.Old, change.New)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	seed "ibu-imager/internal/seed_creator"
+)
+
+// explainCmd represents the explain command
+var explainCmd = &cobra.Command{
+	Use:   "explain [stage|artifact]",
+	Short: "Describe the seed creation stages and the artifacts they produce.",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		explain(args)
+	},
+}
+
+func init() {
+
+	// Add explain command
+	rootCmd.AddCommand(explainCmd)
+}
+
+func explain(args []string) {
+
+	if len(args) == 0 {
+		for _, step := range seed.Steps() {
+			printStep(step)
+		}
+		return
+	}
+
+	step, err := seed.LookupStep(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	printStep(step)
+}
+
+func printStep(step seed.Step) {
+	fmt.Printf("%s\n  %s\n", step.Name, step.Description)
+	if len(step.HostPaths) > 0 {
+		fmt.Printf("  Host paths: %s\n", strings.Join(step.HostPaths, ", "))
+	}
+	if len(step.Services) > 0 {
+		fmt.Printf("  Services:   %s\n", strings.Join(step.Services, ", "))
+	}
+	if len(step.Artifacts) > 0 {
+		fmt.Printf("  Artifacts:  %s\n", strings.Join(step.Artifacts, ", "))
+	}
+	fmt.Println()
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	seed "ibu-imager/internal/seed_creator"
+)
+
+// exportConfig selects the seed image built with create --skip-push
+var exportConfig seed.ExportConfig
+
+// exportOutput is the output the seed image is exported to, parsed into exportConfig
+var exportOutput string
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export a seed image built with create --skip-push to an OCI archive.",
+	Long: `Export a seed image built with create --skip-push to an OCI archive.
+
+The seed image is taken from the local storage, as tagged by create for --registry, and written to the
+--output archive with a sha256sum file next to it, to be carried into disconnected sites and loaded there,
+e.g. with skopeo copy oci-archive:seed.tar docker://<registry>/<seed>:<tag>.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		export()
+	},
+}
+
+func init() {
+
+	// Add export command
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringVarP(&exportConfig.Registry, "registry", "r", "", "The container registry the seed image was built for with create --registry.")
+	exportCmd.Flags().StringVar(&exportConfig.Tag, "tag", seed.DefaultTag, "The tag of the seed image, as create resolved it.")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "The archive the seed image is exported to, as oci-archive:/path/seed.tar.")
+	exportCmd.Flags().BoolVar(&exportConfig.ImageStore, "image-store", false, "Also export the <tag>-image-store image built with create --image-store, to <path>-image-store.tar.")
+}
+
+func export() {
+
+	output, err := seed.ParseOutput(exportOutput)
+	if err != nil {
+		log.Fatal(err)
+	}
+	exportConfig.Output = output
+
+	op := newOps()
+	if _, err = seed.Export(log, op, newRuntime(op), exportConfig); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Seed image exported successfully!")
+}
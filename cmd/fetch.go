@@ -0,0 +1,94 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	registry "ibu-imager/internal/registry_client"
+	verifier "ibu-imager/internal/seed_verify"
+)
+
+// fetchArtifact is the seed artifact downloaded
+var fetchArtifact string
+
+// fetchDest is the file or directory the artifact is downloaded to
+var fetchDest string
+
+// fetchImage is the seed image the artifact is downloaded from, when not given as argument
+var fetchImage string
+
+// fetchCmd represents the fetch command
+var fetchCmd = &cobra.Command{
+	Use:     "fetch [image]",
+	Aliases: []string{"extract"},
+	Short:   "Download a single artifact of a seed image, verifying its digest.",
+	Long: `Download a single artifact of a seed image, verifying its digest.
+
+Only the layer holding the artifact is downloaded from the registry, e.g. containers.list for precache
+planning. Both the layer digest and the artifact digest the image is labeled with are verified. An
+interrupted download is kept next to the destination and resumed by the next fetch.
+
+The image is given as argument or with --image, e.g.
+
+  ibu-imager extract --image quay.io/org/seed:v1 --artifact recert.summary --to /tmp/`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) > 0 {
+			if fetchImage != "" && fetchImage != args[0] {
+				log.Fatalf("The image is given both as argument (%s) and with --image (%s)", args[0], fetchImage)
+			}
+			fetchImage = args[0]
+		}
+		fetch(fetchImage)
+	},
+}
+
+func init() {
+
+	// Add fetch command
+	rootCmd.AddCommand(fetchCmd)
+
+	fetchCmd.Flags().StringVar(&fetchImage, "image", "", "The seed image the artifact is downloaded from, instead of the image argument.")
+	fetchCmd.Flags().StringVar(&fetchArtifact, "artifact", "", "The name of the artifact to download, e.g. var.tgz.")
+	fetchCmd.Flags().StringVar(&fetchDest, "to", ".", "The file or directory the artifact is downloaded to.")
+	fetchCmd.Flags().StringVarP(&authFile, "authfile", "a", imageRegistryAuthFile, "The path to the authentication file of the container registry.")
+}
+
+func fetch(image string) {
+
+	if image == "" {
+		log.Fatal("Please provide the seed image as argument or with --image")
+	}
+	if fetchArtifact == "" {
+		log.Fatal("Please provide the artifact to download with --artifact")
+	}
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := registry.NewClient(authFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	dest, err := verifier.FetchArtifact(client, ref, fetchArtifact, fetchDest)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("Artifact %s of %s downloaded and verified to %s", fetchArtifact, image, dest)
+}
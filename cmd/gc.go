@@ -0,0 +1,61 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	seed "ibu-imager/internal/seed_creator"
+)
+
+// gcDryRun lists what would be removed
+var gcDryRun bool
+
+// gcCmd represents the gc command
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove every container and image created by the imager.",
+	Long: `Remove every container and image created by the imager.
+
+The recert and etcd containers and the seed builds are labeled with io.openshift.ibu.created-by and
+the run-id of the run that created them, gc removes anything carrying these labels, whatever run left it behind.
+With --ssh-host, gc runs against a remote node from an admin workstation.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		gc()
+	},
+}
+
+func init() {
+
+	// Add gc command
+	rootCmd.AddCommand(gcCmd)
+
+	gcCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "List what would be removed, without changing the host.")
+	addBackupDirFlag(gcCmd)
+	addSSHFlags(gcCmd)
+}
+
+func gc() {
+
+	if err := seed.ValidateBackupDir(backupDir); err != nil {
+		log.Fatal(err)
+	}
+	op := newOps()
+	if err := seed.GC(log, op, newRuntime(op), backupDir, gcDryRun); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	systemd "ibu-imager/internal/systemd_unit"
+)
+
+var (
+	// unitConfig describes the generated service and timer
+	unitConfig systemd.Config
+	// unitDir is the directory the units are written to, they're printed when empty
+	unitDir string
+)
+
+// generateUnitCmd represents the generate-unit command
+var generateUnitCmd = &cobra.Command{
+	Use:   "generate-unit [flags] -- command [args...]",
+	Short: "Generate a systemd service, and optional timer, running an ibu-imager command.",
+	Long: `Generate a systemd service, and optional timer, running an ibu-imager command.
+
+The oneshot service runs the ibu-imager command line given after --, in the imager container with the
+privileges, host namespaces and mounts it needs, or with the ibu-imager binary of the host when no imager
+image is set. With --schedule, a timer starts it on the schedule, e.g. to refresh the seed image monthly:
+
+  ibu-imager generate-unit --imager-image quay.io/org/ibu-imager:4.14.0 --schedule monthly -o /etc/systemd/system \
+    -- create --authfile /var/lib/kubelet/config.json --registry quay.io/org/seed
+  systemctl daemon-reload && systemctl enable --now ibu-imager-refresh.timer`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		generateUnit(args)
+	},
+}
+
+func init() {
+
+	// Add generate-unit command
+	rootCmd.AddCommand(generateUnitCmd)
+
+	generateUnitCmd.Flags().StringVar(&unitConfig.Name, "name", systemd.DefaultName, "The name of the units, without their .service and .timer suffixes.")
+	generateUnitCmd.Flags().StringVar(&unitConfig.ImagerImage, "imager-image", "", "The ibu-imager container image the service runs (defaults to running --binary on the host).")
+	generateUnitCmd.Flags().StringVar(&unitConfig.Binary, "binary", systemd.DefaultBinary, "The ibu-imager binary the service runs on the host when no imager image is set.")
+	generateUnitCmd.Flags().StringVarP(&unitConfig.AuthFile, "authfile", "a", imageRegistryAuthFile, "The path to the authentication file podman pulls the imager image with.")
+	generateUnitCmd.Flags().StringArrayVar(&unitConfig.Environment, "env", nil, "A KEY=VALUE environment variable of the service, e.g. the proxy settings, can be repeated.")
+	generateUnitCmd.Flags().StringVar(&unitConfig.Schedule, "schedule", "", "The systemd calendar expression of the timer, e.g. monthly (no timer when empty).")
+	generateUnitCmd.Flags().DurationVar(&unitConfig.RandomizedDelay, "randomized-delay", 0, "Delay the scheduled runs by a random time up to this, e.g. 1h.")
+	generateUnitCmd.Flags().StringVarP(&unitDir, "output-dir", "o", "", "The directory the units are written to, e.g. /etc/systemd/system (printed when empty).")
+}
+
+func generateUnit(args []string) {
+
+	unitConfig.Args = args
+	units, err := systemd.Generate(&unitConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if unitDir == "" {
+		for i, unit := range units {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("# %s\n%s", unit.Name, unit.Contents)
+		}
+		return
+	}
+
+	var written []string
+	for _, unit := range units {
+		file := filepath.Join(unitDir, unit.Name)
+		if err = os.WriteFile(file, []byte(unit.Contents), 0644); err != nil {
+			log.Fatalf("Failed to write %s: %v", file, err)
+		}
+		written = append(written, file)
+	}
+	log.Infof("Wrote %s, run systemctl daemon-reload to load them", strings.Join(written, ", "))
+}
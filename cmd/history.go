@@ -0,0 +1,160 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	seed "ibu-imager/internal/seed_creator"
+)
+
+// historyDiff compares the last two runs instead of listing them
+var historyDiff bool
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List the past seed creation runs, or diff the last two ones.",
+	Run: func(cmd *cobra.Command, args []string) {
+		history()
+	},
+}
+
+func init() {
+
+	// Add history command
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().BoolVar(&historyDiff, "diff", false, "Show how stage durations, resource usage and artifact sizes changed between the last two runs.")
+}
+
+func history() {
+
+	reports, err := seed.LoadHistory(seed.HistoryDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(reports) == 0 {
+		log.Infof("No runs recorded in %s", seed.HistoryDir)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	if !historyDiff {
+		fmt.Fprintln(w, "STARTED\tRESULT\tDURATION\tIMAGE")
+		for _, report := range reports {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", report.StartedAt.Format(time.RFC3339), report.Result,
+				report.FinishedAt.Sub(report.StartedAt).Round(time.Second), report.Image)
+		}
+		return
+	}
+
+	if len(reports) < 2 {
+		log.Fatal("At least two runs are needed to diff")
+	}
+	previous, current := reports[len(reports)-2], reports[len(reports)-1]
+	steps, artifacts := seed.DiffReports(&previous, &current)
+	fmt.Fprintf(w, "Comparing %s to %s\n\n", previous.StartedAt.Format(time.RFC3339), current.StartedAt.Format(time.RFC3339))
+	fmt.Fprintln(w, "STAGE\tPREVIOUS\tCURRENT\tCHANGE")
+	for _, delta := range steps {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", delta.Name, formatDuration(delta.Previous), formatDuration(delta.Current),
+			formatChange(delta, formatDuration))
+	}
+	fmt.Fprintln(w, "\nARTIFACT\tPREVIOUS\tCURRENT\tCHANGE")
+	for _, delta := range artifacts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", delta.Name, formatSize(delta.Previous), formatSize(delta.Current),
+			formatChange(delta, formatSize))
+	}
+
+	cpu, memory, io := seed.DiffStepUsage(&previous, &current)
+	usage := []struct {
+		header string
+		deltas []seed.ReportDelta
+		format func(int64) string
+	}{
+		{"STAGE CPU TIME", cpu, formatCPUTime},
+		{"STAGE PEAK MEMORY", memory, formatSize},
+		{"STAGE I/O", io, formatSize},
+	}
+	var measured bool
+	for _, table := range usage {
+		if len(table.deltas) == 0 {
+			continue
+		}
+		measured = true
+		fmt.Fprintf(w, "\n%s\tPREVIOUS\tCURRENT\tCHANGE\n", table.header)
+		for _, delta := range table.deltas {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", delta.Name, table.format(delta.Previous), table.format(delta.Current),
+				formatChange(delta, table.format))
+		}
+	}
+	if measured && current.UsageScope != "" {
+		fmt.Fprintf(w, "\nThe stage resource usage accounts for %s.\n", current.UsageScope)
+	}
+}
+
+func formatDuration(d int64) string {
+	if d < 0 {
+		return "-"
+	}
+	return time.Duration(d).Round(time.Second).String()
+}
+
+// formatCPUTime formats a CPU time, which is too short for the second rounding of stage durations
+func formatCPUTime(d int64) string {
+	if d < 0 {
+		return "-"
+	}
+	return time.Duration(d).Round(time.Millisecond).String()
+}
+
+func formatSize(size int64) string {
+	if size < 0 {
+		return "-"
+	}
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// formatChange returns the signed change between two runs, or whether the entry was added or removed
+func formatChange(delta seed.ReportDelta, format func(int64) string) string {
+	switch {
+	case delta.Previous < 0:
+		return "added"
+	case delta.Current < 0:
+		return "removed"
+	case delta.Change() < 0:
+		return "-" + format(-delta.Change())
+	default:
+		return "+" + format(delta.Change())
+	}
+}
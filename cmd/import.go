@@ -0,0 +1,63 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	seed "ibu-imager/internal/seed_creator"
+)
+
+// importConfig selects the seed archive and where it's imported to
+var importConfig seed.ImportConfig
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Load a seed OCI or docker archive into the local storage or a container registry.",
+	Long: `Load a seed OCI or docker archive into the local storage or a container registry.
+
+The archive, e.g. written by export or create --output, is checked against the sha256sum file next to it
+when there's one, and loaded into the local storage. The seed image is then pushed to --registry, under
+its exported tag unless --tag is set, or left in the local storage for restore --local-image.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		importSeed()
+	},
+}
+
+func init() {
+
+	// Add import command
+	rootCmd.AddCommand(importCmd)
+
+	importCmd.Flags().StringVarP(&importConfig.Archive, "input", "i", "", "The seed archive to import.")
+	importCmd.Flags().StringVarP(&importConfig.AuthFile, "authfile", "a", imageRegistryAuthFile, "The path to the authentication file of the container registry.")
+	importCmd.Flags().StringVarP(&importConfig.Registry, "registry", "r", "", "The container registry the seed image is pushed to (left in the local storage without).")
+	importCmd.Flags().StringVarP(&importConfig.Tag, "tag", "t", "", "Push the seed image under this tag instead of the one it was exported with.")
+	importCmd.Flags().BoolVar(&importConfig.ImageStore, "image-store", false, "Also import the <input>-image-store.tar archive written by export --image-store.")
+	importCmd.Flags().BoolVar(&importConfig.SkipChecksum, "skip-checksum", false, "Load the archive without checking it against its sha256sum file.")
+}
+
+func importSeed() {
+
+	op := newOps()
+	images, err := seed.Import(log, op, newRuntime(op), importConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Seed image imported successfully as %s!", images[0])
+}
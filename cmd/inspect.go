@@ -0,0 +1,140 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	registry "ibu-imager/internal/registry_client"
+	inspector "ibu-imager/internal/seed_inspect"
+)
+
+// inspectCmd represents the inspect command
+var inspectCmd = &cobra.Command{
+	Use:   "inspect image",
+	Short: "Print the metadata of a seed image in the registry.",
+	Long: `Print the metadata of a seed image in the registry.
+
+The OCP version, architecture, creation time, artifact sizes and recert dry-run summary are read from the
+image config and the seed manifest and recert summary layers, without pulling the image. The extra artifacts
+attached to the seed are listed with their checksums, fetch downloads them by path.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		inspect(args[0])
+	},
+}
+
+func init() {
+
+	// Add inspect command
+	rootCmd.AddCommand(inspectCmd)
+
+	inspectCmd.Flags().StringVarP(&authFile, "authfile", "a", imageRegistryAuthFile, "The path to the authentication file of the container registry.")
+}
+
+func inspect(image string) {
+
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := registry.NewClient(authFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	info, err := inspector.Inspect(client, ref)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if jsonOutput(false) {
+		printJSON(info)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Image:\t%s\n", info.Image)
+	fmt.Fprintf(w, "Kind:\t%s (%s node)\n", info.Manifest.Kind, info.Manifest.NodeRole)
+	if imager := info.Manifest.Imager; imager != nil {
+		fmt.Fprintf(w, "Imager:\t%s (seed format %d)\n", imager.Version, info.Manifest.SchemaVersion)
+	}
+	if version := info.Manifest.ClusterVersion; version != nil {
+		channel := ""
+		if version.Channel != "" {
+			channel = " (" + version.Channel + ")"
+		}
+		fmt.Fprintf(w, "OCP version:\t%s%s\n", version.Version, channel)
+	}
+	if etcd := info.Manifest.Etcd; etcd != nil {
+		fmt.Fprintf(w, "etcd:\t%s (%s in use), %d keys, revision %d\n", formatSize(etcd.DBSize), formatSize(etcd.DBSizeInUse),
+			etcd.Keys, etcd.Revision)
+		var largest []string
+		for _, resource := range etcd.LargestResources {
+			largest = append(largest, fmt.Sprintf("%s (%d)", resource.Resource, resource.Keys))
+		}
+		if len(largest) > 0 {
+			fmt.Fprintf(w, "Largest resources:\t%s\n", strings.Join(largest, ", "))
+		}
+	}
+	if gates := enabledFeatureGates(info.Manifest.FeatureGates); len(gates) > 0 {
+		fmt.Fprintf(w, "Feature gates:\t%s\n", strings.Join(gates, ", "))
+	}
+	fmt.Fprintf(w, "Architecture:\t%s/%s\n", info.OS, info.Architecture)
+	fmt.Fprintf(w, "Created:\t%s\n", info.Created.Format(time.RFC3339))
+	fmt.Fprintf(w, "Size:\t%s\n", formatSize(info.Size()))
+
+	fmt.Fprintln(w, "\nARTIFACT\tSIZE\tDIGEST")
+	for _, artifact := range info.Artifacts {
+		digest := artifact.Digest
+		if digest == "" {
+			digest = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", artifact.Name, formatSize(artifact.LayerSize), digest)
+	}
+	if len(info.Manifest.ExtraArtifacts) > 0 {
+		fmt.Fprintln(w, "\nEXTRA ARTIFACT\tSIZE\tDIGEST")
+		for _, extra := range info.Manifest.ExtraArtifacts {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", extra.Path, formatSize(extra.Size), extra.Digest)
+		}
+	}
+	w.Flush()
+
+	if info.RecertSummary != "" {
+		fmt.Println("\nRecert summary:")
+		for _, line := range strings.Split(info.RecertSummary, "\n") {
+			fmt.Println("  " + line)
+		}
+	}
+}
+
+// enabledFeatureGates returns the names of the feature gates enabled when the seed was created, sorted
+func enabledFeatureGates(states map[string]bool) []string {
+	var enabled []string
+	for name, state := range states {
+		if state {
+			enabled = append(enabled, name)
+		}
+	}
+	sort.Strings(enabled)
+	return enabled
+}
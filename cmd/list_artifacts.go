@@ -0,0 +1,97 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	registry "ibu-imager/internal/registry_client"
+	inspector "ibu-imager/internal/seed_inspect"
+)
+
+var (
+	// contentSizes also reads the .tgz artifacts to sum the size of the files they archive
+	contentSizes bool
+	// listArtifactsJSON prints the artifacts as JSON
+	listArtifactsJSON bool
+)
+
+// listArtifactsCmd represents the list-artifacts command
+var listArtifactsCmd = &cobra.Command{
+	Use:   "list-artifacts image",
+	Short: "List the artifacts of a seed image in the registry with their sizes.",
+	Long: `List the artifacts of a seed image in the registry with their sizes.
+
+Every artifact is listed with the compressed size of its layer, its uncompressed size and its checksum, to
+tell which artifacts made a seed image grow. Only the start of the layers is read, unless --content-sizes
+also downloads the .tgz artifacts to sum the size of the files they archive.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		listArtifacts(args[0])
+	},
+}
+
+func init() {
+
+	// Add list-artifacts command
+	rootCmd.AddCommand(listArtifactsCmd)
+
+	listArtifactsCmd.Flags().StringVarP(&authFile, "authfile", "a", imageRegistryAuthFile, "The path to the authentication file of the container registry.")
+	listArtifactsCmd.Flags().BoolVar(&contentSizes, "content-sizes", false, "Download the .tgz artifacts to also print the size of the files they archive.")
+	listArtifactsCmd.Flags().BoolVar(&listArtifactsJSON, "json", false, "Print the artifacts as JSON, like --output-format json.")
+}
+
+func listArtifacts(image string) {
+
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := registry.NewClient(authFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	artifacts, err := inspector.ListArtifacts(client, ref, contentSizes)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if jsonOutput(listArtifactsJSON) {
+		printJSON(artifacts)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ARTIFACT\tCOMPRESSED\tSIZE\tCONTENT\tDIGEST")
+	var compressed, size int64
+	for _, artifact := range artifacts {
+		digest := artifact.Digest
+		if digest == "" {
+			digest = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", artifact.Name, formatSize(artifact.CompressedSize),
+			formatSize(artifact.Size), formatSize(artifact.ContentSize), digest)
+		compressed += artifact.CompressedSize
+		size += artifact.Size
+	}
+	fmt.Fprintf(w, "TOTAL\t%s\t%s\t\t\n", formatSize(compressed), formatSize(size))
+	w.Flush()
+}
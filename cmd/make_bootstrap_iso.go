@@ -0,0 +1,100 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	bootstrap "ibu-imager/internal/bootstrap_iso"
+	"ibu-imager/internal/ops"
+)
+
+// bootstrapConfig describes how the target node is bootstrapped into the seed
+var bootstrapConfig bootstrap.Config
+
+// liveISO is the RHCOS live ISO the bootstrap ISO is made from
+var liveISO string
+
+// bootstrapISO is the path of the generated bootstrap ISO
+var bootstrapISO string
+
+// pullSecretFile is the registry credentials embedded in the bootstrap ISO
+var pullSecretFile string
+
+// sshKeyFiles are the public SSH keys authorized on the bootstrapped node
+var sshKeyFiles []string
+
+// makeBootstrapISOCmd represents the make-bootstrap-iso command
+var makeBootstrapISOCmd = &cobra.Command{
+	Use:   "make-bootstrap-iso",
+	Short: "Make an RHCOS live ISO that reprovisions a bare-metal target directly into a seed image.",
+	Long: `Make an RHCOS live ISO that reprovisions a bare-metal target directly into a seed image.
+
+The live ISO installs RHCOS to the install disk and reboots. On first boot, the installed system
+runs the restore of the seed image from the ibu-imager container image, then reboots into the seed.
+The ibu-imager binary is pulled as a container image rather than embedded, keeping the Ignition
+config within the size embeddable in the ISO: the image must be of an imager version having the
+restore command, which the target checks before restoring. Requires coreos-installer on the local host.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		makeBootstrapISO()
+	},
+}
+
+func init() {
+
+	// Add make-bootstrap-iso command
+	rootCmd.AddCommand(makeBootstrapISOCmd)
+
+	// Add flags related to the bootstrap ISO
+	makeBootstrapISOCmd.Flags().StringVarP(&liveISO, "live-iso", "i", "", "The RHCOS live ISO to make the bootstrap ISO from.")
+	makeBootstrapISOCmd.Flags().StringVarP(&bootstrapISO, "output", "o", "bootstrap.iso", "The path of the generated bootstrap ISO.")
+	makeBootstrapISOCmd.Flags().StringVar(&bootstrapConfig.SeedImage, "seed-image", "", "The seed image the target is restored from.")
+	makeBootstrapISOCmd.Flags().StringVar(&bootstrapConfig.ImagerImage, "imager-image", "", "The ibu-imager container image running the restore on the target.")
+	makeBootstrapISOCmd.Flags().StringVar(&bootstrapConfig.InstallDisk, "install-disk", "", "The target disk RHCOS is installed to, e.g. /dev/sda.")
+	makeBootstrapISOCmd.Flags().StringVarP(&pullSecretFile, "authfile", "a", "", "The registry credentials used by the target to pull the imager and seed images.")
+	makeBootstrapISOCmd.Flags().StringSliceVar(&sshKeyFiles, "ssh-key", nil, "Public SSH key files authorized for the core user of the target, for troubleshooting.")
+
+	makeBootstrapISOCmd.MarkFlagRequired("live-iso")
+	makeBootstrapISOCmd.MarkFlagRequired("seed-image")
+	makeBootstrapISOCmd.MarkFlagRequired("imager-image")
+	makeBootstrapISOCmd.MarkFlagRequired("install-disk")
+}
+
+func makeBootstrapISO() {
+
+	var err error
+	if pullSecretFile != "" {
+		if bootstrapConfig.PullSecret, err = os.ReadFile(pullSecretFile); err != nil {
+			log.Fatalf("Failed to read pull secret: %v", err)
+		}
+	}
+	for _, sshKeyFile := range sshKeyFiles {
+		key, err := os.ReadFile(sshKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to read SSH key: %v", err)
+		}
+		bootstrapConfig.SSHKeys = append(bootstrapConfig.SSHKeys, strings.TrimSpace(string(key)))
+	}
+
+	if err = bootstrap.EmbedIgnition(ops.NewExecutor(log, verbose), liveISO, bootstrapISO, &bootstrapConfig); err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("Bootstrap ISO for %s written to %s", bootstrapConfig.SeedImage, bootstrapISO)
+}
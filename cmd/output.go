@@ -0,0 +1,60 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const (
+	// outputText prints the command results for humans, with the logs
+	outputText = "text"
+	// outputJSON prints the command results as JSON on stdout, the logs going to stderr
+	outputJSON = "json"
+)
+
+// outputFormat is the format the commands print their result in
+var outputFormat string
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "output-format", outputText,
+		"The format of the command results: text, or json printed on stdout with the logs on stderr.")
+}
+
+// validateOutputFormat checks the output format is known
+func validateOutputFormat() error {
+	if outputFormat != outputText && outputFormat != outputJSON {
+		return fmt.Errorf("Unknown output format %q, expected %s or %s", outputFormat, outputText, outputJSON)
+	}
+	return nil
+}
+
+// jsonOutput tells whether the command prints its result as JSON, per --output-format or its own --json flag
+func jsonOutput(jsonFlag bool) bool {
+	return outputFormat == outputJSON || jsonFlag
+}
+
+// printJSON prints a command result as indented JSON on stdout
+func printJSON(result interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"ibu-imager/internal/precache"
+	registry "ibu-imager/internal/registry_client"
+)
+
+// precacheConfig is how the seed images are precached
+var precacheConfig = precache.Config{Workers: precache.DefaultWorkers, Retries: precache.DefaultRetries}
+
+// precacheReport is the file the precache report is written to
+var precacheReport string
+
+// precacheCmd represents the precache command
+var precacheCmd = &cobra.Command{
+	Use:   "precache image",
+	Short: "Pull the images of a seed image into the CRI-O storage of the host.",
+	Long: `Pull the images of a seed image into the CRI-O storage of the host.
+
+The containers.list and catalogimages.list of the seed image are read from the registry, without pulling
+the seed image, and their images pulled concurrently so the upgrade doesn't have to pull them after the
+reboot. Catalog images are pinned to the digests of the seed cluster. Seeds created with --precache-plan
+carry the digests and sizes resolved at seed time, so their images are pulled by digest, largest first,
+without resolving them again. Failed pulls are retried, and the images still failing are reported.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		precacheImages(args[0])
+	},
+}
+
+func init() {
+
+	// Add precache command
+	rootCmd.AddCommand(precacheCmd)
+
+	precacheCmd.Flags().StringVarP(&precacheConfig.AuthFile, "authfile", "a", imageRegistryAuthFile, "The path to the authentication file of the container registry.")
+	precacheCmd.Flags().IntVar(&precacheConfig.Workers, "workers", precache.DefaultWorkers, "The number of images pulled concurrently.")
+	precacheCmd.Flags().IntVar(&precacheConfig.Retries, "retries", precache.DefaultRetries, "The number of times a failed pull is retried.")
+	precacheCmd.Flags().StringVar(&precacheReport, "report", "", "Write the precache report, listing the failed pulls, to this JSON file.")
+}
+
+func precacheImages(image string) {
+
+	if err := precacheConfig.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := registry.NewClient(precacheConfig.AuthFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	images, err := precache.SeedImages(log, client, ref)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	report := precache.NewPrecacher(log, newOps(), precacheConfig).Precache(images)
+	if precacheReport != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(precacheReport, data, 0644)
+		}
+		if err != nil {
+			log.Fatalf("Failed to write precache report: %v", err)
+		}
+	}
+
+	if len(report.Failed) > 0 {
+		for _, failure := range report.Failed {
+			log.Errorf("%s: %s", failure.Image, failure.Error)
+		}
+		log.Fatalf("Failed to pull %d of %d images", len(report.Failed), report.Images)
+	}
+	log.Infof("Precached %d images of %s", report.Pulled, image)
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	seed "ibu-imager/internal/seed_creator"
+)
+
+// preflightJSON prints the preflight report as JSON
+var preflightJSON bool
+
+// preflightCmd represents the preflight command
+var preflightCmd = &cobra.Command{
+	Use:   "preflight",
+	Short: "Check the host and the cluster are ready for the seed creation.",
+	Long: `Check the host and the cluster are ready for the seed creation.
+
+The free space of the backup dir, the single-node topology, the cluster operators health, the seed
+image registry reachability and the recert image availability are checked while the services are
+still running, before create stops kubelet. create runs the same checks unless --skip-preflight.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		preflight()
+	},
+}
+
+func init() {
+
+	// Add preflight command
+	rootCmd.AddCommand(preflightCmd)
+
+	preflightCmd.Flags().StringVarP(&authFile, "authfile", "a", imageRegistryAuthFile, "The path to the authentication file of the container registry.")
+	preflightCmd.Flags().StringVarP(&containerRegistry, "registry", "r", "", "The container registry the OCI image is pushed to.")
+	preflightCmd.Flags().StringVar(&seedTag, "tag", seed.DefaultTag, "The tag of the seed image, as given to create.")
+	preflightCmd.Flags().BoolVar(&skipPush, "skip-push", false, "Skip the registry check, for seed images built without pushing them.")
+	preflightCmd.Flags().StringVar(&recertConfig.Image, "recert-image", seed.DefaultRecertImage, "The recert container image used for the dry-run, pulled through the cluster image mirrors if any.")
+	preflightCmd.Flags().StringVar(&nodeRole, "node-role", seed.NodeRoleMaster, "The role of the node the seed is captured from, worker needs the workerSeeds feature gate.")
+	preflightCmd.Flags().BoolVar(&preflightJSON, "json", false, "Print the preflight report as JSON, like --output-format json.")
+	addBackupDirFlag(preflightCmd)
+}
+
+func preflight() {
+
+	report, err := runPreflight(containerRegistry, authFile, nodeRole, recertConfig, skipPush)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if jsonOutput(preflightJSON) {
+		printJSON(report)
+	} else {
+		printPreflightReport(os.Stdout, report)
+	}
+	if !report.Passed() {
+		log.Fatal("Preflight checks failed")
+	}
+}
+
+// printPreflightReport prints a line per preflight check
+func printPreflightReport(w io.Writer, report *seed.PreflightReport) {
+	for _, check := range report.Checks {
+		fmt.Fprintf(w, "[%s] %-18s %s\n", strings.ToUpper(check.Status), check.Name, check.Message)
+	}
+}
+
+// runPreflight runs the preflight checks of the seed creation to the registry, also for the serve API
+func runPreflight(registry, authFile, nodeRole string, recert seed.RecertConfig, skipPush bool) (*seed.PreflightReport, error) {
+	options := seed.Options{
+		BackupDir:    backupDir,
+		Kubeconfig:   kubeconfigFile,
+		Registry:     registry,
+		Tag:          seedTag,
+		AuthFile:     authFile,
+		NodeRole:     nodeRole,
+		Recert:       recert,
+		SkipPush:     skipPush,
+		FeatureGates: featureGates,
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	if registry == "" && !skipPush {
+		return nil, fmt.Errorf("Please provide the container registry the OCI image is pushed to with --registry")
+	}
+
+	op := newOps()
+	options.Runtime = newRuntime(op)
+	report := seed.NewSeedCreator(log, op, options).Preflight()
+	savePreflightReport(report)
+	return report, nil
+}
+
+// savePreflightReport keeps the preflight report for support-bundle upload, failures are only logged
+func savePreflightReport(report *seed.PreflightReport) {
+	if err := seed.SavePreflightReport(seed.PreflightFile, report); err != nil {
+		log.Warnf("Failed to save preflight report: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os/user"
+
+	"github.com/spf13/cobra"
+
+	registry "ibu-imager/internal/registry_client"
+	promoter "ibu-imager/internal/seed_promote"
+)
+
+var (
+	// promoteEnvironment names the environment the seed is promoted to
+	promoteEnvironment string
+	// promotedBy is who promotes the seed
+	promotedBy string
+	// promoteContent hashes the candidate artifacts before promoting it
+	promoteContent bool
+	// promoteJSON prints the promotion as JSON
+	promoteJSON bool
+)
+
+// promoteCmd represents the promote command
+var promoteCmd = &cobra.Command{
+	Use:   "promote candidate-image destination-image",
+	Short: "Promote a verified candidate seed image to the tag of an environment, e.g. from candidate to stable.",
+	Long: `Promote a verified candidate seed image to the tag of an environment, e.g. from candidate to stable.
+
+The candidate is pinned to its digest and verified in the registry like verify --remote, --content also
+hashing its artifacts. Only once every artifact passes, the candidate is copied to the destination tag
+with the promotion recorded as annotations of its manifest: the environment, who promoted it and when,
+the candidate digest and the digest of the verify report. Staged rollouts promote each seed through
+the environments of the fleet in turn, e.g. candidate to canary, then canary to stable.
+
+The annotations give the promoted seed image its own digest, signatures of the candidate don't carry
+over: sign the promoted seed image with the sign command.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		promote(args[0], args[1])
+	},
+}
+
+func init() {
+
+	// Add promote command
+	rootCmd.AddCommand(promoteCmd)
+
+	promoteCmd.Flags().StringVar(&srcAuthFile, "src-authfile", imageRegistryAuthFile, "The path to the authentication file of the candidate container registry.")
+	promoteCmd.Flags().StringVar(&destAuthFile, "dest-authfile", "", "The path to the authentication file of the destination container registry, the candidate one if empty.")
+	promoteCmd.Flags().StringVar(&promoteEnvironment, "environment", "", "The environment the seed is promoted to, the destination tag if empty.")
+	promoteCmd.Flags().StringVar(&promotedBy, "promoted-by", "", "Who promotes the seed, the current user if empty.")
+	promoteCmd.Flags().BoolVar(&promoteContent, "content", false, "Download the candidate layers and hash its artifacts before promoting it.")
+	promoteCmd.Flags().BoolVar(&promoteJSON, "json", false, "Print the promotion and its verify report as JSON, like --output-format json.")
+}
+
+func promote(candidate, destination string) {
+
+	if destAuthFile == "" {
+		destAuthFile = srcAuthFile
+	}
+	if promotedBy == "" {
+		current, err := user.Current()
+		if err != nil {
+			log.Fatalf("Failed to get the current user, set --promoted-by: %v", err)
+		}
+		promotedBy = current.Username
+	}
+	config := promoter.Config{Environment: promoteEnvironment, PromotedBy: promotedBy, Content: promoteContent}
+	var err error
+	if config.Source, err = registry.ParseReference(candidate); err != nil {
+		log.Fatal(err)
+	}
+	if config.Destination, err = registry.ParseReference(destination); err != nil {
+		log.Fatal(err)
+	}
+	src, err := registry.NewClient(srcAuthFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dst, err := registry.NewClient(destAuthFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	promotion, err := promoter.Promote(log, src, dst, config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if jsonOutput(promoteJSON) {
+		printJSON(promotion)
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	registry "ibu-imager/internal/registry_client"
+	pruner "ibu-imager/internal/seed_prune"
+)
+
+var (
+	// pruneKeep is the number of newest seed tags kept
+	pruneKeep int
+	// pruneDryRun lists what would be deleted
+	pruneDryRun bool
+)
+
+// pruneCmd represents the prune command
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete the old seed tags of a registry repository.",
+	Long: `Delete the old seed tags of a registry repository.
+
+The tags pointing to seeds, told apart from the other images of the repository by the io.openshift.ibu.created-by
+and io.openshift.ibu.artifacts labels or artifact annotations, are sorted by creation time and all but the newest
+--keep ones are deleted through the registry API, along with their image store and cosign signature tags.
+Other tags pointing to a kept digest keep it too, the registry deletes every tag of a deleted manifest.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		prune()
+	},
+}
+
+func init() {
+
+	// Add prune command
+	rootCmd.AddCommand(pruneCmd)
+
+	pruneCmd.Flags().StringVarP(&containerRegistry, "registry", "r", "", "The container registry repository to prune, e.g. quay.io/org/seed.")
+	pruneCmd.Flags().IntVar(&pruneKeep, "keep", 3, "The number of newest seed tags to keep.")
+	pruneCmd.Flags().StringVarP(&authFile, "authfile", "a", imageRegistryAuthFile, "The path to the authentication file of the container registry.")
+	pruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "List the tags that would be deleted, without deleting them.")
+}
+
+func prune() {
+
+	if containerRegistry == "" {
+		log.Fatal("The registry repository to prune is required, use --registry")
+	}
+	repository, err := registry.ParseReference(containerRegistry)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := registry.NewClient(authFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tags, err := pruner.Prune(log, client, repository, pruneKeep, pruneDryRun)
+	if tags != nil {
+		printPrunedTags(tags)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// printPrunedTags prints the seed tags and their companions, newest first
+func printPrunedTags(tags []pruner.Tag) {
+	deleted := "deleted"
+	if pruneDryRun {
+		deleted = "would delete"
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TAG\tCREATED\tDIGEST\tSTATUS")
+	for _, tag := range tags {
+		created := "-"
+		if !tag.Created.IsZero() {
+			created = tag.Created.Format(time.RFC3339)
+		}
+		status := deleted
+		if tag.Kept {
+			status = "kept"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", tag.Tag, created, tag.Digest, status)
+	}
+	w.Flush()
+}
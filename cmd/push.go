@@ -0,0 +1,61 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	seed "ibu-imager/internal/seed_creator"
+)
+
+// pushConfig selects the seed image built with create --skip-push and where it's pushed
+var pushConfig seed.PushConfig
+
+// pushCmd represents the push command
+var pushCmd = &cobra.Command{
+	Use:   "push",
+	Short: "Push a seed image built with create --skip-push to a container registry.",
+	Long: `Push a seed image built with create --skip-push to a container registry.
+
+The seed image is taken from the local storage, as tagged by create for --source-registry (defaults
+to --registry), and pushed to --registry and the mirror registries, without re-running the seed creation.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		push()
+	},
+}
+
+func init() {
+
+	// Add push command
+	rootCmd.AddCommand(pushCmd)
+
+	pushCmd.Flags().StringVarP(&pushConfig.AuthFile, "authfile", "a", imageRegistryAuthFile, "The path to the authentication file of the container registry.")
+	pushCmd.Flags().StringVarP(&pushConfig.Registry, "registry", "r", "", "The container registry the seed image is pushed to.")
+	pushCmd.Flags().StringVar(&pushConfig.Tag, "tag", seed.DefaultTag, "The tag of the seed image, as create resolved it.")
+	pushCmd.Flags().StringVar(&pushConfig.SourceRegistry, "source-registry", "", "The container registry the seed image was built for with create --registry (defaults to --registry).")
+	pushCmd.Flags().StringSliceVar(&pushConfig.MirrorRegistries, "mirror-registry", nil, "Additional container registries the seed image is pushed to concurrently, without failing the push.")
+	pushCmd.Flags().BoolVar(&pushConfig.ImageStore, "image-store", false, "Also push the <tag>-image-store image built with create --image-store.")
+}
+
+func push() {
+
+	// Mirror failures are already logged as warnings
+	if _, err := seed.Push(log, newRuntime(newOps()), pushConfig); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Seed image pushed successfully!")
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"ibu-imager/internal/host_mounts"
+	seed "ibu-imager/internal/seed_creator"
+)
+
+// recertSummaryFile is where recert-check also saves the recert summary
+var recertSummaryFile string
+
+// recertCheckCmd represents the recert-check command
+var recertCheckCmd = &cobra.Command{
+	Use:   "recert-check",
+	Short: "Check the running cluster can be re-certified, without backing up nor stopping anything.",
+	Long: `Check the running cluster can be re-certified, without backing up nor stopping anything.
+
+A snapshot of the cluster etcd is restored to /var/tmp/recert-check and served by an unauthenticated etcd,
+for the recert dry-run create runs after stopping the services. The cluster keeps running and the recert
+summary is printed, e.g. to review the certificates a seed of the cluster would re-certify.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		recertCheck()
+	},
+}
+
+func init() {
+
+	// Add recert-check command
+	rootCmd.AddCommand(recertCheckCmd)
+
+	recertCheckCmd.Flags().StringVarP(&authFile, "authfile", "a", imageRegistryAuthFile, "The path to the authentication file of the container registry.")
+	recertCheckCmd.Flags().StringVar(&recertConfig.Image, "recert-image", seed.DefaultRecertImage, "The recert container image used for the dry-run, pulled through the cluster image mirrors if any.")
+	recertCheckCmd.Flags().StringVar(&recertConfig.CPUs, "recert-cpus", "", "CPU limit of the recert and etcd containers (podman --cpus).")
+	recertCheckCmd.Flags().StringVar(&recertConfig.Memory, "recert-memory", "", "Memory limit of the recert and etcd containers (podman --memory).")
+	recertCheckCmd.Flags().StringVar(&recertConfig.CgroupParent, "recert-cgroup-parent", "", "Cgroup slice the recert and etcd containers run in (podman --cgroup-parent).")
+	recertCheckCmd.Flags().StringVar(&recertConfig.SignaturePolicy, "signature-policy", "", "The containers policy.json the recert and etcd images are verified against (defaults to the host's).")
+	recertCheckCmd.Flags().BoolVar(&recertConfig.Secure, "secure", false, "Refuse recert and etcd images not verified by the signature policy.")
+	recertCheckCmd.Flags().DurationVar(&recertConfig.Timeout, "recert-timeout", 0, "Cancel the recert dry-run when it takes longer, removing its containers (e.g. 20m, not limited by default).")
+	recertCheckCmd.Flags().StringVarP(&recertSummaryFile, "summary-file", "o", "", "Also save the recert summary to this file.")
+}
+
+func recertCheck() {
+
+	if host_mounts.IsContainerized() {
+		if err := host_mounts.ValidateHostMounts(host_mounts.RequiredHostMounts); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if recertConfig.Timeout < 0 {
+		log.Fatal("--recert-timeout can't be negative")
+	}
+
+	ctx, stop := runContext()
+	defer stop()
+	op := newOps()
+	seedCreator := seed.NewSeedCreator(log, op, seed.Options{
+		Context:      ctx,
+		BackupDir:    backupDir,
+		Kubeconfig:   kubeconfigFile,
+		Tag:          seed.DefaultTag,
+		AuthFile:     authFile,
+		Recert:       recertConfig,
+		SkipPush:     true,
+		Runtime:      newRuntime(op),
+		FeatureGates: featureGates,
+	})
+	summary, err := seedCreator.RecertCheck()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(summary)
+	if recertSummaryFile != "" {
+		if err = os.WriteFile(recertSummaryFile, []byte(summary), 0600); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"ibu-imager/internal/ops"
+	"ibu-imager/internal/rehearsal"
+)
+
+// rehearsalConfig is the seed rehearsed and the scratch VM it's restored on
+var rehearsalConfig rehearsal.Config
+
+// rehearseCmd represents the rehearse command
+var rehearseCmd = &cobra.Command{
+	Use:   "rehearse",
+	Short: "Restore a seed image on a scratch VM and check the node becomes Ready.",
+	Long: `Restore a seed image on a scratch VM and check the node becomes Ready.
+
+A VM is booted through libvirt from a copy-on-write overlay of the disk of a target SNO, leaving the
+disk untouched. The imager image restores the seed on it, the VM is rebooted into the new stateroot,
+and the node is waited for to become Ready. The VM and its overlay are deleted afterwards, smoke
+testing the seed before it's used on production nodes.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		rehearse()
+	},
+}
+
+func init() {
+
+	// Add rehearse command
+	rootCmd.AddCommand(rehearseCmd)
+
+	rehearseCmd.Flags().StringVar(&rehearsalConfig.SeedImage, "seed-image", "", "The seed image to rehearse.")
+	rehearseCmd.Flags().StringVar(&rehearsalConfig.ImagerImage, "imager-image", "", "The ibu-imager container image running the restore on the VM.")
+	rehearseCmd.Flags().StringVar(&rehearsalConfig.BaseDisk, "base-disk", "", "The qcow2 disk of a target SNO the VM boots from, through an overlay.")
+	rehearseCmd.Flags().StringVarP(&rehearsalConfig.AuthFile, "authfile", "a", imageRegistryAuthFile, "The path to the authentication file of the container registry, on the VM.")
+	rehearseCmd.Flags().StringVar(&rehearsalConfig.Kubeconfig, "kubeconfig", kubeconfigFile, "The path to the node kubeconfig, on the VM.")
+	rehearseCmd.Flags().StringVar(&rehearsalConfig.SSHUser, "vm-user", "core", "The SSH user of the VM, commands run through passwordless sudo unless root.")
+	rehearseCmd.Flags().StringVar(&rehearsalConfig.SSHKeyFile, "vm-identity", "", "The private key authenticating to the VM (defaults to the SSH agent's keys).")
+	rehearseCmd.Flags().StringVar(&rehearsalConfig.LibvirtURI, "libvirt-uri", rehearsal.DefaultLibvirtURI, "The libvirt connection the VM is created through.")
+	rehearseCmd.Flags().StringVar(&rehearsalConfig.Network, "network", rehearsal.DefaultNetwork, "The libvirt network the VM is attached to.")
+	rehearseCmd.Flags().IntVar(&rehearsalConfig.MemoryMiB, "memory", 16384, "The memory of the VM, in MiB.")
+	rehearseCmd.Flags().IntVar(&rehearsalConfig.CPUs, "cpus", 8, "The number of CPUs of the VM.")
+	rehearseCmd.Flags().DurationVar(&rehearsalConfig.ReadyTimeout, "ready-timeout", rehearsal.DefaultReadyTimeout, "How long the restored node has to become Ready.")
+	rehearseCmd.Flags().BoolVar(&rehearsalConfig.Keep, "keep", false, "Keep the VM and its overlay disk afterwards, for investigation.")
+}
+
+func rehearse() {
+
+	if err := rehearsalConfig.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	result := rehearsal.NewRehearsal(log, ops.NewExecutor(log, true), rehearsalConfig).Run()
+	if !result.Ready {
+		log.Fatalf("Rehearsal of %s failed after %s: %s", rehearsalConfig.SeedImage, result.Duration.Round(time.Second), result.Error)
+	}
+	log.Infof("Rehearsal of %s succeeded, the node was Ready after %s", rehearsalConfig.SeedImage, result.Duration.Round(time.Second))
+}
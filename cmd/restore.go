@@ -0,0 +1,142 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	featuregate "ibu-imager/internal/feature_gate"
+	"ibu-imager/internal/host_mounts"
+	"ibu-imager/internal/ops"
+	oras "ibu-imager/internal/oras_client"
+	seed "ibu-imager/internal/seed_creator"
+	restorer "ibu-imager/internal/seed_restorer"
+	siteconfig "ibu-imager/internal/site_config"
+)
+
+// restoreConfig is the seed image restored and how
+var restoreConfig restorer.Config
+
+// restoreSiteConfig is the site config bundle the restored node is reconfigured to
+var restoreSiteConfig string
+
+// restoreReboot reboots into the new stateroot once restored
+var restoreReboot bool
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore a seed image to a new stateroot of the target host.",
+	Long: `Restore a seed image to a new stateroot of the target host.
+
+The seed image is pulled and mounted, its artifacts verified against the digests it is labeled with,
+and the restore steps of its manifest applied in dependency order: the seed ostree commit is deployed
+to a new stateroot, and the seed /var and /etc extracted into it. The new stateroot is the default
+deployment on next boot, where recert reconfigures the node.
+
+Unless SELinux is disabled on the target, the extracted files are relabeled to the file contexts of
+the restored policy like restorecon, the labels the target refuses while extracting included, and
+the relabeled files summarized, so the first boot doesn't hit a storm of denials.
+
+With --site-config, the node is relocated to a new site: the bundle gives the new cluster name and domain,
+node network, proxy, NTP servers and registry mirrors the node is reconfigured to on first boot, and can
+select the seed image and stateroot instead of the flags, which take precedence over it. The bundle is
+validated before any change is made to the host.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		restore(cmd)
+	},
+}
+
+func init() {
+
+	// Add restore command
+	rootCmd.AddCommand(restoreCmd)
+
+	restoreCmd.Flags().StringVar(&restoreConfig.SeedImage, "seed-image", "", "The seed image to restore.")
+	restoreCmd.Flags().StringVarP(&restoreConfig.AuthFile, "authfile", "a", imageRegistryAuthFile, "The path to the authentication file of the container registry.")
+	restoreCmd.Flags().StringVar(&restoreConfig.Stateroot, "stateroot", "", "The new stateroot the seed is deployed to (defaults to rhcos_<seed version>).")
+	restoreCmd.Flags().StringVar(&restoreConfig.SSHKeysPolicy, "ssh-keys-policy", "", "Override the core user's authorized_keys restore policy of the seed (seed, target or merge).")
+	restoreCmd.Flags().BoolVar(&restoreConfig.AllowSELinuxModeChange, "allow-selinux-mode-change", false, "Restore a seed whose SELinux mode differs from the target one.")
+	restoreCmd.Flags().BoolVar(&restoreConfig.SkipSELinuxRelabel, "skip-selinux-relabel", false, "Keep the seed SELinux labels of the extracted files instead of relabeling them to the restored policy.")
+	restoreCmd.Flags().BoolVar(&restoreConfig.AllowMissingCrioRuntime, "allow-missing-crio-runtime", false, "Restore a seed lacking OCI hooks or CRI-O runtime handlers of the target.")
+	restoreCmd.Flags().BoolVar(&restoreConfig.LocalImage, "local-image", false, "Restore the seed image already in the local storage, e.g. loaded by import, without pulling it.")
+	restoreCmd.Flags().StringVar(&artifactMode, "artifact-mode", oras.ModeImage, "Pull the seed as a container image (image) or as an ORAS artifact (oras), as it was pushed by create.")
+	restoreCmd.Flags().StringVar(&restoreSiteConfig, "site-config", "", "The site config bundle (YAML) the restored node is reconfigured to.")
+	restoreCmd.Flags().BoolVar(&restoreReboot, "reboot", false, "Reboot into the new stateroot once restored.")
+}
+
+func restore(cmd *cobra.Command) {
+
+	if restoreSiteConfig != "" {
+		config, err := siteconfig.Load(restoreSiteConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		restoreConfig.SiteConfig = config
+		if config.Restore != nil {
+			setUnchangedFlag(cmd, "seed-image", &restoreConfig.SeedImage, config.Restore.SeedImage)
+			setUnchangedFlag(cmd, "stateroot", &restoreConfig.Stateroot, config.Restore.Stateroot)
+			setUnchangedFlag(cmd, "ssh-keys-policy", &restoreConfig.SSHKeysPolicy, config.Restore.SSHKeysPolicy)
+		}
+	}
+	if err := restoreConfig.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if err := oras.ValidateMode(artifactMode); err != nil {
+		log.Fatal(err)
+	}
+	if artifactMode == oras.ModeORAS {
+		if !featureGates.Enabled(featuregate.ORASArtifacts) {
+			log.Fatalf("ORAS artifacts are experimental, enable the %s feature gate to pull seeds as ORAS artifacts", featuregate.ORASArtifacts)
+		}
+		if restoreConfig.LocalImage {
+			log.Fatal("--local-image can't be used with --artifact-mode oras, ORAS artifacts aren't kept in the local storage")
+		}
+		restoreConfig.ORAS = oras.NewClient(log, ops.NewExecutor(log, true), restoreConfig.AuthFile)
+	}
+	if restoreConfig.SSHKeysPolicy != "" {
+		if err := seed.ValidateSSHKeysPolicy(restoreConfig.SSHKeysPolicy); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if host_mounts.IsContainerized() {
+		if err := host_mounts.ValidateHostMounts(host_mounts.RestoreHostMounts); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	op := newOps()
+	restoreConfig.Runtime = newRuntime(op)
+	if err := restorer.NewSeedRestorer(log, op, restoreConfig).RestoreSeedImage(); err != nil {
+		log.Fatal(err)
+	}
+
+	if restoreReboot {
+		log.Info("Rebooting into the new stateroot")
+		if _, err := op.SystemctlAction("reboot"); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// setUnchangedFlag sets the flag value out of the site config, unless the flag was given
+func setUnchangedFlag(cmd *cobra.Command, flag string, value *string, siteValue string) {
+	if siteValue != "" && !cmd.Flags().Changed(flag) {
+		*value = siteValue
+	}
+}
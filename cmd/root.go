@@ -19,9 +19,17 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+
+	containers "ibu-imager/internal/container_runtime"
+	featuregate "ibu-imager/internal/feature_gate"
+	"ibu-imager/internal/ops"
+	"ibu-imager/internal/simulate"
+	"ibu-imager/internal/version"
 )
 
 // Create logger
@@ -36,24 +44,102 @@ var verbose bool
 // noColor is the optional flag for controlling ANSI sequence output
 var noColor bool
 
-// version is an optional command that will display the current release version
-var releaseVersion string
+// sshConfig is the optional remote node the host commands run on, for the commands adding the SSH flags
+var sshConfig ops.SSHConfig
+
+// containerRuntime is the container runtime running the builds, pushes and helper containers
+var containerRuntime string
+
+// featureGatesFlag is the comma separated <feature>=<bool> pairs enabling the experimental subsystems
+var featureGatesFlag string
+
+// featureGates are the states of the feature gates parsed from the flag
+var featureGates *featuregate.Gates
+
+// heartbeatInterval is how often the host commands still running are logged
+var heartbeatInterval time.Duration
 
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Display verbose logs")
 	rootCmd.PersistentFlags().BoolVarP(&noColor, "no-color", "c", false, "Control colored output")
+	rootCmd.PersistentFlags().DurationVar(&heartbeatInterval, "heartbeat-interval", ops.DefaultHeartbeatInterval, "Log the host commands still running, with their elapsed time and I/O, at this interval (0 disables it).")
+
+	rootCmd.PersistentFlags().StringVar(&containerRuntime, "container-runtime", containers.NamePodman,
+		"The container runtime: podman, docker for lab runs on non-CoreOS hosts, or fake to only log the container operations.")
+	rootCmd.PersistentFlags().StringVar(&featureGatesFlag, "feature-gates", "",
+		"Enable the experimental subsystems, comma separated <feature>=<true|false> pairs, e.g. workerSeeds=true,orasArtifacts=true.")
+}
+
+// addSSHFlags adds the flags running the host commands of the command on a remote node over SSH. Only the
+// commands doing all their host work through the ops and the container runtime can run from a workstation,
+// the others read and write the node's files directly.
+func addSSHFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&sshConfig.Host, "ssh-host", "", "Run the host commands on this remote node over SSH instead of nsenter, e.g. from an admin workstation.")
+	cmd.Flags().StringVar(&sshConfig.User, "ssh-user", "core", "The remote user of the SSH transport, commands run through passwordless sudo unless root.")
+	cmd.Flags().IntVar(&sshConfig.Port, "ssh-port", 0, "The remote port of the SSH transport (defaults to the SSH client's).")
+	cmd.Flags().StringVar(&sshConfig.KeyFile, "ssh-identity", "", "The private key of the SSH transport (defaults to the SSH agent's keys).")
 }
 
+// newOps returns the Ops running the host commands, through nsenter or on the remote node of --ssh-host
+func newOps() ops.Ops {
+	executor := ops.NewExecutorWithHeartbeat(log, true, heartbeatInterval)
+	if sshConfig.Enabled() {
+		log.Infof("Running the host commands on %s over SSH", sshConfig.Host)
+		return ops.NewSSHOps(log, executor, sshConfig)
+	}
+	return ops.NewOps(log, executor)
+}
+
+// newRuntime returns the container runtime running its commands through the ops
+func newRuntime(op ops.Ops) containers.Runtime {
+	runtime, err := containers.NewRuntime(log, containerRuntime, op)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return runtime
+}
+
+// banner is printed before the command output
+const banner = `
+ ___ ____  _   _            ___                                 
+|_ _| __ )| | | |          |_ _|_ __ ___   __ _  __ _  ___ _ __ 
+ | ||  _ \| | | |   _____   | ||  _   _ \ / _  |/ _  |/ _ \ '__|
+ | || |_) | |_| |  |_____|  | || | | | | | (_| | (_| |  __/ |
+|___|____/ \___/           |___|_| |_| |_|\__,_|\__, |\___|_|
+                                                |___/
+
+ A tool to assist in building OCI seed images for Image Based Upgrades (IBU)
+	
+`
+
 var (
 	rootCmd = &cobra.Command{
 		Use:     "ibu-imager",
-		Version: releaseVersion,
+		Version: version.Get().String(),
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
 			if verbose {
 				log.SetLevel(logrus.DebugLevel)
 			} else {
 				log.SetLevel(logrus.InfoLevel)
 			}
+			if err := validateOutputFormat(); err != nil {
+				log.Fatal(err)
+			}
+			// stdout only carries the JSON result
+			if outputFormat == outputJSON {
+				log.SetOutput(os.Stderr)
+			}
+			// The imager re-executed by the simulate command printed it already
+			if os.Getenv(simulate.RootEnv) == "" {
+				fmt.Fprint(log.Out, banner)
+			}
+			var err error
+			if featureGates, err = featuregate.Parse(featureGatesFlag); err != nil {
+				log.Fatal(err)
+			}
+			if experimental := featureGates.Experimental(); len(experimental) > 0 {
+				log.Warnf("Experimental features enabled: %s", strings.Join(experimental, ", "))
+			}
 		},
 	}
 )
@@ -65,15 +151,10 @@ func Execute() error {
 		TimestampFormat: "2006-01-02 15:04:05",
 		FullTimestamp:   true,
 	})
-	fmt.Println(`
- ___ ____  _   _            ___                                 
-|_ _| __ )| | | |          |_ _|_ __ ___   __ _  __ _  ___ _ __ 
- | ||  _ \| | | |   _____   | ||  _   _ \ / _  |/ _  |/ _ \ '__|
- | || |_) | |_| |  |_____|  | || | | | | | (_| | (_| |  __/ |
-|___|____/ \___/           |___|_| |_| |_|\__,_|\__, |\___|_|
-                                                |___/
-
- A tool to assist in building OCI seed images for Image Based Upgrades (IBU)
-	`)
+	help := rootCmd.HelpFunc()
+	rootCmd.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+		fmt.Print(banner)
+		help(cmd, args)
+	})
 	return rootCmd.Execute()
 }
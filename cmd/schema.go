@@ -0,0 +1,56 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	seed "ibu-imager/internal/seed_creator"
+)
+
+// schemaCmd represents the schema command
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print machine-readable descriptions of the imager, for external orchestration.",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// stdout only carries the JSON description, the banner and logs go to stderr
+		outputFormat = outputJSON
+		rootCmd.PersistentPreRun(cmd, args)
+	},
+}
+
+// schemaStagesCmd represents the schema stages command
+var schemaStagesCmd = &cobra.Command{
+	Use:   "stages",
+	Short: "Print the seed creation stages, their inputs and the artifacts they produce as JSON.",
+	Long: `Print the seed creation stages, their inputs and the artifacts they produce as JSON.
+
+The description is generated from the stages the create command runs, in their order, so orchestrators
+(Ansible, ACM policies) can tell which artifacts a partial run with --only-steps or --skip-steps leaves
+in the backup dir, and which stages worker node seeds skip.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		printJSON(seed.Stages())
+	},
+}
+
+func init() {
+
+	// Add schema command
+	rootCmd.AddCommand(schemaCmd)
+	schemaCmd.AddCommand(schemaStagesCmd)
+}
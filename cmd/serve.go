@@ -0,0 +1,106 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	api "ibu-imager/internal/api_server"
+	seed "ibu-imager/internal/seed_creator"
+)
+
+// serveListen is the address the API is served on
+var serveListen string
+
+// serveTokenFile holds the bearer token the API calls must present
+var serveTokenFile string
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve an HTTP API driving the seed creation, for the lifecycle operator and other orchestration tools.",
+	Long: `Serve an HTTP API driving the seed creation, for the lifecycle operator and other orchestration tools.
+
+  POST /v1/seed:create     start create in a child process, from a JSON request naming the registry and flags
+  POST /v1/preflight       run the preflight checks and return their report
+  GET  /v1/progress        return the status of the current or last run, as the status command
+  GET  /v1/progress/events stream the run-started, step-started, step-finished and run-finished events as JSON lines
+
+Only one run, started through the API or not, is allowed at a time. The API is served to root on the node
+only, through a unix socket, unless --listen gives a TCP address, which requires --token-file. The requests
+can only pass the create flags that don't read, write or send files of their choosing. Runs started through
+the API keep running when serve stops.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		serve()
+	},
+}
+
+func init() {
+
+	// Add serve command
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveListen, "listen", api.DefaultListen, "The unix socket path or TCP address the API is served on, a TCP address requires --token-file.")
+	serveCmd.Flags().StringVar(&serveTokenFile, "token-file", "", "File holding the bearer token the API calls must present.")
+}
+
+func serve() {
+
+	executable, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	config := api.Config{
+		Command: func(args ...string) *exec.Cmd {
+			return exec.Command(executable, args...)
+		},
+		Preflight:  servePreflight,
+		StatusFile: seed.StatusFile,
+	}
+	if serveTokenFile != "" {
+		token, err := os.ReadFile(serveTokenFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if config.Token = strings.TrimSpace(string(token)); config.Token == "" {
+			log.Fatalf("Token file %s is empty", serveTokenFile)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err = api.NewServer(log, config).ListenAndServe(ctx, serveListen); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// servePreflight runs the preflight checks of an API request, defaulting its settings like the preflight flags
+func servePreflight(request api.PreflightRequest) (*seed.PreflightReport, error) {
+	if request.NodeRole == "" {
+		request.NodeRole = seed.NodeRoleMaster
+	}
+	recert := seed.RecertConfig{Image: seed.DefaultRecertImage}
+	return runPreflight(request.Registry, imageRegistryAuthFile, request.NodeRole, recert, request.SkipPush)
+}
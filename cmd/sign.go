@@ -0,0 +1,67 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"ibu-imager/internal/ops"
+	registry "ibu-imager/internal/registry_client"
+	signer "ibu-imager/internal/seed_sign"
+)
+
+// signKeyFile is the cosign key the seed image is signed with
+var signKeyFile string
+
+// signCmd represents the sign command
+var signCmd = &cobra.Command{
+	Use:   "sign image",
+	Short: "Sign a seed image in the registry with cosign.",
+	Long: `Sign a seed image in the registry with cosign.
+
+The image is resolved to its digest and signed with the cosign private key or KMS URI, the key password
+being read from COSIGN_PASSWORD, so image-based upgrades can enforce signature verification on seeds.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		sign(args[0])
+	},
+}
+
+func init() {
+
+	// Add sign command
+	rootCmd.AddCommand(signCmd)
+
+	signCmd.Flags().StringVarP(&authFile, "authfile", "a", imageRegistryAuthFile, "The path to the authentication file of the container registry.")
+	signCmd.Flags().StringVar(&signKeyFile, "key", "", "The cosign private key or KMS URI the seed image is signed with.")
+}
+
+func sign(image string) {
+
+	if err := signer.ValidateKey(signKeyFile); err != nil {
+		log.Fatal(err)
+	}
+	client, err := registry.NewClient(authFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	signed, err := signer.NewSigner(log, ops.NewExecutor(log, true), client, signKeyFile, authFile).Sign(image)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Seed image %s signed successfully!", signed)
+}
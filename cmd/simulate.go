@@ -0,0 +1,155 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"ibu-imager/internal/ops"
+	ostree "ibu-imager/internal/ostree_client"
+	seed "ibu-imager/internal/seed_creator"
+	"ibu-imager/internal/simulate"
+)
+
+// installationFilesDir holds the installation configuration files the seed creation copies, relative to
+// the working directory
+const installationFilesDir = "installation_configuration_files"
+
+// simulateRoot is where the fake host is generated, a temporary dir when empty
+var simulateRoot string
+
+// simulateImage is the name of the simulated seed image
+var simulateImage string
+
+// simulateOutput is the OCI archive the simulated seed image is exported to
+var simulateOutput string
+
+// keepSimulateRoot keeps the fake host and the artifacts of its backup dir afterwards
+var keepSimulateRoot bool
+
+// simulateCmd represents the simulate command
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Create a seed image from a generated fake host, without an SNO.",
+	Long: `Create a seed image from a generated fake host, without an SNO.
+
+A fake single-node OpenShift host tree is generated (/etc, /var, the ostree repo and the bootloader
+entries), with stubs answering the crictl, oc, systemctl and rpm-ostree queries from fixtures. The seed
+creation runs chrooted into it in new mount and PID namespaces, a user namespace when not run as root,
+and the seed image is built with the container runtime and exported to an OCI archive.
+
+The steps needing a live etcd or the recert containers are skipped. Run it from the imager source or
+image dir, with --container-runtime docker on hosts without podman, for demos and end-to-end tests.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		simulateSeed()
+	},
+}
+
+func init() {
+
+	// Add simulate command
+	rootCmd.AddCommand(simulateCmd)
+
+	simulateCmd.Flags().StringVar(&simulateRoot, "root", "", "The empty dir the fake host is generated in (defaults to a temporary dir).")
+	simulateCmd.Flags().StringVar(&simulateImage, "image", "localhost/ibu-imager-simulated", "The name of the simulated seed image, tagged "+seed.DefaultTag+".")
+	simulateCmd.Flags().StringVar(&simulateOutput, "output", "simulated-seed.tar", "The OCI archive the simulated seed image is exported to.")
+	simulateCmd.Flags().BoolVar(&keepSimulateRoot, "keep-root", false, "Keep the fake host and its backup dir afterwards, for investigation.")
+}
+
+func simulateSeed() {
+	// The imager re-executed by the simulation runs the seed creation in the fake root
+	if root := os.Getenv(simulate.RootEnv); root != "" {
+		createSimulatedSeed(root)
+		return
+	}
+
+	output, err := filepath.Abs(simulateOutput)
+	if err != nil {
+		log.Fatal(err)
+	}
+	root := simulateRoot
+	if root == "" {
+		if root, err = os.MkdirTemp("", "ibu-imager-simulate-"); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if root, err = filepath.Abs(root); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Infof("Generating the fake host in %s", root)
+	err = simulate.Generate(root, installationFilesDir)
+	if err == nil {
+		log.Info("Simulating the seed creation")
+		err = simulate.Run(root, os.Args[1:])
+	}
+	var collected []string
+	if err == nil {
+		collected, err = simulate.Collect(root, filepath.Dir(output))
+	}
+	if keepSimulateRoot {
+		log.Infof("The fake host is kept in %s", root)
+	} else if removeErr := os.RemoveAll(root); removeErr != nil {
+		log.Warnf("Failed to remove the fake host %s: %v", root, removeErr)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("Simulated seed image exported to %v", collected)
+}
+
+// createSimulatedSeed enters the fake root and creates the seed image from it
+func createSimulatedSeed(root string) {
+	if err := simulate.Enter(root); err != nil {
+		log.Fatal(err)
+	}
+
+	steps, err := seed.NewStepSelection(nil, simulate.SkippedSteps)
+	if err != nil {
+		log.Fatal(err)
+	}
+	lintRules, err := loadLintRules()
+	if err != nil {
+		log.Fatal(err)
+	}
+	output := &seed.Output{Transport: seed.OutputOCIArchive, Path: filepath.Join(simulate.OutputDir, filepath.Base(simulateOutput))}
+
+	op := ops.NewLocalOps(log, ops.NewExecutorWithHeartbeat(log, true, heartbeatInterval))
+	seedCreator := seed.NewSeedCreator(log, op, seed.Options{
+		OstreeClient: ostree.NewClient("ibu-imager", op),
+		BackupDir:    backupDir,
+		Kubeconfig:   kubeconfigFile,
+		Registry:     simulateImage,
+		Tag:          seed.DefaultTag,
+		AuthFile:     imageRegistryAuthFile,
+		LintRules:    lintRules,
+		Output:       output,
+		Steps:        steps,
+		Runtime:      newRuntime(op),
+		FeatureGates: featureGates,
+	})
+	err = seedCreator.CreateSeedImage()
+	if jsonOutput(false) {
+		printJSON(seedCreator.Report())
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
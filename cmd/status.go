@@ -0,0 +1,102 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	seed "ibu-imager/internal/seed_creator"
+)
+
+// statusJSON prints the run status as JSON
+var statusJSON bool
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Report the progress of the current, or the result of the last, seed creation run.",
+	Long: `Report the progress of the current, or the result of the last, seed creation run.
+
+The run status is persisted on every step, so status can follow a create running under a systemd unit:
+the step in progress, the duration of every completed step and the result of the run. A run whose process
+died before finishing is reported Interrupted, abort recovers the node and create --resume continues it.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		status()
+	},
+}
+
+func init() {
+
+	// Add status command
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().BoolVar(&statusJSON, "json", false, "Print the run status as JSON, like --output-format json.")
+}
+
+func status() {
+
+	report, err := seed.LoadStatus(seed.StatusFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if report == nil {
+		log.Infof("No seed creation run recorded in %s", seed.StatusFile)
+		return
+	}
+	if jsonOutput(statusJSON) {
+		printJSON(report)
+		return
+	}
+
+	elapsed := report.FinishedAt.Sub(report.StartedAt)
+	if report.Result == seed.ResultRunning || report.Result == seed.ResultInterrupted {
+		elapsed = time.Since(report.StartedAt)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Image:\t%s (%s node)\n", report.Image, report.NodeRole)
+	if report.RunID != "" {
+		fmt.Fprintf(w, "Run ID:\t%s\n", report.RunID)
+	}
+	fmt.Fprintf(w, "Result:\t%s\n", report.Result)
+	fmt.Fprintf(w, "Started:\t%s\n", report.StartedAt.Format(time.RFC3339))
+	fmt.Fprintf(w, "Elapsed:\t%s\n", elapsed.Round(time.Second))
+	if report.CurrentStep != "" && report.CurrentStepStartedAt != nil {
+		fmt.Fprintf(w, "Current step:\t%s (for %s)\n", report.CurrentStep, time.Since(*report.CurrentStepStartedAt).Round(time.Second))
+	}
+	if report.Error != "" {
+		fmt.Fprintf(w, "Error:\t%s\n", report.Error)
+	}
+
+	if len(report.Steps) > 0 {
+		fmt.Fprintln(w, "\nSTEP\tDURATION\tRESULT")
+		for _, step := range report.Steps {
+			result := "done"
+			if step.Error != "" {
+				result = "failed: " + step.Error
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", step.Name, formatDuration(int64(step.Duration)), result)
+		}
+	}
+	w.Flush()
+}
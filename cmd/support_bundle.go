@@ -0,0 +1,114 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	seed "ibu-imager/internal/seed_creator"
+	support "ibu-imager/internal/support_bundle"
+)
+
+// supportBundleFile is where the support bundle is packaged and kept until it's uploaded
+var supportBundleFile string
+
+// uploadConfig configures the upload of the support bundle
+var uploadConfig support.UploadConfig
+
+// uploadMaxRateKiB limits the upload rate of the support bundle
+var uploadMaxRateKiB int64
+
+// uploadChunkMiB is the size of the uploaded chunks of the support bundle
+var uploadChunkMiB int64
+
+// supportBundleCmd represents the support-bundle command
+var supportBundleCmd = &cobra.Command{
+	Use:   "support-bundle",
+	Short: "Package the reports of the seed creation runs for support cases.",
+}
+
+// supportBundleUploadCmd represents the support-bundle upload command
+var supportBundleUploadCmd = &cobra.Command{
+	Use:   "upload",
+	Short: "Package the reports of the seed creation runs and upload them, resuming interrupted uploads.",
+	Long: `Package the reports of the seed creation runs and upload them, resuming interrupted uploads.
+
+The bundle carries the transcript and status of the last run, the latest run reports, the last preflight
+report, and the manifest and recert summary of the backup dir, never the backup archives. It's uploaded to
+an s3://<bucket>/<key> object as a multipart upload, signed with the AWS_ACCESS_KEY_ID and
+AWS_SECRET_ACCESS_KEY variables, or to an http(s) URL accepting resumable ranged PUT uploads, e.g. a
+signed Google Cloud Storage session URL.
+
+The upload goes chunk by chunk at the --max-rate-kib rate, for the narrow links of disconnected sites. The
+bundle is kept in the meantime: running the command again after an interruption resumes the upload after
+the chunks the target received.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		uploadSupportBundle()
+	},
+}
+
+func init() {
+
+	// Add support-bundle command
+	rootCmd.AddCommand(supportBundleCmd)
+	supportBundleCmd.AddCommand(supportBundleUploadCmd)
+
+	supportBundleUploadCmd.Flags().StringVar(&uploadConfig.Target, "to", "", "The s3://<bucket>/<key> object or the http(s) URL the bundle is uploaded to.")
+	supportBundleUploadCmd.Flags().StringVar(&supportBundleFile, "bundle", support.DefaultBundleFile, "Where the bundle is packaged and kept until it's uploaded.")
+	supportBundleUploadCmd.Flags().Int64Var(&uploadMaxRateKiB, "max-rate-kib", 0, "Limit the upload rate to this many KiB per second (0 is unlimited).")
+	supportBundleUploadCmd.Flags().Int64Var(&uploadChunkMiB, "chunk-mib", support.DefaultChunkSize>>20, "The size of the uploaded chunks in MiB, an interrupted upload resumes after the last one received.")
+	supportBundleUploadCmd.Flags().StringVar(&uploadConfig.S3Endpoint, "s3-endpoint", "", "The S3 API endpoint, e.g. an on-premise object store (defaults to the AWS one of the region).")
+	supportBundleUploadCmd.Flags().StringVar(&uploadConfig.S3Region, "s3-region", support.DefaultS3Region, "The region the S3 requests are signed for.")
+	addBackupDirFlag(supportBundleUploadCmd)
+
+	supportBundleUploadCmd.MarkFlagRequired("to")
+}
+
+func uploadSupportBundle() {
+
+	uploadConfig.ChunkSize = uploadChunkMiB << 20
+	uploadConfig.MaxRate = uploadMaxRateKiB << 10
+	if err := uploadConfig.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if err := seed.ValidateBackupDir(backupDir); err != nil {
+		log.Fatal(err)
+	}
+
+	if support.Resumable(supportBundleFile, uploadConfig.Target) {
+		log.Infof("Resuming the upload of %s", supportBundleFile)
+	} else {
+		files, err := support.Files(backupDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = support.Create(log, supportBundleFile, files); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := support.Upload(log, supportBundleFile, uploadConfig); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.Remove(supportBundleFile); err != nil {
+		log.Warnf("Failed to remove %s: %v", supportBundleFile, err)
+	}
+	log.Infof("Support bundle uploaded to %s", uploadConfig.Target)
+}
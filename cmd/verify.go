@@ -0,0 +1,209 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	registry "ibu-imager/internal/registry_client"
+	verifier "ibu-imager/internal/seed_verify"
+)
+
+// verifyRemote verifies the seed image in the registry instead of the local backup dir
+var verifyRemote bool
+
+// verifyContent downloads the seed image layers to hash the artifacts, instead of checking the manifest only
+var verifyContent bool
+
+// verifySample configures the sampling of the archived files compared with their host sources
+var verifySample verifier.SampleConfig
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify image",
+	Short: "Verify the artifacts of a seed image against the digests it is labeled with.",
+	Long: `Verify the artifacts of a seed image against the digests it is labeled with.
+
+By default, the artifacts of the local backup dir are hashed and compared with the labels of the
+locally built image. With --remote, only the manifest and the config blob of the pushed image are
+downloaded, and the registry is asked for the size of every layer. Add --content to download the
+layers and hash the artifacts they contain.
+
+With --sample, the archives of the local backup dir are also streamed once to draw a random sample of
+their files, which are compared with their host sources: type, mode, ownership, size, symlink target
+and content. Sources removed or modified since the seed was created are only covered by the archive
+digest. Sampling gives statistical confidence in the archives right after create, without
+extracting them.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		verify(args[0])
+	},
+}
+
+func init() {
+
+	// Add verify command
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().BoolVar(&verifyRemote, "remote", false, "Verify the seed image in the registry, without downloading its layers.")
+	verifyCmd.Flags().BoolVar(&verifyContent, "content", false, "With --remote, download the layers and hash the artifacts.")
+	verifyCmd.Flags().IntVar(&verifySample.Files, "sample", 0, "Compare the given number of files sampled out of every archive with their host sources.")
+	verifyCmd.Flags().Int64Var(&verifySample.Seed, "sample-seed", 0, "The seed of the random sampling, to draw a failed sample again. Random by default.")
+	verifyCmd.Flags().StringVarP(&authFile, "authfile", "a", imageRegistryAuthFile, "The path to the authentication file of the container registry.")
+	addBackupDirFlag(verifyCmd)
+}
+
+func verify(image string) {
+
+	var (
+		checks  []verifier.Check
+		sampled []verifier.SampledFile
+		err     error
+	)
+	switch {
+	case verifyRemote:
+		if verifySample.Files > 0 {
+			log.Fatal("--sample compares the local archives with their host sources, it can't be used with --remote")
+		}
+		checks, err = verifyRemoteImage(image)
+	case verifyContent:
+		log.Fatal("--content requires --remote, local verification always hashes the artifacts")
+	case verifySample.Files > 0:
+		if verifySample.Seed == 0 {
+			verifySample.Seed = time.Now().UnixNano()
+		}
+		log.Infof("Sampling %d files per archive, with seed %d", verifySample.Files, verifySample.Seed)
+		verifySample.HostRoot = hostRoot
+		checks, sampled, err = verifier.VerifySample(newRuntime(newOps()), image, backupDir, verifySample)
+	default:
+		checks, err = verifier.VerifyLocal(newRuntime(newOps()), image, backupDir)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if jsonOutput(false) {
+		printVerifyResult(image, checks, sampled)
+		return
+	}
+
+	failed := 0
+	for _, check := range checks {
+		switch {
+		case check.Error != nil:
+			failed++
+			fmt.Printf("FAIL  %s: %v\n", check.Artifact, check.Error)
+		case check.ContentVerified:
+			fmt.Printf("OK    %s (%s)\n", check.Artifact, check.Digest)
+		default:
+			fmt.Printf("OK    %s (layer present)\n", check.Artifact)
+		}
+	}
+	failedSamples, hostVerified := 0, 0
+	for _, file := range sampled {
+		switch {
+		case file.Error != nil:
+			failedSamples++
+			fmt.Printf("FAIL  %s: %s: %v\n", file.Archive, file.Name, file.Error)
+		case file.HostVerified:
+			hostVerified++
+			fmt.Printf("OK    %s: %s (matches host)\n", file.Archive, file.Name)
+		default:
+			fmt.Printf("OK    %s: %s (host source gone or changed, archive digest only)\n", file.Archive, file.Name)
+		}
+	}
+	if failed > 0 {
+		log.Fatalf("%d out of %d artifacts failed verification", failed, len(checks))
+	}
+	if failedSamples > 0 {
+		log.Fatalf("%d out of %d sampled files failed verification", failedSamples, len(sampled))
+	}
+	if verifySample.Files > 0 {
+		log.Infof("%d sampled files verified, %d of them against their host sources", len(sampled), hostVerified)
+	}
+	log.Infof("All %d artifacts of %s verified", len(checks), image)
+}
+
+func verifyRemoteImage(image string) ([]verifier.Check, error) {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return nil, err
+	}
+	client, err := registry.NewClient(authFile)
+	if err != nil {
+		return nil, err
+	}
+	return verifier.VerifyRemote(client, ref, verifyContent)
+}
+
+// verifiedArtifact is the verification of an artifact printed as JSON
+type verifiedArtifact struct {
+	Artifact        string `json:"artifact"`
+	Digest          string `json:"digest,omitempty"`
+	ContentVerified bool   `json:"contentVerified"`
+	Error           string `json:"error,omitempty"`
+}
+
+// sampledFile is the verification of a sampled file printed as JSON
+type sampledFile struct {
+	Archive      string `json:"archive"`
+	Name         string `json:"name"`
+	Digest       string `json:"digest,omitempty"`
+	HostVerified bool   `json:"hostVerified"`
+	Error        string `json:"error,omitempty"`
+}
+
+// verifyResult is the verify result printed as JSON
+type verifyResult struct {
+	Image     string             `json:"image"`
+	Passed    bool               `json:"passed"`
+	Artifacts []verifiedArtifact `json:"artifacts"`
+	Samples   []sampledFile      `json:"samples,omitempty"`
+	// SampleSeed draws the same sample again, set when sampling
+	SampleSeed int64 `json:"sampleSeed,omitempty"`
+}
+
+// printVerifyResult prints the verification as JSON, failing when an artifact or sampled file failed it
+func printVerifyResult(image string, checks []verifier.Check, sampled []verifier.SampledFile) {
+	result := verifyResult{Image: image, Passed: true, Artifacts: []verifiedArtifact{}}
+	if verifySample.Files > 0 {
+		result.SampleSeed = verifySample.Seed
+	}
+	for _, check := range checks {
+		artifact := verifiedArtifact{Artifact: check.Artifact, Digest: check.Digest, ContentVerified: check.ContentVerified}
+		if check.Error != nil {
+			artifact.Error = check.Error.Error()
+			result.Passed = false
+		}
+		result.Artifacts = append(result.Artifacts, artifact)
+	}
+	for _, file := range sampled {
+		sample := sampledFile{Archive: file.Archive, Name: file.Name, Digest: file.Digest, HostVerified: file.HostVerified}
+		if file.Error != nil {
+			sample.Error = file.Error.Error()
+			result.Passed = false
+		}
+		result.Samples = append(result.Samples, sample)
+	}
+	printJSON(result)
+	if !result.Passed {
+		log.Fatalf("%s failed verification", image)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"ibu-imager/internal/version"
+)
+
+// versionJSON prints the build information as JSON
+var versionJSON bool
+
+// versionCmd represents the version command
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the imager version and build information.",
+	Long: `Print the imager version and build information.
+
+The seed format version is the highest seed manifest schema the imager creates and restores: seeds of a
+newer format are refused by restore and verify.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		printVersion()
+	},
+}
+
+func init() {
+
+	// Add version command
+	rootCmd.AddCommand(versionCmd)
+
+	versionCmd.Flags().BoolVar(&versionJSON, "json", false, "Print the build information as JSON, like --output-format json.")
+}
+
+func printVersion() {
+
+	info := version.Get()
+	if jsonOutput(versionJSON) {
+		printJSON(info)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Version:\t%s\n", info.Version)
+	fmt.Fprintf(w, "Git commit:\t%s\n", info.GitCommit)
+	fmt.Fprintf(w, "Build date:\t%s\n", info.BuildDate)
+	fmt.Fprintf(w, "Go version:\t%s\n", info.GoVersion)
+	fmt.Fprintf(w, "Platform:\t%s\n", info.Platform)
+	fmt.Fprintf(w, "Seed format:\t%d\n", info.SeedFormatVersion)
+	w.Flush()
+}
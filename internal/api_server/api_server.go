@@ -0,0 +1,461 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api_server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	seed "ibu-imager/internal/seed_creator"
+)
+
+const (
+	// DefaultListen only serves the API to root on the node, through a unix socket, orchestration tools run
+	// there or tunnel to it
+	DefaultListen = "/run/ibu-imager.sock"
+	// DefaultPollInterval is how often the status file is read for the progress events
+	DefaultPollInterval = time.Second
+	// shutdownTimeout is how long the open requests and streams get to finish on shutdown
+	shutdownTimeout = 5 * time.Second
+)
+
+// CreateSeedRequest is the seed creation the CreateSeed call starts, mapped to the create flags. The registry
+// credentials and the recert image are the server defaults, a caller can't have the imager read another host
+// file or run another image as root.
+type CreateSeedRequest struct {
+	Registry         string   `json:"registry"`
+	MirrorRegistries []string `json:"mirrorRegistries,omitempty"`
+	NodeRole         string   `json:"nodeRole,omitempty"`
+	SkipPush         bool     `json:"skipPush,omitempty"`
+	SkipPreflight    bool     `json:"skipPreflight,omitempty"`
+	Resume           bool     `json:"resume,omitempty"`
+	// Args are further create flags among the allowed ones, e.g. --include-ssh-keys merge
+	Args []string `json:"args,omitempty"`
+}
+
+// allowedCreateFlags are the create flags the requests can pass in their args. The flags reading or
+// writing files of the caller's choosing, or sending data out, e.g. --backup-dir, --include-path or
+// --notify-webhook, aren't allowed, the API would run them as root for any caller.
+var allowedCreateFlags = map[string]bool{
+	"tag":                      true,
+	"include-namespaces":       true,
+	"exclude-namespaces":       true,
+	"include-registries":       true,
+	"exclude-registries":       true,
+	"recert-cpus":              true,
+	"recert-memory":            true,
+	"recert-etcd-copy":         true,
+	"recert-timeout":           true,
+	"include-ssh-keys":         true,
+	"include-mcs-certs":        true,
+	"include-rendered-configs": true,
+	"include-usr-local":        true,
+	"precache-plan":            true,
+	"precache-plan-workers":    true,
+	"precache-plan-rate":       true,
+	"audit-logs":               true,
+	"var-exclude":              true,
+	"keep-crio":                true,
+	"strict":                   true,
+	"only-steps":               true,
+	"skip-steps":               true,
+	"image-store":              true,
+	"skip-lint":                true,
+	"verbose":                  true,
+}
+
+// Validate checks the seed creation request
+func (r *CreateSeedRequest) Validate() error {
+	if r.Registry == "" {
+		return errors.New("The container registry the seed image is pushed to is required")
+	}
+	if len(r.Args) > 0 && !strings.HasPrefix(r.Args[0], "-") {
+		return errors.Errorf("Invalid create flag %q", r.Args[0])
+	}
+	for _, arg := range r.Args {
+		// The flag values are the args not starting with -, a value starting with - is checked as a flag
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, _, _ := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if !strings.HasPrefix(arg, "--") || !allowedCreateFlags[name] {
+			return errors.Errorf("The create flag %s can't be used through the API", arg)
+		}
+	}
+	return nil
+}
+
+// args returns the create command line of the request
+func (r *CreateSeedRequest) args() []string {
+	args := []string{"create", "--registry", r.Registry}
+	for _, mirror := range r.MirrorRegistries {
+		args = append(args, "--mirror-registry", mirror)
+	}
+	if r.NodeRole != "" {
+		args = append(args, "--node-role", r.NodeRole)
+	}
+	if r.SkipPush {
+		args = append(args, "--skip-push")
+	}
+	if r.SkipPreflight {
+		args = append(args, "--skip-preflight")
+	}
+	if r.Resume {
+		args = append(args, "--resume")
+	}
+	return append(args, r.Args...)
+}
+
+// CreateSeedResponse identifies the process the seed creation runs in
+type CreateSeedResponse struct {
+	PID int `json:"pid"`
+}
+
+// PreflightRequest selects the preflight checks like the preflight flags, with the server default registry
+// credentials and recert image like CreateSeedRequest
+type PreflightRequest struct {
+	Registry string `json:"registry,omitempty"`
+	NodeRole string `json:"nodeRole,omitempty"`
+	SkipPush bool   `json:"skipPush,omitempty"`
+}
+
+// errorResponse is the body of the failed calls
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Config describes how the server runs the imager
+type Config struct {
+	// Command returns the imager command with the args, run in a child process by CreateSeed
+	Command func(args ...string) *exec.Cmd
+	// Preflight runs the preflight checks of the request
+	Preflight func(request PreflightRequest) (*seed.PreflightReport, error)
+	// StatusFile is the run status the progress is read from
+	StatusFile string
+	// Token is the bearer token the calls must present, no authentication when empty
+	Token string
+	// PollInterval is how often the status file is read for the progress events
+	PollInterval time.Duration
+}
+
+// Server serves the API driving the imager: CreateSeed starts a create run, Preflight runs the preflight
+// checks and GetProgress returns, or streams, the progress of the run
+type Server struct {
+	log    *logrus.Logger
+	config Config
+	events hub
+
+	mu sync.Mutex
+	// child is the create run started by CreateSeed, nil when none is running
+	child *exec.Cmd
+	// preflightRunning serializes the preflight checks, they pull images and query the cluster
+	preflightRunning bool
+}
+
+// NewServer returns a server running the imager commands of the config
+func NewServer(log *logrus.Logger, config Config) *Server {
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+	return &Server{log: log, config: config}
+}
+
+// Handler returns the API routes
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/seed:create", s.route(http.MethodPost, s.createSeed))
+	mux.HandleFunc("/v1/preflight", s.route(http.MethodPost, s.preflight))
+	mux.HandleFunc("/v1/progress", s.route(http.MethodGet, s.getProgress))
+	mux.HandleFunc("/v1/progress/events", s.route(http.MethodGet, s.streamProgress))
+	return mux
+}
+
+// route restricts the handler to the method and to the callers presenting the token
+func (s *Server) route(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("%s only accepts %s", r.URL.Path, method))
+			return
+		}
+		if s.config.Token != "" {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.Token)) != 1 {
+				writeError(w, http.StatusUnauthorized, errors.New("Missing or invalid bearer token"))
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+// ListenAndServe serves the API on the address until the context is done. An absolute path is a unix
+// socket only root can connect to, a TCP address requires the token.
+func (s *Server) ListenAndServe(ctx context.Context, address string) error {
+	listener, err := s.listen(address)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to listen on %s", address)
+	}
+	return s.Serve(ctx, listener)
+}
+
+// listen listens on the unix socket or TCP address
+func (s *Server) listen(address string) (net.Listener, error) {
+	if !strings.HasPrefix(address, "/") {
+		if s.config.Token == "" {
+			return nil, errors.New("A token is required to serve the API on a TCP address, anyone reaching it could run the imager as root")
+		}
+		return net.Listen("tcp", address)
+	}
+
+	// The socket of a previous serve isn't removed when it's killed
+	if info, err := os.Lstat(address); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err = os.Remove(address); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(address, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// Serve serves the API on the listener until the context is done, publishing the progress events of
+// every run, including the ones not started through the API
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	server := &http.Server{Handler: s.Handler(), BaseContext: func(net.Listener) context.Context { return ctx }}
+	go s.pollStatus(ctx)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	s.log.Infof("Serving the imager API on %s", listener.Addr())
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return errors.Wrap(err, "Failed to serve the imager API")
+	}
+	return nil
+}
+
+// pollStatus publishes the events of the status file changes until the context is done
+func (s *Server) pollStatus(ctx context.Context) {
+	prev, _ := seed.LoadStatus(s.config.StatusFile)
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			cur, err := seed.LoadStatus(s.config.StatusFile)
+			if err != nil {
+				// The status is written through a rename, a failed read is retried on the next poll
+				s.log.Debugf("Failed to read the run status: %v", err)
+				continue
+			}
+			for _, event := range diffEvents(prev, cur, now.UTC()) {
+				s.events.publish(event)
+			}
+			prev = cur
+		}
+	}
+}
+
+// createSeed starts a create run in a child process, its output going to the server log
+func (s *Server) createSeed(w http.ResponseWriter, r *http.Request) {
+	var request CreateSeedRequest
+	if err := decodeRequest(r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err, "Invalid seed creation request"))
+		return
+	}
+	if err := request.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkIdle(); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	command := s.config.Command(request.args()...)
+	output := s.log.WriterLevel(logrus.InfoLevel)
+	command.Stdout, command.Stderr = output, output
+	if err := command.Start(); err != nil {
+		output.Close()
+		writeError(w, http.StatusInternalServerError, errors.Wrap(err, "Failed to start the seed creation"))
+		return
+	}
+	s.child = command
+	s.log.Infof("Seed creation to %s started, pid %d", request.Registry, command.Process.Pid)
+	go s.waitChild(command, output)
+
+	writeJSON(w, http.StatusAccepted, CreateSeedResponse{PID: command.Process.Pid})
+}
+
+// decodeRequest decodes the JSON body of the request, refusing unknown fields so settings the API doesn't
+// take, e.g. the authFile of older clients, fail instead of being silently ignored
+func decodeRequest(r *http.Request, request interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(request)
+}
+
+// checkIdle fails when a create run, started through the API or not, or preflight checks are in progress
+func (s *Server) checkIdle() error {
+	if s.child != nil {
+		return errors.Errorf("A seed creation is already running, pid %d", s.child.Process.Pid)
+	}
+	if s.preflightRunning {
+		return errors.New("The preflight checks are running")
+	}
+	report, err := seed.LoadStatus(s.config.StatusFile)
+	if err != nil {
+		return err
+	}
+	if report != nil && report.Result == seed.ResultRunning {
+		return errors.Errorf("A seed creation is already running, pid %d", report.PID)
+	}
+	return nil
+}
+
+// waitChild reaps the create run. A run exiting before it recorded its status, e.g. on invalid flags, only
+// shows in the server log and the run-finished event published here.
+func (s *Server) waitChild(command *exec.Cmd, output interface{ Close() error }) {
+	err := command.Wait()
+	output.Close()
+
+	s.mu.Lock()
+	s.child = nil
+	s.mu.Unlock()
+	if err == nil {
+		return
+	}
+	s.log.Warnf("Seed creation pid %d failed: %v", command.Process.Pid, err)
+	if report, _ := seed.LoadStatus(s.config.StatusFile); report == nil || report.PID != command.Process.Pid {
+		s.events.publish(Event{Type: EventRunFinished, Time: time.Now().UTC(), Result: seed.ResultFailed, Error: err.Error()})
+	}
+}
+
+// preflight runs the preflight checks in the server process, they don't stop anything
+func (s *Server) preflight(w http.ResponseWriter, r *http.Request) {
+	var request PreflightRequest
+	if err := decodeRequest(r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err, "Invalid preflight request"))
+		return
+	}
+
+	s.mu.Lock()
+	if err := s.checkIdle(); err != nil {
+		s.mu.Unlock()
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	s.preflightRunning = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.preflightRunning = false
+		s.mu.Unlock()
+	}()
+
+	report, err := s.config.Preflight(request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// getProgress returns the status of the current or last run
+func (s *Server) getProgress(w http.ResponseWriter, r *http.Request) {
+	report, err := seed.LoadStatus(s.config.StatusFile)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if report == nil {
+		writeError(w, http.StatusNotFound, errors.New("No seed creation run recorded"))
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// streamProgress streams the progress events as JSON lines, starting with the status of the current or
+// last run, until the caller disconnects
+func (s *Server) streamProgress(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("Streaming isn't supported"))
+		return
+	}
+	events := s.events.subscribe()
+	defer s.events.unsubscribe(events)
+	report, err := seed.LoadStatus(s.config.StatusFile)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	event := Event{Type: EventProgress, Time: time.Now().UTC(), Report: report}
+	if report != nil {
+		event.RunID = report.RunID
+	}
+	for {
+		if err := encoder.Encode(event); err != nil {
+			return
+		}
+		flusher.Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case event = <-events:
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
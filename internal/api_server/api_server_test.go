@@ -0,0 +1,227 @@
+package api_server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	seed "ibu-imager/internal/seed_creator"
+)
+
+func TestApiServer(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "API Server Suite")
+}
+
+var _ = Describe("Progress events", func() {
+	started := time.Date(2023, 9, 1, 10, 0, 0, 0, time.UTC)
+	now := started.Add(time.Minute)
+
+	It("Follows a run from its start to its end", func() {
+		running := &seed.RunReport{RunID: "a1", Result: seed.ResultRunning, StartedAt: started, CurrentStep: "stop-services"}
+		events := diffEvents(nil, running, now)
+		Expect(events).To(HaveLen(2))
+		Expect(events[0].Type).To(Equal(EventRunStarted))
+		Expect(events[1]).To(Equal(Event{Type: EventStepStarted, Time: now, RunID: "a1", Step: "stop-services"}))
+
+		next := *running
+		next.Steps = []seed.StepReport{{Name: "stop-services", Duration: time.Second}}
+		next.CurrentStep = "backup-var"
+		events = diffEvents(running, &next, now)
+		Expect(events).To(HaveLen(2))
+		Expect(events[0]).To(Equal(Event{Type: EventStepFinished, Time: now, RunID: "a1", Step: "stop-services", Duration: time.Second}))
+		Expect(events[1].Step).To(Equal("backup-var"))
+		Expect(diffEvents(&next, &next, now)).To(BeEmpty())
+
+		failed := next
+		failed.Steps = append(next.Steps, seed.StepReport{Name: "backup-var", Error: "no space left"})
+		failed.CurrentStep = ""
+		failed.Result, failed.Error = seed.ResultFailed, "no space left"
+		events = diffEvents(&next, &failed, now)
+		Expect(events).To(HaveLen(2))
+		Expect(events[0].Error).To(Equal("no space left"))
+		Expect(events[1].Type).To(Equal(EventRunFinished))
+		Expect(events[1].Result).To(Equal(seed.ResultFailed))
+	})
+
+	It("Doesn't report the finished run it starts from", func() {
+		done := &seed.RunReport{RunID: "a1", Result: seed.ResultSucceeded, StartedAt: started}
+		Expect(diffEvents(done, done, now)).To(BeEmpty())
+		events := diffEvents(done, &seed.RunReport{RunID: "b2", Result: seed.ResultRunning, StartedAt: now}, now)
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].RunID).To(Equal("b2"))
+	})
+})
+
+var _ = Describe("API", func() {
+	var (
+		tmpDir     string
+		statusFile string
+		commands   [][]string
+		server     *Server
+	)
+
+	BeforeEach(func() {
+		tmpDir, _ = os.MkdirTemp("", "test")
+		statusFile = filepath.Join(tmpDir, "status.json")
+		commands = nil
+		server = NewServer(logrus.New(), Config{
+			Command: func(args ...string) *exec.Cmd {
+				commands = append(commands, args)
+				return exec.Command("true")
+			},
+			Preflight: func(request PreflightRequest) (*seed.PreflightReport, error) {
+				return &seed.PreflightReport{Checks: []seed.PreflightCheck{{Name: "registry", Status: seed.PreflightPass, Message: request.Registry}}}, nil
+			},
+			StatusFile:   statusFile,
+			PollInterval: 10 * time.Millisecond,
+		})
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return recorder
+	}
+
+	It("Starts a seed creation with the create flags of the request", func() {
+		response := call(http.MethodPost, "/v1/seed:create", `{"registry": "quay.io/org/seed", "skipPreflight": true, "args": ["--keep-crio"]}`)
+		Expect(response.Code).To(Equal(http.StatusAccepted))
+		Expect(commands).To(Equal([][]string{{"create", "--registry", "quay.io/org/seed", "--skip-preflight", "--keep-crio"}}))
+
+		Expect(call(http.MethodPost, "/v1/seed:create", `{"registry": "quay.io/org/seed", "args": ["--confirm"]}`).Code).
+			To(Equal(http.StatusBadRequest))
+		Expect(call(http.MethodGet, "/v1/seed:create", "").Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	It("Only passes the allowed create flags", func() {
+		request := CreateSeedRequest{Registry: "quay.io/org/seed",
+			Args: []string{"--tag", "seed-{date}", "--include-ssh-keys=merge", "--var-exclude", "/var/lib/prometheus/*"}}
+		Expect(request.Validate()).To(Succeed())
+		for _, args := range [][]string{
+			{"--backup-dir", "/etc"},
+			{"--include-path=/root"},
+			{"--notify-webhook", "https://example.com"},
+			{"--tag", "--backup-dir=/etc"},
+			{"-v"},
+			{"seed"},
+		} {
+			request.Args = args
+			Expect(request.Validate()).To(HaveOccurred(), "%v", args)
+		}
+		Expect(commands).To(BeEmpty())
+	})
+
+	It("Refuses the registry credentials and recert image of the caller", func() {
+		for _, body := range []string{
+			`{"registry": "quay.io/org/seed", "authFile": "/root/.ssh/id_rsa"}`,
+			`{"registry": "quay.io/org/seed", "recertImage": "quay.io/attacker/shell:latest"}`,
+			`{"registry": "quay.io/org/seed", "args": ["--authfile", "/root/.ssh/id_rsa"]}`,
+			`{"registry": "quay.io/org/seed", "args": ["--recert-image=quay.io/attacker/shell:latest"]}`,
+		} {
+			Expect(call(http.MethodPost, "/v1/seed:create", body).Code).To(Equal(http.StatusBadRequest), body)
+		}
+		Expect(commands).To(BeEmpty())
+
+		for _, body := range []string{
+			`{"registry": "quay.io/org/seed", "authFile": "/root/.ssh/id_rsa"}`,
+			`{"registry": "quay.io/org/seed", "recertImage": "quay.io/attacker/shell:latest"}`,
+		} {
+			Expect(call(http.MethodPost, "/v1/preflight", body).Code).To(Equal(http.StatusBadRequest), body)
+		}
+	})
+
+	It("Refuses a seed creation while a run is in progress", func() {
+		Expect(seed.SaveStatus(statusFile, &seed.RunReport{Result: seed.ResultRunning, PID: os.Getpid()})).To(Succeed())
+		response := call(http.MethodPost, "/v1/seed:create", `{"registry": "quay.io/org/seed"}`)
+		Expect(response.Code).To(Equal(http.StatusConflict))
+		Expect(response.Body.String()).To(ContainSubstring("already running"))
+		Expect(commands).To(BeEmpty())
+	})
+
+	It("Runs the preflight checks and returns the progress", func() {
+		response := call(http.MethodPost, "/v1/preflight", `{"registry": "quay.io/org/seed"}`)
+		Expect(response.Code).To(Equal(http.StatusOK))
+		var report seed.PreflightReport
+		Expect(json.Unmarshal(response.Body.Bytes(), &report)).To(Succeed())
+		Expect(report.Checks[0].Message).To(Equal("quay.io/org/seed"))
+
+		Expect(call(http.MethodGet, "/v1/progress", "").Code).To(Equal(http.StatusNotFound))
+		Expect(seed.SaveStatus(statusFile, &seed.RunReport{RunID: "a1", Result: seed.ResultSucceeded})).To(Succeed())
+		response = call(http.MethodGet, "/v1/progress", "")
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Body.String()).To(ContainSubstring(`"runId":"a1"`))
+	})
+
+	It("Requires the token when set", func() {
+		server.config.Token = "secret"
+		Expect(call(http.MethodGet, "/v1/progress", "").Code).To(Equal(http.StatusUnauthorized))
+		request := httptest.NewRequest(http.MethodGet, "/v1/progress", nil)
+		request.Header.Set("Authorization", "Bearer secret")
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, request)
+		Expect(recorder.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("Serves the API to root only on a unix socket and requires the token on TCP", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		Expect(server.ListenAndServe(ctx, "127.0.0.1:0")).To(MatchError(ContainSubstring("A token is required")))
+
+		socket := filepath.Join(tmpDir, "api.sock")
+		Expect(os.WriteFile(socket, nil, 0600)).To(Succeed())
+		Expect(server.ListenAndServe(ctx, socket)).To(MatchError(ContainSubstring("address already in use")))
+		Expect(os.Remove(socket)).To(Succeed())
+
+		listener, err := server.listen(socket)
+		Expect(err).ToNot(HaveOccurred())
+		defer listener.Close()
+		info, err := os.Stat(socket)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode() & os.ModeSocket).ToNot(BeZero())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	})
+
+	It("Streams the progress events", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = server.Serve(ctx, listener) }()
+
+		response, err := http.Get("http://" + listener.Addr().String() + "/v1/progress/events")
+		Expect(err).ToNot(HaveOccurred())
+		defer response.Body.Close()
+		Expect(response.Header.Get("Content-Type")).To(Equal("application/x-ndjson"))
+		lines := bufio.NewScanner(response.Body)
+		next := func() Event {
+			Expect(lines.Scan()).To(BeTrue())
+			var event Event
+			Expect(json.Unmarshal(lines.Bytes(), &event)).To(Succeed())
+			return event
+		}
+		Expect(next().Type).To(Equal(EventProgress))
+
+		Expect(seed.SaveStatus(statusFile, &seed.RunReport{RunID: "a1", Result: seed.ResultRunning, PID: os.Getpid(),
+			CurrentStep: "stop-services"})).To(Succeed())
+		Expect(next().Type).To(Equal(EventRunStarted))
+		Expect(next().Step).To(Equal("stop-services"))
+	})
+})
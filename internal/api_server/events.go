@@ -0,0 +1,109 @@
+package api_server
+
+import (
+	"sync"
+	"time"
+
+	seed "ibu-imager/internal/seed_creator"
+)
+
+const (
+	// EventProgress is the first event of a stream, holding the status of the current or last run
+	EventProgress = "progress"
+	// EventRunStarted is sent when a seed creation run starts
+	EventRunStarted = "run-started"
+	// EventStepStarted is sent when a step of the run starts
+	EventStepStarted = "step-started"
+	// EventStepFinished is sent when a step of the run completes or fails
+	EventStepFinished = "step-finished"
+	// EventRunFinished is sent when the run succeeds, fails or its process dies
+	EventRunFinished = "run-finished"
+
+	// subscriberBuffer is how many events a slow subscriber may lag behind before missing some
+	subscriberBuffer = 64
+)
+
+// Event is a progress event of a seed creation run, streamed as a JSON line
+type Event struct {
+	Type  string    `json:"type"`
+	Time  time.Time `json:"time"`
+	RunID string    `json:"runId,omitempty"`
+	Step  string    `json:"step,omitempty"`
+	// Duration is the duration of the finished step
+	Duration time.Duration `json:"duration,omitempty"`
+	// Result is the result of the finished run
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Report is the status of the run, only sent with the progress and run-finished events
+	Report *seed.RunReport `json:"report,omitempty"`
+}
+
+// diffEvents returns the events that took the run status from prev to cur. The status file is polled, a
+// step starting and finishing between two polls only has its step-finished event.
+func diffEvents(prev, cur *seed.RunReport, now time.Time) []Event {
+	if cur == nil {
+		return nil
+	}
+	var events []Event
+	if prev == nil || prev.RunID != cur.RunID || !prev.StartedAt.Equal(cur.StartedAt) {
+		events = append(events, Event{Type: EventRunStarted, Time: now, RunID: cur.RunID})
+		prev = &seed.RunReport{Result: seed.ResultRunning}
+	}
+
+	for _, step := range cur.Steps[min(len(prev.Steps), len(cur.Steps)):] {
+		events = append(events, Event{Type: EventStepFinished, Time: now, RunID: cur.RunID, Step: step.Name,
+			Duration: step.Duration, Error: step.Error})
+	}
+	if cur.CurrentStep != "" && (cur.CurrentStep != prev.CurrentStep || len(cur.Steps) != len(prev.Steps)) {
+		events = append(events, Event{Type: EventStepStarted, Time: now, RunID: cur.RunID, Step: cur.CurrentStep})
+	}
+	if cur.Result != seed.ResultRunning && prev.Result == seed.ResultRunning {
+		events = append(events, Event{Type: EventRunFinished, Time: now, RunID: cur.RunID, Result: cur.Result,
+			Error: cur.Error, Report: cur})
+	}
+	return events
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// hub fans the events out to the streams subscribed to them
+type hub struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+// subscribe returns a channel receiving the events until unsubscribed
+func (h *hub) subscribe() chan Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers == nil {
+		h.subscribers = map[chan Event]struct{}{}
+	}
+	events := make(chan Event, subscriberBuffer)
+	h.subscribers[events] = struct{}{}
+	return events
+}
+
+func (h *hub) unsubscribe(events chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, events)
+}
+
+// publish sends the event to every subscriber. Subscribers lagging a full buffer behind miss it rather
+// than blocking the others, GET /v1/progress still returns the whole status.
+func (h *hub) publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for events := range h.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
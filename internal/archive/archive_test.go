@@ -0,0 +1,202 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/sys/unix"
+)
+
+func TestArchive(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Archive Suite")
+}
+
+func writeTestArchive(archive string, headers []*tar.Header, contents map[string]string) string {
+	f, err := os.Create(archive)
+	Expect(err).ToNot(HaveOccurred())
+	gzipWriter := gzip.NewWriter(f)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, header := range headers {
+		header.Size = int64(len(contents[header.Name]))
+		Expect(tarWriter.WriteHeader(header)).To(Succeed())
+		_, err = tarWriter.Write([]byte(contents[header.Name]))
+		Expect(err).ToNot(HaveOccurred())
+	}
+	Expect(tarWriter.Close()).To(Succeed())
+	Expect(gzipWriter.Close()).To(Succeed())
+	Expect(f.Close()).To(Succeed())
+
+	data, err := os.ReadFile(archive)
+	Expect(err).ToNot(HaveOccurred())
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+var _ = Describe("Archive extraction", func() {
+	var (
+		tmpDir  string
+		archive string
+		digest  string
+		modTime = time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	BeforeEach(func() {
+		tmpDir, _ = os.MkdirTemp("", "test")
+		archive = filepath.Join(tmpDir, "var.tgz")
+		digest = writeTestArchive(archive, []*tar.Header{
+			{Name: "var/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: modTime},
+			{Name: "var/lib/config", Typeflag: tar.TypeReg, Mode: 0640, ModTime: modTime},
+			{Name: "var/link", Typeflag: tar.TypeSymlink, Linkname: "lib/config", ModTime: modTime},
+		}, map[string]string{"var/lib/config": "content"})
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("Extracts and verifies the archive", func() {
+		dest := filepath.Join(tmpDir, "root")
+		var reported int64
+		Expect(Extract(archive, dest, ExtractOptions{Digest: digest, SkipXattrs: true,
+			Progress: func(read, total int64) { reported = read }})).To(Succeed())
+
+		data, err := os.ReadFile(filepath.Join(dest, "var", "link"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("content"))
+		info, err := os.Stat(filepath.Join(dest, "var", "lib", "config"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0640)))
+		Expect(info.ModTime().UTC()).To(Equal(modTime))
+		Expect(reported).To(BeNumerically(">", 0))
+	})
+
+	It("Fails on checksum mismatch without extracting anything", func() {
+		dest := filepath.Join(tmpDir, "root")
+		Expect(os.MkdirAll(filepath.Join(dest, "var"), 0755)).To(Succeed())
+		Expect(Extract(archive, dest, ExtractOptions{Digest: "sha256:00", SkipXattrs: true})).
+			To(MatchError(ContainSubstring("Checksum mismatch")))
+		Expect(filepath.Join(dest, "var", "lib")).ToNot(BeADirectory())
+		entries, err := os.ReadDir(tmpDir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+	})
+
+	It("Merges the verified entries into the existing directories", func() {
+		dest := filepath.Join(tmpDir, "root")
+		Expect(os.MkdirAll(filepath.Join(dest, "var", "lib"), 0700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dest, "var", "kept"), []byte("kept"), 0600)).To(Succeed())
+		var extracted []string
+		Expect(Extract(archive, dest, ExtractOptions{Digest: digest, SkipXattrs: true, Extracted: func(target string) error {
+			extracted = append(extracted, target)
+			return nil
+		}})).To(Succeed())
+
+		Expect(filepath.Join(dest, "var", "kept")).To(BeAnExistingFile())
+		data, err := os.ReadFile(filepath.Join(dest, "var", "lib", "config"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("content"))
+		info, err := os.Stat(filepath.Join(dest, "var"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
+		Expect(info.ModTime().UTC()).To(Equal(modTime))
+		Expect(extracted).To(ConsistOf(filepath.Join(dest, "var"), filepath.Join(dest, "var", "lib", "config"),
+			filepath.Join(dest, "var", "link")))
+	})
+
+	It("Extracts zstd archives", func() {
+		zstdArchive := filepath.Join(tmpDir, "var.tar.zst")
+		f, err := os.Create(zstdArchive)
+		Expect(err).ToNot(HaveOccurred())
+		zstdWriter, err := zstd.NewWriter(f)
+		Expect(err).ToNot(HaveOccurred())
+		tarWriter := tar.NewWriter(zstdWriter)
+		Expect(tarWriter.WriteHeader(&tar.Header{Name: "etc/hostname", Typeflag: tar.TypeReg, Mode: 0644, Size: 4})).To(Succeed())
+		_, err = tarWriter.Write([]byte("seed"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tarWriter.Close()).To(Succeed())
+		Expect(zstdWriter.Close()).To(Succeed())
+		Expect(f.Close()).To(Succeed())
+
+		dest := filepath.Join(tmpDir, "root")
+		Expect(Extract(zstdArchive, dest, ExtractOptions{SkipXattrs: true})).To(Succeed())
+		data, err := os.ReadFile(filepath.Join(dest, "etc", "hostname"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("seed"))
+	})
+
+	It("Refuses writing through symlinks escaping the destination", func() {
+		evil := filepath.Join(tmpDir, "evil.tgz")
+		writeTestArchive(evil, []*tar.Header{
+			{Name: "escape", Typeflag: tar.TypeSymlink, Linkname: tmpDir},
+			{Name: "escape/owned", Typeflag: tar.TypeReg, Mode: 0600},
+		}, nil)
+		Expect(Extract(evil, filepath.Join(tmpDir, "root"), ExtractOptions{SkipXattrs: true})).To(HaveOccurred())
+		Expect(filepath.Join(tmpDir, "owned")).ToNot(BeAnExistingFile())
+	})
+
+	It("Leaves the labels the host refuses to the relabel", func() {
+		labeled := filepath.Join(tmpDir, "labeled.tgz")
+		writeTestArchive(labeled, []*tar.Header{
+			{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "etc/hosts", Typeflag: tar.TypeReg, Mode: 0644,
+				PAXRecords: map[string]string{xattrPAXPrefix + selinuxXattr: "system_u:object_r:unknown_seed_t:s0"}},
+		}, nil)
+		dest := filepath.Join(tmpDir, "root")
+		var extracted []string
+		Expect(Extract(labeled, dest, ExtractOptions{SkipLabelErrors: true, Extracted: func(target string) error {
+			extracted = append(extracted, target)
+			return nil
+		}})).To(Succeed())
+		Expect(extracted).To(Equal([]string{filepath.Join(dest, "etc"), filepath.Join(dest, "etc", "hosts")}))
+	})
+})
+
+var _ = Describe("File copy", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		tmpDir, _ = os.MkdirTemp("", "test")
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("Copies the content and metadata of the file", func() {
+		src, dst := filepath.Join(tmpDir, "currentconfig"), filepath.Join(tmpDir, "mco-currentconfig.json")
+		modTime := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+		Expect(os.WriteFile(src, []byte("{}"), 0600)).To(Succeed())
+		Expect(os.Chmod(src, 0640)).To(Succeed())
+		Expect(os.Chtimes(src, modTime, modTime)).To(Succeed())
+		xattrs := unix.Lsetxattr(src, "user.ibu", []byte("seed"), 0) == nil
+
+		Expect(CopyFile(src, dst)).To(Succeed())
+		data, err := os.ReadFile(dst)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("{}"))
+		info, err := os.Stat(dst)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0640)))
+		Expect(info.ModTime().UTC()).To(Equal(modTime))
+		if xattrs {
+			value := make([]byte, 4)
+			_, err = unix.Lgetxattr(dst, "user.ibu", value)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(value)).To(Equal("seed"))
+		}
+	})
+
+	It("Fails with a typed error on a missing source", func() {
+		err := CopyFile(filepath.Join(tmpDir, "missing"), filepath.Join(tmpDir, "dst"))
+		Expect(IsMissingSource(err)).To(BeTrue())
+		Expect(filepath.Join(tmpDir, "dst")).ToNot(BeAnExistingFile())
+	})
+})
@@ -0,0 +1,123 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// MissingSourceError is returned when the file to copy doesn't exist
+type MissingSourceError struct {
+	Path string
+}
+
+func (e *MissingSourceError) Error() string {
+	return fmt.Sprintf("%s doesn't exist", e.Path)
+}
+
+// IsMissingSource returns true if the error is a copy of a file that doesn't exist
+func IsMissingSource(err error) bool {
+	var missingErr *MissingSourceError
+	return errors.As(err, &missingErr)
+}
+
+// CopyFile copies a regular file to dst, restoring the ownership, mode, times and extended
+// attributes (including the SELinux label) of the source the way Extract does. The copy is written
+// next to dst first, so dst is either missing or complete.
+func CopyFile(src, dst string) error {
+	info, err := os.Lstat(src)
+	if os.IsNotExist(err) {
+		return &MissingSourceError{Path: src}
+	}
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return errors.Errorf("%s isn't a regular file", src)
+	}
+	// The tar header of the source carries the same metadata an archive entry would
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	if header.PAXRecords, err = readXattrs(src); err != nil {
+		return errors.Wrapf(err, "Failed to read the extended attributes of %s", src)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	if _, err = io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return errors.Wrapf(err, "Failed to copy %s", src)
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+
+	if err = applyMetadata(header, out.Name(), ExtractOptions{}); err != nil {
+		return errors.Wrapf(err, "Failed to copy the metadata of %s", src)
+	}
+	return os.Rename(out.Name(), dst)
+}
+
+// readXattrs returns the extended attributes of a file as tar PAX records
+func readXattrs(file string) (map[string]string, error) {
+	size, err := unix.Llistxattr(file, nil)
+	if err == unix.ENOTSUP {
+		return nil, nil
+	}
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	names := make([]byte, size)
+	if size, err = unix.Llistxattr(file, names); err != nil {
+		return nil, err
+	}
+
+	records := map[string]string{}
+	for _, name := range bytes.Split(names[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		valueSize, err := unix.Lgetxattr(file, string(name), nil)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, valueSize)
+		if valueSize, err = unix.Lgetxattr(file, string(name), value); err != nil {
+			return nil, err
+		}
+		records[xattrPAXPrefix+string(name)] = string(value[:valueSize])
+	}
+	return records, nil
+}
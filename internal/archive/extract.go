@@ -0,0 +1,423 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// xattrPAXPrefix is the PAX record prefix GNU tar and Go use for extended attributes
+	xattrPAXPrefix = "SCHILY.xattr."
+	// selinuxXattr is the extended attribute holding the SELinux label
+	selinuxXattr = "security.selinux"
+	// progressInterval is how many compressed bytes are read between progress reports
+	progressInterval = 64 * 1024 * 1024
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ProgressFunc is called periodically with the compressed bytes read so far and the archive size
+type ProgressFunc func(read, total int64)
+
+// ExtractOptions tunes the archive extraction
+type ExtractOptions struct {
+	// Digest is the expected sha256:<hex> digest of the archive file, verified while extracting. The
+	// entries are only moved into the destination once the digest matches.
+	Digest string
+	// Progress is called periodically while extracting
+	Progress ProgressFunc
+	// SkipXattrs doesn't restore the extended attributes (and thus the SELinux labels)
+	SkipXattrs bool
+	// SkipLabelErrors keeps extracting entries whose SELinux label the host refuses, e.g. unknown to its
+	// policy or denied while enforcing, leaving them to a relabel
+	SkipLabelErrors bool
+	// Extracted is called with the path of every entry once extracted, an error aborting the extraction
+	Extracted func(target string) error
+}
+
+// Extract extracts a tar archive, compressed with gzip or zstd or not at all, into dest. The
+// ownership, modes, times and extended attributes (including SELinux labels) are restored.
+func Extract(archive, dest string, opts ExtractOptions) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	counter := &progressReader{reader: f, total: info.Size(), progress: opts.Progress}
+	reader := bufio.NewReader(io.TeeReader(counter, hash))
+
+	decompressed, closeFn, err := decompress(reader)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to decompress %s", archive)
+	}
+	defer closeFn()
+
+	if opts.Digest == "" {
+		if err = extractTar(decompressed, dest, opts); err != nil {
+			return errors.Wrapf(err, "Failed to extract %s", archive)
+		}
+		return nil
+	}
+
+	// The archive is extracted next to dest, so a corrupted one leaves dest untouched
+	dest, err = filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	staging, err := os.MkdirTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".partial-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	var extracted []string
+	stagingOpts := opts
+	stagingOpts.Extracted = func(target string) error {
+		extracted = append(extracted, strings.TrimPrefix(target, staging))
+		return nil
+	}
+	if err = extractTar(decompressed, staging, stagingOpts); err != nil {
+		return errors.Wrapf(err, "Failed to extract %s", archive)
+	}
+
+	// Read the padding after the tar end marker, so the digest covers the whole file
+	if _, err = io.Copy(io.Discard, reader); err != nil {
+		return errors.Wrapf(err, "Failed to read %s", archive)
+	}
+	digest := "sha256:" + hex.EncodeToString(hash.Sum(nil))
+	if digest != opts.Digest {
+		return errors.Errorf("Checksum mismatch for %s: expected %s, got %s", archive, opts.Digest, digest)
+	}
+
+	// The archive root entry, if any, carries the metadata of dest itself
+	var root *tar.Header
+	for _, name := range extracted {
+		if name == "" {
+			if root, err = stagedHeader(staging, opts); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	if err = os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	if err = commitStaged(staging, dest, opts); err != nil {
+		return errors.Wrapf(err, "Failed to move the extracted %s to %s", archive, dest)
+	}
+	if root != nil {
+		if err = applyMetadata(root, dest, opts); err != nil {
+			return errors.Wrapf(err, "Failed to restore metadata of %s", dest)
+		}
+	}
+	if opts.Extracted != nil {
+		for _, name := range extracted {
+			if err = opts.Extracted(dest + name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// commitStaged moves the entries extracted into staging to dest, merging the directories dest already has
+func commitStaged(staging, dest string, opts ExtractOptions) error {
+	entries, err := os.ReadDir(staging)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		src, dst := filepath.Join(staging, entry.Name()), filepath.Join(dest, entry.Name())
+		if entry.IsDir() {
+			if info, err := os.Lstat(dst); err == nil && info.IsDir() {
+				// Moving the content updates the times of both directories, so the metadata is read first
+				// and restored last
+				header, err := stagedHeader(src, opts)
+				if err != nil {
+					return err
+				}
+				if err = commitStaged(src, dst, opts); err != nil {
+					return err
+				}
+				if err = applyMetadata(header, dst, opts); err != nil {
+					return errors.Wrapf(err, "Failed to restore metadata of %s", dst)
+				}
+				continue
+			}
+		}
+		_ = os.Remove(dst)
+		if err = os.Rename(src, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stagedHeader returns the ownership, mode, times and extended attributes of a staged entry as a tar header
+func stagedHeader(src string, opts ExtractOptions) (*tar.Header, error) {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return nil, err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return nil, err
+	}
+	if !opts.SkipXattrs {
+		if header.PAXRecords, err = readXattrs(src); err != nil {
+			return nil, err
+		}
+	}
+	return header, nil
+}
+
+// decompress detects the compression of the stream from its magic number
+func decompress(reader *bufio.Reader) (io.Reader, func(), error) {
+	magic, err := reader.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		return gzipReader, func() { _ = gzipReader.Close() }, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		decoder, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		return decoder, decoder.Close, nil
+	default:
+		return reader, func() {}, nil
+	}
+}
+
+func extractTar(reader io.Reader, dest string, opts ExtractOptions) error {
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+
+	// Directory times are restored last, since creating their content updates them
+	var dirs []*tar.Header
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := safeJoin(dest, header.Name)
+		if err != nil {
+			return err
+		}
+		if err = extractEntry(tarReader, header, dest, target); err != nil {
+			return errors.Wrapf(err, "Failed to extract %s", header.Name)
+		}
+		if err = applyMetadata(header, target, opts); err != nil {
+			return errors.Wrapf(err, "Failed to restore metadata of %s", header.Name)
+		}
+		if opts.Extracted != nil {
+			if err = opts.Extracted(target); err != nil {
+				return err
+			}
+		}
+		if header.Typeflag == tar.TypeDir {
+			dirs = append(dirs, header)
+		}
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		target, _ := safeJoin(dest, dirs[i].Name)
+		_ = os.Chtimes(target, dirs[i].AccessTime, dirs[i].ModTime)
+	}
+	return nil
+}
+
+func extractEntry(reader io.Reader, header *tar.Header, dest, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	// Refuse writing through symlinks extracted earlier that point outside dest
+	parent, err := filepath.EvalSymlinks(filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+	if parent != dest && !strings.HasPrefix(parent, dest+string(filepath.Separator)) {
+		return errors.Errorf("Archive entry %q escapes the destination through a symlink", header.Name)
+	}
+	mode := os.FileMode(header.Mode).Perm()
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(target, mode); err != nil {
+			return err
+		}
+		return os.Chmod(target, mode)
+	case tar.TypeReg:
+		_ = os.Remove(target)
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(f, reader); err != nil {
+			_ = f.Close()
+			return err
+		}
+		return f.Close()
+	case tar.TypeSymlink:
+		_ = os.Remove(target)
+		return os.Symlink(header.Linkname, target)
+	case tar.TypeLink:
+		source, err := safeJoin(dest, header.Linkname)
+		if err != nil {
+			return err
+		}
+		_ = os.Remove(target)
+		return os.Link(source, target)
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		devMode := map[byte]uint32{tar.TypeChar: unix.S_IFCHR, tar.TypeBlock: unix.S_IFBLK, tar.TypeFifo: unix.S_IFIFO}
+		_ = os.Remove(target)
+		return unix.Mknod(target, devMode[header.Typeflag]|uint32(mode),
+			int(unix.Mkdev(uint32(header.Devmajor), uint32(header.Devminor))))
+	default:
+		// Other entry types (e.g. GNU sparse or volume headers) carry no content to restore
+		return nil
+	}
+}
+
+// applyMetadata restores the ownership, mode, times and extended attributes of an entry
+func applyMetadata(header *tar.Header, target string, opts ExtractOptions) error {
+	if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeDir && header.Typeflag != tar.TypeSymlink &&
+		header.Typeflag != tar.TypeLink && header.Typeflag != tar.TypeChar && header.Typeflag != tar.TypeBlock &&
+		header.Typeflag != tar.TypeFifo {
+		return nil
+	}
+	if os.Geteuid() == 0 {
+		if err := os.Lchown(target, header.Uid, header.Gid); err != nil {
+			return err
+		}
+	}
+
+	if !opts.SkipXattrs {
+		for key, value := range header.PAXRecords {
+			if !strings.HasPrefix(key, xattrPAXPrefix) {
+				continue
+			}
+			attr := strings.TrimPrefix(key, xattrPAXPrefix)
+			err := unix.Lsetxattr(target, attr, []byte(value), 0)
+			if err != nil && attr == selinuxXattr && opts.SkipLabelErrors {
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "Failed to set %s", attr)
+			}
+		}
+	}
+
+	if header.Typeflag == tar.TypeSymlink {
+		times := []unix.Timespec{unix.NsecToTimespec(header.AccessTime.UnixNano()), unix.NsecToTimespec(header.ModTime.UnixNano())}
+		return unix.UtimesNanoAt(unix.AT_FDCWD, target, times, unix.AT_SYMLINK_NOFOLLOW)
+	}
+	// chown clears the setuid/setgid bits, so the mode is restored afterwards
+	if header.Typeflag != tar.TypeLink {
+		if err := os.Chmod(target, os.FileMode(header.Mode).Perm()|specialBits(header.Mode)); err != nil {
+			return err
+		}
+	}
+	accessTime := header.AccessTime
+	if accessTime.IsZero() {
+		accessTime = header.ModTime
+	}
+	return os.Chtimes(target, accessTime, header.ModTime)
+}
+
+func specialBits(mode int64) os.FileMode {
+	var bits os.FileMode
+	if mode&04000 != 0 {
+		bits |= os.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		bits |= os.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		bits |= os.ModeSticky
+	}
+	return bits
+}
+
+// safeJoin joins an archive entry name to dest, refusing entries escaping it
+func safeJoin(dest, name string) (string, error) {
+	target := filepath.Join(dest, filepath.Clean("/"+name))
+	if target != dest && !strings.HasPrefix(target, dest+string(filepath.Separator)) {
+		return "", errors.Errorf("Archive entry %q escapes the destination", name)
+	}
+	return target, nil
+}
+
+// progressReader reports the bytes read through a ProgressFunc
+type progressReader struct {
+	reader       io.Reader
+	read         int64
+	lastReported int64
+	total        int64
+	progress     ProgressFunc
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.reader.Read(buf)
+	p.read += int64(n)
+	if p.progress != nil && (p.read-p.lastReported >= progressInterval || (err == io.EOF && p.read != p.lastReported)) {
+		p.lastReported = p.read
+		p.progress(p.read, p.total)
+	}
+	return n, err
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap_iso
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/ops"
+)
+
+const (
+	// ignitionVersion is the Ignition spec version of the generated configs, supported by RHCOS 4.14
+	ignitionVersion = "3.2.0"
+	// configDir holds the bootstrap configuration on the live and the installed system
+	configDir = "/etc/ibu-imager"
+	// targetIgnitionFile is the Ignition config of the installed system, on the live system
+	targetIgnitionFile = configDir + "/target.ign"
+	// authFile is the registry credentials used to pull the imager and seed images
+	authFile = configDir + "/auth.json"
+	// restoreDoneFile marks the restore as done, so it doesn't run again on the following boots
+	restoreDoneFile = configDir + "/restore.done"
+)
+
+// Config describes how a target node is bootstrapped into a seed
+type Config struct {
+	// SeedImage is the seed image the target is restored from
+	SeedImage string
+	// ImagerImage is the ibu-imager container image running the restore on the installed system
+	ImagerImage string
+	// InstallDisk is the disk RHCOS is installed to, e.g. /dev/sda
+	InstallDisk string
+	// PullSecret is the content of the registry credentials used to pull the imager and seed images
+	PullSecret []byte
+	// SSHKeys are authorized for the core user on the live and the installed system, for troubleshooting
+	SSHKeys []string
+}
+
+// Validate checks that the bootstrap config is complete
+func (c *Config) Validate() error {
+	var missing []string
+	if c.SeedImage == "" {
+		missing = append(missing, "seed image")
+	}
+	if c.ImagerImage == "" {
+		missing = append(missing, "imager image")
+	}
+	if c.InstallDisk == "" {
+		missing = append(missing, "install disk")
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("Incomplete bootstrap config, missing: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// ignition is the subset of the Ignition config spec used by the bootstrap
+type ignition struct {
+	Ignition struct {
+		Version string `json:"version"`
+	} `json:"ignition"`
+	Passwd  *passwd `json:"passwd,omitempty"`
+	Storage struct {
+		Files []file `json:"files,omitempty"`
+	} `json:"storage"`
+	Systemd struct {
+		Units []unit `json:"units,omitempty"`
+	} `json:"systemd"`
+}
+
+type passwd struct {
+	Users []user `json:"users"`
+}
+
+type user struct {
+	Name              string   `json:"name"`
+	SSHAuthorizedKeys []string `json:"sshAuthorizedKeys"`
+}
+
+type file struct {
+	Path      string       `json:"path"`
+	Mode      int          `json:"mode"`
+	Overwrite bool         `json:"overwrite"`
+	Contents  fileContents `json:"contents"`
+}
+
+type fileContents struct {
+	Source string `json:"source"`
+}
+
+type unit struct {
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled"`
+	Contents string `json:"contents"`
+}
+
+func newIgnition(sshKeys []string) *ignition {
+	config := &ignition{}
+	config.Ignition.Version = ignitionVersion
+	if len(sshKeys) > 0 {
+		config.Passwd = &passwd{Users: []user{{Name: "core", SSHAuthorizedKeys: sshKeys}}}
+	}
+	return config
+}
+
+func (i *ignition) addFile(path string, mode int, content []byte) {
+	i.Storage.Files = append(i.Storage.Files, file{
+		Path:      path,
+		Mode:      mode,
+		Overwrite: true,
+		Contents:  fileContents{Source: "data:;base64," + base64.StdEncoding.EncodeToString(content)},
+	})
+}
+
+func (i *ignition) addUnit(name, contents string) {
+	i.Systemd.Units = append(i.Systemd.Units, unit{Name: name, Enabled: true, Contents: contents})
+}
+
+// TargetIgnition returns the Ignition config of the installed system, which restores the seed on first boot.
+// The restore is run by the imager image, which must be of a version having the restore command: the unit
+// checks it does before anything is changed, an older image failing with its usage otherwise.
+func TargetIgnition(config *Config) ([]byte, error) {
+	target := newIgnition(config.SSHKeys)
+	if len(config.PullSecret) > 0 {
+		target.addFile(authFile, 0600, config.PullSecret)
+	}
+	target.addUnit("ibu-imager-restore.service", fmt.Sprintf(`[Unit]
+Description=Restore the seed image %[1]s
+Wants=network-online.target
+After=network-online.target
+ConditionPathExists=!%[3]s
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStartPre=/usr/bin/podman pull --authfile %[4]s %[2]s
+ExecStartPre=/usr/bin/podman run --rm %[2]s restore --help
+ExecStart=/usr/bin/podman run --rm --privileged --pid=host --net=host --authfile %[4]s -v /:/host -v %[5]s:%[5]s %[2]s restore --seed-image %[1]s --authfile %[4]s
+ExecStartPost=/usr/bin/touch %[3]s
+ExecStartPost=/usr/bin/systemctl --no-block reboot
+
+[Install]
+WantedBy=multi-user.target
+`, config.SeedImage, config.ImagerImage, restoreDoneFile, authFile, configDir))
+	return json.MarshalIndent(target, "", "  ")
+}
+
+// LiveIgnition returns the Ignition config of the live ISO, which installs RHCOS to the install disk
+// with the target Ignition config, then reboots into it
+func LiveIgnition(config *Config) ([]byte, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	targetIgnition, err := TargetIgnition(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to generate target ignition")
+	}
+
+	live := newIgnition(config.SSHKeys)
+	live.addFile(targetIgnitionFile, 0600, targetIgnition)
+	live.addUnit("ibu-imager-install.service", fmt.Sprintf(`[Unit]
+Description=Install RHCOS to %[1]s to restore the seed image
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+ExecStart=/usr/bin/coreos-installer install --ignition-file %[2]s %[1]s
+ExecStartPost=/usr/bin/systemctl --no-block reboot
+
+[Install]
+WantedBy=multi-user.target
+`, config.InstallDisk, targetIgnitionFile))
+	return json.MarshalIndent(live, "", "  ")
+}
+
+// EmbedIgnition writes a copy of the RHCOS live ISO with the live Ignition config embedded, using
+// coreos-installer, so booting the output ISO bootstraps the target into the seed unattended
+func EmbedIgnition(execute ops.Execute, liveISO, outputISO string, config *Config) error {
+	liveIgnition, err := LiveIgnition(config)
+	if err != nil {
+		return err
+	}
+
+	ignitionFile, err := os.CreateTemp("", "bootstrap-*.ign")
+	if err != nil {
+		return errors.Wrap(err, "Failed to create ignition file")
+	}
+	defer os.Remove(ignitionFile.Name())
+	_, err = ignitionFile.Write(liveIgnition)
+	if closeErr := ignitionFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "Failed to write ignition file")
+	}
+
+	if _, err = execute.Execute("coreos-installer", "iso", "ignition", "embed", "--force",
+		"-i", ignitionFile.Name(), "-o", outputISO, liveISO); err != nil {
+		return errors.Wrap(err, "Failed to embed ignition in the live ISO")
+	}
+	return nil
+}
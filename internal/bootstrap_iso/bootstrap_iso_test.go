@@ -0,0 +1,85 @@
+package bootstrap_iso
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestBootstrapISO(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Bootstrap ISO Suite")
+}
+
+// unitDirectives returns the values of the directive in the unit, in order
+func unitDirectives(contents, directive string) []string {
+	var values []string
+	for _, line := range strings.Split(contents, "\n") {
+		if value, found := strings.CutPrefix(line, directive+"="); found {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func decodeFile(f file) string {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(f.Contents.Source, "data:;base64,"))
+	Expect(err).ToNot(HaveOccurred())
+	return string(data)
+}
+
+var _ = Describe("Bootstrap ignition", func() {
+	config := &Config{
+		SeedImage:   "quay.io/org/seed:oneimage",
+		ImagerImage: "quay.io/org/ibu-imager:4.14.0",
+		InstallDisk: "/dev/sda",
+		PullSecret:  []byte(`{"auths": {}}`),
+		SSHKeys:     []string{"ssh-ed25519 AAAA core@example.com"},
+	}
+
+	It("Installs RHCOS with a target config restoring the seed", func() {
+		data, err := LiveIgnition(config)
+		Expect(err).ToNot(HaveOccurred())
+		var live ignition
+		Expect(json.Unmarshal(data, &live)).To(Succeed())
+		Expect(live.Ignition.Version).To(Equal(ignitionVersion))
+		Expect(live.Passwd.Users[0].SSHAuthorizedKeys).To(Equal(config.SSHKeys))
+		Expect(live.Systemd.Units).To(HaveLen(1))
+		Expect(live.Systemd.Units[0].Contents).To(ContainSubstring("coreos-installer install --ignition-file " + targetIgnitionFile + " /dev/sda"))
+
+		Expect(live.Storage.Files).To(HaveLen(1))
+		var target ignition
+		Expect(json.Unmarshal([]byte(decodeFile(live.Storage.Files[0])), &target)).To(Succeed())
+		Expect(target.Storage.Files[0].Path).To(Equal(authFile))
+		Expect(target.Storage.Files[0].Mode).To(Equal(0600))
+		Expect(decodeFile(target.Storage.Files[0])).To(Equal(`{"auths": {}}`))
+		Expect(target.Systemd.Units[0].Name).To(Equal("ibu-imager-restore.service"))
+	})
+
+	It("Restores the seed with the imager image once it's checked to have the restore command", func() {
+		data, err := TargetIgnition(config)
+		Expect(err).ToNot(HaveOccurred())
+		var target ignition
+		Expect(json.Unmarshal(data, &target)).To(Succeed())
+		restore := target.Systemd.Units[0].Contents
+		Expect(unitDirectives(restore, "ExecStartPre")).To(Equal([]string{
+			"/usr/bin/podman pull --authfile /etc/ibu-imager/auth.json quay.io/org/ibu-imager:4.14.0",
+			"/usr/bin/podman run --rm quay.io/org/ibu-imager:4.14.0 restore --help",
+		}))
+		Expect(unitDirectives(restore, "ExecStart")).To(Equal([]string{
+			"/usr/bin/podman run --rm --privileged --pid=host --net=host --authfile /etc/ibu-imager/auth.json " +
+				"-v /:/host -v /etc/ibu-imager:/etc/ibu-imager quay.io/org/ibu-imager:4.14.0 " +
+				"restore --seed-image quay.io/org/seed:oneimage --authfile /etc/ibu-imager/auth.json",
+		}))
+		Expect(unitDirectives(restore, "ConditionPathExists")).To(Equal([]string{"!/etc/ibu-imager/restore.done"}))
+	})
+
+	It("Rejects incomplete configs", func() {
+		_, err := LiveIgnition(&Config{SeedImage: "quay.io/org/seed:oneimage"})
+		Expect(err).To(MatchError(ContainSubstring("imager image, install disk")))
+	})
+})
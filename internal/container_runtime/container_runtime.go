@@ -0,0 +1,167 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container_runtime
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"ibu-imager/internal/ops"
+)
+
+const (
+	// NamePodman is the runtime of the CoreOS hosts the imager runs on, sharing the CRI-O storage
+	NamePodman = "podman"
+	// NameDocker runs the container operations on docker hosts, e.g. developer laptops
+	NameDocker = "docker"
+	// NameFake logs the container operations instead of running them, for lab runs of the flow
+	NameFake = "fake"
+)
+
+// Runtime runs the container operations of the imager, so the flow isn't bound to podman
+type Runtime interface {
+	// Name is the name of the runtime
+	Name() string
+	// Build builds the image out of the Containerfile and the context dir. The args are build flags
+	// common to the runtimes, e.g. --label.
+	Build(containerFile, image, contextDir string, args ...string) error
+	// Push pushes the local image, streaming the push output
+	Push(image, authFile string) (*ops.Stream, error)
+	// SaveOCIArchive writes the local image to an OCI archive tarball, for sites without a registry
+	SaveOCIArchive(image, archive string) error
+	// LoadArchive loads the images of an OCI or docker archive into the local storage, returning their names
+	LoadArchive(archive string) ([]string, error)
+	// Tag tags the local image as destination
+	Tag(image, destination string) error
+	// ImageExists fails when the image isn't in the local storage
+	ImageExists(image string) error
+	// ImageLabels returns the labels of the local image
+	ImageLabels(image string) (map[string]string, error)
+	// Pull pulls the image, streaming the pull output
+	Pull(image, authFile string) (*ops.Stream, error)
+	// PullVerified pulls the image, enforcing the signature requirements of the policy file
+	PullVerified(image, authFile, policyFile string) error
+	// MountImage returns a dir holding the files of the local image, until UnmountImage
+	MountImage(image string) (string, error)
+	// UnmountImage releases the dir MountImage returned
+	UnmountImage(image, dir string) error
+	// Run runs a container. The args are run flags common to the runtimes, followed by the image
+	// and its arguments.
+	Run(authFile string, args ...string) error
+	// ListContainers returns the containers labeled with the key=value label, along with the
+	// values of the labels asked for
+	ListContainers(label string, labels ...string) ([]Container, error)
+	// ListImages returns the images, intermediate ones included, labeled with the key=value label
+	ListImages(label string) ([]Image, error)
+	// RemoveContainers force-removes the containers
+	RemoveContainers(ids ...string) error
+	// RemoveImages force-removes the images
+	RemoveImages(ids ...string) error
+}
+
+// Container is a container listed by ListContainers
+type Container struct {
+	ID   string
+	Name string
+	// Labels are the values of the labels ListContainers was asked for
+	Labels map[string]string
+}
+
+// Image is an image listed by ListImages
+type Image struct {
+	ID string
+	// Name is the repository:tag of the image, <none>:<none> for intermediate images
+	Name string
+}
+
+// NewRuntime returns the named runtime running its commands through the ops
+func NewRuntime(log *logrus.Logger, name string, op ops.Ops) (Runtime, error) {
+	switch name {
+	case NamePodman:
+		return NewPodman(op), nil
+	case NameDocker:
+		return NewDocker(op), nil
+	case NameFake:
+		return NewFake(log), nil
+	}
+	return nil, errors.Errorf("Unsupported container runtime %q, use %s, %s or %s", name, NamePodman, NameDocker, NameFake)
+}
+
+// parseContainers parses the listed containers, one per line as the JSON array of their ID, name and the
+// values of the labels, which may hold any character
+func parseContainers(output string, labels []string) ([]Container, error) {
+	var containers []Container
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var fields []string
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse the listed container %s", line)
+		}
+		if len(fields) < 2 {
+			continue
+		}
+		container := Container{ID: fields[0], Name: fields[1], Labels: map[string]string{}}
+		for i, label := range labels {
+			if i+2 < len(fields) && fields[i+2] != "" {
+				container.Labels[label] = fields[i+2]
+			}
+		}
+		containers = append(containers, container)
+	}
+	return containers, nil
+}
+
+// parseImages parses the listed images, one per line with their ID and name, listing every image once
+func parseImages(output string) []Image {
+	var images []Image
+	seen := map[string]bool{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || seen[fields[0]] {
+			continue
+		}
+		seen[fields[0]] = true
+		images = append(images, Image{ID: fields[0], Name: fields[1]})
+	}
+	return images
+}
+
+// parseLoaded parses the names of the images a load printed, as "Loaded image: name" or, for podman loading
+// several images, "Loaded image(s): name,name". Images loaded without a name are only printed by ID.
+func parseLoaded(output string) []string {
+	var names []string
+	for _, line := range strings.Split(output, "\n") {
+		_, loaded, found := strings.Cut(line, "Loaded image: ")
+		if !found {
+			_, loaded, found = strings.Cut(line, "Loaded image(s): ")
+		}
+		if !found {
+			continue
+		}
+		for _, name := range strings.Split(loaded, ",") {
+			if name = strings.TrimSpace(name); name != "" && !strings.HasPrefix(name, "sha256:") {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
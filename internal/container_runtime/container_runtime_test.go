@@ -0,0 +1,135 @@
+package container_runtime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	"ibu-imager/internal/ops"
+)
+
+func TestContainerRuntime(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Container Runtime Suite")
+}
+
+var _ = Describe("Container runtimes", func() {
+	var (
+		ctrl    *gomock.Controller
+		opsMock *ops.MockOps
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		opsMock = ops.NewMockOps(ctrl)
+	})
+
+	It("Selects the runtime by name", func() {
+		runtime, err := NewRuntime(logrus.New(), NameDocker, opsMock)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(runtime.Name()).To(Equal(NameDocker))
+		_, err = NewRuntime(logrus.New(), "containerd", opsMock)
+		Expect(err).To(MatchError(ContainSubstring("Unsupported container runtime")))
+	})
+
+	It("Lists the podman containers with their labels", func() {
+		opsMock.EXPECT().RunInHostNamespace("podman", "ps", "--all", "--noheading", "--filter", "label=created-by=ibu-imager",
+			"--format", `[{{json .ID}},{{json .Names}},{{json (index .Labels "run-id")}},{{json (index .Labels "step")}}]`).
+			Return(`["c1","recert","1a2b","recert dry-run"]`+"\n"+`["c2","etcd","",""]`+"\n", nil)
+		containers, err := NewPodman(opsMock).ListContainers("created-by=ibu-imager", "run-id", "step")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(containers).To(Equal([]Container{
+			{ID: "c1", Name: "recert", Labels: map[string]string{"run-id": "1a2b", "step": "recert dry-run"}},
+			{ID: "c2", Name: "etcd", Labels: map[string]string{}},
+		}))
+	})
+
+	It("Lists the docker containers with label values holding spaces and commas", func() {
+		opsMock.EXPECT().RunInHostNamespace("docker", "ps", "--all", "--filter", "label=created-by=ibu-imager",
+			"--format", `[{{json .ID}},{{json .Names}},{{json (.Label "note")}}]`).
+			Return(`["c1","recert","a, b c"]`+"\n", nil)
+		containers, err := NewDocker(opsMock).ListContainers("created-by=ibu-imager", "note")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(containers).To(Equal([]Container{{ID: "c1", Name: "recert", Labels: map[string]string{"note": "a, b c"}}}))
+
+		opsMock.EXPECT().RunInHostNamespace("docker", gomock.Any()).Return("c1 recert\n", nil)
+		_, err = NewDocker(opsMock).ListContainers("created-by=ibu-imager")
+		Expect(err).To(MatchError(ContainSubstring("Failed to parse the listed container")))
+	})
+
+	It("Returns the names of the loaded images", func() {
+		opsMock.EXPECT().RunInHostNamespace("podman", "load", "-i", "/var/tmp/seed.tar").
+			Return("Getting image source signatures\nLoaded image(s): quay.io/org/seed:v1,quay.io/org/seed:latest\n", nil)
+		opsMock.EXPECT().RunInHostNamespace("docker", "load", "-i", "/var/tmp/seed.tar").
+			Return("Loaded image: quay.io/org/seed:v1\nLoaded image ID: sha256:abc\n", nil)
+		Expect(NewPodman(opsMock).LoadArchive("/var/tmp/seed.tar")).To(Equal([]string{"quay.io/org/seed:v1", "quay.io/org/seed:latest"}))
+		Expect(NewDocker(opsMock).LoadArchive("/var/tmp/seed.tar")).To(Equal([]string{"quay.io/org/seed:v1"}))
+	})
+
+	It("Passes the authfile dir as the docker config dir", func() {
+		docker := NewDocker(opsMock)
+		opsMock.EXPECT().RunInHostNamespaceStream("docker", "--config", "/var/lib/kubelet", "push", "quay.io/org/seed:v1").
+			Return(ops.NewStream(strings.NewReader(""), strings.NewReader(""), func() error { return nil }), nil)
+		opsMock.EXPECT().RunInHostNamespace("docker", "--config", "/var/lib/kubelet", "run", "--rm", "quay.io/recert").Return("", nil)
+
+		_, err := docker.Push("quay.io/org/seed:v1", "/var/lib/kubelet/config.json")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(docker.Run("/var/lib/kubelet/config.json", "--rm", "quay.io/recert")).To(Succeed())
+		_, err = docker.Push("quay.io/org/seed:v1", "/root/pull-secret.json")
+		Expect(err).To(MatchError(ContainSubstring("can't be used as the authfile")))
+		Expect(docker.PullVerified("quay.io/org/seed:v1", "", "/etc/containers/policy.json")).To(MatchError(ContainSubstring("requires podman")))
+	})
+
+	It("Reads the docker image labels out of the image config", func() {
+		opsMock.EXPECT().RunInHostNamespace("docker", "image", "inspect", "quay.io/org/seed:v1").
+			Return(`[{"Config": {"Labels": {"io.openshift.ibu.artifacts": "etc.tgz"}}}]`, nil)
+		Expect(NewDocker(opsMock).ImageLabels("quay.io/org/seed:v1")).To(HaveKeyWithValue("io.openshift.ibu.artifacts", "etc.tgz"))
+	})
+
+	It("Copies the files of docker images out of a container", func() {
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("mktemp", "-d", gomock.Any()).Return("/var/tmp/ibu-imager-mount-1\n", nil),
+			opsMock.EXPECT().RunInHostNamespace("docker", "create", "quay.io/org/seed:v1", "/").Return("abc\n", nil),
+			opsMock.EXPECT().RunInHostNamespace("docker", "cp", "abc:/", "/var/tmp/ibu-imager-mount-1").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("docker", "rm", "--force", "abc").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("rm", "-rf", "/var/tmp/ibu-imager-mount-1").Return("", nil),
+		)
+		docker := NewDocker(opsMock)
+		dir, err := docker.MountImage("quay.io/org/seed:v1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dir).To(Equal("/var/tmp/ibu-imager-mount-1"))
+		Expect(docker.UnmountImage("quay.io/org/seed:v1", dir)).To(Succeed())
+	})
+
+	It("Removes the containers the tracker still runs", func() {
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("podman", "run", "--authfile", "/auth.json", "--name", "recert_etcd-1",
+				"--detach", "--rm", "quay.io/openshift/etcd", "--name", "editor").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("podman", "run", "--authfile", "/auth.json", "--name", "recert-1",
+				"--rm", "quay.io/edge-infrastructure/recert").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("podman", "rm", "--force", "recert_etcd-1").Return("", nil),
+		)
+		tracker := NewTracker(NewPodman(opsMock))
+		Expect(tracker.Run("/auth.json", "--name", "recert_etcd-1", "--detach", "--rm", "quay.io/openshift/etcd", "--name", "editor")).To(Succeed())
+		Expect(tracker.Run("/auth.json", "--name", "recert-1", "--rm", "quay.io/edge-infrastructure/recert")).To(Succeed())
+		Expect(tracker.Tracked()).To(Equal([]string{"recert_etcd-1"}))
+		Expect(tracker.Release()).To(Succeed())
+		Expect(tracker.Tracked()).To(BeEmpty())
+		Expect(tracker.Release()).To(Succeed())
+	})
+
+	It("Remembers the images the fake runtime built", func() {
+		fake := NewFake(logrus.New())
+		Expect(fake.Build("Containerfile", "quay.io/org/seed:v1", "/var/tmp/backup", "--label", "run-id=1a2b")).To(Succeed())
+		Expect(fake.Tag("quay.io/org/seed:v1", "mirror.lab/seed:v1")).To(Succeed())
+		Expect(fake.ImageLabels("mirror.lab/seed:v1")).To(Equal(map[string]string{"run-id": "1a2b"}))
+		Expect(fake.ImageExists("quay.io/org/other:v1")).To(HaveOccurred())
+		stream, err := fake.Push("mirror.lab/seed:v1", "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ops.LogStream(logrus.New(), stream)).To(Succeed())
+	})
+})
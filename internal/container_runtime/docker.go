@@ -0,0 +1,175 @@
+package container_runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/ops"
+)
+
+// dockerConfigFile is the name of the credentials file docker reads out of its config dir
+const dockerConfigFile = "config.json"
+
+// Docker runs the container operations with docker, for lab runs on hosts without podman. Docker has
+// no authfile flag, the authfile dir is passed as its config dir instead.
+type Docker struct {
+	ops ops.Ops
+}
+
+// NewDocker returns the docker runtime
+func NewDocker(op ops.Ops) *Docker {
+	return &Docker{ops: op}
+}
+
+func (d *Docker) Name() string {
+	return NameDocker
+}
+
+// configArgs returns the docker flags reading the credentials of the authfile
+func configArgs(authFile string) ([]string, error) {
+	if authFile == "" {
+		return nil, nil
+	}
+	if filepath.Base(authFile) != dockerConfigFile {
+		return nil, errors.Errorf("docker reads the credentials of its config dir %s file, %s can't be used as the authfile",
+			dockerConfigFile, authFile)
+	}
+	return []string{"--config", filepath.Dir(authFile)}, nil
+}
+
+func (d *Docker) Build(containerFile, image, contextDir string, args ...string) error {
+	buildArgs := append(append([]string{"build", "-f", containerFile, "-t", image}, args...), contextDir)
+	_, err := d.ops.RunInHostNamespace("docker", buildArgs...)
+	return err
+}
+
+func (d *Docker) Push(image, authFile string) (*ops.Stream, error) {
+	args, err := configArgs(authFile)
+	if err != nil {
+		return nil, err
+	}
+	return d.ops.RunInHostNamespaceStream("docker", append(args, "push", image)...)
+}
+
+// SaveOCIArchive relies on docker save writing OCI layout archives, as it does since docker 25
+func (d *Docker) SaveOCIArchive(image, archive string) error {
+	_, err := d.ops.RunInHostNamespace("docker", "save", "-o", archive, image)
+	return err
+}
+
+func (d *Docker) LoadArchive(archive string) ([]string, error) {
+	output, err := d.ops.RunInHostNamespace("docker", "load", "-i", archive)
+	if err != nil {
+		return nil, err
+	}
+	return parseLoaded(output), nil
+}
+
+func (d *Docker) Tag(image, destination string) error {
+	_, err := d.ops.RunInHostNamespace("docker", "tag", image, destination)
+	return err
+}
+
+func (d *Docker) ImageExists(image string) error {
+	_, err := d.ops.RunInHostNamespace("docker", "image", "inspect", "--format", "{{.Id}}", image)
+	return err
+}
+
+func (d *Docker) ImageLabels(image string) (map[string]string, error) {
+	output, err := d.ops.RunInHostNamespace("docker", "image", "inspect", image)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to inspect %s", image)
+	}
+	var inspect []struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"Config"`
+	}
+	if err = json.Unmarshal([]byte(output), &inspect); err != nil || len(inspect) == 0 {
+		return nil, errors.Errorf("Failed to parse the docker inspect output of %s", image)
+	}
+	return inspect[0].Config.Labels, nil
+}
+
+func (d *Docker) Pull(image, authFile string) (*ops.Stream, error) {
+	args, err := configArgs(authFile)
+	if err != nil {
+		return nil, err
+	}
+	return d.ops.RunInHostNamespaceStream("docker", append(args, "pull", image)...)
+}
+
+func (d *Docker) PullVerified(image, authFile, policyFile string) error {
+	return errors.Errorf("docker can't enforce the signature policy %s, verifying %s requires podman", policyFile, image)
+}
+
+// MountImage copies the files of the image out of a container created from it, docker can't mount images
+func (d *Docker) MountImage(image string) (string, error) {
+	dir, err := d.ops.RunInHostNamespace("mktemp", "-d", "/var/tmp/ibu-imager-mount-XXXXXX")
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to create the image mount dir")
+	}
+	dir = strings.TrimSpace(dir)
+	// The command is never run, seed images are built from scratch and have none
+	id, err := d.ops.RunInHostNamespace("docker", "create", image, "/")
+	if err != nil {
+		return "", err
+	}
+	id = strings.TrimSpace(id)
+	defer func() {
+		_, _ = d.ops.RunInHostNamespace("docker", "rm", "--force", id)
+	}()
+	if _, err = d.ops.RunInHostNamespace("docker", "cp", id+":/", dir); err != nil {
+		return "", errors.Wrapf(err, "Failed to copy the files of %s", image)
+	}
+	return dir, nil
+}
+
+func (d *Docker) UnmountImage(image, dir string) error {
+	_, err := d.ops.RunInHostNamespace("rm", "-rf", dir)
+	return err
+}
+
+func (d *Docker) Run(authFile string, args ...string) error {
+	configArgs, err := configArgs(authFile)
+	if err != nil {
+		return err
+	}
+	_, err = d.ops.RunInHostNamespace("docker", append(append(configArgs, "run"), args...)...)
+	return err
+}
+
+func (d *Docker) ListContainers(label string, labels ...string) ([]Container, error) {
+	format := "[{{json .ID}},{{json .Names}}"
+	for _, key := range labels {
+		format += fmt.Sprintf(`,{{json (.Label %q)}}`, key)
+	}
+	output, err := d.ops.RunInHostNamespace("docker", "ps", "--all", "--filter", "label="+label, "--format", format+"]")
+	if err != nil {
+		return nil, err
+	}
+	return parseContainers(output, labels)
+}
+
+func (d *Docker) ListImages(label string) ([]Image, error) {
+	output, err := d.ops.RunInHostNamespace("docker", "images", "--all", "--filter", "label="+label,
+		"--format", "{{.ID}} {{.Repository}}:{{.Tag}}")
+	if err != nil {
+		return nil, err
+	}
+	return parseImages(output), nil
+}
+
+func (d *Docker) RemoveContainers(ids ...string) error {
+	_, err := d.ops.RunInHostNamespace("docker", append([]string{"rm", "--force"}, ids...)...)
+	return err
+}
+
+func (d *Docker) RemoveImages(ids ...string) error {
+	_, err := d.ops.RunInHostNamespace("docker", append([]string{"rmi", "--force"}, ids...)...)
+	return err
+}
@@ -0,0 +1,151 @@
+package container_runtime
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"ibu-imager/internal/ops"
+)
+
+// Fake logs the container operations instead of running them, so the flow can be run on hosts without a
+// container runtime, e.g. to exercise the recert dry-run steps in a lab. The images it builds are only
+// remembered, with their --label labels.
+type Fake struct {
+	log *logrus.Logger
+	mu  sync.Mutex
+	// images maps the images built or tagged to their labels
+	images map[string]map[string]string
+}
+
+// NewFake returns the fake runtime
+func NewFake(log *logrus.Logger) *Fake {
+	return &Fake{log: log, images: map[string]map[string]string{}}
+}
+
+func (f *Fake) Name() string {
+	return NameFake
+}
+
+// emptyStream returns the stream of a command that succeeded without output
+func emptyStream() *ops.Stream {
+	return ops.NewStream(strings.NewReader(""), strings.NewReader(""), func() error { return nil })
+}
+
+func (f *Fake) Build(containerFile, image, contextDir string, args ...string) error {
+	f.log.Infof("Fake runtime: building %s out of %s", image, contextDir)
+	labels := map[string]string{}
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "--label" {
+			key, value, _ := strings.Cut(args[i+1], "=")
+			labels[key] = value
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.images[image] = labels
+	return nil
+}
+
+func (f *Fake) Push(image, authFile string) (*ops.Stream, error) {
+	if err := f.ImageExists(image); err != nil {
+		return nil, err
+	}
+	f.log.Infof("Fake runtime: pushing %s", image)
+	return emptyStream(), nil
+}
+
+func (f *Fake) SaveOCIArchive(image, archive string) error {
+	if err := f.ImageExists(image); err != nil {
+		return err
+	}
+	f.log.Infof("Fake runtime: saving %s to %s", image, archive)
+	return nil
+}
+
+// LoadArchive loads nothing, the fake runtime doesn't read archives
+func (f *Fake) LoadArchive(archive string) ([]string, error) {
+	f.log.Infof("Fake runtime: loading %s", archive)
+	return nil, nil
+}
+
+func (f *Fake) Tag(image, destination string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	labels, ok := f.images[image]
+	if !ok {
+		return errors.Errorf("Fake runtime: no image %s", image)
+	}
+	f.log.Infof("Fake runtime: tagging %s as %s", image, destination)
+	f.images[destination] = labels
+	return nil
+}
+
+func (f *Fake) ImageExists(image string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.images[image]; !ok {
+		return errors.Errorf("Fake runtime: no image %s", image)
+	}
+	return nil
+}
+
+func (f *Fake) ImageLabels(image string) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	labels, ok := f.images[image]
+	if !ok {
+		return nil, errors.Errorf("Fake runtime: no image %s", image)
+	}
+	return labels, nil
+}
+
+func (f *Fake) Pull(image, authFile string) (*ops.Stream, error) {
+	f.log.Infof("Fake runtime: pulling %s", image)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.images[image]; !ok {
+		f.images[image] = map[string]string{}
+	}
+	return emptyStream(), nil
+}
+
+func (f *Fake) PullVerified(image, authFile, policyFile string) error {
+	stream, err := f.Pull(image, authFile)
+	if err != nil {
+		return err
+	}
+	return stream.Wait()
+}
+
+func (f *Fake) MountImage(image string) (string, error) {
+	return "", errors.Errorf("Fake runtime: %s has no files to mount", image)
+}
+
+func (f *Fake) UnmountImage(image, dir string) error {
+	return nil
+}
+
+func (f *Fake) Run(authFile string, args ...string) error {
+	f.log.Infof("Fake runtime: running %s", strings.Join(args, " "))
+	return nil
+}
+
+func (f *Fake) ListContainers(label string, labels ...string) ([]Container, error) {
+	return nil, nil
+}
+
+func (f *Fake) ListImages(label string) ([]Image, error) {
+	return nil, nil
+}
+
+func (f *Fake) RemoveContainers(ids ...string) error {
+	f.log.Infof("Fake runtime: removing %s", strings.Join(ids, " "))
+	return nil
+}
+
+func (f *Fake) RemoveImages(ids ...string) error {
+	return nil
+}
@@ -0,0 +1,127 @@
+package container_runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/ops"
+)
+
+// Podman runs the container operations with podman in the host namespaces
+type Podman struct {
+	ops ops.Ops
+}
+
+// NewPodman returns the podman runtime
+func NewPodman(op ops.Ops) *Podman {
+	return &Podman{ops: op}
+}
+
+func (p *Podman) Name() string {
+	return NamePodman
+}
+
+func (p *Podman) Build(containerFile, image, contextDir string, args ...string) error {
+	buildArgs := append(append([]string{"build", "-f", containerFile, "-t", image}, args...), contextDir)
+	_, err := p.ops.RunInHostNamespace("podman", buildArgs...)
+	return err
+}
+
+func (p *Podman) Push(image, authFile string) (*ops.Stream, error) {
+	return p.ops.RunInHostNamespaceStream("podman", "push", "--authfile", authFile, image)
+}
+
+func (p *Podman) SaveOCIArchive(image, archive string) error {
+	_, err := p.ops.RunInHostNamespace("podman", "save", "--format", "oci-archive", "-o", archive, image)
+	return err
+}
+
+func (p *Podman) LoadArchive(archive string) ([]string, error) {
+	output, err := p.ops.RunInHostNamespace("podman", "load", "-i", archive)
+	if err != nil {
+		return nil, err
+	}
+	return parseLoaded(output), nil
+}
+
+func (p *Podman) Tag(image, destination string) error {
+	_, err := p.ops.RunInHostNamespace("podman", "tag", image, destination)
+	return err
+}
+
+func (p *Podman) ImageExists(image string) error {
+	_, err := p.ops.RunInHostNamespace("podman", "image", "exists", image)
+	return err
+}
+
+func (p *Podman) ImageLabels(image string) (map[string]string, error) {
+	output, err := p.ops.RunInHostNamespace("podman", "image", "inspect", "--format", "json", image)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to inspect %s", image)
+	}
+	var inspect []struct {
+		Labels map[string]string `json:"Labels"`
+	}
+	if err = json.Unmarshal([]byte(output), &inspect); err != nil || len(inspect) == 0 {
+		return nil, errors.Errorf("Failed to parse the podman inspect output of %s", image)
+	}
+	return inspect[0].Labels, nil
+}
+
+func (p *Podman) Pull(image, authFile string) (*ops.Stream, error) {
+	return p.ops.RunInHostNamespaceStream("podman", "pull", "--authfile", authFile, image)
+}
+
+func (p *Podman) PullVerified(image, authFile, policyFile string) error {
+	_, err := p.ops.RunInHostNamespace("podman", "pull", "--signature-policy", policyFile, "--authfile", authFile, image)
+	return err
+}
+
+func (p *Podman) MountImage(image string) (string, error) {
+	dir, err := p.ops.RunInHostNamespace("podman", "image", "mount", image)
+	return strings.TrimSpace(dir), err
+}
+
+func (p *Podman) UnmountImage(image, dir string) error {
+	_, err := p.ops.RunInHostNamespace("podman", "image", "unmount", image)
+	return err
+}
+
+func (p *Podman) Run(authFile string, args ...string) error {
+	_, err := p.ops.RunInHostNamespace("podman", append([]string{"run", "--authfile", authFile}, args...)...)
+	return err
+}
+
+func (p *Podman) ListContainers(label string, labels ...string) ([]Container, error) {
+	format := "[{{json .ID}},{{json .Names}}"
+	for _, key := range labels {
+		format += fmt.Sprintf(`,{{json (index .Labels %q)}}`, key)
+	}
+	output, err := p.ops.RunInHostNamespace("podman", "ps", "--all", "--noheading", "--filter", "label="+label, "--format", format+"]")
+	if err != nil {
+		return nil, err
+	}
+	return parseContainers(output, labels)
+}
+
+func (p *Podman) ListImages(label string) ([]Image, error) {
+	output, err := p.ops.RunInHostNamespace("podman", "images", "--all", "--noheading", "--filter", "label="+label,
+		"--format", "{{.ID}} {{.Repository}}:{{.Tag}}")
+	if err != nil {
+		return nil, err
+	}
+	return parseImages(output), nil
+}
+
+func (p *Podman) RemoveContainers(ids ...string) error {
+	_, err := p.ops.RunInHostNamespace("podman", append([]string{"rm", "--force"}, ids...)...)
+	return err
+}
+
+func (p *Podman) RemoveImages(ids ...string) error {
+	_, err := p.ops.RunInHostNamespace("podman", append([]string{"rmi", "--force"}, ids...)...)
+	return err
+}
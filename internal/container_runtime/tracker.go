@@ -0,0 +1,97 @@
+package container_runtime
+
+import (
+	"strings"
+	"sync"
+)
+
+// Tracker is a runtime tracking the containers run through it by name, from their start until they exit or
+// are released. Detached containers, and the foreground ones of a cancelled run, outlive the Run call, the
+// tracker force-removes them on Release so their bind mounts are released before the caller cleans up.
+type Tracker struct {
+	Runtime
+	// mu is held while the containers are removed, so a Release racing a cancellation returns once they're gone
+	mu sync.Mutex
+	// containers are the names of the tracked containers, in the order they were run
+	containers []string
+}
+
+// NewTracker returns a tracker running the containers with the runtime
+func NewTracker(runtime Runtime) *Tracker {
+	return &Tracker{Runtime: runtime}
+}
+
+// Run runs the container, tracking it by its --name. Foreground containers are untracked once they
+// exited successfully, the --rm ones are gone by then.
+func (t *Tracker) Run(authFile string, args ...string) error {
+	name := containerName(args)
+	if name != "" {
+		t.track(name)
+	}
+	err := t.Runtime.Run(authFile, args...)
+	if name != "" && err == nil && !detached(args) {
+		t.untrack(name)
+	}
+	return err
+}
+
+// Tracked returns the names of the tracked containers
+func (t *Tracker) Tracked() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.containers...)
+}
+
+// Release force-removes the tracked containers, killing the running ones. They're untracked even
+// when the removal fails, the gc command removes the leftovers by their labels.
+func (t *Tracker) Release() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.containers) == 0 {
+		return nil
+	}
+	names := t.containers
+	t.containers = nil
+	return t.Runtime.RemoveContainers(names...)
+}
+
+func (t *Tracker) track(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.containers = append(t.containers, name)
+}
+
+func (t *Tracker) untrack(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, tracked := range t.containers {
+		if tracked == name {
+			t.containers = append(t.containers[:i], t.containers[i+1:]...)
+			return
+		}
+	}
+}
+
+// containerName returns the --name of the run flags, the first one since the arguments of the image
+// may have a --name of their own
+func containerName(args []string) string {
+	for i, arg := range args {
+		if arg == "--name" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if name, found := strings.CutPrefix(arg, "--name="); found {
+			return name
+		}
+	}
+	return ""
+}
+
+// detached returns true if the run flags detach the container
+func detached(args []string) bool {
+	for _, arg := range args {
+		if arg == "--detach" || arg == "-d" {
+			return true
+		}
+	}
+	return false
+}
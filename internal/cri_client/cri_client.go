@@ -0,0 +1,121 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cri_client
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+
+	"ibu-imager/internal/ops"
+)
+
+const (
+	// maxParallelStops is the maximum number of containers being stopped concurrently
+	maxParallelStops = 10
+)
+
+// Client is a handle for interacting with the CRI-O runtime through crictl
+type Client struct {
+	log *logrus.Logger
+	ops ops.Ops
+}
+
+// NewClient creates a new crictl client
+func NewClient(log *logrus.Logger, ops ops.Ops) *Client {
+	return &Client{
+		log: log,
+		ops: ops,
+	}
+}
+
+// ListRunningContainers returns the IDs of the running containers
+func (c *Client) ListRunningContainers() ([]string, error) {
+	output, err := c.ops.RunInHostNamespace("crictl", "ps", "-q")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list running containers")
+	}
+	return strings.Fields(output), nil
+}
+
+// StopContainer stops a single container, waiting up to timeout seconds
+func (c *Client) StopContainer(id string, timeout int) error {
+	_, err := c.ops.RunInHostNamespace("crictl", "stop", "--timeout", strconv.Itoa(timeout), id)
+	return err
+}
+
+// StopAllContainers stops every running container. Containers that fail to stop are retried
+// up to retries times, and an error is only returned when some containers are still running
+// after the last attempt.
+func (c *Client) StopAllContainers(timeout, retries int) error {
+	ids, err := c.ListRunningContainers()
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; attempt <= retries && len(ids) > 0; attempt++ {
+		if attempt > 0 {
+			c.log.Infof("Retrying stop of %d containers (attempt %d/%d)", len(ids), attempt, retries)
+		}
+
+		failed := c.stopContainers(ids, timeout)
+		for id, stopErr := range failed {
+			c.log.Debugf("Failed to stop container %s: %v", id, stopErr)
+		}
+
+		// A failed stop may still leave the container exited (e.g. it exited on its own
+		// meanwhile), so the runtime is the source of truth for what's left to stop
+		ids, err = c.ListRunningContainers()
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(ids) > 0 {
+		return errors.Errorf("Failed to stop %d containers: %s", len(ids), strings.Join(ids, ", "))
+	}
+	return nil
+}
+
+// stopContainers stops the given containers concurrently and returns the per-container failures
+func (c *Client) stopContainers(ids []string, timeout int) map[string]error {
+	var (
+		mu     sync.Mutex
+		failed = map[string]error{}
+		group  errgroup.Group
+	)
+	group.SetLimit(maxParallelStops)
+
+	for _, id := range ids {
+		id := id
+		group.Go(func() error {
+			if err := c.StopContainer(id, timeout); err != nil {
+				mu.Lock()
+				failed[id] = err
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	_ = group.Wait()
+
+	return failed
+}
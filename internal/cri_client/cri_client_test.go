@@ -0,0 +1,110 @@
+package cri_client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	"ibu-imager/internal/ops"
+)
+
+func TestCriClient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "CriClient Suite")
+}
+
+var _ = Describe("Stop containers", func() {
+	var (
+		l       = logrus.New()
+		ctrl    *gomock.Controller
+		opsMock *ops.MockOps
+		client  *Client
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		opsMock = ops.NewMockOps(ctrl)
+		client = NewClient(l, opsMock)
+	})
+
+	It("Retries stragglers and succeeds once they're stopped", func() {
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("crictl", "ps", "-q").Return("a\nb", nil),
+			opsMock.EXPECT().RunInHostNamespace("crictl", "ps", "-q").Return("b", nil),
+			opsMock.EXPECT().RunInHostNamespace("crictl", "ps", "-q").Return("", nil),
+		)
+		opsMock.EXPECT().RunInHostNamespace("crictl", "stop", "--timeout", "5", "a").Return("", nil)
+		opsMock.EXPECT().RunInHostNamespace("crictl", "stop", "--timeout", "5", "b").Return("", fmt.Errorf("Dummy"))
+		opsMock.EXPECT().RunInHostNamespace("crictl", "stop", "--timeout", "5", "b").Return("", nil)
+		Expect(client.StopAllContainers(5, 2)).To(Succeed())
+	})
+
+	It("Ignores stop failures of containers that exited anyway", func() {
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("crictl", "ps", "-q").Return("a", nil),
+			opsMock.EXPECT().RunInHostNamespace("crictl", "ps", "-q").Return("", nil),
+		)
+		opsMock.EXPECT().RunInHostNamespace("crictl", "stop", "--timeout", "5", "a").Return("", fmt.Errorf("Dummy"))
+		Expect(client.StopAllContainers(5, 0)).To(Succeed())
+	})
+
+	It("Fails when containers can't be stopped", func() {
+		opsMock.EXPECT().RunInHostNamespace("crictl", "ps", "-q").Times(3).Return("a", nil)
+		opsMock.EXPECT().RunInHostNamespace("crictl", "stop", "--timeout", "5", "a").Times(2).Return("", fmt.Errorf("Dummy"))
+		Expect(client.StopAllContainers(5, 1)).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Image filter", func() {
+	images := []Image{
+		{ID: "1", RepoTags: []string{"quay.io/openshift/etcd:4.14"}},
+		{ID: "2", RepoTags: []string{"docker.io/library/nginx:latest"}},
+		{ID: "3", RepoTags: []string{"quay.io/openshift/prepulled:4.14"}},
+	}
+	containers := []Container{
+		{ImageRef: "1", Labels: map[string]string{namespaceLabel: "openshift-etcd"}},
+		{Image: ContainerImage{Image: "docker.io/library/nginx:latest"}, Labels: map[string]string{namespaceLabel: "my-app"}},
+	}
+
+	It("Drops images used only by excluded namespaces", func() {
+		filter := ImageFilter{IncludeNamespaces: []string{"openshift-*"}}
+		Expect(ImageReferences(filter.Filter(images, containers))).To(Equal(
+			[]string{"quay.io/openshift/etcd:4.14", "quay.io/openshift/prepulled:4.14"}))
+	})
+
+	It("Drops images from excluded registries", func() {
+		filter := ImageFilter{ExcludeRegistries: []string{"docker.io"}}
+		Expect(filter.Filter(images, containers)).To(HaveLen(2))
+	})
+
+	It("Keeps references allowed by the registry filters", func() {
+		filter := ImageFilter{IncludeRegistries: []string{"quay.io"}, ExcludeRegistries: []string{"quay.io/bad"}}
+		Expect(filter.AllowsReference("quay.io/openshift/etcd:4.14")).To(BeTrue())
+		Expect(filter.AllowsReference("quay.io/bad/image:latest")).To(BeFalse())
+		Expect(filter.AllowsReference("docker.io/library/nginx:latest")).To(BeFalse())
+	})
+
+	It("Keeps images with at least one reference from an included registry", func() {
+		filter := ImageFilter{IncludeRegistries: []string{"mirror.local:5000"}}
+		mirrored := []Image{
+			{ID: "1", RepoTags: []string{"mirror.local:5000/openshift/etcd:4.14"},
+				RepoDigests: []string{"quay.io/openshift/etcd@sha256:1"}},
+			{ID: "2", RepoTags: []string{"quay.io/openshift/prepulled:4.14"}},
+		}
+		Expect(filter.Filter(mirrored, nil)).To(Equal(mirrored[:1]))
+
+		filter.ExcludeRegistries = []string{"quay.io/openshift"}
+		Expect(filter.Filter(mirrored, nil)).To(BeEmpty())
+	})
+
+	It("Saves sorted references without duplicates", func() {
+		Expect(ImageReferences([]Image{
+			{ID: "1", RepoTags: []string{"quay.io/b:1"}, RepoDigests: []string{"quay.io/b@sha256:1"}},
+			{ID: "2", RepoTags: []string{"quay.io/a:1", "quay.io/b:1"}},
+		})).To(Equal([]string{"quay.io/a:1", "quay.io/b:1", "quay.io/b@sha256:1"}))
+	})
+})
@@ -0,0 +1,205 @@
+package cri_client
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// namespaceLabel is the label CRI-O sets on containers with their pod namespace
+	namespaceLabel = "io.kubernetes.pod.namespace"
+)
+
+// Image is an image of the CRI-O storage, as listed by crictl images
+type Image struct {
+	ID          string   `json:"id"`
+	RepoTags    []string `json:"repoTags"`
+	RepoDigests []string `json:"repoDigests"`
+	Size        string   `json:"size"`
+}
+
+// ContainerImage is the image spec of a container
+type ContainerImage struct {
+	Image string `json:"image"`
+}
+
+// Container is a container of the CRI-O runtime, as listed by crictl ps
+type Container struct {
+	ID       string            `json:"id"`
+	Image    ContainerImage    `json:"image"`
+	ImageRef string            `json:"imageRef"`
+	State    string            `json:"state"`
+	Labels   map[string]string `json:"labels"`
+}
+
+// Namespace returns the pod namespace of the container
+func (c *Container) Namespace() string {
+	return c.Labels[namespaceLabel]
+}
+
+// ListImages returns all the images in the CRI-O storage
+func (c *Client) ListImages() ([]Image, error) {
+	output, err := c.ops.RunInHostNamespace("crictl", "images", "-o", "json")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list images")
+	}
+	var list struct {
+		Images []Image `json:"images"`
+	}
+	if err = json.Unmarshal([]byte(output), &list); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse `crictl images -o json` output")
+	}
+	return list.Images, nil
+}
+
+// ListContainers returns all the containers, running or not
+func (c *Client) ListContainers() ([]Container, error) {
+	output, err := c.ops.RunInHostNamespace("crictl", "ps", "-a", "-o", "json")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list containers")
+	}
+	var list struct {
+		Containers []Container `json:"containers"`
+	}
+	if err = json.Unmarshal([]byte(output), &list); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse `crictl ps -a -o json` output")
+	}
+	return list.Containers, nil
+}
+
+// ImageFilter selects which images are kept in containers.list. Namespaces and registries
+// support shell patterns, e.g. openshift-* or quay.io/*.
+type ImageFilter struct {
+	// IncludeNamespaces, when set, only keeps the images used by containers in these namespaces
+	IncludeNamespaces []string `yaml:"includeNamespaces,omitempty"`
+	// ExcludeNamespaces drops the images used only by containers in these namespaces
+	ExcludeNamespaces []string `yaml:"excludeNamespaces,omitempty"`
+	// IncludeRegistries, when set, only keeps the images with at least one reference from these registries
+	IncludeRegistries []string `yaml:"includeRegistries,omitempty"`
+	// ExcludeRegistries drops the images with any reference from these registries
+	ExcludeRegistries []string `yaml:"excludeRegistries,omitempty"`
+}
+
+// IsEmpty returns true if the filter keeps every image
+func (f *ImageFilter) IsEmpty() bool {
+	return len(f.IncludeNamespaces) == 0 && len(f.ExcludeNamespaces) == 0 &&
+		len(f.IncludeRegistries) == 0 && len(f.ExcludeRegistries) == 0
+}
+
+// Filter returns the images kept by the filter. Images not used by any container (e.g. pre-pulled
+// release images) are never dropped because of namespaces, only because of their registry.
+func (f *ImageFilter) Filter(images []Image, containers []Container) []Image {
+	namespaces := imageNamespaces(images, containers)
+
+	var kept []Image
+	for _, image := range images {
+		if !f.registryAllowed(image) {
+			continue
+		}
+		if imageNamespaces, used := namespaces[image.ID]; used && !f.anyNamespaceAllowed(imageNamespaces) {
+			continue
+		}
+		kept = append(kept, image)
+	}
+	return kept
+}
+
+func (f *ImageFilter) anyNamespaceAllowed(namespaces []string) bool {
+	for _, namespace := range namespaces {
+		if (len(f.IncludeNamespaces) == 0 || matchesAny(namespace, f.IncludeNamespaces)) &&
+			!matchesAny(namespace, f.ExcludeNamespaces) {
+			return true
+		}
+	}
+	return false
+}
+
+// registryAllowed returns true if none of the image references is from an excluded registry, and at least
+// one is from an included registry, e.g. a release image tagged in a mirror is kept when the mirror is included
+func (f *ImageFilter) registryAllowed(image Image) bool {
+	included := len(f.IncludeRegistries) == 0
+	for _, ref := range append(append([]string{}, image.RepoDigests...), image.RepoTags...) {
+		if matchesAny(ref, f.ExcludeRegistries) {
+			return false
+		}
+		if matchesAny(ref, f.IncludeRegistries) {
+			included = true
+		}
+	}
+	return included
+}
+
+// AllowsReference returns true if the registry filters keep the given image reference
+func (f *ImageFilter) AllowsReference(ref string) bool {
+	if matchesAny(ref, f.ExcludeRegistries) {
+		return false
+	}
+	return len(f.IncludeRegistries) == 0 || matchesAny(ref, f.IncludeRegistries)
+}
+
+// imageNamespaces maps every image ID to the namespaces of the containers using it
+func imageNamespaces(images []Image, containers []Container) map[string][]string {
+	idByRef := map[string]string{}
+	for _, image := range images {
+		idByRef[image.ID] = image.ID
+		for _, ref := range append(append([]string{}, image.RepoDigests...), image.RepoTags...) {
+			idByRef[ref] = image.ID
+		}
+	}
+
+	namespaces := map[string][]string{}
+	for _, container := range containers {
+		id, ok := idByRef[container.ImageRef]
+		if !ok {
+			id, ok = idByRef[container.Image.Image]
+		}
+		if ok {
+			namespaces[id] = append(namespaces[id], container.Namespace())
+		}
+	}
+	return namespaces
+}
+
+// matchesAny returns true if the value, or its registry/repository prefix, matches one of the patterns
+func matchesAny(value string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+		if strings.HasPrefix(value, strings.TrimSuffix(pattern, "*")) && strings.HasSuffix(pattern, "*") {
+			return true
+		}
+		if strings.HasPrefix(value, strings.TrimSuffix(pattern, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ImageReferences returns the sorted, unique digests and tags of the images, as saved in containers.list
+func ImageReferences(images []Image) []string {
+	var refs []string
+	for _, image := range images {
+		refs = append(refs, image.RepoDigests...)
+		refs = append(refs, image.RepoTags...)
+	}
+	return SortedUnique(refs)
+}
+
+// SortedUnique returns the non-empty references sorted, without duplicates
+func SortedUnique(refs []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, ref := range refs {
+		if ref != "" && !seen[ref] {
+			seen[ref] = true
+			unique = append(unique, ref)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
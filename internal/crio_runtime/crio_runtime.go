@@ -0,0 +1,302 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crio_runtime
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/ops"
+)
+
+const (
+	// configFile is the main CRI-O config, relative to the root
+	configFile = "etc/crio/crio.conf"
+	// dropInDir holds the CRI-O config drop-ins, e.g. the ones rendered by the MCO, relative to the root
+	dropInDir = "etc/crio/crio.conf.d"
+)
+
+// hookDirs are the OCI hooks directories CRI-O reads, relative to the root
+var hookDirs = []string{"etc/containers/oci/hooks.d", "usr/share/containers/oci/hooks.d"}
+
+// builtinHandlers are the runtime handlers CRI-O configures without drop-in
+var builtinHandlers = map[string]bool{"runc": true, "crun": true}
+
+// handlerSection matches the runtime handler tables of the CRI-O config, e.g. [crio.runtime.runtimes.high-performance]
+var handlerSection = regexp.MustCompile(`(?m)^\s*\[\s*crio\.runtime\.runtimes\.("?)([^\]"]+)("?)\s*\]`)
+
+// ConfigFile is a CRI-O config file, by content digest
+type ConfigFile struct {
+	Path   string `json:"path"`
+	Digest string `json:"digest"`
+	// RuntimeHandlers are the runtime handlers the file configures
+	RuntimeHandlers []string `json:"runtimeHandlers,omitempty"`
+}
+
+// Hook is an OCI hook definition
+type Hook struct {
+	Path   string `json:"path"`
+	Digest string `json:"digest"`
+	// Executable is the binary the hook runs
+	Executable string   `json:"executable"`
+	Stages     []string `json:"stages,omitempty"`
+}
+
+// RuntimeClass is a RuntimeClass of the cluster and the CRI-O runtime handler it selects
+type RuntimeClass struct {
+	Name    string `json:"name"`
+	Handler string `json:"handler"`
+}
+
+// State is the CRI-O runtime configuration of a host
+type State struct {
+	// Version is the CRI-O version, e.g. 1.27.1
+	Version string       `json:"version"`
+	Configs []ConfigFile `json:"configs"`
+	Hooks   []Hook       `json:"hooks"`
+	// RuntimeClasses are only captured on nodes with cluster API access
+	RuntimeClasses []RuntimeClass `json:"runtimeClasses,omitempty"`
+}
+
+// Capture reads the CRI-O version, config drop-ins and OCI hooks of the host whose filesystem is mounted at root
+func Capture(ops ops.Ops, root string) (*State, error) {
+	output, err := ops.RunInHostNamespace("crio", "--version")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get the CRI-O version")
+	}
+	state := &State{Version: ParseVersion(output)}
+
+	configs := []string{filepath.Join(root, configFile)}
+	// CRI-O reads every file of the drop-in directory, e.g. the MCO 00-default has no extension
+	entries, err := os.ReadDir(filepath.Join(root, dropInDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "Failed to list CRI-O drop-ins")
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			configs = append(configs, filepath.Join(root, dropInDir, entry.Name()))
+		}
+	}
+	for _, file := range configs {
+		data, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read CRI-O config %s", file)
+		}
+		state.Configs = append(state.Configs, ConfigFile{
+			Path:            "/" + strings.TrimPrefix(file, filepath.Join(root)+"/"),
+			Digest:          digest(data),
+			RuntimeHandlers: ParseRuntimeHandlers(string(data)),
+		})
+	}
+
+	for _, dir := range hookDirs {
+		files, err := filepath.Glob(filepath.Join(root, dir, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Failed to read OCI hook %s", file)
+			}
+			hook, err := ParseHook(data)
+			if err != nil {
+				return nil, errors.Wrapf(err, "OCI hook %s", file)
+			}
+			hook.Path = "/" + strings.TrimPrefix(file, filepath.Join(root)+"/")
+			state.Hooks = append(state.Hooks, *hook)
+		}
+	}
+	return state, nil
+}
+
+// ParseVersion returns the version of the `crio --version` output
+func ParseVersion(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == "crio" && fields[1] == "version" {
+			return fields[2]
+		}
+		if key, value, found := strings.Cut(line, ":"); found && strings.TrimSpace(key) == "Version" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// ParseRuntimeHandlers returns the runtime handlers a CRI-O config file configures
+func ParseRuntimeHandlers(config string) []string {
+	var handlers []string
+	for _, match := range handlerSection.FindAllStringSubmatch(config, -1) {
+		handlers = append(handlers, strings.TrimSpace(match[2]))
+	}
+	return handlers
+}
+
+// ParseHook parses an OCI hook definition, as in the oci-hooks(5) 1.0.0 schema
+func ParseHook(data []byte) (*Hook, error) {
+	var definition struct {
+		Hook struct {
+			Path string `json:"path"`
+		} `json:"hook"`
+		Stages []string `json:"stages"`
+	}
+	if err := json.Unmarshal(data, &definition); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse hook definition")
+	}
+	if definition.Hook.Path == "" {
+		return nil, errors.New("hook definition has no hook path")
+	}
+	return &Hook{Digest: digest(data), Executable: definition.Hook.Path, Stages: definition.Stages}, nil
+}
+
+// ParseRuntimeClasses returns the runtime classes of the `oc get runtimeclass -o json` output
+func ParseRuntimeClasses(output []byte) ([]RuntimeClass, error) {
+	var list struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Handler string `json:"handler"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(output, &list); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse `oc get runtimeclass -o json` output")
+	}
+	var classes []RuntimeClass
+	for _, item := range list.Items {
+		classes = append(classes, RuntimeClass{Name: item.Metadata.Name, Handler: item.Handler})
+	}
+	return classes, nil
+}
+
+// RuntimeHandlers returns the runtime handlers configured by the CRI-O config, the built-in ones included
+func (s *State) RuntimeHandlers() map[string]bool {
+	handlers := map[string]bool{}
+	for handler := range builtinHandlers {
+		handlers[handler] = true
+	}
+	for _, config := range s.Configs {
+		for _, handler := range config.RuntimeHandlers {
+			handlers[handler] = true
+		}
+	}
+	return handlers
+}
+
+// UnconfiguredRuntimeClasses returns the runtime classes whose handler the CRI-O config doesn't
+// configure, pods using them fail to start
+func (s *State) UnconfiguredRuntimeClasses() []RuntimeClass {
+	handlers := s.RuntimeHandlers()
+	var classes []RuntimeClass
+	for _, class := range s.RuntimeClasses {
+		if !handlers[class.Handler] {
+			classes = append(classes, class)
+		}
+	}
+	return classes
+}
+
+// Plan is the outcome of comparing the seed CRI-O runtime configuration with the target one
+type Plan struct {
+	// Missing are the hooks and runtime handlers of the target the seed lacks, which break the
+	// target workloads relying on them without any error until their pods start
+	Missing []string
+	// Discrepancies are the differences that are only flagged
+	Discrepancies []string
+}
+
+// Compare checks the seed CRI-O runtime configuration, which replaces the target one, against the target
+func Compare(seed, target *State) *Plan {
+	plan := &Plan{}
+	if seedMinor, targetMinor := minorVersion(seed.Version), minorVersion(target.Version); seedMinor != targetMinor {
+		plan.Discrepancies = append(plan.Discrepancies, fmt.Sprintf(
+			"CRI-O version changes from %s to %s, the seed drop-ins were validated with CRI-O %s only",
+			target.Version, seed.Version, seed.Version))
+	}
+
+	seedHooks := map[string]Hook{}
+	for _, hook := range seed.Hooks {
+		seedHooks[filepath.Base(hook.Path)] = hook
+	}
+	for _, hook := range target.Hooks {
+		seedHook, ok := seedHooks[filepath.Base(hook.Path)]
+		switch {
+		case !ok:
+			plan.Missing = append(plan.Missing, fmt.Sprintf("OCI hook %s (%s)", hook.Path, hook.Executable))
+		case seedHook.Executable != hook.Executable:
+			plan.Discrepancies = append(plan.Discrepancies, fmt.Sprintf("OCI hook %s runs %s on the target, %s in the seed",
+				filepath.Base(hook.Path), hook.Executable, seedHook.Executable))
+		}
+	}
+
+	seedHandlers := seed.RuntimeHandlers()
+	for _, handler := range sortedKeys(target.RuntimeHandlers()) {
+		if !seedHandlers[handler] {
+			plan.Missing = append(plan.Missing, "runtime handler "+handler)
+		}
+	}
+
+	seedConfigs := map[string]string{}
+	for _, config := range seed.Configs {
+		seedConfigs[config.Path] = config.Digest
+	}
+	for _, config := range target.Configs {
+		seedDigest, ok := seedConfigs[config.Path]
+		switch {
+		case !ok:
+			plan.Discrepancies = append(plan.Discrepancies, "CRI-O drop-in "+config.Path+" is only on the target")
+		case seedDigest != config.Digest:
+			plan.Discrepancies = append(plan.Discrepancies, "CRI-O drop-in "+config.Path+" differs from the seed one")
+		}
+	}
+	return plan
+}
+
+// minorVersion returns the major.minor part of a version
+func minorVersion(version string) string {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func digest(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
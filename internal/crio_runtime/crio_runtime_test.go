@@ -0,0 +1,95 @@
+package crio_runtime
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"ibu-imager/internal/ops"
+)
+
+func TestCrioRuntime(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "CrioRuntime Suite")
+}
+
+var _ = Describe("CRI-O runtime configuration", func() {
+	var root string
+
+	BeforeEach(func() {
+		root, _ = os.MkdirTemp("", "test")
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(root)).To(Succeed())
+	})
+
+	writeFile := func(name, content string) {
+		Expect(os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, name), []byte(content), 0644)).To(Succeed())
+	}
+
+	It("Captures the version, drop-ins, runtime handlers and hooks", func() {
+		writeFile(dropInDir+"/00-default", "[crio.runtime]\nlog_level = \"info\"\n")
+		writeFile(dropInDir+"/99-runtimes.conf", "[crio.runtime]\ninfra_ctr_cpuset = \"0-1\"\n\n[crio.runtime.runtimes.high-performance]\nruntime_path = \"/bin/runc\"\n")
+		writeFile(hookDirs[0]+"/sriov.json", `{"version": "1.0.0", "hook": {"path": "/usr/libexec/sriov-hook"}, "when": {"always": true}, "stages": ["prestart"]}`)
+
+		ctrl := gomock.NewController(GinkgoT())
+		opsMock := ops.NewMockOps(ctrl)
+		opsMock.EXPECT().RunInHostNamespace("crio", "--version").Return("crio version 1.27.1-5.rhaos4.14\nVersion:        1.27.1-5.rhaos4.14\n", nil)
+
+		state, err := Capture(opsMock, root)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state.Version).To(Equal("1.27.1-5.rhaos4.14"))
+		Expect(state.Configs).To(HaveLen(2))
+		Expect(state.Configs[0].Path).To(Equal("/etc/crio/crio.conf.d/00-default"))
+		Expect(state.Configs[0].RuntimeHandlers).To(BeEmpty())
+		Expect(state.Configs[1].Path).To(Equal("/etc/crio/crio.conf.d/99-runtimes.conf"))
+		Expect(state.Configs[1].RuntimeHandlers).To(Equal([]string{"high-performance"}))
+		Expect(state.Hooks).To(HaveLen(1))
+		Expect(state.Hooks[0]).To(HaveField("Path", "/etc/containers/oci/hooks.d/sriov.json"))
+		Expect(state.Hooks[0]).To(HaveField("Executable", "/usr/libexec/sriov-hook"))
+		Expect(state.Hooks[0]).To(HaveField("Stages", []string{"prestart"}))
+	})
+
+	It("Flags the runtime classes without runtime handler", func() {
+		classes, err := ParseRuntimeClasses([]byte(`{"items": [{"metadata": {"name": "performance"}, "handler": "high-performance"}, {"metadata": {"name": "kata"}, "handler": "kata"}]}`))
+		Expect(err).ToNot(HaveOccurred())
+		state := &State{
+			Configs:        []ConfigFile{{Path: "/etc/crio/crio.conf.d/99-runtimes.conf", RuntimeHandlers: []string{"high-performance"}}},
+			RuntimeClasses: classes,
+		}
+		Expect(state.UnconfiguredRuntimeClasses()).To(Equal([]RuntimeClass{{Name: "kata", Handler: "kata"}}))
+	})
+
+	It("Reports the target hooks and runtime handlers the seed lacks", func() {
+		seed := &State{
+			Version: "1.27.1",
+			Configs: []ConfigFile{{Path: "/etc/crio/crio.conf.d/00-default", Digest: "sha256:a"}},
+		}
+		target := &State{
+			Version: "1.26.4",
+			Configs: []ConfigFile{
+				{Path: "/etc/crio/crio.conf.d/00-default", Digest: "sha256:b"},
+				{Path: "/etc/crio/crio.conf.d/99-runtimes.conf", Digest: "sha256:c", RuntimeHandlers: []string{"high-performance"}},
+			},
+			Hooks: []Hook{{Path: "/etc/containers/oci/hooks.d/sriov.json", Executable: "/usr/libexec/sriov-hook"}},
+		}
+
+		plan := Compare(seed, target)
+		Expect(plan.Missing).To(Equal([]string{
+			"OCI hook /etc/containers/oci/hooks.d/sriov.json (/usr/libexec/sriov-hook)",
+			"runtime handler high-performance",
+		}))
+		Expect(plan.Discrepancies).To(ConsistOf(
+			"CRI-O version changes from 1.26.4 to 1.27.1, the seed drop-ins were validated with CRI-O 1.27.1 only",
+			"CRI-O drop-in /etc/crio/crio.conf.d/00-default differs from the seed one",
+			"CRI-O drop-in /etc/crio/crio.conf.d/99-runtimes.conf is only on the target",
+		))
+
+		Expect(Compare(target, target).Missing).To(BeEmpty())
+	})
+})
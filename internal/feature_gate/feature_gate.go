@@ -0,0 +1,140 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package feature_gate guards the experimental subsystems of the imager, so they can ship disabled and be
+// enabled per site with the --feature-gates flag, e.g.
+//
+//	--feature-gates workerSeeds=true,orasArtifacts=true
+//
+// The state of every gate is recorded in the seed manifest, so support can tell what a seed was created with.
+package feature_gate
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Feature is the name of a feature gate
+type Feature string
+
+const (
+	// WorkerSeeds captures seeds from worker nodes, only carrying their kubelet state
+	WorkerSeeds Feature = "workerSeeds"
+	// ORASArtifacts stores seeds as ORAS artifacts, for the artifact registries refusing large image layers
+	ORASArtifacts Feature = "orasArtifacts"
+)
+
+// Stage is the maturity of a feature
+type Stage string
+
+const (
+	// Alpha features are disabled by default, may change or go away
+	Alpha Stage = "alpha"
+	// Beta features are enabled by default, and can still be disabled
+	Beta Stage = "beta"
+)
+
+// spec is the maturity and default state of a feature
+type spec struct {
+	stage   Stage
+	enabled bool
+}
+
+// features are the known feature gates
+var features = map[Feature]spec{
+	WorkerSeeds:   {stage: Alpha},
+	ORASArtifacts: {stage: Alpha},
+}
+
+// Gates are the states of the feature gates, the nil Gates leave every feature in its default state
+type Gates struct {
+	overrides map[Feature]bool
+}
+
+// Parse parses the comma separated <feature>=<bool> pairs of the --feature-gates flag, refusing the
+// unknown features
+func Parse(value string) (*Gates, error) {
+	gates := &Gates{overrides: map[Feature]bool{}}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, state, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, errors.Errorf("Invalid feature gate %q, expected <feature>=<true|false>", pair)
+		}
+		feature := Feature(strings.TrimSpace(name))
+		if _, ok := features[feature]; !ok {
+			return nil, errors.Errorf("Unknown feature gate %s, known ones are %s", feature, strings.Join(Known(), ", "))
+		}
+		enabled, err := strconv.ParseBool(strings.TrimSpace(state))
+		if err != nil {
+			return nil, errors.Errorf("Invalid state %q of feature gate %s, expected true or false", state, feature)
+		}
+		gates.overrides[feature] = enabled
+	}
+	return gates, nil
+}
+
+// Known returns the names of the known feature gates, sorted
+func Known() []string {
+	var names []string
+	for feature := range features {
+		names = append(names, string(feature))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StageOf returns the maturity of the feature
+func StageOf(feature Feature) Stage {
+	return features[feature].stage
+}
+
+// Enabled returns true if the feature is enabled, by the flag or by default
+func (g *Gates) Enabled(feature Feature) bool {
+	if g != nil {
+		if enabled, ok := g.overrides[feature]; ok {
+			return enabled
+		}
+	}
+	return features[feature].enabled
+}
+
+// States returns the state of every known feature gate, as recorded in the seed manifest
+func (g *Gates) States() map[string]bool {
+	states := map[string]bool{}
+	for feature := range features {
+		states[string(feature)] = g.Enabled(feature)
+	}
+	return states
+}
+
+// Experimental returns the names of the enabled features that aren't enabled by default, sorted
+func (g *Gates) Experimental() []string {
+	var names []string
+	for _, name := range Known() {
+		feature := Feature(name)
+		if g.Enabled(feature) && !features[feature].enabled {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,48 @@
+package feature_gate
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestFeatureGate(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Feature Gate Suite")
+}
+
+var _ = Describe("Feature gates", func() {
+
+	It("Leaves the alpha features disabled by default", func() {
+		var gates *Gates
+		Expect(gates.Enabled(WorkerSeeds)).To(BeFalse())
+		Expect(gates.States()).To(Equal(map[string]bool{"orasArtifacts": false, "workerSeeds": false}))
+		Expect(gates.Experimental()).To(BeEmpty())
+		Expect(StageOf(ORASArtifacts)).To(Equal(Alpha))
+	})
+
+	It("Enables the features of the flag", func() {
+		gates, err := Parse("workerSeeds=true, orasArtifacts=false")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gates.Enabled(WorkerSeeds)).To(BeTrue())
+		Expect(gates.Enabled(ORASArtifacts)).To(BeFalse())
+		Expect(gates.States()).To(Equal(map[string]bool{"orasArtifacts": false, "workerSeeds": true}))
+		Expect(gates.Experimental()).To(Equal([]string{"workerSeeds"}))
+	})
+
+	It("Accepts an empty flag", func() {
+		gates, err := Parse("")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gates.Enabled(WorkerSeeds)).To(BeFalse())
+	})
+
+	It("Refuses the unknown features and invalid states", func() {
+		_, err := Parse("hotBackup=true")
+		Expect(err).To(MatchError(ContainSubstring("Unknown feature gate hotBackup, known ones are orasArtifacts, workerSeeds")))
+		_, err = Parse("workerSeeds=yes")
+		Expect(err).To(MatchError(ContainSubstring("Invalid state")))
+		_, err = Parse("workerSeeds")
+		Expect(err).To(MatchError(ContainSubstring("expected <feature>=<true|false>")))
+	})
+})
@@ -0,0 +1,212 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package host_kernel
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/ops"
+)
+
+// hostSpecificKernelArgs are the kernel arguments that differ on every host or deployment, the
+// filesystem references among them being rewritten by the filesystem references restore step
+var hostSpecificKernelArgs = []string{"BOOT_IMAGE", "ostree", "root", "boot", "resume"}
+
+// State is the kernel configuration of a host
+type State struct {
+	// Cmdline is the command line the running kernel was booted with
+	Cmdline string `json:"cmdline"`
+	// KernelArgs are the kernel arguments of the booted deployment, per rpm-ostree kargs
+	KernelArgs []string `json:"kernelArgs"`
+	// TunedProfile is the active tuned profile, empty when tuned isn't running
+	TunedProfile string `json:"tunedProfile,omitempty"`
+}
+
+// Capture reads the kernel command line, the deployment kernel arguments and the tuned profile of the host
+func Capture(ops ops.Ops) (*State, error) {
+	cmdline, err := ops.RunInHostNamespace("cat", "/proc/cmdline")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read /proc/cmdline")
+	}
+	kargs, err := ops.RunInHostNamespace("rpm-ostree", "kargs")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read rpm-ostree kargs")
+	}
+	state := &State{Cmdline: strings.TrimSpace(cmdline), KernelArgs: strings.Fields(kargs)}
+
+	// tuned-adm fails when tuned isn't running, which is only a matter for the comparison
+	if tuned, err := ops.RunInHostNamespace("tuned-adm", "active"); err == nil {
+		state.TunedProfile = ParseTunedActive(tuned)
+	}
+	return state, nil
+}
+
+// ParseTunedActive returns the profile of the `tuned-adm active` output
+func ParseTunedActive(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if _, profile, found := strings.Cut(line, "Current active profile:"); found {
+			return strings.TrimSpace(profile)
+		}
+	}
+	return ""
+}
+
+// PendingKernelArgs returns the deployment kernel arguments the running kernel wasn't booted
+// with, i.e. the changes waiting for a reboot
+func (s *State) PendingKernelArgs() []string {
+	running := map[string]bool{}
+	for _, arg := range strings.Fields(s.Cmdline) {
+		running[arg] = true
+	}
+	var pending []string
+	for _, arg := range relevantKernelArgs(s.KernelArgs) {
+		if !running[arg] {
+			pending = append(pending, arg)
+		}
+	}
+	return pending
+}
+
+// Plan is what the restore has to do for the target kernel configuration to match the seed one
+type Plan struct {
+	// Append are the seed kernel arguments missing on the target
+	Append []string
+	// Replace are the seed kernel arguments whose single value differs on the target
+	Replace []string
+	// Discrepancies are the differences that can't be applied safely and are only flagged, e.g.
+	// target-only kernel arguments or a different tuned profile
+	Discrepancies []string
+}
+
+// Compare returns the kernel arguments to apply on the target to match the seed, ignoring the
+// host-specific ones
+func Compare(seed, target *State) *Plan {
+	seedArgs, targetArgs := relevantKernelArgs(seed.KernelArgs), relevantKernelArgs(target.KernelArgs)
+	seedValues, targetValues := argValues(seedArgs), argValues(targetArgs)
+
+	plan := &Plan{}
+	inSeed := map[string]bool{}
+	for _, arg := range seedArgs {
+		inSeed[arg] = true
+	}
+	inTarget := map[string]bool{}
+	for _, arg := range targetArgs {
+		inTarget[arg] = true
+	}
+
+	replaced := map[string]bool{}
+	for _, arg := range seedArgs {
+		if inTarget[arg] {
+			continue
+		}
+		key := argKey(arg)
+		if len(seedValues[key]) == 1 && len(targetValues[key]) == 1 {
+			plan.Replace = append(plan.Replace, arg)
+			replaced[key] = true
+		} else {
+			plan.Append = append(plan.Append, arg)
+		}
+	}
+	for _, arg := range targetArgs {
+		if !inSeed[arg] && !replaced[argKey(arg)] {
+			plan.Discrepancies = append(plan.Discrepancies, "kernel argument "+arg+" is only set on the target")
+		}
+	}
+	if seed.TunedProfile != target.TunedProfile {
+		plan.Discrepancies = append(plan.Discrepancies,
+			"tuned profile differs: seed is "+profileName(seed.TunedProfile)+", target is "+profileName(target.TunedProfile))
+	}
+	return plan
+}
+
+// Empty tells whether the plan has nothing to apply
+func (p *Plan) Empty() bool {
+	return len(p.Append) == 0 && len(p.Replace) == 0
+}
+
+// DeployArgs returns the `ostree admin deploy` options applying the plan to a new deployment
+func (p *Plan) DeployArgs() []string {
+	var args []string
+	for _, arg := range p.Append {
+		args = append(args, "--karg-append="+arg)
+	}
+	for _, arg := range p.Replace {
+		args = append(args, "--karg="+arg)
+	}
+	return args
+}
+
+// Apply applies the kernel arguments of the plan to the booted deployment, effective on next boot
+func Apply(ops ops.Ops, plan *Plan) error {
+	if plan.Empty() {
+		return nil
+	}
+	args := []string{"kargs"}
+	for _, arg := range plan.Append {
+		args = append(args, "--append="+arg)
+	}
+	for _, arg := range plan.Replace {
+		args = append(args, "--replace="+arg)
+	}
+	_, err := ops.RunInHostNamespace("rpm-ostree", args...)
+	return errors.Wrap(err, "Failed to apply kernel arguments")
+}
+
+// relevantKernelArgs returns the sorted kernel arguments, without the host-specific ones
+func relevantKernelArgs(args []string) []string {
+	var relevant []string
+	for _, arg := range args {
+		if !isHostSpecific(argKey(arg)) {
+			relevant = append(relevant, arg)
+		}
+	}
+	sort.Strings(relevant)
+	return relevant
+}
+
+// argValues groups the kernel arguments by key, arguments such as console can be repeated
+func argValues(args []string) map[string][]string {
+	values := map[string][]string{}
+	for _, arg := range args {
+		values[argKey(arg)] = append(values[argKey(arg)], arg)
+	}
+	return values
+}
+
+func argKey(arg string) string {
+	key, _, _ := strings.Cut(arg, "=")
+	return key
+}
+
+func isHostSpecific(key string) bool {
+	for _, arg := range hostSpecificKernelArgs {
+		if key == arg {
+			return true
+		}
+	}
+	return false
+}
+
+func profileName(profile string) string {
+	if profile == "" {
+		return "none"
+	}
+	return profile
+}
@@ -0,0 +1,74 @@
+package host_kernel
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/ops"
+)
+
+func TestHostKernel(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "HostKernel Suite")
+}
+
+var _ = Describe("Kernel configuration", func() {
+	It("Captures the kernel configuration", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		opsMock := ops.NewMockOps(ctrl)
+		opsMock.EXPECT().RunInHostNamespace("cat", "/proc/cmdline").Return("BOOT_IMAGE=/vmlinuz ostree=/ostree/boot.1 isolcpus=2-3\n", nil)
+		opsMock.EXPECT().RunInHostNamespace("rpm-ostree", "kargs").Return("ostree=/ostree/boot.1 isolcpus=2-3 hugepages=16\n", nil)
+		opsMock.EXPECT().RunInHostNamespace("tuned-adm", "active").Return("Current active profile: openshift-node-performance\n", nil)
+
+		state, err := Capture(opsMock)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state).To(Equal(&State{
+			Cmdline:      "BOOT_IMAGE=/vmlinuz ostree=/ostree/boot.1 isolcpus=2-3",
+			KernelArgs:   []string{"ostree=/ostree/boot.1", "isolcpus=2-3", "hugepages=16"},
+			TunedProfile: "openshift-node-performance",
+		}))
+		Expect(state.PendingKernelArgs()).To(Equal([]string{"hugepages=16"}))
+	})
+
+	It("Captures no tuned profile when tuned isn't running", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		opsMock := ops.NewMockOps(ctrl)
+		opsMock.EXPECT().RunInHostNamespace("cat", "/proc/cmdline").Return("", nil)
+		opsMock.EXPECT().RunInHostNamespace("rpm-ostree", "kargs").Return("", nil)
+		opsMock.EXPECT().RunInHostNamespace("tuned-adm", "active").Return("", errors.New("tuned not running"))
+
+		state, err := Capture(opsMock)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.TunedProfile).To(BeEmpty())
+	})
+
+	It("Plans the kernel arguments to apply on the target", func() {
+		seed := &State{
+			KernelArgs:   []string{"root=UUID=aaa", "hugepages=16", "isolcpus=2-3", "console=tty0", "console=ttyS0"},
+			TunedProfile: "openshift-node-performance",
+		}
+		target := &State{KernelArgs: []string{"root=UUID=bbb", "hugepages=8", "console=tty0", "nosmt"}}
+
+		plan := Compare(seed, target)
+		Expect(plan.Append).To(Equal([]string{"console=ttyS0", "isolcpus=2-3"}))
+		Expect(plan.Replace).To(Equal([]string{"hugepages=16"}))
+		Expect(plan.Discrepancies).To(ConsistOf(
+			"kernel argument nosmt is only set on the target",
+			"tuned profile differs: seed is openshift-node-performance, target is none",
+		))
+		Expect(plan.DeployArgs()).To(Equal([]string{"--karg-append=console=ttyS0", "--karg-append=isolcpus=2-3", "--karg=hugepages=16"}))
+		Expect(Compare(seed, seed).Empty()).To(BeTrue())
+	})
+
+	It("Applies the kernel arguments", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		opsMock := ops.NewMockOps(ctrl)
+		opsMock.EXPECT().RunInHostNamespace("rpm-ostree", "kargs", "--append=isolcpus=2-3", "--replace=hugepages=16").Return("", nil)
+		Expect(Apply(opsMock, &Plan{Append: []string{"isolcpus=2-3"}, Replace: []string{"hugepages=16"}})).To(Succeed())
+		Expect(Apply(opsMock, &Plan{})).To(Succeed())
+	})
+})
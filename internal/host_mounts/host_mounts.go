@@ -0,0 +1,110 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package host_mounts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// hostRoot is the host root filesystem as seen from a container sharing the host PID namespace
+var hostRoot = "/proc/1/root"
+
+// containerMarkers are files created by the container engines inside their containers
+var containerMarkers = []string{"/run/.containerenv", "/.dockerenv"}
+
+// RequiredHostMounts are the host paths the imager accesses directly (i.e. not through nsenter),
+// and which therefore must be bind mounted from the host when running as a container
+var RequiredHostMounts = map[string]string{
+	"/var": "the backup dir, run markers and the podman build context",
+	"/etc": "the installation configuration systemd units and the MCO current config",
+	// /ostree is a symlink into the physical root on the host, so mounting /sysroot doesn't provide it
+	"/sysroot":      "the .origin file of the booted ostree deployment",
+	"/ostree":       "the ostree repo sized by the preflight and downtime estimates",
+	"/var/lib/etcd": "the quiesced etcd data served to the recert dry run",
+}
+
+// RestoreHostMounts are the host paths the restore accesses directly
+var RestoreHostMounts = map[string]string{
+	"/var":     "the mounted seed image and the core user's authorized_keys",
+	"/etc":     "the SELinux config compared with the seed one",
+	"/sysroot": "the new stateroot the seed is extracted to",
+}
+
+// IsContainerized returns true if the imager runs inside a container
+func IsContainerized() bool {
+	for _, marker := range containerMarkers {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateHostMounts checks that the imager shares the host PID namespace and that all the
+// required host paths are mounted from the host, rather than being the container's own paths
+func ValidateHostMounts(mounts map[string]string) error {
+	comm, err := os.ReadFile("/proc/1/comm")
+	if err != nil {
+		return errors.Wrap(err, "Failed to read the name of PID 1")
+	}
+	if strings.TrimSpace(string(comm)) != "systemd" {
+		return errors.New("PID 1 is not systemd, the container must run with --pid=host")
+	}
+
+	var problems []string
+	for mount, reason := range mounts {
+		if err = validateHostMount(mount); err != nil {
+			problems = append(problems, errors.Wrapf(err, "%s (needed for %s)", mount, reason).Error())
+		}
+	}
+	if len(problems) > 0 {
+		return errors.Errorf("Missing host mounts, run the container with -v <path>:<path> for each of: %s",
+			strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func validateHostMount(mount string) error {
+	containerInfo, err := os.Stat(mount)
+	if err != nil {
+		return errors.New("path not present in the container")
+	}
+	hostInfo, err := os.Stat(filepath.Join(hostRoot, mount))
+	if err != nil {
+		return errors.New("path not present on the host")
+	}
+
+	containerStat, ok := containerInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return errors.New("unable to stat path")
+	}
+	hostStat, ok := hostInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return errors.New("unable to stat host path")
+	}
+
+	// A bind mount of the host path shares its device and inode
+	if containerStat.Dev != hostStat.Dev || containerStat.Ino != hostStat.Ino {
+		return errors.New("path is the container's own, not the host's")
+	}
+	return nil
+}
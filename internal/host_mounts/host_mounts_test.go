@@ -0,0 +1,64 @@
+package host_mounts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestHostMounts(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Host Mounts Suite")
+}
+
+var _ = Describe("Host mounts", func() {
+	var (
+		tmpDir          string
+		defaultHostRoot = hostRoot
+	)
+
+	BeforeEach(func() {
+		tmpDir, _ = os.MkdirTemp("", "test")
+	})
+	AfterEach(func() {
+		hostRoot = defaultHostRoot
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("Requires the host paths the seed creation accesses directly", func() {
+		for _, mount := range []string{"/var", "/etc", "/sysroot", "/ostree", "/var/lib/etcd"} {
+			Expect(RequiredHostMounts).To(HaveKey(mount))
+		}
+		Expect(RestoreHostMounts).To(HaveKey("/sysroot"))
+	})
+
+	It("Tells the host paths from the container's own", func() {
+		containerDir := filepath.Join(tmpDir, "container")
+		Expect(os.MkdirAll(filepath.Join(containerDir, "var", "lib", "etcd"), 0755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(containerDir, "etc"), 0755)).To(Succeed())
+		hostDir := filepath.Join(tmpDir, "host")
+		Expect(os.MkdirAll(filepath.Join(hostDir, containerDir, "etc"), 0755)).To(Succeed())
+
+		for _, test := range []struct {
+			mount    string
+			hostRoot string
+			problem  string
+		}{
+			{mount: filepath.Join(containerDir, "var", "lib", "etcd"), hostRoot: "/"},
+			{mount: filepath.Join(containerDir, "ostree"), hostRoot: "/", problem: "path not present in the container"},
+			{mount: filepath.Join(containerDir, "var", "lib", "etcd"), hostRoot: hostDir, problem: "path not present on the host"},
+			{mount: filepath.Join(containerDir, "etc"), hostRoot: hostDir, problem: "path is the container's own, not the host's"},
+		} {
+			hostRoot = test.hostRoot
+			err := validateHostMount(test.mount)
+			if test.problem == "" {
+				Expect(err).ToNot(HaveOccurred(), test.mount)
+			} else {
+				Expect(err).To(MatchError(test.problem), test.mount)
+			}
+		}
+	})
+})
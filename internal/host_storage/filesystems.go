@@ -0,0 +1,219 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package host_storage
+
+import (
+	"bufio"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/ops"
+)
+
+// bootloaderEntries are the bootloader entries holding the kernel arguments
+const bootloaderEntries = "/boot/loader/entries/*.conf"
+
+// kernelArgsWithReferences are the kernel arguments that may reference a filesystem by UUID or label
+var kernelArgsWithReferences = []string{"root", "boot", "resume"}
+
+// FilesystemReference is a reference (e.g. UUID=... or LABEL=...) to a filesystem found in
+// fstab or in the bootloader entries
+type FilesystemReference struct {
+	// Source is the reference as written in the file, e.g. UUID=1234
+	Source string `json:"source"`
+	// MountPoint is the mount point in fstab, or the kernel argument name for bootloader entries
+	MountPoint string `json:"mountPoint"`
+	// Origin is the file the reference was read from
+	Origin string `json:"origin"`
+}
+
+// BlockDevice is a block device identified by blkid
+type BlockDevice struct {
+	Device string `json:"device"`
+	UUID   string `json:"uuid,omitempty"`
+	Label  string `json:"label,omitempty"`
+	Type   string `json:"type,omitempty"`
+}
+
+// FilesystemReferences is the captured set of filesystem references and the devices they resolved to
+type FilesystemReferences struct {
+	References []FilesystemReference `json:"references"`
+	Devices    []BlockDevice         `json:"devices"`
+}
+
+// CaptureFilesystemReferences reads fstab, the bootloader entries and the block devices of the host
+func CaptureFilesystemReferences(ops ops.Ops) (*FilesystemReferences, error) {
+	fstab, err := ops.RunInHostNamespace("cat", "/etc/fstab")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read /etc/fstab")
+	}
+	references := ParseFstab(fstab)
+
+	entries, err := bootloaderOptions(ops)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read bootloader entries")
+	}
+	references = append(references, ParseBootloaderEntries(entries)...)
+
+	blkid, err := ops.RunInHostNamespace("blkid", "-o", "export")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list block devices")
+	}
+
+	return &FilesystemReferences{References: references, Devices: ParseBlkid(blkid)}, nil
+}
+
+// bootloaderOptions returns the options lines of the bootloader entries, prefixed with their file like
+// grep -H prints them. Hosts without grep have the entries read and filtered here.
+func bootloaderOptions(op ops.Ops) (string, error) {
+	entries, err := op.RunBashInHostNamespace("grep", "-H", "^options", bootloaderEntries)
+	if !ops.IsCommandNotFound(err) {
+		return entries, err
+	}
+
+	files, err := op.RunBashInHostNamespace("echo", bootloaderEntries)
+	if err != nil {
+		return "", err
+	}
+	var options []string
+	for _, file := range strings.Fields(files) {
+		content, err := op.RunInHostNamespace("cat", file)
+		if err != nil {
+			return "", err
+		}
+		for _, line := range strings.Split(content, "\n") {
+			if strings.HasPrefix(line, "options") {
+				options = append(options, file+":"+line)
+			}
+		}
+	}
+	return strings.Join(options, "\n"), nil
+}
+
+// ParseFstab returns the UUID and LABEL references found in the given fstab content
+func ParseFstab(content string) []FilesystemReference {
+	var references []FilesystemReference
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !isReference(fields[0]) {
+			continue
+		}
+		references = append(references, FilesystemReference{Source: fields[0], MountPoint: fields[1], Origin: "/etc/fstab"})
+	}
+	return references
+}
+
+// ParseBootloaderEntries parses `grep -H ^options` output of the BLS entries and returns their references
+func ParseBootloaderEntries(content string) []FilesystemReference {
+	var references []FilesystemReference
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		file, options, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		for _, arg := range strings.Fields(strings.TrimPrefix(options, "options")) {
+			key, value, found := strings.Cut(arg, "=")
+			if !found || !isKernelArgWithReference(key) || !isReference(value) {
+				continue
+			}
+			references = append(references, FilesystemReference{Source: value, MountPoint: key, Origin: file})
+		}
+	}
+	return references
+}
+
+// ParseBlkid parses `blkid -o export` output
+func ParseBlkid(content string) []BlockDevice {
+	var (
+		devices []BlockDevice
+		current *BlockDevice
+	)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !found {
+			// Devices are separated by empty lines
+			current = nil
+			continue
+		}
+		if current == nil {
+			devices = append(devices, BlockDevice{})
+			current = &devices[len(devices)-1]
+		}
+		switch key {
+		case "DEVNAME":
+			current.Device = value
+		case "UUID":
+			current.UUID = value
+		case "LABEL":
+			current.Label = value
+		case "TYPE":
+			current.Type = value
+		}
+	}
+	return devices
+}
+
+// ReferenceMapping maps the seed references to the target references of the filesystems
+// mounted at the same place, e.g. UUID=<seed boot uuid> to UUID=<target boot uuid>
+func ReferenceMapping(seed, target *FilesystemReferences) map[string]string {
+	targetByMountPoint := map[string]string{}
+	for _, ref := range target.References {
+		targetByMountPoint[ref.MountPoint] = ref.Source
+	}
+
+	mapping := map[string]string{}
+	for _, ref := range seed.References {
+		if targetSource, ok := targetByMountPoint[ref.MountPoint]; ok && targetSource != ref.Source {
+			mapping[ref.Source] = targetSource
+		}
+	}
+	return mapping
+}
+
+// RewriteReferences replaces the seed filesystem references in content using the given mapping
+func RewriteReferences(content string, mapping map[string]string) string {
+	if len(mapping) == 0 {
+		return content
+	}
+	oldNew := make([]string, 0, len(mapping)*2)
+	for from, to := range mapping {
+		oldNew = append(oldNew, from, to)
+	}
+	return strings.NewReplacer(oldNew...).Replace(content)
+}
+
+func isReference(source string) bool {
+	return strings.HasPrefix(source, "UUID=") || strings.HasPrefix(source, "LABEL=") ||
+		strings.HasPrefix(source, "PARTUUID=") || strings.HasPrefix(source, "PARTLABEL=")
+}
+
+func isKernelArgWithReference(key string) bool {
+	for _, arg := range kernelArgsWithReferences {
+		if key == arg {
+			return true
+		}
+	}
+	return false
+}
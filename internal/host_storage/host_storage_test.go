@@ -0,0 +1,82 @@
+package host_storage
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"ibu-imager/internal/ops"
+)
+
+func TestHostStorage(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "HostStorage Suite")
+}
+
+var _ = Describe("Filesystem references", func() {
+	It("Parses fstab and bootloader references", func() {
+		fstab := "# comment\nUUID=aaa /boot ext4 defaults 1 2\n/dev/sda4 /var xfs defaults 0 0\n"
+		entries := "/boot/loader/entries/ostree-1.conf:options root=UUID=bbb rw boot=UUID=aaa ostree=/ostree/boot.1\n"
+
+		refs := append(ParseFstab(fstab), ParseBootloaderEntries(entries)...)
+		Expect(refs).To(Equal([]FilesystemReference{
+			{Source: "UUID=aaa", MountPoint: "/boot", Origin: "/etc/fstab"},
+			{Source: "UUID=bbb", MountPoint: "root", Origin: "/boot/loader/entries/ostree-1.conf"},
+			{Source: "UUID=aaa", MountPoint: "boot", Origin: "/boot/loader/entries/ostree-1.conf"},
+		}))
+	})
+
+	It("Reads the bootloader entries on hosts without grep", func() {
+		opsMock := ops.NewMockOps(gomock.NewController(GinkgoT()))
+		opsMock.EXPECT().RunBashInHostNamespace("grep", "-H", "^options", "/boot/loader/entries/*.conf").
+			Return("", &ops.CommandNotFoundError{Command: "grep"})
+		opsMock.EXPECT().RunBashInHostNamespace("echo", "/boot/loader/entries/*.conf").
+			Return("/boot/loader/entries/ostree-1.conf /boot/loader/entries/ostree-2.conf", nil)
+		opsMock.EXPECT().RunInHostNamespace("cat", "/boot/loader/entries/ostree-1.conf").
+			Return("title RHCOS\noptions root=UUID=bbb rw", nil)
+		opsMock.EXPECT().RunInHostNamespace("cat", "/boot/loader/entries/ostree-2.conf").
+			Return("options boot=UUID=aaa", nil)
+
+		Expect(bootloaderOptions(opsMock)).To(Equal("/boot/loader/entries/ostree-1.conf:options root=UUID=bbb rw\n" +
+			"/boot/loader/entries/ostree-2.conf:options boot=UUID=aaa"))
+	})
+
+	It("Parses blkid output", func() {
+		devices := ParseBlkid("DEVNAME=/dev/sda3\nLABEL=boot\nUUID=aaa\nTYPE=ext4\n\nDEVNAME=/dev/sda4\nUUID=bbb\n")
+		Expect(devices).To(Equal([]BlockDevice{
+			{Device: "/dev/sda3", Label: "boot", UUID: "aaa", Type: "ext4"},
+			{Device: "/dev/sda4", UUID: "bbb"},
+		}))
+	})
+
+	It("Rewrites seed references to the target ones", func() {
+		seed := &FilesystemReferences{References: []FilesystemReference{{Source: "UUID=aaa", MountPoint: "/boot"}}}
+		target := &FilesystemReferences{References: []FilesystemReference{{Source: "UUID=ccc", MountPoint: "/boot"}}}
+		mapping := ReferenceMapping(seed, target)
+		Expect(RewriteReferences("UUID=aaa /boot ext4 defaults 1 2", mapping)).To(Equal("UUID=ccc /boot ext4 defaults 1 2"))
+	})
+})
+
+var _ = Describe("Storage layout", func() {
+	mountInfo := `22 1 252:4 / /sysroot ro,relatime - xfs /dev/sda4 rw
+23 22 252:4 /ostree/deploy/rhcos/var /var rw - xfs /dev/sda4 rw
+24 22 252:5 / /var rw,relatime shared:3 - xfs /dev/sda5 rw
+25 22 252:3 / /boot rw - ext4 /dev/sda3 rw
+`
+
+	It("Parses the mount table", func() {
+		mounts := ParseMountInfo(mountInfo)
+		Expect(mounts).To(HaveLen(4))
+		Expect(mounts[2]).To(Equal(Mount{MountPoint: "/var", Source: "/dev/sda5", FSType: "xfs", Device: "252:5"}))
+	})
+
+	It("Requires a separate /var on the target when the seed had one", func() {
+		seed := &StorageLayout{Mounts: ParseMountInfo(mountInfo)}
+		Expect(seed.HasSeparateVar()).To(BeTrue())
+		target := &StorageLayout{Mounts: ParseMountInfo(mountInfo)[:2]}
+		Expect(ValidateTarget(seed, target)).To(HaveOccurred())
+		Expect(ValidateTarget(seed, seed)).To(Succeed())
+	})
+})
@@ -0,0 +1,222 @@
+package host_storage
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// sectorSize is the unit of the sysfs block device sizes
+	sectorSize = 512
+)
+
+// layoutMountPoints are the mount points whose filesystem usage is captured
+var layoutMountPoints = []string{"/sysroot", "/var", "/boot"}
+
+// Mount is an entry of the host mount table
+type Mount struct {
+	MountPoint string `json:"mountPoint"`
+	Source     string `json:"source"`
+	FSType     string `json:"fsType"`
+	// Device is the major:minor number of the mounted device
+	Device    string `json:"device"`
+	SizeBytes uint64 `json:"sizeBytes,omitempty"`
+	UsedBytes uint64 `json:"usedBytes,omitempty"`
+	FreeBytes uint64 `json:"freeBytes,omitempty"`
+}
+
+// Partition is a partition of a disk
+type Partition struct {
+	Name      string `json:"name"`
+	Device    string `json:"device"`
+	SizeBytes uint64 `json:"sizeBytes"`
+}
+
+// Disk is a block device of the host
+type Disk struct {
+	Name       string      `json:"name"`
+	Device     string      `json:"device"`
+	SizeBytes  uint64      `json:"sizeBytes"`
+	Partitions []Partition `json:"partitions,omitempty"`
+}
+
+// StorageLayout is the partition layout and mount table of the host
+type StorageLayout struct {
+	Disks  []Disk  `json:"disks"`
+	Mounts []Mount `json:"mounts"`
+}
+
+// CaptureLayout reads the host mount table from procRoot/1/mountinfo, the disks from sysRoot/block,
+// and the usage of the main filesystems through procRoot/1/root
+func CaptureLayout(procRoot, sysRoot string) (*StorageLayout, error) {
+	mountInfo, err := os.ReadFile(filepath.Join(procRoot, "1", "mountinfo"))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read host mount table")
+	}
+	disks, err := ReadDisks(filepath.Join(sysRoot, "block"))
+	if err != nil {
+		return nil, err
+	}
+
+	var mounts []Mount
+	for _, mount := range ParseMountInfo(string(mountInfo)) {
+		if !isLayoutMountPoint(mount.MountPoint) {
+			continue
+		}
+		var stat syscall.Statfs_t
+		if err = syscall.Statfs(filepath.Join(procRoot, "1", "root", mount.MountPoint), &stat); err == nil {
+			mount.SizeBytes = stat.Blocks * uint64(stat.Bsize)
+			mount.FreeBytes = stat.Bavail * uint64(stat.Bsize)
+			mount.UsedBytes = (stat.Blocks - stat.Bfree) * uint64(stat.Bsize)
+		}
+		mounts = append(mounts, mount)
+	}
+	return &StorageLayout{Disks: disks, Mounts: mounts}, nil
+}
+
+// ParseMountInfo parses a proc mountinfo file, see proc(5)
+func ParseMountInfo(content string) []Mount {
+	var mounts []Mount
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// The optional fields are terminated by a single hyphen
+		separator := -1
+		for i, field := range fields {
+			if field == "-" {
+				separator = i
+				break
+			}
+		}
+		if len(fields) < 5 || separator < 0 || len(fields) < separator+3 {
+			continue
+		}
+		mounts = append(mounts, Mount{
+			MountPoint: unescapeMountInfo(fields[4]),
+			Device:     fields[2],
+			FSType:     fields[separator+1],
+			Source:     unescapeMountInfo(fields[separator+2]),
+		})
+	}
+	return mounts
+}
+
+// ReadDisks lists the disks and their partitions from a sysfs block directory
+func ReadDisks(blockDir string) ([]Disk, error) {
+	entries, err := os.ReadDir(blockDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list block devices")
+	}
+
+	var disks []Disk
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+		diskDir := filepath.Join(blockDir, name)
+		disk := Disk{Name: name, Device: readSysfsString(diskDir, "dev"), SizeBytes: readSysfsSize(diskDir)}
+
+		partitions, _ := os.ReadDir(diskDir)
+		for _, partition := range partitions {
+			partitionDir := filepath.Join(diskDir, partition.Name())
+			if _, err := os.Stat(filepath.Join(partitionDir, "partition")); err != nil {
+				continue
+			}
+			disk.Partitions = append(disk.Partitions, Partition{
+				Name:      partition.Name(),
+				Device:    readSysfsString(partitionDir, "dev"),
+				SizeBytes: readSysfsSize(partitionDir),
+			})
+		}
+		disks = append(disks, disk)
+	}
+	return disks, nil
+}
+
+// Mount returns the mount at the given mount point
+func (l *StorageLayout) Mount(mountPoint string) (Mount, bool) {
+	// The last mount on a mount point is the visible one
+	for i := len(l.Mounts) - 1; i >= 0; i-- {
+		if l.Mounts[i].MountPoint == mountPoint {
+			return l.Mounts[i], true
+		}
+	}
+	return Mount{}, false
+}
+
+// HasSeparateVar returns true if /var lives on its own partition rather than on the root one
+func (l *StorageLayout) HasSeparateVar() bool {
+	varMount, hasVar := l.Mount("/var")
+	rootMount, hasRoot := l.Mount("/sysroot")
+	return hasVar && hasRoot && varMount.Device != rootMount.Device
+}
+
+// ValidateTarget checks that the target layout can hold the seed: a separate /var partition is
+// present when the seed had one, and the target /var is large enough for the seed /var content
+func ValidateTarget(seed, target *StorageLayout) error {
+	var problems []string
+	if seed.HasSeparateVar() && !target.HasSeparateVar() {
+		problems = append(problems, "the seed has a separate /var partition but the target doesn't")
+	}
+	seedVar, hasSeedVar := seed.Mount("/var")
+	targetVar, hasTargetVar := target.Mount("/var")
+	if hasSeedVar && hasTargetVar && targetVar.SizeBytes < seedVar.UsedBytes {
+		problems = append(problems, "the target /var ("+strconv.FormatUint(targetVar.SizeBytes, 10)+
+			" bytes) is smaller than the seed /var content ("+strconv.FormatUint(seedVar.UsedBytes, 10)+" bytes)")
+	}
+	if len(problems) > 0 {
+		return errors.Errorf("Target storage layout is not compatible with the seed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func isLayoutMountPoint(mountPoint string) bool {
+	for _, m := range layoutMountPoints {
+		if m == mountPoint {
+			return true
+		}
+	}
+	return false
+}
+
+func readSysfsString(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func readSysfsSize(dir string) uint64 {
+	sectors, err := strconv.ParseUint(readSysfsString(dir, "size"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return sectors * sectorSize
+}
+
+// unescapeMountInfo decodes the octal escapes (e.g. \040 for spaces) of mountinfo paths
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
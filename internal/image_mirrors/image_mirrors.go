@@ -0,0 +1,106 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image_mirrors
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Kinds are the cluster resources holding image mirroring rules, oldest first. Each is only served
+// by some OCP versions, ImageContentSourcePolicy being deprecated by the two others in 4.13.
+var Kinds = []string{"imagecontentsourcepolicy", "imagedigestmirrorset", "imagetagmirrorset"}
+
+// Rule redirects the images of a source repository, or of a registry or namespace, to mirrors
+type Rule struct {
+	Source  string   `json:"source"`
+	Mirrors []string `json:"mirrors"`
+}
+
+// mirrorList is the subset of `oc get <kind> -o json` holding the mirroring rules, whatever the kind
+type mirrorList struct {
+	Items []struct {
+		Spec struct {
+			RepositoryDigestMirrors []Rule `json:"repositoryDigestMirrors"`
+			ImageDigestMirrors      []Rule `json:"imageDigestMirrors"`
+			ImageTagMirrors         []Rule `json:"imageTagMirrors"`
+		} `json:"spec"`
+	} `json:"items"`
+}
+
+// ParseRules returns the mirroring rules of an `oc get <kind> -o json` output, for any of Kinds
+func ParseRules(output []byte) ([]Rule, error) {
+	var list mirrorList
+	if err := json.Unmarshal(output, &list); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse image mirroring rules")
+	}
+	var rules []Rule
+	for _, item := range list.Items {
+		rules = append(rules, item.Spec.RepositoryDigestMirrors...)
+		rules = append(rules, item.Spec.ImageDigestMirrors...)
+		rules = append(rules, item.Spec.ImageTagMirrors...)
+	}
+	return rules, nil
+}
+
+// Mirrors returns the image references in the mirrors of the most specific rule source matching the
+// image, in the order they're configured and without duplicates. Nil if no rule matches the image.
+func Mirrors(rules []Rule, image string) []string {
+	name, suffix := splitName(image)
+	source := ""
+	var mirrors []string
+	for _, rule := range rules {
+		if !matches(rule.Source, name) || len(rule.Source) < len(source) {
+			continue
+		}
+		if len(rule.Source) > len(source) {
+			source, mirrors = rule.Source, nil
+		}
+		mirrors = append(mirrors, rule.Mirrors...)
+	}
+
+	var images []string
+	seen := map[string]bool{}
+	for _, mirror := range mirrors {
+		mirrored := mirror + strings.TrimPrefix(name, source) + suffix
+		if !seen[mirrored] {
+			seen[mirrored] = true
+			images = append(images, mirrored)
+		}
+	}
+	return images
+}
+
+// matches returns true if the source is the repository itself, or one of its registry or namespaces
+func matches(source, name string) bool {
+	return source != "" && (name == source || strings.HasPrefix(name, source+"/"))
+}
+
+// splitName splits an image reference into its repository and its :tag and/or @digest
+func splitName(image string) (string, string) {
+	name, digest, _ := strings.Cut(image, "@")
+	if digest != "" {
+		digest = "@" + digest
+	}
+	// A colon after the last slash separates the tag, otherwise it's the registry port
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		return name[:i], name[i:] + digest
+	}
+	return name, digest
+}
@@ -0,0 +1,43 @@
+package image_mirrors
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestImageMirrors(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Image Mirrors Suite")
+}
+
+var _ = Describe("Image mirrors", func() {
+	It("Parses the rules of every mirroring kind", func() {
+		rules, err := ParseRules([]byte(`{"items": [
+			{"spec": {"repositoryDigestMirrors": [{"source": "quay.io/edge-infrastructure", "mirrors": ["mirror.lab:5000/edge"]}]}},
+			{"spec": {"imageDigestMirrors": [{"source": "quay.io", "mirrors": ["mirror.lab:5000/quay"]}]}},
+			{"spec": {"imageTagMirrors": [{"source": "quay.io/edge-infrastructure/recert", "mirrors": ["tags.lab/recert"]}]}}
+		]}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rules).To(HaveLen(3))
+	})
+
+	It("Rewrites the image with the mirrors of the most specific source", func() {
+		rules := []Rule{
+			{Source: "quay.io", Mirrors: []string{"mirror.lab:5000/quay"}},
+			{Source: "quay.io/edge-infrastructure", Mirrors: []string{"mirror.lab:5000/edge", "backup.lab/edge"}},
+			{Source: "quay.io/edge-infrastructure", Mirrors: []string{"mirror.lab:5000/edge"}},
+		}
+		Expect(Mirrors(rules, "quay.io/edge-infrastructure/recert:latest")).To(Equal([]string{
+			"mirror.lab:5000/edge/recert:latest", "backup.lab/edge/recert:latest",
+		}))
+		Expect(Mirrors(rules, "quay.io/openshift/etcd@sha256:1234")).To(Equal([]string{"mirror.lab:5000/quay/openshift/etcd@sha256:1234"}))
+	})
+
+	It("Doesn't mirror images no source matches", func() {
+		rules := []Rule{{Source: "quay.io/edge", Mirrors: []string{"mirror.lab/edge"}}}
+		Expect(Mirrors(rules, "quay.io/edge-infrastructure/recert:latest")).To(BeEmpty())
+		Expect(Mirrors(rules, "localhost:5000/recert")).To(BeEmpty())
+	})
+})
@@ -0,0 +1,108 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image_policy
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultPolicyFile is the containers-policy.json(5) file of the host
+	DefaultPolicyFile = "/etc/containers/policy.json"
+
+	requirementInsecureAcceptAnything = "insecureAcceptAnything"
+	requirementReject                 = "reject"
+)
+
+// Requirement is a single policy requirement, e.g. signedBy or sigstoreSigned
+type Requirement struct {
+	Type string `json:"type"`
+}
+
+// Policy is the subset of containers-policy.json(5) needed to find the requirements of an image
+type Policy struct {
+	Default    []Requirement                       `json:"default"`
+	Transports map[string]map[string][]Requirement `json:"transports"`
+}
+
+// Verdict is how the policy treats an image
+type Verdict string
+
+const (
+	// VerdictVerified means the image is only accepted with valid signatures
+	VerdictVerified Verdict = "verified"
+	// VerdictUnverified means the image is accepted without signature verification
+	VerdictUnverified Verdict = "unverified"
+	// VerdictRejected means the image is always rejected
+	VerdictRejected Verdict = "rejected"
+)
+
+// Parse parses a containers-policy.json(5) file content
+func Parse(data []byte) (*Policy, error) {
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse signature policy")
+	}
+	return &policy, nil
+}
+
+// Requirements returns the requirements of the most specific scope of the docker transport
+// matching the image, falling back to the default requirements
+func (p *Policy) Requirements(image string) []Requirement {
+	name, _, _ := strings.Cut(image, "@")
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+
+	var (
+		best         []Requirement
+		bestScopeLen = -1
+	)
+	for scope, requirements := range p.Transports["docker"] {
+		matches := scope == "" || name == scope || strings.HasPrefix(name, scope+"/")
+		if matches && len(scope) > bestScopeLen {
+			best, bestScopeLen = requirements, len(scope)
+		}
+	}
+	if bestScopeLen < 0 {
+		return p.Default
+	}
+	return best
+}
+
+// Verdict returns how the policy treats the image
+func (p *Policy) Verdict(image string) Verdict {
+	requirements := p.Requirements(image)
+	verdict := VerdictUnverified
+	for _, requirement := range requirements {
+		switch requirement.Type {
+		case requirementReject:
+			return VerdictRejected
+		case requirementInsecureAcceptAnything:
+		default:
+			verdict = VerdictVerified
+		}
+	}
+	if len(requirements) == 0 {
+		// An empty requirement list is rejected by the policy evaluation
+		return VerdictRejected
+	}
+	return verdict
+}
@@ -0,0 +1,30 @@
+package image_policy
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestImagePolicy(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ImagePolicy Suite")
+}
+
+var _ = Describe("Signature policy", func() {
+	policy, err := Parse([]byte(`{
+		"default": [{"type": "insecureAcceptAnything"}],
+		"transports": {"docker": {
+			"quay.io/edge-infrastructure": [{"type": "sigstoreSigned"}],
+			"quay.io/edge-infrastructure/untrusted": [{"type": "reject"}]
+		}}
+	}`))
+
+	It("Uses the most specific scope", func() {
+		Expect(err).ToNot(HaveOccurred())
+		Expect(policy.Verdict("quay.io/edge-infrastructure/recert:latest")).To(Equal(VerdictVerified))
+		Expect(policy.Verdict("quay.io/edge-infrastructure/untrusted@sha256:abc")).To(Equal(VerdictRejected))
+		Expect(policy.Verdict("quay.io/openshift/etcd:4.14")).To(Equal(VerdictUnverified))
+	})
+})
@@ -0,0 +1,286 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node_network
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/ops"
+)
+
+const (
+	// HintFile holds the KUBELET_NODEIP_HINT nodeip-configuration selects the node IP with, relative to the root
+	HintFile = "etc/default/nodeip-configuration"
+	// KubeletDropIn is the kubelet drop-in nodeip-configuration writes the node IPs to, relative to the root
+	KubeletDropIn = "etc/systemd/system/kubelet.service.d/20-nodenet.conf"
+	// CrioDropIn is the CRI-O drop-in nodeip-configuration writes the stream address to, relative to the root
+	CrioDropIn = "etc/systemd/system/crio.service.d/20-nodenet.conf"
+	// BridgeHintFile holds the NIC configure-ovs attaches to br-ex, relative to the root
+	BridgeHintFile = "var/lib/ovnk/iface_default_hint"
+
+	// primaryIPFile holds the IP nodeip-configuration selected on the last boot, relative to the root
+	primaryIPFile = "run/nodeip-configuration/primary-ip"
+)
+
+// GeneratedFiles are the files nodeip-configuration and configure-ovs write for the node network, relative to the root
+var GeneratedFiles = []string{HintFile, KubeletDropIn, CrioDropIn, BridgeHintFile}
+
+// State is the outcome of the node IP selection of a host
+type State struct {
+	// NodeIPs are the kubelet --node-ip addresses, per the nodeip-configuration kubelet drop-in
+	NodeIPs []string `json:"nodeIPs,omitempty"`
+	// PrimaryIP is the IP nodeip-configuration selected on the last boot
+	PrimaryIP string `json:"primaryIP,omitempty"`
+	// Hint is the IP whose subnet the node IP is selected in, the default route interface one without
+	Hint string `json:"hint,omitempty"`
+	// PrimaryInterface is the interface of the default route, br-ex with OVN-Kubernetes
+	PrimaryInterface string `json:"primaryInterface,omitempty"`
+	// BridgeInterface is the NIC configure-ovs attached to br-ex, per its default interface hint
+	BridgeInterface string `json:"bridgeInterface,omitempty"`
+	// Interfaces are the host interfaces with their addresses
+	Interfaces []Interface `json:"interfaces"`
+}
+
+// Interface is a host network interface
+type Interface struct {
+	Name string `json:"name"`
+	MAC  string `json:"mac,omitempty"`
+	// Addresses are the global addresses of the interface, in CIDR notation
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// Capture reads the node IP selection of the host whose filesystem is mounted at root, and its interfaces
+func Capture(op ops.Ops, root string) (*State, error) {
+	state := &State{}
+	var err error
+	if state.Hint, err = readEnv(filepath.Join(root, HintFile), "KUBELET_NODEIP_HINT"); err != nil {
+		return nil, err
+	}
+	if state.NodeIPs, err = readNodeIPs(filepath.Join(root, KubeletDropIn)); err != nil {
+		return nil, err
+	}
+	if state.PrimaryIP, err = readTrimmed(filepath.Join(root, primaryIPFile)); err != nil {
+		return nil, err
+	}
+	if state.BridgeInterface, err = readTrimmed(filepath.Join(root, BridgeHintFile)); err != nil {
+		return nil, err
+	}
+
+	addresses, err := op.RunInHostNamespace("ip", "-j", "address", "show")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list the network interfaces")
+	}
+	if state.Interfaces, err = parseInterfaces([]byte(addresses)); err != nil {
+		return nil, err
+	}
+	routes, err := op.RunInHostNamespace("ip", "-j", "route", "show", "default")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list the default routes")
+	}
+	if state.PrimaryInterface, err = parseDefaultRoute([]byte(routes)); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// readTrimmed reads a single value file, empty when missing
+func readTrimmed(file string) (string, error) {
+	content, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to read %s", file)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// readEnv reads a variable of an environment file, empty when the file or the variable is missing
+func readEnv(file, name string) (string, error) {
+	content, err := readTrimmed(file)
+	if err != nil {
+		return "", err
+	}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if found && key == name {
+			return strings.Trim(strings.TrimSpace(value), `"`), nil
+		}
+	}
+	return "", nil
+}
+
+// readNodeIPs reads the node IPs of the kubelet drop-in, whose Environment sets KUBELET_NODE_IP and,
+// for dual-stack nodes, KUBELET_NODE_IPS
+func readNodeIPs(file string) ([]string, error) {
+	content, err := readTrimmed(file)
+	if err != nil {
+		return nil, err
+	}
+	var nodeIP, nodeIPs string
+	for _, field := range strings.Fields(content) {
+		key, value, found := strings.Cut(strings.Trim(strings.TrimPrefix(field, "Environment="), `"`), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "KUBELET_NODE_IP":
+			nodeIP = value
+		case "KUBELET_NODE_IPS":
+			nodeIPs = value
+		}
+	}
+	if nodeIPs != "" {
+		return strings.Split(nodeIPs, ","), nil
+	}
+	if nodeIP != "" {
+		return []string{nodeIP}, nil
+	}
+	return nil, nil
+}
+
+// parseInterfaces parses the interfaces listed by ip -j address show, keeping their global addresses
+func parseInterfaces(data []byte) ([]Interface, error) {
+	var listed []struct {
+		Name     string `json:"ifname"`
+		MAC      string `json:"address"`
+		AddrInfo []struct {
+			Local     string `json:"local"`
+			PrefixLen int    `json:"prefixlen"`
+			Scope     string `json:"scope"`
+		} `json:"addr_info"`
+	}
+	if err := json.Unmarshal(data, &listed); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse the network interfaces")
+	}
+	interfaces := make([]Interface, 0, len(listed))
+	for _, link := range listed {
+		iface := Interface{Name: link.Name, MAC: link.MAC}
+		for _, addr := range link.AddrInfo {
+			if addr.Scope == "global" {
+				iface.Addresses = append(iface.Addresses, addr.Local+"/"+strconv.Itoa(addr.PrefixLen))
+			}
+		}
+		interfaces = append(interfaces, iface)
+	}
+	return interfaces, nil
+}
+
+// parseDefaultRoute returns the interface of the first default route listed by ip -j route show default
+func parseDefaultRoute(data []byte) (string, error) {
+	var routes []struct {
+		Dev string `json:"dev"`
+	}
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return "", errors.Wrap(err, "Failed to parse the default routes")
+	}
+	if len(routes) == 0 {
+		return "", nil
+	}
+	return routes[0].Dev, nil
+}
+
+// SelectNodeIP selects the node IP among the host addresses like nodeip-configuration does: the address
+// in the subnet of the hint, or the first address of the default route interface without hint
+func SelectNodeIP(state *State) (string, error) {
+	if state.Hint != "" {
+		hint := net.ParseIP(state.Hint)
+		if hint == nil {
+			return "", errors.Errorf("Invalid node IP hint %q", state.Hint)
+		}
+		for _, iface := range state.Interfaces {
+			for _, address := range iface.Addresses {
+				ip, subnet, err := net.ParseCIDR(address)
+				if err == nil && subnet.Contains(hint) {
+					return ip.String(), nil
+				}
+			}
+		}
+		return "", errors.Errorf("No address in the subnet of the node IP hint %s", state.Hint)
+	}
+
+	for _, iface := range state.Interfaces {
+		if iface.Name != state.PrimaryInterface {
+			continue
+		}
+		for _, address := range iface.Addresses {
+			if ip, _, err := net.ParseCIDR(address); err == nil {
+				return ip.String(), nil
+			}
+		}
+	}
+	return "", errors.Errorf("No address on the default route interface %q", state.PrimaryInterface)
+}
+
+// Plan is what the restore has to do for the kubelet of the restored node to register with a target IP
+type Plan struct {
+	// NodeIP is the IP the target selects, the restored kubelet registers with it
+	NodeIP string
+	// Files are the GeneratedFiles of the seed the target ones replace in the restored stateroot
+	Files []string
+	// Removed are the GeneratedFiles of the seed removed for nodeip-configuration to write them on first boot
+	Removed []string
+	// Discrepancies are the differences that don't fail the restore
+	Discrepancies []string
+}
+
+// Compare selects the node IP on the target hardware and lists the seed node network files that would
+// make the restored kubelet register with a stale IP, or configure-ovs attach a missing NIC
+func Compare(seed, target *State) (*Plan, error) {
+	nodeIP, err := SelectNodeIP(target)
+	if err != nil {
+		return nil, errors.Wrap(err, "No node IP can be selected on the target")
+	}
+	plan := &Plan{NodeIP: nodeIP}
+	if len(target.NodeIPs) > 0 && target.NodeIPs[0] != nodeIP {
+		plan.Discrepancies = append(plan.Discrepancies, "the target kubelet runs with node IP "+target.NodeIPs[0]+
+			" but "+nodeIP+" is selected")
+	}
+
+	if strings.Join(seed.NodeIPs, ",") != strings.Join(target.NodeIPs, ",") {
+		plan.Discrepancies = append(plan.Discrepancies, "the seed kubelet node IP "+strings.Join(seed.NodeIPs, ",")+
+			" is replaced by the target "+strings.Join(target.NodeIPs, ","))
+		plan.Files = append(plan.Files, KubeletDropIn, CrioDropIn)
+	}
+	if seed.Hint != target.Hint {
+		plan.Discrepancies = append(plan.Discrepancies, "the node IP hint changes from "+quoted(seed.Hint)+" to "+quoted(target.Hint))
+		plan.Files = append(plan.Files, HintFile)
+	}
+	if seed.BridgeInterface != target.BridgeInterface {
+		plan.Discrepancies = append(plan.Discrepancies, "the br-ex interface changes from "+quoted(seed.BridgeInterface)+
+			" to "+quoted(target.BridgeInterface))
+		plan.Files = append(plan.Files, BridgeHintFile)
+	}
+	return plan, nil
+}
+
+// quoted quotes a value of the node network, which may be unset
+func quoted(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return strconv.Quote(value)
+}
@@ -0,0 +1,89 @@
+package node_network
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"ibu-imager/internal/ops"
+)
+
+func TestNodeNetwork(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Node Network Suite")
+}
+
+var _ = Describe("Node network", func() {
+	var root string
+
+	BeforeEach(func() {
+		root, _ = os.MkdirTemp("", "test")
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(root)).To(Succeed())
+	})
+
+	writeFile := func(name, content string) {
+		Expect(os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, name), []byte(content), 0644)).To(Succeed())
+	}
+
+	It("Captures the node IP selection and the interfaces", func() {
+		writeFile(HintFile, "KUBELET_NODEIP_HINT=192.168.122.0\n")
+		writeFile(KubeletDropIn, "[Service]\nEnvironment=\"KUBELET_NODE_IP=192.168.122.10\" \"KUBELET_NODE_IPS=192.168.122.10,fd00::10\"\n")
+		writeFile(primaryIPFile, "192.168.122.10\n")
+		writeFile(BridgeHintFile, "ens3\n")
+
+		ctrl := gomock.NewController(GinkgoT())
+		opsMock := ops.NewMockOps(ctrl)
+		opsMock.EXPECT().RunInHostNamespace("ip", "-j", "address", "show").Return(`[
+			{"ifname": "lo", "address": "00:00:00:00:00:00", "addr_info": [{"local": "127.0.0.1", "prefixlen": 8, "scope": "host"}]},
+			{"ifname": "ens3", "address": "52:54:00:aa:bb:cc", "addr_info": []},
+			{"ifname": "br-ex", "address": "52:54:00:aa:bb:cc", "addr_info": [
+				{"local": "192.168.122.10", "prefixlen": 24, "scope": "global"},
+				{"local": "fe80::1", "prefixlen": 64, "scope": "link"}]}]`, nil)
+		opsMock.EXPECT().RunInHostNamespace("ip", "-j", "route", "show", "default").Return(`[{"dst": "default", "gateway": "192.168.122.1", "dev": "br-ex"}]`, nil)
+
+		state, err := Capture(opsMock, root)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state.Hint).To(Equal("192.168.122.0"))
+		Expect(state.NodeIPs).To(Equal([]string{"192.168.122.10", "fd00::10"}))
+		Expect(state.PrimaryIP).To(Equal("192.168.122.10"))
+		Expect(state.PrimaryInterface).To(Equal("br-ex"))
+		Expect(state.BridgeInterface).To(Equal("ens3"))
+		Expect(state.Interfaces).To(HaveLen(3))
+		Expect(state.Interfaces[2].Addresses).To(Equal([]string{"192.168.122.10/24"}))
+	})
+
+	It("Selects the node IP like nodeip-configuration", func() {
+		interfaces := []Interface{
+			{Name: "eno1", Addresses: []string{"10.0.0.5/24"}},
+			{Name: "br-ex", Addresses: []string{"192.168.122.20/24"}},
+		}
+		Expect(SelectNodeIP(&State{PrimaryInterface: "br-ex", Interfaces: interfaces})).To(Equal("192.168.122.20"))
+		Expect(SelectNodeIP(&State{Hint: "10.0.0.0", PrimaryInterface: "br-ex", Interfaces: interfaces})).To(Equal("10.0.0.5"))
+		_, err := SelectNodeIP(&State{Hint: "172.16.0.0", Interfaces: interfaces})
+		Expect(err).To(MatchError(ContainSubstring("No address in the subnet")))
+	})
+
+	It("Replaces the seed files that would keep a stale node IP", func() {
+		seed := &State{NodeIPs: []string{"192.168.122.10"}, BridgeInterface: "ens3"}
+		target := &State{NodeIPs: []string{"192.168.122.20"}, BridgeInterface: "eno1", PrimaryInterface: "br-ex",
+			Interfaces: []Interface{{Name: "br-ex", Addresses: []string{"192.168.122.20/24"}}}}
+		plan, err := Compare(seed, target)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(plan.NodeIP).To(Equal("192.168.122.20"))
+		Expect(plan.Files).To(Equal([]string{KubeletDropIn, CrioDropIn, BridgeHintFile}))
+
+		plan, err = Compare(target, target)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(plan.Files).To(BeEmpty())
+
+		_, err = Compare(seed, &State{PrimaryInterface: "br-ex"})
+		Expect(err).To(MatchError(ContainSubstring("No node IP can be selected")))
+	})
+})
@@ -0,0 +1,156 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	seed "ibu-imager/internal/seed_creator"
+)
+
+const (
+	// httpTimeout is the timeout of the notification HTTP requests
+	httpTimeout = 30 * time.Second
+)
+
+// Notifier sends the report of a finished run somewhere
+type Notifier interface {
+	Notify(report *seed.RunReport) error
+}
+
+// Config holds the notification targets
+type Config struct {
+	// WebhookURLs receive the report as a JSON POST
+	WebhookURLs []string
+	// SlackURLs are Slack incoming webhooks receiving a short summary message
+	SlackURLs []string
+	// EmailTo are the recipients of the report email
+	EmailTo []string
+	// SMTPServer is the host:port of the SMTP relay used for emails
+	SMTPServer string
+	// EmailFrom is the sender of the report email
+	EmailFrom string
+}
+
+// NewNotifiers returns the notifiers matching the configuration
+func NewNotifiers(config Config) ([]Notifier, error) {
+	client := &http.Client{Timeout: httpTimeout}
+
+	var notifiers []Notifier
+	for _, url := range config.WebhookURLs {
+		notifiers = append(notifiers, &webhookNotifier{client: client, url: url})
+	}
+	for _, url := range config.SlackURLs {
+		notifiers = append(notifiers, &slackNotifier{client: client, url: url})
+	}
+	if len(config.EmailTo) > 0 {
+		if config.SMTPServer == "" || config.EmailFrom == "" {
+			return nil, errors.New("email notifications require an SMTP server and a sender address")
+		}
+		notifiers = append(notifiers, &emailNotifier{server: config.SMTPServer, from: config.EmailFrom, to: config.EmailTo})
+	}
+	return notifiers, nil
+}
+
+// NotifyAll sends the report to all notifiers. Notification failures are logged, but never fail the run.
+func NotifyAll(log *logrus.Logger, notifiers []Notifier, report *seed.RunReport) {
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(report); err != nil {
+			log.Warnf("Failed to send notification: %v", err)
+		}
+	}
+}
+
+// Summary returns a one-line human-readable summary of the report
+func Summary(report *seed.RunReport) string {
+	summary := fmt.Sprintf("Seed image %s creation %s after %s", report.Image, strings.ToLower(report.Result),
+		report.FinishedAt.Sub(report.StartedAt).Round(time.Second))
+	if report.Error != "" {
+		summary += ": " + report.Error
+	}
+	if len(report.Pushes) > 1 {
+		pushes := make([]string, 0, len(report.Pushes))
+		for _, push := range report.Pushes {
+			status := "pushed"
+			if push.Error != "" {
+				status = "failed"
+			}
+			pushes = append(pushes, push.Image+" "+status)
+		}
+		summary += " (" + strings.Join(pushes, ", ") + ")"
+	}
+	return summary
+}
+
+type webhookNotifier struct {
+	client *http.Client
+	url    string
+}
+
+func (w *webhookNotifier) Notify(report *seed.RunReport) error {
+	return postJSON(w.client, w.url, report)
+}
+
+type slackNotifier struct {
+	client *http.Client
+	url    string
+}
+
+func (s *slackNotifier) Notify(report *seed.RunReport) error {
+	return postJSON(s.client, s.url, map[string]string{"text": Summary(report)})
+}
+
+type emailNotifier struct {
+	server string
+	from   string
+	to     []string
+}
+
+func (e *emailNotifier) Notify(report *seed.RunReport) error {
+	body, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal report")
+	}
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: [ibu-imager] %s\r\n\r\n%s\r\n",
+		e.from, strings.Join(e.to, ", "), Summary(report), body)
+	return errors.Wrap(smtp.SendMail(e.server, nil, e.from, e.to, []byte(message)), "Failed to send email")
+}
+
+func postJSON(client *http.Client, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal notification payload")
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to post notification to %s", url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.Errorf("Notification to %s failed with status %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	seed "ibu-imager/internal/seed_creator"
+)
+
+func TestNotify(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Notify Suite")
+}
+
+var _ = Describe("Notifications", func() {
+	var (
+		server      *httptest.Server
+		status      int
+		contentType string
+		payload     []byte
+		report      *seed.RunReport
+	)
+
+	BeforeEach(func() {
+		status = http.StatusOK
+		payload = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentType = r.Header.Get("Content-Type")
+			payload, _ = io.ReadAll(r.Body)
+			w.WriteHeader(status)
+		}))
+		startedAt := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+		report = &seed.RunReport{Image: "quay.io/org/seed:oneimage", NodeRole: seed.NodeRoleMaster, Result: "Failed",
+			Error: "Failed to push", StartedAt: startedAt, FinishedAt: startedAt.Add(90 * time.Second)}
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("Posts the report to the webhooks", func() {
+		notifiers, err := NewNotifiers(Config{WebhookURLs: []string{server.URL}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(notifiers).To(HaveLen(1))
+		Expect(notifiers[0].Notify(report)).To(Succeed())
+
+		Expect(contentType).To(Equal("application/json"))
+		var posted seed.RunReport
+		Expect(json.Unmarshal(payload, &posted)).To(Succeed())
+		Expect(posted).To(Equal(*report))
+	})
+
+	It("Posts the summary to Slack", func() {
+		notifiers, err := NewNotifiers(Config{SlackURLs: []string{server.URL}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(notifiers[0].Notify(report)).To(Succeed())
+		Expect(string(payload)).To(MatchJSON(`{"text": "Seed image quay.io/org/seed:oneimage creation failed after 1m30s: Failed to push"}`))
+	})
+
+	It("Fails on the error statuses and unreachable webhooks", func() {
+		status = http.StatusInternalServerError
+		notifiers, err := NewNotifiers(Config{WebhookURLs: []string{server.URL}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(notifiers[0].Notify(report)).To(MatchError(ContainSubstring("failed with status 500 Internal Server Error")))
+
+		server.Close()
+		Expect(notifiers[0].Notify(report)).To(MatchError(ContainSubstring("Failed to post notification to " + server.URL)))
+	})
+
+	It("Logs the failed notifications without stopping at them", func() {
+		status = http.StatusBadGateway
+		var output bytes.Buffer
+		log := logrus.New()
+		log.SetOutput(&output)
+		notifiers, err := NewNotifiers(Config{WebhookURLs: []string{server.URL, server.URL}})
+		Expect(err).ToNot(HaveOccurred())
+
+		NotifyAll(log, notifiers, report)
+		Expect(bytes.Count(output.Bytes(), []byte("Failed to send notification"))).To(Equal(2))
+	})
+
+	It("Requires an SMTP server and a sender for emails", func() {
+		_, err := NewNotifiers(Config{EmailTo: []string{"ops@example.com"}})
+		Expect(err).To(MatchError(ContainSubstring("require an SMTP server")))
+	})
+})
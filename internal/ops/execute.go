@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -12,15 +13,24 @@ import (
 //go:generate mockgen -source=execute.go -package=ops -destination=mock_execute.go
 type Execute interface {
 	Execute(command string, args ...string) (string, error)
+	ExecuteStream(command string, args ...string) (*Stream, error)
 }
 
 type executor struct {
 	verbose bool
 	log     *logrus.Logger
+	// heartbeat is how often a still running command is logged, never when 0
+	heartbeat time.Duration
 }
 
 func NewExecutor(logger *logrus.Logger, verbose bool) Execute {
-	return &executor{log: logger, verbose: verbose}
+	return NewExecutorWithHeartbeat(logger, verbose, DefaultHeartbeatInterval)
+}
+
+// NewExecutorWithHeartbeat creates an executor logging the commands running longer than the heartbeat
+// interval every interval, a zero interval disabling it
+func NewExecutorWithHeartbeat(logger *logrus.Logger, verbose bool, heartbeat time.Duration) Execute {
+	return &executor{log: logger, verbose: verbose, heartbeat: heartbeat}
 }
 
 func (e *executor) Execute(command string, args ...string) (string, error) {
@@ -29,6 +39,32 @@ func (e *executor) Execute(command string, args ...string) (string, error) {
 	var stdoutBytes, stderrBytes bytes.Buffer
 	cmd.Stdout = &stdoutBytes
 	cmd.Stderr = &stderrBytes
-	err := cmd.Run()
+	if err := cmd.Start(); err != nil {
+		return "", errors.Wrap(err, stderrBytes.String())
+	}
+	stop := heartbeat(e.log, e.heartbeat, cmd.Process.Pid, command, args)
+	err := cmd.Wait()
+	stop()
 	return strings.TrimSpace(stdoutBytes.String()), errors.Wrap(err, stderrBytes.String())
 }
+
+func (e *executor) ExecuteStream(command string, args ...string) (*Stream, error) {
+	e.log.Println("Executing ", command, args)
+	cmd := exec.Command(command, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create stdout pipe")
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create stderr pipe")
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "Failed to start %s", command)
+	}
+	stop := heartbeat(e.log, e.heartbeat, cmd.Process.Pid, command, args)
+	return NewStream(stdout, stderr, func() error {
+		defer stop()
+		return cmd.Wait()
+	}), nil
+}
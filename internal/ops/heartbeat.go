@@ -0,0 +1,160 @@
+package ops
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultHeartbeatInterval is how often a still running host command is logged, so the operators
+// watching the journal can tell slow progress from a hang
+const DefaultHeartbeatInterval = time.Minute
+
+// procDir is where the kernel exposes the processes, the I/O counters of the command are read there
+var procDir = "/proc"
+
+// heartbeat logs the command every interval until stopped, with the bytes it read and wrote so far when
+// its process tree can be measured
+func heartbeat(log *logrus.Logger, interval time.Duration, pid int, command string, args []string) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		start := time.Now()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				message := fmt.Sprintf("Still running %s after %s", displayCommand(command, args),
+					time.Since(start).Round(time.Second))
+				if read, written, ok := treeIO(pid); ok {
+					message += fmt.Sprintf(" (read %s, written %s)", FormatBytes(read), FormatBytes(written))
+				}
+				log.Info(message)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// displayCommand returns the command line logged by the heartbeat, without the nsenter arguments
+func displayCommand(command string, args []string) string {
+	if command == "nsenter" {
+		for i, arg := range args {
+			if arg == "--" {
+				command, args = args[i+1], args[i+2:]
+				break
+			}
+		}
+	}
+	line := strings.Join(append([]string{command}, args...), " ")
+	if len(line) > 120 {
+		line = line[:117] + "..."
+	}
+	return line
+}
+
+// treeIO returns the bytes read and written by the live processes of the process tree of pid, e.g.
+// the tar and gzip processes nsenter runs. It returns false when the counters can't be read.
+func treeIO(pid int) (uint64, uint64, bool) {
+	read, written, ok := processIO(pid)
+	if !ok {
+		return 0, 0, false
+	}
+	for _, child := range childPIDs(pid) {
+		if childRead, childWritten, ok := treeIO(child); ok {
+			read, written = read+childRead, written+childWritten
+		}
+	}
+	return read, written, true
+}
+
+// childPIDs returns the live child processes of the threads of pid
+func childPIDs(pid int) []int {
+	var children []int
+	tasks, _ := filepath.Glob(filepath.Join(procDir, strconv.Itoa(pid), "task", "*", "children"))
+	for _, task := range tasks {
+		data, err := os.ReadFile(task)
+		if err != nil {
+			continue
+		}
+		for _, field := range strings.Fields(string(data)) {
+			if child, err := strconv.Atoi(field); err == nil {
+				children = append(children, child)
+			}
+		}
+	}
+	return children
+}
+
+// TerminateCommands sends SIGTERM to the process trees of the host commands the imager is running, e.g.
+// the tar and gzip processes nsenter runs, which nsenter doesn't forward signals to. It returns the number
+// of processes signaled.
+func TerminateCommands() int {
+	var pids []int
+	descendants := childPIDs(os.Getpid())
+	for len(descendants) > 0 {
+		pid := descendants[0]
+		descendants = append(descendants[1:], childPIDs(pid)...)
+		pids = append(pids, pid)
+	}
+	// The tree is listed before signaling it, the children of a terminated nsenter are reparented
+	for _, pid := range pids {
+		_ = syscall.Kill(pid, syscall.SIGTERM)
+	}
+	return len(pids)
+}
+
+// processIO returns the rchar and wchar counters of the process
+func processIO(pid int) (uint64, uint64, bool) {
+	data, err := os.ReadFile(filepath.Join(procDir, strconv.Itoa(pid), "io"))
+	if err != nil {
+		return 0, 0, false
+	}
+	var read, written uint64
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		counter, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "rchar":
+			read = counter
+		case "wchar":
+			written = counter
+		}
+	}
+	return read, written, true
+}
+
+// FormatBytes formats a byte count with a binary unit
+func FormatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for value := n / unit; value >= unit; value /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
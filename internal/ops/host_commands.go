@@ -0,0 +1,66 @@
+package ops
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// exitCommandNotFound is the exit code of nsenter and bash when the command isn't installed
+const exitCommandNotFound = 127
+
+// commandNotFoundPattern matches the bash and sudo report of a missing command, e.g. "bash: line 1: jq: command not found"
+var commandNotFoundPattern = regexp.MustCompile(`([^\s:]+): command not found`)
+
+// CommandNotFoundError is a host command that failed because it, or a command of its bash command line,
+// isn't installed on the host
+type CommandNotFoundError struct {
+	Command string
+	Err     error
+}
+
+func (e *CommandNotFoundError) Error() string {
+	return fmt.Sprintf("%s isn't installed on the host: %v", e.Command, e.Err)
+}
+
+func (e *CommandNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// IsCommandNotFound tells whether the host command failed because a command isn't installed on the host
+func IsCommandNotFound(err error) bool {
+	var notFound *CommandNotFoundError
+	return errors.As(err, &notFound)
+}
+
+// commandNotFound turns the failure of a host command into a CommandNotFoundError naming the missing
+// command, instead of a bare exit status 127. The other exit statuses are kept, whatever the command
+// reported, e.g. a script printing the "command not found" of a command it handled itself.
+func commandNotFound(command string, err error) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != exitCommandNotFound {
+		return err
+	}
+	if match := commandNotFoundPattern.FindStringSubmatch(err.Error()); match != nil {
+		return &CommandNotFoundError{Command: match[1], Err: err}
+	}
+	// bash exits with 127 for the scripts it runs too, it's only trusted with its report of the missing command
+	if command != "bash" {
+		return &CommandNotFoundError{Command: command, Err: err}
+	}
+	return err
+}
+
+// MissingCommands returns the commands that aren't installed on the host, detected with the bash command
+// builtin so minimal hosts are reported before a step fails on them
+func MissingCommands(op Ops, commands ...string) ([]string, error) {
+	output, err := op.RunBashInHostNamespace("for", "tool", "in", strings.Join(commands, " "), ";", "do",
+		"command", "-v", `"$tool"`, ">", "/dev/null", "||", "echo", `"$tool"`, ";", "done")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to detect the host commands")
+	}
+	return strings.Fields(output), nil
+}
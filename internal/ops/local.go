@@ -0,0 +1,49 @@
+package ops
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type localOps struct {
+	log      *logrus.Logger
+	executor Execute
+}
+
+// NewLocalOps returns an Ops running the host commands in the imager's own namespaces instead of entering
+// the host ones, for hosts the imager sees as its root, e.g. the fake host of the simulate command
+func NewLocalOps(log *logrus.Logger, executor Execute) Ops {
+	return &localOps{log: log, executor: executor}
+}
+
+func (o *localOps) SystemctlAction(action string, args ...string) (string, error) {
+	o.log.Infof("Running systemctl %s %s", action, args)
+	output, err := o.RunInHostNamespace("systemctl", append([]string{action}, args...)...)
+	if err != nil {
+		err = errors.Wrapf(err, "Failed executing systemctl %s %s", action, args)
+	}
+	return output, err
+}
+
+// RunInHostNamespace execute a command in the imager namespaces
+func (o *localOps) RunInHostNamespace(command string, args ...string) (string, error) {
+	output, err := o.executor.Execute(command, args...)
+	return output, commandNotFound(command, err)
+}
+
+// RunInHostNamespaceStream execute a command in the imager namespaces, streaming its output
+func (o *localOps) RunInHostNamespaceStream(command string, args ...string) (*Stream, error) {
+	return o.executor.ExecuteStream(command, args...)
+}
+
+func (o *localOps) RunBashInHostNamespace(command string, args ...string) (string, error) {
+	args = append([]string{command}, args...)
+	return o.RunInHostNamespace("bash", "-c", strings.Join(args, " "))
+}
+
+func (o *localOps) RunBashInHostNamespaceStream(command string, args ...string) (*Stream, error) {
+	args = append([]string{command}, args...)
+	return o.RunInHostNamespaceStream("bash", "-c", strings.Join(args, " "))
+}
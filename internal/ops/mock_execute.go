@@ -52,3 +52,23 @@ func (mr *MockExecuteMockRecorder) Execute(command interface{}, args ...interfac
 	varargs := append([]interface{}{command}, args...)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Execute", reflect.TypeOf((*MockExecute)(nil).Execute), varargs...)
 }
+
+// ExecuteStream mocks base method.
+func (m *MockExecute) ExecuteStream(command string, args ...string) (*Stream, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{command}
+	for _, a := range args {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ExecuteStream", varargs...)
+	ret0, _ := ret[0].(*Stream)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExecuteStream indicates an expected call of ExecuteStream.
+func (mr *MockExecuteMockRecorder) ExecuteStream(command interface{}, args ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{command}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecuteStream", reflect.TypeOf((*MockExecute)(nil).ExecuteStream), varargs...)
+}
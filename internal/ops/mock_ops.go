@@ -53,6 +53,26 @@ func (mr *MockOpsMockRecorder) RunBashInHostNamespace(command interface{}, args
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunBashInHostNamespace", reflect.TypeOf((*MockOps)(nil).RunBashInHostNamespace), varargs...)
 }
 
+// RunBashInHostNamespaceStream mocks base method.
+func (m *MockOps) RunBashInHostNamespaceStream(command string, args ...string) (*Stream, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{command}
+	for _, a := range args {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "RunBashInHostNamespaceStream", varargs...)
+	ret0, _ := ret[0].(*Stream)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RunBashInHostNamespaceStream indicates an expected call of RunBashInHostNamespaceStream.
+func (mr *MockOpsMockRecorder) RunBashInHostNamespaceStream(command interface{}, args ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{command}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunBashInHostNamespaceStream", reflect.TypeOf((*MockOps)(nil).RunBashInHostNamespaceStream), varargs...)
+}
+
 // RunInHostNamespace mocks base method.
 func (m *MockOps) RunInHostNamespace(command string, args ...string) (string, error) {
 	m.ctrl.T.Helper()
@@ -73,6 +93,26 @@ func (mr *MockOpsMockRecorder) RunInHostNamespace(command interface{}, args ...i
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunInHostNamespace", reflect.TypeOf((*MockOps)(nil).RunInHostNamespace), varargs...)
 }
 
+// RunInHostNamespaceStream mocks base method.
+func (m *MockOps) RunInHostNamespaceStream(command string, args ...string) (*Stream, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{command}
+	for _, a := range args {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "RunInHostNamespaceStream", varargs...)
+	ret0, _ := ret[0].(*Stream)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RunInHostNamespaceStream indicates an expected call of RunInHostNamespaceStream.
+func (mr *MockOpsMockRecorder) RunInHostNamespaceStream(command interface{}, args ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{command}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunInHostNamespaceStream", reflect.TypeOf((*MockOps)(nil).RunInHostNamespaceStream), varargs...)
+}
+
 // SystemctlAction mocks base method.
 func (m *MockOps) SystemctlAction(action string, args ...string) (string, error) {
 	m.ctrl.T.Helper()
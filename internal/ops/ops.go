@@ -12,6 +12,8 @@ type Ops interface {
 	SystemctlAction(action string, args ...string) (string, error)
 	RunInHostNamespace(command string, args ...string) (string, error)
 	RunBashInHostNamespace(command string, args ...string) (string, error)
+	RunInHostNamespaceStream(command string, args ...string) (*Stream, error)
+	RunBashInHostNamespaceStream(command string, args ...string) (*Stream, error)
 }
 
 type ops struct {
@@ -34,10 +36,29 @@ func (o *ops) SystemctlAction(action string, args ...string) (string, error) {
 
 // RunInHostNamespace execute a command in the host environment via nsenter
 func (o *ops) RunInHostNamespace(command string, args ...string) (string, error) {
+	output, err := o.executor.Execute("nsenter", hostNamespaceArgs(command, args...)...)
+	return output, commandNotFound(command, err)
+}
+
+// RunInHostNamespaceStream execute a command in the host environment via nsenter, streaming its output
+func (o *ops) RunInHostNamespaceStream(command string, args ...string) (*Stream, error) {
+	return o.executor.ExecuteStream("nsenter", hostNamespaceArgs(command, args...)...)
+}
+
+func (o *ops) RunBashInHostNamespace(command string, args ...string) (string, error) {
+	args = append([]string{command}, args...)
+	return o.RunInHostNamespace("bash", "-c", strings.Join(args, " "))
+}
+
+func (o *ops) RunBashInHostNamespaceStream(command string, args ...string) (*Stream, error) {
+	args = append([]string{command}, args...)
+	return o.RunInHostNamespaceStream("bash", "-c", strings.Join(args, " "))
+}
+
+// hostNamespaceArgs returns the nsenter arguments running the command in the host namespaces
+func hostNamespaceArgs(command string, args ...string) []string {
 	// nsenter is used here to launch processes inside the container in a way that makes said processes feel
 	// and behave as if they're running on the host directly rather than inside the container
-	commandBase := "nsenter"
-
 	arguments := []string{
 		"--target", "1",
 		// Entering the cgroup namespace is not required for podman on CoreOS (where the
@@ -56,11 +77,5 @@ func (o *ops) RunInHostNamespace(command string, args ...string) (string, error)
 		command,
 	}
 
-	arguments = append(arguments, args...)
-	return o.executor.Execute(commandBase, arguments...)
-}
-
-func (o *ops) RunBashInHostNamespace(command string, args ...string) (string, error) {
-	args = append([]string{command}, args...)
-	return o.RunInHostNamespace("bash", "-c", strings.Join(args, " "))
+	return append(arguments, args...)
 }
@@ -0,0 +1,187 @@
+package ops
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestOps(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Ops Suite")
+}
+
+var _ = Describe("SSH ops", func() {
+	var (
+		ctrl         *gomock.Controller
+		executorMock *MockExecute
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		executorMock = NewMockExecute(ctrl)
+	})
+
+	It("Runs the quoted command on the remote node", func() {
+		op := NewSSHOps(logrus.New(), executorMock, SSHConfig{Host: "sno.example.com", User: "core", Port: 2222, KeyFile: "/key"})
+		executorMock.EXPECT().Execute("ssh", "-o", "BatchMode=yes", "-p", "2222", "-i", "/key", "-o", "IdentitiesOnly=yes",
+			"core@sno.example.com", "--", `sudo -n 'cat' '/etc/it'\''s'`).Return("content", nil)
+		Expect(op.RunInHostNamespace("cat", "/etc/it's")).To(Equal("content"))
+	})
+
+	It("Keeps bash commands as a single remote argument", func() {
+		op := NewSSHOps(logrus.New(), executorMock, SSHConfig{Host: "sno.example.com"})
+		executorMock.EXPECT().Execute("ssh", "-o", "BatchMode=yes", "sno.example.com", "--",
+			`'bash' '-c' 'du -sb /var > /tmp/du'`).Return("", nil)
+		_, err := op.RunBashInHostNamespace("du", "-sb", "/var", ">", "/tmp/du")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("Skips the host key check of throwaway hosts", func() {
+		op := NewSSHOps(logrus.New(), executorMock, SSHConfig{Host: "192.168.122.45", User: "root", SkipHostKeyCheck: true})
+		executorMock.EXPECT().Execute("ssh", "-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null",
+			"root@192.168.122.45", "--", `'true'`).Return("", nil)
+		_, err := op.RunInHostNamespace("true")
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
+
+var _ = Describe("Local ops", func() {
+	It("Runs the commands without entering the host namespaces", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		executorMock := NewMockExecute(ctrl)
+		op := NewLocalOps(logrus.New(), executorMock)
+		executorMock.EXPECT().Execute("bash", "-c", "crictl ps -q").Return("0f1e", nil)
+		Expect(op.RunBashInHostNamespace("crictl", "ps", "-q")).To(Equal("0f1e"))
+	})
+})
+
+var _ = Describe("Heartbeat", func() {
+	It("Logs the commands still running", func() {
+		var output bytes.Buffer
+		log := logrus.New()
+		log.SetOutput(&output)
+		_, err := NewExecutorWithHeartbeat(log, true, 50*time.Millisecond).Execute("sleep", "0.3")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(output.String()).To(ContainSubstring("Still running sleep 0.3 after"))
+	})
+
+	It("Sums the I/O of the process tree and hides the nsenter arguments", func() {
+		root, _ := os.MkdirTemp("", "test")
+		defer os.RemoveAll(root)
+		writeFile := func(name, content string) {
+			Expect(os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(root, name), []byte(content), 0644)).To(Succeed())
+		}
+		writeFile("100/io", "rchar: 1000\nwchar: 10\nsyscr: 5\n")
+		writeFile("100/task/100/children", "101 ")
+		writeFile("101/io", "rchar: 2000\nwchar: 2048\n")
+		procDir = root
+		defer func() { procDir = "/proc" }()
+
+		read, written, ok := treeIO(100)
+		Expect(ok).To(BeTrue())
+		Expect(read).To(Equal(uint64(3000)))
+		Expect(written).To(Equal(uint64(2058)))
+		Expect(FormatBytes(written)).To(Equal("2.0 KiB"))
+		_, _, ok = treeIO(200)
+		Expect(ok).To(BeFalse())
+
+		Expect(displayCommand("nsenter", hostNamespaceArgs("tar", "czf", "/var/tmp/backup/var.tgz"))).
+			To(Equal("tar czf /var/tmp/backup/var.tgz"))
+	})
+
+	It("Terminates the process trees of the running commands", func() {
+		cmd := exec.Command("sh", "-c", "sleep 10 & wait")
+		Expect(cmd.Start()).To(Succeed())
+		Eventually(func() []int { return childPIDs(cmd.Process.Pid) }).ShouldNot(BeEmpty())
+		Expect(TerminateCommands()).To(Equal(2))
+		Expect(cmd.Wait()).To(MatchError("signal: terminated"))
+	})
+})
+
+var _ = Describe("Host commands", func() {
+	var (
+		ctrl         *gomock.Controller
+		executorMock *MockExecute
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		executorMock = NewMockExecute(ctrl)
+	})
+
+	It("Names the command missing on the host", func() {
+		exitErr := exec.Command("sh", "-c", "exit 127").Run()
+		executorMock.EXPECT().Execute("nsenter", hostNamespaceArgs("jq", "-r", ".")).
+			Return("", errors.Wrap(exitErr, "nsenter: failed to execute jq: No such file or directory"))
+		_, err := NewOps(logrus.New(), executorMock).RunInHostNamespace("jq", "-r", ".")
+		Expect(IsCommandNotFound(err)).To(BeTrue())
+		Expect(err).To(MatchError(HavePrefix("jq isn't installed on the host")))
+
+		executorMock.EXPECT().Execute("nsenter", gomock.Any()).
+			Return("", errors.Wrap(exitErr, "bash: line 1: awk: command not found"))
+		_, err = NewOps(logrus.New(), executorMock).RunBashInHostNamespace("cat", "/etc/hosts", "|", "awk", "'{print $1}'")
+		Expect(err).To(MatchError(HavePrefix("awk isn't installed on the host")))
+	})
+
+	It("Keeps the other failures", func() {
+		executorMock.EXPECT().Execute("nsenter", gomock.Any()).
+			Return("", errors.Wrap(exec.Command("sh", "-c", "exit 127").Run(), "script failed"))
+		_, err := NewOps(logrus.New(), executorMock).RunBashInHostNamespace("exit", "127")
+		Expect(IsCommandNotFound(err)).To(BeFalse())
+
+		// Only the exit status 127 tells a missing command, not what the command printed
+		executorMock.EXPECT().Execute("nsenter", gomock.Any()).
+			Return("", errors.Wrap(exec.Command("sh", "-c", "exit 2").Run(), "grep: /boot/loader/entries/x.conf: command not found"))
+		_, err = NewOps(logrus.New(), executorMock).RunBashInHostNamespace("grep", "-H", "^options", "/boot/loader/entries/*.conf")
+		Expect(IsCommandNotFound(err)).To(BeFalse())
+	})
+
+	It("Detects the missing commands", func() {
+		executorMock.EXPECT().Execute("nsenter", hostNamespaceArgs("bash", "-c",
+			`for tool in jq awk xargs ; do command -v "$tool" > /dev/null || echo "$tool" ; done`)).Return("jq\nxargs", nil)
+		Expect(MissingCommands(NewOps(logrus.New(), executorMock), "jq", "awk", "xargs")).To(Equal([]string{"jq", "xargs"}))
+	})
+})
+
+var _ = Describe("Streams", func() {
+	It("Scans the lines longer than the default scanner buffer", func() {
+		long := strings.Repeat("a", 100*1024)
+		var lines []string
+		stream := NewStream(strings.NewReader(long+"\nlast\n"), strings.NewReader(""), func() error { return nil })
+		Expect(ScanStream(logrus.New(), stream, func(line string) { lines = append(lines, line) })).To(Succeed())
+		Expect(lines).To(Equal([]string{long, "last"}))
+	})
+
+	It("Drains the output after a line too long to scan, so the command doesn't block", func() {
+		stdout, writer := io.Pipe()
+		written := make(chan error, 1)
+		go func() {
+			_, err := writer.Write([]byte(strings.Repeat("a", maxLineSize+1) + "\n"))
+			if err == nil {
+				_, err = writer.Write([]byte("after\n"))
+			}
+			writer.Close()
+			written <- err
+		}()
+		stream := NewStream(stdout, strings.NewReader(""), func() error { return <-written })
+		Expect(ScanStream(logrus.New(), stream, func(string) {})).To(Succeed())
+	})
+
+	It("Carries the last stderr lines in the error", func() {
+		stream := NewStream(strings.NewReader(""), strings.NewReader("first\nsecond\n"), func() error { return errors.New("exit status 1") })
+		Expect(DrainStream(stream)).To(MatchError("first\nsecond: exit status 1"))
+	})
+})
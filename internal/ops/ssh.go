@@ -0,0 +1,103 @@
+package ops
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// SSHConfig is the remote node the host commands are run on, through the OpenSSH client. Keys are
+// taken from the SSH agent or the user's SSH config unless KeyFile is set.
+type SSHConfig struct {
+	// Host is the remote node address
+	Host string
+	// User is the remote user, the host commands run through passwordless sudo unless it's root
+	User string
+	// Port is the remote SSH port, the client default when 0
+	Port int
+	// KeyFile is the private key used to authenticate
+	KeyFile string
+	// SkipHostKeyCheck accepts any host key without recording it, only meant for throwaway hosts
+	SkipHostKeyCheck bool
+}
+
+// Enabled returns true if host commands run on a remote node
+func (c *SSHConfig) Enabled() bool {
+	return c.Host != ""
+}
+
+type sshOps struct {
+	log      *logrus.Logger
+	executor Execute
+	config   SSHConfig
+}
+
+// NewSSHOps returns an Ops running the host commands on a remote node over SSH instead of nsenter, e.g.
+// the rehearsal VM
+func NewSSHOps(log *logrus.Logger, executor Execute, config SSHConfig) Ops {
+	return &sshOps{log: log, executor: executor, config: config}
+}
+
+func (o *sshOps) SystemctlAction(action string, args ...string) (string, error) {
+	o.log.Infof("Running systemctl %s %s on %s", action, args, o.config.Host)
+	output, err := o.RunInHostNamespace("systemctl", append([]string{action}, args...)...)
+	if err != nil {
+		err = errors.Wrapf(err, "Failed executing systemctl %s %s", action, args)
+	}
+	return output, err
+}
+
+// RunInHostNamespace execute a command on the remote node, each argument quoted from the remote shell
+func (o *sshOps) RunInHostNamespace(command string, args ...string) (string, error) {
+	output, err := o.executor.Execute("ssh", o.sshArgs(shellQuote(append([]string{command}, args...)))...)
+	return output, commandNotFound(command, err)
+}
+
+// RunInHostNamespaceStream execute a command on the remote node, streaming its output
+func (o *sshOps) RunInHostNamespaceStream(command string, args ...string) (*Stream, error) {
+	return o.executor.ExecuteStream("ssh", o.sshArgs(shellQuote(append([]string{command}, args...)))...)
+}
+
+func (o *sshOps) RunBashInHostNamespace(command string, args ...string) (string, error) {
+	args = append([]string{command}, args...)
+	return o.RunInHostNamespace("bash", "-c", strings.Join(args, " "))
+}
+
+func (o *sshOps) RunBashInHostNamespaceStream(command string, args ...string) (*Stream, error) {
+	args = append([]string{command}, args...)
+	return o.RunInHostNamespaceStream("bash", "-c", strings.Join(args, " "))
+}
+
+// sshArgs returns the ssh client arguments running the remote command line
+func (o *sshOps) sshArgs(commandLine string) []string {
+	// BatchMode fails instead of prompting for passwords or host key confirmation
+	args := []string{"-o", "BatchMode=yes"}
+	if o.config.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(o.config.Port))
+	}
+	if o.config.KeyFile != "" {
+		args = append(args, "-i", o.config.KeyFile, "-o", "IdentitiesOnly=yes")
+	}
+	if o.config.SkipHostKeyCheck {
+		args = append(args, "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null")
+	}
+	destination := o.config.Host
+	if o.config.User != "" {
+		destination = o.config.User + "@" + destination
+	}
+	if o.config.User != "" && o.config.User != "root" {
+		commandLine = "sudo -n " + commandLine
+	}
+	return append(args, destination, "--", commandLine)
+}
+
+// shellQuote joins the words into a command line the remote shell splits back into the same words
+func shellQuote(words []string) string {
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		quoted = append(quoted, "'"+strings.ReplaceAll(word, "'", `'\''`)+"'")
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,91 @@
+package ops
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// stderrTailLines is the number of stderr lines kept to explain a failure
+	stderrTailLines = 20
+	// maxLineSize is the longest output line scanned, e.g. a JSON document on a single line
+	maxLineSize = 16 << 20
+)
+
+// Stream is a running command whose output is consumed while it runs. Both Stdout and Stderr
+// must be read until EOF before calling Wait.
+type Stream struct {
+	Stdout io.Reader
+	Stderr io.Reader
+	wait   func() error
+}
+
+// NewStream creates a stream out of the given readers and wait function, mostly meant for tests
+func NewStream(stdout, stderr io.Reader, wait func() error) *Stream {
+	return &Stream{Stdout: stdout, Stderr: stderr, wait: wait}
+}
+
+// Wait waits for the command to exit
+func (s *Stream) Wait() error {
+	return s.wait()
+}
+
+// LogStream logs every output line of the stream as it's produced and waits for the command
+// to exit. On failure, the error carries the last stderr lines.
+func LogStream(log *logrus.Logger, stream *Stream) error {
+	return ScanStream(log, stream, func(line string) { log.Info(line) })
+}
+
+// ScanStream calls onLine for every stdout line of the stream, logs the stderr lines and waits
+// for the command to exit. On failure, the error carries the last stderr lines.
+func ScanStream(log *logrus.Logger, stream *Stream, onLine func(line string)) error {
+	var (
+		wg   sync.WaitGroup
+		tail []string
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		scanLines(log, stream.Stdout, onLine)
+	}()
+	go func() {
+		defer wg.Done()
+		scanLines(log, stream.Stderr, func(line string) {
+			log.Info(line)
+			tail = append(tail, line)
+			if len(tail) > stderrTailLines {
+				tail = tail[1:]
+			}
+		})
+	}()
+	wg.Wait()
+
+	return errors.Wrap(stream.Wait(), strings.Join(tail, "\n"))
+}
+
+// scanLines calls onLine for every line of the reader. When a line can't be scanned, e.g. one longer than
+// maxLineSize, the rest of the output is drained so the command doesn't block writing it.
+func scanLines(log *logrus.Logger, reader io.Reader, onLine func(line string)) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		onLine(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		log.Warnf("Failed to read command output, discarding the rest: %v", err)
+		_, _ = io.Copy(io.Discard, reader)
+	}
+}
+
+// DrainStream waits for the command to exit without logging its output, e.g. when commands run
+// concurrently would interleave their output. On failure, the error carries the last stderr lines.
+func DrainStream(stream *Stream) error {
+	quiet := logrus.New()
+	quiet.SetOutput(io.Discard)
+	return ScanStream(quiet, stream, func(string) {})
+}
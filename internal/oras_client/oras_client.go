@@ -0,0 +1,107 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package oras_client pushes and pulls seeds as ORAS artifacts, for artifact registries refusing
+// container images with layers as large as the seed ones
+package oras_client
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"ibu-imager/internal/ops"
+)
+
+const (
+	// ModeImage stores seeds as container images, built and pushed with podman
+	ModeImage = "image"
+	// ModeORAS stores seeds as ORAS artifacts, pushed and pulled with the oras CLI
+	ModeORAS = "oras"
+
+	// ArtifactType is the artifact type of the seed manifest
+	ArtifactType = "application/vnd.openshift.ibu.seed.v1"
+	// FileMediaType is the media type of the regular file artifacts of the seed, directories are
+	// pushed by oras as tarballs of its own media type
+	FileMediaType = "application/vnd.openshift.ibu.seed.file.v1"
+)
+
+// pushDigest matches the manifest digest oras push prints
+var pushDigest = regexp.MustCompile(`(?m)^Digest: (sha256:[0-9a-f]{64})\s*$`)
+
+// ValidateMode checks the artifact mode is supported
+func ValidateMode(mode string) error {
+	switch mode {
+	case ModeImage, ModeORAS:
+		return nil
+	default:
+		return errors.Errorf("unsupported artifact mode %q, must be one of: %s, %s", mode, ModeImage, ModeORAS)
+	}
+}
+
+// Client runs the oras CLI with the registry credentials of the authfile
+type Client struct {
+	log      *logrus.Logger
+	executor ops.Execute
+	authFile string
+}
+
+// NewClient returns a client of the oras CLI, run by the executor
+func NewClient(log *logrus.Logger, executor ops.Execute, authFile string) *Client {
+	return &Client{log: log, executor: executor, authFile: authFile}
+}
+
+// Push pushes the files of dir as the layers of an artifact, titled after their name, annotating
+// the manifest. It returns the digest of the pushed manifest.
+func (c *Client) Push(dir string, files []string, image string, annotations map[string]string) (string, error) {
+	// oras titles the layers after the paths given, so it runs from the dir to keep the bare names
+	args := []string{"-C", dir, "oras", "push", "--registry-config", c.authFile, "--artifact-type", ArtifactType}
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "--annotation", fmt.Sprintf("%s=%s", key, annotations[key]))
+	}
+	args = append(args, image)
+	for _, file := range files {
+		args = append(args, file+":"+FileMediaType)
+	}
+
+	c.log.Infof("Pushing %d files to %s with oras", len(files), image)
+	output, err := c.executor.Execute("env", args...)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to push %s with oras", image)
+	}
+	match := pushDigest.FindStringSubmatch(output)
+	if match == nil {
+		return "", errors.Errorf("Failed to find the manifest digest in the oras push output of %s", image)
+	}
+	return match[1], nil
+}
+
+// Pull downloads the files of the artifact into dir, oras verifying every blob against its digest
+func (c *Client) Pull(image, dir string) error {
+	c.log.Infof("Pulling %s with oras", image)
+	if _, err := c.executor.Execute("oras", "pull", "--registry-config", c.authFile, "--output", dir, image); err != nil {
+		return errors.Wrapf(err, "Failed to pull %s with oras", image)
+	}
+	return nil
+}
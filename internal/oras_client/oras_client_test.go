@@ -0,0 +1,47 @@
+package oras_client
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	"ibu-imager/internal/ops"
+)
+
+func TestORASClient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ORAS Client Suite")
+}
+
+var _ = Describe("ORAS client", func() {
+	const digest = "sha256:0c95d1f1a5ba7bd2d3ac0ff1bb2f79cbd0ba6d32c5d0bde3e7894a5f0a1a1de8"
+
+	It("Pushes the files titled after their name, with sorted annotations", func() {
+		executor := ops.NewMockExecute(gomock.NewController(GinkgoT()))
+		executor.EXPECT().Execute("env", "-C", "/var/tmp/backup", "oras", "push", "--registry-config", "auth.json",
+			"--artifact-type", ArtifactType, "--annotation", "a=1", "--annotation", "b=2", "quay.io/org/seed:oneimage",
+			"etc.tgz:"+FileMediaType, "manifest.json:"+FileMediaType).
+			Return("Uploading etc.tgz\nPushed [registry] quay.io/org/seed:oneimage\nArtifactType: "+ArtifactType+"\nDigest: "+digest+"\n", nil)
+
+		pushed, err := NewClient(logrus.New(), executor, "auth.json").Push("/var/tmp/backup", []string{"etc.tgz", "manifest.json"},
+			"quay.io/org/seed:oneimage", map[string]string{"b": "2", "a": "1"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pushed).To(Equal(digest))
+	})
+
+	It("Fails without a digest in the push output", func() {
+		executor := ops.NewMockExecute(gomock.NewController(GinkgoT()))
+		executor.EXPECT().Execute("env", gomock.Any()).Return("", nil)
+		_, err := NewClient(logrus.New(), executor, "auth.json").Push("/var/tmp/backup", nil, "quay.io/org/seed:oneimage", nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Validates the artifact mode", func() {
+		Expect(ValidateMode(ModeImage)).To(Succeed())
+		Expect(ValidateMode(ModeORAS)).To(Succeed())
+		Expect(ValidateMode("helm")).ToNot(Succeed())
+	})
+})
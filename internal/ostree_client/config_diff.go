@@ -0,0 +1,91 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rpm_ostree_client
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ConfigDiff is the difference between /etc and the default /etc of the booted deployment, as
+// reported by `ostree admin config-diff`. Paths are absolute and sorted.
+type ConfigDiff struct {
+	Added    []string
+	Modified []string
+	Deleted  []string
+}
+
+// Changed returns the added and modified files, the ones an /etc backup has to carry
+func (d *ConfigDiff) Changed() []string {
+	changed := append(append([]string{}, d.Added...), d.Modified...)
+	sort.Strings(changed)
+	return changed
+}
+
+// Status returns the config-diff status of the file (A, M or D), empty when unchanged
+func (d *ConfigDiff) Status(file string) string {
+	for status, files := range map[string][]string{"A": d.Added, "M": d.Modified, "D": d.Deleted} {
+		if i := sort.SearchStrings(files, file); i < len(files) && files[i] == file {
+			return status
+		}
+	}
+	return ""
+}
+
+// ParseConfigDiff parses the output of `ostree admin config-diff`, one status letter and /etc relative
+// path per line
+func ParseConfigDiff(output string) (*ConfigDiff, error) {
+	diff := &ConfigDiff{Added: []string{}, Modified: []string{}, Deleted: []string{}}
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		// Paths may have spaces, only the status is a field of its own
+		status, file, ok := strings.Cut(strings.TrimSpace(line), " ")
+		file = strings.TrimSpace(file)
+		if !ok || file == "" {
+			return nil, errors.Errorf("Unexpected config-diff line %q", line)
+		}
+		file = path.Join("/etc", file)
+		switch status {
+		case "A":
+			diff.Added = append(diff.Added, file)
+		case "M":
+			diff.Modified = append(diff.Modified, file)
+		case "D":
+			diff.Deleted = append(diff.Deleted, file)
+		default:
+			return nil, errors.Errorf("Unexpected config-diff status %q of %s", status, file)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Modified)
+	sort.Strings(diff.Deleted)
+	return diff, nil
+}
+
+// ConfigDiff returns the difference between /etc and the default /etc of the booted deployment
+func (c *Client) ConfigDiff() (*ConfigDiff, error) {
+	output, err := c.ops.RunInHostNamespace("ostree", "admin", "config-diff")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to diff /etc")
+	}
+	return ParseConfigDiff(output)
+}
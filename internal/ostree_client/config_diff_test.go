@@ -0,0 +1,34 @@
+package rpm_ostree_client
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestOstreeClient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Ostree Client Suite")
+}
+
+var _ = Describe("Config diff", func() {
+	It("Parses the added, modified and deleted files", func() {
+		diff, err := ParseConfigDiff("M    hosts\nA    chrony.conf\nA    NetworkManager/system-connections/wired 1.nmconnection\n" +
+			"D    systemd/system/multi-user.target.wants/ptp4l.service\n\n")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diff.Added).To(Equal([]string{"/etc/NetworkManager/system-connections/wired 1.nmconnection", "/etc/chrony.conf"}))
+		Expect(diff.Modified).To(Equal([]string{"/etc/hosts"}))
+		Expect(diff.Deleted).To(Equal([]string{"/etc/systemd/system/multi-user.target.wants/ptp4l.service"}))
+		Expect(diff.Changed()).To(Equal([]string{"/etc/NetworkManager/system-connections/wired 1.nmconnection", "/etc/chrony.conf", "/etc/hosts"}))
+		Expect(diff.Status("/etc/hosts")).To(Equal("M"))
+		Expect(diff.Status("/etc/passwd")).To(BeEmpty())
+	})
+
+	It("Refuses unexpected lines", func() {
+		_, err := ParseConfigDiff("X    hosts\n")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseConfigDiff("M\n")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,225 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precache
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+
+	cri "ibu-imager/internal/cri_client"
+	"ibu-imager/internal/ops"
+	planner "ibu-imager/internal/precache_plan"
+	registry "ibu-imager/internal/registry_client"
+	seed "ibu-imager/internal/seed_creator"
+	verifier "ibu-imager/internal/seed_verify"
+)
+
+const (
+	// DefaultWorkers is the default number of images pulled concurrently
+	DefaultWorkers = 10
+	// DefaultRetries is the default number of times a failed pull is retried
+	DefaultRetries = 2
+	// retryInterval is the wait before the first retry of a pull, it grows linearly with the attempts
+	retryInterval = 5 * time.Second
+)
+
+// Config is how the images are precached
+type Config struct {
+	// AuthFile holds the credentials to pull the images
+	AuthFile string
+	// Workers is the number of images pulled concurrently
+	Workers int
+	// Retries is the number of times a failed pull is retried
+	Retries int
+}
+
+// Validate checks the config values
+func (c *Config) Validate() error {
+	if c.Workers < 1 {
+		return errors.Errorf("at least one worker is required, got %d", c.Workers)
+	}
+	if c.Retries < 0 {
+		return errors.Errorf("retries can't be negative, got %d", c.Retries)
+	}
+	return nil
+}
+
+// Failure is an image that couldn't be pulled
+type Failure struct {
+	Image string `json:"image"`
+	Error string `json:"error"`
+}
+
+// Report is the outcome of a precache run
+type Report struct {
+	Images int       `json:"images"`
+	Pulled int       `json:"pulled"`
+	Failed []Failure `json:"failed,omitempty"`
+}
+
+// Precacher pulls the images of a seed into the CRI-O storage of the host
+type Precacher struct {
+	log           *logrus.Logger
+	ops           ops.Ops
+	config        Config
+	retryInterval time.Duration
+}
+
+func NewPrecacher(log *logrus.Logger, ops ops.Ops, config Config) *Precacher {
+	return &Precacher{
+		log:           log,
+		ops:           ops,
+		config:        config,
+		retryInterval: retryInterval,
+	}
+}
+
+// SeedImages reads the images to precache out of the containers.list and catalogimages.list of a
+// remote seed image, without pulling it. Catalog images are pinned to the digests of the seed
+// cluster when the seed has them. Seeds created with a precache plan have all their images pinned
+// to the digests resolved at seed time instead.
+func SeedImages(log *logrus.Logger, client *registry.Client, ref registry.Reference) ([]string, error) {
+	data, err := verifier.ReadArtifact(client, ref, planner.FileName)
+	if err == nil {
+		plan, err := planner.Parse(data)
+		if err != nil {
+			return nil, err
+		}
+		logPlan(log, plan)
+		return plan.Images(), nil
+	}
+	log.Debugf("Resolving the seed images without precache plan: %v", err)
+
+	containers, err := verifier.ReadArtifact(client, ref, seed.ContainersListFile)
+	if err != nil {
+		return nil, err
+	}
+	catalogs, err := verifier.ReadArtifact(client, ref, seed.CatalogImagesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	catalogImages := ParseImageList(catalogs)
+	if data, err := verifier.ReadArtifact(client, ref, seed.CatalogDigestsFile); err != nil {
+		log.Warnf("Catalog images aren't pinned to the seed digests: %v", err)
+	} else {
+		var digests []seed.CatalogImage
+		if err = json.Unmarshal(data, &digests); err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse %s", seed.CatalogDigestsFile)
+		}
+		catalogImages = PinCatalogImages(catalogImages, digests)
+	}
+	return cri.SortedUnique(append(ParseImageList(containers), catalogImages...)), nil
+}
+
+// logPlan logs what the precache plan resolved at seed time
+func logPlan(log *logrus.Logger, plan *planner.Plan) {
+	var unavailable int
+	for _, entry := range plan.Entries {
+		if !entry.Available {
+			unavailable++
+			log.Warnf("Image %s wasn't available at seed time: %s", entry.Image, entry.Error)
+		}
+	}
+	log.Infof("Using the precache plan of the seed: %d images, %d bytes, %d unavailable at seed time",
+		len(plan.Entries), plan.Size(), unavailable)
+}
+
+// ParseImageList returns the image references of a containers.list or catalogimages.list file
+func ParseImageList(data []byte) []string {
+	var images []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if image := strings.TrimSpace(line); image != "" {
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// PinCatalogImages replaces the catalog images by their digest at capture time, as the tags of
+// catalog images move along with the operator releases. Images without digest are kept as is.
+func PinCatalogImages(images []string, catalogImages []seed.CatalogImage) []string {
+	digests := map[string]string{}
+	for _, catalogImage := range catalogImages {
+		digests[catalogImage.Image] = catalogImage.Digest
+	}
+
+	pinned := make([]string, 0, len(images))
+	for _, image := range images {
+		ref, err := registry.ParseReference(image)
+		if digest := digests[image]; err == nil && digest != "" {
+			image = ref.Name() + "@" + digest
+		}
+		pinned = append(pinned, image)
+	}
+	return pinned
+}
+
+// Precache pulls the images concurrently, retrying failed pulls. Failures don't stop the other
+// pulls, they're returned in the report.
+func (p *Precacher) Precache(images []string) *Report {
+	var (
+		mu     sync.Mutex
+		report = &Report{Images: len(images)}
+		group  errgroup.Group
+	)
+	group.SetLimit(p.config.Workers)
+
+	p.log.Infof("Precaching %d images with %d workers", len(images), p.config.Workers)
+	for _, image := range images {
+		image := image
+		group.Go(func() error {
+			err := p.pull(image)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				p.log.Warnf("Failed to pull %s: %v", image, err)
+				report.Failed = append(report.Failed, Failure{Image: image, Error: err.Error()})
+			} else {
+				report.Pulled++
+				p.log.Debugf("Pulled %s (%d/%d)", image, report.Pulled, report.Images)
+			}
+			return nil
+		})
+	}
+	_ = group.Wait()
+
+	sort.Slice(report.Failed, func(i, j int) bool { return report.Failed[i].Image < report.Failed[j].Image })
+	return report
+}
+
+// pull pulls a single image into the host containers storage, shared with CRI-O
+func (p *Precacher) pull(image string) error {
+	var err error
+	for attempt := 0; attempt <= p.config.Retries; attempt++ {
+		if attempt > 0 {
+			p.log.Debugf("Retrying pull of %s (attempt %d/%d)", image, attempt, p.config.Retries)
+			time.Sleep(time.Duration(attempt) * p.retryInterval)
+		}
+		if _, err = p.ops.RunInHostNamespace("podman", "pull", "--authfile", p.config.AuthFile, image); err == nil {
+			return nil
+		}
+	}
+	return err
+}
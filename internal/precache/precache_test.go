@@ -0,0 +1,70 @@
+package precache
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	"ibu-imager/internal/ops"
+	seed "ibu-imager/internal/seed_creator"
+)
+
+func TestPrecache(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Precache Suite")
+}
+
+var _ = Describe("Precache", func() {
+	var (
+		l         = logrus.New()
+		ctrl      *gomock.Controller
+		opsMock   *ops.MockOps
+		precacher *Precacher
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		opsMock = ops.NewMockOps(ctrl)
+		precacher = NewPrecacher(l, opsMock, Config{AuthFile: "/auth.json", Workers: 2, Retries: 1})
+		precacher.retryInterval = 0
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+
+	It("Retries failed pulls and reports the images that still fail", func() {
+		opsMock.EXPECT().RunInHostNamespace("podman", "pull", "--authfile", "/auth.json", "quay.io/a:1").Return("", nil)
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("podman", "pull", "--authfile", "/auth.json", "quay.io/b:1").Return("", fmt.Errorf("Dummy")),
+			opsMock.EXPECT().RunInHostNamespace("podman", "pull", "--authfile", "/auth.json", "quay.io/b:1").Return("", nil),
+		)
+		opsMock.EXPECT().RunInHostNamespace("podman", "pull", "--authfile", "/auth.json", "quay.io/c:1").Times(2).Return("", fmt.Errorf("Dummy"))
+
+		report := precacher.Precache([]string{"quay.io/a:1", "quay.io/b:1", "quay.io/c:1"})
+		Expect(report).To(Equal(&Report{Images: 3, Pulled: 2, Failed: []Failure{{Image: "quay.io/c:1", Error: "Dummy"}}}))
+	})
+
+	It("Parses image lists", func() {
+		Expect(ParseImageList([]byte("quay.io/a:1\n\n  quay.io/b@sha256:1234\n"))).To(Equal([]string{"quay.io/a:1", "quay.io/b@sha256:1234"}))
+	})
+
+	It("Pins catalog images to their seed digests", func() {
+		images := PinCatalogImages([]string{"registry.redhat.io/redhat/redhat-operator-index:v4.14", "quay.io/org/index:latest"},
+			[]seed.CatalogImage{
+				{Image: "registry.redhat.io/redhat/redhat-operator-index:v4.14", Digest: "sha256:1234"},
+				{Image: "quay.io/org/index:latest"},
+			})
+		Expect(images).To(Equal([]string{"registry.redhat.io/redhat/redhat-operator-index@sha256:1234", "quay.io/org/index:latest"}))
+	})
+
+	It("Validates the config", func() {
+		Expect((&Config{Workers: 0}).Validate()).ToNot(Succeed())
+		Expect((&Config{Workers: 1, Retries: -1}).Validate()).ToNot(Succeed())
+		Expect((&Config{Workers: 1}).Validate()).To(Succeed())
+	})
+})
@@ -0,0 +1,294 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precache_plan
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+
+	registry "ibu-imager/internal/registry_client"
+)
+
+const (
+	// FileName is the seed artifact holding the precache plan
+	FileName = "precache-plan.json"
+	// SchemaVersion is the version of the precache plan format
+	SchemaVersion = 1
+
+	// DefaultWorkers is the default number of images resolved concurrently
+	DefaultWorkers = 4
+	// DefaultRequestsPerSecond is the default rate of registry requests, low enough not to hit the
+	// rate limits of public registries with the few hundred images of an OCP release
+	DefaultRequestsPerSecond = 5
+)
+
+// indexMediaTypes are the media types of multi-platform manifests
+var indexMediaTypes = map[string]bool{
+	"application/vnd.oci.image.index.v1+json":                   true,
+	"application/vnd.docker.distribution.manifest.list.v2+json": true,
+}
+
+// Config is how the precache plan is resolved
+type Config struct {
+	// Enabled resolves the plan at seed time
+	Enabled bool
+	// Workers is the number of images resolved concurrently
+	Workers int
+	// RequestsPerSecond bounds the rate of registry requests of all the workers
+	RequestsPerSecond float64
+}
+
+// Validate checks the config values
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Workers < 1 {
+		return errors.Errorf("at least one worker is required, got %d", c.Workers)
+	}
+	if c.RequestsPerSecond <= 0 {
+		return errors.Errorf("the request rate must be positive, got %v", c.RequestsPerSecond)
+	}
+	return nil
+}
+
+// Entry is an image to precache as resolved at seed time
+type Entry struct {
+	Image string `json:"image"`
+	// Digest is the manifest digest the image resolved to, what the target pulls
+	Digest string `json:"digest,omitempty"`
+	// Size is the compressed size of the config and layers of the seed platform
+	Size int64 `json:"size,omitempty"`
+	// Available is false when the registry didn't serve the image
+	Available bool   `json:"available"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Reference returns the image pinned to its digest, or the image as is when it wasn't resolved
+func (e *Entry) Reference() string {
+	ref, err := registry.ParseReference(e.Image)
+	if err != nil || e.Digest == "" {
+		return e.Image
+	}
+	return ref.Name() + "@" + e.Digest
+}
+
+// Plan is the precache plan of a seed, the images of containers.list and catalogimages.list resolved
+// at seed time, so the target precaches them without resolving them again
+type Plan struct {
+	SchemaVersion int     `json:"schemaVersion"`
+	Entries       []Entry `json:"entries"`
+}
+
+// Size returns the size of the available images
+func (p *Plan) Size() int64 {
+	var size int64
+	for _, entry := range p.Entries {
+		size += entry.Size
+	}
+	return size
+}
+
+// Images returns the image references to precache pinned to their digests, largest first so the
+// longest pulls start first
+func (p *Plan) Images() []string {
+	entries := append([]Entry(nil), p.Entries...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Size > entries[j].Size })
+	images := make([]string, 0, len(entries))
+	for i := range entries {
+		images = append(images, entries[i].Reference())
+	}
+	return images
+}
+
+// Parse parses a precache plan, refusing plans of newer schema versions
+func Parse(data []byte) (*Plan, error) {
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse %s", FileName)
+	}
+	if plan.SchemaVersion > SchemaVersion {
+		return nil, errors.Errorf("Unsupported %s schema version %d, at most %d is supported",
+			FileName, plan.SchemaVersion, SchemaVersion)
+	}
+	return &plan, nil
+}
+
+// Resolver resolves the images of a precache plan through the registries
+type Resolver struct {
+	log    *logrus.Logger
+	client *registry.Client
+	config Config
+	// arch is the platform picked out of multi-platform images, the seed host one
+	arch string
+}
+
+func NewResolver(log *logrus.Logger, client *registry.Client, config Config) *Resolver {
+	return &Resolver{log: log, client: client, config: config, arch: runtime.GOARCH}
+}
+
+// Resolve resolves the images and writes the plan to file, after every image so an interrupted run
+// resumes where it stopped: the available images of an existing plan file aren't resolved again.
+// Images that can't be resolved are recorded as unavailable, they don't fail the plan.
+func (r *Resolver) Resolve(images []string, file string) (*Plan, error) {
+	resolved := map[string]Entry{}
+	if data, err := os.ReadFile(file); err == nil {
+		previous, err := Parse(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range previous.Entries {
+			if entry.Available {
+				resolved[entry.Image] = entry
+			}
+		}
+		r.log.Infof("Resuming the precache plan, %d images already resolved", len(resolved))
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "Failed to read %s", file)
+	}
+
+	var (
+		mu    sync.Mutex
+		plan  = &Plan{SchemaVersion: SchemaVersion, Entries: make([]Entry, len(images))}
+		group errgroup.Group
+	)
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / r.config.RequestsPerSecond))
+	defer ticker.Stop()
+	group.SetLimit(r.config.Workers)
+
+	var pending []int
+	for i, image := range images {
+		if entry, ok := resolved[image]; ok {
+			plan.Entries[i] = entry
+		} else {
+			plan.Entries[i] = Entry{Image: image}
+			pending = append(pending, i)
+		}
+	}
+	for _, i := range pending {
+		i := i
+		group.Go(func() error {
+			entry := r.resolve(plan.Entries[i].Image, ticker.C)
+			if !entry.Available {
+				r.log.Warnf("Failed to resolve precache image %s: %s", entry.Image, entry.Error)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			plan.Entries[i] = entry
+			return save(plan, file)
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	return plan, save(plan, file)
+}
+
+// resolve resolves the digest and size of an image, waiting for the rate limiter before each request
+func (r *Resolver) resolve(image string, limiter <-chan time.Time) Entry {
+	entry := Entry{Image: image}
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+
+	<-limiter
+	data, mediaType, err := r.client.GetRawManifest(ref)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+	entry.Digest = fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+
+	if indexMediaTypes[mediaType] || indexMediaTypes[manifestMediaType(data)] {
+		platform, err := r.platformManifest(data)
+		if err != nil {
+			entry.Error = errors.Wrapf(err, "Failed to select the %s manifest", r.arch).Error()
+			return entry
+		}
+		<-limiter
+		platformRef := ref
+		platformRef.Tag, platformRef.Digest = "", platform
+		if data, _, err = r.client.GetRawManifest(platformRef); err != nil {
+			entry.Error = err.Error()
+			return entry
+		}
+	}
+
+	var manifest registry.Manifest
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		entry.Error = errors.Wrap(err, "Failed to parse manifest").Error()
+		return entry
+	}
+	entry.Size = manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		entry.Size += layer.Size
+	}
+	entry.Available = true
+	return entry
+}
+
+// platformManifest returns the digest of the seed platform manifest of a multi-platform image
+func (r *Resolver) platformManifest(data []byte) (string, error) {
+	var index struct {
+		Manifests []struct {
+			Digest   string `json:"digest"`
+			Platform struct {
+				Architecture string `json:"architecture"`
+				OS           string `json:"os"`
+			} `json:"platform"`
+		} `json:"manifests"`
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return "", err
+	}
+	for _, manifest := range index.Manifests {
+		if manifest.Platform.OS == "linux" && manifest.Platform.Architecture == r.arch {
+			return manifest.Digest, nil
+		}
+	}
+	return "", errors.New("no manifest for the platform")
+}
+
+// manifestMediaType returns the media type a manifest declares, registries may serve it with a generic one
+func manifestMediaType(data []byte) string {
+	var manifest struct {
+		MediaType string `json:"mediaType"`
+	}
+	_ = json.Unmarshal(data, &manifest)
+	return manifest.MediaType
+}
+
+// save writes the plan with its entries in image order
+func save(plan *Plan, file string) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal the precache plan")
+	}
+	return errors.Wrapf(os.WriteFile(file, data, 0600), "Failed to write %s", file)
+}
@@ -0,0 +1,118 @@
+package precache_plan
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	registry "ibu-imager/internal/registry_client"
+)
+
+func TestPrecachePlan(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "PrecachePlan Suite")
+}
+
+var _ = Describe("Precache plan", func() {
+	var (
+		tmpDir   string
+		server   *httptest.Server
+		mu       sync.Mutex
+		requests []string
+	)
+
+	BeforeEach(func() {
+		tmpDir, _ = os.MkdirTemp("", "test")
+		requests = nil
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests = append(requests, r.URL.Path)
+			mu.Unlock()
+			switch r.URL.Path {
+			case "/v2/ocp/release/manifests/v1":
+				w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+				_, _ = w.Write([]byte(`{"config": {"digest": "sha256:c", "size": 10}, "layers": [{"digest": "sha256:l", "size": 90}]}`))
+			case "/v2/redhat/catalog/manifests/v4.14":
+				w.Header().Set("Content-Type", "application/vnd.oci.image.index.v1+json")
+				_, _ = w.Write([]byte(`{"manifests": [{"digest": "sha256:other", "platform": {"os": "linux", "architecture": "s390x"}},
+					{"digest": "sha256:amd64", "platform": {"os": "linux", "architecture": "amd64"}}]}`))
+			case "/v2/redhat/catalog/manifests/sha256:amd64":
+				w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+				_, _ = w.Write([]byte(`{"config": {"digest": "sha256:c", "size": 5}, "layers": [{"digest": "sha256:l", "size": 995}]}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	})
+	AfterEach(func() {
+		server.Close()
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	resolver := func() *Resolver {
+		client, err := registry.NewClient("")
+		Expect(err).ToNot(HaveOccurred())
+		client.SetHTTPClient(server.Client())
+		r := NewResolver(logrus.New(), client, Config{Enabled: true, Workers: 2, RequestsPerSecond: 1000})
+		r.arch = "amd64"
+		return r
+	}
+
+	It("Resolves digests, sizes and availability, pinning the images largest first", func() {
+		host := strings.TrimPrefix(server.URL, "https://")
+		images := []string{host + "/ocp/release:v1", host + "/redhat/catalog:v4.14", host + "/ocp/missing:v1"}
+		file := filepath.Join(tmpDir, FileName)
+
+		plan, err := resolver().Resolve(images, file)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(plan.Entries).To(HaveLen(3))
+		Expect(plan.Entries[0]).To(HaveField("Size", int64(100)))
+		Expect(plan.Entries[0]).To(HaveField("Available", true))
+		Expect(plan.Entries[1]).To(HaveField("Size", int64(1000)))
+		Expect(plan.Entries[1].Digest).To(HavePrefix("sha256:"))
+		Expect(plan.Entries[2]).To(HaveField("Available", false))
+		Expect(plan.Size()).To(Equal(int64(1100)))
+		Expect(plan.Images()).To(Equal([]string{
+			host + "/redhat/catalog@" + plan.Entries[1].Digest,
+			host + "/ocp/release@" + plan.Entries[0].Digest,
+			host + "/ocp/missing:v1",
+		}))
+
+		data, err := os.ReadFile(file)
+		Expect(err).ToNot(HaveOccurred())
+		saved, err := Parse(data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(saved).To(Equal(plan))
+	})
+
+	It("Resumes an interrupted plan, resolving only the images left", func() {
+		host := strings.TrimPrefix(server.URL, "https://")
+		images := []string{host + "/ocp/release:v1", host + "/redhat/catalog:v4.14"}
+		file := filepath.Join(tmpDir, FileName)
+		data, _ := json.Marshal(&Plan{SchemaVersion: SchemaVersion, Entries: []Entry{
+			{Image: images[0], Digest: "sha256:resolved", Size: 1, Available: true},
+			{Image: images[1]},
+		}})
+		Expect(os.WriteFile(file, data, 0600)).To(Succeed())
+
+		plan, err := resolver().Resolve(images, file)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(plan.Entries[0].Digest).To(Equal("sha256:resolved"))
+		Expect(plan.Entries[1]).To(HaveField("Available", true))
+		Expect(requests).ToNot(ContainElement("/v2/ocp/release/manifests/v1"))
+	})
+
+	It("Refuses plans of newer schema versions", func() {
+		_, err := Parse([]byte(`{"schemaVersion": 2}`))
+		Expect(err).To(HaveOccurred())
+	})
+})
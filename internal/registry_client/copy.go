@@ -0,0 +1,228 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry_client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxParallelBlobCopies is the maximum number of blobs CopyImage copies concurrently
+const maxParallelBlobCopies = 3
+
+// CopyResult summarizes an image copy
+type CopyResult struct {
+	// Digest is the manifest digest, the same in both registries
+	Digest string
+	// Copied are the blobs streamed from the source registry
+	Copied []Descriptor
+	// Mounted are the blobs the destination registry mounted from the source repository
+	Mounted []Descriptor
+	// Skipped are the blobs the destination repository already had
+	Skipped []Descriptor
+}
+
+// CopiedBytes returns the amount of data streamed between the registries
+func (r *CopyResult) CopiedBytes() int64 {
+	var size int64
+	for _, blob := range r.Copied {
+		size += blob.Size
+	}
+	return size
+}
+
+// CopyImage copies the image manifest and all its blobs from one registry to another, each client
+// carrying the credentials of its registry. Blobs are streamed between the registries without being
+// stored locally, and the manifest is copied verbatim so the image keeps its digest.
+func CopyImage(src *Client, from Reference, dst *Client, to Reference) (*CopyResult, error) {
+	data, mediaType, err := src.GetRawManifest(from)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := parseManifest(from, data, mediaType)
+	if err != nil {
+		return nil, err
+	}
+	if mediaType == "" {
+		mediaType = manifest.MediaType
+	}
+	result := &CopyResult{Digest: fmt.Sprintf("sha256:%x", sha256.Sum256(data))}
+	if from.Digest != "" && from.Digest != result.Digest {
+		return nil, errors.Errorf("Manifest of %s doesn't match its digest, got %s", from, result.Digest)
+	}
+
+	// The same registry can mount the blobs instead of copying them, when the credentials allow it,
+	// otherwise it falls back to a regular upload
+	var mountFrom string
+	if from.Registry == to.Registry {
+		mountFrom = from.Repository
+	}
+
+	var (
+		mu    sync.Mutex
+		group errgroup.Group
+	)
+	group.SetLimit(maxParallelBlobCopies)
+	for _, blob := range append([]Descriptor{manifest.Config}, manifest.Layers...) {
+		blob := blob
+		group.Go(func() error {
+			exists, err := dst.BlobExists(to, blob.Digest)
+			if err != nil {
+				return err
+			}
+			copied := &result.Skipped
+			if !exists {
+				mounted, err := copyBlob(src, from, dst, to, blob, mountFrom)
+				if err != nil {
+					return errors.Wrapf(err, "Failed to copy blob %s", blob.Digest)
+				}
+				copied = &result.Copied
+				if mounted {
+					copied = &result.Mounted
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			*copied = append(*copied, blob)
+			return nil
+		})
+	}
+	if err = group.Wait(); err != nil {
+		return nil, err
+	}
+
+	// The manifest goes last, the destination registry refuses manifests referencing missing blobs
+	if err = dst.PutManifest(to, mediaType, data); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// copyBlob streams a blob from the source repository to the destination one, returning true if the
+// destination registry mounted it from mountFrom instead
+func copyBlob(src *Client, from Reference, dst *Client, to Reference, blob Descriptor, mountFrom string) (bool, error) {
+	location, err := dst.startUpload(to, blob.Digest, mountFrom)
+	if err != nil {
+		return false, err
+	}
+	if location == "" {
+		return true, nil
+	}
+
+	reader, err := src.GetBlob(from, blob.Digest)
+	if err != nil {
+		return false, err
+	}
+	defer reader.Close()
+	return false, dst.finishUpload(to, location, blob, reader)
+}
+
+// BlobExists returns true if the repository has the blob
+func (c *Client) BlobExists(ref Reference, digest string) (bool, error) {
+	resp, err := c.do(http.MethodHead, c.blobURL(ref, digest), ref, "pull,push", nil, nil)
+	if IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// PutManifest uploads the manifest under the reference tag, or its digest for references without tag
+func (c *Client) PutManifest(ref Reference, mediaType string, data []byte) error {
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", ref.endpoint(), ref.Repository, ref.Tag)
+	if ref.Tag == "" {
+		manifestURL = fmt.Sprintf("https://%s/v2/%s/manifests/%s", ref.endpoint(), ref.Repository, ref.Digest)
+	}
+	resp, err := c.do(http.MethodPut, manifestURL, ref, "pull,push", func() io.Reader {
+		return bytes.NewReader(data)
+	}, http.Header{"Content-Type": {mediaType}})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to upload manifest of %s", ref)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// startUpload opens an upload session for the blob, returning the URL to upload it to. The returned URL
+// is empty when the registry mounted the blob from the mountFrom repository of the same registry.
+func (c *Client) startUpload(ref Reference, digest, mountFrom string) (string, error) {
+	uploadURL := fmt.Sprintf("https://%s/v2/%s/blobs/uploads/", ref.endpoint(), ref.Repository)
+	if mountFrom != "" {
+		uploadURL += "?" + url.Values{"mount": {digest}, "from": {mountFrom}}.Encode()
+	}
+	resp, err := c.do(http.MethodPost, uploadURL, ref, "pull,push", nil, http.Header{"Content-Length": {"0"}})
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to start blob upload")
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusCreated && mountFrom != "" {
+		return "", nil
+	}
+	return resolveLocation(uploadURL, resp.Header.Get("Location"))
+}
+
+// finishUpload uploads the whole blob to the upload session at once. The session was opened with the
+// same token scope, so the request isn't challenged and the blob reader is consumed once.
+func (c *Client) finishUpload(ref Reference, location string, blob Descriptor, reader io.Reader) error {
+	uploadURL, err := url.Parse(location)
+	if err != nil {
+		return errors.Wrapf(err, "Invalid upload location %q", location)
+	}
+	query := uploadURL.Query()
+	query.Set("digest", blob.Digest)
+	uploadURL.RawQuery = query.Encode()
+
+	resp, err := c.do(http.MethodPut, uploadURL.String(), ref, "pull,push", func() io.Reader {
+		return reader
+	}, http.Header{
+		"Content-Type":   {"application/octet-stream"},
+		"Content-Length": {strconv.FormatInt(blob.Size, 10)},
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// resolveLocation resolves the Location header of an upload session, which may be relative
+func resolveLocation(requestURL, location string) (string, error) {
+	if location == "" {
+		return "", errors.New("Registry returned no upload location")
+	}
+	base, err := url.Parse(requestURL)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := base.Parse(location)
+	if err != nil {
+		return "", errors.Wrapf(err, "Invalid upload location %q", location)
+	}
+	return resolved.String(), nil
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry_client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Descriptor references a blob of an image, as in the OCI image spec
+type Descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// Manifest is a single platform image manifest
+type Manifest struct {
+	MediaType string       `json:"mediaType"`
+	Config    Descriptor   `json:"config"`
+	Layers    []Descriptor `json:"layers"`
+	// Annotations are the manifest annotations, which artifacts carry rather than image labels
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ImageConfig is the subset of the image config blob describing the image
+type ImageConfig struct {
+	Architecture string    `json:"architecture"`
+	OS           string    `json:"os"`
+	Created      time.Time `json:"created"`
+	Config       struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
+}
+
+// GetManifest returns the image manifest the reference points to. Manifest lists aren't supported,
+// seed images are built for the seed host platform only.
+func (c *Client) GetManifest(ref Reference) (*Manifest, error) {
+	data, mediaType, err := c.GetRawManifest(ref)
+	if err != nil {
+		return nil, err
+	}
+	return parseManifest(ref, data, mediaType)
+}
+
+// GetRawManifest returns the manifest the reference points to as served by the registry, along with
+// its media type, so that it can be copied without changing its digest
+func (c *Client) GetRawManifest(ref Reference) ([]byte, string, error) {
+	resp, err := c.manifestRequest(http.MethodGet, ref)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "Failed to read manifest of %s", ref)
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+func parseManifest(ref Reference, data []byte, mediaType string) (*Manifest, error) {
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse manifest of %s", ref)
+	}
+	if manifest.MediaType == "" {
+		manifest.MediaType = mediaType
+	}
+	if len(manifest.Layers) == 0 && manifest.Config.Digest == "" {
+		return nil, errors.Errorf("%s is not a single platform image manifest (%s)", ref, manifest.MediaType)
+	}
+	return &manifest, nil
+}
+
+// GetImageConfig returns the image config of the manifest, a small blob carrying the image labels
+func (c *Client) GetImageConfig(ref Reference, manifest *Manifest) (*ImageConfig, error) {
+	blob, err := c.GetBlob(ref, manifest.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+
+	var config ImageConfig
+	if err = json.NewDecoder(blob).Decode(&config); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse image config of %s", ref)
+	}
+	return &config, nil
+}
+
+// GetBlob downloads a blob of the repository, the caller must close it
+func (c *Client) GetBlob(ref Reference, digest string) (io.ReadCloser, error) {
+	resp, err := c.do(http.MethodGet, c.blobURL(ref, digest), ref, "pull", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// GetBlobFrom downloads a blob of the repository starting at offset, to resume an interrupted
+// download. It returns the offset the registry serves the blob from, which is 0 if it ignored the
+// range. The caller must close the blob.
+func (c *Client) GetBlobFrom(ref Reference, digest string, offset int64) (io.ReadCloser, int64, error) {
+	if offset == 0 {
+		blob, err := c.GetBlob(ref, digest)
+		return blob, 0, err
+	}
+	resp, err := c.do(http.MethodGet, c.blobURL(ref, digest), ref, "pull", nil,
+		http.Header{"Range": {fmt.Sprintf("bytes=%d-", offset)}})
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return resp.Body, 0, nil
+	}
+	return resp.Body, offset, nil
+}
+
+// BlobSize returns the size of a blob of the repository, without downloading it
+func (c *Client) BlobSize(ref Reference, digest string) (int64, error) {
+	resp, err := c.do(http.MethodHead, c.blobURL(ref, digest), ref, "pull", nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.ContentLength < 0 {
+		return 0, errors.Errorf("Registry returned no size for blob %s of %s", digest, ref.Name())
+	}
+	return resp.ContentLength, nil
+}
+
+func (c *Client) blobURL(ref Reference, digest string) string {
+	return fmt.Sprintf("https://%s/v2/%s/blobs/%s", ref.endpoint(), ref.Repository, digest)
+}
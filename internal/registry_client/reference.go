@@ -0,0 +1,103 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry_client
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	dockerHubDomain   = "docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+)
+
+// Reference is a parsed image reference, e.g. quay.io/org/repo:tag or quay.io/org/repo@sha256:...
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses an image reference, defaulting to docker.io and the latest tag
+func ParseReference(ref string) (Reference, error) {
+	var r Reference
+	if ref == "" {
+		return r, errors.New("empty image reference")
+	}
+
+	name := ref
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, r.Digest = name[:i], name[i+1:]
+	}
+	// A colon after the last slash separates the tag, otherwise it's the registry port
+	if i := strings.LastIndex(name, ":"); i >= 0 && i > strings.LastIndex(name, "/") {
+		name, r.Tag = name[:i], name[i+1:]
+	}
+
+	registry, repository, found := strings.Cut(name, "/")
+	if !found || !(strings.ContainsAny(registry, ".:") || registry == "localhost") {
+		registry, repository = dockerHubDomain, name
+	}
+	if registry == dockerHubDomain && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	if repository == "" {
+		return r, errors.Errorf("invalid image reference %q", ref)
+	}
+	r.Registry, r.Repository = registry, repository
+
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = "latest"
+	}
+	return r, nil
+}
+
+// Name returns the reference without tag nor digest
+func (r Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// String returns the full reference
+func (r Reference) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// manifestRef is the tag or digest used to address the manifest, preferring the digest
+func (r Reference) manifestRef() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// endpoint returns the registry API host
+func (r Reference) endpoint() string {
+	if r.Registry == dockerHubDomain {
+		return dockerHubRegistry
+	}
+	return r.Registry
+}
@@ -0,0 +1,272 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry_client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// requestTimeout is the timeout of the registry API requests until the response headers. The
+	// body isn't bounded, blobs of several GiB take longer than any sensible request timeout.
+	requestTimeout = 30 * time.Second
+)
+
+// manifestMediaTypes are the manifest media types accepted from the registries
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// credentials are the basic auth credentials of a registry
+type credentials struct {
+	username string
+	password string
+}
+
+// Client is a handle for interacting with container registries through the distribution API
+type Client struct {
+	http        *http.Client
+	credentials map[string]credentials
+	tokens      map[string]string
+}
+
+// NewClient creates a new registry client using the credentials of the given auth file, which
+// uses the containers-auth.json format. An empty auth file path means anonymous access.
+func NewClient(authFile string) (*Client, error) {
+	c := &Client{
+		http: &http.Client{Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			TLSHandshakeTimeout:   requestTimeout,
+			ResponseHeaderTimeout: requestTimeout,
+		}},
+		credentials: map[string]credentials{},
+		tokens:      map[string]string{},
+	}
+	if authFile == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(authFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read auth file %s", authFile)
+	}
+	var auths struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err = json.Unmarshal(data, &auths); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse auth file %s", authFile)
+	}
+	for registry, auth := range auths.Auths {
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to decode credentials of %s", registry)
+		}
+		username, password, _ := strings.Cut(string(decoded), ":")
+		c.credentials[normalizeRegistry(registry)] = credentials{username: username, password: password}
+	}
+	return c, nil
+}
+
+// SetHTTPClient replaces the HTTP client of the registry client, mostly meant for tests
+func (c *Client) SetHTTPClient(client *http.Client) {
+	c.http = client
+}
+
+// ResolveDigest returns the manifest digest the reference points to
+func (c *Client) ResolveDigest(ref Reference) (string, error) {
+	resp, err := c.manifestRequest(http.MethodHead, ref)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", errors.Errorf("Registry returned no digest for %s", ref)
+	}
+	return digest, nil
+}
+
+func (c *Client) manifestRequest(method string, ref Reference) (*http.Response, error) {
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", ref.endpoint(), ref.Repository, ref.manifestRef())
+	return c.do(method, manifestURL, ref, "pull", nil, http.Header{"Accept": {strings.Join(manifestMediaTypes, ", ")}})
+}
+
+// do sends a registry API request, authenticating against the registry token service when challenged
+func (c *Client) do(method, requestURL string, ref Reference, actions string, body func() io.Reader,
+	header http.Header) (*http.Response, error) {
+	scope := fmt.Sprintf("repository:%s:%s", ref.Repository, actions)
+
+	send := func() (*http.Response, error) {
+		var reader io.Reader
+		if body != nil {
+			reader = body()
+		}
+		req, err := http.NewRequest(method, requestURL, reader)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		// The transport only sizes in-memory bodies, blob uploads carry their size in the header
+		if length := header.Get("Content-Length"); length != "" {
+			if req.ContentLength, err = strconv.ParseInt(length, 10, 64); err != nil {
+				return nil, errors.Wrapf(err, "Invalid content length %q", length)
+			}
+		}
+		if token, ok := c.tokens[ref.Registry+"|"+scope]; ok {
+			req.Header.Set("Authorization", token)
+		}
+		return c.http.Do(req)
+	}
+
+	resp, err := send()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to reach registry %s", ref.Registry)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err = c.authenticate(ref.Registry, scope, challenge); err != nil {
+			return nil, err
+		}
+		if resp, err = send(); err != nil {
+			return nil, errors.Wrapf(err, "Failed to reach registry %s", ref.Registry)
+		}
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, &StatusError{URL: requestURL, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return resp, nil
+}
+
+// authenticate stores the authorization header answering the given challenge
+func (c *Client) authenticate(registry, scope, challenge string) error {
+	creds, hasCredentials := c.credentials[normalizeRegistry(registry)]
+
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if !hasCredentials {
+			return errors.Errorf("Registry %s requires credentials", registry)
+		}
+		c.tokens[registry+"|"+scope] = "Basic " + base64.StdEncoding.EncodeToString(
+			[]byte(creds.username+":"+creds.password))
+		return nil
+	case "bearer":
+	default:
+		return errors.Errorf("Unsupported authentication challenge from %s: %q", registry, challenge)
+	}
+
+	values := parseChallengeParams(params)
+	tokenURL, err := url.Parse(values["realm"])
+	if err != nil || values["realm"] == "" {
+		return errors.Errorf("Invalid authentication realm from %s: %q", registry, challenge)
+	}
+	query := tokenURL.Query()
+	if service, ok := values["service"]; ok {
+		query.Set("service", service)
+	}
+	query.Set("scope", scope)
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	if hasCredentials {
+		req.SetBasicAuth(creds.username, creds.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get token from %s", tokenURL.Host)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("Failed to get token from %s: %s", tokenURL.Host, resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return errors.Wrap(err, "Failed to parse registry token")
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	c.tokens[registry+"|"+scope] = "Bearer " + token.Token
+	return nil
+}
+
+// StatusError is returned when the registry answers with an unexpected status
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Registry request %s failed: %s", e.URL, e.Status)
+}
+
+// IsNotFound returns true if the error is a registry 404
+func IsNotFound(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
+// parseChallengeParams parses the comma separated key="value" parameters of a WWW-Authenticate header
+func parseChallengeParams(params string) map[string]string {
+	values := map[string]string{}
+	for _, param := range strings.Split(params, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+		if found {
+			values[strings.ToLower(key)] = strings.Trim(value, `"`)
+		}
+	}
+	return values
+}
+
+// normalizeRegistry strips the scheme and path that some auth files use as keys
+func normalizeRegistry(registry string) string {
+	registry = strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://")
+	registry, _, _ = strings.Cut(registry, "/")
+	if registry == "index.docker.io" || registry == dockerHubRegistry {
+		return dockerHubDomain
+	}
+	return registry
+}
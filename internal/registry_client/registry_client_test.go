@@ -0,0 +1,207 @@
+package registry_client
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestRegistryClient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "RegistryClient Suite")
+}
+
+var _ = Describe("Image references", func() {
+	It("Parses references", func() {
+		ref, err := ParseReference("quay.io/org/repo:v1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ref).To(Equal(Reference{Registry: "quay.io", Repository: "org/repo", Tag: "v1"}))
+
+		ref, err = ParseReference("registry.local:5000/repo@sha256:abc")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ref).To(Equal(Reference{Registry: "registry.local:5000", Repository: "repo", Digest: "sha256:abc"}))
+
+		ref, err = ParseReference("nginx")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ref.String()).To(Equal("docker.io/library/nginx:latest"))
+	})
+})
+
+var _ = Describe("Registry client", func() {
+	It("Resolves digests through a bearer token challenge", func() {
+		var server *httptest.Server
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/token":
+				_, _ = w.Write([]byte(`{"token":"abc"}`))
+			case r.Header.Get("Authorization") != "Bearer abc":
+				w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="test"`)
+				w.WriteHeader(http.StatusUnauthorized)
+			default:
+				w.Header().Set("Docker-Content-Digest", "sha256:123")
+			}
+		}))
+		defer server.Close()
+
+		client, err := NewClient("")
+		Expect(err).ToNot(HaveOccurred())
+		client.http = server.Client()
+		ref, err := ParseReference(strings.TrimPrefix(server.URL, "https://") + "/org/repo:v1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(client.ResolveDigest(ref)).To(Equal("sha256:123"))
+	})
+})
+
+var _ = Describe("Manifests and blobs", func() {
+	It("Reads the manifest and the image config, and sizes blobs", func() {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v2/org/repo/manifests/v1":
+				w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+				_, _ = w.Write([]byte(`{"config": {"digest": "sha256:c"}, "layers": [{"digest": "sha256:l", "size": 4}]}`))
+			case "/v2/org/repo/blobs/sha256:c":
+				_, _ = w.Write([]byte(`{"config": {"Labels": {"key": "value"}}}`))
+			case "/v2/org/repo/blobs/sha256:l":
+				http.ServeContent(w, r, "", time.Time{}, strings.NewReader("blob"))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		client, err := NewClient("")
+		Expect(err).ToNot(HaveOccurred())
+		client.http = server.Client()
+		ref, err := ParseReference(strings.TrimPrefix(server.URL, "https://") + "/org/repo:v1")
+		Expect(err).ToNot(HaveOccurred())
+
+		manifest, err := client.GetManifest(ref)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(manifest.MediaType).To(Equal("application/vnd.oci.image.manifest.v1+json"))
+		Expect(manifest.Layers).To(Equal([]Descriptor{{Digest: "sha256:l", Size: 4}}))
+
+		config, err := client.GetImageConfig(ref, manifest)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(config.Config.Labels).To(HaveKeyWithValue("key", "value"))
+
+		Expect(client.BlobSize(ref, "sha256:l")).To(Equal(int64(4)))
+		blob, offset, err := client.GetBlobFrom(ref, "sha256:l", 2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(offset).To(Equal(int64(2)))
+		Expect(io.ReadAll(blob)).To(Equal([]byte("ob")))
+		Expect(blob.Close()).To(Succeed())
+		_, err = client.BlobSize(ref, "sha256:missing")
+		Expect(IsNotFound(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Image copy", func() {
+	It("Copies the missing blobs and the verbatim manifest", func() {
+		manifest := `{"mediaType": "application/vnd.oci.image.manifest.v1+json", "config": {"digest": "sha256:c", "size": 2}, "layers": [{"digest": "sha256:l", "size": 4}]}`
+		source := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v2/org/seed/manifests/v1":
+				w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+				_, _ = w.Write([]byte(manifest))
+			case "/v2/org/seed/blobs/sha256:l":
+				_, _ = w.Write([]byte("blob"))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer source.Close()
+
+		blobs := map[string]string{"sha256:c": "{}"}
+		var (
+			mu                      sync.Mutex
+			manifests, contentTypes []string
+		)
+		destination := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case r.Method == http.MethodHead && strings.HasPrefix(r.URL.Path, "/v2/site/seed/blobs/"):
+				if _, ok := blobs[strings.TrimPrefix(r.URL.Path, "/v2/site/seed/blobs/")]; !ok {
+					w.WriteHeader(http.StatusNotFound)
+				}
+			case r.Method == http.MethodPost && r.URL.Path == "/v2/site/seed/blobs/uploads/":
+				w.Header().Set("Location", "/v2/site/seed/blobs/uploads/session?state=s")
+				w.WriteHeader(http.StatusAccepted)
+			case r.Method == http.MethodPut && r.URL.Path == "/v2/site/seed/blobs/uploads/session":
+				Expect(r.URL.Query().Get("state")).To(Equal("s"))
+				Expect(r.ContentLength).To(Equal(int64(4)))
+				data, _ := io.ReadAll(r.Body)
+				blobs[r.URL.Query().Get("digest")] = string(data)
+				w.WriteHeader(http.StatusCreated)
+			case r.Method == http.MethodPut && r.URL.Path == "/v2/site/seed/manifests/v2":
+				data, _ := io.ReadAll(r.Body)
+				manifests = append(manifests, string(data))
+				contentTypes = append(contentTypes, r.Header.Get("Content-Type"))
+				w.WriteHeader(http.StatusCreated)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer destination.Close()
+
+		src, err := NewClient("")
+		Expect(err).ToNot(HaveOccurred())
+		src.http = source.Client()
+		dst, err := NewClient("")
+		Expect(err).ToNot(HaveOccurred())
+		dst.http = destination.Client()
+		from, err := ParseReference(strings.TrimPrefix(source.URL, "https://") + "/org/seed:v1")
+		Expect(err).ToNot(HaveOccurred())
+		to, err := ParseReference(strings.TrimPrefix(destination.URL, "https://") + "/site/seed:v2")
+		Expect(err).ToNot(HaveOccurred())
+
+		result, err := CopyImage(src, from, dst, to)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Copied).To(Equal([]Descriptor{{Digest: "sha256:l", Size: 4}}))
+		Expect(result.Skipped).To(Equal([]Descriptor{{Digest: "sha256:c", Size: 2}}))
+		Expect(result.CopiedBytes()).To(Equal(int64(4)))
+		Expect(blobs).To(HaveKeyWithValue("sha256:l", "blob"))
+		Expect(manifests).To(Equal([]string{manifest}))
+		Expect(contentTypes).To(Equal([]string{"application/vnd.oci.image.manifest.v1+json"}))
+	})
+})
+
+var _ = Describe("Tags", func() {
+	It("Lists the tags across pages and deletes manifests by digest", func() {
+		var deleted []string
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/v2/org/seed/tags/list" && r.URL.Query().Get("last") == "":
+				w.Header().Set("Link", `</v2/org/seed/tags/list?n=100&last=v2>; rel="next"`)
+				_, _ = w.Write([]byte(`{"tags": ["v1", "v2"]}`))
+			case r.URL.Path == "/v2/org/seed/tags/list":
+				_, _ = w.Write([]byte(`{"tags": ["v3"]}`))
+			case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v2/org/seed/manifests/"):
+				deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/v2/org/seed/manifests/"))
+				w.WriteHeader(http.StatusAccepted)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		client, err := NewClient("")
+		Expect(err).ToNot(HaveOccurred())
+		client.http = server.Client()
+		ref, err := ParseReference(strings.TrimPrefix(server.URL, "https://") + "/org/seed")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(client.ListTags(ref)).To(Equal([]string{"v1", "v2", "v3"}))
+		Expect(client.DeleteManifest(ref)).To(MatchError(ContainSubstring("digest is required")))
+		ref.Digest = "sha256:123"
+		Expect(client.DeleteManifest(ref)).To(Succeed())
+		Expect(deleted).To(Equal([]string{"sha256:123"}))
+	})
+})
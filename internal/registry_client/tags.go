@@ -0,0 +1,80 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry_client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// tagsPageSize is the number of tags asked per page of the tag list
+const tagsPageSize = 100
+
+// nextLink matches the Link header of the next page of a paginated list
+var nextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// ListTags returns the tags of the repository, following the pagination of the registry
+func (c *Client) ListTags(ref Reference) ([]string, error) {
+	var (
+		tags    []string
+		pageURL = fmt.Sprintf("https://%s/v2/%s/tags/list?n=%d", ref.endpoint(), ref.Repository, tagsPageSize)
+	)
+	for pageURL != "" {
+		resp, err := c.do(http.MethodGet, pageURL, ref, "pull", nil, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to list the tags of %s", ref.Name())
+		}
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse the tags of %s", ref.Name())
+		}
+		tags = append(tags, page.Tags...)
+
+		pageURL = ""
+		if match := nextLink.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+			next, err := resp.Request.URL.Parse(match[1])
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid next page link %q", match[1])
+			}
+			pageURL = next.String()
+		}
+	}
+	return tags, nil
+}
+
+// DeleteManifest deletes the manifest of the reference digest, untagging every tag pointing to it
+func (c *Client) DeleteManifest(ref Reference) error {
+	if ref.Digest == "" {
+		return errors.Errorf("A digest is required to delete the manifest of %s", ref)
+	}
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", ref.endpoint(), ref.Repository, ref.Digest)
+	// Registries differ on the action deletes need, asking for them all gets whichever is granted
+	resp, err := c.do(http.MethodDelete, manifestURL, ref, "pull,push,delete", nil, nil)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to delete the manifest of %s", ref)
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,289 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rehearsal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"ibu-imager/internal/ops"
+)
+
+const (
+	// DefaultLibvirtURI is the libvirt connection the scratch VM is created through
+	DefaultLibvirtURI = "qemu:///system"
+	// DefaultNetwork is the libvirt network the scratch VM is attached to
+	DefaultNetwork = "default"
+	// DefaultReadyTimeout is how long the restored node has to become Ready
+	DefaultReadyTimeout = 30 * time.Minute
+	// workDir holds the overlay disks of the scratch VMs
+	workDir = "/var/tmp/ibu-rehearse"
+	// bootTimeout is how long the scratch VM has to get an address and answer over SSH
+	bootTimeout = 10 * time.Minute
+	// pollInterval is the wait between two checks of the scratch VM state
+	pollInterval = 10 * time.Second
+	// bootIDFile changes on every boot, telling the VM rebooted into the new stateroot
+	bootIDFile = "/proc/sys/kernel/random/boot_id"
+)
+
+// Config is the seed rehearsed and the scratch VM it's restored on
+type Config struct {
+	// SeedImage is the seed image to rehearse
+	SeedImage string
+	// ImagerImage is the imager container image running the restore on the VM
+	ImagerImage string
+	// BaseDisk is the qcow2 disk of a target SNO, the VM boots from an overlay of it
+	BaseDisk string
+	// AuthFile is the registry credentials on the VM, to pull the seed and imager images
+	AuthFile string
+	// Kubeconfig is the node kubeconfig on the VM, to check the node readiness
+	Kubeconfig string
+	// SSHUser and SSHKeyFile authenticate to the VM
+	SSHUser    string
+	SSHKeyFile string
+	LibvirtURI string
+	Network    string
+	MemoryMiB  int
+	CPUs       int
+	// ReadyTimeout is how long the restored node has to become Ready
+	ReadyTimeout time.Duration
+	// Keep leaves the VM and its overlay disk around, for investigation
+	Keep bool
+}
+
+// Validate checks the config is complete
+func (c *Config) Validate() error {
+	if c.SeedImage == "" {
+		return errors.New("a seed image is required")
+	}
+	if c.ImagerImage == "" {
+		return errors.New("an imager image is required")
+	}
+	if c.BaseDisk == "" {
+		return errors.New("a base disk is required")
+	}
+	if _, err := os.Stat(c.BaseDisk); err != nil {
+		return errors.Wrap(err, "Failed to find the base disk")
+	}
+	if c.MemoryMiB < 1 || c.CPUs < 1 {
+		return errors.Errorf("the VM needs memory and CPUs, got %d MiB and %d CPUs", c.MemoryMiB, c.CPUs)
+	}
+	return nil
+}
+
+// Result is the outcome of a rehearsal
+type Result struct {
+	VM       string        `json:"vm"`
+	Address  string        `json:"address,omitempty"`
+	Ready    bool          `json:"ready"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Rehearsal restores a seed on a scratch VM booted from an overlay of a target SNO disk, leaving
+// the base disk untouched, and checks that the restored node becomes Ready
+type Rehearsal struct {
+	log      *logrus.Logger
+	executor ops.Execute
+	config   Config
+	name     string
+	overlay  string
+	interval time.Duration
+}
+
+func NewRehearsal(log *logrus.Logger, executor ops.Execute, config Config) *Rehearsal {
+	name := fmt.Sprintf("ibu-rehearse-%d", time.Now().Unix())
+	return &Rehearsal{
+		log:      log,
+		executor: executor,
+		config:   config,
+		name:     name,
+		overlay:  filepath.Join(workDir, name+".qcow2"),
+		interval: pollInterval,
+	}
+}
+
+// Run boots the scratch VM, restores the seed on it, reboots it into the new stateroot and waits
+// for the node to become Ready. The VM is deleted afterwards unless Keep is set.
+func (r *Rehearsal) Run() *Result {
+	start := time.Now()
+	result := &Result{VM: r.name}
+	err := r.run(result)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Duration = time.Since(start)
+
+	if r.config.Keep {
+		r.log.Infof("Keeping VM %s and its disk %s", r.name, r.overlay)
+	} else {
+		r.deleteVM()
+	}
+	return result
+}
+
+func (r *Rehearsal) run(result *Result) error {
+	if err := r.createVM(); err != nil {
+		return err
+	}
+	address, err := r.waitForAddress()
+	if err != nil {
+		return err
+	}
+	result.Address = address
+	vm := ops.NewSSHOps(r.log, r.executor, ops.SSHConfig{
+		Host:             address,
+		User:             r.config.SSHUser,
+		KeyFile:          r.config.SSHKeyFile,
+		SkipHostKeyCheck: true,
+	})
+
+	var bootID string
+	if err = r.poll(bootTimeout, "SSH on "+address, func() (bool, error) {
+		id, err := vm.RunInHostNamespace("cat", bootIDFile)
+		bootID = id
+		return err == nil, err
+	}); err != nil {
+		return err
+	}
+
+	r.log.Infof("Restoring %s on VM %s", r.config.SeedImage, r.name)
+	stream, err := vm.RunInHostNamespaceStream("podman", r.restoreArgs()...)
+	if err == nil {
+		err = ops.LogStream(r.log, stream)
+	}
+	if err != nil {
+		return errors.Wrap(err, "Failed to restore the seed on the VM")
+	}
+
+	// The SSH connection is cut by the reboot, so its outcome tells nothing
+	r.log.Info("Rebooting the VM into the new stateroot")
+	_, _ = vm.SystemctlAction("reboot")
+	if err = r.poll(bootTimeout, "the VM reboot", func() (bool, error) {
+		id, err := vm.RunInHostNamespace("cat", bootIDFile)
+		return err == nil && id != bootID, err
+	}); err != nil {
+		return err
+	}
+
+	r.log.Info("Waiting for the restored node to become Ready")
+	if err = r.poll(r.config.ReadyTimeout, "the node to become Ready", func() (bool, error) {
+		status, err := vm.RunInHostNamespace("oc", "get", "nodes", "--kubeconfig", r.config.Kubeconfig,
+			"-o", `jsonpath={.items[*].status.conditions[?(@.type=="Ready")].status}`)
+		return err == nil && status == "True", err
+	}); err != nil {
+		return err
+	}
+	result.Ready = true
+	return nil
+}
+
+// restoreArgs returns the podman arguments running the imager restore on the VM
+func (r *Rehearsal) restoreArgs() []string {
+	return []string{"run", "--privileged", "--pid=host", "--rm", "--net=host",
+		"--authfile", r.config.AuthFile,
+		"-v", "/etc:/etc", "-v", "/var:/var", "-v", "/var/run:/var/run", "-v", "/sysroot:/sysroot",
+		r.config.ImagerImage, "restore", "--seed-image", r.config.SeedImage, "--authfile", r.config.AuthFile}
+}
+
+// createVM boots the scratch VM from a copy-on-write overlay of the base disk
+func (r *Rehearsal) createVM() error {
+	if err := os.MkdirAll(filepath.Dir(r.overlay), 0700); err != nil {
+		return errors.Wrap(err, "Failed to create rehearsal work dir")
+	}
+	r.log.Infof("Creating VM %s from %s", r.name, r.config.BaseDisk)
+	baseDisk, err := filepath.Abs(r.config.BaseDisk)
+	if err != nil {
+		return err
+	}
+	if _, err = r.executor.Execute("qemu-img", "create", "-f", "qcow2", "-F", "qcow2", "-b", baseDisk, r.overlay); err != nil {
+		return errors.Wrap(err, "Failed to create the VM overlay disk")
+	}
+	if _, err = r.executor.Execute("virt-install", "--connect", r.config.LibvirtURI, "--name", r.name,
+		"--memory", fmt.Sprint(r.config.MemoryMiB), "--vcpus", fmt.Sprint(r.config.CPUs),
+		"--disk", "path="+r.overlay+",format=qcow2,bus=virtio", "--network", "network="+r.config.Network,
+		"--import", "--os-variant", "rhel9.0", "--graphics", "none", "--noautoconsole"); err != nil {
+		return errors.Wrap(err, "Failed to create the VM")
+	}
+	return nil
+}
+
+// waitForAddress returns the IPv4 address the VM was leased by the libvirt network
+func (r *Rehearsal) waitForAddress() (string, error) {
+	var address string
+	err := r.poll(bootTimeout, "the VM address", func() (bool, error) {
+		output, err := r.executor.Execute("virsh", "--connect", r.config.LibvirtURI, "domifaddr", r.name, "--source", "lease")
+		if err == nil {
+			address = ParseDomainAddress(output)
+		}
+		return address != "", err
+	})
+	if err == nil {
+		r.log.Infof("VM %s has address %s", r.name, address)
+	}
+	return address, err
+}
+
+// deleteVM deletes the VM and its overlay disk, logging failures since the result stands anyway
+func (r *Rehearsal) deleteVM() {
+	r.log.Infof("Deleting VM %s", r.name)
+	// destroy fails when the VM was never started or already stopped, undefine tells what's left
+	_, _ = r.executor.Execute("virsh", "--connect", r.config.LibvirtURI, "destroy", r.name)
+	if _, err := r.executor.Execute("virsh", "--connect", r.config.LibvirtURI, "undefine", r.name); err != nil {
+		r.log.Warnf("Failed to delete VM %s: %v", r.name, err)
+	}
+	if err := os.Remove(r.overlay); err != nil && !os.IsNotExist(err) {
+		r.log.Warnf("Failed to delete VM disk %s: %v", r.overlay, err)
+	}
+}
+
+// poll calls check until it's done or the timeout expires, the check errors are only reported on timeout
+func (r *Rehearsal) poll(timeout time.Duration, what string, check func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		done, err := check()
+		if done {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return errors.Wrapf(err, "Timed out waiting for %s", what)
+			}
+			return errors.Errorf("Timed out waiting for %s", what)
+		}
+		r.log.Debugf("Waiting for %s", what)
+		time.Sleep(r.interval)
+	}
+}
+
+// ParseDomainAddress returns the first IPv4 address of `virsh domifaddr` output, empty if none
+func ParseDomainAddress(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 4 && fields[2] == "ipv4" {
+			address, _, _ := strings.Cut(fields[3], "/")
+			return address
+		}
+	}
+	return ""
+}
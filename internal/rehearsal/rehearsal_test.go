@@ -0,0 +1,61 @@
+package rehearsal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	"ibu-imager/internal/ops"
+)
+
+func TestRehearsal(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Rehearsal Suite")
+}
+
+var _ = Describe("Rehearsal", func() {
+	It("Parses the VM address out of virsh domifaddr", func() {
+		output := ` Name       MAC address          Protocol     Address
+-------------------------------------------------------------------------------
+ vnet0      52:54:00:12:34:56    ipv6         fd00::10/64
+ vnet0      52:54:00:12:34:56    ipv4         192.168.122.45/24
+`
+		Expect(ParseDomainAddress(output)).To(Equal("192.168.122.45"))
+		Expect(ParseDomainAddress(" Name       MAC address          Protocol     Address\n---\n")).To(BeEmpty())
+	})
+
+	It("Validates the config", func() {
+		tmpDir, _ := os.MkdirTemp("", "test")
+		defer os.RemoveAll(tmpDir)
+		disk := filepath.Join(tmpDir, "sno.qcow2")
+		Expect(os.WriteFile(disk, nil, 0600)).To(Succeed())
+
+		config := Config{SeedImage: "quay.io/org/seed:oneimage", ImagerImage: "quay.io/org/ibu-imager:latest", BaseDisk: disk, MemoryMiB: 16384, CPUs: 8}
+		Expect(config.Validate()).To(Succeed())
+		config.BaseDisk = filepath.Join(tmpDir, "missing.qcow2")
+		Expect(config.Validate()).ToNot(Succeed())
+	})
+
+	It("Deletes the VM when the rehearsal fails", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		executorMock := ops.NewMockExecute(ctrl)
+		rehearsal := NewRehearsal(logrus.New(), executorMock, Config{BaseDisk: "/sno.qcow2", LibvirtURI: DefaultLibvirtURI})
+		rehearsal.overlay = filepath.Join(os.TempDir(), rehearsal.name+".qcow2")
+
+		gomock.InOrder(
+			executorMock.EXPECT().Execute("qemu-img", "create", "-f", "qcow2", "-F", "qcow2", "-b", "/sno.qcow2", rehearsal.overlay).Return("", nil),
+			executorMock.EXPECT().Execute("virt-install", gomock.Any()).Return("", fmt.Errorf("Dummy")),
+			executorMock.EXPECT().Execute("virsh", "--connect", DefaultLibvirtURI, "destroy", rehearsal.name).Return("", fmt.Errorf("Not running")),
+			executorMock.EXPECT().Execute("virsh", "--connect", DefaultLibvirtURI, "undefine", rehearsal.name).Return("", nil),
+		)
+		result := rehearsal.Run()
+		Expect(result.Ready).To(BeFalse())
+		Expect(result.Error).To(ContainSubstring("Failed to create the VM"))
+	})
+})
@@ -0,0 +1,190 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_usage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// cgroupRoot is where the cgroup v2 hierarchy is mounted
+	cgroupRoot = "/sys/fs/cgroup"
+	// procCgroup tells the cgroup of the imager itself
+	procCgroup = "/proc/self/cgroup"
+
+	// Scope tells what the usage accounts for. The containers are started by podman in cgroups of their own,
+	// outside the imager's, and removed with them when they exit, so their usage can't be collected.
+	Scope = "the imager and the host commands it runs, excluding the containers it starts (the recert etcd and recert)"
+)
+
+// Usage is the resources consumed by the imager and the commands it spawned over a period
+type Usage struct {
+	CPUTime time.Duration `json:"cpuTime"`
+	// PeakMemory is the peak memory of the cgroup in bytes, page cache included. It's only known
+	// on kernels supporting memory.peak resets (6.12+).
+	PeakMemory   int64 `json:"peakMemory,omitempty"`
+	ReadBytes    int64 `json:"readBytes"`
+	WrittenBytes int64 `json:"writtenBytes"`
+}
+
+// Meter accounts the resources used through the cgroup of the imager. The host commands run
+// through nsenter stay in that cgroup, so their usage is accounted along with the imager's, the
+// containers don't, see Scope.
+type Meter struct {
+	dir string
+}
+
+// NewMeter returns a meter of the imager's own cgroup, which must be a cgroup v2 one
+func NewMeter() (*Meter, error) {
+	return newMeter(cgroupRoot, procCgroup)
+}
+
+func newMeter(root, procFile string) (*Meter, error) {
+	data, err := os.ReadFile(procFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read the imager cgroup")
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// The cgroup v2 hierarchy has id 0 and no controllers listed
+		if cgroup, found := strings.CutPrefix(line, "0::"); found {
+			dir := filepath.Join(root, cgroup)
+			if _, err = os.Stat(filepath.Join(dir, "cpu.stat")); err != nil {
+				return nil, errors.Wrapf(err, "Failed to find cgroup %s", cgroup)
+			}
+			return &Meter{dir: dir}, nil
+		}
+	}
+	return nil, errors.New("The imager doesn't run in a cgroup v2 hierarchy")
+}
+
+// Sample is a running measure of the resource usage, started by Meter.Start
+type Sample struct {
+	dir   string
+	start Usage
+	// peak is the memory.peak file reset at start, nil when resets aren't supported
+	peak *os.File
+}
+
+// Start starts measuring the resource usage, until the returned sample is stopped
+func (m *Meter) Start() (*Sample, error) {
+	start, err := readUsage(m.dir)
+	if err != nil {
+		return nil, err
+	}
+	sample := &Sample{dir: m.dir, start: start}
+
+	// Writing to memory.peak resets the peak as seen through that file descriptor only, older
+	// kernels refuse the write
+	if file, err := os.OpenFile(filepath.Join(m.dir, "memory.peak"), os.O_RDWR, 0); err == nil {
+		if _, err = file.WriteString("reset\n"); err == nil {
+			sample.peak = file
+		} else {
+			file.Close()
+		}
+	}
+	return sample, nil
+}
+
+// Stop returns the resources used since the sample was started
+func (s *Sample) Stop() (Usage, error) {
+	end, err := readUsage(s.dir)
+	if err != nil {
+		return Usage{}, err
+	}
+	usage := Usage{
+		CPUTime:      end.CPUTime - s.start.CPUTime,
+		ReadBytes:    end.ReadBytes - s.start.ReadBytes,
+		WrittenBytes: end.WrittenBytes - s.start.WrittenBytes,
+	}
+
+	if s.peak != nil {
+		defer s.peak.Close()
+		if _, err = s.peak.Seek(0, io.SeekStart); err != nil {
+			return usage, errors.Wrap(err, "Failed to read memory.peak")
+		}
+		data, err := io.ReadAll(s.peak)
+		if err != nil {
+			return usage, errors.Wrap(err, "Failed to read memory.peak")
+		}
+		if usage.PeakMemory, err = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err != nil {
+			return usage, errors.Wrap(err, "Failed to parse memory.peak")
+		}
+	}
+	return usage, nil
+}
+
+// readUsage reads the cumulative CPU time and I/O of the cgroup in dir. The I/O of cgroups without
+// the io controller enabled is unknown and left to zero.
+func readUsage(dir string) (Usage, error) {
+	var usage Usage
+	cpuStat, err := readKeyedFile(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return usage, err
+	}
+	usage.CPUTime = time.Duration(cpuStat["usage_usec"]) * time.Microsecond
+
+	data, err := os.ReadFile(filepath.Join(dir, "io.stat"))
+	if os.IsNotExist(err) {
+		return usage, nil
+	}
+	if err != nil {
+		return usage, errors.Wrap(err, "Failed to read io.stat")
+	}
+	// Each line is a device followed by its key=value counters, e.g. "8:0 rbytes=1024 wbytes=0 ..."
+	for _, line := range strings.Split(string(data), "\n") {
+		for _, field := range strings.Fields(line) {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				continue
+			}
+			n, _ := strconv.ParseInt(value, 10, 64)
+			switch key {
+			case "rbytes":
+				usage.ReadBytes += n
+			case "wbytes":
+				usage.WrittenBytes += n
+			}
+		}
+	}
+	return usage, nil
+}
+
+// readKeyedFile parses a flat keyed cgroup file, made of "key value" lines
+func readKeyedFile(file string) (map[string]int64, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read %s", filepath.Base(file))
+	}
+	values := map[string]int64{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if n, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			values[fields[0]] = n
+		}
+	}
+	return values, nil
+}
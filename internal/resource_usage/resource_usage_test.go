@@ -0,0 +1,65 @@
+package resource_usage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestResourceUsage(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Resource Usage Suite")
+}
+
+var _ = Describe("Resource usage", func() {
+	var root, cgroupDir string
+
+	BeforeEach(func() {
+		root, _ = os.MkdirTemp("", "test")
+		cgroupDir = filepath.Join(root, "machine.slice", "imager.scope")
+		Expect(os.MkdirAll(cgroupDir, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, "cgroup"), []byte("0::/machine.slice/imager.scope\n"), 0644)).To(Succeed())
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(root)).To(Succeed())
+	})
+
+	writeFile := func(name, content string) {
+		Expect(os.WriteFile(filepath.Join(cgroupDir, name), []byte(content), 0644)).To(Succeed())
+	}
+
+	It("Measures the CPU time, I/O and peak memory of a period", func() {
+		writeFile("cpu.stat", "usage_usec 1000000\nuser_usec 800000\nsystem_usec 200000\n")
+		writeFile("io.stat", "8:0 rbytes=1024 wbytes=2048 rios=1 wios=2\n")
+		writeFile("memory.peak", "100\n")
+		meter, err := newMeter(root, filepath.Join(root, "cgroup"))
+		Expect(err).ToNot(HaveOccurred())
+
+		sample, err := meter.Start()
+		Expect(err).ToNot(HaveOccurred())
+		writeFile("cpu.stat", "usage_usec 3500000\nuser_usec 3000000\nsystem_usec 500000\n")
+		writeFile("io.stat", "8:0 rbytes=4096 wbytes=2048 rios=3 wios=2\n253:0 rbytes=0 wbytes=512 rios=0 wios=1\n")
+		writeFile("memory.peak", "1048576\n")
+
+		Expect(sample.Stop()).To(Equal(Usage{CPUTime: 2500 * time.Millisecond, PeakMemory: 1048576, ReadBytes: 3072, WrittenBytes: 512}))
+	})
+
+	It("Leaves the I/O and peak memory unknown without the controllers", func() {
+		writeFile("cpu.stat", "usage_usec 0\n")
+		meter, err := newMeter(root, filepath.Join(root, "cgroup"))
+		Expect(err).ToNot(HaveOccurred())
+		sample, err := meter.Start()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sample.Stop()).To(Equal(Usage{}))
+	})
+
+	It("Requires a cgroup v2 hierarchy", func() {
+		Expect(os.WriteFile(filepath.Join(root, "cgroup"), []byte("12:cpu,cpuacct:/imager\n"), 0644)).To(Succeed())
+		_, err := newMeter(root, filepath.Join(root, "cgroup"))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,146 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schedule
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// statusInterval is how often the remaining waiting time is logged
+	statusInterval = time.Minute
+	// maxCronLookahead bounds the search of the next cron match
+	maxCronLookahead = 366 * 24 * time.Hour
+)
+
+// cronField is the allowed range of a cron expression field
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	{name: "day of week", min: 0, max: 6},
+}
+
+// NextStart returns when the maintenance window described by spec opens. The spec is either an
+// RFC3339 timestamp or a 5-field cron expression (minute hour day-of-month month day-of-week),
+// in which case the next matching minute after now is returned. Unlike crontab, restricting both
+// the day of month and the day of week requires both to match.
+func NextStart(spec string, now time.Time) (time.Time, error) {
+	if at, err := time.Parse(time.RFC3339, spec); err == nil {
+		return at, nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return time.Time{}, errors.Errorf("%q is neither an RFC3339 timestamp nor a 5-field cron expression", spec)
+	}
+	allowed := make([]map[int]bool, len(fields))
+	for i, field := range fields {
+		values, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return time.Time{}, err
+		}
+		allowed[i] = values
+	}
+
+	t := now.Truncate(time.Minute).Add(time.Minute)
+	for end := now.Add(maxCronLookahead); t.Before(end); t = t.Add(time.Minute) {
+		if allowed[0][t.Minute()] && allowed[1][t.Hour()] && allowed[2][t.Day()] &&
+			allowed[3][int(t.Month())] && allowed[4][int(t.Weekday())] {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("cron expression %q never matches", spec)
+}
+
+// parseCronField parses a comma separated list of *, values, ranges and steps (e.g. 1-5/2)
+func parseCronField(field string, spec cronField) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return nil, errors.Errorf("invalid step %q in cron %s field", stepPart, spec.name)
+			}
+		}
+
+		low, high := spec.min, spec.max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = strconv.Atoi(lowPart); err != nil {
+				return nil, errors.Errorf("invalid value %q in cron %s field", lowPart, spec.name)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(highPart); err != nil {
+					return nil, errors.Errorf("invalid value %q in cron %s field", highPart, spec.name)
+				}
+			} else if hasStep {
+				high = spec.max
+			}
+		}
+		if low < spec.min || high > spec.max || low > high {
+			return nil, errors.Errorf("cron %s field %q out of range %d-%d", spec.name, part, spec.min, spec.max)
+		}
+		for v := low; v <= high; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+// WaitUntil blocks until the given time, logging the remaining time periodically. It returns
+// the context error if the context is cancelled before.
+func WaitUntil(ctx context.Context, log *logrus.Logger, at time.Time) error {
+	remaining := time.Until(at)
+	if remaining <= 0 {
+		return nil
+	}
+	log.Infof("Waiting for the maintenance window to open at %s", at.Format(time.RFC3339))
+
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "Cancelled while waiting for the maintenance window")
+		case <-ticker.C:
+			log.Infof("Maintenance window opens in %s", time.Until(at).Round(time.Second))
+		case <-timer.C:
+			log.Info("Maintenance window is open")
+			return nil
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSchedule(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Schedule Suite")
+}
+
+var _ = Describe("Maintenance window start", func() {
+	now := time.Date(2023, 10, 4, 10, 30, 15, 0, time.UTC) // Wednesday
+
+	It("Accepts RFC3339 timestamps", func() {
+		Expect(NextStart("2023-10-05T02:00:00Z", now)).To(Equal(time.Date(2023, 10, 5, 2, 0, 0, 0, time.UTC)))
+	})
+
+	It("Finds the next cron match", func() {
+		Expect(NextStart("0 2 * * *", now)).To(Equal(time.Date(2023, 10, 5, 2, 0, 0, 0, time.UTC)))
+		Expect(NextStart("*/15 * * * *", now)).To(Equal(time.Date(2023, 10, 4, 10, 45, 0, 0, time.UTC)))
+		Expect(NextStart("0 3 * * 0,6", now)).To(Equal(time.Date(2023, 10, 7, 3, 0, 0, 0, time.UTC)))
+	})
+
+	It("Rejects invalid specs", func() {
+		_, err := NextStart("tomorrow", now)
+		Expect(err).To(HaveOccurred())
+		_, err = NextStart("0 25 * * *", now)
+		Expect(err).To(HaveOccurred())
+	})
+})
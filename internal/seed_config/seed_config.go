@@ -0,0 +1,105 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package seed_config reads the seed config file of the create command, so pipelines can version the
+// seed creation parameters instead of spelling them as flags. Its keys are the create flag names, e.g.
+//
+//	registry: quay.io/org/seed
+//	recert-image: quay.io/edge-infrastructure/recert:v0
+//	skip-steps: [image-store]
+//	strict: true
+package seed_config
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Setting is a flag value of the seed config, in the flag syntax
+type Setting struct {
+	Flag  string
+	Value string
+}
+
+// Load reads a seed config file
+func Load(file string) ([]Setting, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read seed config %s", file)
+	}
+	settings, err := Parse(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Seed config %s", file)
+	}
+	return settings, nil
+}
+
+// Parse parses a seed config into its settings, sorted by flag. Values are scalars, or lists of scalars
+// for the flags taking several values.
+func Parse(data []byte) ([]Setting, error) {
+	var config map[string]yaml.Node
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&config); err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "Failed to parse seed config")
+	}
+
+	settings := make([]Setting, 0, len(config))
+	for flag, node := range config {
+		value, err := flagValue(&node)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid %s", flag)
+		}
+		settings = append(settings, Setting{Flag: flag, Value: value})
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Flag < settings[j].Flag })
+	return settings, nil
+}
+
+// flagValue returns the value of the node in the flag syntax, lists being comma separated
+func flagValue(node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			return "", errors.New("no value given")
+		}
+		return node.Value, nil
+	case yaml.SequenceNode:
+		values := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", errors.New("lists must only have values")
+			}
+			values = append(values, item.Value)
+		}
+		// The list flags read their values as a CSV record, values with commas must be quoted
+		var record strings.Builder
+		writer := csv.NewWriter(&record)
+		if err := writer.Write(values); err != nil {
+			return "", err
+		}
+		writer.Flush()
+		return strings.TrimSuffix(record.String(), "\n"), writer.Error()
+	default:
+		return "", errors.New("expected a value or a list of values")
+	}
+}
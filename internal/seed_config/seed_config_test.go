@@ -0,0 +1,46 @@
+package seed_config
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSeedConfig(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Seed Config Suite")
+}
+
+var _ = Describe("Seed config", func() {
+	It("Parses the settings in the flag syntax", func() {
+		settings, err := Parse([]byte(`registry: quay.io/org/seed
+strict: true
+precache-plan-workers: 8
+exclude-registries: [docker.io, "a,b"]
+`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(settings).To(Equal([]Setting{
+			{Flag: "exclude-registries", Value: `docker.io,"a,b"`},
+			{Flag: "precache-plan-workers", Value: "8"},
+			{Flag: "registry", Value: "quay.io/org/seed"},
+			{Flag: "strict", Value: "true"},
+		}))
+	})
+
+	It("Refuses nested and missing values", func() {
+		_, err := Parse([]byte("recert:\n  image: quay.io/recert\n"))
+		Expect(err).To(MatchError(ContainSubstring("Invalid recert")))
+		_, err = Parse([]byte("skip-steps: [[lint]]\n"))
+		Expect(err).To(HaveOccurred())
+		_, err = Parse([]byte("registry:\n"))
+		Expect(err).To(MatchError(ContainSubstring("no value given")))
+		_, err = Parse([]byte("- registry\n"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Reports the unreadable files", func() {
+		_, err := Load("/nonexistent/seed.yaml")
+		Expect(err).To(MatchError(ContainSubstring("Failed to read seed config")))
+	})
+})
@@ -0,0 +1,71 @@
+package seed_creator
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	containers "ibu-imager/internal/container_runtime"
+	"ibu-imager/internal/ops"
+)
+
+// Abort unwinds an interrupted seed creation run, returning the node to a running cluster: the recert
+// helper containers are killed, the partial artifacts of the interrupted step removed, and CRI-O and
+// kubelet enabled and started again. Unlike Cleanup, the artifacts of the completed steps and the step
+// journal are kept, so the run can still be continued with create --resume.
+func Abort(log *logrus.Logger, op ops.Ops, runtime containers.Runtime, backupDir string, dryRun bool) error {
+	journal, err := readJournal(backupDir)
+	if err != nil {
+		return err
+	}
+	paths := []string{etcdScratchDir(backupDir)}
+	if journal == nil {
+		log.Infof("No step journal in %s, only the services are restored, cleanup removes the artifacts", backupDir)
+	} else {
+		paths = append(paths, partialArtifacts(journal, backupDir)...)
+	}
+	services := []string{"crio.service", "kubelet.service"}
+	if dryRun {
+		log.Infof("Dry run, would delete %v, and enable and start %v", paths, services)
+		return removeContainers(log, runtime, true)
+	}
+
+	if err = removeContainers(log, runtime, false); err != nil {
+		return err
+	}
+	log.Infof("Deleting %v", paths)
+	if _, err = op.RunInHostNamespace("rm", append([]string{"-rf"}, paths...)...); err != nil {
+		return errors.Wrap(err, "Failed to delete partial artifacts")
+	}
+	if err = restartServices(log, op, services); err != nil {
+		return err
+	}
+	log.Info("Seed creation aborted, the node is back to running the cluster")
+	return nil
+}
+
+// partialArtifacts returns the artifacts of the step the run was interrupted in, the first one missing
+// from the journal
+func partialArtifacts(journal *stepJournal, backupDir string) []string {
+	for _, step := range Steps() {
+		if (step.masterOnly && journal.NodeRole == NodeRoleWorker) || journal.completed(step.Name) {
+			continue
+		}
+		return stepArtifacts(step, backupDir)
+	}
+	return nil
+}
+
+// stepArtifacts returns the paths of the artifacts the step writes to the backup dir
+func stepArtifacts(step Step, backupDir string) []string {
+	var paths []string
+	for _, artifact := range step.Artifacts {
+		// Placeholder names aren't known before the step runs
+		if !strings.Contains(artifact, "<") {
+			paths = append(paths, path.Join(backupDir, artifact))
+		}
+	}
+	return paths
+}
@@ -0,0 +1,63 @@
+package seed_creator
+
+import (
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// auditLogsFile holds the audit logs and login records. It's only produced on request, since
+	// some compliance regimes forbid audit trails from leaving the site.
+	auditLogsFile = "audit-logs.tgz"
+)
+
+const (
+	// AuditLogPolicyExclude leaves the audit logs and login records out of the seed, the default
+	AuditLogPolicyExclude = "exclude"
+	// AuditLogPolicyInclude carries the audit logs and login records in the seed
+	AuditLogPolicyInclude = "include"
+)
+
+// auditLogPaths are the audit logs and login records captured, relative to /. They live under
+// /var/log, which is excluded from the /var backup.
+var auditLogPaths = []string{
+	"var/log/audit",
+	"var/log/wtmp",
+	"var/log/btmp",
+	"var/log/lastlog",
+}
+
+// ValidateAuditLogPolicy checks that the given audit log policy is supported
+func ValidateAuditLogPolicy(policy string) error {
+	switch policy {
+	case AuditLogPolicyExclude, AuditLogPolicyInclude:
+		return nil
+	default:
+		return errors.Errorf("unsupported audit log policy %q, must be one of: %s, %s", policy,
+			AuditLogPolicyExclude, AuditLogPolicyInclude)
+	}
+}
+
+// backupAuditLogs archives the audit logs and login records, when the policy includes them
+func (s *SeedCreator) backupAuditLogs() error {
+	if s.auditLogPolicy != AuditLogPolicyInclude {
+		s.log.Debug("Skipping audit logs backup, excluded by policy")
+		return nil
+	}
+
+	auditLogsTar := path.Join(s.backupDir, auditLogsFile)
+	_, err := os.Stat(auditLogsTar)
+	if err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	s.log.Warn("Including the audit logs and login records in the seed image")
+	args := append([]string{"czf", auditLogsTar, "--selinux", "--ignore-failed-read", "-C", "/"}, auditLogPaths...)
+	if _, err = s.ops.RunInHostNamespace("tar", args...); err != nil {
+		return errors.Wrap(err, "Failed to backup audit logs")
+	}
+	s.log.Println("Backup of audit logs created successfully.")
+	return nil
+}
@@ -0,0 +1,137 @@
+package seed_creator
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultBackupDir is where the artifacts are written and the seed image is built from by default, in
+	// /var/tmp which the /var backup excludes
+	DefaultBackupDir = "/var/tmp/backup"
+
+	// backupDirMarker marks the backup dirs created by the imager, the only ones the cleanup deletes
+	backupDirMarker = ".ibu-imager-backup-dir"
+	// scratchDir holds the temporary files of the run in the backup dir, e.g. the etcd copy of the recert
+	// dry-run, so they're in the configured filesystem too. It isn't a seed artifact.
+	scratchDir = ".scratch"
+	// buildIgnoreFile keeps the scratch dir out of the build context of the seed image
+	buildIgnoreFile = ".dockerignore"
+)
+
+// reservedDirs are the host dirs the backup dir can't be in: they're backed up, read by the seed
+// creation or not disk-backed
+var reservedDirs = []string{"/etc", "/usr", "/boot", "/ostree", "/sysroot", "/proc", "/sys", "/dev", "/run",
+	"/var/lib/etcd", "/var/lib/kubelet", "/var/lib/containers", "/var/lib/ibu-imager"}
+
+// sharedDirs are the host dirs holding the dirs of others, the backup dir can be in them but not be them
+var sharedDirs = []string{"/var/lib", "/var/home", "/home", "/var/roothome", "/root", "/var/tmp", "/tmp", "/var/mnt",
+	"/mnt", "/opt", "/var/opt", "/srv", "/var/srv"}
+
+// ValidateBackupDir refuses backup dirs that aren't absolute, or would hold or be held by the host dirs the
+// seed is created from. The cleanup deletes the backup dir, it must be a dir of its own.
+func ValidateBackupDir(dir string) error {
+	if !path.IsAbs(dir) {
+		return errors.Errorf("The backup dir %s must be an absolute path", dir)
+	}
+	dir = path.Clean(dir)
+	if dir == "/" || dir == varFolder {
+		return errors.Errorf("The backup dir can't be %s, use a dir of its own", dir)
+	}
+	for _, shared := range sharedDirs {
+		if dir == shared {
+			return errors.Errorf("The backup dir can't be %s, use a dir of its own", dir)
+		}
+	}
+	for _, reserved := range reservedDirs {
+		if dir == reserved || strings.HasPrefix(dir, reserved+"/") {
+			return errors.Errorf("The backup dir can't be in %s", reserved)
+		}
+	}
+	return nil
+}
+
+// backupDirExcludePattern returns the pattern excluding the backup dir from the /var backup, empty when
+// it's out of /var or already excluded by the patterns, e.g. in /var/tmp while they exclude /var/tmp
+func backupDirExcludePattern(dir string, patterns []string) string {
+	dir = path.Clean(dir)
+	if !strings.HasPrefix(dir, varFolder+"/") || excludedBy(dir+"/*", patterns) {
+		return ""
+	}
+	return dir + "/*"
+}
+
+// excludedBy returns true if one of the <dir>/* patterns already excludes the path of the pattern
+func excludedBy(pattern string, patterns []string) bool {
+	for _, other := range patterns {
+		if strings.HasSuffix(other, "/*") && strings.HasPrefix(pattern, strings.TrimSuffix(other, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareBackupDir creates the backup dir and marks it as the imager's. An existing dir must be empty or
+// marked already, the imager would otherwise write into and the cleanup delete the files of others.
+func prepareBackupDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Failed to read backup dir %s", dir)
+	}
+	if len(entries) > 0 && !ownedBackupDir(dir) {
+		return errors.Errorf("The backup dir %s isn't empty and wasn't created by the imager, use a dir of its own", dir)
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return errors.Wrap(os.WriteFile(path.Join(dir, backupDirMarker), nil, 0600), "Failed to mark backup dir")
+}
+
+// ownedBackupDir returns true if the imager created the backup dir. The default one predates the marker and
+// was only ever the imager's.
+func ownedBackupDir(dir string) bool {
+	if path.Clean(dir) == DefaultBackupDir {
+		return true
+	}
+	_, err := os.Stat(path.Join(dir, backupDirMarker))
+	return err == nil
+}
+
+// scratchPath returns the path of the temporary file or dir in the scratch dir of the backup dir
+func scratchPath(backupDir, name string) string {
+	return path.Join(backupDir, scratchDir, name)
+}
+
+// etcdScratchDir is where the etcd data is copied when the recert dry-run must not touch the live data
+func etcdScratchDir(backupDir string) string {
+	return scratchPath(backupDir, "recert-etcd")
+}
+
+// imageStoreDir is the containers-storage root the images are composed into
+func imageStoreDir(backupDir string) string {
+	return scratchPath(backupDir, "image-store")
+}
+
+// imageStoreBuildDir is the build context of the image store image
+func imageStoreBuildDir(backupDir string) string {
+	return scratchPath(backupDir, "image-store-build")
+}
+
+// createScratchFile creates a temporary file in the scratch dir of the backup dir
+func (s *SeedCreator) createScratchFile(pattern string) (*os.File, error) {
+	dir := scratchPath(s.backupDir, "")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "Failed to create scratch dir")
+	}
+	file, err := os.CreateTemp(dir, pattern)
+	return file, errors.Wrap(err, "Error creating temporary file")
+}
+
+// isSeedArtifact returns false for the files of the backup dir that aren't seed artifacts: the manifest,
+// added last, and the hidden files of the imager, e.g. the journal and the scratch dir
+func isSeedArtifact(name string) bool {
+	return name != manifestFile && !strings.HasPrefix(name, ".")
+}
@@ -0,0 +1,77 @@
+package seed_creator
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// packageSteps are the steps packaging a collected backup dir into the seed image, in the order they run
+var packageSteps = []string{"lint", "write-manifest", "build-and-push"}
+
+// BuildSeedImage packages an existing, fully-populated backup dir, e.g. collected on another node or by
+// CI, into the seed image: only the manifest, lint, image build and push steps run, nothing is collected
+// from the host
+func (s *SeedCreator) BuildSeedImage() (err error) {
+	s.log.Println("Building seed image from", s.backupDir)
+	s.fromBackupDir = true
+	s.startReport()
+	defer func() { s.finishReport(err) }()
+
+	if s.imageStore {
+		return errors.New("The image store is composed from the host container storage, it can't be built from a backup dir")
+	}
+	if err = s.checkBackupDir(); err != nil {
+		return err
+	}
+	if err = s.resolveTag(); err != nil {
+		return err
+	}
+	if err = s.startDiskWatch(); err != nil {
+		return err
+	}
+	defer func() { err = s.stopDiskWatch(err) }()
+	for _, name := range packageSteps {
+		step, _ := FindStep(name)
+		if err = s.runStep(step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkBackupDir checks the backup dir holds the artifacts of every restore step and the .origin of
+// the deployment the seed was collected from, failing before anything is built
+func (s *SeedCreator) checkBackupDir() error {
+	var missing []string
+	for _, step := range s.restoreSteps() {
+		if step.Artifact == "" {
+			continue
+		}
+		if _, err := os.Stat(path.Join(s.backupDir, step.Artifact)); err != nil {
+			missing = append(missing, step.Artifact)
+		}
+	}
+	origins, err := filepath.Glob(path.Join(s.backupDir, "ostree-*.origin"))
+	if err != nil {
+		return err
+	}
+	if len(origins) == 0 {
+		missing = append(missing, "ostree-<deployment>.origin")
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("Backup dir %s isn't fully populated, missing %s", s.backupDir, strings.Join(missing, ", "))
+	}
+
+	// Optional artifacts the flags don't select aren't restored, the collecting run may have meant them to be
+	if _, err = os.Stat(path.Join(s.backupDir, coreUserFile)); err == nil && s.sshKeysPolicy == "" {
+		s.log.Warnf("%s is in the backup dir but no SSH keys policy is set, it won't be restored", coreUserFile)
+	}
+	if _, err = os.Stat(path.Join(s.backupDir, auditLogsFile)); err == nil && s.auditLogPolicy != AuditLogPolicyInclude {
+		s.log.Warnf("%s is in the backup dir but the audit logs aren't included, it won't be restored", auditLogsFile)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package seed_creator
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	cri "ibu-imager/internal/cri_client"
+	registry "ibu-imager/internal/registry_client"
+)
+
+const (
+	// ContainersListFile lists the images of the seed cluster, by digest and tag
+	ContainersListFile = "containers.list"
+	// CatalogImagesFile lists the catalog source images, as referenced by the catalog sources
+	CatalogImagesFile = "catalogimages.list"
+	// CatalogDigestsFile pins the catalog source images to the digests used by the seed cluster
+	CatalogDigestsFile = "catalogimages.json"
+)
+
+// CatalogImage is a catalog source image and the digest it resolved to at capture time
+type CatalogImage struct {
+	Image  string `json:"image"`
+	Digest string `json:"digest,omitempty"`
+}
+
+// catalogSourceList is the subset of `oc get catalogsource -o json` needed to find the catalog images
+type catalogSourceList struct {
+	Items []struct {
+		Spec struct {
+			Image string `json:"image"`
+		} `json:"spec"`
+	} `json:"items"`
+}
+
+// catalogSourceImages returns the sorted, unique images of the catalog sources kept by the registry
+// filters. Catalog sources served from an address have no image and are skipped.
+func catalogSourceImages(output []byte, filter cri.ImageFilter) ([]string, error) {
+	var list catalogSourceList
+	if err := json.Unmarshal(output, &list); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse `oc get catalogsource -o json` output")
+	}
+	var images []string
+	for _, item := range list.Items {
+		if item.Spec.Image != "" && filter.AllowsReference(item.Spec.Image) {
+			images = append(images, item.Spec.Image)
+		}
+	}
+	return cri.SortedUnique(images), nil
+}
+
+// saveCatalogImages saves the catalog source images to catalogimages.list
+func (s *SeedCreator) saveCatalogImages() error {
+	output, err := s.ops.RunInHostNamespace("oc", "get", "catalogsource", "-A", "-o", "json", "--kubeconfig", s.kubeconfig)
+	if err != nil {
+		return errors.Wrap(err, "Failed to list catalog sources")
+	}
+	images, err := catalogSourceImages([]byte(output), s.imageFilter)
+	if err != nil {
+		return err
+	}
+
+	var content string
+	for _, image := range images {
+		content += image + "\n"
+	}
+	return errors.Wrap(os.WriteFile(path.Join(s.backupDir, CatalogImagesFile), []byte(content), 0600),
+		"Failed to write catalog images")
+}
+
+// resolveCatalogImageDigests resolves the catalog source images to digests through the registry,
+// so precache on the target can pin the exact catalog content of the seed cluster. Images that
+// can't be resolved are recorded without a digest.
+func (s *SeedCreator) resolveCatalogImageDigests() error {
+	data, err := os.ReadFile(path.Join(s.backupDir, CatalogImagesFile))
+	if err != nil {
+		return errors.Wrap(err, "Failed to read catalog images")
+	}
+
+	client, err := registry.NewClient(s.authFile)
+	if err != nil {
+		return err
+	}
+
+	var catalogImages []CatalogImage
+	for _, image := range strings.Fields(string(data)) {
+		catalogImage := CatalogImage{Image: image}
+		ref, err := registry.ParseReference(image)
+		if err == nil {
+			catalogImage.Digest, err = client.ResolveDigest(ref)
+		}
+		if err != nil {
+			s.log.Warnf("Failed to resolve digest of catalog image %s: %v", image, err)
+		}
+		catalogImages = append(catalogImages, catalogImage)
+	}
+
+	data, err = json.MarshalIndent(catalogImages, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal catalog images")
+	}
+	return errors.Wrap(os.WriteFile(path.Join(s.backupDir, CatalogDigestsFile), data, 0600),
+		"Failed to write catalog images")
+}
@@ -0,0 +1,56 @@
+package seed_creator
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	containers "ibu-imager/internal/container_runtime"
+	"ibu-imager/internal/ops"
+)
+
+// Cleanup resets the host state left by a seed creation run, so the next run starts from scratch:
+// the backup dir and step markers are removed, leftover imager containers deleted, and CRI-O and
+// kubelet enabled and started again. The built images are kept, DeleteLocal removes them. Backup dirs
+// the imager didn't create are left in place, they may hold the files of others.
+func Cleanup(log *logrus.Logger, op ops.Ops, runtime containers.Runtime, backupDir string, dryRun bool) error {
+	paths := []string{containerListDoneFile, inputsFile, recertImageFile}
+	if ownedBackupDir(backupDir) {
+		paths = append([]string{backupDir}, paths...)
+	} else if _, err := os.Stat(backupDir); err == nil {
+		log.Warnf("The backup dir %s wasn't created by the imager, leaving it in place", backupDir)
+	}
+	services := []string{"crio.service", "kubelet.service"}
+	if dryRun {
+		log.Infof("Dry run, would delete %v, and enable and start %v", paths, services)
+		return removeContainers(log, runtime, true)
+	}
+
+	// The recert containers are left behind when the run is interrupted during recert
+	if err := removeContainers(log, runtime, false); err != nil {
+		return err
+	}
+	log.Infof("Deleting %v", paths)
+	if _, err := op.RunInHostNamespace("rm", append([]string{"-rf"}, paths...)...); err != nil {
+		return errors.Wrap(err, "Failed to delete seed creation leftovers")
+	}
+
+	if err := restartServices(log, op, services); err != nil {
+		return err
+	}
+	log.Info("Host state reset, seed creation can be run again")
+	return nil
+}
+
+// restartServices enables and starts the services stopped by the run, in order
+func restartServices(log *logrus.Logger, op ops.Ops, services []string) error {
+	// CRI-O first, kubelet can't start its pods without it
+	for _, service := range services {
+		log.Infof("Enabling and starting %s", service)
+		if _, err := op.SystemctlAction("enable", "--now", service); err != nil {
+			return err
+		}
+	}
+	return nil
+}
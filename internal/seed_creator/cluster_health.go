@@ -0,0 +1,125 @@
+package seed_creator
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// clusterHealthFile is the snapshot of the cluster health at seed time
+	clusterHealthFile = "cluster-health.json"
+)
+
+// healthyConditions are the condition statuses expected from a healthy resource, per resource kind
+var healthyConditions = map[string]map[string]string{
+	"clusteroperators":   {"Available": "True", "Degraded": "False"},
+	"nodes":              {"Ready": "True"},
+	"machineconfigpools": {"Updated": "True", "Degraded": "False"},
+}
+
+// ResourceHealth is the condition statuses of a single cluster resource
+type ResourceHealth struct {
+	Name       string            `json:"name"`
+	Conditions map[string]string `json:"conditions"`
+	Healthy    bool              `json:"healthy"`
+}
+
+// ClusterHealth is the health of the cluster at seed time, used to prove the seed was cut from a
+// healthy cluster and to compare against the post-restore health
+type ClusterHealth struct {
+	CapturedAt         time.Time        `json:"capturedAt"`
+	Healthy            bool             `json:"healthy"`
+	ClusterOperators   []ResourceHealth `json:"clusterOperators"`
+	Nodes              []ResourceHealth `json:"nodes"`
+	MachineConfigPools []ResourceHealth `json:"machineConfigPools"`
+}
+
+// resourceList is the subset of `oc get -o json` output needed to evaluate the health
+type resourceList struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Status struct {
+			Conditions []struct {
+				Type   string `json:"type"`
+				Status string `json:"status"`
+			} `json:"conditions"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// ParseResourceHealth evaluates the health of the resources of the given kind from `oc get -o json` output
+func ParseResourceHealth(kind string, output []byte) ([]ResourceHealth, error) {
+	var list resourceList
+	if err := json.Unmarshal(output, &list); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse %s", kind)
+	}
+
+	var resources []ResourceHealth
+	for _, item := range list.Items {
+		resource := ResourceHealth{Name: item.Metadata.Name, Conditions: map[string]string{}, Healthy: true}
+		for _, condition := range item.Status.Conditions {
+			resource.Conditions[condition.Type] = condition.Status
+		}
+		for conditionType, expected := range healthyConditions[kind] {
+			if resource.Conditions[conditionType] != expected {
+				resource.Healthy = false
+			}
+		}
+		resources = append(resources, resource)
+	}
+	return resources, nil
+}
+
+func (s *SeedCreator) getResourceHealth(kind string) ([]ResourceHealth, error) {
+	output, err := s.ops.RunInHostNamespace("oc", "get", kind, "-o", "json", "--kubeconfig", s.kubeconfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get %s", kind)
+	}
+	return ParseResourceHealth(kind, []byte(output))
+}
+
+// backupClusterHealth saves the health of the cluster operators, nodes and machine config pools
+func (s *SeedCreator) backupClusterHealth() error {
+	healthJson := path.Join(s.backupDir, clusterHealthFile)
+	_, err := os.Stat(healthJson)
+	if err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	s.log.Println("Saving cluster health snapshot")
+	health := ClusterHealth{CapturedAt: time.Now().UTC(), Healthy: true}
+	if health.ClusterOperators, err = s.getResourceHealth("clusteroperators"); err != nil {
+		return err
+	}
+	if health.Nodes, err = s.getResourceHealth("nodes"); err != nil {
+		return err
+	}
+	if health.MachineConfigPools, err = s.getResourceHealth("machineconfigpools"); err != nil {
+		return err
+	}
+
+	for _, resources := range [][]ResourceHealth{health.ClusterOperators, health.Nodes, health.MachineConfigPools} {
+		for _, resource := range resources {
+			if !resource.Healthy {
+				health.Healthy = false
+				s.log.Warnf("%s is not healthy: %v", resource.Name, resource.Conditions)
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(health, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal cluster health")
+	}
+	if err = os.WriteFile(healthJson, data, 0600); err != nil {
+		return errors.Wrap(err, "Failed to write cluster health")
+	}
+	s.log.Println("Cluster health snapshot saved successfully.")
+	return nil
+}
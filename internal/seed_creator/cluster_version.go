@@ -0,0 +1,70 @@
+package seed_creator
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/pkg/seedmanifest"
+)
+
+const (
+	// clusterVersionFile is the raw ClusterVersion of the seed cluster
+	clusterVersionFile = "clusterversion.json"
+)
+
+// ClusterVersionUpdate is an entry of the cluster version update history
+type ClusterVersionUpdate = seedmanifest.ClusterVersionUpdate
+
+// ClusterVersionSummary is the version of the seed cluster, summarized from its ClusterVersion
+type ClusterVersionSummary = seedmanifest.ClusterVersionSummary
+
+// ParseClusterVersion summarizes the output of `oc get clusterversion version -o json`
+func ParseClusterVersion(data []byte) (*ClusterVersionSummary, error) {
+	var clusterVersion struct {
+		Spec struct {
+			Channel string `json:"channel"`
+		} `json:"spec"`
+		Status struct {
+			History          []ClusterVersionUpdate `json:"history"`
+			AvailableUpdates []struct {
+				Version string `json:"version"`
+			} `json:"availableUpdates"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(data, &clusterVersion); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse clusterversion")
+	}
+
+	summary := &ClusterVersionSummary{
+		Channel: clusterVersion.Spec.Channel,
+		History: clusterVersion.Status.History,
+	}
+	for _, update := range clusterVersion.Status.History {
+		if update.State == "Completed" {
+			summary.Version, summary.Image = update.Version, update.Image
+			break
+		}
+	}
+	if summary.Version == "" {
+		return nil, errors.New("Cluster has no completed version in its history")
+	}
+	for _, update := range clusterVersion.Status.AvailableUpdates {
+		summary.AvailableUpdates = append(summary.AvailableUpdates, update.Version)
+	}
+	return summary, nil
+}
+
+// clusterVersionSummary summarizes the saved clusterversion.json, nil when not captured (worker seeds)
+func (s *SeedCreator) clusterVersionSummary() (*ClusterVersionSummary, error) {
+	data, err := os.ReadFile(path.Join(s.backupDir, clusterVersionFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read clusterversion")
+	}
+	return ParseClusterVersion(data)
+}
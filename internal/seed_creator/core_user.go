@@ -0,0 +1,102 @@
+package seed_creator
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/pkg/seedmanifest"
+)
+
+const (
+	// coreUserFile holds the core user's authorized_keys and shell customizations. It's only
+	// produced on request, since it carries the seed cluster's SSH access.
+	coreUserFile = "core-user.tgz"
+	// coreUserHome is the home of the core user
+	coreUserHome = "/home/core"
+)
+
+const (
+	// SSHKeysPolicySeed keeps the seed authorized_keys on restore
+	SSHKeysPolicySeed = "seed"
+	// SSHKeysPolicyTarget replaces the seed authorized_keys with the target ones on restore
+	SSHKeysPolicyTarget = "target"
+	// SSHKeysPolicyMerge merges the seed and target authorized_keys on restore
+	SSHKeysPolicyMerge = "merge"
+)
+
+// coreUserPaths are the core user customizations captured, relative to its home
+var coreUserPaths = []string{
+	".ssh/authorized_keys",
+	".ssh/authorized_keys.d",
+	".bashrc",
+	".bash_profile",
+}
+
+// CoreUserArtifact flags the presence of the core user artifact in the manifest
+type CoreUserArtifact = seedmanifest.CoreUserArtifact
+
+// ValidateSSHKeysPolicy checks that the given authorized_keys restore policy is supported
+func ValidateSSHKeysPolicy(policy string) error {
+	switch policy {
+	case SSHKeysPolicySeed, SSHKeysPolicyTarget, SSHKeysPolicyMerge:
+		return nil
+	default:
+		return errors.Errorf("unsupported SSH keys policy %q, must be one of: %s, %s, %s", policy,
+			SSHKeysPolicySeed, SSHKeysPolicyTarget, SSHKeysPolicyMerge)
+	}
+}
+
+// ApplySSHKeysPolicy returns the authorized_keys content resulting from the restore policy
+func ApplySSHKeysPolicy(policy, seedKeys, targetKeys string) (string, error) {
+	switch policy {
+	case SSHKeysPolicySeed:
+		return seedKeys, nil
+	case SSHKeysPolicyTarget:
+		return targetKeys, nil
+	case SSHKeysPolicyMerge:
+		var (
+			merged []string
+			seen   = map[string]bool{}
+		)
+		for _, keys := range []string{targetKeys, seedKeys} {
+			scanner := bufio.NewScanner(strings.NewReader(keys))
+			for scanner.Scan() {
+				key := strings.TrimSpace(scanner.Text())
+				if key == "" || seen[key] {
+					continue
+				}
+				seen[key] = true
+				merged = append(merged, key)
+			}
+		}
+		return strings.Join(merged, "\n") + "\n", nil
+	default:
+		return "", ValidateSSHKeysPolicy(policy)
+	}
+}
+
+// backupCoreUser archives the core user's authorized_keys and shell customizations, when requested
+func (s *SeedCreator) backupCoreUser() error {
+	if s.sshKeysPolicy == "" {
+		s.log.Debug("Skipping core user backup, not requested")
+		return nil
+	}
+
+	coreUserTar := path.Join(s.backupDir, coreUserFile)
+	_, err := os.Stat(coreUserTar)
+	if err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	s.log.Warn("Including the core user's authorized_keys in the seed image")
+	args := append([]string{"czf", coreUserTar, "--selinux", "--ignore-failed-read", "-C", coreUserHome}, coreUserPaths...)
+	if _, err = s.ops.RunInHostNamespace("tar", args...); err != nil {
+		return errors.Wrap(err, "Failed to backup core user")
+	}
+	s.log.Println("Backup of core user created successfully.")
+	return nil
+}
@@ -0,0 +1,60 @@
+package seed_creator
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+
+	crio "ibu-imager/internal/crio_runtime"
+)
+
+const (
+	// crioRuntimeFile holds the CRI-O version, config drop-ins, OCI hooks and runtime classes of the seed host
+	crioRuntimeFile = "crio-runtime.json"
+)
+
+// backupCrioRuntime saves the CRI-O runtime configuration, so the restore can check the target hooks
+// and runtime handlers, e.g. the SR-IOV ones, are still there after the upgrade: missing ones only
+// show up once the pods relying on them fail to start
+func (s *SeedCreator) backupCrioRuntime() error {
+	crioRuntimeJson := path.Join(s.backupDir, crioRuntimeFile)
+	_, err := os.Stat(crioRuntimeJson)
+	if err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	state, err := crio.Capture(s.ops, "/")
+	if err != nil {
+		return err
+	}
+	// Worker nodes don't host the API server, runtime classes are cluster-scoped
+	if s.nodeRole != NodeRoleWorker {
+		output, err := s.ops.RunInHostNamespace("oc", "get", "runtimeclass", "-o", "json", "--kubeconfig", s.kubeconfig)
+		if err != nil {
+			return errors.Wrap(err, "Failed to list runtime classes")
+		}
+		if state.RuntimeClasses, err = crio.ParseRuntimeClasses([]byte(output)); err != nil {
+			return err
+		}
+	}
+	for _, hook := range state.Hooks {
+		if _, err := os.Stat(hook.Executable); err != nil {
+			s.log.Warnf("OCI hook %s runs %s, which is missing on the seed host", hook.Path, hook.Executable)
+		}
+	}
+	for _, class := range state.UnconfiguredRuntimeClasses() {
+		s.log.Warnf("Runtime class %s selects the runtime handler %s, which CRI-O doesn't configure", class.Name, class.Handler)
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal CRI-O runtime configuration")
+	}
+	if err = os.WriteFile(crioRuntimeJson, data, 0600); err != nil {
+		return errors.Wrap(err, "Failed to write CRI-O runtime configuration")
+	}
+	s.log.Println("Backup of CRI-O runtime configuration created successfully.")
+	return nil
+}
@@ -0,0 +1,41 @@
+package seed_creator
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	containers "ibu-imager/internal/container_runtime"
+	"ibu-imager/internal/ops"
+)
+
+// DeleteLocal removes the seed and image store images built by the imager from the local container
+// storage, with their intermediate build images, the image store build dirs of the backup dir and the layer
+// cache. Only images labeled by the imager are removed, CRI-O shares the storage and its untagged images must stay.
+func DeleteLocal(log *logrus.Logger, op ops.Ops, runtime containers.Runtime, backupDir string, dryRun bool) error {
+	images, err := runtime.ListImages(CreatedByLabel + "=" + CreatedBy)
+	if err != nil {
+		return errors.Wrap(err, "Failed to list imager images")
+	}
+
+	var ids []string
+	for _, image := range images {
+		ids = append(ids, image.ID)
+		log.Infof("Image %s %s", image.ID, image.Name)
+	}
+	if dryRun {
+		log.Infof("Dry run, would delete %d images and %s, %s", len(ids), imageStoreDir(backupDir), imageStoreBuildDir(backupDir))
+		return nil
+	}
+
+	if len(ids) > 0 {
+		if err = runtime.RemoveImages(ids...); err != nil {
+			return errors.Wrap(err, "Failed to delete imager images")
+		}
+	}
+	// The cached layer digests would claim reuse of layers that are gone
+	if _, err = op.RunInHostNamespace("rm", "-rf", imageStoreDir(backupDir), imageStoreBuildDir(backupDir), layerCacheFile); err != nil {
+		return errors.Wrap(err, "Failed to delete image store build dirs")
+	}
+	log.Infof("Deleted %d imager images", len(ids))
+	return nil
+}
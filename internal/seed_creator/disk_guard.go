@@ -0,0 +1,236 @@
+package seed_creator
+
+import (
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/ops"
+)
+
+const (
+	// DefaultMinFreePercent is the share of the backup dir filesystem the run keeps free
+	DefaultMinFreePercent = 5
+	// diskGuardInterval is how often the free space of the backup dir filesystem is checked
+	diskGuardInterval = 5 * time.Second
+)
+
+// DiskGuard caps the space the run fills in the filesystem of the backup dir, /var on CoreOS hosts, so a
+// growing archive doesn't fill the disk of the node the seed is created from
+type DiskGuard struct {
+	// MinFreePercent is the share of the filesystem kept free, the run is aborted below it
+	MinFreePercent float64
+	// MaxWrittenBytes is the most the filesystem usage may grow during the run, unlimited when 0
+	MaxWrittenBytes uint64
+}
+
+// Validate checks the disk guard limits
+func (g *DiskGuard) Validate() error {
+	if g.MinFreePercent < 0 || g.MinFreePercent >= 100 {
+		return errors.Errorf("The minimum free space must be a percentage between 0 and 100, got %v", g.MinFreePercent)
+	}
+	return nil
+}
+
+// diskWatch is a running watch of the backup dir filesystem, terminating the host commands of the
+// step in progress when a limit of the guard is crossed
+type diskWatch struct {
+	guard *DiskGuard
+	dir   string
+	// space returns the free and total bytes of the filesystem of the dir
+	space func(dir string) (uint64, uint64, error)
+	// terminate fails the host commands in progress
+	terminate func() int
+	minFree   uint64
+	startFree uint64
+
+	mu         sync.Mutex
+	lowestFree uint64
+	warned     bool
+	tripped    error
+	// interrupted is the step the tripped watch failed
+	interrupted string
+	done        chan struct{}
+	stopped     chan struct{}
+}
+
+// filesystemSpace returns the bytes available to unprivileged users and the size of the filesystem of dir
+func filesystemSpace(dir string) (uint64, uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, 0, errors.Wrapf(err, "Failed to get the free space of %s", dir)
+	}
+	return stat.Bavail * uint64(stat.Bsize), stat.Blocks * uint64(stat.Bsize), nil
+}
+
+// newDiskWatch measures the filesystem of dir before the run writes to it
+func newDiskWatch(guard *DiskGuard, dir string, space func(string) (uint64, uint64, error), terminate func() int) (*diskWatch, error) {
+	free, total, err := space(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &diskWatch{
+		guard:      guard,
+		dir:        dir,
+		space:      space,
+		terminate:  terminate,
+		minFree:    uint64(float64(total) * guard.MinFreePercent / 100),
+		startFree:  free,
+		lowestFree: free,
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}, nil
+}
+
+// run checks the free space every interval until stopped or tripped
+func (w *diskWatch) run(interval time.Duration, log func(format string, args ...interface{})) {
+	defer close(w.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			if w.check(log) != nil {
+				return
+			}
+		}
+	}
+}
+
+// check measures the free space, tripping the watch and terminating the host commands in progress when
+// it crossed a limit. Failed measures are skipped, the guard mustn't fail the run by itself.
+func (w *diskWatch) check(log func(format string, args ...interface{})) error {
+	free, _, err := w.space(w.dir)
+	if err != nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.tripped != nil {
+		return w.tripped
+	}
+	if free < w.lowestFree {
+		w.lowestFree = free
+	}
+	written := w.written()
+	switch {
+	case free < w.minFree:
+		w.tripped = errors.Errorf("Free space of %s fell to %s, below the %v%% kept free", w.dir, ops.FormatBytes(free),
+			w.guard.MinFreePercent)
+	case w.guard.MaxWrittenBytes > 0 && written > w.guard.MaxWrittenBytes:
+		w.tripped = errors.Errorf("The run wrote %s to the filesystem of %s, over the %s cap", ops.FormatBytes(written), w.dir,
+			ops.FormatBytes(w.guard.MaxWrittenBytes))
+	case !w.warned && free < 2*w.minFree:
+		w.warned = true
+		log("Free space of %s is down to %s, the run is aborted below %s", w.dir, ops.FormatBytes(free), ops.FormatBytes(w.minFree))
+	}
+	if w.tripped != nil {
+		w.terminate()
+	}
+	return w.tripped
+}
+
+// written returns how much the filesystem usage grew since the run started, at its peak
+func (w *diskWatch) written() uint64 {
+	if w.lowestFree > w.startFree {
+		return 0
+	}
+	return w.startFree - w.lowestFree
+}
+
+// err returns why the watch tripped, nil when it didn't
+func (w *diskWatch) err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.tripped
+}
+
+// interrupt records the step that failed, returning why the watch tripped when that's what failed it
+func (w *diskWatch) interrupt(step string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.tripped != nil {
+		w.interrupted = step
+	}
+	return w.tripped
+}
+
+// interruptedStep returns the step the tripped watch failed, empty when it tripped between steps
+func (w *diskWatch) interruptedStep() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.interrupted
+}
+
+// stop stops the watch, returning the peak growth of the filesystem usage
+func (w *diskWatch) stop() uint64 {
+	close(w.done)
+	<-w.stopped
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.written()
+}
+
+// startDiskWatch starts watching the backup dir filesystem when the run has a disk guard
+func (s *SeedCreator) startDiskWatch() error {
+	if s.diskGuard == nil {
+		return nil
+	}
+	watch, err := newDiskWatch(s.diskGuard, s.backupDir, filesystemSpace, ops.TerminateCommands)
+	if err != nil {
+		return err
+	}
+	s.log.Infof("Keeping %s free in %s", ops.FormatBytes(watch.minFree), s.backupDir)
+	s.diskWatch = watch
+	go watch.run(diskGuardInterval, s.log.Warnf)
+	return nil
+}
+
+// stopDiskWatch stops the watch of the backup dir filesystem, recording how much the run wrote. When
+// the watch tripped, the interrupted step is rolled back and the node returned to running the cluster.
+func (s *SeedCreator) stopDiskWatch(err error) error {
+	if s.diskWatch == nil {
+		return err
+	}
+	watch := s.diskWatch
+	s.diskWatch = nil
+	s.report.WrittenBytes = int64(watch.stop())
+	tripped := watch.err()
+	if tripped == nil {
+		return err
+	}
+
+	s.log.Errorf("%v, rolling back", tripped)
+	if rollbackErr := s.rollbackStep(watch.interruptedStep()); rollbackErr != nil {
+		return errors.Wrapf(tripped, "rollback failed: %v", rollbackErr)
+	}
+	return errors.Wrap(tripped, "Seed creation aborted and rolled back")
+}
+
+// rollbackStep removes the partial artifacts of the interrupted step, like Abort, and starts the
+// services again. The artifacts of the completed steps are kept for create --resume.
+func (s *SeedCreator) rollbackStep(name string) error {
+	var paths []string
+	if step, ok := FindStep(name); ok {
+		paths = stepArtifacts(step, s.backupDir)
+	}
+	if err := removeContainers(s.log, s.runtime, false); err != nil {
+		return err
+	}
+	if len(paths) > 0 {
+		s.log.Infof("Deleting %v", paths)
+		if _, err := s.ops.RunInHostNamespace("rm", append([]string{"-rf"}, paths...)...); err != nil {
+			return errors.Wrap(err, "Failed to delete partial artifacts")
+		}
+	}
+	// Builds from a backup dir don't stop the services, they may not even run on a node
+	if s.fromBackupDir {
+		return nil
+	}
+	return restartServices(s.log, s.ops, []string{"crio.service", "kubelet.service"})
+}
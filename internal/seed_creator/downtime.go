@@ -0,0 +1,134 @@
+package seed_creator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// benchmarkSize is the amount of data written to measure the disk throughput
+	benchmarkSize = 128 * 1024 * 1024
+	// compressionBenchmarkSize is the amount of data compressed to measure the gzip throughput
+	compressionBenchmarkSize = 16 * 1024 * 1024
+	// fixedDowntime accounts for stopping the services and the recert dry-run
+	fixedDowntime = 3 * time.Minute
+)
+
+// now is the clock timing the benchmarks
+var now = time.Now
+
+// DowntimeEstimate is the predicted kubelet/crio downtime of the seed creation
+type DowntimeEstimate struct {
+	// Bytes is the amount of data archived while the services are stopped
+	Bytes uint64
+	// DiskThroughput is the measured backup dir write throughput, in bytes per second
+	DiskThroughput float64
+	// CompressionThroughput is the measured gzip throughput, in bytes per second
+	CompressionThroughput float64
+	// Downtime is the predicted downtime
+	Downtime time.Duration
+}
+
+func (e *DowntimeEstimate) String() string {
+	return fmt.Sprintf("Predicted kubelet/crio downtime: %s (%.1f GiB to archive, disk %.0f MiB/s, gzip %.0f MiB/s)",
+		e.Downtime.Round(time.Minute), float64(e.Bytes)/(1<<30), e.DiskThroughput/(1<<20), e.CompressionThroughput/(1<<20))
+}
+
+// EstimateDowntime predicts how long kubelet and crio stay stopped, from the size of the data
+// archived while they're stopped and a quick benchmark of the disk and compression throughput
+func (s *SeedCreator) EstimateDowntime() (*DowntimeEstimate, error) {
+	if err := prepareBackupDir(s.backupDir); err != nil {
+		return nil, err
+	}
+
+	var estimate DowntimeEstimate
+	varSize, err := s.diskUsage(append(s.duExcludeArgs(), s.varArchiveRoot())...)
+	if err != nil {
+		return nil, err
+	}
+	ostreeSize, err := s.diskUsage("/ostree/repo")
+	if err != nil {
+		return nil, err
+	}
+	estimate.Bytes = varSize + ostreeSize
+
+	if estimate.DiskThroughput, err = s.benchmarkDisk(); err != nil {
+		return nil, err
+	}
+	estimate.CompressionThroughput = benchmarkCompression()
+
+	throughput := estimate.DiskThroughput
+	if estimate.CompressionThroughput < throughput {
+		throughput = estimate.CompressionThroughput
+	}
+	estimate.Downtime = fixedDowntime + time.Duration(float64(estimate.Bytes)/throughput*float64(time.Second))
+	return &estimate, nil
+}
+
+// diskUsage returns the apparent size in bytes of the given du arguments
+func (s *SeedCreator) diskUsage(args ...string) (uint64, error) {
+	output, err := s.ops.RunInHostNamespace("du", append([]string{"-sb"}, args...)...)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to compute disk usage")
+	}
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return 0, errors.Errorf("Unexpected du output %q", output)
+	}
+	return strconv.ParseUint(fields[0], 10, 64)
+}
+
+// duExcludeArgs returns the du options excluding the same paths as the /var backup
+func (s *SeedCreator) duExcludeArgs() []string {
+	var args []string
+	for _, pattern := range s.varExcludePatterns() {
+		args = append(args, "--exclude", pattern)
+	}
+	return args
+}
+
+// benchmarkDisk measures the synchronous write throughput of the backup dir
+func (s *SeedCreator) benchmarkDisk() (float64, error) {
+	f, err := os.CreateTemp(s.backupDir, ".benchmark-")
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to create benchmark file")
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	chunk := make([]byte, 1024*1024)
+	start := now()
+	for written := 0; written < benchmarkSize; written += len(chunk) {
+		if _, err = f.Write(chunk); err != nil {
+			return 0, errors.Wrap(err, "Failed to write benchmark file")
+		}
+	}
+	if err = f.Sync(); err != nil {
+		return 0, errors.Wrap(err, "Failed to sync benchmark file")
+	}
+	return float64(benchmarkSize) / now().Sub(start).Seconds(), nil
+}
+
+// benchmarkCompression measures the gzip throughput on partly compressible data
+func benchmarkCompression() float64 {
+	data := make([]byte, compressionBenchmarkSize)
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < len(data); i += 2 {
+		data[i] = byte(random.Intn(256))
+	}
+
+	start := now()
+	w := gzip.NewWriter(io.Discard)
+	_, _ = io.Copy(w, bytes.NewReader(data))
+	_ = w.Close()
+	return float64(len(data)) / now().Sub(start).Seconds()
+}
@@ -0,0 +1,56 @@
+package seed_creator
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	ostree "ibu-imager/internal/ostree_client"
+	"ibu-imager/pkg/seedmanifest"
+)
+
+// defaultEtcDir is the pristine /etc of the ostree deployment, config-diff compares /etc against it
+const defaultEtcDir = "/usr/etc"
+
+// writeEtcDeletions writes the files config-diff reports deleted from /etc, with their type in the default /etc
+func (s *SeedCreator) writeEtcDeletions(diff *ostree.ConfigDiff) error {
+	deletions := seedmanifest.Deletions{SchemaVersion: seedmanifest.DeletionsSchemaVersion, Deletions: []seedmanifest.Deletion{}}
+	for _, deleted := range diff.Deleted {
+		deletionType, err := s.defaultEtcType(deleted)
+		if err != nil {
+			return err
+		}
+		deletion := seedmanifest.Deletion{Path: deleted, Type: deletionType, Reason: seedmanifest.DeletionReasonConfigDiff}
+		if err = deletion.Validate(); err != nil {
+			return err
+		}
+		deletions.Deletions = append(deletions.Deletions, deletion)
+	}
+
+	data, err := json.MarshalIndent(deletions, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal /etc deletions")
+	}
+	s.log.Infof("Recorded %d /etc deletions", len(deletions.Deletions))
+	return errors.Wrap(os.WriteFile(path.Join(s.backupDir, seedmanifest.DeletionsFileName), data, 0600),
+		"Failed to write /etc deletions")
+}
+
+// defaultEtcType returns the type of the deleted file in the default /etc
+func (s *SeedCreator) defaultEtcType(deleted string) (seedmanifest.DeletionType, error) {
+	output, err := s.ops.RunInHostNamespace("stat", "--printf", "%F", path.Join(defaultEtcDir, strings.TrimPrefix(deleted, "/etc/")))
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to stat the default %s", deleted)
+	}
+	switch output {
+	case "directory":
+		return seedmanifest.DeletionTypeDirectory, nil
+	case "symbolic link":
+		return seedmanifest.DeletionTypeSymlink, nil
+	default:
+		return seedmanifest.DeletionTypeFile, nil
+	}
+}
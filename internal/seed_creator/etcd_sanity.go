@@ -0,0 +1,175 @@
+package seed_creator
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// etcdNamespace is the namespace of the etcd static pod
+	etcdNamespace = "openshift-etcd"
+	// etcdSanityRetries is how many times an etcd applying its raft log is checked again
+	etcdSanityRetries = 5
+	// etcdSanityInterval is the wait between two checks of an etcd applying its raft log
+	etcdSanityInterval = 3 * time.Second
+)
+
+// etcdMemberList is the subset of `etcdctl member list -w json` output
+type etcdMemberList struct {
+	Members []struct {
+		ID        uint64 `json:"ID"`
+		Name      string `json:"name"`
+		IsLearner bool   `json:"isLearner"`
+	} `json:"members"`
+}
+
+// etcdEndpointStatus is the subset of `etcdctl endpoint status -w json` output
+type etcdEndpointStatus []struct {
+	Endpoint string `json:"Endpoint"`
+	Status   struct {
+		Header struct {
+			MemberID uint64 `json:"member_id"`
+			Revision int64  `json:"revision"`
+		} `json:"header"`
+		Leader           uint64   `json:"leader"`
+		RaftIndex        uint64   `json:"raftIndex"`
+		RaftAppliedIndex uint64   `json:"raftAppliedIndex"`
+		Errors           []string `json:"errors"`
+		IsLearner        bool     `json:"isLearner"`
+		DBSize           int64    `json:"dbSize"`
+		DBSizeInUse      int64    `json:"dbSizeInUse"`
+	} `json:"Status"`
+}
+
+// etcdAlarmList is the subset of `etcdctl alarm list -w json` output
+type etcdAlarmList struct {
+	Alarms []struct {
+		MemberID uint64 `json:"memberID"`
+		Alarm    int    `json:"alarm"`
+	} `json:"alarms"`
+}
+
+// errEtcdApplying is returned while etcd hasn't applied all of its raft log, e.g. after a snapshot restore
+var errEtcdApplying = errors.New("etcd hasn't applied its whole raft log")
+
+// EvaluateEtcdSanity checks the etcdctl outputs describe a single-node etcd able to be seeded: the
+// sole, leading and voting member, without alarms nor errors, and with its raft log applied
+func EvaluateEtcdSanity(memberList, endpointStatus, alarmList []byte) error {
+	var members etcdMemberList
+	if err := json.Unmarshal(memberList, &members); err != nil {
+		return errors.Wrap(err, "Failed to parse etcd member list")
+	}
+	if len(members.Members) != 1 {
+		var names []string
+		for _, member := range members.Members {
+			names = append(names, member.Name)
+		}
+		return errors.Errorf("etcd has %d members (%s), a single-node seed must have exactly one",
+			len(members.Members), strings.Join(names, ", "))
+	}
+	if members.Members[0].IsLearner {
+		return errors.Errorf("etcd member %s is a learner", members.Members[0].Name)
+	}
+
+	var statuses etcdEndpointStatus
+	if err := json.Unmarshal(endpointStatus, &statuses); err != nil {
+		return errors.Wrap(err, "Failed to parse etcd endpoint status")
+	}
+	if len(statuses) != 1 {
+		return errors.Errorf("Expected the status of one etcd endpoint, got %d", len(statuses))
+	}
+	status := statuses[0].Status
+	if len(status.Errors) > 0 {
+		return errors.Errorf("etcd reports errors: %s", strings.Join(status.Errors, "; "))
+	}
+	if status.Leader != status.Header.MemberID || status.Leader != members.Members[0].ID {
+		return errors.Errorf("etcd member %x is not the leader (leader %x)", status.Header.MemberID, status.Leader)
+	}
+
+	var alarms etcdAlarmList
+	if err := json.Unmarshal(alarmList, &alarms); err != nil {
+		return errors.Wrap(err, "Failed to parse etcd alarm list")
+	}
+	if len(alarms.Alarms) > 0 {
+		return errors.Errorf("etcd has %d active alarms (e.g. NOSPACE or CORRUPT)", len(alarms.Alarms))
+	}
+
+	if status.RaftAppliedIndex < status.RaftIndex {
+		return errors.Wrapf(errEtcdApplying, "applied index %d, raft index %d", status.RaftAppliedIndex, status.RaftIndex)
+	}
+	return nil
+}
+
+// etcdPod returns the name of the etcd static pod
+func (s *SeedCreator) etcdPod() (string, error) {
+	pod, err := s.ops.RunInHostNamespace("oc", "get", "pods", "-n", etcdNamespace, "-l", "app=etcd",
+		"-o", "jsonpath={.items[0].metadata.name}", "--kubeconfig", s.kubeconfig)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to find the etcd pod")
+	}
+	return pod, nil
+}
+
+// etcdctl runs etcdctl in the etcd pod, whose environment points it to the local member
+func (s *SeedCreator) etcdctl(pod string, args ...string) ([]byte, error) {
+	output, err := s.ops.RunInHostNamespace("oc", append([]string{"exec", "-n", etcdNamespace, pod, "-c", "etcdctl",
+		"--kubeconfig", s.kubeconfig, "--", "etcdctl"}, append(args, "-w", "json")...)...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to run etcdctl %s", strings.Join(args, " "))
+	}
+	return []byte(output), nil
+}
+
+// checkEtcdSanity validates etcd through its maintenance API before quiescing, so the seed isn't cut
+// from a transiently inconsistent etcd. A member that is defragmenting doesn't answer the status
+// request, and one applying its raft log after a snapshot restore is given time to catch up.
+func (s *SeedCreator) checkEtcdSanity() error {
+	// A rerun may have stopped etcd already, the etcd it checked is the one the seed is cut from
+	if _, err := os.Stat(path.Join(s.backupDir, etcdSummaryFile)); err == nil {
+		s.log.Println("Skipping etcd sanity check, the etcd summary was saved after it passed.")
+		return nil
+	}
+	if journal, err := readJournal(s.backupDir); err != nil {
+		return err
+	} else if journal != nil && journal.completed("etcd-sanity") {
+		s.log.Println("Skipping etcd sanity check, it passed already.")
+		return nil
+	}
+
+	s.log.Println("Checking etcd is the sole and healthy member")
+	pod, err := s.etcdPod()
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		memberList, err := s.etcdctl(pod, "member", "list")
+		if err != nil {
+			return err
+		}
+		endpointStatus, err := s.etcdctl(pod, "endpoint", "status", "--command-timeout=10s")
+		if err != nil {
+			return errors.Wrap(err, "etcd didn't answer its status, it may be defragmenting")
+		}
+		alarmList, err := s.etcdctl(pod, "alarm", "list")
+		if err != nil {
+			return err
+		}
+
+		err = EvaluateEtcdSanity(memberList, endpointStatus, alarmList)
+		if err == nil {
+			s.log.Println("etcd sanity check passed.")
+			return nil
+		}
+		if errors.Cause(err) != errEtcdApplying || attempt == etcdSanityRetries {
+			return err
+		}
+		s.log.Infof("Waiting for etcd to catch up: %v", err)
+		time.Sleep(etcdSanityInterval)
+	}
+}
@@ -0,0 +1,156 @@
+package seed_creator
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/ops"
+	"ibu-imager/pkg/seedmanifest"
+)
+
+const (
+	// etcdSummaryFile is the size of the seed cluster etcd, summarized into the seed manifest
+	etcdSummaryFile = "etcd-summary.json"
+	// etcdLargestResources is how many resource types the summary keeps, by number of keys
+	etcdLargestResources = 10
+)
+
+// etcdKeyPrefixes are the prefixes the API servers store the resources under
+var etcdKeyPrefixes = []string{"/kubernetes.io/", "/openshift.io/"}
+
+// EtcdSummary is the size of the seed cluster etcd, see the seedmanifest package
+type EtcdSummary = seedmanifest.EtcdSummary
+
+// EtcdResourceCount is the number of etcd keys of a resource type
+type EtcdResourceCount = seedmanifest.EtcdResourceCount
+
+// etcdKeys is the subset of `etcdctl get / --prefix --keys-only -w json` output
+type etcdKeys struct {
+	Kvs []struct {
+		Key []byte `json:"key"`
+	} `json:"kvs"`
+	Count int `json:"count"`
+}
+
+// ParseEtcdSummary summarizes the etcdctl endpoint status and key listing outputs
+func ParseEtcdSummary(endpointStatus, keyList []byte) (*EtcdSummary, error) {
+	var statuses etcdEndpointStatus
+	if err := json.Unmarshal(endpointStatus, &statuses); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse etcd endpoint status")
+	}
+	if len(statuses) != 1 {
+		return nil, errors.Errorf("Expected the status of one etcd endpoint, got %d", len(statuses))
+	}
+	var keys etcdKeys
+	if err := json.Unmarshal(keyList, &keys); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse etcd keys")
+	}
+
+	status := statuses[0].Status
+	summary := &EtcdSummary{
+		Revision:    status.Header.Revision,
+		DBSize:      status.DBSize,
+		DBSizeInUse: status.DBSizeInUse,
+		Keys:        keys.Count,
+	}
+	counts := map[string]int{}
+	for _, kv := range keys.Kvs {
+		if resource := etcdKeyResource(string(kv.Key)); resource != "" {
+			counts[resource]++
+		}
+	}
+	for resource, count := range counts {
+		summary.LargestResources = append(summary.LargestResources, EtcdResourceCount{Resource: resource, Keys: count})
+	}
+	sort.Slice(summary.LargestResources, func(i, j int) bool {
+		a, b := summary.LargestResources[i], summary.LargestResources[j]
+		if a.Keys != b.Keys {
+			return a.Keys > b.Keys
+		}
+		return a.Resource < b.Resource
+	})
+	if len(summary.LargestResources) > etcdLargestResources {
+		summary.LargestResources = summary.LargestResources[:etcdLargestResources]
+	}
+	return summary, nil
+}
+
+// etcdKeyResource returns the resource type the key stores, e.g. secrets for /kubernetes.io/secrets/ns/name
+// and machineconfigs.machineconfiguration.openshift.io for the resources of API groups, empty for the keys
+// that aren't resources
+func etcdKeyResource(key string) string {
+	for _, prefix := range etcdKeyPrefixes {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		segments := strings.Split(strings.TrimPrefix(key, prefix), "/")
+		if len(segments) < 2 {
+			return ""
+		}
+		// Core resources aren't stored under a group, and group names hold dots
+		if strings.Contains(segments[0], ".") && len(segments) > 2 {
+			return segments[1] + "." + segments[0]
+		}
+		return segments[0]
+	}
+	return ""
+}
+
+// backupEtcdSummary saves the etcd revision, database size and the number of keys per resource type
+func (s *SeedCreator) backupEtcdSummary() error {
+	summaryJson := path.Join(s.backupDir, etcdSummaryFile)
+	_, err := os.Stat(summaryJson)
+	if err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	s.log.Println("Saving etcd summary")
+	pod, err := s.etcdPod()
+	if err != nil {
+		return err
+	}
+	endpointStatus, err := s.etcdctl(pod, "endpoint", "status", "--command-timeout=10s")
+	if err != nil {
+		return err
+	}
+	// Only the keys are listed, the values of a bloated etcd would weigh as much as its database
+	keyList, err := s.etcdctl(pod, "get", "/", "--prefix", "--keys-only", "--command-timeout=60s")
+	if err != nil {
+		return err
+	}
+	summary, err := ParseEtcdSummary(endpointStatus, keyList)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal etcd summary")
+	}
+	if err = os.WriteFile(summaryJson, data, 0600); err != nil {
+		return errors.Wrap(err, "Failed to write etcd summary")
+	}
+	s.log.Infof("etcd holds %d keys in %s at revision %d", summary.Keys, ops.FormatBytes(uint64(summary.DBSize)), summary.Revision)
+	return nil
+}
+
+// etcdSummary reads the saved etcd summary, nil when not captured (worker seeds)
+func (s *SeedCreator) etcdSummary() (*EtcdSummary, error) {
+	data, err := os.ReadFile(path.Join(s.backupDir, etcdSummaryFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read etcd summary")
+	}
+	var summary EtcdSummary
+	if err = json.Unmarshal(data, &summary); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse etcd summary")
+	}
+	return &summary, nil
+}
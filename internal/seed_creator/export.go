@@ -0,0 +1,160 @@
+package seed_creator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	containers "ibu-imager/internal/container_runtime"
+	"ibu-imager/internal/ops"
+)
+
+const (
+	// OutputOCIArchive writes the seed image to an OCI archive tarball instead of pushing it
+	OutputOCIArchive = "oci-archive"
+	// checksumSuffix is the suffix of the sha256sum file written next to every archive
+	checksumSuffix = ".sha256"
+)
+
+// sha256Pattern matches the hex digest leading a sha256sum line
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Output is where the seed image is written instead of a registry, to sneaker-net it into disconnected sites
+type Output struct {
+	Transport string
+	Path      string
+}
+
+// ParseOutput parses an output of the form oci-archive:/path/seed.tar
+func ParseOutput(spec string) (*Output, error) {
+	transport, archive, found := strings.Cut(spec, ":")
+	if !found || transport != OutputOCIArchive {
+		return nil, errors.Errorf("Unsupported output %q, expected %s:/path/seed.tar", spec, OutputOCIArchive)
+	}
+	if !filepath.IsAbs(archive) || strings.HasSuffix(archive, "/") {
+		return nil, errors.Errorf("The output archive %q must be an absolute file path", archive)
+	}
+	return &Output{Transport: transport, Path: filepath.Clean(archive)}, nil
+}
+
+func (o *Output) String() string {
+	return o.Transport + ":" + o.Path
+}
+
+// imageStorePath returns the archive the image store image is written to, next to the seed one
+func (o *Output) imageStorePath() string {
+	return imageStoreArchive(o.Path)
+}
+
+// imageStoreArchive returns the image store archive exported next to the seed archive
+func imageStoreArchive(archive string) string {
+	ext := filepath.Ext(archive)
+	return strings.TrimSuffix(archive, ext) + imageStoreTagSuffix + ext
+}
+
+// ExportConfig selects an already built seed image and the archive Export writes it to
+type ExportConfig struct {
+	// Registry is the registry the seed image was built for
+	Registry string
+	Tag      string
+	Output   *Output
+	// ImageStore also exports the <tag>-image-store image
+	ImageStore bool
+}
+
+// Validate checks the export configuration
+func (c *ExportConfig) Validate() error {
+	if c.Registry == "" {
+		return errors.New("The registry the seed image was built for is required")
+	}
+	if c.Tag == "" {
+		return errors.New("A seed image tag is required")
+	}
+	if IsTagTemplate(c.Tag) {
+		return errors.Errorf("The tag %s has variables, give the tag create resolved them to", c.Tag)
+	}
+	if err := ValidateTag(c.Tag); err != nil {
+		return err
+	}
+	if c.Output == nil {
+		return errors.New("An output archive is required")
+	}
+	return nil
+}
+
+// Export writes a seed image built with --skip-push from the local storage to OCI archives, returning them
+func Export(log *logrus.Logger, op ops.Ops, runtime containers.Runtime, config ExportConfig) ([]string, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	image := config.Registry + ":" + config.Tag
+	if err := runtime.ImageExists(image); err != nil {
+		return nil, errors.Wrapf(err, "Seed image %s not found in the local storage", image)
+	}
+	if err := exportImage(log, op, runtime, image, config.Output.Path); err != nil {
+		return nil, err
+	}
+	archives := []string{config.Output.Path}
+	if !config.ImageStore {
+		return archives, nil
+	}
+
+	if err := exportImage(log, op, runtime, image+imageStoreTagSuffix, config.Output.imageStorePath()); err != nil {
+		return archives, err
+	}
+	return append(archives, config.Output.imageStorePath()), nil
+}
+
+// exportSeedImage writes the built seed image to the output archive
+func (s *SeedCreator) exportSeedImage(image, archive string) error {
+	if err := exportImage(s.log, s.ops, s.runtime, image, archive); err != nil {
+		return err
+	}
+	s.report.Archives = append(s.report.Archives, archive)
+	return nil
+}
+
+// exportImage writes the local image to the OCI archive, with a sha256sum file next to it so the archive
+// can be checked once carried into the disconnected site
+func exportImage(log *logrus.Logger, op ops.Ops, runtime containers.Runtime, image, archive string) error {
+	dir, base := filepath.Dir(archive), filepath.Base(archive)
+	if _, err := op.RunInHostNamespace("mkdir", "-p", dir); err != nil {
+		return errors.Wrapf(err, "Failed to create output dir %s", dir)
+	}
+	log.Printf("Exporting %s to %s", image, archive)
+	if err := runtime.SaveOCIArchive(image, archive); err != nil {
+		return errors.Wrapf(err, "Failed to export %s", image)
+	}
+	output, err := op.RunInHostNamespace("sha256sum", archive)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to checksum %s", archive)
+	}
+	sum, err := parseChecksum(output)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to checksum %s", archive)
+	}
+	// The archive is named relative to the checksum file, so sha256sum --check works wherever both are carried
+	if err = os.WriteFile(archive+checksumSuffix, []byte(fmt.Sprintf("%s  %s\n", sum, base)), 0o644); err != nil {
+		return errors.Wrapf(err, "Failed to write the checksum of %s", archive)
+	}
+	return nil
+}
+
+// parseChecksum returns the digest of the first line of a sha256sum output or file
+func parseChecksum(output string) (string, error) {
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return "", errors.New("No sha256sum found")
+	}
+	// sha256sum prefixes the line with a backslash when it escapes the file name
+	sum := strings.TrimPrefix(fields[0], "\\")
+	if !sha256Pattern.MatchString(sum) {
+		return "", errors.Errorf("Invalid sha256sum %q", sum)
+	}
+	return sum, nil
+}
@@ -0,0 +1,152 @@
+package seed_creator
+
+import (
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/archive"
+	"ibu-imager/pkg/seedmanifest"
+)
+
+const (
+	// extraArtifactsDir holds the extra artifacts in the backup dir, one directory per namespace
+	extraArtifactsDir = seedmanifest.ExtraArtifactsDir
+	// DefaultExtraArtifactsMaxSize is the default limit of the total size of the extra artifacts
+	DefaultExtraArtifactsMaxSize = 256 << 20
+
+	// maxNamespaceLength is the maximum length of a DNS subdomain
+	maxNamespaceLength = 253
+)
+
+// extraArtifactNamespace is a DNS subdomain, e.g. the domain of the vendor attaching the files
+var extraArtifactNamespace = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+
+// ExtraArtifact is a third-party file attached to the seed under a namespace
+type ExtraArtifact struct {
+	Namespace string
+	// Source is the file attached, its name is kept in the seed
+	Source string
+}
+
+// ParseExtraArtifact parses an extra artifact given as <namespace>=<file>
+func ParseExtraArtifact(spec string) (ExtraArtifact, error) {
+	namespace, source, found := strings.Cut(spec, "=")
+	if !found || source == "" {
+		return ExtraArtifact{}, errors.Errorf("Invalid extra artifact %q, expected <namespace>=<file>", spec)
+	}
+	artifact := ExtraArtifact{Namespace: namespace, Source: source}
+	return artifact, artifact.Validate()
+}
+
+// Validate checks the namespace is a DNS subdomain and the source names a file
+func (a *ExtraArtifact) Validate() error {
+	if len(a.Namespace) > maxNamespaceLength || !extraArtifactNamespace.MatchString(a.Namespace) {
+		return errors.Errorf("Invalid extra artifact namespace %q, expected a DNS subdomain such as the vendor domain", a.Namespace)
+	}
+	if a.Namespace == includedPathsNamespace {
+		return errors.Errorf("The extra artifact namespace %s is reserved for the included host paths", a.Namespace)
+	}
+	if name := path.Base(a.Source); name == "." || name == "/" || name == ".." {
+		return errors.Errorf("Invalid extra artifact %q, expected a file", a.Source)
+	}
+	return nil
+}
+
+// Path returns the path of the artifact in the seed image
+func (a *ExtraArtifact) Path() string {
+	return path.Join(extraArtifactsDir, a.Namespace, path.Base(a.Source))
+}
+
+// attachExtraArtifacts copies the extra artifacts into the backup dir, replacing the ones of previous runs.
+// The files are checked before anything is copied: they must be regular files, not clash, and fit in the
+// size limit altogether.
+func (s *SeedCreator) attachExtraArtifacts() error {
+	if err := os.RemoveAll(path.Join(s.backupDir, extraArtifactsDir)); err != nil {
+		return errors.Wrap(err, "Failed to remove the previous extra artifacts")
+	}
+	if len(s.extraArtifacts) == 0 {
+		s.log.Info("No extra artifacts to attach")
+		return nil
+	}
+
+	var total int64
+	seen := map[string]string{}
+	for _, artifact := range s.extraArtifacts {
+		info, err := os.Stat(artifact.Source)
+		if err != nil {
+			return errors.Wrap(err, "Failed to read extra artifact")
+		}
+		if !info.Mode().IsRegular() {
+			return errors.Errorf("Extra artifact %s isn't a regular file", artifact.Source)
+		}
+		if other, ok := seen[artifact.Path()]; ok {
+			return errors.Errorf("Extra artifacts %s and %s are both attached as %s", other, artifact.Source, artifact.Path())
+		}
+		seen[artifact.Path()] = artifact.Source
+		total += info.Size()
+	}
+	if total > s.extraArtifactsMaxSize {
+		return errors.Errorf("Extra artifacts are %.1f MiB, more than the %.1f MiB limit", float64(total)/(1<<20),
+			float64(s.extraArtifactsMaxSize)/(1<<20))
+	}
+
+	for _, artifact := range s.extraArtifacts {
+		dest := path.Join(s.backupDir, artifact.Path())
+		if err := os.MkdirAll(path.Dir(dest), 0700); err != nil {
+			return err
+		}
+		if err := archive.CopyFile(artifact.Source, dest); err != nil {
+			return errors.Wrapf(err, "Failed to attach extra artifact %s", artifact.Source)
+		}
+		s.log.Infof("Attached %s as %s", artifact.Source, artifact.Path())
+	}
+	return nil
+}
+
+// listExtraArtifacts returns the extra artifacts in the backup dir with their sizes and digests, sorted by path
+func (s *SeedCreator) listExtraArtifacts() ([]seedmanifest.ExtraArtifact, error) {
+	namespaces, err := os.ReadDir(path.Join(s.backupDir, extraArtifactsDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list the extra artifacts")
+	}
+
+	var artifacts []seedmanifest.ExtraArtifact
+	for _, namespace := range namespaces {
+		dir := path.Join(extraArtifactsDir, namespace.Name())
+		files, err := os.ReadDir(path.Join(s.backupDir, dir))
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to list the extra artifacts")
+		}
+		for _, file := range files {
+			artifactPath := path.Join(dir, file.Name())
+			info, err := file.Info()
+			if err != nil {
+				return nil, err
+			}
+			if !info.Mode().IsRegular() {
+				return nil, errors.Errorf("Extra artifact %s isn't a regular file", artifactPath)
+			}
+			digest, err := fileDigest(path.Join(s.backupDir, artifactPath))
+			if err != nil {
+				return nil, err
+			}
+			artifacts = append(artifacts, seedmanifest.ExtraArtifact{
+				Namespace: namespace.Name(),
+				Name:      file.Name(),
+				Path:      artifactPath,
+				Size:      info.Size(),
+				Digest:    digest,
+			})
+		}
+	}
+	sort.Slice(artifacts, func(i, j int) bool { return artifacts[i].Path < artifacts[j].Path })
+	return artifacts, nil
+}
@@ -0,0 +1,40 @@
+package seed_creator
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+
+	storage "ibu-imager/internal/host_storage"
+)
+
+const (
+	// filesystemsFile holds the filesystem UUIDs/labels referenced by fstab and the bootloader
+	filesystemsFile = "filesystems.json"
+)
+
+// backupFilesystemReferences captures the filesystem references so the restore can rewrite them
+// to the target's actual UUIDs when disks differ between seed and target hardware
+func (s *SeedCreator) backupFilesystemReferences() error {
+	filesystemsJson := path.Join(s.backupDir, filesystemsFile)
+	_, err := os.Stat(filesystemsJson)
+	if err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	references, err := storage.CaptureFilesystemReferences(s.ops)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(references, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal filesystem references")
+	}
+	if err = os.WriteFile(filesystemsJson, data, 0600); err != nil {
+		return errors.Wrap(err, "Failed to write filesystem references")
+	}
+	s.log.Println("Backup of filesystem references created successfully.")
+	return nil
+}
@@ -0,0 +1,67 @@
+package seed_creator
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	containers "ibu-imager/internal/container_runtime"
+	"ibu-imager/internal/ops"
+)
+
+// newRunID returns a random identifier of the run, labeling what it creates
+func newRunID() string {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		// Not expected on Linux, the run is still labeled as the imager's
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// runLabelArgs returns the podman options labeling the containers and images of the run, so gc can find them
+func (s *SeedCreator) runLabelArgs() []string {
+	return []string{"--label", CreatedByLabel + "=" + CreatedBy, "--label", RunIDLabel + "=" + s.runID}
+}
+
+// containerName returns the name of a container of the run, unique so retries never collide with leftovers
+func (s *SeedCreator) containerName(name string) string {
+	return name + "-" + s.runID
+}
+
+// GC removes everything labeled by the imager: the containers left behind by interrupted runs, then
+// the images like DeleteLocal does
+func GC(log *logrus.Logger, op ops.Ops, runtime containers.Runtime, backupDir string, dryRun bool) error {
+	if err := removeContainers(log, runtime, dryRun); err != nil {
+		return err
+	}
+	return DeleteLocal(log, op, runtime, backupDir, dryRun)
+}
+
+// removeContainers removes the containers labeled by the imager, whatever run created them
+func removeContainers(log *logrus.Logger, runtime containers.Runtime, dryRun bool) error {
+	listed, err := runtime.ListContainers(CreatedByLabel+"="+CreatedBy, RunIDLabel)
+	if err != nil {
+		return errors.Wrap(err, "Failed to list imager containers")
+	}
+
+	var ids []string
+	for _, container := range listed {
+		ids = append(ids, container.ID)
+		log.Infof("Container %s %s %s", container.ID, container.Name, container.Labels[RunIDLabel])
+	}
+	if dryRun {
+		log.Infof("Dry run, would delete %d containers", len(ids))
+		return nil
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if err = runtime.RemoveContainers(ids...); err != nil {
+		return errors.Wrap(err, "Failed to delete imager containers")
+	}
+	log.Infof("Deleted %d imager containers", len(ids))
+	return nil
+}
@@ -0,0 +1,158 @@
+package seed_creator
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// HistoryDir keeps the reports of the past runs
+	HistoryDir = "/var/lib/ibu-imager/history"
+	// historyLimit is the number of run reports kept in the history
+	historyLimit = 50
+	// historyTimeFormat names the history reports after their start time, sorting them chronologically
+	historyTimeFormat = "20060102T150405Z"
+)
+
+// SaveReport adds the run report to the history in dir, dropping the oldest reports past the history limit
+func SaveReport(dir string, report *RunReport) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrap(err, "Failed to create history dir")
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal run report")
+	}
+	reportFile := path.Join(dir, report.StartedAt.UTC().Format(historyTimeFormat)+".json")
+	if err = os.WriteFile(reportFile, data, 0600); err != nil {
+		return errors.Wrap(err, "Failed to write run report")
+	}
+
+	files, err := historyFiles(dir)
+	if err != nil {
+		return err
+	}
+	for len(files) > historyLimit {
+		if err = os.Remove(path.Join(dir, files[0])); err != nil {
+			return errors.Wrap(err, "Failed to prune run history")
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// LoadHistory returns the run reports of the history in dir, oldest first
+func LoadHistory(dir string) ([]RunReport, error) {
+	files, err := historyFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]RunReport, 0, len(files))
+	for _, name := range files {
+		data, err := os.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read run report")
+		}
+		var report RunReport
+		if err = json.Unmarshal(data, &report); err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse run report %s", name)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func historyFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list run history")
+	}
+	var files []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".json") {
+			files = append(files, entry.Name())
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// ReportDelta is the change of a step duration or an artifact size between two runs. Previous or
+// Current is -1 when the step or artifact is missing from that run.
+type ReportDelta struct {
+	Name     string
+	Previous int64
+	Current  int64
+}
+
+// Change returns the difference between the current and the previous value
+func (d *ReportDelta) Change() int64 {
+	return d.Current - d.Previous
+}
+
+// DiffReports compares two runs, returning the step duration (in nanoseconds) and artifact size deltas
+func DiffReports(previous, current *RunReport) (steps, artifacts []ReportDelta) {
+	previousSteps, currentSteps := map[string]int64{}, map[string]int64{}
+	for _, step := range previous.Steps {
+		previousSteps[step.Name] = int64(step.Duration)
+	}
+	for _, step := range current.Steps {
+		currentSteps[step.Name] = int64(step.Duration)
+	}
+	return diffValues(previousSteps, currentSteps), diffValues(previous.Artifacts, current.Artifacts)
+}
+
+// DiffStepUsage compares the resource usage of the steps of two runs, returning the CPU time (in
+// nanoseconds), peak memory and I/O (bytes read and written) deltas. Steps whose usage wasn't
+// measured are treated as missing from that run.
+func DiffStepUsage(previous, current *RunReport) (cpu, memory, io []ReportDelta) {
+	usageValues := func(report *RunReport) (cpu, memory, io map[string]int64) {
+		cpu, memory, io = map[string]int64{}, map[string]int64{}, map[string]int64{}
+		for _, step := range report.Steps {
+			if step.Usage == nil {
+				continue
+			}
+			cpu[step.Name] = int64(step.Usage.CPUTime)
+			if step.Usage.PeakMemory > 0 {
+				memory[step.Name] = step.Usage.PeakMemory
+			}
+			io[step.Name] = step.Usage.ReadBytes + step.Usage.WrittenBytes
+		}
+		return cpu, memory, io
+	}
+	previousCPU, previousMemory, previousIO := usageValues(previous)
+	currentCPU, currentMemory, currentIO := usageValues(current)
+	return diffValues(previousCPU, currentCPU), diffValues(previousMemory, currentMemory), diffValues(previousIO, currentIO)
+}
+
+func diffValues(previous, current map[string]int64) []ReportDelta {
+	names := map[string]bool{}
+	for name := range previous {
+		names[name] = true
+	}
+	for name := range current {
+		names[name] = true
+	}
+
+	deltas := make([]ReportDelta, 0, len(names))
+	for name := range names {
+		delta := ReportDelta{Name: name, Previous: -1, Current: -1}
+		if value, ok := previous[name]; ok {
+			delta.Previous = value
+		}
+		if value, ok := current[name]; ok {
+			delta.Current = value
+		}
+		deltas = append(deltas, delta)
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i].Name < deltas[j].Name })
+	return deltas
+}
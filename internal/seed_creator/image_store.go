@@ -0,0 +1,114 @@
+package seed_creator
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/ops"
+)
+
+const (
+	// imageStoreFile is the archive of the composed image store, in the image store image
+	imageStoreFile = "image-store.tgz"
+	// imageStoreTagSuffix is appended to the seed tag to get the image store image tag
+	imageStoreTagSuffix = "-image-store"
+)
+
+// imageStoreImage returns the reference of the additional image store image
+func (s *SeedCreator) imageStoreImage() string {
+	return s.seedImage() + imageStoreTagSuffix
+}
+
+// imageStoreReferences returns the image references of a containers.list file
+func imageStoreReferences(containerList string) []string {
+	var refs []string
+	for _, line := range strings.Split(containerList, "\n") {
+		if ref := strings.TrimSpace(line); ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// buildAndPushImageStore composes the seed images into a standalone containers-storage root and
+// pushes it as a separate OCI image, so targets can mount it read-only through CRI-O's
+// additionalimagestores instead of pulling every image
+func (s *SeedCreator) buildAndPushImageStore() error {
+	if !s.imageStore {
+		s.log.Debug("Skipping additional image store, not requested")
+		return nil
+	}
+
+	buildDir := imageStoreBuildDir(s.backupDir)
+	archive := path.Join(buildDir, imageStoreFile)
+	if _, err := os.Stat(archive); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		if err = s.composeImageStore(archive); err != nil {
+			return err
+		}
+	} else {
+		s.log.Println("Skipping image store composition, already done.")
+	}
+
+	image := s.imageStoreImage()
+	s.log.Println("Build and push additional image store to", image)
+	containerfile := path.Join(buildDir, "Containerfile")
+	if err := os.WriteFile(containerfile, []byte(containerFile([]string{imageStoreFile}, nil)), 0600); err != nil {
+		return errors.Wrap(err, "Failed to write image store Containerfile")
+	}
+	if err := s.runtime.Build(containerfile, image, buildDir, s.runLabelArgs()...); err != nil {
+		return errors.Wrap(err, "Failed to build image store image")
+	}
+	if s.output != nil {
+		return s.exportSeedImage(image, s.output.imageStorePath())
+	}
+	if s.skipPush {
+		s.log.Printf("Skipping push, the image store %s is left in the local storage for the push command", image)
+		return nil
+	}
+	stream, err := s.runtime.Push(image, s.authFile)
+	if err == nil {
+		err = ops.LogStream(s.log, stream)
+	}
+	return errors.Wrap(err, "Failed to push image store image")
+}
+
+// composeImageStore copies the images of containers.list into a fresh containers-storage root and archives it
+func (s *SeedCreator) composeImageStore(archive string) error {
+	containerList, err := os.ReadFile(path.Join(s.backupDir, ContainersListFile))
+	if err != nil {
+		return errors.Wrap(err, "Failed to read container list")
+	}
+	refs := imageStoreReferences(string(containerList))
+
+	// Start from an empty store, an interrupted composition may have left partial layers behind
+	storeDir, buildDir := imageStoreDir(s.backupDir), imageStoreBuildDir(s.backupDir)
+	if _, err = s.ops.RunInHostNamespace("rm", "-rf", storeDir, buildDir); err != nil {
+		return errors.Wrap(err, "Failed to clean image store")
+	}
+	if err = os.MkdirAll(buildDir, 0700); err != nil {
+		return errors.Wrap(err, "Failed to create image store build dir")
+	}
+
+	s.log.Printf("Composing additional image store with %d images", len(refs))
+	store := "containers-storage:[overlay@" + path.Join(storeDir, "storage") + "+" + path.Join(storeDir, "run") + "]"
+	for _, ref := range refs {
+		if _, err = s.ops.RunInHostNamespace("skopeo", "copy", "--preserve-digests",
+			"containers-storage:"+ref, store+ref); err != nil {
+			return errors.Wrapf(err, "Failed to copy %s to the image store", ref)
+		}
+	}
+
+	// Only the storage root is shipped, the run root is host specific
+	if _, err = s.ops.RunInHostNamespace("tar", "czf", archive, "--selinux", "--xattrs",
+		"-C", storeDir, "storage"); err != nil {
+		return errors.Wrap(err, "Failed to archive image store")
+	}
+	s.log.Println("Additional image store composed.")
+	return nil
+}
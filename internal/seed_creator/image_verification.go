@@ -0,0 +1,45 @@
+package seed_creator
+
+import (
+	"github.com/pkg/errors"
+
+	policy "ibu-imager/internal/image_policy"
+)
+
+// verifyImages pulls the images enforcing the signature policy, since the recert containers run
+// privileged with the etcd data mounted. In secure mode, images the policy accepts without
+// signature verification are refused.
+func (s *SeedCreator) verifyImages(images ...string) error {
+	policyFile := s.recert.SignaturePolicy
+	if policyFile == "" {
+		policyFile = policy.DefaultPolicyFile
+	}
+	data, err := s.ops.RunInHostNamespace("cat", policyFile)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read signature policy %s", policyFile)
+	}
+	signaturePolicy, err := policy.Parse([]byte(data))
+	if err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		switch signaturePolicy.Verdict(image) {
+		case policy.VerdictRejected:
+			return errors.Errorf("Image %s is rejected by the signature policy %s", image, policyFile)
+		case policy.VerdictUnverified:
+			if s.recert.Secure {
+				return errors.Errorf("Refusing unverified image %s in secure mode, add a signature requirement for it to %s",
+					image, policyFile)
+			}
+			s.log.Warnf("Image %s is not verified by the signature policy %s", image, policyFile)
+		case policy.VerdictVerified:
+		}
+
+		// Pulling enforces the policy signature requirements
+		if err = s.runtime.PullVerified(image, s.authFile, policyFile); err != nil {
+			return errors.Wrapf(err, "Failed to pull and verify image %s", image)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package seed_creator
+
+import (
+	"os/exec"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	containers "ibu-imager/internal/container_runtime"
+	"ibu-imager/internal/ops"
+	registry "ibu-imager/internal/registry_client"
+)
+
+// ImportConfig selects a seed archive written by export, or any OCI or docker archive of a seed image,
+// and where Import loads it to
+type ImportConfig struct {
+	Archive string
+	// Registry is the registry the loaded seed image is pushed to, it's left in the local storage when empty
+	Registry string
+	// Tag pushes the seed image under another tag than the one it was exported with
+	Tag      string
+	AuthFile string
+	// ImageStore also imports the <archive>-image-store archive written by export --image-store
+	ImageStore bool
+	// SkipChecksum loads the archive without checking it against the sha256sum file written by export
+	SkipChecksum bool
+}
+
+// Validate checks the import configuration
+func (c *ImportConfig) Validate() error {
+	if c.Archive == "" {
+		return errors.New("A seed archive is required")
+	}
+	// The archive is read in the host mount namespace
+	if !filepath.IsAbs(c.Archive) {
+		return errors.Errorf("The seed archive %q must be an absolute file path", c.Archive)
+	}
+	if c.Tag != "" && c.Registry == "" {
+		return errors.New("A tag can only be set with the registry the seed image is pushed to")
+	}
+	return nil
+}
+
+// Import loads a seed archive into the local storage, for restore --local-image, or pushes it to the
+// registry, returning the seed images it imported
+func Import(log *logrus.Logger, op ops.Ops, runtime containers.Runtime, config ImportConfig) ([]string, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	image, err := importImage(log, op, runtime, config, config.Archive)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := runtime.ImageLabels(image)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to inspect imported image %s", image)
+	}
+	if labels[CreatedByLabel] != CreatedBy {
+		return nil, errors.Errorf("Imported image %s isn't a seed image, it wasn't created by %s", image, CreatedBy)
+	}
+	images := []string{image}
+	if config.ImageStore {
+		store, err := importImage(log, op, runtime, config, imageStoreArchive(config.Archive))
+		if err != nil {
+			return images, err
+		}
+		images = append(images, store)
+	}
+	if config.Registry == "" {
+		log.Printf("Seed image %s loaded into the local storage", image)
+		return images, nil
+	}
+
+	destination, err := importDestination(image, config)
+	if err != nil {
+		return images, err
+	}
+	if _, err = pushImages(log, runtime, config.AuthFile, image, []string{destination}); err != nil {
+		return images, err
+	}
+	pushed := []string{destination}
+	if config.ImageStore {
+		// The image store keeps following the seed image name, like create pushes it
+		if _, err = pushImages(log, runtime, config.AuthFile, images[1], []string{destination + imageStoreTagSuffix}); err != nil {
+			return pushed, err
+		}
+		pushed = append(pushed, destination+imageStoreTagSuffix)
+	}
+	return pushed, nil
+}
+
+// importImage checks the archive against its sha256sum file, when export wrote one, and loads it, returning
+// the name of the image it holds
+func importImage(log *logrus.Logger, op ops.Ops, runtime containers.Runtime, config ImportConfig, archive string) (string, error) {
+	if !config.SkipChecksum {
+		if err := verifyArchive(log, op, archive); err != nil {
+			return "", err
+		}
+	}
+	log.Printf("Loading %s", archive)
+	names, err := runtime.LoadArchive(archive)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to load %s", archive)
+	}
+	if len(names) == 0 {
+		return "", errors.Errorf("No named image loaded from %s, only archives of tagged images can be imported", archive)
+	}
+	return names[0], nil
+}
+
+// verifyArchive checks the archive against the sha256sum file next to it. Archives without one, e.g. not
+// written by export, are loaded unchecked.
+func verifyArchive(log *logrus.Logger, op ops.Ops, archive string) error {
+	checksumFile := archive + checksumSuffix
+	if _, err := op.RunInHostNamespace("test", "-f", checksumFile); err != nil {
+		// test exits with 1 when the file doesn't exist, any other failure mustn't turn the check off
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+			return errors.Wrapf(err, "Failed to look for the checksum file of %s", archive)
+		}
+		log.Warnf("No %s file next to %s, the archive isn't verified", filepath.Base(checksumFile), archive)
+		return nil
+	}
+	content, err := op.RunInHostNamespace("cat", checksumFile)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read %s", checksumFile)
+	}
+	expected, err := parseChecksum(content)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read %s", checksumFile)
+	}
+	output, err := op.RunInHostNamespace("sha256sum", archive)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to checksum %s", archive)
+	}
+	actual, err := parseChecksum(output)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to checksum %s", archive)
+	}
+	if actual != expected {
+		return errors.Errorf("Archive %s doesn't match its checksum, sha256 %s instead of %s", archive, actual, expected)
+	}
+	return nil
+}
+
+// importDestination returns the reference the imported seed image is pushed to, keeping its exported tag
+// unless the config overrides it
+func importDestination(image string, config ImportConfig) (string, error) {
+	tag := config.Tag
+	if tag == "" {
+		ref, err := registry.ParseReference(image)
+		if err != nil {
+			return "", errors.Wrapf(err, "Failed to parse imported image %s", image)
+		}
+		if ref.Tag == "" {
+			return "", errors.Errorf("Imported image %s has no tag, set one for the push", image)
+		}
+		tag = ref.Tag
+	}
+	return config.Registry + ":" + tag, nil
+}
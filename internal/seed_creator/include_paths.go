@@ -0,0 +1,78 @@
+package seed_creator
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// includedPathsNamespace is the extra artifacts namespace of the tarballs of the included host paths
+const includedPathsNamespace = "host-paths"
+
+// unincludableDirs are the host dirs that can't be included: the seed carries them already, or they
+// aren't disk-backed
+var unincludableDirs = []string{varFolder, "/etc", "/ostree", "/sysroot", "/boot", "/proc", "/sys", "/dev", "/run"}
+
+// ValidateIncludePaths refuses the included paths that aren't absolute, that the seed carries already,
+// that hold the backup dir, or whose tarballs would have the same name
+func ValidateIncludePaths(paths []string, backupDir string) error {
+	seen := map[string]string{}
+	for _, includePath := range paths {
+		if !path.IsAbs(includePath) {
+			return errors.Errorf("The included path %s must be absolute", includePath)
+		}
+		cleaned := path.Clean(includePath)
+		if cleaned == "/" {
+			return errors.New("The included paths can't be /, include the dirs the seed lacks")
+		}
+		for _, dir := range unincludableDirs {
+			if cleaned == dir || strings.HasPrefix(cleaned, dir+"/") {
+				return errors.Errorf("The included path %s can't be in %s", includePath, dir)
+			}
+		}
+		if backup := path.Clean(backupDir); backup == cleaned || strings.HasPrefix(backup, cleaned+"/") {
+			return errors.Errorf("The included path %s holds the backup dir %s", includePath, backupDir)
+		}
+		name := includedPathArtifact(cleaned)
+		if other, ok := seen[name]; ok {
+			return errors.Errorf("The included paths %s and %s would both be archived as %s", other, includePath, name)
+		}
+		seen[name] = includePath
+	}
+	return nil
+}
+
+// includedPathArtifact returns the name of the tarball of the included path, e.g. opt-custom-agent.tgz
+// for /opt/custom-agent
+func includedPathArtifact(includePath string) string {
+	return strings.ReplaceAll(strings.Trim(path.Clean(includePath), "/"), "/", "-") + ".tgz"
+}
+
+// archiveIncludedPaths archives every included host path into a tarball of its own, stored with the extra
+// artifacts so they're listed in the manifest with their checksums. The paths are archived relative to /.
+func (s *SeedCreator) archiveIncludedPaths() error {
+	dir := path.Join(s.backupDir, extraArtifactsDir, includedPathsNamespace)
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.Wrap(err, "Failed to remove the previous included paths")
+	}
+	if len(s.includePaths) == 0 {
+		s.log.Info("No host paths to include")
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	for _, includePath := range s.includePaths {
+		includePath = path.Clean(includePath)
+		artifact := path.Join(extraArtifactsDir, includedPathsNamespace, includedPathArtifact(includePath))
+		s.log.Infof("Archiving %s as %s", includePath, artifact)
+		if _, err := s.ops.RunInHostNamespace("tar", "czf", path.Join(s.backupDir, artifact), "--selinux",
+			"-C", "/", strings.TrimPrefix(includePath, "/")); err != nil {
+			return errors.Wrapf(err, "Failed to archive included path %s", includePath)
+		}
+	}
+	return nil
+}
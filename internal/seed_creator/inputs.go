@@ -0,0 +1,123 @@
+package seed_creator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// inputsFile keeps the fingerprint of the inputs of every completed step, outside the backup dir
+	inputsFile = "/var/tmp/ibu-imager-inputs.json"
+)
+
+// stepInputs maps every completed step to the fingerprint of its inputs
+type stepInputs map[string]string
+
+func loadStepInputs() (stepInputs, error) {
+	inputs := stepInputs{}
+	data, err := os.ReadFile(inputsFile)
+	if os.IsNotExist(err) {
+		return inputs, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read step inputs")
+	}
+	if err = json.Unmarshal(data, &inputs); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse step inputs")
+	}
+	return inputs, nil
+}
+
+func (i stepInputs) save() error {
+	data, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal step inputs")
+	}
+	return errors.Wrap(os.WriteFile(inputsFile, data, 0600), "Failed to write step inputs")
+}
+
+// fingerprint hashes the inputs of a step
+func fingerprint(inputs ...string) string {
+	h := sha256.New()
+	for _, input := range inputs {
+		h.Write([]byte(input))
+		h.Write([]byte{0})
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// invalidateStaleStep removes the artifacts of a step whose inputs changed since they were produced,
+// so the step produces them again instead of skipping because they exist. It returns the current
+// fingerprint of the step inputs, to record once the step completes.
+func (s *SeedCreator) invalidateStaleStep(step Step, inputs stepInputs) (string, error) {
+	current, err := step.inputs(s)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to fingerprint the inputs of step %s", step.Name)
+	}
+	previous, recorded := inputs[step.Name]
+	if !recorded || previous == current {
+		return current, nil
+	}
+
+	s.log.Infof("Inputs of step %s changed since its artifacts were produced, redoing it", step.Name)
+	for _, artifact := range step.Artifacts {
+		if err = os.RemoveAll(path.Join(s.backupDir, artifact)); err != nil {
+			return "", errors.Wrapf(err, "Failed to remove stale artifact %s", artifact)
+		}
+	}
+	return current, nil
+}
+
+// etcInputs fingerprints the /etc diff list, and the size and modification time of the changed files
+func etcInputs(s *SeedCreator) (string, error) {
+	diff, err := s.etcDiff()
+	if err != nil {
+		return "", err
+	}
+	var stats []string
+	for _, file := range diff.Changed() {
+		// Files removed since config-diff ran only count through the diff itself
+		if info, err := os.Lstat(file); err == nil {
+			stats = append(stats, fmt.Sprintf("%s %d %d", file, info.Size(), info.ModTime().Unix()))
+		}
+	}
+	return fingerprint(strings.Join(diff.Added, "\n"), strings.Join(diff.Modified, "\n"), strings.Join(diff.Deleted, "\n"),
+		strings.Join(stats, "\n")), nil
+}
+
+// ostreeInputs fingerprints the checksums of the ostree deployments
+func ostreeInputs(s *SeedCreator) (string, error) {
+	output, err := s.ops.RunInHostNamespace("rpm-ostree", "status", "--json")
+	if err != nil {
+		return "", err
+	}
+	var status struct {
+		Deployments []struct {
+			Checksum string `json:"checksum"`
+		} `json:"deployments"`
+	}
+	if err = json.Unmarshal([]byte(output), &status); err != nil {
+		return "", errors.Wrap(err, "Failed to parse rpm-ostree status")
+	}
+	var checksums []string
+	for _, deployment := range status.Deployments {
+		checksums = append(checksums, deployment.Checksum)
+	}
+	return fingerprint(strings.Join(checksums, ",")), nil
+}
+
+// mcoConfigInputs fingerprints the current machine-config-daemon configuration
+func mcoConfigInputs(s *SeedCreator) (string, error) {
+	currentConfig, err := s.ops.RunInHostNamespace("cat", mcoCurrentConfigFile)
+	if err != nil {
+		return "", err
+	}
+	return fingerprint(currentConfig), nil
+}
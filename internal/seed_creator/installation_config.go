@@ -0,0 +1,65 @@
+package seed_creator
+
+import (
+	"os"
+	"path/filepath"
+
+	cp "github.com/otiai10/copy"
+	"github.com/pkg/errors"
+)
+
+const (
+	// installationConfigDir holds the scripts and services reconfiguring the node on first boot of the seed
+	installationConfigDir = "installation_configuration_files"
+)
+
+// installationConfig is where the installation configuration files are copied from and to
+type installationConfig struct {
+	sourceDir  string
+	scriptsDir string
+	unitsDir   string
+}
+
+// defaultInstallationConfig returns the locations of the installation configuration on the host
+func defaultInstallationConfig() installationConfig {
+	return installationConfig{
+		sourceDir:  installationConfigDir,
+		scriptsDir: "/var/usrlocal/bin",
+		unitsDir:   "/etc/systemd/system",
+	}
+}
+
+// copyConfigurationFiles installs the installation configuration scripts and services on the
+// host, so they're captured in the /var and /etc backups
+func (s *SeedCreator) copyConfigurationFiles() error {
+	if err := s.copyConfigurationScripts(); err != nil {
+		return err
+	}
+	return s.handleServices()
+}
+
+func (s *SeedCreator) copyConfigurationScripts() error {
+	source := filepath.Join(s.installationConfig.sourceDir, "scripts")
+	s.log.Infof("Copying %s to %s", source, s.installationConfig.scriptsDir)
+	return errors.Wrap(cp.Copy(source, s.installationConfig.scriptsDir, cp.Options{AddPermission: os.FileMode(0777)}),
+		"Failed to copy installation configuration scripts")
+}
+
+func (s *SeedCreator) handleServices() error {
+	dir := filepath.Join(s.installationConfig.sourceDir, "services")
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		s.log.Infof("Creating service %s", info.Name())
+		if err = cp.Copy(path, filepath.Join(s.installationConfig.unitsDir, info.Name())); err != nil {
+			return errors.Wrapf(err, "Failed to create service %s", info.Name())
+		}
+		s.log.Infof("Enabling service %s", info.Name())
+		_, err = s.ops.SystemctlAction("enable", info.Name())
+		return err
+	})
+}
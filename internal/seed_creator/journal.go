@@ -0,0 +1,103 @@
+package seed_creator
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// journalFile records the completed steps of the run in the backup dir, it isn't a seed artifact
+const journalFile = ".ibu-imager-journal.json"
+
+// JournalEntry is a step completed by a run
+type JournalEntry struct {
+	Name        string    `json:"name"`
+	CompletedAt time.Time `json:"completedAt"`
+}
+
+// stepJournal is the progress of a run, persisted after every step so an interrupted run can be resumed
+type stepJournal struct {
+	Image    string         `json:"image"`
+	NodeRole string         `json:"nodeRole"`
+	Steps    []JournalEntry `json:"steps"`
+
+	file string
+}
+
+// openJournal returns the journal of the run. When resuming, the journal of the interrupted run is
+// loaded and must be for the same seed, otherwise any previous journal is discarded.
+func (s *SeedCreator) openJournal() (*stepJournal, error) {
+	journal := &stepJournal{Image: s.seedImage(), NodeRole: s.nodeRole, file: path.Join(s.backupDir, journalFile)}
+	if !s.resume {
+		return journal, journal.save()
+	}
+
+	previous, err := readJournal(s.backupDir)
+	if err != nil {
+		return nil, err
+	}
+	if previous == nil {
+		s.log.Warn("No interrupted run to resume, starting from the first step")
+		return journal, journal.save()
+	}
+	if previous.Image != journal.Image || previous.NodeRole != journal.NodeRole {
+		return nil, errors.Errorf("Can't resume the run of the %s node seed %s as the %s node seed %s, run without --resume to start over",
+			previous.NodeRole, previous.Image, journal.NodeRole, journal.Image)
+	}
+	journal.Steps = previous.Steps
+	if len(journal.Steps) > 0 {
+		s.log.Infof("Resuming the interrupted run after step %s", journal.Steps[len(journal.Steps)-1].Name)
+	}
+	return journal, nil
+}
+
+// readJournal loads the journal left in the backup dir by an interrupted run, nil when there's none
+func readJournal(backupDir string) (*stepJournal, error) {
+	data, err := os.ReadFile(path.Join(backupDir, journalFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read the step journal")
+	}
+	journal := &stepJournal{file: path.Join(backupDir, journalFile)}
+	if err = json.Unmarshal(data, journal); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse the step journal")
+	}
+	return journal, nil
+}
+
+// completed returns true if the step was completed by the run being resumed
+func (j *stepJournal) completed(name string) bool {
+	for _, entry := range j.Steps {
+		if entry.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// complete records the step as completed
+func (j *stepJournal) complete(name string) error {
+	j.Steps = append(j.Steps, JournalEntry{Name: name, CompletedAt: time.Now().UTC()})
+	return j.save()
+}
+
+func (j *stepJournal) save() error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal the step journal")
+	}
+	return errors.Wrap(os.WriteFile(j.file, data, 0600), "Failed to write the step journal")
+}
+
+// remove deletes the journal of a completed run, so resuming the next one doesn't skip its steps
+func (j *stepJournal) remove() error {
+	if err := os.Remove(j.file); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "Failed to remove the step journal")
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package seed_creator
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/host_kernel"
+)
+
+const (
+	// kernelFile holds the kernel command line, kernel arguments and tuned profile of the seed host
+	kernelFile = "kernel.json"
+)
+
+// backupKernel saves the kernel configuration, so the restore can apply the seed kernel arguments
+// missing on the target, since wrong isolcpus or hugepages silently break RAN workloads
+func (s *SeedCreator) backupKernel() error {
+	kernelJson := path.Join(s.backupDir, kernelFile)
+	_, err := os.Stat(kernelJson)
+	if err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	state, err := host_kernel.Capture(s.ops)
+	if err != nil {
+		return err
+	}
+	if pending := state.PendingKernelArgs(); len(pending) > 0 {
+		s.log.Warnf("Kernel arguments %s aren't applied until the next reboot, the seed records them anyway",
+			strings.Join(pending, " "))
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal kernel configuration")
+	}
+	if err = os.WriteFile(kernelJson, data, 0600); err != nil {
+		return errors.Wrap(err, "Failed to write kernel configuration")
+	}
+	s.log.Println("Backup of kernel configuration created successfully.")
+	return nil
+}
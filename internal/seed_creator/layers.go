@@ -0,0 +1,192 @@
+package seed_creator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/version"
+	"ibu-imager/pkg/seedmanifest"
+)
+
+const (
+	// layerCacheFile keeps the artifact digests of the last built seed image, outside the backup dir
+	layerCacheFile = "/var/tmp/ibu-imager-layers.json"
+
+	// CreatedByLabel marks the images and intermediate build images created by the imager
+	CreatedByLabel = "io.openshift.ibu.created-by"
+	// CreatedBy is the value of the created-by label
+	CreatedBy = "ibu-imager"
+	// RunIDLabel tells the run that created the container or image
+	RunIDLabel = "io.openshift.ibu.run-id"
+	// ArtifactsLabel lists the seed image artifacts, comma separated, in layer order
+	ArtifactsLabel = "io.openshift.ibu.artifacts"
+	// ArtifactLabelPrefix prefixes the labels carrying the content digest of every artifact
+	ArtifactLabelPrefix = "io.openshift.ibu.artifact."
+	// ImagerVersionLabel tells the version of the imager that built the seed image
+	ImagerVersionLabel = "io.openshift.ibu.imager-version"
+	// SeedFormatLabel is the seed manifest schema version of the seed image, so consumers can
+	// refuse seeds they can't restore from the image config alone
+	SeedFormatLabel = "io.openshift.ibu.seed-format"
+)
+
+// layerCache maps every artifact to the sha256 digest of its content
+type layerCache map[string]string
+
+// seedArtifacts returns the artifacts in the backup dir in layer order. The manifest changes on
+// every run, so it goes last to keep the layers of the unchanged artifacts cacheable.
+func (s *SeedCreator) seedArtifacts() ([]string, error) {
+	entries, err := os.ReadDir(s.backupDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list backup dir")
+	}
+
+	var artifacts []string
+	for _, entry := range entries {
+		if isSeedArtifact(entry.Name()) {
+			artifacts = append(artifacts, entry.Name())
+		}
+	}
+	sort.Strings(artifacts)
+	return append(artifacts, manifestFile), nil
+}
+
+// ArchiveSourceRoot returns the host directory the entries of the artifact archive of the backup dir are
+// relative to
+func ArchiveSourceRoot(backupDir, artifact string) string {
+	switch artifact {
+	case "ostree.tgz":
+		return "/ostree/repo"
+	case imageStoreFile:
+		return imageStoreDir(backupDir)
+	case coreUserFile:
+		return coreUserHome
+	}
+	return "/"
+}
+
+// containerFile returns the Containerfile of the seed image, with one layer per artifact so
+// podman reuses the layers of unchanged artifacts on build and skips their blobs on push. The
+// artifact digests are labeled, so the image can be verified from its config blob alone.
+func containerFile(artifacts []string, digests layerCache) string {
+	var b strings.Builder
+	b.WriteString("FROM scratch\n")
+	// Labeled first, so the intermediate images of every layer carry it too
+	fmt.Fprintf(&b, "LABEL %s=%q\n", CreatedByLabel, CreatedBy)
+	for _, artifact := range artifacts {
+		fmt.Fprintf(&b, "COPY %s /%s\n", artifact, artifact)
+	}
+	if len(digests) > 0 {
+		fmt.Fprintf(&b, "LABEL %s=%q", ArtifactsLabel, strings.Join(artifacts, ","))
+		for _, artifact := range artifacts {
+			if digest, ok := digests[artifact]; ok {
+				fmt.Fprintf(&b, " \\\n    %s%s=%q", ArtifactLabelPrefix, artifact, digest)
+			}
+		}
+		b.WriteString("\n")
+	}
+	// Labeled last, so a new imager version doesn't invalidate the cached artifact layers
+	fmt.Fprintf(&b, "LABEL %s=%q %s=\"%d\"\n", ImagerVersionLabel, version.Get().Version, SeedFormatLabel, seedmanifest.SchemaVersion)
+	return b.String()
+}
+
+// artifactAnnotations returns the labels of the seed image built out of the artifacts, annotating
+// the manifest of seeds pushed as ORAS artifacts
+func artifactAnnotations(artifacts []string, digests layerCache) map[string]string {
+	annotations := map[string]string{
+		CreatedByLabel:     CreatedBy,
+		ArtifactsLabel:     strings.Join(artifacts, ","),
+		ImagerVersionLabel: version.Get().Version,
+		SeedFormatLabel:    strconv.Itoa(seedmanifest.SchemaVersion),
+	}
+	for artifact, digest := range digests {
+		annotations[ArtifactLabelPrefix+artifact] = digest
+	}
+	return annotations
+}
+
+// artifactDigests computes the content digest of the regular file artifacts
+func (s *SeedCreator) artifactDigests(artifacts []string) (layerCache, error) {
+	digests := layerCache{}
+	for _, artifact := range artifacts {
+		info, err := os.Stat(path.Join(s.backupDir, artifact))
+		if err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		digest, err := fileDigest(path.Join(s.backupDir, artifact))
+		if err != nil {
+			return nil, err
+		}
+		digests[artifact] = digest
+	}
+	return digests, nil
+}
+
+// reportLayerReuse logs which artifact layers are unchanged since the previous build, and records
+// the current digests for the next one
+func (s *SeedCreator) reportLayerReuse(digests layerCache) error {
+	reused, rebuilt, err := updateLayerCache(layerCacheFile, digests, s.log.Warnf)
+	if err != nil {
+		return err
+	}
+	s.log.Infof("Reusing %d layers from previous build: %s", len(reused), strings.Join(reused, ", "))
+	s.log.Infof("Building %d new layers: %s", len(rebuilt), strings.Join(rebuilt, ", "))
+	return nil
+}
+
+// updateLayerCache compares the digests with the ones of the cache file, returning the sorted artifacts
+// whose layers are reused and rebuilt, and replaces the cache with the digests. A corrupted cache is
+// warned about and rebuilt.
+func updateLayerCache(cacheFile string, digests layerCache, warnf func(string, ...interface{})) ([]string, []string, error) {
+	previous := layerCache{}
+	if data, err := os.ReadFile(cacheFile); err == nil {
+		if err = json.Unmarshal(data, &previous); err != nil {
+			warnf("Ignoring corrupted layer cache %s: %v", cacheFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, nil, errors.Wrap(err, "Failed to read layer cache")
+	}
+
+	var reused, rebuilt []string
+	for artifact, digest := range digests {
+		if previous[artifact] == digest {
+			reused = append(reused, artifact)
+		} else {
+			rebuilt = append(rebuilt, artifact)
+		}
+	}
+	sort.Strings(reused)
+	sort.Strings(rebuilt)
+
+	data, err := json.MarshalIndent(digests, "", "  ")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to marshal layer cache")
+	}
+	return reused, rebuilt, errors.Wrap(os.WriteFile(cacheFile, data, 0600), "Failed to write layer cache")
+}
+
+func fileDigest(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", errors.Wrapf(err, "Failed to compute digest of %s", filePath)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
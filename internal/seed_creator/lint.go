@@ -0,0 +1,75 @@
+package seed_creator
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	ostree "ibu-imager/internal/ostree_client"
+	lint "ibu-imager/internal/seed_lint"
+)
+
+// lintSeed scans the assembled backup dir for files that should never be in a seed, failing
+// or redacting them according to the lint rules
+func (s *SeedCreator) lintSeed() error {
+	if s.lintRules == nil {
+		s.log.Warn("Skipping seed content lint")
+		return nil
+	}
+
+	s.log.Println("Linting seed content")
+	findings, err := s.lintRules.Lint(s.backupDir)
+	if err != nil {
+		return err
+	}
+
+	origins, err := s.etcFindingOrigins(findings)
+	if err != nil {
+		return err
+	}
+	var failures []string
+	for _, finding := range findings {
+		s.log.Warnf("%s: %s%s matches lint rule %s (%s)", finding.Artifact, finding.Path, origins[finding.Path], finding.Rule, finding.Action)
+		if finding.Action == lint.ActionFail {
+			failures = append(failures, finding.Artifact+":"+finding.Path)
+		}
+	}
+	if len(failures) > 0 {
+		return errors.Errorf("Seed content lint failed, forbidden files found: %s", strings.Join(failures, ", "))
+	}
+
+	if err = lint.Redact(s.backupDir, findings); err != nil {
+		return err
+	}
+	s.log.Printf("Seed content lint passed with %d redacted files.", len(findings))
+	return nil
+}
+
+// etcFindingOrigins tells for the /etc findings whether the file was added on the seed or is a
+// modified default, as the fix differs: the former is removed, the latter reverted
+func (s *SeedCreator) etcFindingOrigins(findings []lint.Finding) (map[string]string, error) {
+	origins := map[string]string{}
+	// The config diff is the one of the host the packaged backup dir was collected on
+	if s.fromBackupDir {
+		return origins, nil
+	}
+	var diff *ostree.ConfigDiff
+	for _, finding := range findings {
+		if finding.Artifact != "etc.tgz" {
+			continue
+		}
+		if diff == nil {
+			var err error
+			if diff, err = s.ostreeClient.ConfigDiff(); err != nil {
+				return nil, err
+			}
+		}
+		switch diff.Status(finding.Path) {
+		case "A":
+			origins[finding.Path] = " (added)"
+		case "M":
+			origins[finding.Path] = " (modified default)"
+		}
+	}
+	return origins, nil
+}
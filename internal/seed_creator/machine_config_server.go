@@ -0,0 +1,102 @@
+package seed_creator
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// mcsServerTLSFile holds the machine-config-server serving certificate secret
+	mcsServerTLSFile = "mcs-server-tls.json"
+	// mcoNamespace is the namespace of the machine-config-operator
+	mcoNamespace = "openshift-machine-config-operator"
+	// mcsServerTLSSecret is the secret with the machine-config-server serving certificate
+	mcsServerTLSSecret = "machine-config-server-tls"
+)
+
+// mcsPools are the machine config pools whose rendered config is captured
+var mcsPools = []string{"master", "worker"}
+
+// MCSConfig toggles the capture of the machine-config-server data, which some users consider sensitive
+type MCSConfig struct {
+	// IncludeServerCerts captures the machine-config-server serving certificate
+	IncludeServerCerts bool
+	// IncludeRenderedConfigs captures the rendered master and worker machine configs
+	IncludeRenderedConfigs bool
+}
+
+// enabled returns true if any machine-config-server data is captured
+func (c *MCSConfig) enabled() bool {
+	return c.IncludeServerCerts || c.IncludeRenderedConfigs
+}
+
+// mcsRenderedConfigFile returns the artifact of the rendered config of the given pool
+func mcsRenderedConfigFile(pool string) string {
+	return "mcs-rendered-" + pool + ".json"
+}
+
+// backupMachineConfigServer captures the machine-config-server serving certificate and the rendered
+// configs, so a restored SNO can still serve ignition to future add-on nodes
+func (s *SeedCreator) backupMachineConfigServer() error {
+	if !s.mcs.enabled() {
+		s.log.Debug("Skipping machine-config-server backup, not requested")
+		return nil
+	}
+
+	if s.mcs.IncludeServerCerts {
+		s.log.Warn("Including the machine-config-server serving certificate in the seed image")
+		if err := s.saveOcOutput(mcsServerTLSFile, "get", "secret", mcsServerTLSSecret, "-n", mcoNamespace, "-o", "json"); err != nil {
+			return err
+		}
+	}
+
+	if s.mcs.IncludeRenderedConfigs {
+		for _, pool := range mcsPools {
+			// The pool has moved on to another rendered config since a rerun saved it, keep the saved one
+			saved, err := s.artifactExists(mcsRenderedConfigFile(pool))
+			if err != nil {
+				return err
+			}
+			if saved {
+				continue
+			}
+			rendered, err := s.ops.RunInHostNamespace("oc", "get", "machineconfigpool", pool,
+				"-o", "jsonpath={.status.configuration.name}", "--kubeconfig", s.kubeconfig)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to get rendered config of pool %s", pool)
+			}
+			if err = s.saveOcOutput(mcsRenderedConfigFile(pool), "get", "machineconfig",
+				strings.TrimSpace(rendered), "-o", "json"); err != nil {
+				return err
+			}
+		}
+	}
+
+	s.log.Println("Backup of machine-config-server data created successfully.")
+	return nil
+}
+
+// artifactExists returns true if the artifact was already saved in the backup dir
+func (s *SeedCreator) artifactExists(artifact string) (bool, error) {
+	_, err := os.Stat(path.Join(s.backupDir, artifact))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// saveOcOutput saves the output of an oc command to an artifact, unless it already exists
+func (s *SeedCreator) saveOcOutput(artifact string, args ...string) error {
+	saved, err := s.artifactExists(artifact)
+	if err != nil || saved {
+		return err
+	}
+	output, err := s.ops.RunInHostNamespace("oc", append(args, "--kubeconfig", s.kubeconfig)...)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to save %s", artifact)
+	}
+	return errors.Wrapf(os.WriteFile(path.Join(s.backupDir, artifact), []byte(output), 0600), "Failed to write %s", artifact)
+}
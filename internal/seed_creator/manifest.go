@@ -0,0 +1,87 @@
+package seed_creator
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/version"
+	"ibu-imager/pkg/seedmanifest"
+)
+
+const (
+	// manifestFile is the name of the seed manifest stored at the root of the seed image
+	manifestFile = seedmanifest.FileName
+
+	// ManifestKindSeed is the manifest kind of a regular single-node (master) seed
+	ManifestKindSeed = seedmanifest.KindSeed
+	// ManifestKindWorkerSeed is the manifest kind of an experimental worker-node seed
+	ManifestKindWorkerSeed = seedmanifest.KindWorkerSeed
+)
+
+const (
+	// NodeRoleMaster is the default node role, capturing a full single-node OpenShift seed
+	NodeRoleMaster = seedmanifest.NodeRoleMaster
+	// NodeRoleWorker is the experimental node role, capturing kubelet state only
+	NodeRoleWorker = seedmanifest.NodeRoleWorker
+)
+
+// Manifest describes the content of a seed image, see the seedmanifest package
+type Manifest = seedmanifest.Manifest
+
+// ValidateNodeRole checks that the given node role is supported
+func ValidateNodeRole(nodeRole string) error {
+	return seedmanifest.ValidateNodeRole(nodeRole)
+}
+
+func (s *SeedCreator) writeManifest() error {
+	s.log.Println("Writing seed manifest")
+	manifest := Manifest{
+		SchemaVersion: seedmanifest.SchemaVersion,
+		Kind:          seedmanifest.KindForNodeRole(s.nodeRole),
+		NodeRole:      s.nodeRole,
+		CreatedAt:     time.Now().UTC(),
+		RestoreSteps:  s.restoreSteps(),
+		AuditLogs:     AuditLogPolicyExclude,
+		Imager:        imagerVersion(),
+		FeatureGates:  s.featureGates.States(),
+	}
+	if s.sshKeysPolicy != "" {
+		manifest.CoreUser = &CoreUserArtifact{Artifact: coreUserFile, RestorePolicy: s.sshKeysPolicy}
+	}
+	clusterVersion, err := s.clusterVersionSummary()
+	if err != nil {
+		return err
+	}
+	manifest.ClusterVersion = clusterVersion
+	if manifest.Etcd, err = s.etcdSummary(); err != nil {
+		return err
+	}
+	if s.auditLogPolicy == AuditLogPolicyInclude {
+		manifest.AuditLogs = AuditLogPolicyInclude
+	}
+	if s.imageStore {
+		manifest.ImageStore = s.imageStoreImage()
+	}
+	if manifest.ExtraArtifacts, err = s.listExtraArtifacts(); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal seed manifest")
+	}
+	if err = os.WriteFile(path.Join(s.backupDir, manifestFile), data, 0600); err != nil {
+		return errors.Wrap(err, "Failed to write seed manifest")
+	}
+	return nil
+}
+
+// imagerVersion returns the version of the running imager, as recorded in the seed manifest
+func imagerVersion() *seedmanifest.ImagerVersion {
+	info := version.Get()
+	return &seedmanifest.ImagerVersion{Version: info.Version, GitCommit: info.GitCommit}
+}
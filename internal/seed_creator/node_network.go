@@ -0,0 +1,47 @@
+package seed_creator
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	nodenet "ibu-imager/internal/node_network"
+)
+
+const (
+	// nodeNetworkFile holds the node IP selection outcome and the interfaces of the seed host
+	nodeNetworkFile = "node-network.json"
+)
+
+// backupNodeNetwork saves the nodeip-configuration outcome, the kubelet node IP and the primary interface,
+// so the restore can select the node IP on the target hardware instead of keeping the seed one
+func (s *SeedCreator) backupNodeNetwork() error {
+	nodeNetworkJson := path.Join(s.backupDir, nodeNetworkFile)
+	_, err := os.Stat(nodeNetworkJson)
+	if err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	state, err := nodenet.Capture(s.ops, "/")
+	if err != nil {
+		return err
+	}
+	if len(state.NodeIPs) == 0 {
+		s.log.Warn("No kubelet node IP set by nodeip-configuration, the kubelet selects its IP itself")
+	} else if state.PrimaryIP != "" && state.PrimaryIP != state.NodeIPs[0] {
+		s.log.Warnf("nodeip-configuration selected %s but the kubelet runs with node IP %s", state.PrimaryIP,
+			strings.Join(state.NodeIPs, ","))
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal node network")
+	}
+	if err = os.WriteFile(nodeNetworkJson, data, 0600); err != nil {
+		return errors.Wrap(err, "Failed to write node network")
+	}
+	s.log.Println("Backup of node network created successfully.")
+	return nil
+}
@@ -0,0 +1,195 @@
+package seed_creator
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	containers "ibu-imager/internal/container_runtime"
+	cri "ibu-imager/internal/cri_client"
+	featuregate "ibu-imager/internal/feature_gate"
+	oras "ibu-imager/internal/oras_client"
+	ostree "ibu-imager/internal/ostree_client"
+	planner "ibu-imager/internal/precache_plan"
+	"ibu-imager/internal/resource_usage"
+	lint "ibu-imager/internal/seed_lint"
+)
+
+// Options configures a seed creation. The zero value of an option is its default, so new options don't
+// change the callers not setting them.
+type Options struct {
+	// Context is the context of the run, cancelling it stops the run before its next step and removes the
+	// recert dry-run containers. Never cancelled when nil.
+	Context context.Context
+	// OstreeClient queries rpm-ostree, only the steps collecting from the host need it
+	OstreeClient *ostree.Client
+	// BackupDir is where the artifacts are written and the seed image is built from, DefaultBackupDir when empty
+	BackupDir string
+	// Kubeconfig is the kubeconfig of the cluster queries
+	Kubeconfig string
+	// Registry is the repository the seed image is named after and pushed to
+	Registry string
+	// Tag is the tag of the seed image, DefaultTag when empty. Its {ocp_version}, {arch} and {date} variables
+	// are replaced when the run starts.
+	Tag string
+	// AuthFile holds the registry credentials
+	AuthFile string
+	// NodeRole is the role of the node the seed is captured from, master when empty
+	NodeRole string
+	// ImageFilter selects the images saved in containers.list
+	ImageFilter cri.ImageFilter
+	// Recert configures the recert dry-run, with the default recert image when it has none
+	Recert RecertConfig
+	// SSHKeysPolicy is the restore policy of the core user's SSH keys, which are only included when set
+	SSHKeysPolicy string
+	// LintRules are the seed content lint rules, the lint is skipped when nil
+	LintRules *lint.RuleSet
+	// MCS toggles the capture of the machine-config-server data
+	MCS MCSConfig
+	// ImageStore also pushes the seed images as an additional image store image
+	ImageStore bool
+	// AuditLogPolicy decides whether the audit logs are carried in the seed, excluded when empty
+	AuditLogPolicy string
+	// Strict redoes the steps whose inputs changed since their artifacts were produced
+	Strict bool
+	// MirrorRegistries are the additional registries the seed image is pushed to, best-effort
+	MirrorRegistries []string
+	// KeepCrio only stops kubelet and the containers, keeping CRI-O running
+	KeepCrio bool
+	// Resume continues an interrupted run after its last completed step
+	Resume bool
+	// SkipPush leaves the built seed image in the local storage
+	SkipPush bool
+	// IncludeUsrLocal archives the out-of-band /usr/local files var.tgz doesn't carry
+	IncludeUsrLocal bool
+	// VarExcludePatterns are the paths excluded from the /var backup, DefaultVarExcludePatterns when nil
+	VarExcludePatterns []string
+	// PrecachePlan is how the precache plan of the seed is resolved
+	PrecachePlan planner.Config
+	// Meter accounts the resource usage of the steps, not accounted when nil
+	Meter *resource_usage.Meter
+	// ORAS pushes the seed as an ORAS artifact instead of building an image when set
+	ORAS *oras.Client
+	// Output exports the seed image to an archive instead of pushing it when set
+	Output *Output
+	// Steps selects the steps run, every step when nil
+	Steps *StepSelection
+	// DiskGuard aborts the run before it fills the backup dir filesystem, unguarded when nil
+	DiskGuard *DiskGuard
+	// ExtraArtifacts are the third-party files attached to the seed
+	ExtraArtifacts []ExtraArtifact
+	// IncludePaths are the host paths archived each into a tarball of its own among the extra artifacts
+	IncludePaths []string
+	// ExtraArtifactsMaxSize limits the total size of the extra artifacts, DefaultExtraArtifactsMaxSize when 0
+	ExtraArtifactsMaxSize int64
+	// FeatureGates enable the experimental subsystems, every feature in its default state when nil
+	FeatureGates *featuregate.Gates
+	// Runtime builds and pushes the seed image and runs the helper containers, podman when nil
+	Runtime containers.Runtime
+}
+
+// Validate checks the backup dir, policies and limits of the options
+func (o *Options) Validate() error {
+	if o.BackupDir != "" {
+		if err := ValidateBackupDir(o.BackupDir); err != nil {
+			return err
+		}
+	}
+	if o.NodeRole != "" {
+		if err := ValidateNodeRole(o.NodeRole); err != nil {
+			return err
+		}
+	}
+	if err := o.validateFeatureGates(); err != nil {
+		return err
+	}
+	if o.Tag != "" {
+		if err := ValidateTag(o.Tag); err != nil {
+			return err
+		}
+		if o.NodeRole == NodeRoleWorker && strings.Contains(o.Tag, TagVarOCPVersion) {
+			return errors.Errorf("Worker node seeds don't carry the cluster version, %s can't be used in their tag", TagVarOCPVersion)
+		}
+	}
+	if o.SSHKeysPolicy != "" {
+		if err := ValidateSSHKeysPolicy(o.SSHKeysPolicy); err != nil {
+			return err
+		}
+	}
+	if o.AuditLogPolicy != "" {
+		if err := ValidateAuditLogPolicy(o.AuditLogPolicy); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range o.VarExcludePatterns {
+		if err := ValidateVarExcludePattern(pattern); err != nil {
+			return err
+		}
+	}
+	for _, artifact := range o.ExtraArtifacts {
+		if err := artifact.Validate(); err != nil {
+			return err
+		}
+	}
+	if o.Recert.Timeout < 0 {
+		return errors.New("The recert dry-run timeout can't be negative")
+	}
+	backupDir := o.BackupDir
+	if backupDir == "" {
+		backupDir = DefaultBackupDir
+	}
+	if err := ValidateIncludePaths(o.IncludePaths, backupDir); err != nil {
+		return err
+	}
+	if o.ExtraArtifactsMaxSize < 0 {
+		return errors.New("The extra artifacts size limit can't be negative")
+	}
+	if err := o.PrecachePlan.Validate(); err != nil {
+		return err
+	}
+	if o.DiskGuard != nil {
+		return o.DiskGuard.Validate()
+	}
+	return nil
+}
+
+// validateFeatureGates checks the experimental subsystems the options use are enabled by their feature gate
+func (o *Options) validateFeatureGates() error {
+	if o.NodeRole == NodeRoleWorker && !o.FeatureGates.Enabled(featuregate.WorkerSeeds) {
+		return errors.Errorf("Worker node seeds are experimental, enable the %s feature gate to create them", featuregate.WorkerSeeds)
+	}
+	if o.ORAS != nil && !o.FeatureGates.Enabled(featuregate.ORASArtifacts) {
+		return errors.Errorf("ORAS artifacts are experimental, enable the %s feature gate to push seeds as ORAS artifacts", featuregate.ORASArtifacts)
+	}
+	return nil
+}
+
+// withDefaults returns the options with the defaults of the options left empty
+func (o Options) withDefaults() Options {
+	if o.Context == nil {
+		o.Context = context.Background()
+	}
+	if o.BackupDir == "" {
+		o.BackupDir = DefaultBackupDir
+	}
+	if o.Tag == "" {
+		o.Tag = DefaultTag
+	}
+	if o.VarExcludePatterns == nil {
+		o.VarExcludePatterns = DefaultVarExcludePatterns
+	}
+	if o.NodeRole == "" {
+		o.NodeRole = NodeRoleMaster
+	}
+	if o.AuditLogPolicy == "" {
+		o.AuditLogPolicy = AuditLogPolicyExclude
+	}
+	if o.ExtraArtifactsMaxSize == 0 {
+		o.ExtraArtifactsMaxSize = DefaultExtraArtifactsMaxSize
+	}
+	if o.Recert.Image == "" {
+		o.Recert.Image = DefaultRecertImage
+	}
+	return o
+}
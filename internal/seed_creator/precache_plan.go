@@ -0,0 +1,59 @@
+package seed_creator
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	planner "ibu-imager/internal/precache_plan"
+	registry "ibu-imager/internal/registry_client"
+)
+
+// resolvePrecachePlan resolves the digests, sizes and availability of the images of containers.list and
+// catalogimages.list into the precache plan, so the target precaches them without resolving them again.
+// A plan left by an interrupted run is resumed, unless the run starts over.
+func (s *SeedCreator) resolvePrecachePlan() error {
+	if !s.precachePlan.Enabled {
+		s.log.Println("Skipping the precache plan, not requested")
+		return nil
+	}
+	file := path.Join(s.backupDir, planner.FileName)
+	if !s.resume {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "Failed to remove the previous precache plan")
+		}
+	}
+
+	var images []string
+	for _, list := range []string{ContainersListFile, CatalogImagesFile} {
+		data, err := os.ReadFile(path.Join(s.backupDir, list))
+		if os.IsNotExist(err) && list == CatalogImagesFile {
+			// Worker node seeds have no catalog sources
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Failed to read %s", list)
+		}
+		images = append(images, strings.Fields(string(data))...)
+	}
+
+	client, err := registry.NewClient(s.authFile)
+	if err != nil {
+		return err
+	}
+	s.log.Infof("Resolving the precache plan of %d images", len(images))
+	plan, err := planner.NewResolver(s.log, client, s.precachePlan).Resolve(images, file)
+	if err != nil {
+		return err
+	}
+	var unavailable int
+	for _, entry := range plan.Entries {
+		if !entry.Available {
+			unavailable++
+		}
+	}
+	s.log.Infof("Precache plan resolved: %d images, %d bytes, %d unavailable", len(plan.Entries), plan.Size(), unavailable)
+	return nil
+}
@@ -0,0 +1,261 @@
+package seed_creator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/ops"
+	registry "ibu-imager/internal/registry_client"
+)
+
+const (
+	// PreflightFile is the report of the last preflight checks, kept for the support bundles
+	PreflightFile = "/var/lib/ibu-imager/preflight.json"
+
+	// PreflightPass is a check that passed
+	PreflightPass = "pass"
+	// PreflightWarn is a check that passed with a caveat
+	PreflightWarn = "warn"
+	// PreflightFail is a check the seed creation would fail or produce a bad seed with
+	PreflightFail = "fail"
+	// PreflightSkip is a check that doesn't apply to the run
+	PreflightSkip = "skip"
+
+	// minCompressionRatio is the worst compression ratio expected from the archives, the free space
+	// must hold at least this share of the archived data
+	minCompressionRatio = 0.5
+)
+
+var (
+	// hostCommands are the host commands outside coreutils the seed creation runs
+	hostCommands = []string{"tar", "ostree", "rpm-ostree", "crictl", "systemctl", "find", "ip", "blkid"}
+	// hostCommandsWithFallback are the host commands the seed creation does without, with a slower fallback
+	hostCommandsWithFallback = []string{"grep"}
+)
+
+// PreflightCheck is the outcome of a single readiness check
+type PreflightCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// PreflightReport is the outcome of the readiness checks of the host and the cluster
+type PreflightReport struct {
+	Checks []PreflightCheck `json:"checks"`
+}
+
+// Passed tells whether no check failed
+func (r *PreflightReport) Passed() bool {
+	for _, check := range r.Checks {
+		if check.Status == PreflightFail {
+			return false
+		}
+	}
+	return true
+}
+
+// SavePreflightReport writes the preflight report to the file
+func SavePreflightReport(file string, report *PreflightReport) error {
+	if err := os.MkdirAll(path.Dir(file), 0700); err != nil {
+		return errors.Wrap(err, "Failed to create preflight report dir")
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal preflight report")
+	}
+	return errors.Wrap(os.WriteFile(file, data, 0600), "Failed to write preflight report")
+}
+
+// preflightCheck is a readiness check, returning its status and a message
+type preflightCheck struct {
+	name       string
+	masterOnly bool
+	run        func(s *SeedCreator) (string, string)
+}
+
+// preflightChecks are the readiness checks, in the order they run
+var preflightChecks = []preflightCheck{
+	{name: "host-commands", run: (*SeedCreator).checkHostCommands},
+	{name: "disk-space", run: (*SeedCreator).checkDiskSpace},
+	{name: "sno-topology", masterOnly: true, run: (*SeedCreator).checkSNOTopology},
+	{name: "cluster-operators", masterOnly: true, run: (*SeedCreator).checkClusterOperators},
+	{name: "registry", run: (*SeedCreator).checkRegistry},
+	{name: "recert-image", masterOnly: true, run: (*SeedCreator).checkRecertImage},
+}
+
+// Preflight checks the host and the cluster are ready for the seed creation, while the services
+// are still running. Failing checks don't stop the other ones, they're all reported.
+func (s *SeedCreator) Preflight() *PreflightReport {
+	report := &PreflightReport{}
+	for _, check := range preflightChecks {
+		result := PreflightCheck{Name: check.name, Status: PreflightSkip, Message: "not applicable to worker node seeds"}
+		if !check.masterOnly || s.nodeRole != NodeRoleWorker {
+			result.Status, result.Message = check.run(s)
+		}
+		s.log.Debugf("Preflight check %s: %s: %s", result.Name, result.Status, result.Message)
+		report.Checks = append(report.Checks, result)
+	}
+	return report
+}
+
+// checkHostCommands checks the host has the commands the seed creation runs, minimal hosts otherwise
+// failing a step midway with a bare exit status 127
+func (s *SeedCreator) checkHostCommands() (string, string) {
+	missing, err := ops.MissingCommands(s.ops, append(hostCommands, hostCommandsWithFallback...)...)
+	if err != nil {
+		return PreflightFail, err.Error()
+	}
+	isMissing := map[string]bool{}
+	for _, command := range missing {
+		isMissing[command] = true
+	}
+	var required, fallback []string
+	for _, command := range hostCommands {
+		if isMissing[command] {
+			required = append(required, command)
+		}
+	}
+	for _, command := range hostCommandsWithFallback {
+		if isMissing[command] {
+			fallback = append(fallback, command)
+		}
+	}
+	switch {
+	case len(required) > 0:
+		return PreflightFail, "missing host commands: " + strings.Join(required, ", ")
+	case len(fallback) > 0:
+		return PreflightWarn, "missing host commands: " + strings.Join(fallback, ", ") + ", done without them"
+	}
+	return PreflightPass, "all host commands are available"
+}
+
+// checkDiskSpace checks the backup dir can hold the archives of /var and the ostree repo
+func (s *SeedCreator) checkDiskSpace() (string, string) {
+	varSize, err := s.diskUsage(append(s.duExcludeArgs(), s.varArchiveRoot())...)
+	if err != nil {
+		return PreflightFail, err.Error()
+	}
+	ostreeSize, err := s.diskUsage("/ostree/repo")
+	if err != nil {
+		return PreflightFail, err.Error()
+	}
+	if err = prepareBackupDir(s.backupDir); err != nil {
+		return PreflightFail, err.Error()
+	}
+	free, err := s.freeSpace(s.backupDir)
+	if err != nil {
+		return PreflightFail, err.Error()
+	}
+
+	archived := varSize + ostreeSize
+	message := fmt.Sprintf("%.1f GiB free in %s for %.1f GiB to archive", float64(free)/(1<<30), s.backupDir,
+		float64(archived)/(1<<30))
+	switch {
+	case float64(free) < float64(archived)*minCompressionRatio:
+		return PreflightFail, message
+	case free < archived:
+		return PreflightWarn, message + ", enough only if the archives compress well"
+	}
+	return PreflightPass, message
+}
+
+// freeSpace returns the space available to unprivileged users in the filesystem of dir
+func (s *SeedCreator) freeSpace(dir string) (uint64, error) {
+	output, err := s.ops.RunInHostNamespace("df", "--output=avail", "-B1", dir)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Failed to get the free space of %s", dir)
+	}
+	fields := strings.Fields(output)
+	if len(fields) < 2 {
+		return 0, errors.Errorf("Unexpected df output %q", output)
+	}
+	return strconv.ParseUint(fields[len(fields)-1], 10, 64)
+}
+
+// checkSNOTopology checks the cluster is a single-node OpenShift, the only topology seeds are cut from
+func (s *SeedCreator) checkSNOTopology() (string, string) {
+	nodes, err := s.getResourceHealth("nodes")
+	if err != nil {
+		return PreflightFail, err.Error()
+	}
+	if len(nodes) != 1 {
+		names := make([]string, 0, len(nodes))
+		for _, node := range nodes {
+			names = append(names, node.Name)
+		}
+		return PreflightFail, fmt.Sprintf("the cluster has %d nodes (%s), seeds are cut from single-node clusters only",
+			len(nodes), strings.Join(names, ", "))
+	}
+	if !nodes[0].Healthy {
+		return PreflightFail, fmt.Sprintf("node %s is not ready", nodes[0].Name)
+	}
+	return PreflightPass, fmt.Sprintf("single node %s is ready", nodes[0].Name)
+}
+
+// checkClusterOperators checks the cluster operators are available and not degraded
+func (s *SeedCreator) checkClusterOperators() (string, string) {
+	operators, err := s.getResourceHealth("clusteroperators")
+	if err != nil {
+		return PreflightFail, err.Error()
+	}
+	var unhealthy []string
+	for _, operator := range operators {
+		if !operator.Healthy {
+			unhealthy = append(unhealthy, operator.Name)
+		}
+	}
+	if len(unhealthy) > 0 {
+		return PreflightFail, fmt.Sprintf("%d of %d cluster operators are unavailable or degraded: %s",
+			len(unhealthy), len(operators), strings.Join(unhealthy, ", "))
+	}
+	return PreflightPass, fmt.Sprintf("%d cluster operators are available and not degraded", len(operators))
+}
+
+// checkRegistry checks the seed image registry is reachable with the credentials of the auth file
+func (s *SeedCreator) checkRegistry() (string, string) {
+	if s.skipPush {
+		return PreflightSkip, "the seed image isn't pushed"
+	}
+	if s.output != nil {
+		return PreflightSkip, "the seed image is exported to " + s.output.String()
+	}
+	client, err := registry.NewClient(s.authFile)
+	if err != nil {
+		return PreflightFail, err.Error()
+	}
+	if err = s.resolveTag(); err != nil {
+		return PreflightFail, err.Error()
+	}
+	ref, err := registry.ParseReference(s.seedImage())
+	if err != nil {
+		return PreflightFail, err.Error()
+	}
+	_, err = client.ResolveDigest(ref)
+	switch {
+	case registry.IsNotFound(err):
+		return PreflightPass, fmt.Sprintf("registry %s is reachable", ref.Registry)
+	case err != nil:
+		return PreflightFail, err.Error()
+	}
+	return PreflightWarn, fmt.Sprintf("registry %s is reachable, %s already exists and would be overwritten", ref.Registry, s.seedImage())
+}
+
+// checkRecertImage checks the recert image, or one of its mirrors, is available
+func (s *SeedCreator) checkRecertImage() (string, string) {
+	mirrors, err := s.recertImageMirrors()
+	if err != nil {
+		return PreflightFail, err.Error()
+	}
+	image, err := s.firstAvailableImage(append(mirrors, s.recert.Image))
+	if err != nil {
+		return PreflightFail, fmt.Sprintf("recert image %s isn't available, %v", s.recert.Image, err)
+	}
+	return PreflightPass, fmt.Sprintf("recert image is available from %s", image)
+}
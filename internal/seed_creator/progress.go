@@ -0,0 +1,64 @@
+package seed_creator
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// progressPercentStep is the percent-complete increment between two progress logs
+	progressPercentStep = 5
+	// progressFilesStep is the number of files between two progress logs when the total is unknown
+	progressFilesStep = 10000
+)
+
+// archiveProgress logs how far tar went through a tree, counting the names tar --verbose lists
+// against the number of files counted beforehand
+type archiveProgress struct {
+	log         *logrus.Logger
+	tree        string
+	total       uint64
+	done        uint64
+	lastPercent uint64
+}
+
+func newArchiveProgress(log *logrus.Logger, tree string, total uint64) *archiveProgress {
+	return &archiveProgress{log: log, tree: tree, total: total}
+}
+
+// add accounts for one more archived file
+func (p *archiveProgress) add() {
+	p.done++
+	if p.total == 0 {
+		if p.done%progressFilesStep == 0 {
+			p.log.Infof("Archived %d files of %s", p.done, p.tree)
+		}
+		return
+	}
+
+	// The tree may have grown since it was counted
+	percent := p.done * 100 / p.total
+	if percent > 100 {
+		percent = 100
+	}
+	if percent >= p.lastPercent+progressPercentStep {
+		p.lastPercent = percent - percent%progressPercentStep
+		p.log.Infof("Archived %d%% of %s (%d/%d files)", p.lastPercent, p.tree, p.done, p.total)
+	}
+}
+
+// fileCount returns the number of files and directories of the given du arguments
+func (s *SeedCreator) fileCount(args ...string) (uint64, error) {
+	output, err := s.ops.RunInHostNamespace("du", append([]string{"-s", "--inodes"}, args...)...)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to count files")
+	}
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return 0, errors.Errorf("Unexpected du output %q", output)
+	}
+	return strconv.ParseUint(fields[0], 10, 64)
+}
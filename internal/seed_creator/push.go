@@ -0,0 +1,183 @@
+package seed_creator
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+
+	containers "ibu-imager/internal/container_runtime"
+	"ibu-imager/internal/ops"
+)
+
+// maxParallelPushes is the maximum number of destinations the seed image is pushed to concurrently
+const maxParallelPushes = 3
+
+// PushStatus is the outcome of pushing the seed image to one destination
+type PushStatus struct {
+	Image string `json:"image"`
+	// Primary is set for the --registry destination, which the run fails without
+	Primary bool   `json:"primary,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Signature is the signed image@digest reference, set when the push was signed
+	Signature string `json:"signature,omitempty"`
+}
+
+// PushConfig selects an already built seed image and the registries Push pushes it to
+type PushConfig struct {
+	// SourceRegistry is the registry the seed image was built for, Registry when empty
+	SourceRegistry string
+	// Registry is the primary destination, the push fails without it
+	Registry string
+	// MirrorRegistries are the additional destinations, best-effort
+	MirrorRegistries []string
+	Tag              string
+	AuthFile         string
+	// ImageStore also pushes the <tag>-image-store image
+	ImageStore bool
+}
+
+// Validate checks the push configuration
+func (c *PushConfig) Validate() error {
+	if c.Registry == "" {
+		return errors.New("A destination registry is required")
+	}
+	if c.Tag == "" {
+		return errors.New("A seed image tag is required")
+	}
+	if IsTagTemplate(c.Tag) {
+		return errors.Errorf("The tag %s has variables, give the tag create resolved them to", c.Tag)
+	}
+	if err := ValidateTag(c.Tag); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Push pushes a seed image built with --skip-push from the local storage to the registry and its mirrors
+func Push(log *logrus.Logger, runtime containers.Runtime, config PushConfig) ([]PushStatus, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	source := config.SourceRegistry
+	if source == "" {
+		source = config.Registry
+	}
+	image := source + ":" + config.Tag
+	if err := runtime.ImageExists(image); err != nil {
+		return nil, errors.Wrapf(err, "Seed image %s not found in the local storage", image)
+	}
+
+	destinations := []string{config.Registry + ":" + config.Tag}
+	for _, registry := range config.MirrorRegistries {
+		destinations = append(destinations, registry+":"+config.Tag)
+	}
+	statuses, err := pushImages(log, runtime, config.AuthFile, image, destinations)
+	if err != nil || !config.ImageStore {
+		return statuses, err
+	}
+
+	// The image store goes to the primary registry only, like create does
+	storeStatuses, err := pushImages(log, runtime, config.AuthFile, image+imageStoreTagSuffix,
+		[]string{destinations[0] + imageStoreTagSuffix})
+	return append(statuses, storeStatuses...), err
+}
+
+// mirrorImages returns the seed image references in the mirror registries
+func (s *SeedCreator) mirrorImages() []string {
+	images := make([]string, 0, len(s.mirrorRegistries))
+	for _, registry := range s.mirrorRegistries {
+		images = append(images, registry+":"+s.backupTag)
+	}
+	return images
+}
+
+// pushSeedImage pushes the built seed image to the primary registry and its mirrors concurrently.
+// Mirror failures are only reported, so a flaky mirror doesn't cost a new seed creation run.
+func (s *SeedCreator) pushSeedImage(image string) error {
+	statuses, err := pushImages(s.log, s.runtime, s.authFile, image, append([]string{image}, s.mirrorImages()...))
+	s.report.Pushes = statuses
+	return err
+}
+
+// pushSeedArtifact pushes the backup dir artifacts as an ORAS artifact to the primary registry and its
+// mirrors, annotated like the seed image is labeled
+func (s *SeedCreator) pushSeedArtifact(artifacts []string, digests layerCache) error {
+	annotations := artifactAnnotations(artifacts, digests)
+	statuses, err := pushAll(s.log, append([]string{s.seedImage()}, s.mirrorImages()...), func(destination string) error {
+		_, err := s.orasClient.Push(s.backupDir, artifacts, destination, annotations)
+		return err
+	})
+	s.report.Pushes = statuses
+	return err
+}
+
+// pushImages pushes the local image to the destinations concurrently, failing only when the first, primary,
+// destination fails
+func pushImages(log *logrus.Logger, runtime containers.Runtime, authFile, image string, destinations []string) ([]PushStatus, error) {
+	return pushAll(log, destinations, func(destination string) error {
+		return pushImage(log, runtime, authFile, image, destination)
+	})
+}
+
+// pushAll runs the push to every destination concurrently, failing only when the first, primary,
+// destination fails
+func pushAll(log *logrus.Logger, destinations []string, push func(destination string) error) ([]PushStatus, error) {
+	var (
+		mu       sync.Mutex
+		statuses = make([]PushStatus, 0, len(destinations))
+		group    errgroup.Group
+	)
+	for i, destination := range destinations {
+		statuses = append(statuses, PushStatus{Image: destination, Primary: i == 0})
+	}
+	group.SetLimit(maxParallelPushes)
+
+	for i := range statuses {
+		i := i
+		group.Go(func() error {
+			err := push(statuses[i].Image)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				statuses[i].Error = err.Error()
+				if !statuses[i].Primary {
+					log.Warnf("Failed to push seed image to mirror %s: %v", statuses[i].Image, err)
+				}
+			}
+			return nil
+		})
+	}
+	_ = group.Wait()
+
+	if statuses[0].Error != "" {
+		return statuses, errors.Errorf("Failed to push seed image: %s", statuses[0].Error)
+	}
+	return statuses, nil
+}
+
+// pushImage pushes the local image to the destination, tagging it first when it's pushed under another name
+func pushImage(log *logrus.Logger, runtime containers.Runtime, authFile, image, destination string) error {
+	if destination == image {
+		stream, err := runtime.Push(image, authFile)
+		if err == nil {
+			err = ops.LogStream(log, stream)
+		}
+		return err
+	}
+
+	// Mirror pushes aren't logged, their output would interleave with the primary's
+	if err := runtime.Tag(image, destination); err != nil {
+		return errors.Wrapf(err, "Failed to tag seed image as %s", destination)
+	}
+	stream, err := runtime.Push(destination, authFile)
+	if err == nil {
+		err = ops.DrainStream(stream)
+	}
+	if err != nil {
+		return err
+	}
+	log.Println("Pushed seed image to", destination)
+	return nil
+}
@@ -0,0 +1,307 @@
+package seed_creator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	containers "ibu-imager/internal/container_runtime"
+)
+
+const (
+	// DefaultRecertImage is the recert image used to validate that the seed can be re-certified
+	DefaultRecertImage = "quay.io/edge-infrastructure/recert:latest"
+
+	// RecertSummaryFile is the recert dry-run summary
+	RecertSummaryFile = "recert.summary"
+	// etcdPodManifest is the static pod manifest of etcd, used to find the etcd image
+	etcdPodManifest = "/etc/kubernetes/manifests/etcd-pod.yaml"
+	// etcdContainerName prefixes the name of the unauthenticated etcd container used by recert
+	etcdContainerName = "recert_etcd"
+	// recertContainerName prefixes the name of the recert dry-run container
+	recertContainerName = "recert"
+	// etcdHost is where the unauthenticated etcd listens, on ports picked at run time
+	etcdHost = "127.0.0.1"
+	// etcdDefaultClientPort is the client port of the cluster etcd
+	etcdDefaultClientPort = 2379
+	// etcdReadyTimeout is how long to wait for the unauthenticated etcd to be ready
+	etcdReadyTimeout = 2 * time.Minute
+	// etcdDataDir is the live etcd data directory
+	etcdDataDir = "/var/lib/etcd"
+)
+
+// RecertConfig configures the recert dry-run
+type RecertConfig struct {
+	// Image is the recert container image
+	Image string
+	// CPUs limits the CPUs of the etcd and recert containers (podman --cpus)
+	CPUs string
+	// Memory limits the memory of the etcd and recert containers (podman --memory)
+	Memory string
+	// CgroupParent is the cgroup slice the etcd and recert containers run in (podman --cgroup-parent)
+	CgroupParent string
+	// SignaturePolicy is the containers-policy.json(5) file the etcd and recert images are verified against
+	SignaturePolicy string
+	// Secure refuses etcd and recert images that the signature policy doesn't verify
+	Secure bool
+	// CopyEtcd runs the unauthenticated etcd against a copy of the etcd data, keeping the live data untouched
+	CopyEtcd bool
+	// Timeout cancels the dry-run when it takes longer, removing its containers. Not limited when 0.
+	Timeout time.Duration
+}
+
+// resourceArgs returns the container run options limiting the container resources
+func (c *RecertConfig) resourceArgs() []string {
+	var args []string
+	if c.CPUs != "" {
+		args = append(args, "--cpus", c.CPUs)
+	}
+	if c.Memory != "" {
+		args = append(args, "--memory", c.Memory)
+	}
+	if c.CgroupParent != "" {
+		args = append(args, "--cgroup-parent", c.CgroupParent)
+	}
+	return args
+}
+
+// etcdImage returns the etcd image of the etcd static pod
+func (s *SeedCreator) etcdImage() (string, error) {
+	manifest, err := s.ops.RunInHostNamespace("cat", etcdPodManifest)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to read etcd pod manifest")
+	}
+	var pod struct {
+		Spec struct {
+			Containers []struct {
+				Name  string `yaml:"name"`
+				Image string `yaml:"image"`
+			} `yaml:"containers"`
+		} `yaml:"spec"`
+	}
+	if err = yaml.Unmarshal([]byte(manifest), &pod); err != nil {
+		return "", errors.Wrap(err, "Failed to parse etcd pod manifest")
+	}
+	for _, container := range pod.Spec.Containers {
+		if container.Name == "etcd" {
+			return container.Image, nil
+		}
+	}
+	return "", errors.New("No etcd container found in the etcd pod manifest")
+}
+
+// runRecertDryRun runs recert against an unauthenticated etcd serving the quiesced etcd data, to
+// validate that the seed can be re-certified on the target
+func (s *SeedCreator) runRecertDryRun() error {
+	summary := path.Join(s.backupDir, RecertSummaryFile)
+	_, err := os.Stat(summary)
+	if err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	s.log.Println("Running recert dry-run")
+	image, recertImage, err := s.recertImages()
+	if err != nil {
+		return err
+	}
+	dataDir, cleanup, err := s.prepareEtcdData()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if err = s.recertDryRun(image, recertImage, dataDir, s.backupDir); err != nil {
+		return err
+	}
+	s.log.Println("Recert dry-run succeeded.")
+	return nil
+}
+
+// recertImages returns the etcd and recert images of the dry-run, verified against the signature policy
+func (s *SeedCreator) recertImages() (string, string, error) {
+	image, err := s.etcdImage()
+	if err != nil {
+		return "", "", err
+	}
+	recertImage := s.recertImage()
+	if err = s.verifyImages(image, recertImage); err != nil {
+		return "", "", err
+	}
+	return image, recertImage, nil
+}
+
+// recertDryRun serves the etcd data dir with an unauthenticated etcd of the image and runs the recert
+// dry-run against it, writing its summary to the summary dir. The containers are tracked from their start:
+// they're force-removed when the run context is cancelled or the dry-run times out, and in any case before
+// returning, so the etcd data dir isn't bind mounted anymore when the caller cleans it up.
+func (s *SeedCreator) recertDryRun(image, recertImage, dataDir, summaryDir string) (err error) {
+	ctx := s.ctx
+	if s.recert.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.recert.Timeout)
+		defer cancel()
+	}
+	runtime := containers.NewTracker(s.runtime)
+	defer s.releaseContainers(runtime)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.log.Warnf("Recert dry-run cancelled, removing its containers: %v", ctx.Err())
+			s.releaseContainers(runtime)
+		case <-done:
+		}
+	}()
+	defer close(done)
+	defer func() {
+		// The containers failed on being removed, the cancellation tells why
+		if err != nil && ctx.Err() != nil {
+			err = errors.Wrap(ctx.Err(), "Recert dry-run cancelled")
+		}
+	}()
+
+	// A partial quiesce may leave the cluster etcd listening on the default ports, pick free ones
+	if portInUse(etcdDefaultClientPort) {
+		s.log.Warnf("Port %d is in use, the cluster etcd may still be running", etcdDefaultClientPort)
+	}
+	clientPort, err := freeLocalPort()
+	if err != nil {
+		return err
+	}
+	peerPort, err := freeLocalPort()
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s:%d", etcdHost, clientPort)
+	s.log.Debugf("Serving recert etcd on %s", endpoint)
+
+	etcdContainer := s.containerName(etcdContainerName)
+	etcdArgs := append([]string{"--name", etcdContainer, "--detach", "--rm", "--network=host", "--privileged"},
+		s.runLabelArgs()...)
+	etcdArgs = append(etcdArgs, s.recert.resourceArgs()...)
+	etcdArgs = append(etcdArgs, "--entrypoint", "etcd", "-v", dataDir+":/store", image,
+		"--name", "editor", "--data-dir", "/store",
+		"--listen-client-urls", "http://"+endpoint, "--advertise-client-urls", "http://"+endpoint,
+		"--listen-peer-urls", fmt.Sprintf("http://%s:%d", etcdHost, peerPort))
+	if err = runtime.Run(s.authFile, etcdArgs...); err != nil {
+		return errors.Wrap(err, "Failed to run recert etcd")
+	}
+
+	if err = waitForEtcd(ctx, endpoint); err != nil {
+		return err
+	}
+
+	recertArgs := append([]string{"--name", s.containerName(recertContainerName), "--rm", "--network=host", "--privileged"},
+		s.runLabelArgs()...)
+	recertArgs = append(recertArgs, s.recert.resourceArgs()...)
+	recertArgs = append(recertArgs,
+		"-v", "/etc/kubernetes:/kubernetes",
+		"-v", "/var/lib/kubelet:/kubelet",
+		"-v", "/etc/machine-config-daemon:/machine-config-daemon",
+		"-v", summaryDir+":/backup",
+		recertImage,
+		"--etcd-endpoint", endpoint,
+		"--static-dir", "/kubernetes",
+		"--static-dir", "/kubelet",
+		"--static-dir", "/machine-config-daemon",
+		"--summary-file", path.Join("/backup", RecertSummaryFile),
+		"--dry-run")
+	if err = runtime.Run(s.authFile, recertArgs...); err != nil {
+		return errors.Wrap(err, "Recert dry-run failed")
+	}
+	return nil
+}
+
+// releaseContainers force-removes the tracked containers still around
+func (s *SeedCreator) releaseContainers(runtime *containers.Tracker) {
+	tracked := runtime.Tracked()
+	if len(tracked) == 0 {
+		return
+	}
+	s.log.Debugf("Removing containers %v", tracked)
+	if err := runtime.Release(); err != nil {
+		s.log.Warnf("Failed to remove containers %v, run the gc command: %v", tracked, err)
+	}
+}
+
+// prepareEtcdData returns the etcd data directory the unauthenticated etcd serves, copying the live
+// data to a scratch directory when configured to. The returned cleanup removes the copy
+func (s *SeedCreator) prepareEtcdData() (string, func(), error) {
+	if !s.recert.CopyEtcd {
+		return etcdDataDir, func() {}, nil
+	}
+
+	scratch := etcdScratchDir(s.backupDir)
+	s.log.Printf("Copying %s to %s for the recert dry-run", etcdDataDir, scratch)
+	cleanup := func() {
+		if _, err := s.ops.RunInHostNamespace("rm", "-rf", scratch); err != nil {
+			s.log.Warnf("Failed to remove %s: %v", scratch, err)
+		}
+	}
+	// Remove leftovers of an interrupted run so the copy reflects the current data
+	cleanup()
+	// Reflinks make the copy nearly free on filesystems supporting them, e.g. XFS on RHCOS
+	if _, err := s.ops.RunBashInHostNamespace("mkdir", "-p", path.Dir(scratch), "&&",
+		"cp", "-a", "--reflink=auto", etcdDataDir, scratch); err != nil {
+		cleanup()
+		return "", nil, errors.Wrap(err, "Failed to copy etcd data")
+	}
+	return scratch, cleanup, nil
+}
+
+// freeLocalPort returns a loopback TCP port nothing listens on
+func freeLocalPort() (int, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(etcdHost, "0"))
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to find a free port for recert etcd")
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// portInUse returns true if something listens on the loopback port
+func portInUse(port int) bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(etcdHost, fmt.Sprint(port)), time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// waitForEtcd polls the etcd health endpoint until it answers, or the context is cancelled
+func waitForEtcd(ctx context.Context, endpoint string) error {
+	healthURL := "http://" + endpoint + "/health"
+	client := &http.Client{Timeout: 5 * time.Second}
+	deadline := time.Now().Add(etcdReadyTimeout)
+	listening := false
+	for time.Now().Before(deadline) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		resp, err := client.Get(healthURL)
+		if err == nil {
+			listening = true
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(2 * time.Second):
+		}
+	}
+	if listening {
+		// Another process took the port between picking it and etcd binding it
+		return errors.Errorf("Something other than recert etcd answers on %s, check the processes listening on it", endpoint)
+	}
+	return errors.Errorf("Timed out waiting for recert etcd at %s", healthURL)
+}
@@ -0,0 +1,86 @@
+package seed_creator
+
+import (
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// recertCheckDir is where recert-check restores the etcd snapshot and recert writes its summary,
+	// /var/tmp is excluded from the /var backup
+	recertCheckDir = "/var/tmp/recert-check"
+	// etcdSnapshotFile is the snapshot of the cluster etcd, saved to the data dir the etcdctl container
+	// of the etcd pod mounts from the host
+	etcdSnapshotFile = etcdDataDir + "/recert-check.db"
+	// etcdRestoreContainerName prefixes the name of the container restoring the etcd snapshot
+	etcdRestoreContainerName = "recert_etcd_restore"
+)
+
+// RecertCheck runs the recert dry-run against a snapshot of the running cluster etcd, returning the recert
+// summary. Nothing is backed up and no service is stopped, so operators can check a cluster can be
+// re-certified before creating its seed.
+func (s *SeedCreator) RecertCheck() (string, error) {
+	s.runID = newRunID()
+	s.log.Println("Checking the cluster can be re-certified")
+	// The cluster API is up, the recert image is pulled through its mirrors like create does
+	if err := s.resolveRecertImage(); err != nil {
+		return "", err
+	}
+	image, recertImage, err := s.recertImages()
+	if err != nil {
+		return "", err
+	}
+
+	cleanup := func() {
+		if _, err := s.ops.RunInHostNamespace("rm", "-rf", recertCheckDir, etcdSnapshotFile); err != nil {
+			s.log.Warnf("Failed to remove %s: %v", recertCheckDir, err)
+		}
+	}
+	// Remove leftovers of an interrupted check so the dry-run serves the current data
+	cleanup()
+	defer cleanup()
+	dataDir := path.Join(recertCheckDir, "data")
+	if err = s.restoreEtcdSnapshot(image, dataDir); err != nil {
+		return "", err
+	}
+
+	if err = s.recertDryRun(image, recertImage, dataDir, recertCheckDir); err != nil {
+		return "", err
+	}
+	summary, err := s.ops.RunInHostNamespace("cat", path.Join(recertCheckDir, RecertSummaryFile))
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to read recert summary")
+	}
+	s.log.Println("Recert dry-run succeeded.")
+	return summary, nil
+}
+
+// restoreEtcdSnapshot saves a snapshot of the cluster etcd through its maintenance API and restores it to
+// the data dir, which the unauthenticated etcd serves while the cluster etcd keeps running
+func (s *SeedCreator) restoreEtcdSnapshot(image, dataDir string) error {
+	pod, err := s.etcdPod()
+	if err != nil {
+		return err
+	}
+	s.log.Println("Saving etcd snapshot")
+	if _, err = s.etcdctl(pod, "snapshot", "save", etcdSnapshotFile); err != nil {
+		return err
+	}
+	snapshot := path.Join(recertCheckDir, "snapshot.db")
+	// The snapshot mustn't stay in the live data dir, the next seed would carry it
+	if _, err = s.ops.RunBashInHostNamespace("mkdir", "-p", recertCheckDir, "&&", "mv", etcdSnapshotFile, snapshot); err != nil {
+		return errors.Wrap(err, "Failed to move etcd snapshot")
+	}
+
+	s.log.Println("Restoring etcd snapshot")
+	restoreArgs := append([]string{"--name", s.containerName(etcdRestoreContainerName), "--rm", "--network=none"},
+		s.runLabelArgs()...)
+	restoreArgs = append(restoreArgs, s.recert.resourceArgs()...)
+	restoreArgs = append(restoreArgs, "--entrypoint", "etcdctl", "-v", recertCheckDir+":"+recertCheckDir, image,
+		"snapshot", "restore", snapshot, "--data-dir", dataDir)
+	if err = s.runtime.Run(s.authFile, restoreArgs...); err != nil {
+		return errors.Wrap(err, "Failed to restore etcd snapshot")
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package seed_creator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/image_mirrors"
+	registry "ibu-imager/internal/registry_client"
+)
+
+// recertImageFile keeps the recert image resolved through the cluster mirrors, outside the backup
+// dir, since the cluster API is down by the time the recert dry-run runs
+const recertImageFile = "/var/tmp/ibu-imager-recert-image.json"
+
+// resolvedImage is an image and the reference it's pulled from
+type resolvedImage struct {
+	Image    string `json:"image"`
+	Resolved string `json:"resolved"`
+}
+
+// resolveRecertImage resolves the recert image through the ICSP, IDMS and ITMS mirroring rules of
+// the cluster, so disconnected clusters pull it from their mirrors. The mirrors are tried in order
+// with the cluster pull secret, then the source itself, and it's an error if none provides it.
+func (s *SeedCreator) resolveRecertImage() error {
+	if resolved := s.recertImage(); resolved != s.recert.Image {
+		s.log.Printf("Skipping recert image resolution, already resolved to %s.", resolved)
+		return nil
+	}
+
+	mirrors, err := s.recertImageMirrors()
+	if err != nil {
+		return err
+	}
+	if len(mirrors) == 0 {
+		s.log.Debugf("No mirroring rule matches recert image %s", s.recert.Image)
+		return nil
+	}
+	resolved, err := s.firstAvailableImage(append(mirrors, s.recert.Image))
+	if err != nil {
+		return errors.Wrapf(err, "No mirror provides recert image %s", s.recert.Image)
+	}
+	s.log.Printf("Recert image %s resolved to %s", s.recert.Image, resolved)
+
+	data, err := json.Marshal(resolvedImage{Image: s.recert.Image, Resolved: resolved})
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal resolved recert image")
+	}
+	return errors.Wrap(os.WriteFile(recertImageFile, data, 0600), "Failed to write resolved recert image")
+}
+
+// recertImageMirrors returns the mirrors of the recert image, per the cluster mirroring rules
+func (s *SeedCreator) recertImageMirrors() ([]string, error) {
+	var rules []image_mirrors.Rule
+	for _, kind := range image_mirrors.Kinds {
+		output, err := s.ops.RunInHostNamespace("oc", "get", kind, "-o", "json", "--kubeconfig", s.kubeconfig)
+		if err != nil {
+			// Every kind is only served by some OCP versions
+			s.log.Debugf("No %s mirroring rules: %v", kind, err)
+			continue
+		}
+		kindRules, err := image_mirrors.ParseRules([]byte(output))
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, kindRules...)
+	}
+	return image_mirrors.Mirrors(rules, s.recert.Image), nil
+}
+
+// firstAvailableImage returns the first of the images the registry serves with the cluster pull secret
+func (s *SeedCreator) firstAvailableImage(images []string) (string, error) {
+	client, err := registry.NewClient(s.authFile)
+	if err != nil {
+		return "", err
+	}
+	var failures []string
+	for _, image := range images {
+		ref, err := registry.ParseReference(image)
+		if err == nil {
+			if _, err = client.ResolveDigest(ref); err == nil {
+				return image, nil
+			}
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", image, err))
+	}
+	return "", errors.Errorf("tried:\n  %s", strings.Join(failures, "\n  "))
+}
+
+// recertImage returns the reference the recert image is pulled from, the resolved mirror if any
+func (s *SeedCreator) recertImage() string {
+	data, err := os.ReadFile(recertImageFile)
+	if err != nil {
+		return s.recert.Image
+	}
+	var resolved resolvedImage
+	if err = json.Unmarshal(data, &resolved); err != nil || resolved.Image != s.recert.Image {
+		return s.recert.Image
+	}
+	return resolved.Resolved
+}
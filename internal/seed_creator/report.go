@@ -0,0 +1,139 @@
+package seed_creator
+
+import (
+	"os"
+	"path"
+	"time"
+
+	"ibu-imager/internal/resource_usage"
+)
+
+const (
+	// ResultSucceeded is the result of a successful run
+	ResultSucceeded = "Succeeded"
+	// ResultFailed is the result of a failed run
+	ResultFailed = "Failed"
+)
+
+// StepReport is the outcome of a single step of the run
+type StepReport struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	// Usage is the resources used by the step, missing when they couldn't be measured
+	Usage *resource_usage.Usage `json:"usage,omitempty"`
+}
+
+// RunReport summarizes a seed creation run
+type RunReport struct {
+	// RunID is the run-id label of the containers and images created by the run
+	RunID      string       `json:"runId,omitempty"`
+	Image      string       `json:"image"`
+	NodeRole   string       `json:"nodeRole"`
+	Result     string       `json:"result"`
+	Error      string       `json:"error,omitempty"`
+	StartedAt  time.Time    `json:"startedAt"`
+	FinishedAt time.Time    `json:"finishedAt"`
+	Steps      []StepReport `json:"steps"`
+	// PID is the process of the run, telling whether a running run is still alive
+	PID int `json:"pid,omitempty"`
+	// CurrentStep is the step in progress, only set while the run is
+	CurrentStep          string     `json:"currentStep,omitempty"`
+	CurrentStepStartedAt *time.Time `json:"currentStepStartedAt,omitempty"`
+	// Artifacts maps the artifacts in the backup dir to their size in bytes
+	Artifacts map[string]int64 `json:"artifacts,omitempty"`
+	// Pushes is the outcome of the seed image push per destination registry
+	Pushes []PushStatus `json:"pushes,omitempty"`
+	// Archives are the OCI archives the seed image was exported to, instead of being pushed
+	Archives []string `json:"archives,omitempty"`
+	// WrittenBytes is the peak growth of the backup dir filesystem usage, measured by the disk guard
+	WrittenBytes int64 `json:"writtenBytes,omitempty"`
+	// UsageScope tells what the resource usage of the steps accounts for, when it's measured
+	UsageScope string `json:"usageScope,omitempty"`
+}
+
+// Report returns the report of the last run
+func (s *SeedCreator) Report() *RunReport {
+	return &s.report
+}
+
+func (s *SeedCreator) startReport() {
+	s.runID = newRunID()
+	s.report = RunReport{
+		RunID:     s.runID,
+		Image:     s.seedImage(),
+		NodeRole:  s.nodeRole,
+		Result:    ResultRunning,
+		StartedAt: time.Now().UTC(),
+		PID:       os.Getpid(),
+	}
+	if s.meter != nil {
+		s.report.UsageScope = resource_usage.Scope
+	}
+	s.saveStatus()
+}
+
+func (s *SeedCreator) finishReport(err error) {
+	s.report.FinishedAt = time.Now().UTC()
+	s.report.Result = ResultSucceeded
+	if err != nil {
+		s.report.Result = ResultFailed
+		s.report.Error = err.Error()
+	}
+	s.report.Artifacts = s.artifactSizes()
+	s.report.CurrentStep = ""
+	s.report.CurrentStepStartedAt = nil
+	s.saveStatus()
+
+	if s.historyDir == "" {
+		return
+	}
+	if saveErr := SaveReport(s.historyDir, &s.report); saveErr != nil {
+		s.log.Warnf("Failed to save run report to history: %v", saveErr)
+	}
+}
+
+// startUsage starts measuring the resource usage of a step, returning nil when it isn't measured
+func (s *SeedCreator) startUsage() *resource_usage.Sample {
+	if s.meter == nil {
+		return nil
+	}
+	sample, err := s.meter.Start()
+	if err != nil {
+		s.log.Warnf("Failed to measure step resource usage: %v", err)
+	}
+	return sample
+}
+
+// stopUsage returns the resource usage of a step since startUsage, or nil when it isn't measured
+func (s *SeedCreator) stopUsage(sample *resource_usage.Sample) *resource_usage.Usage {
+	if sample == nil {
+		return nil
+	}
+	usage, err := sample.Stop()
+	if err != nil {
+		s.log.Warnf("Failed to measure step resource usage: %v", err)
+		return nil
+	}
+	return &usage
+}
+
+// artifactSizes returns the size of the regular file artifacts in the backup dir
+func (s *SeedCreator) artifactSizes() map[string]int64 {
+	entries, err := os.ReadDir(s.backupDir)
+	if err != nil {
+		return nil
+	}
+	sizes := map[string]int64{}
+	for _, entry := range entries {
+		info, err := os.Stat(path.Join(s.backupDir, entry.Name()))
+		if err == nil && info.Mode().IsRegular() && isSeedArtifact(entry.Name()) {
+			sizes[entry.Name()] = info.Size()
+		}
+	}
+	return sizes
+}
+
+func (s *SeedCreator) seedImage() string {
+	return s.containerRegistry + ":" + s.backupTag
+}
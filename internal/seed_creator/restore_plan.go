@@ -0,0 +1,53 @@
+package seed_creator
+
+import (
+	"os"
+	"path"
+
+	"ibu-imager/pkg/seedmanifest"
+)
+
+// RestoreStep is a single step a restorer has to apply, see the seedmanifest package
+type RestoreStep = seedmanifest.RestoreStep
+
+// restoreSteps returns the restore steps of the artifacts this creator was configured to produce
+func (s *SeedCreator) restoreSteps() []RestoreStep {
+	steps := defaultRestoreSteps()
+	if s.sshKeysPolicy != "" {
+		steps = append(steps, RestoreStep{Name: "core-user", Artifact: coreUserFile, DependsOn: []string{"var"}})
+	}
+	if s.auditLogPolicy == AuditLogPolicyInclude {
+		steps = append(steps, RestoreStep{Name: "audit-logs", Artifact: auditLogsFile, DependsOn: []string{"var"}})
+	}
+	// Only archived when /usr/local isn't carried by var.tgz
+	if _, err := os.Stat(path.Join(s.backupDir, usrLocalFile)); err == nil {
+		steps = append(steps, RestoreStep{Name: "usr-local", Artifact: usrLocalFile, DependsOn: []string{"ostree"}})
+	}
+	if s.mcs.enabled() {
+		steps = append(steps, RestoreStep{Name: "machine-config-server", DependsOn: []string{"recert"}})
+	}
+	return steps
+}
+
+// defaultRestoreSteps returns the restore steps matching the artifacts produced by this creator
+func defaultRestoreSteps() []RestoreStep {
+	return []RestoreStep{
+		{Name: "validate-storage-layout", Artifact: storageLayoutFile},
+		{Name: "validate-selinux", Artifact: selinuxFile},
+		{Name: "validate-node-network", Artifact: nodeNetworkFile},
+		{Name: "kernel-arguments", Artifact: kernelFile},
+		{Name: "validate-crio-runtime", Artifact: crioRuntimeFile},
+		{Name: "ostree", Artifact: "ostree.tgz", DependsOn: []string{"validate-storage-layout", "validate-selinux", "validate-node-network",
+			"kernel-arguments", "validate-crio-runtime"}},
+		{Name: "var", Artifact: "var.tgz", DependsOn: []string{"ostree"}},
+		{Name: "etc", Artifact: "etc.tgz", DependsOn: []string{"ostree"}},
+		{Name: "etc-deletions", Artifact: seedmanifest.DeletionsFileName, DependsOn: []string{"etc"}},
+		{Name: "filesystem-references", Artifact: filesystemsFile, DependsOn: []string{"etc"}},
+		{Name: "recert", DependsOn: []string{"etc", "var"}},
+	}
+}
+
+// OrderRestoreSteps topologically sorts the restore steps by their dependencies
+func OrderRestoreSteps(steps []RestoreStep) ([]RestoreStep, error) {
+	return seedmanifest.OrderRestoreSteps(steps)
+}
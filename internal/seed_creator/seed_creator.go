@@ -1,96 +1,278 @@
 package seed_creator
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
+	"ibu-imager/internal/archive"
+	containers "ibu-imager/internal/container_runtime"
+	cri "ibu-imager/internal/cri_client"
+	featuregate "ibu-imager/internal/feature_gate"
 	"ibu-imager/internal/ops"
+	oras "ibu-imager/internal/oras_client"
 	ostree "ibu-imager/internal/ostree_client"
+	planner "ibu-imager/internal/precache_plan"
+	"ibu-imager/internal/resource_usage"
+	lint "ibu-imager/internal/seed_lint"
 )
 
 const (
 	varFolder = "/var"
+	// containerListDoneFile marks the container list, catalog sources and clusterversion as saved
+	containerListDoneFile = "/var/tmp/container_list.done"
+	// mcoCurrentConfigFile is the machine config the MCD last applied to the node
+	mcoCurrentConfigFile = "/etc/machine-config-daemon/currentconfig"
+	// sysrootDir is where the host physical root, holding the ostree deployments, is mounted
+	sysrootDir = "/sysroot"
+	// workerVarDir is the only part of /var a worker node seed carries, the kubelet state
+	workerVarDir = "/var/lib/kubelet"
+	// workerEtcDir is the only part of /etc a worker node seed carries, the kubelet config and credentials
+	workerEtcDir = "/etc/kubernetes"
+
+	// containerStopTimeout is the number of seconds crictl waits for a container to stop
+	containerStopTimeout = 5
+	// containerStopRetries is the number of times stragglers are retried before failing
+	containerStopRetries = 3
 )
 
-// containerFileContent is the Dockerfile content for the IBU seed image
-const containerFileContent = `
-FROM scratch
-COPY . /
-`
+// DefaultVarExcludePatterns are the paths excluded from the /var backup unless configured otherwise
+var DefaultVarExcludePatterns = []string{
+	"/var/tmp/*",
+	"/var/lib/log/*",
+	"/var/log/*",
+	"/var/lib/containers/*",
+	"/var/lib/kubelet/pods/*",
+	"/var/lib/cni/bin/*",
+}
+
+// requiredVarExcludePatterns are the paths always excluded from the /var backup, whatever the configured ones
+var requiredVarExcludePatterns = []string{
+	// The run history and status of the imager itself
+	HistoryDir + "/*",
+	StatusFile + "*",
+	// The scratch files of the imager, the backup dir holding the others is excluded on its own
+	inputsFile,
+	layerCacheFile,
+	containerListDoneFile,
+	recertImageFile,
+	recertCheckDir + "/*",
+}
+
+// coreUserExcludePatterns are the paths additionally excluded from the /var backup when the core user
+// artifact is produced, its SSH keys are then only carried through it and restored with its policy
+var coreUserExcludePatterns = []string{
+	"/var/home/core/.ssh/*",
+}
+
+// keepCrioExcludePatterns are the paths additionally excluded from the /var backup when CRI-O is
+// kept running, since it keeps writing its live state there
+var keepCrioExcludePatterns = []string{
+	"/var/lib/crio/*",
+}
 
-// SeedCreator TODO: move params to Options
+// SeedCreator collects the artifacts of the seed from the host, and builds and pushes the seed image
 type SeedCreator struct {
-	log               *logrus.Logger
-	ops               ops.Ops
-	ostreeClient      *ostree.Client
-	backupDir         string
-	kubeconfig        string
-	containerRegistry string
-	backupTag         string
-	authFile          string
+	log                   *logrus.Logger
+	ctx                   context.Context
+	ops                   ops.Ops
+	runtime               containers.Runtime
+	ostreeClient          *ostree.Client
+	criClient             *cri.Client
+	backupDir             string
+	kubeconfig            string
+	containerRegistry     string
+	backupTag             string
+	authFile              string
+	nodeRole              string
+	imageFilter           cri.ImageFilter
+	recert                RecertConfig
+	sshKeysPolicy         string
+	installationConfig    installationConfig
+	lintRules             *lint.RuleSet
+	mcs                   MCSConfig
+	imageStore            bool
+	auditLogPolicy        string
+	strict                bool
+	mirrorRegistries      []string
+	keepCrio              bool
+	resume                bool
+	skipPush              bool
+	includeUsrLocal       bool
+	varExclude            []string
+	precachePlan          planner.Config
+	runID                 string
+	meter                 *resource_usage.Meter
+	orasClient            *oras.Client
+	output                *Output
+	steps                 *StepSelection
+	diskGuard             *DiskGuard
+	extraArtifacts        []ExtraArtifact
+	extraArtifactsMaxSize int64
+	includePaths          []string
+	featureGates          *featuregate.Gates
+	diskWatch             *diskWatch
+	fromBackupDir         bool
+	report                RunReport
+	statusFile            string
+	historyDir            string
 }
 
-func NewSeedCreator(log *logrus.Logger, ops ops.Ops, ostreeClient *ostree.Client, backupDir,
-	kubeconfig, containerRegistry, backupTag, authFile string) *SeedCreator {
+// NewSeedCreator returns the seed creator of the options, applying the defaults of the options left empty
+func NewSeedCreator(log *logrus.Logger, ops ops.Ops, options Options) *SeedCreator {
+	options = options.withDefaults()
+	// podman is the runtime of the CoreOS hosts seeds are created on
+	if options.Runtime == nil {
+		options.Runtime = containers.NewPodman(ops)
+	}
 	return &SeedCreator{
-		log:               log,
-		ops:               ops,
-		ostreeClient:      ostreeClient,
-		backupDir:         backupDir,
-		kubeconfig:        kubeconfig,
-		containerRegistry: containerRegistry,
-		backupTag:         backupTag,
-		authFile:          authFile,
+		log:                   log,
+		ctx:                   options.Context,
+		ops:                   ops,
+		runtime:               options.Runtime,
+		ostreeClient:          options.OstreeClient,
+		criClient:             cri.NewClient(log, ops),
+		backupDir:             options.BackupDir,
+		statusFile:            StatusFile,
+		historyDir:            HistoryDir,
+		kubeconfig:            options.Kubeconfig,
+		containerRegistry:     options.Registry,
+		backupTag:             options.Tag,
+		authFile:              options.AuthFile,
+		nodeRole:              options.NodeRole,
+		imageFilter:           options.ImageFilter,
+		recert:                options.Recert,
+		sshKeysPolicy:         options.SSHKeysPolicy,
+		installationConfig:    defaultInstallationConfig(),
+		lintRules:             options.LintRules,
+		mcs:                   options.MCS,
+		imageStore:            options.ImageStore,
+		auditLogPolicy:        options.AuditLogPolicy,
+		strict:                options.Strict,
+		mirrorRegistries:      options.MirrorRegistries,
+		keepCrio:              options.KeepCrio,
+		resume:                options.Resume,
+		skipPush:              options.SkipPush,
+		includeUsrLocal:       options.IncludeUsrLocal,
+		varExclude:            options.VarExcludePatterns,
+		precachePlan:          options.PrecachePlan,
+		meter:                 options.Meter,
+		orasClient:            options.ORAS,
+		output:                options.Output,
+		steps:                 options.Steps,
+		diskGuard:             options.DiskGuard,
+		extraArtifacts:        options.ExtraArtifacts,
+		extraArtifactsMaxSize: options.ExtraArtifactsMaxSize,
+		includePaths:          options.IncludePaths,
+		featureGates:          options.FeatureGates,
 	}
 }
 
-func (s *SeedCreator) CreateSeedImage() error {
+func (s *SeedCreator) CreateSeedImage() (err error) {
 	s.log.Println("Creating seed image")
+	s.startReport()
+	defer func() { s.finishReport(err) }()
 
 	// create backup dir
-	if err := os.MkdirAll(s.backupDir, 0700); err != nil {
+	if err = prepareBackupDir(s.backupDir); err != nil {
 		return err
 	}
-
-	if err := s.createContainerList(); err != nil {
+	if err = s.startDiskWatch(); err != nil {
 		return err
 	}
+	defer func() { err = s.stopDiskWatch(err) }()
 
-	if err := s.stopServices(); err != nil {
+	if err = s.resolveTag(); err != nil {
 		return err
 	}
-
-	if err := s.backupVar(); err != nil {
+	journal, err := s.openJournal()
+	if err != nil {
 		return err
 	}
 
-	if err := s.backupEtc(); err != nil {
-		return err
+	var inputs stepInputs
+	if s.strict {
+		if inputs, err = loadStepInputs(); err != nil {
+			return err
+		}
 	}
 
-	if err := s.backupOstree(); err != nil {
-		return err
+	if s.steps != nil {
+		s.log.Warnf("Running %s, the other artifacts are kept as left by previous runs", s.steps)
 	}
-
-	if err := s.backupRPMOstree(); err != nil {
-		return err
+	for _, step := range Steps() {
+		if step.masterOnly && s.nodeRole == NodeRoleWorker {
+			s.log.Debugf("Skipping step %s for worker node seed", step.Name)
+			continue
+		}
+		if !s.steps.Selects(step.Name) {
+			s.log.Infof("Skipping step %s, not selected", step.Name)
+			continue
+		}
+		if journal.completed(step.Name) {
+			// Resumed steps are trusted as done, --strict doesn't check their inputs again
+			s.log.Infof("Skipping step %s, completed by the interrupted run", step.Name)
+			continue
+		}
+		var stepFingerprint string
+		if s.strict && step.inputs != nil {
+			if stepFingerprint, err = s.invalidateStaleStep(step, inputs); err != nil {
+				return err
+			}
+		}
+		if err = s.runStep(step); err != nil {
+			return err
+		}
+		if stepFingerprint != "" {
+			inputs[step.Name] = stepFingerprint
+			if err = inputs.save(); err != nil {
+				return err
+			}
+		}
+		if err = journal.complete(step.Name); err != nil {
+			return err
+		}
 	}
 
-	if err := s.backupMCOConfig(); err != nil {
-		return err
-	}
+	return journal.remove()
+}
 
-	if err := s.createAndPushSeedImage(); err != nil {
-		return err
+// runStep runs the step, recording its duration, resource usage and outcome in the report
+func (s *SeedCreator) runStep(step Step) error {
+	// The completed steps are kept in the journal, the cancelled run can be resumed
+	if err := s.ctx.Err(); err != nil {
+		return errors.Wrap(err, "Seed creation cancelled")
 	}
-
-	return nil
+	// The free space may have crossed the disk guard limits once the previous step was done
+	if s.diskWatch != nil {
+		if err := s.diskWatch.err(); err != nil {
+			return err
+		}
+	}
+	s.log.Debugf("Running step %s", step.Name)
+	s.startStep(step.Name)
+	start := time.Now()
+	sample := s.startUsage()
+	err := step.run(s)
+	if err != nil && s.diskWatch != nil {
+		// The step failed on its host commands being terminated, the disk guard tells why
+		if tripped := s.diskWatch.interrupt(step.Name); tripped != nil {
+			err = tripped
+		}
+	}
+	stepReport := StepReport{Name: step.Name, Duration: time.Since(start), Usage: s.stopUsage(sample)}
+	if err != nil {
+		stepReport.Error = err.Error()
+	}
+	s.finishStep(stepReport)
+	return err
 }
 
 // TODO: split function per operation
@@ -98,37 +280,38 @@ func (s *SeedCreator) createContainerList() error {
 	s.log.Println("Saving list of running containers, catalogsources, and clusterversion.")
 
 	// Check if the file /var/tmp/container_list.done does not exist
-	if _, err := os.Stat("/var/tmp/container_list.done"); os.IsNotExist(err) {
-		// Execute 'crictl images -o json' command, parse the JSON output and extract image references using 'jq'
+	if _, err := os.Stat(containerListDoneFile); os.IsNotExist(err) {
 		s.log.Println("Save list of running containers")
-		args := []string{"images", "-o", "json", "|", "jq", "-r", "'.images[] | .repoDigests[], .repoTags[]'",
-			">", s.backupDir + "/containers.list"}
-
-		_, err = s.ops.RunBashInHostNamespace("crictl", args...)
-		if err != nil {
+		if err = s.saveContainerList(); err != nil {
 			return err
 		}
 
-		// Execute 'oc get catalogsource' command, parse the JSON output and extract image references using 'jq'
+		// Worker nodes don't host the API server, skip cluster-scoped artifacts
+		if s.nodeRole == NodeRoleWorker {
+			s.log.Println("Skipping catalogsources and clusterversion for worker node seed")
+			if _, err = os.Create(containerListDoneFile); err != nil {
+				return err
+			}
+			return nil
+		}
+
 		s.log.Println("Save catalog source images")
-		_, err = s.ops.RunBashInHostNamespace(
-			"oc", append([]string{"get", "catalogsource", "-A", "-o", "json", "--kubeconfig",
-				s.kubeconfig, "|", "jq", "-r", "'.items[].spec.image'"}, ">", s.backupDir+"/catalogimages.list")...)
-		if err != nil {
+		if err = s.saveCatalogImages(); err != nil {
+			return err
+		}
+
+		s.log.Println("Resolve catalog source image digests")
+		if err = s.resolveCatalogImageDigests(); err != nil {
 			return err
 		}
 
-		// Execute 'oc get clusterversion' command and save it
 		s.log.Println("Save clusterversion to file")
-		_, err = s.ops.RunBashInHostNamespace(
-			"oc", append([]string{"get", "clusterversion", "version", "-o", "json", "--kubeconfig", s.kubeconfig},
-				">", s.backupDir+"/clusterversion.json")...)
-		if err != nil {
+		if err = s.saveOcOutput(clusterVersionFile, "get", "clusterversion", "version", "-o", "json"); err != nil {
 			return err
 		}
 
 		// Create the file /var/tmp/container_list.done
-		_, err = os.Create("/var/tmp/container_list.done")
+		_, err = os.Create(containerListDoneFile)
 		if err != nil {
 			return err
 		}
@@ -140,6 +323,30 @@ func (s *SeedCreator) createContainerList() error {
 	return nil
 }
 
+// saveContainerList writes the references of the images in the CRI-O storage kept by the image filter
+func (s *SeedCreator) saveContainerList() error {
+	images, err := s.criClient.ListImages()
+	if err != nil {
+		return err
+	}
+
+	if !s.imageFilter.IsEmpty() {
+		containers, err := s.criClient.ListContainers()
+		if err != nil {
+			return err
+		}
+		kept := s.imageFilter.Filter(images, containers)
+		s.log.Infof("Image filter kept %d out of %d images", len(kept), len(images))
+		images = kept
+	}
+
+	var content string
+	for _, ref := range cri.ImageReferences(images) {
+		content += ref + "\n"
+	}
+	return os.WriteFile(path.Join(s.backupDir, ContainersListFile), []byte(content), 0600)
+}
+
 func (s *SeedCreator) stopServices() error {
 	s.log.Println("Stop kubelet service")
 	_, err := s.ops.SystemctlAction("stop", "kubelet.service")
@@ -163,12 +370,15 @@ func (s *SeedCreator) stopServices() error {
 
 		// CRI-O is active, so stop running containers
 		s.log.Println("Stop running containers")
-		args := []string{"ps", "-q", "|", "xargs", "--no-run-if-empty", "--max-args", "1", "--max-procs", "10", "crictl", "stop", "--timeout", "5"}
-		_, err = s.ops.RunBashInHostNamespace("crictl", args...)
-		if err != nil {
+		if err = s.criClient.StopAllContainers(containerStopTimeout, containerStopRetries); err != nil {
 			return err
 		}
 
+		if s.keepCrio {
+			s.log.Println("Running containers stopped successfully, keeping CRI-O running.")
+			return nil
+		}
+
 		// Execute a D-Bus call to stop the CRI-O runtime
 		s.log.Debug("Stopping CRI-O engine")
 		_, err = s.ops.SystemctlAction("stop", "crio.service")
@@ -183,6 +393,38 @@ func (s *SeedCreator) stopServices() error {
 	return nil
 }
 
+// varExcludePatterns returns the paths excluded from the /var backup: the configured ones, the required ones
+// and the backup dir when it's in /var
+func (s *SeedCreator) varExcludePatterns() []string {
+	patterns := append([]string{}, s.varExclude...)
+	for _, pattern := range requiredVarExcludePatterns {
+		if !excludedBy(pattern, s.varExclude) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	if pattern := backupDirExcludePattern(s.backupDir, s.varExclude); pattern != "" {
+		patterns = append(patterns, pattern)
+	}
+	if s.sshKeysPolicy != "" {
+		patterns = append(patterns, coreUserExcludePatterns...)
+	}
+	if s.keepCrio {
+		patterns = append(patterns, keepCrioExcludePatterns...)
+	}
+	return patterns
+}
+
+// ValidateVarExcludePattern checks the pattern is in /var, and can be single quoted for the shell running tar
+func ValidateVarExcludePattern(pattern string) error {
+	if !strings.HasPrefix(pattern, varFolder+"/") {
+		return errors.Errorf("Invalid /var exclude pattern %q, it must start with %s/", pattern, varFolder)
+	}
+	if strings.Contains(pattern, "'") {
+		return errors.Errorf("Invalid /var exclude pattern %q, it can't contain single quotes", pattern)
+	}
+	return nil
+}
+
 func (s *SeedCreator) backupVar() error {
 	// Check if the backup file for /var doesn't exist
 	varTarFile := path.Join(s.backupDir, "var.tgz")
@@ -191,34 +433,65 @@ func (s *SeedCreator) backupVar() error {
 		return err
 	}
 
-	// Define the 'exclude' patterns
-	excludePatterns := []string{
-		"/var/tmp/*",
-		"/var/lib/log/*",
-		"/var/log/*",
-		"/var/lib/containers/*",
-		"/var/lib/kubelet/pods/*",
-		"/var/lib/cni/bin/*",
+	// Count what's archived first, so the progress can be reported as tar lists the files. The
+	// progress is only informative, tar runs without a total if the count fails.
+	root := s.varArchiveRoot()
+	files, err := s.fileCount(append(s.duExcludeArgs(), root)...)
+	if err != nil {
+		s.log.Warnf("Failed to count the %s files, archiving without progress: %v", root, err)
+	} else if size, err := s.diskUsage(append(s.duExcludeArgs(), root)...); err == nil {
+		s.log.Infof("Archiving %d files (%.1f GiB) of %s", files, float64(size)/(1<<30), root)
 	}
 
 	// Build the tar command
-	tarArgs := []string{"czf", varTarFile}
-	for _, pattern := range excludePatterns {
+	tarArgs := []string{"czvf", varTarFile}
+	for _, pattern := range s.varExcludePatterns() {
 		// We're handling the excluded patterns in bash, we need to single quote them to prevent expansion
 		tarArgs = append(tarArgs, "--exclude", fmt.Sprintf("'%s'", pattern))
 	}
-	tarArgs = append(tarArgs, "--selinux", varFolder)
+	tarArgs = append(tarArgs, "--selinux", root)
 
 	// Run the tar command
-	_, err = s.ops.RunBashInHostNamespace("tar", tarArgs...)
+	stream, err := s.ops.RunBashInHostNamespaceStream("tar", tarArgs...)
+	if err == nil {
+		progress := newArchiveProgress(s.log, root, files)
+		err = ops.ScanStream(s.log, stream, func(string) { progress.add() })
+	}
 	if err != nil {
-		return err
+		return errors.Wrapf(err, "Failed to archive %s", root)
 	}
 
-	s.log.Infof("Backup of %s created successfully.", varFolder)
+	s.log.Infof("Backup of %s created successfully.", root)
 	return nil
 }
 
+// varArchiveRoot returns the dir archived in var.tgz, only the kubelet state for worker node seeds
+func (s *SeedCreator) varArchiveRoot() string {
+	if s.nodeRole == NodeRoleWorker {
+		return workerVarDir
+	}
+	return varFolder
+}
+
+// etcDiff returns the /etc changes archived in etc.tgz, only the kubelet ones for worker node seeds
+func (s *SeedCreator) etcDiff() (*ostree.ConfigDiff, error) {
+	diff, err := s.ostreeClient.ConfigDiff()
+	if err != nil || s.nodeRole != NodeRoleWorker {
+		return diff, err
+	}
+	kubeletFiles := func(files []string) []string {
+		kept := []string{}
+		for _, file := range files {
+			if strings.HasPrefix(file, workerEtcDir+"/") {
+				kept = append(kept, file)
+			}
+		}
+		return kept
+	}
+	return &ostree.ConfigDiff{Added: kubeletFiles(diff.Added), Modified: kubeletFiles(diff.Modified),
+		Deleted: kubeletFiles(diff.Deleted)}, nil
+}
+
 func (s *SeedCreator) backupEtc() error {
 	s.log.Println("Backing up /etc")
 	_, err := os.Stat(path.Join(s.backupDir, "etc.tgz"))
@@ -228,18 +501,15 @@ func (s *SeedCreator) backupEtc() error {
 	if !os.IsNotExist(err) {
 		return err
 	}
-	// Execute 'ostree admin config-diff' command and backup etc.deletions
-	args := []string{"admin", "config-diff", "|", "awk", `'$1 == "D" {print "/etc/" $2}'`, ">",
-		path.Join(s.backupDir, "/etc.deletions")}
-	_, err = s.ops.RunBashInHostNamespace("ostree", args...)
+	diff, err := s.etcDiff()
 	if err != nil {
 		return err
 	}
-
-	args = []string{"admin", "config-diff", "|", "awk", `'$1 != "D" {print "/etc/" $2}'`, "|", "xargs", "tar", "czf",
-		path.Join(s.backupDir + "/etc.tgz"), "--selinux"}
-	_, err = s.ops.RunBashInHostNamespace("ostree", args...)
-	if err != nil {
+	// Record the files deleted from /etc, then archive the added and modified ones
+	if err = s.writeEtcDeletions(diff); err != nil {
+		return err
+	}
+	if err = s.archiveFiles("etc.tgz", diff.Changed()); err != nil {
 		return err
 	}
 	s.log.Println("Backup of /etc created successfully.")
@@ -247,6 +517,28 @@ func (s *SeedCreator) backupEtc() error {
 	return nil
 }
 
+// archiveFiles archives the host files as the artifact, listed in a file rather than as arguments so
+// a single tar invocation gets them all
+func (s *SeedCreator) archiveFiles(artifact string, files []string) error {
+	list, err := s.createScratchFile("archive-files-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(list.Name())
+	_, err = list.WriteString(strings.Join(files, "\n") + "\n")
+	if closeErr := list.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Failed to write the %s file list", artifact)
+	}
+
+	s.log.Infof("Archiving %d files as %s", len(files), artifact)
+	_, err = s.ops.RunInHostNamespace("tar", "czf", path.Join(s.backupDir, artifact), "--selinux",
+		"--verbatim-files-from", "-T", list.Name())
+	return errors.Wrapf(err, "Failed to archive %s", artifact)
+}
+
 func (s *SeedCreator) backupOstree() error {
 	// Check if the backup file for ostree doesn't exist
 	s.log.Println("Backing up ostree")
@@ -282,55 +574,83 @@ func (s *SeedCreator) backupMCOConfig() error {
 	if err == nil || !os.IsNotExist(err) {
 		return err
 	}
-	_, err = s.ops.RunBashInHostNamespace(
-		"cp", "/etc/machine-config-daemon/currentconfig", mcoJson)
+	if err = archive.CopyFile(mcoCurrentConfigFile, mcoJson); err != nil {
+		return errors.Wrap(err, "Failed to backup mco-currentconfig")
+	}
 	log.Println("Backup of mco-currentconfig created successfully.")
-	return err
+	return nil
 }
 
 // Building and pushing OCI image
 func (s *SeedCreator) createAndPushSeedImage() error {
-	image := s.containerRegistry + ":" + s.backupTag
+	image := s.seedImage()
 	s.log.Println("Build and push OCI image to", image)
-	s.log.Debug(s.ostreeClient.RpmOstreeVersion()) // If verbose, also dump out current rpm-ostree version available
 
-	// Get the current status of rpm-ostree daemon in the host
-	statusRpmOstree, err := s.ostreeClient.QueryStatus()
+	// A packaged backup dir already holds the .origin of the host it was collected on
+	if !s.fromBackupDir {
+		s.log.Debug(s.ostreeClient.RpmOstreeVersion()) // If verbose, also dump out current rpm-ostree version available
+
+		// Get the current status of rpm-ostree daemon in the host
+		statusRpmOstree, err := s.ostreeClient.QueryStatus()
+		if err != nil {
+			return errors.Wrap(err, "Failed to query ostree status")
+		}
+		if err = s.backupOstreeOrigin(statusRpmOstree); err != nil {
+			return err
+		}
+	}
+
+	artifacts, err := s.seedArtifacts()
 	if err != nil {
-		return errors.Wrap(err, "Failed to query ostree status")
+		return err
 	}
-	if err = s.backupOstreeOrigin(statusRpmOstree); err != nil {
+	digests, err := s.artifactDigests(artifacts)
+	if err != nil {
 		return err
 	}
 
+	// ORAS artifacts are pushed straight from the backup dir, without building an image
+	if s.orasClient != nil {
+		return s.pushSeedArtifact(artifacts, digests)
+	}
+
 	// Create a temporary file for the Dockerfile content
-	tmpfile, err := os.CreateTemp("/var/tmp", "dockerfile-")
+	tmpfile, err := s.createScratchFile("dockerfile-")
 	if err != nil {
-		return errors.Wrap(err, "Error creating temporary file")
+		return err
 	}
 	defer os.Remove(tmpfile.Name()) // Clean up the temporary file
 
 	// Write the content to the temporary file
-	_, err = tmpfile.WriteString(containerFileContent)
+	_, err = tmpfile.WriteString(containerFile(artifacts, digests))
 	if err != nil {
 		return errors.Wrap(err, "Error writing to temporary file")
 	}
 	_ = tmpfile.Close() // Close the temporary file
 
+	// The hidden files of the backup dir aren't sent along the build context
+	if err = os.WriteFile(path.Join(s.backupDir, buildIgnoreFile), []byte(".*\n"), 0600); err != nil {
+		return errors.Wrap(err, "Failed to write build ignore file")
+	}
+
 	// Build the single OCI image (note: We could include --squash-all option, as well)
-	_, err = s.ops.RunInHostNamespace(
-		"podman", []string{"build", "-f", tmpfile.Name(), "-t", image, s.backupDir}...)
-	if err != nil {
+	if err = s.runtime.Build(tmpfile.Name(), image, s.backupDir, s.runLabelArgs()...); err != nil {
 		return errors.Wrap(err, "Failed to build seed image")
 	}
 
-	// Push the created OCI image to user's repository
-	_, err = s.ops.RunInHostNamespace(
-		"podman", []string{"push", "--authfile", s.authFile, image}...)
+	// Push the created OCI image to user's repository, and its mirrors if any, or export it
+	switch {
+	case s.output != nil:
+		err = s.exportSeedImage(image, s.output.Path)
+	case s.skipPush:
+		s.log.Printf("Skipping push, the seed image %s is left in the local storage for the push command", image)
+	default:
+		err = s.pushSeedImage(image)
+	}
 	if err != nil {
-		return errors.Wrap(err, "Failed to push seed image")
+		return err
 	}
-	return nil
+	return s.reportLayerReuse(digests)
 }
 
 func (s *SeedCreator) backupOstreeOrigin(statusRpmOstree *ostree.Status) error {
@@ -348,11 +668,10 @@ func (s *SeedCreator) backupOstreeOrigin(statusRpmOstree *ostree.Status) error {
 	if err == nil || !os.IsNotExist(err) {
 		return err
 	}
-	// Execute 'copy' command and backup .origin file
-	_, err = s.ops.RunInHostNamespace(
-		"cp", []string{"/ostree/deploy/" + bootedOSName + "/deploy/" + bootedDeployment + ".origin", originFileName}...)
-	if err != nil {
-		return err
+	// Backup .origin file
+	origin := path.Join(sysrootDir, "ostree/deploy", bootedOSName, "deploy", bootedDeployment+".origin")
+	if err = archive.CopyFile(origin, originFileName); err != nil {
+		return errors.Wrap(err, "Failed to backup .origin")
 	}
 	log.Println("Backup of .origin created successfully.")
 	return nil
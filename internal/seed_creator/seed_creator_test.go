@@ -1,21 +1,54 @@
 package seed_creator
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"net"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
 
 	"github.com/sirupsen/logrus"
+	containers "ibu-imager/internal/container_runtime"
+	cri "ibu-imager/internal/cri_client"
+	featuregate "ibu-imager/internal/feature_gate"
 	"ibu-imager/internal/ops"
+	oras "ibu-imager/internal/oras_client"
+	ostree "ibu-imager/internal/ostree_client"
+	"ibu-imager/internal/resource_usage"
+	"ibu-imager/internal/version"
+	"ibu-imager/pkg/seedmanifest"
 )
 
+// packageDir is the directory of the package, the suite itself runs from a temporary directory
+var packageDir string
+
 func TestIbuImager(t *testing.T) {
+	// Run the suite from a temporary directory, so a relative path in a test can't leave files in the package
+	workDir, err := os.MkdirTemp("", "seed-creator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workDir)
+	if packageDir, err = os.Getwd(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(workDir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(packageDir) }()
+
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "IbuImager Suite")
 }
@@ -33,21 +66,54 @@ var _ = Describe("Backup /var", func() {
 		ctrl = gomock.NewController(GinkgoT())
 		opsMock = ops.NewMockOps(ctrl)
 		tmpDir, _ = os.MkdirTemp("", "test")
-		seed = NewSeedCreator(l, opsMock, nil, tmpDir, "", "", "", "")
+		seed = NewSeedCreator(l, opsMock, Options{BackupDir: tmpDir})
 	})
 	AfterEach(func() {
 		Expect(os.RemoveAll(tmpDir)).To(Succeed())
 	})
 
+	countFiles := func(output string, err error) {
+		opsMock.EXPECT().RunInHostNamespace("du", append(append([]string{"-s", "--inodes"}, seed.duExcludeArgs()...), "/var")).
+			Return(output, err)
+	}
+	tarStream := func(output string, err error) *ops.Stream {
+		return ops.NewStream(strings.NewReader(output), strings.NewReader(""), func() error { return err })
+	}
+
 	It("Full flow", func() {
-		args := []string{"czf", path.Join(tmpDir, "var.tgz"), "--exclude", "'/var/tmp/*'",
+		countFiles("4\t/var\n", nil)
+		opsMock.EXPECT().RunInHostNamespace("du", append(append([]string{"-sb"}, seed.duExcludeArgs()...), "/var")).Return("4096\t/var\n", nil)
+		args := []string{"czvf", path.Join(tmpDir, "var.tgz"), "--exclude", "'/var/tmp/*'",
 			"--exclude", "'/var/lib/log/*'", "--exclude", "'/var/log/*'", "--exclude", "'/var/lib/containers/*'", "--exclude",
-			"'/var/lib/kubelet/pods/*'", "--exclude", "'/var/lib/cni/bin/*'", "--selinux", "/var"}
-		opsMock.EXPECT().RunBashInHostNamespace("tar", args).Times(1).Return("", nil)
+			"'/var/lib/kubelet/pods/*'", "--exclude", "'/var/lib/cni/bin/*'",
+			"--exclude", "'/var/lib/ibu-imager/history/*'",
+			"--exclude", "'/var/lib/ibu-imager/status.json*'",
+			"--selinux", "/var"}
+		opsMock.EXPECT().RunBashInHostNamespaceStream("tar", args).Times(1).
+			Return(tarStream("/var/\n/var/lib/\n/var/lib/etcd/\n/var/lib/etcd/db\n", nil), nil)
 		err := seed.backupVar()
 		Expect(err).ToNot(HaveOccurred())
 	})
 
+	It("Only archives the kubelet state of worker nodes", func() {
+		seed.nodeRole = NodeRoleWorker
+		seed.ostreeClient = ostree.NewClient("ibu-imager", opsMock)
+		opsMock.EXPECT().RunInHostNamespace("du", append(append([]string{"-s", "--inodes"}, seed.duExcludeArgs()...), "/var/lib/kubelet")).
+			Return("", fmt.Errorf("Dummy"))
+		opsMock.EXPECT().RunBashInHostNamespaceStream("tar", gomock.Any()).DoAndReturn(func(_ string, args ...string) (*ops.Stream, error) {
+			Expect(args[len(args)-2:]).To(Equal([]string{"--selinux", "/var/lib/kubelet"}))
+			return tarStream("/var/lib/kubelet/\n", nil), nil
+		})
+		Expect(seed.backupVar()).To(Succeed())
+
+		opsMock.EXPECT().RunInHostNamespace("ostree", "admin", "config-diff").
+			Return("M    hosts\nA    kubernetes/kubelet-ca.crt\nD    kubernetes/manifests/etcd-pod.yaml\nD    chrony.conf\n", nil)
+		diff, err := seed.etcDiff()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diff).To(Equal(&ostree.ConfigDiff{Added: []string{"/etc/kubernetes/kubelet-ca.crt"}, Modified: []string{},
+			Deleted: []string{"/etc/kubernetes/manifests/etcd-pod.yaml"}}))
+	})
+
 	It("var.tgz was already created, no need to run", func() {
 		newPath := filepath.Join(tmpDir, "var.tgz")
 		f, err := os.Create(newPath)
@@ -57,9 +123,1685 @@ var _ = Describe("Backup /var", func() {
 		Expect(err).ToNot(HaveOccurred())
 	})
 
+	It("Archives without progress when the files can't be counted", func() {
+		countFiles("", fmt.Errorf("Dummy"))
+		opsMock.EXPECT().RunBashInHostNamespaceStream("tar", gomock.Any()).Times(1).Return(tarStream("/var/\n", nil), nil)
+		err := seed.backupVar()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
 	It("Fail to run tar command", func() {
-		opsMock.EXPECT().RunBashInHostNamespace("tar", gomock.Any()).Times(1).Return("", fmt.Errorf("Dummy"))
+		countFiles("", fmt.Errorf("Dummy"))
+		opsMock.EXPECT().RunBashInHostNamespaceStream("tar", gomock.Any()).Times(1).Return(tarStream("", fmt.Errorf("Dummy")), nil)
 		err := seed.backupVar()
 		Expect(err).To(HaveOccurred())
 	})
+
+	It("Excludes the CRI-O live state when CRI-O is kept running", func() {
+		Expect(seed.varExcludePatterns()).NotTo(ContainElement("/var/lib/crio/*"))
+		seed.keepCrio = true
+		Expect(seed.varExcludePatterns()).To(ContainElement("/var/lib/crio/*"))
+		Expect(DefaultVarExcludePatterns).NotTo(ContainElement("/var/lib/crio/*"))
+	})
+
+	It("Excludes the core user's SSH keys only when they're carried by the core user artifact", func() {
+		Expect(seed.varExcludePatterns()).NotTo(ContainElement("/var/home/core/.ssh/*"))
+		seed = NewSeedCreator(l, opsMock, Options{BackupDir: tmpDir, SSHKeysPolicy: SSHKeysPolicyMerge})
+		Expect(seed.varExcludePatterns()).To(ContainElement("/var/home/core/.ssh/*"))
+	})
+
+	It("Excludes the backup dir when it's in /var", func() {
+		defaults := seed.varExcludePatterns()
+		seed.backupDir = "/var/lib/ibu-backup/"
+		Expect(seed.varExcludePatterns()).To(ContainElement("/var/lib/ibu-backup/*"))
+		seed.backupDir = "/var/tmp/backup"
+		Expect(seed.varExcludePatterns()).To(Equal(defaults))
+		seed.backupDir = "/mnt/data/backup"
+		Expect(seed.varExcludePatterns()).To(Equal(defaults))
+	})
+
+	It("Excludes the configured paths and the required ones", func() {
+		seed = NewSeedCreator(logrus.New(), opsMock, Options{BackupDir: "/var/tmp/backup", VarExcludePatterns: []string{"/var/lib/prometheus/*"}})
+		Expect(seed.varExcludePatterns()).To(Equal([]string{"/var/lib/prometheus/*",
+			HistoryDir + "/*", StatusFile + "*", "/var/tmp/ibu-imager-inputs.json", "/var/tmp/ibu-imager-layers.json",
+			"/var/tmp/container_list.done", "/var/tmp/ibu-imager-recert-image.json", "/var/tmp/recert-check/*",
+			"/var/tmp/backup/*"}))
+
+		seed = NewSeedCreator(logrus.New(), opsMock, Options{BackupDir: "/var/tmp/backup", VarExcludePatterns: []string{"/var/tmp/*"}})
+		Expect(seed.varExcludePatterns()).To(Equal([]string{"/var/tmp/*", HistoryDir + "/*", StatusFile + "*"}))
+
+		Expect(ValidateVarExcludePattern("/var/log/ptp/*")).To(Succeed())
+		Expect(ValidateVarExcludePattern("/etc/*")).To(HaveOccurred())
+		Expect(ValidateVarExcludePattern("/var/log/'*")).To(MatchError(ContainSubstring("single quotes")))
+	})
+
+	It("Refuses backup dirs holding or held by the host dirs", func() {
+		Expect(ValidateBackupDir("/var/mnt/backup")).To(Succeed())
+		Expect(ValidateBackupDir("var/tmp/backup")).To(MatchError(ContainSubstring("absolute")))
+		Expect(ValidateBackupDir("/var/")).To(HaveOccurred())
+		Expect(ValidateBackupDir("/etc/backup")).To(MatchError(ContainSubstring("can't be in /etc")))
+		Expect(ValidateBackupDir("/usr")).To(HaveOccurred())
+		Expect(ValidateBackupDir("/var/lib/ibu-backup")).To(Succeed())
+		for _, dir := range []string{"/var/lib", "/var/home", "/root", "/tmp/"} {
+			Expect(ValidateBackupDir(dir)).To(MatchError(ContainSubstring("use a dir of its own")), dir)
+		}
+		Expect(ValidateBackupDir("/var/lib/etcd")).To(MatchError(ContainSubstring("can't be in /var/lib/etcd")))
+		Expect(ValidateBackupDir("/var/lib/etcd/member")).To(HaveOccurred())
+	})
+
+	It("Reports the archive progress", func() {
+		var output strings.Builder
+		l := logrus.New()
+		l.SetOutput(&output)
+		progress := newArchiveProgress(l, "/var", 40)
+		for i := 0; i < 40; i++ {
+			progress.add()
+		}
+		lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+		Expect(lines).To(HaveLen(100 / progressPercentStep))
+		Expect(lines[len(lines)-1]).To(ContainSubstring("Archived 100% of /var (40/40 files)"))
+	})
+})
+
+var _ = Describe("Seed manifest", func() {
+	var (
+		l      = logrus.New()
+		tmpDir string
+	)
+
+	BeforeEach(func() {
+		tmpDir, _ = os.MkdirTemp("", "test")
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("Worker seed uses a distinct manifest kind", func() {
+		seed := NewSeedCreator(l, nil, Options{BackupDir: tmpDir, NodeRole: NodeRoleWorker})
+		Expect(seed.writeManifest()).To(Succeed())
+		data, err := os.ReadFile(filepath.Join(tmpDir, manifestFile))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(ManifestKindWorkerSeed))
+	})
+
+	It("Records the audit log policy", func() {
+		seed := NewSeedCreator(l, nil, Options{BackupDir: tmpDir, AuditLogPolicy: AuditLogPolicyInclude})
+		Expect(seed.writeManifest()).To(Succeed())
+		data, err := os.ReadFile(filepath.Join(tmpDir, manifestFile))
+		Expect(err).ToNot(HaveOccurred())
+		var manifest Manifest
+		Expect(json.Unmarshal(data, &manifest)).To(Succeed())
+		Expect(manifest.AuditLogs).To(Equal(AuditLogPolicyInclude))
+		Expect(manifest.RestoreSteps).To(ContainElement(RestoreStep{Name: "audit-logs", Artifact: auditLogsFile, DependsOn: []string{"var"}}))
+		Expect(ValidateAuditLogPolicy("maybe")).To(HaveOccurred())
+	})
+
+	It("Records the feature gate states", func() {
+		gates, err := featuregate.Parse("workerSeeds=true")
+		Expect(err).ToNot(HaveOccurred())
+		seed := NewSeedCreator(l, nil, Options{BackupDir: tmpDir, FeatureGates: gates})
+		Expect(seed.writeManifest()).To(Succeed())
+		data, err := os.ReadFile(filepath.Join(tmpDir, manifestFile))
+		Expect(err).ToNot(HaveOccurred())
+		var manifest Manifest
+		Expect(json.Unmarshal(data, &manifest)).To(Succeed())
+		Expect(manifest.FeatureGates).To(Equal(map[string]bool{"orasArtifacts": false, "workerSeeds": true}))
+	})
+
+	It("Refuses the experimental subsystems their feature gate doesn't enable", func() {
+		Expect((&Options{NodeRole: NodeRoleWorker}).Validate()).To(MatchError(ContainSubstring("enable the workerSeeds feature gate")))
+		Expect((&Options{ORAS: &oras.Client{}}).Validate()).To(MatchError(ContainSubstring("enable the orasArtifacts feature gate")))
+
+		gates, err := featuregate.Parse("workerSeeds=true,orasArtifacts=true")
+		Expect(err).ToNot(HaveOccurred())
+		Expect((&Options{NodeRole: NodeRoleWorker, FeatureGates: gates}).Validate()).To(Succeed())
+		Expect((&Options{ORAS: &oras.Client{}, FeatureGates: gates}).Validate()).To(Succeed())
+	})
+
+	It("Rejects unknown node roles", func() {
+		Expect(ValidateNodeRole("infra")).To(HaveOccurred())
+		Expect(ValidateNodeRole(NodeRoleWorker)).To(Succeed())
+	})
+
+	It("Defaults the options left empty", func() {
+		Expect((&Options{}).Validate()).To(Succeed())
+		Expect((&Options{NodeRole: "infra"}).Validate()).To(HaveOccurred())
+		Expect((&Options{AuditLogPolicy: "maybe"}).Validate()).To(HaveOccurred())
+
+		seed := NewSeedCreator(l, nil, Options{BackupDir: tmpDir})
+		Expect(seed.nodeRole).To(Equal(NodeRoleMaster))
+		Expect(seed.auditLogPolicy).To(Equal(AuditLogPolicyExclude))
+		Expect(seed.recert.Image).To(Equal(DefaultRecertImage))
+	})
+})
+
+var _ = Describe("Restore steps ordering", func() {
+	It("Orders steps by their dependencies", func() {
+		steps, err := OrderRestoreSteps([]RestoreStep{
+			{Name: "recert", DependsOn: []string{"etc"}},
+			{Name: "etc", DependsOn: []string{"ostree"}},
+			{Name: "ostree"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(steps).To(HaveLen(3))
+		Expect(steps[0].Name).To(Equal("ostree"))
+		Expect(steps[1].Name).To(Equal("etc"))
+		Expect(steps[2].Name).To(Equal("recert"))
+	})
+
+	It("Detects cycles and unknown dependencies", func() {
+		_, err := OrderRestoreSteps([]RestoreStep{{Name: "a", DependsOn: []string{"b"}}, {Name: "b", DependsOn: []string{"a"}}})
+		Expect(err).To(HaveOccurred())
+		_, err = OrderRestoreSteps([]RestoreStep{{Name: "a", DependsOn: []string{"missing"}}})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Default steps are well-formed", func() {
+		_, err := OrderRestoreSteps(defaultRestoreSteps())
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
+
+var _ = Describe("Cluster health", func() {
+	It("Evaluates the health of cluster operators", func() {
+		output := `{"items": [
+			{"metadata": {"name": "etcd"}, "status": {"conditions": [{"type": "Available", "status": "True"}, {"type": "Degraded", "status": "False"}]}},
+			{"metadata": {"name": "ingress"}, "status": {"conditions": [{"type": "Available", "status": "True"}, {"type": "Degraded", "status": "True"}]}}
+		]}`
+		resources, err := ParseResourceHealth("clusteroperators", []byte(output))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resources).To(HaveLen(2))
+		Expect(resources[0].Healthy).To(BeTrue())
+		Expect(resources[1].Healthy).To(BeFalse())
+	})
+})
+
+var _ = Describe("Machine config server", func() {
+	var (
+		tmpDir  string
+		opsMock *ops.MockOps
+		seed    *SeedCreator
+	)
+
+	BeforeEach(func() {
+		tmpDir, _ = os.MkdirTemp("", "test")
+		opsMock = ops.NewMockOps(gomock.NewController(GinkgoT()))
+		seed = NewSeedCreator(logrus.New(), opsMock, Options{BackupDir: tmpDir, Kubeconfig: "kubeconfig",
+			MCS: MCSConfig{IncludeServerCerts: true, IncludeRenderedConfigs: true}})
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("Saves the serving certificate and the rendered configs of the pools", func() {
+		opsMock.EXPECT().RunInHostNamespace("oc", "get", "secret", mcsServerTLSSecret, "-n", mcoNamespace, "-o", "json",
+			"--kubeconfig", "kubeconfig").Return(`{"kind": "Secret"}`, nil)
+		for _, pool := range mcsPools {
+			opsMock.EXPECT().RunInHostNamespace("oc", "get", "machineconfigpool", pool, "-o", "jsonpath={.status.configuration.name}",
+				"--kubeconfig", "kubeconfig").Return("rendered-"+pool+"-1\n", nil)
+			opsMock.EXPECT().RunInHostNamespace("oc", "get", "machineconfig", "rendered-"+pool+"-1", "-o", "json",
+				"--kubeconfig", "kubeconfig").Return(`{"kind": "MachineConfig"}`, nil)
+		}
+		Expect(seed.backupMachineConfigServer()).To(Succeed())
+		Expect(filepath.Join(tmpDir, mcsServerTLSFile)).To(BeAnExistingFile())
+		Expect(filepath.Join(tmpDir, mcsRenderedConfigFile("worker"))).To(BeAnExistingFile())
+	})
+
+	It("Doesn't query the pools whose rendered config was saved already", func() {
+		for _, artifact := range []string{mcsServerTLSFile, mcsRenderedConfigFile("master")} {
+			Expect(os.WriteFile(filepath.Join(tmpDir, artifact), []byte("{}"), 0600)).To(Succeed())
+		}
+		opsMock.EXPECT().RunInHostNamespace("oc", "get", "machineconfigpool", "worker", "-o", "jsonpath={.status.configuration.name}",
+			"--kubeconfig", "kubeconfig").Return("rendered-worker-2", nil)
+		opsMock.EXPECT().RunInHostNamespace("oc", "get", "machineconfig", "rendered-worker-2", "-o", "json",
+			"--kubeconfig", "kubeconfig").Return(`{"kind": "MachineConfig"}`, nil)
+		Expect(seed.backupMachineConfigServer()).To(Succeed())
+	})
+})
+
+var _ = Describe("SSH keys restore policy", func() {
+	It("Merges seed and target keys without duplicates", func() {
+		keys, err := ApplySSHKeysPolicy(SSHKeysPolicyMerge, "ssh-rsa seed\nssh-rsa both\n", "ssh-rsa target\nssh-rsa both\n")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(keys).To(Equal("ssh-rsa target\nssh-rsa both\nssh-rsa seed\n"))
+	})
+
+	It("Rejects unknown policies", func() {
+		_, err := ApplySSHKeysPolicy("drop", "", "")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Installation configuration", func() {
+	var (
+		l       = logrus.New()
+		ctrl    *gomock.Controller
+		opsMock *ops.MockOps
+		seed    *SeedCreator
+		tmpDir  string
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		opsMock = ops.NewMockOps(ctrl)
+		tmpDir, _ = os.MkdirTemp("", "test")
+		seed = NewSeedCreator(l, opsMock, Options{BackupDir: tmpDir})
+		seed.installationConfig = installationConfig{
+			sourceDir:  filepath.Join(packageDir, "..", "..", installationConfigDir),
+			scriptsDir: filepath.Join(tmpDir, "bin"),
+			unitsDir:   filepath.Join(tmpDir, "units"),
+		}
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("Copies the scripts and enables the services", func() {
+		opsMock.EXPECT().SystemctlAction("enable", "installation-configuration.service").Return("", nil)
+		opsMock.EXPECT().SystemctlAction("enable", "prepare-installation-configuration.service").Return("", nil)
+		Expect(seed.copyConfigurationFiles()).To(Succeed())
+		Expect(filepath.Join(tmpDir, "bin", "installation-configuration.sh")).To(BeARegularFile())
+		Expect(filepath.Join(tmpDir, "units", "installation-configuration.service")).To(BeARegularFile())
+	})
+
+	It("Fails when a service can't be enabled", func() {
+		opsMock.EXPECT().SystemctlAction("enable", gomock.Any()).Return("", fmt.Errorf("Dummy"))
+		Expect(seed.copyConfigurationFiles()).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Recert etcd data", func() {
+	var (
+		l       = logrus.New()
+		ctrl    *gomock.Controller
+		opsMock *ops.MockOps
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		opsMock = ops.NewMockOps(ctrl)
+	})
+
+	It("Serves the live data by default", func() {
+		seed := NewSeedCreator(l, opsMock, Options{})
+		dataDir, _, err := seed.prepareEtcdData()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dataDir).To(Equal(etcdDataDir))
+	})
+
+	It("Serves a copy of the data when configured to", func() {
+		seed := NewSeedCreator(l, opsMock, Options{BackupDir: "/mnt/backup", Recert: RecertConfig{CopyEtcd: true}})
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("rm", "-rf", "/mnt/backup/.scratch/recert-etcd").Return("", nil),
+			opsMock.EXPECT().RunBashInHostNamespace("mkdir", "-p", "/mnt/backup/.scratch", "&&",
+				"cp", "-a", "--reflink=auto", etcdDataDir, "/mnt/backup/.scratch/recert-etcd").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("rm", "-rf", "/mnt/backup/.scratch/recert-etcd").Return("", nil),
+		)
+		dataDir, cleanup, err := seed.prepareEtcdData()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dataDir).To(Equal("/mnt/backup/.scratch/recert-etcd"))
+		cleanup()
+	})
+
+	It("Removes the recert etcd container when the run is cancelled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		seed := NewSeedCreator(l, opsMock, Options{Context: ctx, AuthFile: "/auth.json"})
+		seed.runID = "r1"
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("podman", gomock.Any()).Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("podman", "rm", "--force", "recert_etcd-r1").Return("", nil),
+		)
+		err := seed.recertDryRun("quay.io/openshift/etcd", DefaultRecertImage, etcdDataDir, "/var/tmp/backup")
+		Expect(err).To(MatchError(ContainSubstring("Recert dry-run cancelled")))
+		Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+	})
+
+	It("Limits the resources of the etcd and recert containers", func() {
+		for _, test := range []struct {
+			config RecertConfig
+			args   []string
+		}{
+			{config: RecertConfig{}},
+			{config: RecertConfig{CPUs: "2"}, args: []string{"--cpus", "2"}},
+			{config: RecertConfig{Memory: "4g"}, args: []string{"--memory", "4g"}},
+			{config: RecertConfig{CPUs: "0.5", Memory: "512m", CgroupParent: "ibu.slice"},
+				args: []string{"--cpus", "0.5", "--memory", "512m", "--cgroup-parent", "ibu.slice"}},
+		} {
+			Expect(test.config.resourceArgs()).To(Equal(test.args))
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		seed := NewSeedCreator(l, opsMock, Options{Context: ctx, Recert: RecertConfig{CPUs: "2", Memory: "4g"}})
+		seed.runID = "r1"
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("podman", gomock.Any()).DoAndReturn(func(_ string, args ...string) (string, error) {
+				Expect(strings.Join(args, " ")).To(ContainSubstring(
+					"--label " + RunIDLabel + "=r1 --cpus 2 --memory 4g --entrypoint etcd"))
+				return "", nil
+			}),
+			opsMock.EXPECT().RunInHostNamespace("podman", "rm", "--force", "recert_etcd-r1").Return("", nil),
+		)
+		Expect(seed.recertDryRun("quay.io/openshift/etcd", DefaultRecertImage, etcdDataDir, "/var/tmp/backup")).
+			To(MatchError(ContainSubstring("Recert dry-run cancelled")))
+	})
+})
+
+var _ = Describe("Recert check", func() {
+	var (
+		ctrl    *gomock.Controller
+		opsMock *ops.MockOps
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		opsMock = ops.NewMockOps(ctrl)
+	})
+
+	It("Serves a restored snapshot of the running etcd", func() {
+		seed := &SeedCreator{log: logrus.New(), ops: opsMock, runtime: containers.NewPodman(opsMock), kubeconfig: "/kubeconfig",
+			authFile: "/auth.json", runID: "r1"}
+		dataDir := path.Join(recertCheckDir, "data")
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("oc", "get", "pods", "-n", etcdNamespace, "-l", "app=etcd",
+				"-o", "jsonpath={.items[0].metadata.name}", "--kubeconfig", "/kubeconfig").Return("etcd-sno", nil),
+			opsMock.EXPECT().RunInHostNamespace("oc", "exec", "-n", etcdNamespace, "etcd-sno", "-c", "etcdctl",
+				"--kubeconfig", "/kubeconfig", "--", "etcdctl", "snapshot", "save", etcdSnapshotFile, "-w", "json").Return("", nil),
+			opsMock.EXPECT().RunBashInHostNamespace("mkdir", "-p", recertCheckDir, "&&", "mv", etcdSnapshotFile,
+				path.Join(recertCheckDir, "snapshot.db")).Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("podman", "run", "--authfile", "/auth.json", "--name", "recert_etcd_restore-r1",
+				"--rm", "--network=none", "--label", CreatedByLabel+"="+CreatedBy, "--label", RunIDLabel+"=r1",
+				"--entrypoint", "etcdctl", "-v", recertCheckDir+":"+recertCheckDir, "quay.io/openshift/etcd",
+				"snapshot", "restore", path.Join(recertCheckDir, "snapshot.db"), "--data-dir", dataDir).Return("", nil),
+		)
+		Expect(seed.restoreEtcdSnapshot("quay.io/openshift/etcd", dataDir)).To(Succeed())
+	})
+
+	It("Fails when the snapshot can't be saved", func() {
+		seed := &SeedCreator{log: logrus.New(), ops: opsMock, runtime: containers.NewPodman(opsMock)}
+		opsMock.EXPECT().RunInHostNamespace("oc", gomock.Any()).Return("etcd-sno", nil)
+		opsMock.EXPECT().RunInHostNamespace("oc", gomock.Any()).Return("", fmt.Errorf("deadline exceeded"))
+		Expect(seed.restoreEtcdSnapshot("quay.io/openshift/etcd", "/data")).To(MatchError(ContainSubstring("snapshot save")))
+	})
+})
+
+var _ = Describe("Additional image store", func() {
+	It("Reads the image references of the container list", func() {
+		Expect(imageStoreReferences("quay.io/a@sha256:1\n\n  quay.io/b:latest \n")).
+			To(Equal([]string{"quay.io/a@sha256:1", "quay.io/b:latest"}))
+	})
+
+	It("Is tagged after the seed image", func() {
+		seed := NewSeedCreator(logrus.New(), nil, Options{Registry: "quay.io/org/seed", Tag: "oneimage", ImageStore: true})
+		Expect(seed.imageStoreImage()).To(Equal("quay.io/org/seed:oneimage-image-store"))
+	})
+})
+
+var _ = Describe("Layer cache", func() {
+	var (
+		tmpDir    string
+		cacheFile string
+		warnings  []string
+	)
+	warnf := func(format string, args ...interface{}) { warnings = append(warnings, fmt.Sprintf(format, args...)) }
+
+	BeforeEach(func() {
+		tmpDir, _ = os.MkdirTemp("", "test")
+		cacheFile = filepath.Join(tmpDir, "layers.json")
+		warnings = nil
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("Rebuilds every layer without a previous build", func() {
+		reused, rebuilt, err := updateLayerCache(cacheFile, layerCache{"var.tgz": "sha256:1", "etc.tgz": "sha256:2"}, warnf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reused).To(BeEmpty())
+		Expect(rebuilt).To(Equal([]string{"etc.tgz", "var.tgz"}))
+
+		data, err := os.ReadFile(cacheFile)
+		Expect(err).ToNot(HaveOccurred())
+		var cache layerCache
+		Expect(json.Unmarshal(data, &cache)).To(Succeed())
+		Expect(cache).To(Equal(layerCache{"var.tgz": "sha256:1", "etc.tgz": "sha256:2"}))
+	})
+
+	It("Reuses the layers of the unchanged artifacts and rebuilds the changed ones", func() {
+		_, _, err := updateLayerCache(cacheFile, layerCache{"var.tgz": "sha256:1", "etc.tgz": "sha256:2"}, warnf)
+		Expect(err).ToNot(HaveOccurred())
+		reused, rebuilt, err := updateLayerCache(cacheFile,
+			layerCache{"var.tgz": "sha256:1", "etc.tgz": "sha256:3", "ostree.tgz": "sha256:4"}, warnf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reused).To(Equal([]string{"var.tgz"}))
+		Expect(rebuilt).To(Equal([]string{"etc.tgz", "ostree.tgz"}))
+
+		// The changed digest replaced the cached one
+		reused, rebuilt, err = updateLayerCache(cacheFile, layerCache{"etc.tgz": "sha256:2"}, warnf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reused).To(BeEmpty())
+		Expect(rebuilt).To(Equal([]string{"etc.tgz"}))
+		Expect(warnings).To(BeEmpty())
+	})
+
+	It("Rebuilds every layer of a corrupted cache", func() {
+		Expect(os.WriteFile(cacheFile, []byte("{"), 0600)).To(Succeed())
+		reused, rebuilt, err := updateLayerCache(cacheFile, layerCache{"var.tgz": "sha256:1"}, warnf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reused).To(BeEmpty())
+		Expect(rebuilt).To(Equal([]string{"var.tgz"}))
+		Expect(warnings).To(ConsistOf(ContainSubstring("Ignoring corrupted layer cache")))
+
+		reused, _, err = updateLayerCache(cacheFile, layerCache{"var.tgz": "sha256:1"}, warnf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reused).To(Equal([]string{"var.tgz"}))
+	})
+})
+
+var _ = Describe("Catalog source images", func() {
+	It("Extracts the sorted, unique and allowed catalog images", func() {
+		output := `{"items": [
+			{"spec": {"image": "registry.redhat.io/redhat/redhat-operator-index:v4.14"}},
+			{"spec": {"address": "catalog.example.com:50051"}},
+			{"spec": {"image": "quay.io/org/catalog:latest"}},
+			{"spec": {"image": "registry.redhat.io/redhat/redhat-operator-index:v4.14"}},
+			{"spec": {"image": "docker.io/org/catalog:latest"}}
+		]}`
+		images, err := catalogSourceImages([]byte(output), cri.ImageFilter{ExcludeRegistries: []string{"docker.io"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(images).To(Equal([]string{"quay.io/org/catalog:latest", "registry.redhat.io/redhat/redhat-operator-index:v4.14"}))
+	})
+
+	It("Fails on invalid output", func() {
+		_, err := catalogSourceImages([]byte("not json"), cri.ImageFilter{})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Run history", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		tmpDir, _ = os.MkdirTemp("", "test")
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("Saves and loads the reports chronologically", func() {
+		start := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+		for i := 0; i < historyLimit+2; i++ {
+			Expect(SaveReport(tmpDir, &RunReport{StartedAt: start.Add(time.Duration(i) * time.Hour), Result: ResultSucceeded})).To(Succeed())
+		}
+		reports, err := LoadHistory(tmpDir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reports).To(HaveLen(historyLimit))
+		Expect(reports[0].StartedAt).To(Equal(start.Add(2 * time.Hour)))
+	})
+
+	It("Reports running runs whose process is gone as interrupted", func() {
+		file := path.Join(tmpDir, "status.json")
+		Expect(LoadStatus(file)).To(BeNil())
+
+		Expect(SaveStatus(file, &RunReport{Result: ResultRunning, PID: os.Getpid(), CurrentStep: "backup-var"})).To(Succeed())
+		report, err := LoadStatus(file)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Result).To(Equal(ResultRunning))
+		Expect(report.CurrentStep).To(Equal("backup-var"))
+
+		Expect(SaveStatus(file, &RunReport{Result: ResultRunning})).To(Succeed())
+		Expect(LoadStatus(file)).To(HaveField("Result", ResultInterrupted))
+	})
+
+	It("Diffs step durations and artifact sizes", func() {
+		previous := &RunReport{
+			Steps:     []StepReport{{Name: "backup-var", Duration: time.Minute}, {Name: "lint", Duration: time.Second}},
+			Artifacts: map[string]int64{"var.tgz": 100},
+		}
+		current := &RunReport{
+			Steps:     []StepReport{{Name: "backup-var", Duration: 2 * time.Minute}},
+			Artifacts: map[string]int64{"var.tgz": 150, "etc.tgz": 10},
+		}
+		steps, artifacts := DiffReports(previous, current)
+		Expect(steps).To(Equal([]ReportDelta{
+			{Name: "backup-var", Previous: int64(time.Minute), Current: int64(2 * time.Minute)},
+			{Name: "lint", Previous: int64(time.Second), Current: -1},
+		}))
+		Expect(artifacts).To(Equal([]ReportDelta{{Name: "etc.tgz", Previous: -1, Current: 10}, {Name: "var.tgz", Previous: 100, Current: 150}}))
+		Expect(artifacts[1].Change()).To(Equal(int64(50)))
+	})
+
+	It("Diffs step resource usage", func() {
+		previous := &RunReport{Steps: []StepReport{
+			{Name: "backup-var", Usage: &resource_usage.Usage{CPUTime: time.Second, ReadBytes: 10, WrittenBytes: 5}},
+			{Name: "lint"},
+		}}
+		current := &RunReport{Steps: []StepReport{
+			{Name: "backup-var", Usage: &resource_usage.Usage{CPUTime: 3 * time.Second, PeakMemory: 1024, ReadBytes: 20, WrittenBytes: 5}},
+			{Name: "lint", Usage: &resource_usage.Usage{}},
+		}}
+		cpu, memory, io := DiffStepUsage(previous, current)
+		Expect(cpu).To(Equal([]ReportDelta{
+			{Name: "backup-var", Previous: int64(time.Second), Current: int64(3 * time.Second)},
+			{Name: "lint", Previous: -1, Current: 0},
+		}))
+		Expect(memory).To(Equal([]ReportDelta{{Name: "backup-var", Previous: -1, Current: 1024}}))
+		Expect(io).To(Equal([]ReportDelta{{Name: "backup-var", Previous: 15, Current: 25}, {Name: "lint", Previous: -1, Current: 0}}))
+	})
+})
+
+var _ = Describe("Recert etcd ports", func() {
+	It("Picks free ports and detects the taken ones", func() {
+		port, err := freeLocalPort()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(portInUse(port)).To(BeFalse())
+
+		listener, err := net.Listen("tcp", net.JoinHostPort(etcdHost, fmt.Sprint(port)))
+		Expect(err).ToNot(HaveOccurred())
+		defer listener.Close()
+		Expect(portInUse(port)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Delete local images", func() {
+	var (
+		ctrl    *gomock.Controller
+		opsMock *ops.MockOps
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		opsMock = ops.NewMockOps(ctrl)
+	})
+
+	It("Deletes the imager images only", func() {
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("podman", "images", "--all", "--noheading",
+				"--filter", "label="+CreatedByLabel+"=ibu-imager", "--format", "{{.ID}} {{.Repository}}:{{.Tag}}").
+				Return("abc quay.io/org/seed:oneimage\nabc localhost/seed:latest\ndef <none>:<none>\n", nil),
+			opsMock.EXPECT().RunInHostNamespace("podman", "rmi", "--force", "abc", "def").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("rm", "-rf", "/var/tmp/backup/.scratch/image-store",
+				"/var/tmp/backup/.scratch/image-store-build", layerCacheFile).Return("", nil),
+		)
+		Expect(DeleteLocal(logrus.New(), opsMock, containers.NewPodman(opsMock), DefaultBackupDir, false)).To(Succeed())
+	})
+
+	It("Only lists the images on dry run", func() {
+		opsMock.EXPECT().RunInHostNamespace("podman", gomock.Any()).Return("abc quay.io/org/seed:oneimage\n", nil)
+		Expect(DeleteLocal(logrus.New(), opsMock, containers.NewPodman(opsMock), DefaultBackupDir, true)).To(Succeed())
+	})
+
+	It("Deletes the images of a remote node over SSH", func() {
+		executorMock := ops.NewMockExecute(ctrl)
+		op := ops.NewSSHOps(logrus.New(), executorMock, ops.SSHConfig{Host: "sno.example.com", User: "core"})
+		gomock.InOrder(
+			executorMock.EXPECT().Execute("ssh", "-o", "BatchMode=yes", "core@sno.example.com", "--",
+				`sudo -n 'podman' 'images' '--all' '--noheading' '--filter' 'label=`+CreatedByLabel+`=ibu-imager' '--format' '{{.ID}} {{.Repository}}:{{.Tag}}'`).
+				Return("abc quay.io/org/seed:oneimage\n", nil),
+			executorMock.EXPECT().Execute("ssh", "-o", "BatchMode=yes", "core@sno.example.com", "--",
+				`sudo -n 'podman' 'rmi' '--force' 'abc'`).Return("", nil),
+			executorMock.EXPECT().Execute("ssh", "-o", "BatchMode=yes", "core@sno.example.com", "--",
+				`sudo -n 'rm' '-rf' '/var/tmp/backup/.scratch/image-store' '/var/tmp/backup/.scratch/image-store-build' '`+layerCacheFile+`'`).Return("", nil),
+		)
+		Expect(DeleteLocal(logrus.New(), op, containers.NewPodman(op), DefaultBackupDir, false)).To(Succeed())
+	})
+})
+
+var _ = Describe("Step journal", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		tmpDir, _ = os.MkdirTemp("", "test")
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	newSeedCreator := func(tag string, resume bool) *SeedCreator {
+		return NewSeedCreator(logrus.New(), nil, Options{BackupDir: tmpDir, Registry: "quay.io/org/seed", Tag: tag, Resume: resume})
+	}
+
+	It("Resumes the steps completed by the interrupted run", func() {
+		journal, err := newSeedCreator("oneimage", false).openJournal()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(journal.complete("create-container-list")).To(Succeed())
+
+		resumed, err := newSeedCreator("oneimage", true).openJournal()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resumed.completed("create-container-list")).To(BeTrue())
+		Expect(resumed.completed("backup-var")).To(BeFalse())
+
+		Expect(os.MkdirAll(scratchPath(tmpDir, "recert-etcd"), 0700)).To(Succeed())
+		artifacts, err := newSeedCreator("oneimage", true).seedArtifacts()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(artifacts).ToNot(ContainElement(journalFile))
+		Expect(artifacts).ToNot(ContainElement(scratchDir))
+
+		restarted, err := newSeedCreator("oneimage", false).openJournal()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(restarted.completed("create-container-list")).To(BeFalse())
+	})
+
+	It("Refuses resuming the run of another seed", func() {
+		journal, err := newSeedCreator("oneimage", false).openJournal()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(journal.complete("create-container-list")).To(Succeed())
+
+		_, err = newSeedCreator("otherimage", true).openJournal()
+		Expect(err).To(MatchError(ContainSubstring("Can't resume")))
+	})
+})
+
+var _ = Describe("Recert image resolution", func() {
+	It("Keeps the recert image no mirroring rule matches", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		opsMock := ops.NewMockOps(ctrl)
+		seed := NewSeedCreator(logrus.New(), opsMock, Options{Kubeconfig: "/kubeconfig",
+			Recert: RecertConfig{Image: "quay.io/edge-infrastructure/recert:latest"}})
+		opsMock.EXPECT().RunInHostNamespace("oc", "get", "imagecontentsourcepolicy", "-o", "json", "--kubeconfig", "/kubeconfig").
+			Return(`{"items": [{"spec": {"repositoryDigestMirrors": [{"source": "registry.redhat.io", "mirrors": ["mirror.lab/redhat"]}]}}]}`, nil)
+		opsMock.EXPECT().RunInHostNamespace("oc", "get", "imagedigestmirrorset", "-o", "json", "--kubeconfig", "/kubeconfig").
+			Return(`{"items": []}`, nil)
+		opsMock.EXPECT().RunInHostNamespace("oc", "get", "imagetagmirrorset", "-o", "json", "--kubeconfig", "/kubeconfig").
+			Return("", fmt.Errorf("the server doesn't have a resource type"))
+
+		Expect(seed.resolveRecertImage()).To(Succeed())
+		Expect(seed.recertImage()).To(Equal("quay.io/edge-infrastructure/recert:latest"))
+	})
+})
+
+var _ = Describe("Cleanup", func() {
+	It("Removes the run leftovers and restarts the services", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		opsMock := ops.NewMockOps(ctrl)
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("podman", "ps", "--all", "--noheading", "--filter", "label="+CreatedByLabel+"=ibu-imager",
+				"--format", `[{{json .ID}},{{json .Names}},{{json (index .Labels "`+RunIDLabel+`")}}]`).
+				Return(`["c1","recert_etcd-1a2b3c4d","1a2b3c4d"]`+"\n", nil),
+			opsMock.EXPECT().RunInHostNamespace("podman", "rm", "--force", "c1").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("rm", "-rf", "/var/tmp/backup", containerListDoneFile, inputsFile, recertImageFile).Return("", nil),
+			opsMock.EXPECT().SystemctlAction("enable", "--now", "crio.service").Return("", nil),
+			opsMock.EXPECT().SystemctlAction("enable", "--now", "kubelet.service").Return("", nil),
+		)
+		Expect(Cleanup(logrus.New(), opsMock, containers.NewPodman(opsMock), "/var/tmp/backup", false)).To(Succeed())
+	})
+
+	It("Leaves the backup dirs the imager didn't create in place", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		opsMock := ops.NewMockOps(ctrl)
+		backupDir, _ := os.MkdirTemp("", "test")
+		defer os.RemoveAll(backupDir)
+		Expect(os.WriteFile(filepath.Join(backupDir, "notes.txt"), []byte("notes"), 0600)).To(Succeed())
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("podman", "ps", "--all", "--noheading", "--filter", gomock.Any(), gomock.Any(), gomock.Any()).Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("rm", "-rf", containerListDoneFile, inputsFile, recertImageFile).Return("", nil),
+			opsMock.EXPECT().SystemctlAction("enable", "--now", "crio.service").Return("", nil),
+			opsMock.EXPECT().SystemctlAction("enable", "--now", "kubelet.service").Return("", nil),
+		)
+		Expect(Cleanup(logrus.New(), opsMock, containers.NewPodman(opsMock), backupDir, false)).To(Succeed())
+		Expect(prepareBackupDir(backupDir)).To(MatchError(ContainSubstring("wasn't created by the imager")))
+	})
+
+	It("Marks the backup dirs it creates as the imager's", func() {
+		tmpDir, _ := os.MkdirTemp("", "test")
+		defer os.RemoveAll(tmpDir)
+		backupDir := filepath.Join(tmpDir, "backup")
+		Expect(prepareBackupDir(backupDir)).To(Succeed())
+		Expect(ownedBackupDir(backupDir)).To(BeTrue())
+		Expect(os.WriteFile(filepath.Join(backupDir, "var.tgz"), nil, 0600)).To(Succeed())
+		Expect(prepareBackupDir(backupDir)).To(Succeed())
+
+		empty := filepath.Join(tmpDir, "empty")
+		Expect(os.Mkdir(empty, 0700)).To(Succeed())
+		Expect(prepareBackupDir(empty)).To(Succeed())
+		Expect(ownedBackupDir(empty)).To(BeTrue())
+	})
+})
+
+var _ = Describe("GC", func() {
+	It("Deletes the labeled containers, then the images", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		opsMock := ops.NewMockOps(ctrl)
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("podman", "ps", "--all", "--noheading", "--filter", "label="+CreatedByLabel+"=ibu-imager",
+				gomock.Any(), gomock.Any()).Return(`["c1","recert_etcd-1a2b3c4d","1a2b3c4d"]`+"\n"+`["c2","recert-5e6f7a8b","5e6f7a8b"]`+"\n", nil),
+			opsMock.EXPECT().RunInHostNamespace("podman", "rm", "--force", "c1", "c2").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("podman", "images", "--all", "--noheading", "--filter", "label="+CreatedByLabel+"=ibu-imager",
+				gomock.Any(), gomock.Any()).Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("rm", "-rf", imageStoreDir(DefaultBackupDir), imageStoreBuildDir(DefaultBackupDir), layerCacheFile).Return("", nil),
+		)
+		Expect(GC(logrus.New(), opsMock, containers.NewPodman(opsMock), DefaultBackupDir, false)).To(Succeed())
+	})
+
+	It("Names the run containers after the run id", func() {
+		seed := &SeedCreator{runID: "1a2b3c4d"}
+		Expect(seed.containerName(etcdContainerName)).To(Equal("recert_etcd-1a2b3c4d"))
+		Expect(seed.runLabelArgs()).To(Equal([]string{"--label", CreatedByLabel + "=ibu-imager", "--label", RunIDLabel + "=1a2b3c4d"}))
+	})
+})
+
+var _ = Describe("Cluster version summary", func() {
+	It("Extracts the completed version, channel and available updates", func() {
+		summary, err := ParseClusterVersion([]byte(`{
+			"spec": {"channel": "stable-4.14"},
+			"status": {
+				"history": [
+					{"version": "4.14.2", "image": "quay.io/release:4.14.2", "state": "Partial", "startedTime": "2023-11-02T00:00:00Z"},
+					{"version": "4.14.1", "image": "quay.io/release:4.14.1", "state": "Completed", "startedTime": "2023-11-01T00:00:00Z",
+					 "completionTime": "2023-11-01T01:00:00Z"}
+				],
+				"availableUpdates": [{"version": "4.14.3"}, {"version": "4.14.4"}]
+			}
+		}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary.Version).To(Equal("4.14.1"))
+		Expect(summary.Image).To(Equal("quay.io/release:4.14.1"))
+		Expect(summary.Channel).To(Equal("stable-4.14"))
+		Expect(summary.History).To(HaveLen(2))
+		Expect(summary.AvailableUpdates).To(Equal([]string{"4.14.3", "4.14.4"}))
+	})
+
+	It("Fails without a completed version", func() {
+		_, err := ParseClusterVersion([]byte(`{"status": {"history": [{"version": "4.14.0", "state": "Partial"}]}}`))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Step selection", func() {
+	It("Selects the steps by step or artifact name", func() {
+		selection, err := NewStepSelection([]string{"backup-etc", "var.tgz"}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(selection.Selects("backup-etc")).To(BeTrue())
+		Expect(selection.Selects("backup-var")).To(BeTrue())
+		Expect(selection.Selects("build-and-push")).To(BeFalse())
+		Expect(selection.String()).To(Equal("only backup-etc, backup-var"))
+
+		selection, err = NewStepSelection(nil, []string{"build-and-push"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(selection.Selects("backup-etc")).To(BeTrue())
+		Expect(selection.Selects("build-and-push")).To(BeFalse())
+
+		var all *StepSelection
+		Expect(all.Selects("build-and-push")).To(BeTrue())
+	})
+
+	It("Refuses unknown steps and mixed selections", func() {
+		_, err := NewStepSelection([]string{"backup-home"}, nil)
+		Expect(err).To(MatchError(ContainSubstring("Unknown step")))
+		_, err = NewStepSelection([]string{"backup-etc"}, []string{"backup-var"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Looks the steps up by name or by the artifacts they produce", func() {
+		for nameOrArtifact, name := range map[string]string{
+			"backup-var":             "backup-var",
+			"var.tgz":                "backup-var",
+			"mco-currentconfig.json": "backup-mco-config",
+			manifestFile:             "write-manifest",
+			RecertSummaryFile:        "recert-dry-run",
+		} {
+			step, err := LookupStep(nameOrArtifact)
+			Expect(err).ToNot(HaveOccurred(), nameOrArtifact)
+			Expect(step.Name).To(Equal(name), nameOrArtifact)
+		}
+	})
+
+	It("Refuses looking up unknown steps and artifacts", func() {
+		_, found := FindStep("home.tgz")
+		Expect(found).To(BeFalse())
+		_, err := LookupStep("home.tgz")
+		Expect(err).To(MatchError(`Unknown step or artifact "home.tgz", run 'ibu-imager explain' to list them`))
+	})
+
+	It("Describes the stages from the steps", func() {
+		schema := Stages()
+		Expect(schema.Stages).To(HaveLen(len(Steps())))
+		for _, stage := range schema.Stages {
+			if stage.Name == "backup-etc" {
+				Expect(stage.NodeRoles).To(ConsistOf(NodeRoleMaster, NodeRoleWorker))
+				Expect(stage.Outputs.Artifacts).To(ContainElement("etc.tgz"))
+				Expect(stage.Fingerprinted).To(BeTrue())
+			}
+			if stage.Name == "etcd-sanity" {
+				Expect(stage.NodeRoles).To(Equal([]string{NodeRoleMaster}))
+				Expect(stage.Outputs.Artifacts).ToNot(BeNil())
+			}
+		}
+		Expect(schema.Stages[0].Order).To(Equal(1))
+	})
+})
+
+var _ = Describe("Build from backup dir", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		tmpDir, _ = os.MkdirTemp("", "test")
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	newBuilder := func(sshKeysPolicy string) *SeedCreator {
+		return NewSeedCreator(logrus.New(), nil, Options{BackupDir: tmpDir, Registry: "quay.io/org/seed", Tag: "oneimage",
+			SSHKeysPolicy: sshKeysPolicy, Runtime: containers.NewFake(logrus.New())})
+	}
+
+	It("Accepts backup dirs holding every restore step artifact", func() {
+		for _, step := range defaultRestoreSteps() {
+			if step.Artifact != "" {
+				Expect(os.WriteFile(filepath.Join(tmpDir, step.Artifact), nil, 0600)).To(Succeed())
+			}
+		}
+		Expect(os.WriteFile(filepath.Join(tmpDir, "ostree-abc.origin"), nil, 0600)).To(Succeed())
+		Expect(newBuilder("").checkBackupDir()).To(Succeed())
+
+		err := newBuilder(SSHKeysPolicyMerge).checkBackupDir()
+		Expect(err).To(MatchError(ContainSubstring("missing " + coreUserFile)))
+	})
+
+	It("Refuses partially collected backup dirs", func() {
+		Expect(os.WriteFile(filepath.Join(tmpDir, "etc.tgz"), nil, 0600)).To(Succeed())
+		err := newBuilder("").checkBackupDir()
+		Expect(err).To(MatchError(ContainSubstring("var.tgz")))
+		Expect(err).To(MatchError(ContainSubstring("ostree-<deployment>.origin")))
+		Expect(err).ToNot(MatchError(ContainSubstring("etc.tgz")))
+	})
+})
+
+var _ = Describe("Disk guard", func() {
+	const gib = 1 << 30
+
+	// space returns a filesystem of 100 GiB with the free space of the pointer
+	space := func(free *uint64) func(string) (uint64, uint64, error) {
+		return func(string) (uint64, uint64, error) { return *free, 100 * gib, nil }
+	}
+	noWarnings := func(format string, args ...interface{}) { Fail(fmt.Sprintf(format, args...)) }
+
+	It("Terminates the host commands below the free space kept", func() {
+		free, terminated := uint64(40*gib), 0
+		watch, err := newDiskWatch(&DiskGuard{MinFreePercent: 5}, "/var/tmp/backup", space(&free), func() int { terminated++; return 1 })
+		Expect(err).ToNot(HaveOccurred())
+
+		free = 20 * gib
+		Expect(watch.check(noWarnings)).To(Succeed())
+		var warnings []string
+		free = 8 * gib
+		Expect(watch.check(func(format string, args ...interface{}) { warnings = append(warnings, fmt.Sprintf(format, args...)) })).To(Succeed())
+		Expect(warnings).To(Equal([]string{"Free space of /var/tmp/backup is down to 8.0 GiB, the run is aborted below 5.0 GiB"}))
+		free = 4 * gib
+		Expect(watch.check(noWarnings)).To(MatchError("Free space of /var/tmp/backup fell to 4.0 GiB, below the 5% kept free"))
+		Expect(terminated).To(Equal(1))
+		Expect(watch.interrupt("backup-var")).To(HaveOccurred())
+		Expect(watch.written()).To(Equal(uint64(36 * gib)))
+	})
+
+	It("Caps the growth of the filesystem usage", func() {
+		free := uint64(40 * gib)
+		watch, err := newDiskWatch(&DiskGuard{MaxWrittenBytes: 10 * gib}, "/var/tmp/backup", space(&free), func() int { return 0 })
+		Expect(err).ToNot(HaveOccurred())
+		free = 29 * gib
+		Expect(watch.check(noWarnings)).To(MatchError(ContainSubstring("wrote 11.0 GiB")))
+	})
+
+	It("Rolls back the interrupted step", func() {
+		tmpDir, _ := os.MkdirTemp("", "test")
+		defer os.RemoveAll(tmpDir)
+		opsMock := ops.NewMockOps(gomock.NewController(GinkgoT()))
+		seed := &SeedCreator{log: logrus.New(), ctx: context.Background(), ops: opsMock, runtime: containers.NewFake(logrus.New()), backupDir: tmpDir}
+		free := uint64(40 * gib)
+		watch, err := newDiskWatch(&DiskGuard{MinFreePercent: 5}, tmpDir, space(&free), func() int { return 1 })
+		Expect(err).ToNot(HaveOccurred())
+		go watch.run(time.Hour, noWarnings)
+		seed.diskWatch = watch
+
+		step, _ := FindStep("backup-var")
+		step.run = func(*SeedCreator) error {
+			free = 1 * gib
+			Expect(watch.check(noWarnings)).To(HaveOccurred())
+			return errors.New("signal: terminated")
+		}
+		Expect(seed.runStep(step)).To(MatchError(ContainSubstring("below the 5% kept free")))
+		Expect(seed.runStep(step)).To(MatchError(ContainSubstring("below the 5% kept free")))
+
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("rm", "-rf", filepath.Join(tmpDir, "var.tgz")).Return("", nil),
+			opsMock.EXPECT().SystemctlAction("enable", "--now", "crio.service").Return("", nil),
+			opsMock.EXPECT().SystemctlAction("enable", "--now", "kubelet.service").Return("", nil),
+		)
+		err = seed.stopDiskWatch(errors.New("signal: terminated"))
+		Expect(err).To(MatchError(HavePrefix("Seed creation aborted and rolled back: Free space of " + tmpDir)))
+		Expect(seed.report.WrittenBytes).To(Equal(int64(39 * gib)))
+	})
+})
+
+var _ = Describe("Strict mode", func() {
+	var (
+		l       = logrus.New()
+		ctrl    *gomock.Controller
+		opsMock *ops.MockOps
+		seed    *SeedCreator
+		tmpDir  string
+		step    Step
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		opsMock = ops.NewMockOps(ctrl)
+		tmpDir, _ = os.MkdirTemp("", "test")
+		seed = NewSeedCreator(l, opsMock, Options{BackupDir: tmpDir, Strict: true})
+		step, _ = FindStep("backup-mco-config")
+		Expect(os.WriteFile(filepath.Join(tmpDir, "mco-currentconfig.json"), []byte("{}"), 0600)).To(Succeed())
+		opsMock.EXPECT().RunInHostNamespace("cat", "/etc/machine-config-daemon/currentconfig").Return(`{"config": 2}`, nil)
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("Redoes steps whose inputs changed", func() {
+		current, err := seed.invalidateStaleStep(step, stepInputs{step.Name: fingerprint(`{"config": 1}`)})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(current).To(Equal(fingerprint(`{"config": 2}`)))
+		Expect(filepath.Join(tmpDir, "mco-currentconfig.json")).ToNot(BeAnExistingFile())
+	})
+
+	It("Keeps artifacts whose inputs are unchanged", func() {
+		_, err := seed.invalidateStaleStep(step, stepInputs{step.Name: fingerprint(`{"config": 2}`)})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(filepath.Join(tmpDir, "mco-currentconfig.json")).To(BeAnExistingFile())
+	})
+})
+
+var _ = Describe("etcd sanity", func() {
+	members := []byte(`{"members": [{"ID": 12345678901234567890, "name": "sno"}]}`)
+	noAlarms := []byte(`{"header": {}}`)
+	status := func(leader, raftIndex, appliedIndex uint64) []byte {
+		return []byte(fmt.Sprintf(`[{"Endpoint": "https://10.0.0.1:2379", "Status": {"header": {"member_id": 12345678901234567890},
+			"leader": %d, "raftIndex": %d, "raftAppliedIndex": %d}}]`, leader, raftIndex, appliedIndex))
+	}
+
+	It("Passes for the sole leading member", func() {
+		Expect(EvaluateEtcdSanity(members, status(12345678901234567890, 10, 10), noAlarms)).To(Succeed())
+	})
+
+	It("Fails for multiple members, lost leadership or alarms", func() {
+		Expect(EvaluateEtcdSanity([]byte(`{"members": [{"ID": 1, "name": "a"}, {"ID": 2, "name": "b"}]}`),
+			status(1, 10, 10), noAlarms)).To(MatchError(ContainSubstring("2 members (a, b)")))
+		Expect(EvaluateEtcdSanity(members, status(1, 10, 10), noAlarms)).To(MatchError(ContainSubstring("not the leader")))
+		Expect(EvaluateEtcdSanity(members, status(12345678901234567890, 10, 10),
+			[]byte(`{"alarms": [{"memberID": 1, "alarm": 1}]}`))).To(HaveOccurred())
+	})
+
+	It("Reports an etcd still applying its raft log", func() {
+		err := EvaluateEtcdSanity(members, status(12345678901234567890, 10, 8), noAlarms)
+		Expect(errors.Cause(err)).To(Equal(errEtcdApplying))
+	})
+
+	It("Skips the check once passed, etcd may be stopped already", func() {
+		tmpDir, _ := os.MkdirTemp("", "test")
+		defer os.RemoveAll(tmpDir)
+		// No etcdctl call is expected
+		seed := NewSeedCreator(logrus.New(), ops.NewMockOps(gomock.NewController(GinkgoT())), Options{BackupDir: tmpDir})
+
+		journal := &stepJournal{NodeRole: NodeRoleMaster, file: filepath.Join(tmpDir, journalFile)}
+		Expect(journal.complete("etcd-sanity")).To(Succeed())
+		Expect(seed.checkEtcdSanity()).To(Succeed())
+
+		Expect(os.Remove(filepath.Join(tmpDir, journalFile))).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(tmpDir, etcdSummaryFile), []byte("{}"), 0644)).To(Succeed())
+		Expect(seed.checkEtcdSanity()).To(Succeed())
+	})
+})
+
+var _ = Describe("etcd summary", func() {
+	status := []byte(`[{"Endpoint": "https://10.0.0.1:2379", "Status": {"header": {"member_id": 1, "revision": 4242},
+		"leader": 1, "dbSize": 104857600, "dbSizeInUse": 52428800}}]`)
+	key := func(key string) string {
+		return fmt.Sprintf(`{"key": "%s"}`, base64.StdEncoding.EncodeToString([]byte(key)))
+	}
+
+	It("Counts the keys per resource type", func() {
+		keys := []byte(fmt.Sprintf(`{"header": {"revision": 4242}, "kvs": [%s], "count": 5}`, strings.Join([]string{
+			key("/kubernetes.io/secrets/openshift-etcd/etcd-all-certs"),
+			key("/kubernetes.io/secrets/default/builder-token"),
+			key("/kubernetes.io/machineconfiguration.openshift.io/machineconfigs/rendered-master-1"),
+			key("/openshift.io/images/sha256:abc"),
+			key("compact_rev_key"),
+		}, ", ")))
+		summary, err := ParseEtcdSummary(status, keys)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary.Revision).To(Equal(int64(4242)))
+		Expect(summary.DBSize).To(Equal(int64(104857600)))
+		Expect(summary.DBSizeInUse).To(Equal(int64(52428800)))
+		Expect(summary.Keys).To(Equal(5))
+		Expect(summary.LargestResources).To(Equal([]EtcdResourceCount{
+			{Resource: "secrets", Keys: 2},
+			{Resource: "images", Keys: 1},
+			{Resource: "machineconfigs.machineconfiguration.openshift.io", Keys: 1},
+		}))
+	})
+
+	It("Fails on an unexpected endpoint status", func() {
+		_, err := ParseEtcdSummary([]byte(`[]`), []byte(`{}`))
+		Expect(err).To(MatchError(ContainSubstring("one etcd endpoint")))
+	})
+})
+
+var _ = Describe("Mirror registries push", func() {
+	var (
+		ctrl    *gomock.Controller
+		opsMock *ops.MockOps
+		seed    *SeedCreator
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		opsMock = ops.NewMockOps(ctrl)
+		seed = NewSeedCreator(logrus.New(), opsMock, Options{Registry: "quay.io/org/seed", Tag: "oneimage", AuthFile: "auth.json",
+			MirrorRegistries: []string{"mirror.lab/seed", "backup.lab/seed"}})
+	})
+
+	primaryPush := func(err error) {
+		opsMock.EXPECT().RunInHostNamespaceStream("podman", "push", "--authfile", "auth.json", "quay.io/org/seed:oneimage").
+			Return(ops.NewStream(strings.NewReader(""), strings.NewReader(""), func() error { return err }), nil)
+	}
+
+	It("Succeeds when only a mirror fails", func() {
+		primaryPush(nil)
+		opsMock.EXPECT().RunInHostNamespace("podman", "tag", "quay.io/org/seed:oneimage", "mirror.lab/seed:oneimage").Return("", nil)
+		opsMock.EXPECT().RunInHostNamespaceStream("podman", "push", "--authfile", "auth.json", "mirror.lab/seed:oneimage").
+			Return(ops.NewStream(strings.NewReader(""), strings.NewReader(""), func() error { return nil }), nil)
+		opsMock.EXPECT().RunInHostNamespace("podman", "tag", "quay.io/org/seed:oneimage", "backup.lab/seed:oneimage").
+			Return("", errors.New("tag failed"))
+
+		Expect(seed.pushSeedImage("quay.io/org/seed:oneimage")).To(Succeed())
+		Expect(seed.Report().Pushes).To(HaveLen(3))
+		Expect(seed.Report().Pushes[0]).To(Equal(PushStatus{Image: "quay.io/org/seed:oneimage", Primary: true}))
+		Expect(seed.Report().Pushes[1].Error).To(BeEmpty())
+		Expect(seed.Report().Pushes[2].Error).To(ContainSubstring("tag failed"))
+	})
+
+	It("Fails when the primary fails", func() {
+		primaryPush(errors.New("unauthorized"))
+		opsMock.EXPECT().RunInHostNamespace("podman", gomock.Any()).Return("", nil).AnyTimes()
+		opsMock.EXPECT().RunInHostNamespaceStream("podman", gomock.Any()).DoAndReturn(func(string, ...string) (*ops.Stream, error) {
+			return ops.NewStream(strings.NewReader(""), strings.NewReader(""), func() error { return nil }), nil
+		}).AnyTimes()
+
+		Expect(seed.pushSeedImage("quay.io/org/seed:oneimage")).To(MatchError(ContainSubstring("unauthorized")))
+		Expect(seed.Report().Pushes[0].Error).To(ContainSubstring("unauthorized"))
+	})
+
+	It("Pushes ORAS artifacts annotated like the image is labeled", func() {
+		executor := ops.NewMockExecute(ctrl)
+		seed.orasClient = oras.NewClient(logrus.New(), executor, "auth.json")
+		seed.backupDir = "/var/tmp/backup"
+		for _, image := range []string{"quay.io/org/seed:oneimage", "mirror.lab/seed:oneimage", "backup.lab/seed:oneimage"} {
+			executor.EXPECT().Execute("env", "-C", "/var/tmp/backup", "oras", "push", "--registry-config", "auth.json",
+				"--artifact-type", oras.ArtifactType,
+				"--annotation", ArtifactLabelPrefix+"etc.tgz=sha256:abc",
+				"--annotation", ArtifactsLabel+"=etc.tgz,manifest.json",
+				"--annotation", CreatedByLabel+"=ibu-imager",
+				"--annotation", ImagerVersionLabel+"="+version.Get().Version,
+				"--annotation", SeedFormatLabel+"=2",
+				image, "etc.tgz:"+oras.FileMediaType, "manifest.json:"+oras.FileMediaType).
+				Return("Digest: sha256:0c95d1f1a5ba7bd2d3ac0ff1bb2f79cbd0ba6d32c5d0bde3e7894a5f0a1a1de8\n", nil)
+		}
+
+		Expect(seed.pushSeedArtifact([]string{"etc.tgz", "manifest.json"}, layerCache{"etc.tgz": "sha256:abc"})).To(Succeed())
+		Expect(seed.Report().Pushes).To(HaveLen(3))
+	})
+})
+
+var _ = Describe("Push", func() {
+	var (
+		ctrl    *gomock.Controller
+		opsMock *ops.MockOps
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		opsMock = ops.NewMockOps(ctrl)
+	})
+
+	It("Pushes the local seed image to another registry", func() {
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("podman", "image", "exists", "quay.io/org/seed:oneimage").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("podman", "tag", "quay.io/org/seed:oneimage", "registry.lab/seed:oneimage").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespaceStream("podman", "push", "--authfile", "lab.json", "registry.lab/seed:oneimage").
+				Return(ops.NewStream(strings.NewReader(""), strings.NewReader(""), func() error { return nil }), nil),
+		)
+		statuses, err := Push(logrus.New(), containers.NewPodman(opsMock), PushConfig{SourceRegistry: "quay.io/org/seed", Registry: "registry.lab/seed",
+			Tag: "oneimage", AuthFile: "lab.json"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(statuses).To(Equal([]PushStatus{{Image: "registry.lab/seed:oneimage", Primary: true}}))
+	})
+
+	It("Fails without the local seed image", func() {
+		opsMock.EXPECT().RunInHostNamespace("podman", "image", "exists", "quay.io/org/seed:oneimage").Return("", errors.New("exit status 1"))
+		_, err := Push(logrus.New(), containers.NewPodman(opsMock), PushConfig{Registry: "quay.io/org/seed", Tag: "oneimage"})
+		Expect(err).To(MatchError(ContainSubstring("not found in the local storage")))
+	})
+})
+
+var _ = Describe("Export", func() {
+	var (
+		ctrl    *gomock.Controller
+		opsMock *ops.MockOps
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		opsMock = ops.NewMockOps(ctrl)
+	})
+
+	It("Parses OCI archive outputs", func() {
+		output, err := ParseOutput("oci-archive:/var/tmp/seeds/seed.tar")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(output).To(Equal(&Output{Transport: OutputOCIArchive, Path: "/var/tmp/seeds/seed.tar"}))
+		Expect(output.imageStorePath()).To(Equal("/var/tmp/seeds/seed-image-store.tar"))
+
+		for _, spec := range []string{"docker-archive:/var/tmp/seed.tar", "/var/tmp/seed.tar", "oci-archive:seed.tar", "oci-archive:/var/tmp/"} {
+			_, err = ParseOutput(spec)
+			Expect(err).To(HaveOccurred(), spec)
+		}
+	})
+
+	It("Exports the local seed image and its image store with their checksums", func() {
+		tmpDir, _ := os.MkdirTemp("", "test")
+		defer os.RemoveAll(tmpDir)
+		// The checksum files are written next to the archives, to a dir podman would have created
+		dir := filepath.Join(tmpDir, "my seeds")
+		Expect(os.Mkdir(dir, 0o755)).To(Succeed())
+		sum := strings.Repeat("ab", 32)
+		storeSum := strings.Repeat("cd", 32)
+
+		output, _ := ParseOutput("oci-archive:" + filepath.Join(dir, "seed.tar"))
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("podman", "image", "exists", "quay.io/org/seed:oneimage").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("mkdir", "-p", dir).Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("podman", "save", "--format", "oci-archive", "-o", filepath.Join(dir, "seed.tar"),
+				"quay.io/org/seed:oneimage").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("sha256sum", filepath.Join(dir, "seed.tar")).
+				Return(sum+"  "+filepath.Join(dir, "seed.tar")+"\n", nil),
+			opsMock.EXPECT().RunInHostNamespace("mkdir", "-p", dir).Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("podman", "save", "--format", "oci-archive", "-o", filepath.Join(dir, "seed-image-store.tar"),
+				"quay.io/org/seed:oneimage-image-store").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("sha256sum", filepath.Join(dir, "seed-image-store.tar")).
+				Return(storeSum+"  "+filepath.Join(dir, "seed-image-store.tar")+"\n", nil),
+		)
+		archives, err := Export(logrus.New(), opsMock, containers.NewPodman(opsMock), ExportConfig{Registry: "quay.io/org/seed",
+			Tag: "oneimage", Output: output, ImageStore: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(archives).To(Equal([]string{filepath.Join(dir, "seed.tar"), filepath.Join(dir, "seed-image-store.tar")}))
+		Expect(os.ReadFile(filepath.Join(dir, "seed.tar.sha256"))).To(BeEquivalentTo(sum + "  seed.tar\n"))
+		Expect(os.ReadFile(filepath.Join(dir, "seed-image-store.tar.sha256"))).To(BeEquivalentTo(storeSum + "  seed-image-store.tar\n"))
+	})
+
+	It("Fails on an invalid checksum", func() {
+		output, _ := ParseOutput("oci-archive:/var/tmp/seeds/seed.tar")
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("podman", "image", "exists", "quay.io/org/seed:oneimage").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("mkdir", "-p", "/var/tmp/seeds").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("podman", "save", "--format", "oci-archive", "-o", "/var/tmp/seeds/seed.tar",
+				"quay.io/org/seed:oneimage").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("sha256sum", "/var/tmp/seeds/seed.tar").Return("", nil),
+		)
+		_, err := Export(logrus.New(), opsMock, containers.NewPodman(opsMock), ExportConfig{Registry: "quay.io/org/seed",
+			Tag: "oneimage", Output: output})
+		Expect(err).To(MatchError(ContainSubstring("No sha256sum found")))
+	})
+
+	It("Fails without the local seed image", func() {
+		output, _ := ParseOutput("oci-archive:/var/tmp/seed.tar")
+		opsMock.EXPECT().RunInHostNamespace("podman", "image", "exists", "quay.io/org/seed:oneimage").Return("", errors.New("exit status 1"))
+		_, err := Export(logrus.New(), opsMock, containers.NewPodman(opsMock), ExportConfig{Registry: "quay.io/org/seed",
+			Tag: "oneimage", Output: output})
+		Expect(err).To(MatchError(ContainSubstring("not found in the local storage")))
+	})
+})
+
+var _ = Describe("Import", func() {
+	var (
+		ctrl    *gomock.Controller
+		opsMock *ops.MockOps
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		opsMock = ops.NewMockOps(ctrl)
+	})
+
+	It("Verifies and loads the seed archive, pushing it under another tag", func() {
+		sum := strings.Repeat("ab", 32)
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("test", "-f", "/var/tmp/my seeds/seed.tar.sha256").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("cat", "/var/tmp/my seeds/seed.tar.sha256").Return(sum+"  seed.tar\n", nil),
+			opsMock.EXPECT().RunInHostNamespace("sha256sum", "/var/tmp/my seeds/seed.tar").Return(sum+"  /var/tmp/my seeds/seed.tar\n", nil),
+			opsMock.EXPECT().RunInHostNamespace("podman", "load", "-i", "/var/tmp/my seeds/seed.tar").Return("Loaded image: quay.io/org/seed:oneimage\n", nil),
+			opsMock.EXPECT().RunInHostNamespace("podman", "image", "inspect", "--format", "json", "quay.io/org/seed:oneimage").
+				Return(`[{"Labels": {"io.openshift.ibu.created-by": "ibu-imager"}}]`, nil),
+			opsMock.EXPECT().RunInHostNamespace("podman", "tag", "quay.io/org/seed:oneimage", "registry.lab/seed:v2").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespaceStream("podman", "push", "--authfile", "lab.json", "registry.lab/seed:v2").
+				Return(ops.NewStream(strings.NewReader(""), strings.NewReader(""), func() error { return nil }), nil),
+		)
+		images, err := Import(logrus.New(), opsMock, containers.NewPodman(opsMock), ImportConfig{Archive: "/var/tmp/my seeds/seed.tar",
+			Registry: "registry.lab/seed", Tag: "v2", AuthFile: "lab.json"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(images).To(Equal([]string{"registry.lab/seed:v2"}))
+	})
+
+	It("Refuses archives not matching their checksum", func() {
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("test", "-f", "/var/tmp/seed.tar.sha256").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("cat", "/var/tmp/seed.tar.sha256").Return(strings.Repeat("ab", 32)+"  seed.tar\n", nil),
+			opsMock.EXPECT().RunInHostNamespace("sha256sum", "/var/tmp/seed.tar").Return(strings.Repeat("cd", 32)+"  /var/tmp/seed.tar\n", nil),
+		)
+		_, err := Import(logrus.New(), opsMock, containers.NewPodman(opsMock), ImportConfig{Archive: "/var/tmp/seed.tar"})
+		Expect(err).To(MatchError(ContainSubstring("doesn't match its checksum")))
+	})
+
+	It("Loads archives without a checksum file unchecked", func() {
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("test", "-f", "/var/tmp/seed.tar.sha256").Return("", exec.Command("sh", "-c", "exit 1").Run()),
+			opsMock.EXPECT().RunInHostNamespace("podman", "load", "-i", "/var/tmp/seed.tar").Return("Loaded image: quay.io/org/seed:oneimage\n", nil),
+			opsMock.EXPECT().RunInHostNamespace("podman", "image", "inspect", "--format", "json", "quay.io/org/seed:oneimage").
+				Return(`[{"Labels": {"io.openshift.ibu.created-by": "ibu-imager"}}]`, nil),
+		)
+		_, err := Import(logrus.New(), opsMock, containers.NewPodman(opsMock), ImportConfig{Archive: "/var/tmp/seed.tar"})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("Fails when the checksum file can't be looked for", func() {
+		opsMock.EXPECT().RunInHostNamespace("test", "-f", "/var/tmp/seed.tar.sha256").
+			Return("", errors.Wrap(exec.Command("sh", "-c", "exit 2").Run(), "nsenter: cannot open /proc/1/ns/mnt"))
+		_, err := Import(logrus.New(), opsMock, containers.NewPodman(opsMock), ImportConfig{Archive: "/var/tmp/seed.tar"})
+		Expect(err).To(MatchError(ContainSubstring("Failed to look for the checksum file")))
+	})
+
+	It("Refuses images that aren't seeds", func() {
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("podman", "load", "-i", "/var/tmp/seed.tar").Return("Loaded image: quay.io/org/app:v1\n", nil),
+			opsMock.EXPECT().RunInHostNamespace("podman", "image", "inspect", "--format", "json", "quay.io/org/app:v1").Return(`[{"Labels": {}}]`, nil),
+		)
+		_, err := Import(logrus.New(), opsMock, containers.NewPodman(opsMock), ImportConfig{Archive: "/var/tmp/seed.tar", SkipChecksum: true})
+		Expect(err).To(MatchError(ContainSubstring("isn't a seed image")))
+	})
+})
+
+var _ = Describe("Abort", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		tmpDir, _ = os.MkdirTemp("", "test")
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("Removes the artifacts of the interrupted step and restarts the services", func() {
+		journal := &stepJournal{NodeRole: NodeRoleMaster, file: filepath.Join(tmpDir, journalFile)}
+		// Interrupted during the recert dry-run
+		for _, step := range Steps() {
+			if step.Name == "recert-dry-run" {
+				break
+			}
+			Expect(journal.complete(step.Name)).To(Succeed())
+		}
+
+		ctrl := gomock.NewController(GinkgoT())
+		opsMock := ops.NewMockOps(ctrl)
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("podman", "ps", "--all", "--noheading", "--filter", gomock.Any(), gomock.Any(), gomock.Any()).Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("rm", "-rf", etcdScratchDir(tmpDir), filepath.Join(tmpDir, RecertSummaryFile)).Return("", nil),
+			opsMock.EXPECT().SystemctlAction("enable", "--now", "crio.service").Return("", nil),
+			opsMock.EXPECT().SystemctlAction("enable", "--now", "kubelet.service").Return("", nil),
+		)
+		Expect(Abort(logrus.New(), opsMock, containers.NewPodman(opsMock), tmpDir, false)).To(Succeed())
+		Expect(filepath.Join(tmpDir, journalFile)).To(BeAnExistingFile())
+	})
+})
+
+var _ = Describe("Etc deletions", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		tmpDir, _ = os.MkdirTemp("", "test")
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("Records the deleted files with their default type", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		opsMock := ops.NewMockOps(ctrl)
+		seed := &SeedCreator{log: logrus.New(), ops: opsMock, backupDir: tmpDir}
+		opsMock.EXPECT().RunInHostNamespace("stat", "--printf", "%F", "/usr/etc/systemd/system/multi-user.target.wants/ptp4l.service").
+			Return("symbolic link", nil)
+		diff, err := ostree.ParseConfigDiff("M    hosts\nA    chrony.conf\nD    systemd/system/multi-user.target.wants/ptp4l.service\n")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(seed.writeEtcDeletions(diff)).To(Succeed())
+
+		data, err := os.ReadFile(filepath.Join(tmpDir, seedmanifest.DeletionsFileName))
+		Expect(err).ToNot(HaveOccurred())
+		deletions, err := seedmanifest.ParseDeletions(data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deletions.Deletions).To(Equal([]seedmanifest.Deletion{{Path: "/etc/systemd/system/multi-user.target.wants/ptp4l.service",
+			Type: seedmanifest.DeletionTypeSymlink, Reason: seedmanifest.DeletionReasonConfigDiff}}))
+	})
+})
+
+var _ = Describe("Out-of-band /usr/local files", func() {
+	var (
+		opsMock *ops.MockOps
+		seed    *SeedCreator
+		tmpDir  string
+	)
+
+	BeforeEach(func() {
+		tmpDir, _ = os.MkdirTemp("", "test")
+		opsMock = ops.NewMockOps(gomock.NewController(GinkgoT()))
+		seed = &SeedCreator{log: logrus.New(), ops: opsMock, ostreeClient: ostree.NewClient("ibu-imager", opsMock), backupDir: tmpDir}
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	expectUsrLocal := func(target string) {
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("readlink", "-f", "/usr/local").Return(target+"\n", nil),
+			opsMock.EXPECT().RunInHostNamespace("find", target+"/", "-mindepth", "1", "-not", "-type", "d", "-printf", `%P\n`).
+				Return("bin/site-tool\nshare/shipped\n", nil),
+			opsMock.EXPECT().RunInHostNamespace("rpm-ostree", "status", "--json").
+				Return(`{"deployments": [{"booted": false, "checksum": "old"}, {"booted": true, "checksum": "abc"}]}`, nil),
+			opsMock.EXPECT().RunInHostNamespace("ostree", "ls", "-R", "--nul-filenames-only", "abc", "/usr/local").
+				Return("/usr/local\x00/usr/local/share\x00/usr/local/share/shipped\x00", nil),
+		)
+	}
+
+	It("Relies on var.tgz when /usr/local links into /var", func() {
+		expectUsrLocal("/var/usrlocal")
+		Expect(seed.captureUsrLocal()).To(Succeed())
+	})
+
+	It("Archives the out-of-band files when requested", func() {
+		seed.includeUsrLocal = true
+		expectUsrLocal("/usr/local")
+		opsMock.EXPECT().RunInHostNamespace("tar", "czf", filepath.Join(tmpDir, usrLocalFile), "--selinux", "--verbatim-files-from", "-T", gomock.Any()).
+			DoAndReturn(func(_ string, args ...string) (string, error) {
+				Expect(os.ReadFile(args[len(args)-1])).To(Equal([]byte("/usr/local/bin/site-tool\n")))
+				return "", nil
+			})
+		Expect(seed.captureUsrLocal()).To(Succeed())
+	})
+})
+
+var _ = Describe("Preflight", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		tmpDir, _ = os.MkdirTemp("", "test")
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("Fails when the backup dir can't hold the archives and skips the master checks of worker seeds", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		opsMock := ops.NewMockOps(ctrl)
+		seed := &SeedCreator{log: logrus.New(), ops: opsMock, backupDir: tmpDir, nodeRole: NodeRoleWorker, skipPush: true}
+		opsMock.EXPECT().RunBashInHostNamespace("for", gomock.Any()).Return("grep", nil)
+		opsMock.EXPECT().RunInHostNamespace("du", gomock.Any()).Return("8589934592\t/var\n", nil)
+		opsMock.EXPECT().RunInHostNamespace("du", "-sb", "/ostree/repo").Return("2147483648\t/ostree/repo\n", nil)
+		opsMock.EXPECT().RunInHostNamespace("df", "--output=avail", "-B1", tmpDir).Return("   Avail\n1073741824\n", nil)
+
+		report := seed.Preflight()
+		Expect(report.Passed()).To(BeFalse())
+		Expect(report.Checks).To(HaveLen(len(preflightChecks)))
+		Expect(report.Checks[0]).To(Equal(PreflightCheck{Name: "host-commands", Status: PreflightWarn,
+			Message: "missing host commands: grep, done without them"}))
+		Expect(report.Checks[1]).To(Equal(PreflightCheck{Name: "disk-space", Status: PreflightFail,
+			Message: "1.0 GiB free in " + tmpDir + " for 10.0 GiB to archive"}))
+		for _, check := range report.Checks[2:] {
+			Expect(check.Status).To(Equal(PreflightSkip))
+		}
+	})
+
+	It("Checks the single-node topology and the cluster operators", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		opsMock := ops.NewMockOps(ctrl)
+		seed := &SeedCreator{log: logrus.New(), ops: opsMock, kubeconfig: "kubeconfig"}
+		opsMock.EXPECT().RunInHostNamespace("oc", "get", "nodes", "-o", "json", "--kubeconfig", "kubeconfig").Return(
+			`{"items": [{"metadata": {"name": "sno"}, "status": {"conditions": [{"type": "Ready", "status": "True"}]}},
+				{"metadata": {"name": "worker"}, "status": {"conditions": [{"type": "Ready", "status": "True"}]}}]}`, nil)
+		opsMock.EXPECT().RunInHostNamespace("oc", "get", "clusteroperators", "-o", "json", "--kubeconfig", "kubeconfig").Return(
+			`{"items": [{"metadata": {"name": "etcd"}, "status": {"conditions": [{"type": "Available", "status": "True"}, {"type": "Degraded", "status": "False"}]}},
+				{"metadata": {"name": "dns"}, "status": {"conditions": [{"type": "Available", "status": "True"}, {"type": "Degraded", "status": "True"}]}}]}`, nil)
+
+		status, message := seed.checkSNOTopology()
+		Expect(status).To(Equal(PreflightFail))
+		Expect(message).To(ContainSubstring("2 nodes (sno, worker)"))
+		status, message = seed.checkClusterOperators()
+		Expect(status).To(Equal(PreflightFail))
+		Expect(message).To(Equal("1 of 2 cluster operators are unavailable or degraded: dns"))
+	})
+})
+
+var _ = Describe("Downtime estimate", func() {
+	var (
+		tmpDir  string
+		opsMock *ops.MockOps
+		seed    *SeedCreator
+	)
+
+	BeforeEach(func() {
+		tmpDir, _ = os.MkdirTemp("", "test")
+		opsMock = ops.NewMockOps(gomock.NewController(GinkgoT()))
+		seed = &SeedCreator{log: logrus.New(), ops: opsMock, backupDir: tmpDir}
+	})
+	AfterEach(func() {
+		now = time.Now
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	// fakeClock returns the start of every benchmark, then its end after the given durations
+	fakeClock := func(durations ...time.Duration) {
+		start := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+		var times []time.Time
+		for _, duration := range durations {
+			times = append(times, start, start.Add(duration))
+		}
+		now = func() time.Time {
+			Expect(times).ToNot(BeEmpty())
+			next := times[0]
+			times = times[1:]
+			return next
+		}
+	}
+	expectSizes := func(varSize, ostreeSize string) {
+		opsMock.EXPECT().RunInHostNamespace("du", append(append([]string{"-sb"}, seed.duExcludeArgs()...), "/var")).
+			Return(varSize+"\t/var\n", nil)
+		opsMock.EXPECT().RunInHostNamespace("du", "-sb", "/ostree/repo").Return(ostreeSize+"\t/ostree/repo\n", nil)
+	}
+
+	It("Predicts the archiving time at the compression throughput when it's the slowest", func() {
+		// 8 GiB of /var and 2 GiB of ostree repo, the disk writes 128 MiB/s and gzip compresses 16 MiB/s
+		expectSizes("8589934592", "2147483648")
+		fakeClock(time.Second, time.Second)
+
+		estimate, err := seed.EstimateDowntime()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(estimate.Bytes).To(Equal(uint64(10 << 30)))
+		Expect(estimate.DiskThroughput).To(Equal(float64(128 << 20)))
+		Expect(estimate.CompressionThroughput).To(Equal(float64(16 << 20)))
+		Expect(estimate.Downtime).To(Equal(fixedDowntime + 640*time.Second))
+		Expect(estimate.String()).To(Equal("Predicted kubelet/crio downtime: 14m0s (10.0 GiB to archive, disk 128 MiB/s, gzip 16 MiB/s)"))
+	})
+
+	It("Predicts the archiving time at the disk throughput when it's the slowest", func() {
+		expectSizes("8589934592", "2147483648")
+		fakeClock(16*time.Second, time.Second)
+
+		estimate, err := seed.EstimateDowntime()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(estimate.DiskThroughput).To(Equal(float64(8 << 20)))
+		Expect(estimate.Downtime).To(Equal(fixedDowntime + 1280*time.Second))
+	})
+
+	It("Fails when the sizes can't be measured", func() {
+		opsMock.EXPECT().RunInHostNamespace("du", gomock.Any()).Return("", fmt.Errorf("Dummy"))
+		_, err := seed.EstimateDowntime()
+		Expect(err).To(MatchError(ContainSubstring("Failed to compute disk usage")))
+	})
+})
+
+var _ = Describe("Extra artifacts", func() {
+	var (
+		l      = logrus.New()
+		tmpDir string
+		source string
+	)
+
+	BeforeEach(func() {
+		tmpDir, _ = os.MkdirTemp("", "test")
+		source = filepath.Join(tmpDir, "license.bin")
+		Expect(os.WriteFile(source, []byte("license"), 0600)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(tmpDir, "backup"), 0700)).To(Succeed())
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("Parses the namespace and file", func() {
+		extra, err := ParseExtraArtifact("acme.com=" + source)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(extra.Path()).To(Equal("extra/acme.com/license.bin"))
+
+		_, err = ParseExtraArtifact(source)
+		Expect(err).To(MatchError(ContainSubstring("expected <namespace>=<file>")))
+		_, err = ParseExtraArtifact("../etc=" + source)
+		Expect(err).To(MatchError(ContainSubstring("namespace")))
+	})
+
+	It("Attaches the files and records them in the manifest", func() {
+		seed := NewSeedCreator(l, nil, Options{BackupDir: filepath.Join(tmpDir, "backup"),
+			ExtraArtifacts: []ExtraArtifact{{Namespace: "acme.com", Source: source}}})
+		Expect(seed.attachExtraArtifacts()).To(Succeed())
+		Expect(seed.writeManifest()).To(Succeed())
+
+		data, err := os.ReadFile(filepath.Join(tmpDir, "backup", manifestFile))
+		Expect(err).ToNot(HaveOccurred())
+		var manifest Manifest
+		Expect(json.Unmarshal(data, &manifest)).To(Succeed())
+		Expect(manifest.ExtraArtifacts).To(Equal([]seedmanifest.ExtraArtifact{{
+			Namespace: "acme.com",
+			Name:      "license.bin",
+			Path:      "extra/acme.com/license.bin",
+			Size:      7,
+			Digest:    "sha256:cc1d3b0234846714b0aeda6cc34b057b4305bb83dd447fb88f816efeb59a4e96",
+		}}))
+	})
+
+	It("Refuses clashing and oversized attachments before copying anything", func() {
+		other := filepath.Join(tmpDir, "other", "license.bin")
+		Expect(os.MkdirAll(filepath.Dir(other), 0700)).To(Succeed())
+		Expect(os.WriteFile(other, []byte("other"), 0600)).To(Succeed())
+		seed := NewSeedCreator(l, nil, Options{BackupDir: filepath.Join(tmpDir, "backup"),
+			ExtraArtifacts: []ExtraArtifact{{Namespace: "acme.com", Source: source}, {Namespace: "acme.com", Source: other}}})
+		Expect(seed.attachExtraArtifacts()).To(MatchError(ContainSubstring("both attached as extra/acme.com/license.bin")))
+
+		seed = NewSeedCreator(l, nil, Options{BackupDir: filepath.Join(tmpDir, "backup"), ExtraArtifactsMaxSize: 4,
+			ExtraArtifacts: []ExtraArtifact{{Namespace: "acme.com", Source: source}}})
+		Expect(seed.attachExtraArtifacts()).To(MatchError(ContainSubstring("limit")))
+		Expect(filepath.Join(tmpDir, "backup", "extra", "acme.com")).ToNot(BeADirectory())
+	})
+
+	It("Archives every included host path into a tarball of its own", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		opsMock := ops.NewMockOps(ctrl)
+		backup := filepath.Join(tmpDir, "backup")
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("tar", "czf", filepath.Join(backup, "extra/host-paths/opt-custom-agent.tgz"),
+				"--selinux", "-C", "/", "opt/custom-agent").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("tar", "czf", filepath.Join(backup, "extra/host-paths/usr-local-bin.tgz"),
+				"--selinux", "-C", "/", "usr/local/bin").Return("", nil),
+		)
+		seed := NewSeedCreator(l, opsMock, Options{BackupDir: backup, IncludePaths: []string{"/opt/custom-agent/", "/usr/local/bin"}})
+		Expect(seed.archiveIncludedPaths()).To(Succeed())
+		Expect(filepath.Join(backup, "extra", "host-paths")).To(BeADirectory())
+	})
+
+	It("Refuses the included paths the seed carries or that would clash", func() {
+		Expect(ValidateIncludePaths([]string{"/opt/agent", "/usr/local/bin"}, DefaultBackupDir)).To(Succeed())
+		Expect(ValidateIncludePaths([]string{"opt/agent"}, DefaultBackupDir)).To(MatchError(ContainSubstring("must be absolute")))
+		Expect(ValidateIncludePaths([]string{"/var/lib/agent"}, DefaultBackupDir)).To(MatchError(ContainSubstring("can't be in /var")))
+		Expect(ValidateIncludePaths([]string{"/srv"}, "/srv/backup")).To(MatchError(ContainSubstring("holds the backup dir")))
+		Expect(ValidateIncludePaths([]string{"/opt/a-b", "/opt/a/b"}, DefaultBackupDir)).To(MatchError(ContainSubstring("both be archived as opt-a-b.tgz")))
+		_, err := ParseExtraArtifact("host-paths=" + source)
+		Expect(err).To(MatchError(ContainSubstring("reserved")))
+	})
+})
+
+var _ = Describe("Seed image tag", func() {
+	var (
+		l       = logrus.New()
+		ctrl    *gomock.Controller
+		opsMock *ops.MockOps
+		tmpDir  string
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		opsMock = ops.NewMockOps(ctrl)
+		tmpDir, _ = os.MkdirTemp("", "test")
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("Validates the tag templates", func() {
+		Expect(ValidateTag("{ocp_version}-{arch}-{date}")).To(Succeed())
+		Expect(ValidateTag("seed-{date}")).To(Succeed())
+		Expect(ValidateTag("seed-{hostname}")).To(MatchError(ContainSubstring("Unknown variables {hostname}")))
+		Expect(ValidateTag("-{date}")).To(MatchError(ContainSubstring("Invalid tag")))
+		Expect(ValidateTag("seed:{date}")).To(MatchError(ContainSubstring("Invalid tag")))
+		gates, err := featuregate.Parse("workerSeeds=true")
+		Expect(err).ToNot(HaveOccurred())
+		Expect((&Options{Tag: "{ocp_version}", NodeRole: NodeRoleWorker, FeatureGates: gates}).Validate()).
+			To(MatchError(ContainSubstring("don't carry the cluster version")))
+		Expect((&PushConfig{Registry: "quay.io/org/seed", Tag: "{date}"}).Validate()).To(MatchError(ContainSubstring("has variables")))
+	})
+
+	It("Replaces the variables of the tag", func() {
+		opsMock.EXPECT().RunInHostNamespace("oc", "get", "clusterversion", "version", "-o", "json", "--kubeconfig", "kubeconfig").
+			Return(`{"status": {"history": [{"version": "4.14.3", "state": "Completed"}]}}`, nil)
+		opsMock.EXPECT().RunInHostNamespace("uname", "-m").Return("x86_64\n", nil)
+		seed := NewSeedCreator(l, opsMock, Options{BackupDir: tmpDir, Kubeconfig: "kubeconfig", Registry: "quay.io/org/seed",
+			Tag: "{ocp_version}-{arch}-{date}"})
+		Expect(seed.resolveTag()).To(Succeed())
+		Expect(seed.seedImage()).To(Equal("quay.io/org/seed:4.14.3-x86_64-" + time.Now().UTC().Format("20060102")))
+
+		// Resolved once per run
+		Expect(seed.resolveTag()).To(Succeed())
+	})
+
+	It("Keeps the date of the resumed run", func() {
+		Expect(os.WriteFile(filepath.Join(tmpDir, clusterVersionFile),
+			[]byte(`{"status": {"history": [{"version": "4.14.0+ec.1", "state": "Completed"}]}}`), 0600)).To(Succeed())
+		journal := &stepJournal{Image: "quay.io/org/seed:4.14.0-ec.1-20231130", NodeRole: NodeRoleMaster, file: filepath.Join(tmpDir, journalFile),
+			Steps: []JournalEntry{{Name: "collect", CompletedAt: time.Date(2023, 11, 30, 23, 50, 0, 0, time.UTC)}}}
+		Expect(journal.save()).To(Succeed())
+
+		seed := NewSeedCreator(l, opsMock, Options{BackupDir: tmpDir, Registry: "quay.io/org/seed", Tag: "{ocp_version}-{date}", Resume: true})
+		Expect(seed.resolveTag()).To(Succeed())
+		Expect(seed.seedImage()).To(Equal("quay.io/org/seed:4.14.0-ec.1-20231130"))
+		_, err := seed.openJournal()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("Defaults the tag", func() {
+		seed := NewSeedCreator(l, opsMock, Options{BackupDir: tmpDir, Registry: "quay.io/org/seed"})
+		Expect(seed.resolveTag()).To(Succeed())
+		Expect(seed.seedImage()).To(Equal("quay.io/org/seed:" + DefaultTag))
+	})
 })
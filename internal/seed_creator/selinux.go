@@ -0,0 +1,43 @@
+package seed_creator
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/selinux"
+)
+
+const (
+	// selinuxFile holds the SELinux mode and policy of the seed host
+	selinuxFile = "selinux.json"
+)
+
+// backupSELinux saves the SELinux mode and policy version, so the restore can tell whether the
+// seed labels are valid on the target or a relabel is needed
+func (s *SeedCreator) backupSELinux() error {
+	selinuxJson := path.Join(s.backupDir, selinuxFile)
+	_, err := os.Stat(selinuxJson)
+	if err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	state, err := selinux.Capture("/")
+	if err != nil {
+		return err
+	}
+	if state.Mode != state.ConfigMode {
+		s.log.Warnf("SELinux runs %s but boots %s, the seed records the runtime mode", state.Mode, state.ConfigMode)
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal SELinux state")
+	}
+	if err = os.WriteFile(selinuxJson, data, 0600); err != nil {
+		return errors.Wrap(err, "Failed to write SELinux state")
+	}
+	s.log.Println("Backup of SELinux state created successfully.")
+	return nil
+}
@@ -0,0 +1,67 @@
+package seed_creator
+
+// StagesSchemaVersion is the version of the stages description, bumped on incompatible changes
+const StagesSchemaVersion = 1
+
+// StagesSchema describes the seed creation stages, for external orchestrators reasoning about partial
+// runs and the artifacts to expect in the backup dir
+type StagesSchema struct {
+	SchemaVersion int           `json:"schemaVersion"`
+	Stages        []StageSchema `json:"stages"`
+}
+
+// StageSchema describes a single stage of the seed creation
+type StageSchema struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Order is the position of the stage in the run, starting at 1
+	Order int `json:"order"`
+	// NodeRoles are the roles of the nodes whose seeds run the stage
+	NodeRoles []string     `json:"nodeRoles"`
+	Inputs    StageInputs  `json:"inputs"`
+	Outputs   StageOutputs `json:"outputs"`
+	// Fingerprinted stages are redone by --strict when their inputs changed since their artifacts were produced
+	Fingerprinted bool `json:"fingerprinted"`
+}
+
+// StageInputs is what a stage reads or acts on
+type StageInputs struct {
+	HostPaths []string `json:"hostPaths"`
+	Services  []string `json:"services"`
+}
+
+// StageOutputs is what a stage produces
+type StageOutputs struct {
+	// Artifacts are the files written in the backup dir, --only-steps and --skip-steps also select the
+	// stage by them
+	Artifacts []string `json:"artifacts"`
+}
+
+// Stages returns the description of the seed creation stages, generated from the steps
+func Stages() StagesSchema {
+	schema := StagesSchema{SchemaVersion: StagesSchemaVersion}
+	for i, step := range Steps() {
+		roles := []string{NodeRoleMaster}
+		if !step.masterOnly {
+			roles = append(roles, NodeRoleWorker)
+		}
+		schema.Stages = append(schema.Stages, StageSchema{
+			Name:          step.Name,
+			Description:   step.Description,
+			Order:         i + 1,
+			NodeRoles:     roles,
+			Inputs:        StageInputs{HostPaths: nonNil(step.HostPaths), Services: nonNil(step.Services)},
+			Outputs:       StageOutputs{Artifacts: nonNil(step.Artifacts)},
+			Fingerprinted: step.inputs != nil,
+		})
+	}
+	return schema
+}
+
+// nonNil returns an empty list instead of nil, so the JSON lists are never null
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
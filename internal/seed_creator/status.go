@@ -0,0 +1,93 @@
+package seed_creator
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// StatusFile is the report of the current or last run, updated on every step so status can follow
+	// a run from another process
+	StatusFile = "/var/lib/ibu-imager/status.json"
+
+	// ResultRunning is the result of a run still in progress
+	ResultRunning = "Running"
+	// ResultInterrupted is the result of a run whose process died before it finished
+	ResultInterrupted = "Interrupted"
+)
+
+// saveStatus persists the report of the run to the status file. Failures are only logged, the
+// status of a run isn't worth failing it. Nothing is saved when the seed creator has no status file.
+func (s *SeedCreator) saveStatus() {
+	if s.statusFile == "" {
+		return
+	}
+	if err := SaveStatus(s.statusFile, &s.report); err != nil {
+		s.log.Warnf("Failed to save run status: %v", err)
+	}
+}
+
+// startStep records the step as the current one of the run
+func (s *SeedCreator) startStep(name string) {
+	now := time.Now().UTC()
+	s.report.CurrentStep = name
+	s.report.CurrentStepStartedAt = &now
+	s.saveStatus()
+}
+
+// finishStep records the outcome of the current step of the run
+func (s *SeedCreator) finishStep(step StepReport) {
+	s.report.Steps = append(s.report.Steps, step)
+	s.report.CurrentStep = ""
+	s.report.CurrentStepStartedAt = nil
+	s.saveStatus()
+}
+
+// SaveStatus writes the report to the status file, through a rename so readers never see it truncated
+func SaveStatus(file string, report *RunReport) error {
+	if err := os.MkdirAll(path.Dir(file), 0700); err != nil {
+		return errors.Wrap(err, "Failed to create status dir")
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal run status")
+	}
+	if err = os.WriteFile(file+".tmp", data, 0600); err != nil {
+		return errors.Wrap(err, "Failed to write run status")
+	}
+	return errors.Wrap(os.Rename(file+".tmp", file), "Failed to write run status")
+}
+
+// LoadStatus returns the report of the current or last run, nil when no run was recorded. A run
+// still marked running whose process is gone is reported interrupted.
+func LoadStatus(file string) (*RunReport, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read run status")
+	}
+	var report RunReport
+	if err = json.Unmarshal(data, &report); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse run status")
+	}
+	if report.Result == ResultRunning && !processAlive(report.PID) {
+		report.Result = ResultInterrupted
+	}
+	return &report, nil
+}
+
+// processAlive returns true if the process exists, even when it isn't ours to signal
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,337 @@
+package seed_creator
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	planner "ibu-imager/internal/precache_plan"
+	"ibu-imager/pkg/seedmanifest"
+)
+
+// Step is a named stage of the seed creation
+type Step struct {
+	// Name identifies the step
+	Name string
+	// Description explains what the step does
+	Description string
+	// HostPaths are the host paths the step reads or modifies
+	HostPaths []string
+	// Services are the systemd services the step acts on
+	Services []string
+	// Artifacts are the files the step produces in the backup dir
+	Artifacts []string
+
+	// masterOnly steps are skipped for worker node seeds
+	masterOnly bool
+	// inputs fingerprints what the step artifacts are produced from, in strict mode
+	inputs func(s *SeedCreator) (string, error)
+
+	run func(s *SeedCreator) error
+}
+
+// Steps returns the seed creation steps, in the order they run
+func Steps() []Step {
+	return []Step{
+		{
+			Name:        "install-configuration",
+			Description: "Installs the scripts and systemd services that reconfigure the node on the first boot of the seed.",
+			HostPaths:   []string{"/var/usrlocal/bin", "/etc/systemd/system"},
+			run:         (*SeedCreator).copyConfigurationFiles,
+		},
+		{
+			Name:        "container-list",
+			Description: "Saves the images used by CRI-O, the catalog source images pinned to their digests and the cluster version, needed for pre-caching on the target.",
+			HostPaths:   []string{"/var/lib/containers"},
+			Artifacts:   []string{ContainersListFile, CatalogImagesFile, CatalogDigestsFile, clusterVersionFile},
+			run:         (*SeedCreator).createContainerList,
+		},
+		{
+			Name:        "precache-plan",
+			Description: "Optionally resolves the digests, sizes and registry availability of the images to precache, so the target doesn't resolve them again.",
+			Artifacts:   []string{planner.FileName},
+			run:         (*SeedCreator).resolvePrecachePlan,
+		},
+		{
+			Name:        "cluster-health",
+			Description: "Saves the health of the cluster operators, nodes and machine config pools at seed time.",
+			Artifacts:   []string{clusterHealthFile},
+			masterOnly:  true,
+			run:         (*SeedCreator).backupClusterHealth,
+		},
+		{
+			Name:        "backup-crio-runtime",
+			Description: "Saves the CRI-O version, config drop-ins, OCI hooks and runtime classes, so the restore can check the target hooks and runtime handlers are kept.",
+			HostPaths:   []string{"/etc/crio", "/etc/containers/oci/hooks.d", "/usr/share/containers/oci/hooks.d"},
+			Artifacts:   []string{crioRuntimeFile},
+			run:         (*SeedCreator).backupCrioRuntime,
+		},
+		{
+			Name:        "machine-config-server",
+			Description: "Optionally saves the machine-config-server serving certificate and the rendered master/worker configs, to serve ignition to future add-on nodes.",
+			Artifacts:   []string{mcsServerTLSFile, mcsRenderedConfigFile("master"), mcsRenderedConfigFile("worker")},
+			masterOnly:  true,
+			run:         (*SeedCreator).backupMachineConfigServer,
+		},
+		{
+			Name:        "etcd-sanity",
+			Description: "Checks through the etcd maintenance API that etcd is the sole, leading member, without alarms, and not defragmenting nor applying a restored snapshot.",
+			masterOnly:  true,
+			run:         (*SeedCreator).checkEtcdSanity,
+		},
+		{
+			Name:        "etcd-summary",
+			Description: "Saves the etcd revision, database size and the resource types with the most keys, to predict the restore time and spot bloated clusters.",
+			Artifacts:   []string{etcdSummaryFile},
+			masterOnly:  true,
+			run:         (*SeedCreator).backupEtcdSummary,
+		},
+		{
+			Name:        "resolve-recert-image",
+			Description: "Resolves the recert image through the cluster ICSP/IDMS/ITMS mirroring rules while the API is up, so disconnected clusters pull it from their mirrors.",
+			masterOnly:  true,
+			run:         (*SeedCreator).resolveRecertImage,
+		},
+		{
+			Name:        "stop-services",
+			Description: "Stops and disables kubelet, then stops the running containers and CRI-O (unless kept running) so the backups are consistent.",
+			Services:    []string{"kubelet.service", "crio.service"},
+			run:         (*SeedCreator).stopServices,
+		},
+		{
+			Name:        "recert-dry-run",
+			Description: "Serves the quiesced etcd data with an unauthenticated etcd and runs recert in dry-run mode, to validate the seed can be re-certified.",
+			HostPaths:   []string{"/var/lib/etcd", "/etc/kubernetes", "/var/lib/kubelet", "/etc/machine-config-daemon"},
+			Artifacts:   []string{RecertSummaryFile},
+			masterOnly:  true,
+			run:         (*SeedCreator).runRecertDryRun,
+		},
+		{
+			Name:        "backup-var",
+			Description: "Archives /var, excluding logs, temporary files, container storage and pod volumes, only /var/lib/kubelet for worker node seeds.",
+			HostPaths:   []string{varFolder},
+			Artifacts:   []string{"var.tgz"},
+			run:         (*SeedCreator).backupVar,
+		},
+		{
+			Name:        "backup-etc",
+			Description: "Archives the files of /etc that differ from the ostree deployment, and lists the deleted ones, only the ones of /etc/kubernetes for worker node seeds.",
+			HostPaths:   []string{"/etc"},
+			Artifacts:   []string{"etc.tgz", seedmanifest.DeletionsFileName},
+			inputs:      etcInputs,
+			run:         (*SeedCreator).backupEtc,
+		},
+		{
+			Name:        "usr-local",
+			Description: "Reports the files added to /usr/local out-of-band, outside the ostree commit, and optionally archives the ones var.tgz doesn't carry.",
+			HostPaths:   []string{usrLocalDir},
+			Artifacts:   []string{usrLocalFile},
+			run:         (*SeedCreator).captureUsrLocal,
+		},
+		{
+			Name:        "backup-ostree",
+			Description: "Archives the ostree repository.",
+			HostPaths:   []string{"/ostree/repo"},
+			Artifacts:   []string{"ostree.tgz"},
+			inputs:      ostreeInputs,
+			run:         (*SeedCreator).backupOstree,
+		},
+		{
+			Name:        "backup-rpm-ostree",
+			Description: "Saves the rpm-ostree status of the host.",
+			Artifacts:   []string{"rpm-ostree.json"},
+			inputs:      ostreeInputs,
+			run:         (*SeedCreator).backupRPMOstree,
+		},
+		{
+			Name:        "backup-mco-config",
+			Description: "Saves the current machine-config-daemon configuration.",
+			HostPaths:   []string{mcoCurrentConfigFile},
+			Artifacts:   []string{"mco-currentconfig.json"},
+			inputs:      mcoConfigInputs,
+			run:         (*SeedCreator).backupMCOConfig,
+		},
+		{
+			Name:        "backup-filesystems",
+			Description: "Saves the filesystem UUIDs/labels referenced by fstab and the bootloader, so the restore can rewrite them.",
+			HostPaths:   []string{"/etc/fstab", "/boot/loader/entries"},
+			Artifacts:   []string{filesystemsFile},
+			run:         (*SeedCreator).backupFilesystemReferences,
+		},
+		{
+			Name:        "backup-storage-layout",
+			Description: "Saves the disks, partitions and mount table of the host, so the restore can validate the target layout.",
+			HostPaths:   []string{"/proc/1/mountinfo", "/sys/block"},
+			Artifacts:   []string{storageLayoutFile},
+			run:         (*SeedCreator).backupStorageLayout,
+		},
+		{
+			Name:        "backup-selinux",
+			Description: "Saves the SELinux mode and policy version of the host, so the restore can refuse mode mismatches and schedule a relabel when needed.",
+			HostPaths:   []string{"/sys/fs/selinux", "/etc/selinux/config"},
+			Artifacts:   []string{selinuxFile},
+			run:         (*SeedCreator).backupSELinux,
+		},
+		{
+			Name:        "backup-node-network",
+			Description: "Saves the nodeip-configuration outcome, kubelet node IP and primary interface, so the restore selects the node IP on the target hardware instead of keeping the seed one.",
+			HostPaths:   []string{"/etc/default/nodeip-configuration", "/etc/systemd/system/kubelet.service.d", "/run/nodeip-configuration", "/var/lib/ovnk"},
+			Artifacts:   []string{nodeNetworkFile},
+			run:         (*SeedCreator).backupNodeNetwork,
+		},
+		{
+			Name:        "backup-kernel",
+			Description: "Saves the kernel command line, rpm-ostree kernel arguments and active tuned profile, so the restore can apply the missing kernel arguments and flag discrepancies.",
+			HostPaths:   []string{"/proc/cmdline"},
+			Artifacts:   []string{kernelFile},
+			run:         (*SeedCreator).backupKernel,
+		},
+		{
+			Name:        "backup-core-user",
+			Description: "Optionally archives the core user's SSH authorized_keys and shell customizations, restored according to a keys policy.",
+			HostPaths:   []string{coreUserHome},
+			Artifacts:   []string{coreUserFile},
+			run:         (*SeedCreator).backupCoreUser,
+		},
+		{
+			Name:        "backup-audit-logs",
+			Description: "Archives /var/log/audit and the login records when the audit log policy includes them, the policy is recorded in the manifest either way.",
+			HostPaths:   []string{"/var/log/audit", "/var/log/wtmp", "/var/log/btmp", "/var/log/lastlog"},
+			Artifacts:   []string{auditLogsFile},
+			run:         (*SeedCreator).backupAuditLogs,
+		},
+		{
+			Name:        "extra-artifacts",
+			Description: "Attaches the third-party files given by --attach-extra-artifact (e.g. vendor license blobs) under their namespace, recorded in the manifest with their checksums.",
+			Artifacts:   []string{extraArtifactsDir},
+			run:         (*SeedCreator).attachExtraArtifacts,
+		},
+		{
+			Name:        "include-paths",
+			Description: "Archives the host paths given by --include-path (e.g. /opt agents, /usr/local/bin scripts) each into a tarball of its own among the extra artifacts.",
+			Artifacts:   []string{path.Join(extraArtifactsDir, includedPathsNamespace)},
+			run:         (*SeedCreator).archiveIncludedPaths,
+		},
+		{
+			Name:        "lint",
+			Description: "Scans the artifacts for files that should never be in a seed (private keys, passwords, cloud credentials), failing or redacting them.",
+			run:         (*SeedCreator).lintSeed,
+		},
+		{
+			Name:        "write-manifest",
+			Description: "Writes the seed manifest describing the seed kind and its restore steps.",
+			Artifacts:   []string{manifestFile},
+			run:         (*SeedCreator).writeManifest,
+		},
+		{
+			Name:        "build-and-push",
+			Description: "Saves the booted deployment .origin file, builds the seed OCI image and pushes it to the registry and its mirrors, unless --skip-push.",
+			HostPaths:   []string{"/ostree/deploy", "/var/lib/containers"},
+			Artifacts:   []string{"ostree-<deployment>.origin"},
+			run:         (*SeedCreator).createAndPushSeedImage,
+		},
+		{
+			Name:        "image-store",
+			Description: "Optionally composes the seed images into a containers-storage root and pushes it as a separate <tag>-image-store image (unless --skip-push), to mount read-only through CRI-O's additionalimagestores.",
+			HostPaths:   []string{"/var/lib/containers"},
+			run:         (*SeedCreator).buildAndPushImageStore,
+		},
+	}
+}
+
+// FindStep returns the step with the given name, or the step producing the given artifact
+func FindStep(nameOrArtifact string) (Step, bool) {
+	for _, step := range Steps() {
+		if step.Name == nameOrArtifact {
+			return step, true
+		}
+		for _, artifact := range step.Artifacts {
+			if artifact == nameOrArtifact {
+				return step, true
+			}
+		}
+	}
+	return Step{}, false
+}
+
+// LookupStep returns the step with the given name, or the step producing the given artifact, failing
+// on unknown ones
+func LookupStep(nameOrArtifact string) (Step, error) {
+	step, found := FindStep(nameOrArtifact)
+	if !found {
+		return Step{}, errors.Errorf("Unknown step or artifact %q, run 'ibu-imager explain' to list them", nameOrArtifact)
+	}
+	return step, nil
+}
+
+// StepSelection selects the steps a seed creation runs, e.g. to rerun a single phase while iterating on
+// one backup. A nil selection runs every step.
+type StepSelection struct {
+	only map[string]bool
+	skip map[string]bool
+}
+
+// NewStepSelection selects either the only steps to run or the steps to skip, by step or artifact name
+func NewStepSelection(only, skip []string) (*StepSelection, error) {
+	if len(only) > 0 && len(skip) > 0 {
+		return nil, errors.New("The steps to run and the steps to skip can't be both selected")
+	}
+	selection := &StepSelection{}
+	var err error
+	if selection.only, err = resolveSteps(only); err != nil {
+		return nil, err
+	}
+	if selection.skip, err = resolveSteps(skip); err != nil {
+		return nil, err
+	}
+	return selection, nil
+}
+
+// resolveSteps returns the set of the steps named, or producing the artifacts named
+func resolveSteps(names []string) (map[string]bool, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	steps := map[string]bool{}
+	for _, name := range names {
+		step, err := LookupStep(name)
+		if err != nil {
+			return nil, err
+		}
+		steps[step.Name] = true
+	}
+	return steps, nil
+}
+
+// Selects tells whether the step runs
+func (s *StepSelection) Selects(name string) bool {
+	if s == nil {
+		return true
+	}
+	if s.only != nil {
+		return s.only[name]
+	}
+	return !s.skip[name]
+}
+
+func (s *StepSelection) String() string {
+	if s == nil {
+		return "all steps"
+	}
+	if s.only != nil {
+		return "only " + joinSteps(s.only)
+	}
+	return "all steps but " + joinSteps(s.skip)
+}
+
+// joinSteps lists the set of steps, sorted
+func joinSteps(steps map[string]bool) string {
+	names := make([]string, 0, len(steps))
+	for name := range steps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,40 @@
+package seed_creator
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+
+	storage "ibu-imager/internal/host_storage"
+)
+
+const (
+	// storageLayoutFile holds the partition layout and mount table of the seed host
+	storageLayoutFile = "storage-layout.json"
+)
+
+// backupStorageLayout saves the partition layout and mount table, so the restore can validate
+// the target layout before making destructive changes
+func (s *SeedCreator) backupStorageLayout() error {
+	layoutJson := path.Join(s.backupDir, storageLayoutFile)
+	_, err := os.Stat(layoutJson)
+	if err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	layout, err := storage.CaptureLayout("/proc", "/sys")
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(layout, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal storage layout")
+	}
+	if err = os.WriteFile(layoutJson, data, 0600); err != nil {
+		return errors.Wrap(err, "Failed to write storage layout")
+	}
+	s.log.Println("Backup of storage layout created successfully.")
+	return nil
+}
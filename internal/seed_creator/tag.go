@@ -0,0 +1,132 @@
+package seed_creator
+
+import (
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultTag is the seed image tag when none is given
+	DefaultTag = "oneimage"
+
+	// TagVarOCPVersion is replaced in the tag by the OCP version of the seed cluster, e.g. 4.14.3
+	TagVarOCPVersion = "{ocp_version}"
+	// TagVarArch is replaced in the tag by the architecture of the host, as uname -m reports it, e.g. x86_64
+	TagVarArch = "{arch}"
+	// TagVarDate is replaced in the tag by the UTC date of the run, e.g. 20231130
+	TagVarDate = "{date}"
+
+	// tagDateFormat is the format of the {date} tag variable
+	tagDateFormat = "20060102"
+)
+
+var (
+	// tagVariable matches the {variables} of a tag template
+	tagVariable = regexp.MustCompile(`\{[^{}]*\}`)
+	// validTag is the OCI distribution spec tag syntax
+	validTag = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+	// invalidTagChars are replaced in the variable values, e.g. the + of OCP build metadata
+	invalidTagChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+)
+
+// ValidateTag checks the tag is a valid image tag once its {ocp_version}, {arch} and {date} variables are
+// replaced, refusing the unknown variables
+func ValidateTag(tag string) error {
+	var unknown []string
+	sample := tagVariable.ReplaceAllStringFunc(tag, func(variable string) string {
+		switch variable {
+		case TagVarOCPVersion, TagVarArch, TagVarDate:
+			return "x"
+		}
+		unknown = append(unknown, variable)
+		return ""
+	})
+	if len(unknown) > 0 {
+		return errors.Errorf("Unknown variables %s in tag %s, use %s, %s or %s", strings.Join(unknown, ", "), tag,
+			TagVarOCPVersion, TagVarArch, TagVarDate)
+	}
+	if !validTag.MatchString(sample) {
+		return errors.Errorf("Invalid tag %s, tags are up to 128 letters, digits, '.', '_' and '-', not starting with '.' or '-'", tag)
+	}
+	return nil
+}
+
+// IsTagTemplate returns true if the tag has variables to replace
+func IsTagTemplate(tag string) bool {
+	return tagVariable.MatchString(tag)
+}
+
+// resolveTag replaces the variables of the tag template, once per run. A resumed run keeps the date of
+// the run it resumes, so it pushes the same image.
+func (s *SeedCreator) resolveTag() error {
+	if !IsTagTemplate(s.backupTag) {
+		return nil
+	}
+
+	var resolveErr error
+	tag := tagVariable.ReplaceAllStringFunc(s.backupTag, func(variable string) string {
+		value, err := s.tagVariable(variable)
+		if err != nil && resolveErr == nil {
+			resolveErr = err
+		}
+		return invalidTagChars.ReplaceAllString(value, "-")
+	})
+	if resolveErr != nil {
+		return errors.Wrapf(resolveErr, "Failed to resolve tag %s", s.backupTag)
+	}
+	if !validTag.MatchString(tag) {
+		return errors.Errorf("The tag %s resolves to the invalid tag %s", s.backupTag, tag)
+	}
+	s.log.Infof("Tagging the seed image %s", tag)
+	s.backupTag = tag
+	return nil
+}
+
+// tagVariable returns the value of a tag variable
+func (s *SeedCreator) tagVariable(variable string) (string, error) {
+	switch variable {
+	case TagVarOCPVersion:
+		version, err := s.ocpVersion()
+		return version, errors.Wrap(err, "Failed to get the OCP version")
+	case TagVarArch:
+		arch, err := s.ops.RunInHostNamespace("uname", "-m")
+		return strings.TrimSpace(arch), errors.Wrap(err, "Failed to get the host architecture")
+	case TagVarDate:
+		return s.runDate().Format(tagDateFormat), nil
+	}
+	return "", errors.Errorf("Unknown tag variable %s", variable)
+}
+
+// ocpVersion returns the OCP version of the seed cluster, from the clusterversion.json already collected
+// when resuming or building from a backup dir, from the cluster otherwise
+func (s *SeedCreator) ocpVersion() (string, error) {
+	data, err := os.ReadFile(path.Join(s.backupDir, clusterVersionFile))
+	if os.IsNotExist(err) && !s.fromBackupDir {
+		var output string
+		output, err = s.ops.RunInHostNamespace("oc", "get", "clusterversion", "version", "-o", "json", "--kubeconfig", s.kubeconfig)
+		data = []byte(output)
+	}
+	if err != nil {
+		return "", err
+	}
+	summary, err := ParseClusterVersion(data)
+	if err != nil {
+		return "", err
+	}
+	return summary.Version, nil
+}
+
+// runDate returns the date of the run, the date the resumed run completed its first step
+func (s *SeedCreator) runDate() time.Time {
+	if s.resume {
+		if journal, err := readJournal(s.backupDir); err == nil && journal != nil && len(journal.Steps) > 0 {
+			return journal.Steps[0].CompletedAt.UTC()
+		}
+	}
+	return time.Now().UTC()
+}
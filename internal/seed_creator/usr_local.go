@@ -0,0 +1,104 @@
+package seed_creator
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// usrLocalDir is where sites drop tools outside ostree, a link to /var/usrlocal on RHCOS
+	usrLocalDir = "/usr/local"
+	// usrLocalFile is the archive of the out-of-band /usr/local files var.tgz doesn't carry
+	usrLocalFile = "usrlocal.tgz"
+)
+
+// OutOfBandFiles returns the host files that aren't in the ostree commit, sorted
+func OutOfBandFiles(hostFiles, commitFiles []string) []string {
+	inCommit := make(map[string]bool, len(commitFiles))
+	for _, file := range commitFiles {
+		inCommit[file] = true
+	}
+	var outOfBand []string
+	for _, file := range hostFiles {
+		if !inCommit[file] {
+			outOfBand = append(outOfBand, file)
+		}
+	}
+	sort.Strings(outOfBand)
+	return outOfBand
+}
+
+// captureUsrLocal diffs /usr/local against the booted ostree commit. The out-of-band files are
+// carried by var.tgz when /usr/local links into /var, as on RHCOS, otherwise they're only archived
+// with --include-usr-local and reported as lost without it.
+func (s *SeedCreator) captureUsrLocal() error {
+	target, err := s.ops.RunInHostNamespace("readlink", "-f", usrLocalDir)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to resolve %s", usrLocalDir)
+	}
+	target = strings.TrimSpace(target)
+	output, err := s.ops.RunInHostNamespace("find", target+"/", "-mindepth", "1", "-not", "-type", "d", "-printf", "%P\\n")
+	if err != nil {
+		return errors.Wrapf(err, "Failed to list %s", usrLocalDir)
+	}
+	var hostFiles []string
+	for _, file := range strings.Split(output, "\n") {
+		if file != "" {
+			hostFiles = append(hostFiles, path.Join(usrLocalDir, file))
+		}
+	}
+	if len(hostFiles) == 0 {
+		s.log.Info("No files in /usr/local")
+		return nil
+	}
+
+	commitFiles, err := s.commitFiles(usrLocalDir)
+	if err != nil {
+		return err
+	}
+	outOfBand := OutOfBandFiles(hostFiles, commitFiles)
+	switch {
+	case len(outOfBand) == 0:
+		s.log.Info("No out-of-band files in /usr/local")
+		return nil
+	case strings.HasPrefix(target, varFolder+"/"):
+		s.log.Infof("%d out-of-band files in /usr/local, carried by var.tgz through %s", len(outOfBand), target)
+		return nil
+	case !s.includeUsrLocal:
+		s.log.Warnf("%d out-of-band files in /usr/local won't be in the seed, use --include-usr-local to carry them: %s",
+			len(outOfBand), strings.Join(outOfBand, ", "))
+		return nil
+	}
+	return s.archiveFiles(usrLocalFile, outOfBand)
+}
+
+// commitFiles returns the files of the booted ostree commit below the directory
+func (s *SeedCreator) commitFiles(dir string) ([]string, error) {
+	status, err := s.ostreeClient.QueryStatus()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to query ostree status")
+	}
+	checksum := ""
+	for _, deployment := range status.Deployments {
+		if deployment.Booted {
+			checksum = deployment.Checksum
+		}
+	}
+	if checksum == "" {
+		return nil, errors.New("No booted ostree deployment")
+	}
+	output, err := s.ops.RunInHostNamespace("ostree", "ls", "-R", "--nul-filenames-only", checksum, dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list %s in the ostree commit", dir)
+	}
+	var files []string
+	for _, file := range strings.Split(output, "\x00") {
+		if file = strings.TrimSpace(file); file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
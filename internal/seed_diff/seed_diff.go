@@ -0,0 +1,392 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package seed_diff
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	registry "ibu-imager/internal/registry_client"
+	inspector "ibu-imager/internal/seed_inspect"
+	verifier "ibu-imager/internal/seed_verify"
+	"ibu-imager/pkg/seedmanifest"
+)
+
+const (
+	rpmOstreeFile        = "rpm-ostree.json"
+	mcoCurrentConfigFile = "mco-currentconfig.json"
+	etcFile              = "etc.tgz"
+
+	// shortDigestLength is the length digests are shortened to when printed
+	shortDigestLength = 12
+)
+
+// Change kinds
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Change is an entry of a section that differs between the two seeds
+type Change struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Old is the value in the first seed, empty when added
+	Old string `json:"old,omitempty"`
+	// New is the value in the second seed, empty when removed
+	New string `json:"new,omitempty"`
+}
+
+// Section is a part of the seeds that is compared, e.g. their artifacts or /etc
+type Section struct {
+	Name    string   `json:"name"`
+	Changes []Change `json:"changes"`
+}
+
+// Result is the difference between two seed images
+type Result struct {
+	Old      string    `json:"old"`
+	New      string    `json:"new"`
+	Sections []Section `json:"sections"`
+}
+
+// Identical returns true when no section changed
+func (r *Result) Identical() bool {
+	for _, section := range r.Sections {
+		if len(section.Changes) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Seed is a seed image to compare, its metadata and a reader of its file artifacts
+type Seed struct {
+	Info *inspector.Info
+	Read func(artifact string) ([]byte, error)
+}
+
+// RemoteSeed returns the seed image in the registry, reading its artifacts without pulling it
+func RemoteSeed(client *registry.Client, ref registry.Reference) (*Seed, error) {
+	info, err := inspector.Inspect(client, ref)
+	if err != nil {
+		return nil, err
+	}
+	return &Seed{Info: info, Read: func(artifact string) ([]byte, error) {
+		return verifier.ReadArtifact(client, ref, artifact)
+	}}, nil
+}
+
+// sectionEntries flattens a part of a seed into named values compared one by one
+type sectionEntries func(seed *Seed) (map[string]string, error)
+
+// sections are the parts of the seeds compared, in order, with the artifact they're read from.
+// The artifacts with the same digest in both seeds aren't downloaded.
+var sections = []struct {
+	name     string
+	artifact string
+	entries  sectionEntries
+}{
+	{"Manifest", "", manifestEntries},
+	{"Artifacts", "", artifactEntries},
+	{"rpm-ostree", rpmOstreeFile, rpmOstreeEntries},
+	{"MCO currentconfig", mcoCurrentConfigFile, mcoConfigEntries},
+	{"/etc", etcFile, etcEntries},
+	// Small enough to always be compared, older seeds carry the legacy deletions instead
+	{"/etc deletions", "", deletionEntries},
+}
+
+// Diff compares two seed images
+func Diff(from, to *Seed) (*Result, error) {
+	result := &Result{Old: from.Info.Image, New: to.Info.Image}
+	for _, section := range sections {
+		if section.artifact != "" && sameArtifact(from.Info, to.Info, section.artifact) {
+			result.Sections = append(result.Sections, Section{Name: section.name, Changes: []Change{}})
+			continue
+		}
+		fromEntries, err := section.entries(from)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s of %s", section.name, from.Info.Image)
+		}
+		toEntries, err := section.entries(to)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s of %s", section.name, to.Info.Image)
+		}
+		result.Sections = append(result.Sections, Section{Name: section.name, Changes: compare(fromEntries, toEntries)})
+	}
+	return result, nil
+}
+
+// compare returns the entries added, removed and changed, sorted by name
+func compare(from, to map[string]string) []Change {
+	changes := []Change{}
+	for name, value := range from {
+		toValue, ok := to[name]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Kind: Removed, Name: name, Old: value})
+		case toValue != value:
+			changes = append(changes, Change{Kind: Changed, Name: name, Old: value, New: toValue})
+		}
+	}
+	for name, value := range to {
+		if _, ok := from[name]; !ok {
+			changes = append(changes, Change{Kind: Added, Name: name, New: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// findArtifact returns the artifact of the seed, false when the seed has none
+func findArtifact(info *inspector.Info, name string) (inspector.Artifact, bool) {
+	for _, artifact := range info.Artifacts {
+		if artifact.Name == name {
+			return artifact, true
+		}
+	}
+	return inspector.Artifact{}, false
+}
+
+// sameArtifact returns true when both seeds have the artifact with the same digest
+func sameArtifact(from, to *inspector.Info, name string) bool {
+	fromArtifact, fromOk := findArtifact(from, name)
+	toArtifact, toOk := findArtifact(to, name)
+	if !fromOk && !toOk {
+		return true
+	}
+	return fromOk && toOk && fromArtifact.Digest != "" && fromArtifact.Digest == toArtifact.Digest
+}
+
+// readArtifact reads the artifact of the seed, nil when the seed has none
+func readArtifact(seed *Seed, name string) ([]byte, error) {
+	if _, ok := findArtifact(seed.Info, name); !ok {
+		return nil, nil
+	}
+	return seed.Read(name)
+}
+
+// shortDigest shortens a digest for printing
+func shortDigest(digest string) string {
+	digest = strings.TrimPrefix(digest, "sha256:")
+	if len(digest) > shortDigestLength {
+		return digest[:shortDigestLength]
+	}
+	return digest
+}
+
+// contentDigest returns the short digest of a JSON encoded value or of raw data
+func contentDigest(value interface{}) string {
+	data, ok := value.([]byte)
+	if !ok {
+		data, _ = json.Marshal(value)
+	}
+	sum := sha256.Sum256(data)
+	return shortDigest(hex.EncodeToString(sum[:]))
+}
+
+func manifestEntries(seed *Seed) (map[string]string, error) {
+	manifest := seed.Info.Manifest
+	entries := map[string]string{
+		"kind":      manifest.Kind,
+		"nodeRole":  manifest.NodeRole,
+		"auditLogs": manifest.AuditLogs,
+	}
+	if manifest.ClusterVersion != nil {
+		entries["clusterVersion"] = manifest.ClusterVersion.Version
+	}
+	if manifest.Etcd != nil {
+		entries["etcdDBSize"] = fmt.Sprint(manifest.Etcd.DBSize)
+		entries["etcdKeys"] = fmt.Sprint(manifest.Etcd.Keys)
+	}
+	if manifest.ImageStore != "" {
+		entries["imageStore"] = manifest.ImageStore
+	}
+	for _, step := range manifest.RestoreSteps {
+		entries["restoreStep "+step.Name] = step.Artifact
+	}
+	return entries, nil
+}
+
+func artifactEntries(seed *Seed) (map[string]string, error) {
+	entries := map[string]string{}
+	for _, artifact := range seed.Info.Artifacts {
+		entries[artifact.Name] = shortDigest(artifact.Digest)
+	}
+	return entries, nil
+}
+
+// rpmOstreeEntries returns the booted deployment of rpm-ostree status
+func rpmOstreeEntries(seed *Seed) (map[string]string, error) {
+	data, err := readArtifact(seed, rpmOstreeFile)
+	if err != nil || data == nil {
+		return map[string]string{}, err
+	}
+	var status struct {
+		Deployments []struct {
+			Booted                  bool     `json:"booted"`
+			OSName                  string   `json:"osname"`
+			Version                 string   `json:"version"`
+			Checksum                string   `json:"checksum"`
+			ContainerImageReference string   `json:"container-image-reference"`
+			RequestedPackages       []string `json:"requested-packages"`
+		} `json:"deployments"`
+	}
+	if err = json.Unmarshal(data, &status); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse rpm-ostree status")
+	}
+	entries := map[string]string{}
+	for _, deployment := range status.Deployments {
+		if !deployment.Booted {
+			continue
+		}
+		entries["osname"] = deployment.OSName
+		entries["version"] = deployment.Version
+		entries["checksum"] = shortDigest(deployment.Checksum)
+		entries["containerImageReference"] = deployment.ContainerImageReference
+		for _, pkg := range deployment.RequestedPackages {
+			entries["package "+pkg] = "requested"
+		}
+	}
+	return entries, nil
+}
+
+// mcoConfigEntries returns the OS image, kernel arguments, files and units of the current machine config
+func mcoConfigEntries(seed *Seed) (map[string]string, error) {
+	data, err := readArtifact(seed, mcoCurrentConfigFile)
+	if err != nil || data == nil {
+		return map[string]string{}, err
+	}
+	var config struct {
+		Spec struct {
+			OSImageURL      string   `json:"osImageURL"`
+			KernelType      string   `json:"kernelType"`
+			KernelArguments []string `json:"kernelArguments"`
+			Extensions      []string `json:"extensions"`
+			Config          struct {
+				Storage struct {
+					Files []json.RawMessage `json:"files"`
+				} `json:"storage"`
+				Systemd struct {
+					Units []json.RawMessage `json:"units"`
+				} `json:"systemd"`
+			} `json:"config"`
+		} `json:"spec"`
+	}
+	if err = json.Unmarshal(data, &config); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse MCO currentconfig")
+	}
+	spec := config.Spec
+	entries := map[string]string{"osImageURL": spec.OSImageURL, "kernelType": spec.KernelType}
+	for _, argument := range spec.KernelArguments {
+		entries["kernelArgument "+argument] = "set"
+	}
+	for _, extension := range spec.Extensions {
+		entries["extension "+extension] = "enabled"
+	}
+	for _, file := range spec.Config.Storage.Files {
+		var named struct {
+			Path string `json:"path"`
+		}
+		if err = json.Unmarshal(file, &named); err != nil {
+			return nil, errors.Wrap(err, "Failed to parse MCO currentconfig file")
+		}
+		entries["file "+named.Path] = contentDigest([]byte(file))
+	}
+	for _, unit := range spec.Config.Systemd.Units {
+		var named struct {
+			Name string `json:"name"`
+		}
+		if err = json.Unmarshal(unit, &named); err != nil {
+			return nil, errors.Wrap(err, "Failed to parse MCO currentconfig unit")
+		}
+		entries["unit "+named.Name] = contentDigest([]byte(unit))
+	}
+	return entries, nil
+}
+
+// etcEntries returns the files of the /etc archive, with their mode and content digest or link target
+func etcEntries(seed *Seed) (map[string]string, error) {
+	data, err := readArtifact(seed, etcFile)
+	if err != nil || data == nil {
+		return map[string]string{}, err
+	}
+	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read /etc archive")
+	}
+	entries := map[string]string{}
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read /etc archive")
+		}
+		name := "/" + strings.TrimPrefix(strings.TrimSuffix(header.Name, "/"), "/")
+		mode := fmt.Sprintf("%04o", header.Mode&0o7777)
+		switch header.Typeflag {
+		case tar.TypeReg:
+			sum := sha256.New()
+			if _, err = io.Copy(sum, tarReader); err != nil {
+				return nil, errors.Wrapf(err, "Failed to read %s", name)
+			}
+			entries[name] = mode + " " + shortDigest(hex.EncodeToString(sum.Sum(nil)))
+		case tar.TypeSymlink:
+			entries[name] = "-> " + header.Linkname
+		case tar.TypeDir:
+			entries[name] = mode + " directory"
+		}
+	}
+}
+
+// deletionEntries returns the files the seed deleted from /etc, from the deletions of older seeds too
+func deletionEntries(seed *Seed) (map[string]string, error) {
+	var deletions []seedmanifest.Deletion
+	if data, err := readArtifact(seed, seedmanifest.DeletionsFileName); err != nil {
+		return nil, err
+	} else if data != nil {
+		parsed, err := seedmanifest.ParseDeletions(data)
+		if err != nil {
+			return nil, err
+		}
+		deletions = parsed.Deletions
+	} else if data, err = readArtifact(seed, seedmanifest.LegacyDeletionsFileName); err != nil {
+		return nil, err
+	} else if deletions, err = seedmanifest.ParseLegacyDeletions(data); err != nil {
+		return nil, err
+	}
+
+	entries := map[string]string{}
+	for _, deletion := range deletions {
+		entries[deletion.Path] = string(deletion.Type)
+	}
+	return entries, nil
+}
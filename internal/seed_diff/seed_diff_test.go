@@ -0,0 +1,107 @@
+package seed_diff
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	inspector "ibu-imager/internal/seed_inspect"
+	"ibu-imager/pkg/seedmanifest"
+)
+
+func TestSeedDiff(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Seed Diff Suite")
+}
+
+// etcArchive returns a gzipped tar of the given /etc files
+func etcArchive(files map[string]string) []byte {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		Expect(tarWriter.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))})).To(Succeed())
+		_, err := tarWriter.Write([]byte(content))
+		Expect(err).ToNot(HaveOccurred())
+	}
+	Expect(tarWriter.Close()).To(Succeed())
+	Expect(gzipWriter.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+// seed returns a seed with the given version and artifacts, the artifact digests being their content
+func seed(version string, artifacts map[string][]byte) *Seed {
+	info := &inspector.Info{
+		Image: "quay.io/org/seed:" + version,
+		Manifest: &seedmanifest.Manifest{Kind: seedmanifest.KindSeed, NodeRole: seedmanifest.NodeRoleMaster,
+			ClusterVersion: &seedmanifest.ClusterVersionSummary{Version: version}},
+	}
+	for name, content := range artifacts {
+		info.Artifacts = append(info.Artifacts, inspector.Artifact{Name: name, Digest: "sha256:" + string(content)})
+	}
+	return &Seed{Info: info, Read: func(artifact string) ([]byte, error) {
+		Expect(artifacts).To(HaveKey(artifact))
+		return artifacts[artifact], nil
+	}}
+}
+
+func section(result *Result, name string) []Change {
+	for _, section := range result.Sections {
+		if section.Name == name {
+			return section.Changes
+		}
+	}
+	Fail("no section " + name)
+	return nil
+}
+
+var _ = Describe("Seed diff", func() {
+	It("Reports what changed between two seeds", func() {
+		from := seed("4.14.1", map[string][]byte{
+			rpmOstreeFile: []byte(`{"deployments": [{"booted": true, "version": "414.92.1", "checksum": "aaa"}, {"version": "413.92.1"}]}`),
+			mcoCurrentConfigFile: []byte(`{"spec": {"kernelArguments": ["nosmt"], "config": {"storage": {"files": [
+				{"path": "/etc/chrony.conf", "contents": {"source": "data:,old"}}]}}}}`),
+			etcFile:                              etcArchive(map[string]string{"etc/hosts": "old", "etc/removed": ""}),
+			seedmanifest.LegacyDeletionsFileName: []byte("/etc/systemd/system/multi-user.target.wants/ptp4l.service\n"),
+		})
+		to := seed("4.14.2", map[string][]byte{
+			rpmOstreeFile: []byte(`{"deployments": [{"booted": true, "version": "414.92.2", "checksum": "aaa"}]}`),
+			mcoCurrentConfigFile: []byte(`{"spec": {"kernelArguments": ["nosmt", "isolcpus=2-3"], "config": {"storage": {"files": [
+				{"path": "/etc/chrony.conf", "contents": {"source": "data:,new"}}]}}}}`),
+			etcFile:                        etcArchive(map[string]string{"etc/hosts": "new", "etc/added": ""}),
+			seedmanifest.DeletionsFileName: []byte(`{"schemaVersion": 1, "deletions": []}`),
+		})
+
+		result, err := Diff(from, to)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Identical()).To(BeFalse())
+		Expect(section(result, "Manifest")).To(Equal([]Change{{Kind: Changed, Name: "clusterVersion", Old: "4.14.1", New: "4.14.2"}}))
+		Expect(section(result, "rpm-ostree")).To(Equal([]Change{{Kind: Changed, Name: "version", Old: "414.92.1", New: "414.92.2"}}))
+		Expect(section(result, "MCO currentconfig")).To(ConsistOf(
+			HaveField("Name", "file /etc/chrony.conf"),
+			Equal(Change{Kind: Added, Name: "kernelArgument isolcpus=2-3", New: "set"}),
+		))
+		Expect(section(result, "/etc")).To(ConsistOf(
+			HaveField("Kind", Added), HaveField("Kind", Changed), HaveField("Kind", Removed)))
+		Expect(section(result, "/etc")[0].Name).To(Equal("/etc/added"))
+		Expect(section(result, "/etc deletions")).To(Equal([]Change{{Kind: Removed,
+			Name: "/etc/systemd/system/multi-user.target.wants/ptp4l.service"}}))
+	})
+
+	It("Doesn't download the artifacts with the same digest", func() {
+		artifacts := map[string][]byte{rpmOstreeFile: []byte("same"), etcFile: []byte("same")}
+		from, to := seed("4.14.1", artifacts), seed("4.14.1", artifacts)
+		from.Read = func(string) ([]byte, error) {
+			Fail("artifact downloaded")
+			return nil, nil
+		}
+
+		result, err := Diff(from, to)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Identical()).To(BeTrue())
+	})
+})
@@ -0,0 +1,120 @@
+package seed_inspect
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	registry "ibu-imager/internal/registry_client"
+	seed "ibu-imager/internal/seed_creator"
+)
+
+// ArtifactSizes is an artifact of the seed image with its compressed and uncompressed sizes
+type ArtifactSizes struct {
+	Name string `json:"name"`
+	// Digest is the artifact content digest, empty for directories
+	Digest string `json:"digest,omitempty"`
+	// CompressedSize is the size of the layer holding the artifact, as stored in the registry
+	CompressedSize int64 `json:"compressedSize"`
+	// Size is the uncompressed size of the artifact, the total size of its files for directories
+	Size int64 `json:"size"`
+	// ContentSize is the total size of the files archived by a .tgz artifact, -1 when it wasn't read
+	ContentSize int64 `json:"contentSize"`
+}
+
+// ListArtifacts lists the artifacts of a remote seed image with their sizes. Only the start of the file
+// artifact layers is downloaded, unless contentSizes also reads the whole .tgz artifacts to sum the size
+// of the files they archive, e.g. to tell which /var directory made the seed grow.
+func ListArtifacts(client *registry.Client, ref registry.Reference, contentSizes bool) ([]ArtifactSizes, error) {
+	manifest, config, err := seedImage(client, ref)
+	if err != nil {
+		return nil, err
+	}
+	var artifacts []ArtifactSizes
+	for i, name := range artifactNames(config) {
+		artifact := ArtifactSizes{
+			Name:           name,
+			Digest:         config.Config.Labels[seed.ArtifactLabelPrefix+name],
+			CompressedSize: manifest.Layers[i].Size,
+			ContentSize:    -1,
+		}
+		readContent := contentSizes && isArchive(name)
+		if err = layerSizes(client, ref, manifest.Layers[i], &artifact, readContent); err != nil {
+			return nil, errors.Wrapf(err, "Failed to read the layer of %s", name)
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts, nil
+}
+
+// isArchive tells whether the artifact is a compressed tarball
+func isArchive(name string) bool {
+	return strings.HasSuffix(name, ".tgz") || strings.HasSuffix(name, ".tar.gz")
+}
+
+// layerSizes reads the uncompressed size of the artifact out of the tar headers of its layer, stopping
+// after the file artifact header unless its content size is read too
+func layerSizes(client *registry.Client, ref registry.Reference, layer registry.Descriptor, artifact *ArtifactSizes, readContent bool) error {
+	blob, err := client.GetBlob(ref, layer.Digest)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	var reader io.Reader = blob
+	if strings.HasSuffix(layer.MediaType, "gzip") {
+		gzipReader, err := gzip.NewReader(blob)
+		if err != nil {
+			return err
+		}
+		reader = gzipReader
+	}
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		artifact.Size += header.Size
+		// Directory artifacts have no digest, their files are summed up
+		if artifact.Digest == "" || strings.TrimPrefix(path.Clean("/"+header.Name), "/") != artifact.Name {
+			continue
+		}
+		if readContent {
+			artifact.ContentSize, err = archiveContentSize(tarReader)
+		}
+		return err
+	}
+}
+
+// archiveContentSize returns the total size of the files of a gzipped tarball
+func archiveContentSize(archive io.Reader) (int64, error) {
+	gzipReader, err := gzip.NewReader(archive)
+	if err != nil {
+		return 0, err
+	}
+	tarReader := tar.NewReader(gzipReader)
+	var size int64
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return size, err
+		}
+		if header.Typeflag == tar.TypeReg {
+			size += header.Size
+		}
+	}
+}
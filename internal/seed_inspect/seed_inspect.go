@@ -0,0 +1,125 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package seed_inspect
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	registry "ibu-imager/internal/registry_client"
+	seed "ibu-imager/internal/seed_creator"
+	verifier "ibu-imager/internal/seed_verify"
+	"ibu-imager/pkg/seedmanifest"
+)
+
+// Artifact is an artifact of the seed image and the size of its layer
+type Artifact struct {
+	Name string `json:"name"`
+	// Digest is the artifact content digest, empty for directories
+	Digest string `json:"digest,omitempty"`
+	// LayerSize is the compressed size of the layer holding the artifact
+	LayerSize int64 `json:"layerSize"`
+}
+
+// Info is the metadata of a seed image
+type Info struct {
+	Image        string    `json:"image"`
+	Architecture string    `json:"architecture"`
+	OS           string    `json:"os"`
+	Created      time.Time `json:"created"`
+	// Manifest is the seed manifest, carrying the OCP version of the seed
+	Manifest  *seedmanifest.Manifest `json:"manifest"`
+	Artifacts []Artifact             `json:"artifacts"`
+	// RecertSummary is the recert dry-run summary, empty when the seed has none
+	RecertSummary string `json:"recertSummary,omitempty"`
+}
+
+// Size returns the total compressed size of the seed image layers
+func (i *Info) Size() int64 {
+	var size int64
+	for _, artifact := range i.Artifacts {
+		size += artifact.LayerSize
+	}
+	return size
+}
+
+// Inspect reads the metadata of a remote seed image out of its config blob and the layers of its
+// manifest and recert summary, without pulling the image
+func Inspect(client *registry.Client, ref registry.Reference) (*Info, error) {
+	manifest, config, err := seedImage(client, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{
+		Image:        ref.String(),
+		Architecture: config.Architecture,
+		OS:           config.OS,
+		Created:      config.Created,
+	}
+	hasRecertSummary := false
+	for i, name := range artifactNames(config) {
+		info.Artifacts = append(info.Artifacts, Artifact{
+			Name:      name,
+			Digest:    config.Config.Labels[seed.ArtifactLabelPrefix+name],
+			LayerSize: manifest.Layers[i].Size,
+		})
+		hasRecertSummary = hasRecertSummary || name == seed.RecertSummaryFile
+	}
+
+	data, err := verifier.ReadArtifact(client, ref, seedmanifest.FileName)
+	if err != nil {
+		return nil, err
+	}
+	if info.Manifest, err = seedmanifest.Parse(data); err != nil {
+		return nil, err
+	}
+	if hasRecertSummary {
+		summary, err := verifier.ReadArtifact(client, ref, seed.RecertSummaryFile)
+		if err != nil {
+			return nil, err
+		}
+		info.RecertSummary = strings.TrimSpace(string(summary))
+	}
+	return info, nil
+}
+
+// seedImage returns the manifest and config of a remote seed image, checking it has a layer per artifact
+func seedImage(client *registry.Client, ref registry.Reference) (*registry.Manifest, *registry.ImageConfig, error) {
+	manifest, err := client.GetManifest(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	config, err := client.GetImageConfig(ref, manifest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if config.Config.Labels[seed.ArtifactsLabel] == "" {
+		return nil, nil, errors.Errorf("Image has no %s label, it isn't a seed image or was built by an ibu-imager version not labeling artifacts", seed.ArtifactsLabel)
+	}
+	if names := artifactNames(config); len(names) != len(manifest.Layers) {
+		return nil, nil, errors.Errorf("%s has %d layers for %d artifacts", ref, len(manifest.Layers), len(names))
+	}
+	return manifest, config, nil
+}
+
+// artifactNames returns the artifacts of the seed image, in layer order
+func artifactNames(config *registry.ImageConfig) []string {
+	return strings.Split(config.Config.Labels[seed.ArtifactsLabel], ",")
+}
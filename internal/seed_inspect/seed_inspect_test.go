@@ -0,0 +1,150 @@
+package seed_inspect
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	registry "ibu-imager/internal/registry_client"
+)
+
+func TestSeedInspect(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Seed Inspect Suite")
+}
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// layer returns a gzipped tar layer holding a single artifact
+func layer(name, content string) []byte {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	Expect(tarWriter.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(content))})).To(Succeed())
+	_, err := tarWriter.Write([]byte(content))
+	Expect(err).ToNot(HaveOccurred())
+	Expect(tarWriter.Close()).To(Succeed())
+	Expect(gzipWriter.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+// serveSeed serves the seed image manifest and blobs from a test registry, returning a client for it
+func serveSeed(manifest string, blobs map[string][]byte) (*registry.Client, registry.Reference, func()) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/org/seed/manifests/v1" {
+			_, _ = w.Write([]byte(manifest))
+			return
+		}
+		blob, ok := blobs[strings.TrimPrefix(r.URL.Path, "/v2/org/seed/blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(blob)
+	}))
+
+	client, err := registry.NewClient("")
+	Expect(err).ToNot(HaveOccurred())
+	client.SetHTTPClient(server.Client())
+	ref, err := registry.ParseReference(strings.TrimPrefix(server.URL, "https://") + "/org/seed:v1")
+	Expect(err).ToNot(HaveOccurred())
+	return client, ref, server.Close
+}
+
+// archive returns a gzipped tarball of the files
+func archive(files map[string]string) []byte {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		Expect(tarWriter.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(content))})).To(Succeed())
+		_, err := tarWriter.Write([]byte(content))
+		Expect(err).ToNot(HaveOccurred())
+	}
+	Expect(tarWriter.Close()).To(Succeed())
+	Expect(gzipWriter.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+var _ = Describe("Seed inspection", func() {
+	It("Reads the seed metadata out of the registry", func() {
+		artifacts := map[string]string{
+			"recert.summary": "certs: 42\n",
+			"manifest.json":  `{"kind": "SeedImage", "nodeRole": "master", "clusterVersion": {"version": "4.14.1"}}`,
+		}
+		names := []string{"recert.summary", "manifest.json"}
+		blobs := map[string][]byte{}
+		labels := []string{`"io.openshift.ibu.artifacts": "recert.summary,manifest.json"`}
+		var layers []string
+		for _, name := range names {
+			blob := layer(name, artifacts[name])
+			blobs[digest(blob)] = blob
+			labels = append(labels, fmt.Sprintf(`"io.openshift.ibu.artifact.%s": %q`, name, digest([]byte(artifacts[name]))))
+			layers = append(layers, fmt.Sprintf(`{"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip", "digest": %q, "size": %d}`,
+				digest(blob), len(blob)))
+		}
+		config := []byte(`{"architecture": "amd64", "os": "linux", "created": "2023-10-01T00:00:00Z", "config": {"Labels": {` +
+			strings.Join(labels, ",") + `}}}`)
+		blobs[digest(config)] = config
+		manifest := fmt.Sprintf(`{"config": {"digest": %q}, "layers": [%s]}`, digest(config), strings.Join(layers, ","))
+
+		client, ref, closeServer := serveSeed(manifest, blobs)
+		defer closeServer()
+
+		info, err := Inspect(client, ref)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Architecture).To(Equal("amd64"))
+		Expect(info.Created.Year()).To(Equal(2023))
+		Expect(info.Manifest.ClusterVersion.Version).To(Equal("4.14.1"))
+		Expect(info.Artifacts).To(HaveLen(2))
+		Expect(info.Artifacts[0].Digest).To(Equal(digest([]byte("certs: 42\n"))))
+		Expect(info.Size()).To(Equal(info.Artifacts[0].LayerSize + info.Artifacts[1].LayerSize))
+		Expect(info.RecertSummary).To(Equal("certs: 42"))
+	})
+
+	It("Lists the artifacts with their sizes", func() {
+		varArchive := archive(map[string]string{"var/lib/a": "aaaa", "var/lib/b": "bbbbbbbb"})
+		etcLayer := layer("manifest.json", "{}")
+		varLayer := layer("var.tgz", string(varArchive))
+		dirLayer := archive(map[string]string{"backup/a": "12", "backup/b": "345"})
+		blobs := map[string][]byte{digest(etcLayer): etcLayer, digest(varLayer): varLayer, digest(dirLayer): dirLayer}
+		config := []byte(fmt.Sprintf(`{"config": {"Labels": {"io.openshift.ibu.artifacts": "manifest.json,var.tgz,backup",
+			"io.openshift.ibu.artifact.manifest.json": %q, "io.openshift.ibu.artifact.var.tgz": %q}}}`,
+			digest([]byte("{}")), digest(varArchive)))
+		blobs[digest(config)] = config
+		var layers []string
+		for _, blob := range [][]byte{etcLayer, varLayer, dirLayer} {
+			layers = append(layers, fmt.Sprintf(`{"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip", "digest": %q, "size": %d}`,
+				digest(blob), len(blob)))
+		}
+		manifest := fmt.Sprintf(`{"config": {"digest": %q}, "layers": [%s]}`, digest(config), strings.Join(layers, ","))
+		client, ref, closeServer := serveSeed(manifest, blobs)
+		defer closeServer()
+
+		artifacts, err := ListArtifacts(client, ref, false)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(artifacts).To(HaveLen(3))
+		Expect(artifacts[1]).To(Equal(ArtifactSizes{Name: "var.tgz", Digest: digest(varArchive),
+			CompressedSize: int64(len(varLayer)), Size: int64(len(varArchive)), ContentSize: -1}))
+		Expect(artifacts[2].Size).To(Equal(int64(5)))
+
+		artifacts, err = ListArtifacts(client, ref, true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(artifacts[0].ContentSize).To(Equal(int64(-1)))
+		Expect(artifacts[1].ContentSize).To(Equal(int64(12)))
+		Expect(artifacts[2].ContentSize).To(Equal(int64(-1)))
+	})
+})
@@ -0,0 +1,331 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package seed_lint
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ActionFail fails the seed creation when the rule matches
+	ActionFail = "fail"
+	// ActionRedact removes the matching files from the seed artifacts
+	ActionRedact = "redact"
+
+	// maxContentScanSize is the largest file whose content is matched against content rules
+	maxContentScanSize = 64 * 1024
+)
+
+// Rule describes files that should never be part of a seed
+type Rule struct {
+	Name string `yaml:"name"`
+	// PathPatterns are patterns matched against the absolute path of the files, where * also
+	// matches path separators
+	PathPatterns []string `yaml:"pathPatterns,omitempty"`
+	// ContentPattern is a regular expression matched against the content of small files
+	ContentPattern string `yaml:"contentPattern,omitempty"`
+	// AllowedPaths are patterns of paths exempted from the rule
+	AllowedPaths []string `yaml:"allowedPaths,omitempty"`
+	// Action is either fail or redact
+	Action string `yaml:"action"`
+
+	contentRegexp *regexp.Regexp
+}
+
+// RuleSet is the configurable set of lint rules
+type RuleSet struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// DefaultRuleSet returns the built-in lint rules
+func DefaultRuleSet() *RuleSet {
+	return &RuleSet{Rules: []Rule{
+		{
+			Name:           "private-ssh-key",
+			ContentPattern: `-----BEGIN (OPENSSH|RSA|EC|DSA) PRIVATE KEY-----`,
+			// Host keys and the cluster's own PKI are expected on the node
+			AllowedPaths: []string{"/etc/ssh/ssh_host_*", "/etc/kubernetes/*", "/var/lib/kubelet/pki/*",
+				"/etc/pki/*", "/var/lib/etcd/*", "/var/lib/ovn-ic/*"},
+			Action: ActionFail,
+		},
+		{
+			Name:         "kubeadmin-password",
+			PathPatterns: []string{"*kubeadmin-password*"},
+			Action:       ActionRedact,
+		},
+		{
+			Name:         "cloud-credentials",
+			PathPatterns: []string{"*/.aws/credentials", "*/.azure/*", "*/.config/gcloud/*"},
+			Action:       ActionFail,
+		},
+	}}
+}
+
+// LoadRuleSet reads a YAML rule set file
+func LoadRuleSet(file string) (*RuleSet, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read lint rules %s", file)
+	}
+	var rules RuleSet
+	if err = yaml.Unmarshal(data, &rules); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse lint rules %s", file)
+	}
+	return &rules, nil
+}
+
+// Compile validates the rules and compiles their content patterns
+func (r *RuleSet) Compile() error {
+	for i := range r.Rules {
+		rule := &r.Rules[i]
+		if rule.Action != ActionFail && rule.Action != ActionRedact {
+			return errors.Errorf("lint rule %q has invalid action %q, must be %s or %s", rule.Name, rule.Action,
+				ActionFail, ActionRedact)
+		}
+		if len(rule.PathPatterns) == 0 && rule.ContentPattern == "" {
+			return errors.Errorf("lint rule %q has neither path nor content patterns", rule.Name)
+		}
+		if rule.ContentPattern != "" {
+			re, err := regexp.Compile(rule.ContentPattern)
+			if err != nil {
+				return errors.Wrapf(err, "lint rule %q has invalid content pattern", rule.Name)
+			}
+			rule.contentRegexp = re
+		}
+	}
+	return nil
+}
+
+// Finding is a file of an artifact matching a lint rule
+type Finding struct {
+	Artifact string
+	Path     string
+	Rule     string
+	Action   string
+}
+
+// Lint scans the tgz artifacts of the backup dir, and the plain files, against the rules
+func (r *RuleSet) Lint(backupDir string) ([]Finding, error) {
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list backup dir")
+	}
+
+	var findings []Finding
+	for _, entry := range entries {
+		artifact := filepath.Join(backupDir, entry.Name())
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if strings.HasSuffix(entry.Name(), ".tgz") {
+			archiveFindings, err := r.lintArchive(artifact)
+			if err != nil {
+				return nil, err
+			}
+			findings = append(findings, archiveFindings...)
+			continue
+		}
+		content, err := readHead(artifact)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range r.match("/"+entry.Name(), content) {
+			findings = append(findings, Finding{Artifact: entry.Name(), Path: entry.Name(), Rule: rule.Name, Action: rule.Action})
+		}
+	}
+	return findings, nil
+}
+
+func (r *RuleSet) lintArchive(archive string) ([]Finding, error) {
+	var findings []Finding
+	err := walkArchive(archive, func(header *tar.Header, reader io.Reader) error {
+		if header.Typeflag != tar.TypeReg {
+			return nil
+		}
+		var content []byte
+		if header.Size <= maxContentScanSize {
+			var err error
+			if content, err = io.ReadAll(reader); err != nil {
+				return err
+			}
+		}
+		for _, rule := range r.match(archivePath(header.Name), content) {
+			findings = append(findings, Finding{Artifact: filepath.Base(archive), Path: archivePath(header.Name),
+				Rule: rule.Name, Action: rule.Action})
+		}
+		return nil
+	})
+	return findings, err
+}
+
+// match returns the rules matching the file
+func (r *RuleSet) match(filePath string, content []byte) []Rule {
+	var matched []Rule
+	for _, rule := range r.Rules {
+		if matchesAny(filePath, rule.AllowedPaths) {
+			continue
+		}
+		if matchesAny(filePath, rule.PathPatterns) ||
+			(rule.contentRegexp != nil && content != nil && rule.contentRegexp.Match(content)) {
+			matched = append(matched, rule)
+		}
+	}
+	return matched
+}
+
+// Redact rewrites the archives of the findings without the redacted files, keeping the
+// PAX records (and thus the SELinux labels) of the remaining files
+func Redact(backupDir string, findings []Finding) error {
+	redacted := map[string]map[string]bool{}
+	for _, finding := range findings {
+		if finding.Action != ActionRedact {
+			continue
+		}
+		if redacted[finding.Artifact] == nil {
+			redacted[finding.Artifact] = map[string]bool{}
+		}
+		redacted[finding.Artifact][finding.Path] = true
+	}
+
+	for artifact, paths := range redacted {
+		archive := filepath.Join(backupDir, artifact)
+		if !strings.HasSuffix(artifact, ".tgz") {
+			if err := os.Remove(archive); err != nil {
+				return errors.Wrapf(err, "Failed to redact %s", artifact)
+			}
+			continue
+		}
+		if err := rewriteArchive(archive, paths); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rewriteArchive(archive string, skip map[string]bool) error {
+	tmp, err := os.CreateTemp(filepath.Dir(archive), filepath.Base(archive)+".redact-")
+	if err != nil {
+		return errors.Wrap(err, "Failed to create redacted archive")
+	}
+	defer os.Remove(tmp.Name())
+
+	gzipWriter := gzip.NewWriter(tmp)
+	tarWriter := tar.NewWriter(gzipWriter)
+	err = walkArchive(archive, func(header *tar.Header, reader io.Reader) error {
+		if skip[archivePath(header.Name)] {
+			return nil
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := io.Copy(tarWriter, reader)
+		return err
+	})
+	if err == nil {
+		err = tarWriter.Close()
+	}
+	if err == nil {
+		err = gzipWriter.Close()
+	}
+	if err == nil {
+		err = tmp.Close()
+	}
+	if err != nil {
+		_ = tmp.Close()
+		return errors.Wrapf(err, "Failed to redact %s", archive)
+	}
+	return errors.Wrapf(os.Rename(tmp.Name(), archive), "Failed to replace %s", archive)
+}
+
+// walkArchive calls fn for every entry of a tgz archive
+func walkArchive(archive string, fn func(header *tar.Header, reader io.Reader) error) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gzipReader, err := gzip.NewReader(f)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read %s", archive)
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Failed to read %s", archive)
+		}
+		if err = fn(header, tarReader); err != nil {
+			return err
+		}
+	}
+}
+
+func readHead(file string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	_, err = io.CopyN(&buf, f, maxContentScanSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// archivePath returns the absolute path of an archive entry, e.g. var/lib/foo for /var/lib/foo
+func archivePath(name string) string {
+	return path.Clean("/" + name)
+}
+
+// matchesAny matches the path against the patterns, where * matches any sequence of characters,
+// including path separators, and ? matches a single character
+func matchesAny(filePath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		var expr strings.Builder
+		expr.WriteString("^")
+		for i, part := range strings.Split(pattern, "*") {
+			if i > 0 {
+				expr.WriteString(".*")
+			}
+			expr.WriteString(strings.ReplaceAll(regexp.QuoteMeta(part), "\\?", "."))
+		}
+		expr.WriteString("$")
+		if matched, _ := regexp.MatchString(expr.String(), filePath); matched {
+			return true
+		}
+	}
+	return false
+}
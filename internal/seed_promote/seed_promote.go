@@ -0,0 +1,218 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package seed_promote
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	registry "ibu-imager/internal/registry_client"
+	verifier "ibu-imager/internal/seed_verify"
+)
+
+const (
+	// EnvironmentAnnotation is the environment, e.g. stable, the seed image was promoted to
+	EnvironmentAnnotation = "io.openshift.ibu.promotion.environment"
+	// PromotedByAnnotation is who promoted the seed image
+	PromotedByAnnotation = "io.openshift.ibu.promotion.promoted-by"
+	// PromotedAtAnnotation is when the seed image was promoted, as an RFC 3339 timestamp
+	PromotedAtAnnotation = "io.openshift.ibu.promotion.promoted-at"
+	// PromotedFromAnnotation is the candidate seed image the promoted one was copied from, pinned to its digest
+	PromotedFromAnnotation = "io.openshift.ibu.promotion.promoted-from"
+	// VerifyReportAnnotation is the digest of the verify report the promotion passed
+	VerifyReportAnnotation = "io.openshift.ibu.promotion.verify-report"
+
+	// ociManifestMediaType is the only manifest media type carrying annotations
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+)
+
+// Config selects the candidate seed image and where it's promoted to
+type Config struct {
+	// Source is the candidate seed image, e.g. quay.io/org/seed:candidate
+	Source registry.Reference
+	// Destination is the tagged seed image of the environment, e.g. quay.io/org/seed:stable
+	Destination registry.Reference
+	// Environment names the environment the seed is promoted to, the destination tag when empty
+	Environment string
+	// PromotedBy is who promotes the seed, recorded in the promotion annotations
+	PromotedBy string
+	// Content downloads the candidate layers to hash its artifacts, instead of only checking the layers exist
+	Content bool
+}
+
+// Validate checks the promotion config
+func (c *Config) Validate() error {
+	if c.Destination.Tag == "" {
+		return errors.Errorf("The destination seed image %s must be tagged", c.Destination)
+	}
+	if c.Source.Name() == c.Destination.Name() && c.Source.Tag == c.Destination.Tag && c.Source.Digest == "" {
+		return errors.Errorf("The seed image %s can't be promoted to itself", c.Source)
+	}
+	if c.PromotedBy == "" {
+		return errors.New("Who promotes the seed image is required")
+	}
+	return nil
+}
+
+// VerifiedArtifact is an artifact of the verify report the promotion passed
+type VerifiedArtifact struct {
+	Artifact        string `json:"artifact"`
+	Digest          string `json:"digest,omitempty"`
+	ContentVerified bool   `json:"contentVerified"`
+}
+
+// VerifyReport is the verification of the candidate seed image, whose digest the promotion records
+type VerifyReport struct {
+	Image     string             `json:"image"`
+	Artifacts []VerifiedArtifact `json:"artifacts"`
+}
+
+// Promotion is the outcome of a promotion
+type Promotion struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	// Digest is the digest of the promoted manifest, which differs from the candidate one by its annotations
+	Digest             string       `json:"digest"`
+	Environment        string       `json:"environment"`
+	PromotedBy         string       `json:"promotedBy"`
+	PromotedAt         time.Time    `json:"promotedAt"`
+	VerifyReportDigest string       `json:"verifyReportDigest"`
+	VerifyReport       VerifyReport `json:"verifyReport"`
+}
+
+// Promote verifies the candidate seed image in the registry and copies it to the destination tag, with the
+// promotion annotations added to its manifest. The candidate is pinned to its digest first, so a candidate
+// tag moving during the promotion never promotes an unverified seed.
+func Promote(log *logrus.Logger, src, dst *registry.Client, config Config) (*Promotion, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	data, mediaType, err := src.GetRawManifest(config.Source)
+	if err != nil {
+		return nil, err
+	}
+	candidate := config.Source
+	candidate.Digest = fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	if config.Source.Digest != "" && config.Source.Digest != candidate.Digest {
+		return nil, errors.Errorf("Manifest of %s doesn't match its digest, got %s", config.Source, candidate.Digest)
+	}
+
+	log.Printf("Verifying candidate seed image %s", candidate)
+	report, err := verify(src, candidate, config.Content)
+	if err != nil {
+		return nil, err
+	}
+	reportData, err := json.Marshal(report)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal verify report")
+	}
+
+	promotion := &Promotion{
+		Source:             candidate.String(),
+		Destination:        config.Destination.String(),
+		Environment:        config.Environment,
+		PromotedBy:         config.PromotedBy,
+		PromotedAt:         time.Now().UTC().Truncate(time.Second),
+		VerifyReportDigest: fmt.Sprintf("sha256:%x", sha256.Sum256(reportData)),
+		VerifyReport:       *report,
+	}
+	if promotion.Environment == "" {
+		promotion.Environment = config.Destination.Tag
+	}
+	annotated, err := annotate(data, mediaType, promotion)
+	if err != nil {
+		return nil, err
+	}
+
+	// The blobs are copied under the candidate digest, only the annotated manifest is tagged
+	untagged := config.Destination
+	untagged.Tag, untagged.Digest = "", candidate.Digest
+	log.Printf("Copying seed image %s to %s", candidate, config.Destination.Name())
+	if _, err = registry.CopyImage(src, candidate, dst, untagged); err != nil {
+		return nil, err
+	}
+	destination := config.Destination
+	destination.Digest = ""
+	if err = dst.PutManifest(destination, ociManifestMediaType, annotated); err != nil {
+		return nil, err
+	}
+	promotion.Digest = fmt.Sprintf("sha256:%x", sha256.Sum256(annotated))
+	log.Printf("Seed image %s promoted to %s as %s@%s", candidate, promotion.Environment, destination, promotion.Digest)
+	return promotion, nil
+}
+
+// verify verifies the candidate seed image, failing unless every artifact passes
+func verify(client *registry.Client, candidate registry.Reference, content bool) (*VerifyReport, error) {
+	checks, err := verifier.VerifyRemote(client, candidate, content)
+	if err != nil {
+		return nil, err
+	}
+	report := &VerifyReport{Image: candidate.String()}
+	var failed []string
+	for _, check := range checks {
+		if check.Error != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", check.Artifact, check.Error))
+			continue
+		}
+		report.Artifacts = append(report.Artifacts, VerifiedArtifact{Artifact: check.Artifact, Digest: check.Digest,
+			ContentVerified: check.ContentVerified})
+	}
+	if len(failed) > 0 {
+		return nil, errors.Errorf("Candidate seed image %s failed verification, not promoting it: %s", candidate,
+			strings.Join(failed, "; "))
+	}
+	return report, nil
+}
+
+// annotate returns the manifest with the promotion annotations, keeping every other field as is
+func annotate(data []byte, mediaType string, promotion *Promotion) ([]byte, error) {
+	var manifest map[string]json.RawMessage
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse seed image manifest")
+	}
+	if embedded, ok := manifest["mediaType"]; ok {
+		_ = json.Unmarshal(embedded, &mediaType)
+	}
+	if mediaType != ociManifestMediaType {
+		return nil, errors.Errorf("The seed image manifest is %s, only OCI manifests (%s) carry the promotion annotations",
+			mediaType, ociManifestMediaType)
+	}
+
+	annotations := map[string]string{}
+	if existing, ok := manifest["annotations"]; ok {
+		if err := json.Unmarshal(existing, &annotations); err != nil {
+			return nil, errors.Wrap(err, "Failed to parse seed image manifest annotations")
+		}
+	}
+	annotations[EnvironmentAnnotation] = promotion.Environment
+	annotations[PromotedByAnnotation] = promotion.PromotedBy
+	annotations[PromotedAtAnnotation] = promotion.PromotedAt.Format(time.RFC3339)
+	annotations[PromotedFromAnnotation] = promotion.Source
+	annotations[VerifyReportAnnotation] = promotion.VerifyReportDigest
+	encoded, err := json.Marshal(annotations)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal promotion annotations")
+	}
+	manifest["annotations"] = encoded
+	return json.Marshal(manifest)
+}
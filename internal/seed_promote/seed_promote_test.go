@@ -0,0 +1,137 @@
+package seed_promote
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	registry "ibu-imager/internal/registry_client"
+)
+
+func TestSeedPromote(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Seed Promote Suite")
+}
+
+func digest(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+// fakeRegistry serves the manifests, by tag or digest, and the blobs of a single repository
+type fakeRegistry struct {
+	manifests map[string]string
+	blobs     map[string]string
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v2/org/seed/")
+	switch {
+	case strings.HasPrefix(path, "manifests/") && r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.manifests[strings.TrimPrefix(path, "manifests/")] = string(data)
+		f.manifests[digest(data)] = string(data)
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(path, "manifests/"):
+		manifest, ok := f.manifests[strings.TrimPrefix(path, "manifests/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		_, _ = io.WriteString(w, manifest)
+	case strings.HasPrefix(path, "blobs/"):
+		blob, ok := f.blobs[strings.TrimPrefix(path, "blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(blob)))
+		_, _ = io.WriteString(w, blob)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+var _ = Describe("Seed promotion", func() {
+	var (
+		fake   *fakeRegistry
+		server *httptest.Server
+		client *registry.Client
+		config Config
+	)
+
+	BeforeEach(func() {
+		seedConfig := `{"config": {"Labels": {"io.openshift.ibu.artifacts": "etc.tgz"}}}`
+		fake = &fakeRegistry{manifests: map[string]string{}, blobs: map[string]string{
+			digest([]byte(seedConfig)): seedConfig,
+			"sha256:l":                 "blob",
+		}}
+		fake.manifests["candidate"] = fmt.Sprintf(`{"schemaVersion": 2, "mediaType": "application/vnd.oci.image.manifest.v1+json", `+
+			`"config": {"digest": %q, "size": %d}, "layers": [{"digest": "sha256:l", "size": 4}]}`, digest([]byte(seedConfig)), len(seedConfig))
+		fake.manifests[digest([]byte(fake.manifests["candidate"]))] = fake.manifests["candidate"]
+
+		server = httptest.NewTLSServer(fake)
+		var err error
+		client, err = registry.NewClient("")
+		Expect(err).ToNot(HaveOccurred())
+		client.SetHTTPClient(server.Client())
+		repository := strings.TrimPrefix(server.URL, "https://") + "/org/seed"
+		config = Config{PromotedBy: "jdoe"}
+		config.Source, err = registry.ParseReference(repository + ":candidate")
+		Expect(err).ToNot(HaveOccurred())
+		config.Destination, err = registry.ParseReference(repository + ":stable")
+		Expect(err).ToNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("Tags the verified candidate with the promotion annotations", func() {
+		promotion, err := Promote(logrus.New(), client, client, config)
+		Expect(err).ToNot(HaveOccurred())
+		candidate := digest([]byte(fake.manifests["candidate"]))
+		Expect(promotion.Source).To(HaveSuffix(":candidate@" + candidate))
+		Expect(promotion.Environment).To(Equal("stable"))
+		Expect(promotion.VerifyReport.Artifacts).To(Equal([]VerifiedArtifact{{Artifact: "etc.tgz"}}))
+
+		stable := fake.manifests["stable"]
+		Expect(digest([]byte(stable))).To(Equal(promotion.Digest))
+		var manifest struct {
+			Layers      []registry.Descriptor `json:"layers"`
+			Annotations map[string]string     `json:"annotations"`
+		}
+		Expect(json.Unmarshal([]byte(stable), &manifest)).To(Succeed())
+		Expect(manifest.Layers).To(HaveLen(1))
+		Expect(manifest.Annotations).To(HaveKeyWithValue(PromotedByAnnotation, "jdoe"))
+		Expect(manifest.Annotations).To(HaveKeyWithValue(EnvironmentAnnotation, "stable"))
+		Expect(manifest.Annotations).To(HaveKeyWithValue(PromotedFromAnnotation, promotion.Source))
+		Expect(manifest.Annotations).To(HaveKeyWithValue(VerifyReportAnnotation, promotion.VerifyReportDigest))
+		Expect(manifest.Annotations).To(HaveKey(PromotedAtAnnotation))
+	})
+
+	It("Doesn't promote a candidate failing verification", func() {
+		fake.blobs["sha256:l"] = "truncated"
+		_, err := Promote(logrus.New(), client, client, config)
+		Expect(err).To(MatchError(ContainSubstring("failed verification")))
+		Expect(fake.manifests).ToNot(HaveKey("stable"))
+	})
+
+	It("Refuses untagged destinations and docker manifests", func() {
+		untagged := config
+		untagged.Destination.Tag = ""
+		_, err := Promote(logrus.New(), client, client, untagged)
+		Expect(err).To(MatchError(ContainSubstring("must be tagged")))
+
+		_, err = annotate([]byte(`{"schemaVersion": 2}`), "application/vnd.docker.distribution.manifest.v2+json", &Promotion{})
+		Expect(err).To(MatchError(ContainSubstring("only OCI manifests")))
+	})
+})
@@ -0,0 +1,206 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package seed_prune
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	registry "ibu-imager/internal/registry_client"
+	seed "ibu-imager/internal/seed_creator"
+)
+
+const (
+	// imageStoreTagSuffix suffixes the tag of the image store image pushed along a seed image
+	imageStoreTagSuffix = "-image-store"
+	// createdAnnotation is the OCI annotation ORAS sets to the artifact creation time
+	createdAnnotation = "org.opencontainers.image.created"
+)
+
+// Tag is a tag of the repository considered for pruning
+type Tag struct {
+	Tag     string    `json:"tag"`
+	Digest  string    `json:"digest"`
+	Created time.Time `json:"created,omitempty"`
+	// CompanionOf is the seed tag an image store or signature tag belongs to, empty for seed tags
+	CompanionOf string `json:"companionOf,omitempty"`
+	// Kept is set for the tags of the newest seeds, and for the tags sharing their digests
+	Kept bool `json:"kept"`
+}
+
+// Prune deletes the tags of all but the newest keep seeds of the repository, along with their image store
+// and cosign signature tags. Seed tags are the ones whose image labels, or artifact annotations, tell
+// the imager created them, so other images of the repository are left alone. Deleting a manifest
+// removes every tag pointing to it, so digests referenced by a kept tag are never deleted. With
+// dryRun set, nothing is deleted.
+func Prune(log *logrus.Logger, client *registry.Client, repository registry.Reference, keep int, dryRun bool) ([]Tag, error) {
+	if keep < 1 {
+		return nil, errors.Errorf("At least one seed tag must be kept, got %d", keep)
+	}
+	repository.Tag, repository.Digest = "", ""
+
+	names, err := client.ListTags(repository)
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]bool{}
+	for _, name := range names {
+		existing[name] = true
+	}
+
+	seeds, err := seedTags(client, repository, names)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(seeds, func(i, j int) bool {
+		if !seeds[i].Created.Equal(seeds[j].Created) {
+			return seeds[i].Created.After(seeds[j].Created)
+		}
+		return seeds[i].Tag > seeds[j].Tag
+	})
+
+	// Tags of the same seed count once, so aliases like latest don't push out an older seed
+	var (
+		tags      []Tag
+		keptSeeds = map[string]bool{}
+	)
+	for _, tag := range seeds {
+		if len(keptSeeds) < keep {
+			keptSeeds[tag.Digest] = true
+		}
+		tag.Kept = keptSeeds[tag.Digest]
+		tags = append(tags, tag)
+		companions, err := companionTags(client, repository, tag, existing)
+		if err != nil {
+			return nil, err
+		}
+		for _, companion := range companions {
+			// Aliases of a seed share its signature tag
+			delete(existing, companion.Tag)
+		}
+		tags = append(tags, companions...)
+	}
+
+	kept := map[string]bool{}
+	for _, tag := range tags {
+		if tag.Kept {
+			kept[tag.Digest] = true
+		}
+	}
+	deleted := map[string]bool{}
+	for i := range tags {
+		tag := &tags[i]
+		if tag.Kept = kept[tag.Digest]; tag.Kept || deleted[tag.Digest] {
+			continue
+		}
+		deleted[tag.Digest] = true
+		if dryRun {
+			log.Infof("Would delete %s:%s (%s)", repository.Name(), tag.Tag, tag.Digest)
+			continue
+		}
+		ref := repository
+		ref.Digest = tag.Digest
+		if err = client.DeleteManifest(ref); err != nil {
+			return nil, err
+		}
+		log.Infof("Deleted %s:%s (%s)", repository.Name(), tag.Tag, tag.Digest)
+	}
+	return tags, nil
+}
+
+// seedTags returns the tags of the repository pointing to seeds, skipping the companion tags
+func seedTags(client *registry.Client, repository registry.Reference, names []string) ([]Tag, error) {
+	var tags []Tag
+	for _, name := range names {
+		if strings.HasSuffix(name, imageStoreTagSuffix) || strings.HasSuffix(name, ".sig") {
+			continue
+		}
+		ref := repository
+		ref.Tag = name
+		data, _, err := client.GetRawManifest(ref)
+		if registry.IsNotFound(err) {
+			// Deleted since the tags were listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var manifest registry.Manifest
+		if err = json.Unmarshal(data, &manifest); err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse manifest of %s", ref)
+		}
+		if manifest.Config.Digest == "" {
+			// Manifest lists aren't seeds, the imager pushes single platform images only
+			continue
+		}
+
+		tag := Tag{Tag: name, Digest: digest(data)}
+		labels := manifest.Annotations
+		if labels[seed.CreatedByLabel] == seed.CreatedBy {
+			// Seeds pushed as ORAS artifacts carry their labels as manifest annotations
+			if created, ok := labels[createdAnnotation]; ok {
+				if tag.Created, err = time.Parse(time.RFC3339, created); err != nil {
+					return nil, errors.Wrapf(err, "Invalid creation time of %s", ref)
+				}
+			}
+		} else {
+			config, err := client.GetImageConfig(ref, &manifest)
+			if err != nil {
+				return nil, err
+			}
+			labels, tag.Created = config.Config.Labels, config.Created
+		}
+		if labels[seed.CreatedByLabel] == seed.CreatedBy && labels[seed.ArtifactsLabel] != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// companionTags returns the image store and cosign signature tags of the seed tag found in the repository
+func companionTags(client *registry.Client, repository registry.Reference, tag Tag, existing map[string]bool) ([]Tag, error) {
+	var companions []Tag
+	for _, name := range []string{tag.Tag + imageStoreTagSuffix, strings.Replace(tag.Digest, ":", "-", 1) + ".sig"} {
+		if !existing[name] {
+			continue
+		}
+		ref := repository
+		ref.Tag = name
+		digest, err := client.ResolveDigest(ref)
+		if registry.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		companions = append(companions, Tag{Tag: name, Digest: digest, CompanionOf: tag.Tag, Kept: tag.Kept})
+	}
+	return companions, nil
+}
+
+// digest returns the sha256 digest of the manifest as served by the registry
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,141 @@
+package seed_prune
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	registry "ibu-imager/internal/registry_client"
+)
+
+func TestSeedPrune(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Seed Prune Suite")
+}
+
+// fakeRegistry serves the tags, manifests and config blobs of a single repository, deleting manifests by digest
+type fakeRegistry struct {
+	tags    map[string]string
+	blobs   map[string]string
+	deleted []string
+}
+
+func (f *fakeRegistry) image(tag, created string, labels string) {
+	config := fmt.Sprintf(`{"created": %q, "config": {"Labels": {%s}}}`, created, labels)
+	f.blobs[digest([]byte(config))] = config
+	f.tags[tag] = fmt.Sprintf(`{"config": {"digest": %q}, "layers": [{"digest": "sha256:l"}]}`, digest([]byte(config)))
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v2/org/seed/")
+	switch {
+	case path == "tags/list":
+		var tags []string
+		for tag := range f.tags {
+			tags = append(tags, fmt.Sprintf("%q", tag))
+		}
+		_, _ = w.Write([]byte(`{"tags": [` + strings.Join(tags, ",") + `]}`))
+	case strings.HasPrefix(path, "manifests/"):
+		reference := strings.TrimPrefix(path, "manifests/")
+		if r.Method == http.MethodDelete {
+			f.deleted = append(f.deleted, reference)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		manifest, ok := f.tags[reference]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest([]byte(manifest)))
+		_, _ = io.WriteString(w, manifest)
+	case strings.HasPrefix(path, "blobs/"):
+		blob, ok := f.blobs[strings.TrimPrefix(path, "blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = io.WriteString(w, blob)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+var _ = Describe("Seed tag pruning", func() {
+	const seedLabels = `"io.openshift.ibu.created-by": "ibu-imager", "io.openshift.ibu.artifacts": "etc.tgz,manifest.json"`
+	var (
+		fake       *fakeRegistry
+		server     *httptest.Server
+		client     *registry.Client
+		repository registry.Reference
+	)
+
+	BeforeEach(func() {
+		fake = &fakeRegistry{tags: map[string]string{}, blobs: map[string]string{}}
+		fake.image("v1", "2023-01-01T00:00:00Z", seedLabels)
+		fake.image("v1-image-store", "2023-01-01T00:00:00Z", `"io.openshift.ibu.created-by": "ibu-imager"`)
+		fake.tags[strings.Replace(digest([]byte(fake.tags["v1"])), ":", "-", 1)+".sig"] = `{"config": {"digest": "sha256:s"}}`
+		fake.tags["v2"] = `{"config": {"digest": "sha256:e"}, "layers": [{"digest": "sha256:l"}], "annotations": {` + seedLabels +
+			`, "org.opencontainers.image.created": "2023-02-01T00:00:00Z"}}`
+		fake.image("v3", "2023-03-01T00:00:00Z", seedLabels)
+		fake.tags["latest"] = fake.tags["v3"]
+		fake.image("base", "2024-01-01T00:00:00Z", `"maintainer": "someone"`)
+		fake.tags["list"] = `{"manifests": [{"digest": "sha256:m"}]}`
+
+		server = httptest.NewTLSServer(fake)
+		var err error
+		client, err = registry.NewClient("")
+		Expect(err).ToNot(HaveOccurred())
+		client.SetHTTPClient(server.Client())
+		repository, err = registry.ParseReference(strings.TrimPrefix(server.URL, "https://") + "/org/seed")
+		Expect(err).ToNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+
+	status := func(tags []Tag) map[string]bool {
+		kept := map[string]bool{}
+		for _, tag := range tags {
+			kept[tag.Tag] = tag.Kept
+		}
+		return kept
+	}
+
+	It("Deletes the old seeds and their companion tags, keeping the newest ones", func() {
+		tags, err := Prune(logrus.New(), client, repository, 2, false)
+		Expect(err).ToNot(HaveOccurred())
+		sig := strings.Replace(digest([]byte(fake.tags["v1"])), ":", "-", 1) + ".sig"
+		Expect(status(tags)).To(Equal(map[string]bool{"v3": true, "latest": true, "v2": true,
+			"v1": false, "v1-image-store": false, sig: false}))
+		Expect(tags[0].Tag).To(Equal("v3"))
+		Expect(fake.deleted).To(ConsistOf(digest([]byte(fake.tags["v1"])), digest([]byte(fake.tags["v1-image-store"])),
+			digest([]byte(fake.tags[sig]))))
+	})
+
+	It("Never deletes the digest of a kept tag", func() {
+		tags, err := Prune(logrus.New(), client, repository, 1, false)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(status(tags)).To(HaveKeyWithValue("latest", true))
+		Expect(status(tags)).To(HaveKeyWithValue("v2", false))
+		Expect(fake.deleted).ToNot(ContainElement(digest([]byte(fake.tags["v3"]))))
+		Expect(fake.deleted).To(HaveLen(4))
+	})
+
+	It("Deletes nothing on dry runs", func() {
+		tags, err := Prune(logrus.New(), client, repository, 1, true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(status(tags)).To(HaveKeyWithValue("v1", false))
+		Expect(fake.deleted).To(BeEmpty())
+
+		_, err = Prune(logrus.New(), client, repository, 0, true)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,389 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package seed_restorer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	containers "ibu-imager/internal/container_runtime"
+	"ibu-imager/internal/host_kernel"
+	nodenet "ibu-imager/internal/node_network"
+	"ibu-imager/internal/ops"
+	oras "ibu-imager/internal/oras_client"
+	ostree "ibu-imager/internal/ostree_client"
+	verifier "ibu-imager/internal/seed_verify"
+	"ibu-imager/internal/selinux"
+	siteconfig "ibu-imager/internal/site_config"
+	"ibu-imager/pkg/seedmanifest"
+)
+
+const (
+	// sysrootDir is where the host physical root, holding the ostree repo and stateroots, is mounted
+	sysrootDir = "/sysroot"
+	// defaultWorkDir holds the extracted seed ostree repo while it's pulled into the host repo
+	defaultWorkDir = "/var/tmp/ibu-imager-restore"
+	// defaultORASPullDir is where seeds stored as ORAS artifacts are pulled to, out of the work dir the
+	// ostree restore step wipes
+	defaultORASPullDir = "/var/tmp/ibu-imager-seed"
+	// rpmOstreeFile is the seed rpm-ostree status, telling the seed booted commit
+	rpmOstreeFile = "rpm-ostree.json"
+	// staterootPrefix prefixes the seed version in the default stateroot name
+	staterootPrefix = "rhcos_"
+)
+
+// Config is what and how to restore
+type Config struct {
+	// SeedImage is the seed image to restore
+	SeedImage string
+	// AuthFile holds the credentials to pull the seed image
+	AuthFile string
+	// Stateroot is the new stateroot the seed is deployed to, defaults to rhcos_<seed version>
+	Stateroot string
+	// SSHKeysPolicy overrides the authorized_keys restore policy of the seed
+	SSHKeysPolicy string
+	// AllowSELinuxModeChange restores a seed whose SELinux mode differs from the target one
+	AllowSELinuxModeChange bool
+	// SkipSELinuxRelabel keeps the labels the extracted files had on the seed, instead of relabeling them to
+	// the file contexts of the restored policy
+	SkipSELinuxRelabel bool
+	// AllowMissingCrioRuntime restores a seed lacking OCI hooks or runtime handlers of the target
+	AllowMissingCrioRuntime bool
+	// ORAS pulls the seed as an ORAS artifact, the runtime pulls and mounts it as an image when nil
+	ORAS *oras.Client
+	// Runtime pulls and mounts the seed image, podman when nil
+	Runtime containers.Runtime
+	// LocalImage restores the seed image already in the local storage, e.g. loaded by import, without pulling it
+	LocalImage bool
+	// SiteConfig reconfigures the restored node to a new site on first boot, it keeps the seed identity without
+	SiteConfig *siteconfig.SiteConfig
+}
+
+// Validate checks the config is complete
+func (c *Config) Validate() error {
+	if c.SeedImage == "" {
+		return errors.New("a seed image is required")
+	}
+	return nil
+}
+
+// SeedRestorer applies a seed image to a new stateroot of the host
+type SeedRestorer struct {
+	log     *logrus.Logger
+	ops     ops.Ops
+	config  Config
+	sysroot string
+	// root is the target root, the node network files of the target are read from
+	root string
+	// workDir holds the extracted seed ostree repo while it's pulled into the host repo
+	workDir string
+	// orasPullDir is where seeds stored as ORAS artifacts are pulled to
+	orasPullDir string
+
+	// seedDir is where the seed image is mounted
+	seedDir  string
+	manifest *seedmanifest.Manifest
+	// checksum is the ostree commit the seed was booted from
+	checksum   string
+	kernelPlan *host_kernel.Plan
+	relabel    bool
+	// targetSELinux is the SELinux state of the target, the extracted files are relabeled unless disabled
+	targetSELinux *selinux.State
+	// relabeler relabels the extracted files, once the new deployment holds the restored policy
+	relabeler     *selinux.Relabeler
+	deploymentDir string
+	// nodeNetworkPlan replaces the seed node network files with the target ones
+	nodeNetworkPlan *nodenet.Plan
+}
+
+func NewSeedRestorer(log *logrus.Logger, ops ops.Ops, config Config) *SeedRestorer {
+	if config.Runtime == nil {
+		config.Runtime = containers.NewPodman(ops)
+	}
+	return &SeedRestorer{
+		log:         log,
+		ops:         ops,
+		config:      config,
+		sysroot:     sysrootDir,
+		root:        "/",
+		workDir:     defaultWorkDir,
+		orasPullDir: defaultORASPullDir,
+	}
+}
+
+// RestoreSeedImage pulls the seed image and applies its restore steps, in dependency order, to a
+// new stateroot which becomes the default deployment on next boot
+func (r *SeedRestorer) RestoreSeedImage() error {
+	r.log.Println("Restoring seed image", r.config.SeedImage)
+
+	release, err := r.pullSeed()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	steps, err := r.plan()
+	if err != nil {
+		return err
+	}
+	if r.config.ORAS != nil {
+		// The artifacts are the layer blobs themselves, oras verified them against their digest
+		r.log.Info("Seed artifacts verified by the oras pull")
+	} else if err = r.verifyArtifacts(); err != nil {
+		return err
+	}
+
+	// The sysroot is mounted read-only, ostree itself only remounts it for its own operations
+	if _, err = r.ops.RunInHostNamespace("mount", "-o", "remount,rw", r.sysroot); err != nil {
+		return errors.Wrap(err, "Failed to remount the sysroot read-write")
+	}
+	for _, step := range steps {
+		r.log.Infof("Running restore step %s", step.Name)
+		if err = restoreHandlers[step.Name](r, step); err != nil {
+			return errors.Wrapf(err, "Restore step %s failed", step.Name)
+		}
+	}
+
+	if r.nodeNetworkPlan != nil {
+		if err = r.applyNodeNetworkPlan(); err != nil {
+			return errors.Wrap(err, "Failed to apply the node network")
+		}
+	}
+	if r.config.SiteConfig != nil {
+		if err = r.applySiteConfig(); err != nil {
+			return errors.Wrap(err, "Failed to apply the site config")
+		}
+	}
+	if r.relabeler != nil {
+		summary := r.relabeler.Summary
+		r.log.Infof("SELinux relabeled %d of the %d extracted files, %d having no file context", summary.Relabeled,
+			summary.Checked, summary.Unmatched)
+		for _, path := range summary.Paths {
+			r.log.Infof("Relabeled %s", path)
+		}
+		if summary.Relabeled > len(summary.Paths) {
+			r.log.Infof("... and %d more", summary.Relabeled-len(summary.Paths))
+		}
+	}
+	if r.relabel {
+		r.log.Info("Scheduling a full SELinux relabel on first boot of the new stateroot")
+		if err = selinux.ScheduleRelabel(r.deploymentDir); err != nil {
+			return err
+		}
+	}
+	r.log.Infof("Seed image restored to stateroot %s, reboot to boot it", r.config.Stateroot)
+	return nil
+}
+
+// pullSeed pulls the seed and sets the dir holding its artifacts, the image mount or the ORAS pull
+// dir, returning the func releasing it
+func (r *SeedRestorer) pullSeed() (func(), error) {
+	if r.config.ORAS != nil {
+		r.seedDir = r.orasPullDir
+		if err := os.RemoveAll(r.seedDir); err != nil {
+			return nil, err
+		}
+		if err := r.config.ORAS.Pull(r.config.SeedImage, r.seedDir); err != nil {
+			return nil, err
+		}
+		return func() {
+			if err := os.RemoveAll(r.seedDir); err != nil {
+				r.log.Warnf("Failed to remove the pulled seed: %v", err)
+			}
+		}, nil
+	}
+
+	if r.config.LocalImage {
+		if err := r.config.Runtime.ImageExists(r.config.SeedImage); err != nil {
+			return nil, errors.Wrapf(err, "Seed image %s not found in the local storage", r.config.SeedImage)
+		}
+	} else {
+		stream, err := r.config.Runtime.Pull(r.config.SeedImage, r.config.AuthFile)
+		if err == nil {
+			err = ops.LogStream(r.log, stream)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to pull seed image")
+		}
+	}
+
+	seedDir, err := r.config.Runtime.MountImage(r.config.SeedImage)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to mount seed image")
+	}
+	r.seedDir = seedDir
+	return func() {
+		if err := r.config.Runtime.UnmountImage(r.config.SeedImage, seedDir); err != nil {
+			r.log.Warnf("Failed to unmount seed image: %v", err)
+		}
+	}, nil
+}
+
+// plan reads the seed manifest and orders its restore steps, refusing steps this imager can't apply
+func (r *SeedRestorer) plan() ([]seedmanifest.RestoreStep, error) {
+	data, err := os.ReadFile(filepath.Join(r.seedDir, seedmanifest.FileName))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read seed manifest")
+	}
+	if r.manifest, err = seedmanifest.Parse(data); err != nil {
+		return nil, err
+	}
+	steps, err := seedmanifest.OrderRestoreSteps(r.manifest.RestoreSteps)
+	if err != nil {
+		return nil, err
+	}
+
+	var unknown []string
+	for _, step := range steps {
+		if _, ok := restoreHandlers[step.Name]; !ok {
+			unknown = append(unknown, step.Name)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, errors.Errorf("Seed image requires restore steps unknown to this imager version: %s",
+			strings.Join(unknown, ", "))
+	}
+
+	if r.config.Stateroot == "" {
+		if r.manifest.ClusterVersion == nil || r.manifest.ClusterVersion.Version == "" {
+			return nil, errors.New("Seed manifest has no cluster version, a stateroot must be given")
+		}
+		r.config.Stateroot = staterootPrefix + r.manifest.ClusterVersion.Version
+	}
+	if _, err = os.Stat(r.staterootDir()); err == nil {
+		return nil, errors.Errorf("Stateroot %s already exists, restore to another one", r.config.Stateroot)
+	}
+
+	if r.checksum, err = r.seedChecksum(); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+// verifyArtifacts checks every seed artifact against the digest the image is labeled with,
+// before any change is made to the host
+func (r *SeedRestorer) verifyArtifacts() error {
+	checks, err := verifier.VerifyLocal(r.config.Runtime, r.config.SeedImage, r.seedDir)
+	if err != nil {
+		return err
+	}
+	var failed []string
+	for _, check := range checks {
+		if check.Error != nil {
+			failed = append(failed, check.Artifact+": "+check.Error.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("Seed artifacts failed verification: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// seedChecksum returns the ostree commit of the seed booted deployment
+func (r *SeedRestorer) seedChecksum() (string, error) {
+	data, err := os.ReadFile(filepath.Join(r.seedDir, rpmOstreeFile))
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to read seed rpm-ostree status")
+	}
+	var status ostree.Status
+	if err = json.Unmarshal(data, &status); err != nil {
+		return "", errors.Wrap(err, "Failed to parse seed rpm-ostree status")
+	}
+	for _, deployment := range status.Deployments {
+		if deployment.Booted {
+			return deployment.Checksum, nil
+		}
+	}
+	return "", errors.New("Seed rpm-ostree status has no booted deployment")
+}
+
+// artifact returns the path of a seed artifact
+func (r *SeedRestorer) artifact(name string) string {
+	return filepath.Join(r.seedDir, name)
+}
+
+// applySiteConfig writes the files reconfiguring the node to the site config: the /var ones
+// into the stateroot, shared by its deployments, and the /etc ones into the new deployment
+func (r *SeedRestorer) applySiteConfig() error {
+	r.log.Infof("Reconfiguring the new stateroot to cluster domain %s", r.config.SiteConfig.Domain())
+	files, err := r.config.SiteConfig.Render()
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		dest := r.restoredPath(file.Path)
+		if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		if err = os.WriteFile(dest, file.Content, file.Mode); err != nil {
+			return errors.Wrapf(err, "Failed to write %s", dest)
+		}
+		r.log.Debugf("Wrote %s", dest)
+	}
+	return nil
+}
+
+// applyNodeNetworkPlan replaces the seed node network files of the new stateroot with the target ones,
+// removing the ones the target lacks or the plan leaves to nodeip-configuration
+func (r *SeedRestorer) applyNodeNetworkPlan() error {
+	for _, file := range r.nodeNetworkPlan.Removed {
+		r.log.Infof("Removing the seed %s, nodeip-configuration writes it on first boot", file)
+		if err := os.RemoveAll(r.restoredPath(file)); err != nil {
+			return errors.Wrapf(err, "Failed to remove %s", file)
+		}
+	}
+	for _, file := range r.nodeNetworkPlan.Files {
+		dest := r.restoredPath(file)
+		content, err := os.ReadFile(filepath.Join(r.root, file))
+		if os.IsNotExist(err) {
+			r.log.Infof("Removing the seed %s, the target has none", file)
+			if err = os.RemoveAll(dest); err != nil {
+				return errors.Wrapf(err, "Failed to remove %s", file)
+			}
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Failed to read the target %s", file)
+		}
+		r.log.Infof("Replacing the seed %s with the target one", file)
+		if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		if err = os.WriteFile(dest, content, 0644); err != nil {
+			return errors.Wrapf(err, "Failed to write %s", dest)
+		}
+	}
+	return nil
+}
+
+// restoredPath returns where a file of the host root is restored, /var being the stateroot one
+func (r *SeedRestorer) restoredPath(file string) string {
+	if strings.HasPrefix(file, "var/") {
+		return filepath.Join(r.staterootDir(), file)
+	}
+	return filepath.Join(r.deploymentDir, file)
+}
+
+// staterootDir is the new stateroot, holding its deployments and /var
+func (r *SeedRestorer) staterootDir() string {
+	return filepath.Join(r.sysroot, "ostree", "deploy", r.config.Stateroot)
+}
@@ -0,0 +1,286 @@
+package seed_restorer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	"ibu-imager/internal/host_kernel"
+	nodenet "ibu-imager/internal/node_network"
+	"ibu-imager/internal/ops"
+	oras "ibu-imager/internal/oras_client"
+	"ibu-imager/internal/selinux"
+	siteconfig "ibu-imager/internal/site_config"
+	"ibu-imager/pkg/seedmanifest"
+)
+
+func TestSeedRestorer(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SeedRestorer Suite")
+}
+
+func writeTestArchive(archive string, contents map[string]string) {
+	f, err := os.Create(archive)
+	Expect(err).ToNot(HaveOccurred())
+	gzipWriter := gzip.NewWriter(f)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range contents {
+		Expect(tarWriter.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(content))})).To(Succeed())
+		_, err = tarWriter.Write([]byte(content))
+		Expect(err).ToNot(HaveOccurred())
+	}
+	Expect(tarWriter.Close()).To(Succeed())
+	Expect(gzipWriter.Close()).To(Succeed())
+	Expect(f.Close()).To(Succeed())
+}
+
+var _ = Describe("Seed restore", func() {
+	var (
+		ctrl     *gomock.Controller
+		opsMock  *ops.MockOps
+		restorer *SeedRestorer
+		tmpDir   string
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		opsMock = ops.NewMockOps(ctrl)
+		tmpDir, _ = os.MkdirTemp("", "test")
+		restorer = NewSeedRestorer(logrus.New(), opsMock, Config{SeedImage: "quay.io/org/seed:oneimage"})
+		restorer.sysroot = filepath.Join(tmpDir, "sysroot")
+		restorer.workDir = filepath.Join(tmpDir, "work")
+		restorer.orasPullDir = filepath.Join(tmpDir, "seed-pull")
+		restorer.seedDir = filepath.Join(tmpDir, "seed")
+		Expect(os.MkdirAll(restorer.seedDir, 0755)).To(Succeed())
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	writeSeedFile := func(name, content string) {
+		Expect(os.WriteFile(filepath.Join(restorer.seedDir, name), []byte(content), 0600)).To(Succeed())
+	}
+
+	Context("Plan", func() {
+		BeforeEach(func() {
+			writeSeedFile(rpmOstreeFile, `{"deployments": [{"checksum": "abc", "booted": false}, {"checksum": "def", "booted": true}]}`)
+		})
+
+		It("Orders the steps and defaults the stateroot to the seed version", func() {
+			writeSeedFile(seedmanifest.FileName, `{"kind": "SeedImage", "nodeRole": "master",
+				"clusterVersion": {"version": "4.14.1"},
+				"restoreSteps": [{"name": "var", "dependsOn": ["ostree"]}, {"name": "ostree"}]}`)
+			steps, err := restorer.plan()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(steps[0].Name).To(Equal("ostree"))
+			Expect(restorer.config.Stateroot).To(Equal("rhcos_4.14.1"))
+			Expect(restorer.checksum).To(Equal("def"))
+		})
+
+		It("Refuses unknown restore steps", func() {
+			writeSeedFile(seedmanifest.FileName, `{"kind": "SeedImage", "nodeRole": "master",
+				"restoreSteps": [{"name": "future-step"}]}`)
+			_, err := restorer.plan()
+			Expect(err).To(MatchError(ContainSubstring("future-step")))
+		})
+
+		It("Refuses existing stateroots", func() {
+			writeSeedFile(seedmanifest.FileName, `{"kind": "SeedImage", "nodeRole": "master"}`)
+			restorer.config.Stateroot = "rhcos"
+			Expect(os.MkdirAll(restorer.staterootDir(), 0755)).To(Succeed())
+			_, err := restorer.plan()
+			Expect(err).To(MatchError(ContainSubstring("already exists")))
+		})
+	})
+
+	It("Deploys the seed commit with the missing kernel arguments", func() {
+		writeTestArchive(filepath.Join(restorer.seedDir, "ostree.tgz"), map[string]string{"config": "[core]\n"})
+		restorer.config.Stateroot = "rhcos_4.14.1"
+		restorer.checksum = "def"
+		restorer.kernelPlan = &host_kernel.Plan{Append: []string{"isolcpus=2-3"}}
+		Expect(os.MkdirAll(filepath.Join(restorer.staterootDir(), "deploy", "def.0"), 0755)).To(Succeed())
+
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("ostree", "pull-local", "--repo", filepath.Join(restorer.sysroot, "ostree", "repo"),
+				filepath.Join(restorer.workDir, "ostree-repo"), "def").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("ostree", "admin", "os-init", "rhcos_4.14.1").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("ostree", "admin", "deploy", "--os", "rhcos_4.14.1", "--no-prune",
+				"--karg-proc-cmdline", "--karg-append=isolcpus=2-3", "def").Return("", nil),
+		)
+		Expect(restorer.deployOstree(seedmanifest.RestoreStep{Name: "ostree", Artifact: "ostree.tgz"})).To(Succeed())
+		Expect(restorer.deploymentDir).To(Equal(filepath.Join(restorer.staterootDir(), "deploy", "def.0")))
+		Expect(restorer.workDir).ToNot(BeADirectory())
+	})
+
+	It("Reports the extraction progress of empty artifacts", func() {
+		progress := restorer.extractProgress("var.tgz")
+		Expect(func() { progress(0, 0) }).ToNot(Panic())
+		Expect(func() { progress(512, 1024) }).ToNot(Panic())
+	})
+
+	It("Applies the seed /etc deletions", func() {
+		restorer.deploymentDir = filepath.Join(tmpDir, "deployment")
+		wants := filepath.Join(restorer.deploymentDir, "etc", "systemd", "system", "multi-user.target.wants")
+		Expect(os.MkdirAll(wants, 0755)).To(Succeed())
+		Expect(os.Symlink("/usr/lib/systemd/system/ptp4l.service", filepath.Join(wants, "ptp4l.service"))).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(wants, "chronyd.service"), nil, 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(restorer.deploymentDir, "etc", "kept"), nil, 0644)).To(Succeed())
+		writeSeedFile(seedmanifest.DeletionsFileName, `{"schemaVersion": 1, "deletions": [
+			{"path": "/etc/systemd/system/multi-user.target.wants/ptp4l.service", "type": "symlink", "reason": "ostree-config-diff"},
+			{"path": "/etc/systemd/system/multi-user.target.wants/chronyd.service", "type": "symlink", "reason": "ostree-config-diff"},
+			{"path": "/etc/missing", "type": "file", "reason": "ostree-config-diff"}]}`)
+
+		Expect(restorer.applyEtcDeletions(seedmanifest.RestoreStep{Name: "etc-deletions", Artifact: seedmanifest.DeletionsFileName})).To(Succeed())
+		Expect(filepath.Join(wants, "ptp4l.service")).NotTo(BeAnExistingFile())
+		// Not a symlink on the target anymore, so not the unit the seed removed
+		Expect(filepath.Join(wants, "chronyd.service")).To(BeAnExistingFile())
+		Expect(filepath.Join(restorer.deploymentDir, "etc", "kept")).To(BeAnExistingFile())
+	})
+
+	It("Applies the deletions of older seeds", func() {
+		restorer.deploymentDir = filepath.Join(tmpDir, "deployment")
+		Expect(os.MkdirAll(filepath.Join(restorer.deploymentDir, "etc"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(restorer.deploymentDir, "etc", "deleted"), nil, 0644)).To(Succeed())
+		writeSeedFile(seedmanifest.LegacyDeletionsFileName, "/etc/deleted\n/etc/missing\n")
+
+		Expect(restorer.applyEtcDeletions(seedmanifest.RestoreStep{Name: "etc-deletions", Artifact: seedmanifest.LegacyDeletionsFileName})).To(Succeed())
+		Expect(filepath.Join(restorer.deploymentDir, "etc", "deleted")).NotTo(BeAnExistingFile())
+	})
+
+	It("Refuses deletions leaving the deployment /etc", func() {
+		restorer.deploymentDir = filepath.Join(tmpDir, "deployment")
+		outside := filepath.Join(tmpDir, "outside")
+		Expect(os.MkdirAll(filepath.Join(restorer.deploymentDir, "etc"), 0755)).To(Succeed())
+		Expect(os.MkdirAll(outside, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(outside, "file"), nil, 0644)).To(Succeed())
+		Expect(os.Symlink(outside, filepath.Join(restorer.deploymentDir, "etc", "link"))).To(Succeed())
+
+		writeSeedFile(seedmanifest.LegacyDeletionsFileName, "/etc/../var/lib/kubelet\n")
+		Expect(restorer.applyEtcDeletions(seedmanifest.RestoreStep{Name: "etc-deletions", Artifact: seedmanifest.LegacyDeletionsFileName})).
+			To(MatchError(ContainSubstring("below /etc")))
+
+		writeSeedFile(seedmanifest.DeletionsFileName, `{"deletions": [{"path": "/etc/link/file", "type": "file", "reason": "ostree-config-diff"}]}`)
+		Expect(restorer.applyEtcDeletions(seedmanifest.RestoreStep{Name: "etc-deletions", Artifact: seedmanifest.DeletionsFileName})).
+			To(MatchError(ContainSubstring("is a symlink")))
+		Expect(filepath.Join(outside, "file")).To(BeAnExistingFile())
+	})
+
+	It("Restores the core user with the seed policy", func() {
+		writeTestArchive(filepath.Join(restorer.seedDir, "core-user.tgz"), map[string]string{
+			".ssh/authorized_keys": "ssh-ed25519 seed\n",
+			".bashrc":              "alias k=kubectl\n",
+		})
+		restorer.config.Stateroot = "rhcos"
+		restorer.manifest = &seedmanifest.Manifest{CoreUser: &seedmanifest.CoreUserArtifact{Artifact: "core-user.tgz", RestorePolicy: "seed"}}
+
+		Expect(restorer.restoreCoreUser(seedmanifest.RestoreStep{Name: "core-user", Artifact: "core-user.tgz"})).To(Succeed())
+		home := filepath.Join(restorer.staterootDir(), coreUserHome)
+		Expect(os.ReadFile(filepath.Join(home, ".ssh", "authorized_keys"))).To(Equal([]byte("ssh-ed25519 seed\n")))
+		Expect(filepath.Join(home, ".bashrc")).To(BeAnExistingFile())
+	})
+
+	It("Gives the authorized_keys it creates to the core user", func() {
+		writeTestArchive(filepath.Join(restorer.seedDir, "core-user.tgz"), map[string]string{".bashrc": "alias k=kubectl\n"})
+		restorer.config.Stateroot = "rhcos"
+		restorer.config.SSHKeysPolicy = "seed"
+		restorer.manifest = &seedmanifest.Manifest{}
+		// The home is restored with /var, owned by the core user
+		home := filepath.Join(restorer.staterootDir(), coreUserHome)
+		Expect(os.MkdirAll(home, 0700)).To(Succeed())
+		if os.Geteuid() == 0 {
+			Expect(os.Chown(home, 1000, 1000)).To(Succeed())
+		}
+		contexts, err := selinux.ParseFileContexts(map[string]string{"file_contexts": "/etc(/.*)? system_u:object_r:etc_t:s0\n"})
+		Expect(err).ToNot(HaveOccurred())
+		restorer.relabeler = selinux.NewRelabeler(contexts)
+
+		Expect(restorer.restoreCoreUser(seedmanifest.RestoreStep{Name: "core-user", Artifact: "core-user.tgz"})).To(Succeed())
+		homeInfo, err := os.Stat(home)
+		Expect(err).ToNot(HaveOccurred())
+		owner := homeInfo.Sys().(*syscall.Stat_t)
+		for file, mode := range map[string]os.FileMode{".ssh": os.ModeDir | 0700, ".ssh/authorized_keys": 0600} {
+			info, err := os.Stat(filepath.Join(home, file))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Mode()).To(Equal(mode), file)
+			stat := info.Sys().(*syscall.Stat_t)
+			Expect([]uint32{stat.Uid, stat.Gid}).To(Equal([]uint32{owner.Uid, owner.Gid}), file)
+		}
+		// .bashrc, then .ssh and its authorized_keys
+		Expect(restorer.relabeler.Summary.Checked).To(Equal(3))
+	})
+
+	It("Relabels the extracted files by their path on the restored host", func() {
+		restorer.config.Stateroot = "rhcos"
+		restorer.deploymentDir = filepath.Join(restorer.staterootDir(), "deploy", "def.0")
+		Expect(restorer.hostPath(filepath.Join(restorer.deploymentDir, "etc", "hosts"))).To(Equal("/etc/hosts"))
+		Expect(restorer.hostPath(filepath.Join(restorer.staterootDir(), coreUserHome, ".ssh"))).To(Equal("/var/home/core/.ssh"))
+		Expect(restorer.hostPath(filepath.Join(restorer.staterootDir(), "var"))).To(Equal("/var"))
+
+		restorer.targetSELinux = &selinux.State{Mode: selinux.ModeDisabled}
+		relabeler, err := restorer.extractRelabeler()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(relabeler).To(BeNil())
+		restorer.targetSELinux = &selinux.State{Mode: selinux.ModeEnforcing}
+		_, err = restorer.extractRelabeler()
+		Expect(err).To(MatchError(ContainSubstring("file contexts of the restored policy")))
+	})
+
+	It("Writes the site config files into the stateroot and deployment", func() {
+		restorer.config.Stateroot = "rhcos"
+		restorer.deploymentDir = filepath.Join(restorer.staterootDir(), "deploy", "def.0")
+		restorer.config.SiteConfig = &siteconfig.SiteConfig{ClusterName: "sno2", BaseDomain: "example.com", Hostname: "sno2"}
+
+		Expect(restorer.applySiteConfig()).To(Succeed())
+		Expect(filepath.Join(restorer.staterootDir(), siteconfig.ClusterConfigurationDir, "cluster-relocation.yaml")).To(BeAnExistingFile())
+		Expect(os.ReadFile(filepath.Join(restorer.deploymentDir, "etc", "hostname"))).To(Equal([]byte("sno2\n")))
+	})
+
+	It("Replaces the seed node network files with the target ones", func() {
+		restorer.config.Stateroot = "rhcos"
+		restorer.deploymentDir = filepath.Join(restorer.staterootDir(), "deploy", "def.0")
+		restorer.root = filepath.Join(tmpDir, "target")
+		for _, file := range []string{nodenet.KubeletDropIn, nodenet.CrioDropIn, nodenet.BridgeHintFile} {
+			Expect(os.MkdirAll(filepath.Dir(restorer.restoredPath(file)), 0755)).To(Succeed())
+			Expect(os.WriteFile(restorer.restoredPath(file), []byte("seed"), 0644)).To(Succeed())
+		}
+		Expect(os.MkdirAll(filepath.Join(restorer.root, filepath.Dir(nodenet.KubeletDropIn)), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(restorer.root, nodenet.KubeletDropIn), []byte("target"), 0644)).To(Succeed())
+		restorer.nodeNetworkPlan = &nodenet.Plan{Files: []string{nodenet.KubeletDropIn, nodenet.BridgeHintFile},
+			Removed: []string{nodenet.CrioDropIn}}
+
+		Expect(restorer.applyNodeNetworkPlan()).To(Succeed())
+		Expect(os.ReadFile(filepath.Join(restorer.deploymentDir, nodenet.KubeletDropIn))).To(Equal([]byte("target")))
+		Expect(filepath.Join(restorer.deploymentDir, nodenet.CrioDropIn)).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(restorer.staterootDir(), nodenet.BridgeHintFile)).NotTo(BeAnExistingFile())
+	})
+
+	It("Pulls seeds stored as ORAS artifacts instead of mounting them", func() {
+		executor := ops.NewMockExecute(ctrl)
+		executor.EXPECT().Execute("oras", "pull", "--registry-config", "auth.json", "--output", restorer.orasPullDir, "quay.io/org/seed:oneimage").Return("", nil)
+		restorer.config.ORAS = oras.NewClient(logrus.New(), executor, "auth.json")
+
+		release, err := restorer.pullSeed()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(restorer.seedDir).To(Equal(restorer.orasPullDir))
+		release()
+	})
+
+	It("Mounts local seed images without pulling them", func() {
+		restorer.config.LocalImage = true
+		gomock.InOrder(
+			opsMock.EXPECT().RunInHostNamespace("podman", "image", "exists", "quay.io/org/seed:oneimage").Return("", nil),
+			opsMock.EXPECT().RunInHostNamespace("podman", "image", "mount", "quay.io/org/seed:oneimage").Return("/var/lib/containers/storage/overlay/abc/merged\n", nil),
+		)
+		_, err := restorer.pullSeed()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(restorer.seedDir).To(Equal("/var/lib/containers/storage/overlay/abc/merged"))
+	})
+})
@@ -0,0 +1,477 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package seed_restorer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/archive"
+	crio "ibu-imager/internal/crio_runtime"
+	"ibu-imager/internal/host_kernel"
+	storage "ibu-imager/internal/host_storage"
+	nodenet "ibu-imager/internal/node_network"
+	seed "ibu-imager/internal/seed_creator"
+	"ibu-imager/internal/selinux"
+	"ibu-imager/pkg/seedmanifest"
+)
+
+// coreUserHome is the home of the core user, relative to the stateroot
+const coreUserHome = "var/home/core"
+
+// restoreHandler applies a single seed manifest restore step
+type restoreHandler func(r *SeedRestorer, step seedmanifest.RestoreStep) error
+
+// restoreHandlers are the restore steps this imager knows to apply, by name
+var restoreHandlers = map[string]restoreHandler{
+	"validate-storage-layout": (*SeedRestorer).validateStorageLayout,
+	"validate-selinux":        (*SeedRestorer).validateSELinux,
+	"validate-crio-runtime":   (*SeedRestorer).validateCrioRuntime,
+	"validate-node-network":   (*SeedRestorer).validateNodeNetwork,
+	"kernel-arguments":        (*SeedRestorer).planKernelArguments,
+	"ostree":                  (*SeedRestorer).deployOstree,
+	"var":                     (*SeedRestorer).restoreVar,
+	"etc":                     (*SeedRestorer).restoreEtc,
+	"etc-deletions":           (*SeedRestorer).applyEtcDeletions,
+	"filesystem-references":   (*SeedRestorer).rewriteFilesystemReferences,
+	"recert":                  (*SeedRestorer).scheduleRecert,
+	"core-user":               (*SeedRestorer).restoreCoreUser,
+	"audit-logs":              (*SeedRestorer).restoreVar,
+	"machine-config-server":   (*SeedRestorer).skipMachineConfigServer,
+	"usr-local":               (*SeedRestorer).restoreUsrLocal,
+}
+
+func (r *SeedRestorer) readArtifact(step seedmanifest.RestoreStep, into interface{}) error {
+	data, err := os.ReadFile(r.artifact(step.Artifact))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read %s", step.Artifact)
+	}
+	return errors.Wrapf(json.Unmarshal(data, into), "Failed to parse %s", step.Artifact)
+}
+
+// extractProgress logs the progress of the extraction of the artifact
+func (r *SeedRestorer) extractProgress(artifact string) archive.ProgressFunc {
+	return func(read, total int64) {
+		// An empty artifact has no progress to report
+		if total > 0 {
+			r.log.Infof("Extracted %d%% of %s", read*100/total, artifact)
+		}
+	}
+}
+
+// extract extracts a tree of the seed into the new stateroot, relabeling the extracted files to the
+// restored policy, as the seed labels may be unknown to it or have changed
+func (r *SeedRestorer) extract(step seedmanifest.RestoreStep, dest string) error {
+	r.log.Infof("Extracting %s to %s", step.Artifact, dest)
+	opts := archive.ExtractOptions{Progress: r.extractProgress(step.Artifact)}
+
+	relabeler, err := r.extractRelabeler()
+	if err != nil {
+		return err
+	}
+	var relabeled int
+	if relabeler != nil {
+		relabeled = relabeler.Summary.Relabeled
+		opts.SkipLabelErrors = true
+		opts.Extracted = func(target string) error {
+			return relabeler.Relabel(target, r.hostPath(target))
+		}
+	}
+	if err = archive.Extract(r.artifact(step.Artifact), dest, opts); err != nil {
+		return err
+	}
+
+	if relabeler != nil {
+		r.log.Infof("Relabeled %d of the files extracted from %s", relabeler.Summary.Relabeled-relabeled, step.Artifact)
+	}
+	return nil
+}
+
+// extractRelabeler returns the relabeler of the extracted files, nil when they keep the seed labels: when
+// SELinux is disabled on the target, relabeling is skipped, or a full relabel is scheduled on first boot
+func (r *SeedRestorer) extractRelabeler() (*selinux.Relabeler, error) {
+	if r.relabeler != nil || r.targetSELinux == nil || r.targetSELinux.Mode == selinux.ModeDisabled ||
+		r.config.SkipSELinuxRelabel || r.relabel {
+		return r.relabeler, nil
+	}
+	contexts, err := selinux.LoadFileContexts(r.deploymentDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to load the file contexts of the restored policy")
+	}
+	r.relabeler = selinux.NewRelabeler(contexts)
+	return r.relabeler, nil
+}
+
+// hostPath returns the path on the restored host of a file of the new stateroot
+func (r *SeedRestorer) hostPath(file string) string {
+	if r.deploymentDir != "" && strings.HasPrefix(file, r.deploymentDir+"/") {
+		return strings.TrimPrefix(file, r.deploymentDir)
+	}
+	return "/" + strings.TrimPrefix(strings.TrimPrefix(file, r.staterootDir()), "/")
+}
+
+func (r *SeedRestorer) validateStorageLayout(step seedmanifest.RestoreStep) error {
+	var seedLayout storage.StorageLayout
+	if err := r.readArtifact(step, &seedLayout); err != nil {
+		return err
+	}
+	targetLayout, err := storage.CaptureLayout("/proc", "/sys")
+	if err != nil {
+		return err
+	}
+	return storage.ValidateTarget(&seedLayout, targetLayout)
+}
+
+func (r *SeedRestorer) validateSELinux(step seedmanifest.RestoreStep) error {
+	var seedState selinux.State
+	if err := r.readArtifact(step, &seedState); err != nil {
+		return err
+	}
+	targetState, err := selinux.Capture("/")
+	if err != nil {
+		return err
+	}
+	plan, err := selinux.Compare(&seedState, targetState, r.config.AllowSELinuxModeChange)
+	if err != nil {
+		return err
+	}
+	for _, reason := range plan.Reasons {
+		r.log.Infof("SELinux relabel needed: %s", reason)
+	}
+	r.relabel = plan.Relabel
+	r.targetSELinux = targetState
+	return nil
+}
+
+// validateCrioRuntime checks the target OCI hooks and runtime handlers are kept by the seed CRI-O
+// configuration, which replaces the target one
+func (r *SeedRestorer) validateCrioRuntime(step seedmanifest.RestoreStep) error {
+	var seedState crio.State
+	if err := r.readArtifact(step, &seedState); err != nil {
+		return err
+	}
+	targetState, err := crio.Capture(r.ops, "/")
+	if err != nil {
+		return err
+	}
+	plan := crio.Compare(&seedState, targetState)
+	for _, discrepancy := range plan.Discrepancies {
+		r.log.Warnf("CRI-O runtime discrepancy: %s", discrepancy)
+	}
+	if len(plan.Missing) == 0 {
+		return nil
+	}
+	if r.config.AllowMissingCrioRuntime {
+		for _, missing := range plan.Missing {
+			r.log.Warnf("The seed lacks the target %s", missing)
+		}
+		return nil
+	}
+	return errors.Errorf("The seed lacks the target %s, the workloads relying on them would fail to start",
+		strings.Join(plan.Missing, ", "))
+}
+
+// validateNodeNetwork selects the node IP on the target hardware, failing before any change when none can
+// be, and plans the replacement of the seed node network files that would make the restored kubelet
+// register with the seed IP
+func (r *SeedRestorer) validateNodeNetwork(step seedmanifest.RestoreStep) error {
+	// The site config address only applies on first boot, the target can't select the node IP beforehand
+	if r.config.SiteConfig != nil && r.config.SiteConfig.Network != nil {
+		r.log.Info("The site config changes the node address, nodeip-configuration selects the node IP on first boot")
+		r.nodeNetworkPlan = &nodenet.Plan{Removed: []string{nodenet.KubeletDropIn, nodenet.CrioDropIn, nodenet.HintFile}}
+		return nil
+	}
+
+	var seedState nodenet.State
+	if err := r.readArtifact(step, &seedState); err != nil {
+		return err
+	}
+	targetState, err := nodenet.Capture(r.ops, r.root)
+	if err != nil {
+		return err
+	}
+	plan, err := nodenet.Compare(&seedState, targetState)
+	if err != nil {
+		return err
+	}
+	for _, discrepancy := range plan.Discrepancies {
+		r.log.Warnf("Node network discrepancy: %s", discrepancy)
+	}
+	r.log.Infof("The restored kubelet registers with node IP %s", plan.NodeIP)
+	r.nodeNetworkPlan = plan
+	return nil
+}
+
+// planKernelArguments compares the seed kernel arguments with the target ones, the missing ones
+// being applied when deploying the new stateroot
+func (r *SeedRestorer) planKernelArguments(step seedmanifest.RestoreStep) error {
+	var seedState host_kernel.State
+	if err := r.readArtifact(step, &seedState); err != nil {
+		return err
+	}
+	targetState, err := host_kernel.Capture(r.ops)
+	if err != nil {
+		return err
+	}
+	r.kernelPlan = host_kernel.Compare(&seedState, targetState)
+	for _, discrepancy := range r.kernelPlan.Discrepancies {
+		r.log.Warnf("Kernel configuration discrepancy: %s", discrepancy)
+	}
+	return nil
+}
+
+// deployOstree pulls the seed commit into the host repo and deploys it to the new stateroot, with
+// the target kernel command line and the missing seed kernel arguments
+func (r *SeedRestorer) deployOstree(step seedmanifest.RestoreStep) error {
+	repo := filepath.Join(r.workDir, "ostree-repo")
+	if err := os.RemoveAll(r.workDir); err != nil {
+		return err
+	}
+	defer os.RemoveAll(r.workDir)
+	if err := r.extract(step, repo); err != nil {
+		return err
+	}
+
+	if _, err := r.ops.RunInHostNamespace("ostree", "pull-local", "--repo", filepath.Join(r.sysroot, "ostree", "repo"),
+		repo, r.checksum); err != nil {
+		return errors.Wrap(err, "Failed to pull the seed commit")
+	}
+	if _, err := r.ops.RunInHostNamespace("ostree", "admin", "os-init", r.config.Stateroot); err != nil {
+		return errors.Wrapf(err, "Failed to create stateroot %s", r.config.Stateroot)
+	}
+	args := []string{"admin", "deploy", "--os", r.config.Stateroot, "--no-prune", "--karg-proc-cmdline"}
+	if r.kernelPlan != nil {
+		args = append(args, r.kernelPlan.DeployArgs()...)
+	}
+	if _, err := r.ops.RunInHostNamespace("ostree", append(args, r.checksum)...); err != nil {
+		return errors.Wrap(err, "Failed to deploy the seed commit")
+	}
+
+	// A new stateroot only has this deployment, with serial 0
+	r.deploymentDir = filepath.Join(r.staterootDir(), "deploy", r.checksum+".0")
+	if _, err := os.Stat(r.deploymentDir); err != nil {
+		return errors.Wrap(err, "Failed to find the new deployment")
+	}
+	return nil
+}
+
+// restoreVar extracts an archive of /var content, its entries being relative to / and the
+// stateroot holding the deployments /var
+func (r *SeedRestorer) restoreVar(step seedmanifest.RestoreStep) error {
+	return r.extract(step, r.staterootDir())
+}
+
+func (r *SeedRestorer) restoreEtc(step seedmanifest.RestoreStep) error {
+	return r.extract(step, r.deploymentDir)
+}
+
+// restoreUsrLocal extracts the out-of-band /usr/local files of the seed into the new deployment
+func (r *SeedRestorer) restoreUsrLocal(step seedmanifest.RestoreStep) error {
+	return r.extract(step, r.deploymentDir)
+}
+
+// applyEtcDeletions removes the files the seed deleted from its /etc. Deletions never leave the
+// deployment /etc: paths outside of it are refused, parent symlinks aren't followed, and files whose
+// type changed on the target are kept.
+func (r *SeedRestorer) applyEtcDeletions(step seedmanifest.RestoreStep) error {
+	data, err := os.ReadFile(r.artifact(step.Artifact))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read %s", step.Artifact)
+	}
+	var deletions []seedmanifest.Deletion
+	if step.Artifact == seedmanifest.LegacyDeletionsFileName {
+		deletions, err = seedmanifest.ParseLegacyDeletions(data)
+	} else {
+		var parsed *seedmanifest.Deletions
+		if parsed, err = seedmanifest.ParseDeletions(data); err == nil {
+			deletions = parsed.Deletions
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, deletion := range deletions {
+		if err = r.applyEtcDeletion(deletion); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyEtcDeletion deletes a single file from the deployment /etc
+func (r *SeedRestorer) applyEtcDeletion(deletion seedmanifest.Deletion) error {
+	target := filepath.Join(r.deploymentDir, deletion.Path)
+
+	// A symlinked parent would take the deletion out of the deployment
+	for parent := filepath.Dir(target); parent != r.deploymentDir; parent = filepath.Dir(parent) {
+		info, err := os.Lstat(parent)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Failed to check %s", deletion.Path)
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return errors.Errorf("Refusing to delete %s, its parent %s is a symlink", deletion.Path,
+				strings.TrimPrefix(parent, r.deploymentDir))
+		}
+	}
+
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Failed to check %s", deletion.Path)
+	}
+	if deletion.Type != "" && deletion.Type != deletionType(info) {
+		r.log.Warnf("Keeping %s, it's a %s on the target but the seed deleted a %s", deletion.Path, deletionType(info), deletion.Type)
+		return nil
+	}
+	r.log.Debugf("Deleting %s (%s)", deletion.Path, deletion.Reason)
+	return errors.Wrapf(os.RemoveAll(target), "Failed to delete %s", deletion.Path)
+}
+
+// deletionType returns the deletion type matching the file
+func deletionType(info os.FileInfo) seedmanifest.DeletionType {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return seedmanifest.DeletionTypeSymlink
+	case info.IsDir():
+		return seedmanifest.DeletionTypeDirectory
+	default:
+		return seedmanifest.DeletionTypeFile
+	}
+}
+
+// rewriteFilesystemReferences replaces the seed filesystem UUIDs and labels in the restored fstab
+// with the target ones
+func (r *SeedRestorer) rewriteFilesystemReferences(step seedmanifest.RestoreStep) error {
+	var seedReferences storage.FilesystemReferences
+	if err := r.readArtifact(step, &seedReferences); err != nil {
+		return err
+	}
+	targetReferences, err := storage.CaptureFilesystemReferences(r.ops)
+	if err != nil {
+		return err
+	}
+	mapping := storage.ReferenceMapping(&seedReferences, targetReferences)
+	for from, to := range mapping {
+		r.log.Infof("Rewriting filesystem reference %s to %s", from, to)
+	}
+
+	fstab := filepath.Join(r.deploymentDir, "etc", "fstab")
+	content, err := os.ReadFile(fstab)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "Failed to read restored fstab")
+	}
+	return errors.Wrap(os.WriteFile(fstab, []byte(storage.RewriteReferences(string(content), mapping)), 0644),
+		"Failed to rewrite restored fstab")
+}
+
+// scheduleRecert has nothing to do: the installation configuration services in the restored
+// /etc and /var run recert on first boot of the new stateroot
+func (r *SeedRestorer) scheduleRecert(step seedmanifest.RestoreStep) error {
+	r.log.Info("Recert runs on first boot of the new stateroot")
+	return nil
+}
+
+// restoreCoreUser extracts the core user customizations and applies the authorized_keys policy,
+// the seed default one unless overridden
+func (r *SeedRestorer) restoreCoreUser(step seedmanifest.RestoreStep) error {
+	policy := r.config.SSHKeysPolicy
+	if policy == "" && r.manifest.CoreUser != nil {
+		policy = r.manifest.CoreUser.RestorePolicy
+	}
+	if err := seed.ValidateSSHKeysPolicy(policy); err != nil {
+		return err
+	}
+
+	home := filepath.Join(r.staterootDir(), coreUserHome)
+	if err := r.extract(step, home); err != nil {
+		return err
+	}
+	authorizedKeys := filepath.Join(home, ".ssh", "authorized_keys")
+	seedKeys, err := os.ReadFile(authorizedKeys)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	targetKeys, err := os.ReadFile(filepath.Join("/", coreUserHome, ".ssh", "authorized_keys"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	keys, err := seed.ApplySSHKeysPolicy(policy, string(seedKeys), string(targetKeys))
+	if err != nil {
+		return err
+	}
+	r.log.Infof("Restoring the core user's authorized_keys with the %s policy", policy)
+	if err = os.MkdirAll(filepath.Dir(authorizedKeys), 0700); err != nil {
+		return err
+	}
+	if err = os.WriteFile(authorizedKeys, []byte(keys), 0600); err != nil {
+		return errors.Wrap(err, "Failed to write authorized_keys")
+	}
+	return r.secureSSHDir(home)
+}
+
+// secureSSHDir gives the .ssh dir of the core user home, and its authorized_keys, to the owner of the home,
+// restored with /var, and relabels them: sshd's StrictModes refuses keys of files owned by root for core,
+// and its policy only reads the ones labeled ssh_home_t
+func (r *SeedRestorer) secureSSHDir(home string) error {
+	info, err := os.Stat(home)
+	if err != nil {
+		return err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return errors.Errorf("Failed to read the owner of %s", home)
+	}
+	relabeler, err := r.extractRelabeler()
+	if err != nil {
+		return err
+	}
+	sshDir := filepath.Join(home, ".ssh")
+	for _, file := range []string{sshDir, filepath.Join(sshDir, "authorized_keys")} {
+		if err = os.Lchown(file, int(stat.Uid), int(stat.Gid)); err != nil {
+			return errors.Wrapf(err, "Failed to give %s to the core user", r.hostPath(file))
+		}
+		if relabeler == nil {
+			continue
+		}
+		if err = relabeler.Relabel(file, r.hostPath(file)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipMachineConfigServer leaves the machine-config-server data to be applied once the restored
+// cluster runs, as it's only served by the machine-config-server
+func (r *SeedRestorer) skipMachineConfigServer(step seedmanifest.RestoreStep) error {
+	r.log.Warn("The seed machine-config-server data isn't applied on restore, apply it once the cluster runs")
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package seed_sign
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"ibu-imager/internal/ops"
+	registry "ibu-imager/internal/registry_client"
+)
+
+// Signer signs seed images with cosign, so image-based upgrades can enforce signature
+// verification on seeds
+type Signer struct {
+	log      *logrus.Logger
+	executor ops.Execute
+	client   *registry.Client
+	// key is a cosign private key file or KMS URI, the key password is read by cosign from COSIGN_PASSWORD
+	key      string
+	authFile string
+}
+
+// NewSigner returns a signer using the cosign key and the registry credentials of the authfile
+func NewSigner(log *logrus.Logger, executor ops.Execute, client *registry.Client, key, authFile string) *Signer {
+	return &Signer{log: log, executor: executor, client: client, key: key, authFile: authFile}
+}
+
+// ValidateKey checks the key file exists, KMS URIs are left to cosign
+func ValidateKey(key string) error {
+	if key == "" {
+		return errors.New("A cosign signing key is required")
+	}
+	if strings.Contains(key, "://") {
+		return nil
+	}
+	if _, err := os.Stat(key); err != nil {
+		return errors.Wrapf(err, "Invalid cosign signing key")
+	}
+	return nil
+}
+
+// Sign signs the seed image by digest, so the signature covers the exact content pushed whatever
+// the tag points to later, and returns the signed reference
+func (s *Signer) Sign(image string) (string, error) {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return "", err
+	}
+	digest := ref.Digest
+	if digest == "" {
+		if digest, err = s.client.ResolveDigest(ref); err != nil {
+			return "", errors.Wrapf(err, "Failed to resolve the digest of %s", image)
+		}
+	}
+	signed := ref.Name() + "@" + digest
+
+	args := []string{"cosign", "sign", "--yes", "--key", s.key, signed}
+	if s.authFile != "" {
+		// cosign reads the registry credentials from the Docker config dir
+		configDir, err := os.MkdirTemp("", "cosign-")
+		if err != nil {
+			return "", errors.Wrap(err, "Failed to create cosign config dir")
+		}
+		defer os.RemoveAll(configDir)
+		authFile, err := filepath.Abs(s.authFile)
+		if err != nil {
+			return "", err
+		}
+		if err = os.Symlink(authFile, filepath.Join(configDir, "config.json")); err != nil {
+			return "", errors.Wrap(err, "Failed to link the authfile to the cosign config dir")
+		}
+		args = append([]string{"DOCKER_CONFIG=" + configDir}, args...)
+	}
+
+	s.log.Infof("Signing %s", signed)
+	if _, err = s.executor.Execute("env", args...); err != nil {
+		return "", errors.Wrapf(err, "Failed to sign %s", signed)
+	}
+	return signed, nil
+}
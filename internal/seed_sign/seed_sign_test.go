@@ -0,0 +1,60 @@
+package seed_sign
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	"ibu-imager/internal/ops"
+	registry "ibu-imager/internal/registry_client"
+)
+
+func TestSeedSign(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Seed Sign Suite")
+}
+
+var _ = Describe("Seed signing", func() {
+	It("Signs the seed image by digest with the authfile credentials", func() {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Path).To(Equal("/v2/org/seed/manifests/oneimage"))
+			w.Header().Set("Docker-Content-Digest", "sha256:abc")
+		}))
+		defer server.Close()
+		client, err := registry.NewClient("")
+		Expect(err).ToNot(HaveOccurred())
+		client.SetHTTPClient(server.Client())
+		host := strings.TrimPrefix(server.URL, "https://")
+
+		tmpDir, _ := os.MkdirTemp("", "test")
+		defer os.RemoveAll(tmpDir)
+		authFile := filepath.Join(tmpDir, "auth.json")
+		Expect(os.WriteFile(authFile, []byte(`{"auths": {}}`), 0600)).To(Succeed())
+
+		executor := ops.NewMockExecute(gomock.NewController(GinkgoT()))
+		executor.EXPECT().Execute("env", gomock.Any(), "cosign", "sign", "--yes", "--key", "cosign.key", host+"/org/seed@sha256:abc").
+			DoAndReturn(func(_ string, args ...string) (string, error) {
+				configDir := strings.TrimPrefix(args[0], "DOCKER_CONFIG=")
+				Expect(os.ReadFile(filepath.Join(configDir, "config.json"))).To(Equal([]byte(`{"auths": {}}`)))
+				return "", nil
+			})
+
+		signed, err := NewSigner(logrus.New(), executor, client, "cosign.key", authFile).Sign(host + "/org/seed:oneimage")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(signed).To(Equal(host + "/org/seed@sha256:abc"))
+	})
+
+	It("Validates the signing key", func() {
+		Expect(ValidateKey("")).ToNot(Succeed())
+		Expect(ValidateKey("/nonexistent/cosign.key")).ToNot(Succeed())
+		Expect(ValidateKey("awskms:///alias/seed")).To(Succeed())
+	})
+})
@@ -0,0 +1,253 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package seed_verify
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	registry "ibu-imager/internal/registry_client"
+	"ibu-imager/pkg/seedmanifest"
+)
+
+// partialSuffix is appended to the destination of the layer being downloaded, which is kept on
+// failure so the next fetch resumes it
+const partialSuffix = ".partial"
+
+// FetchArtifact downloads a single artifact of a remote seed image to dest, or into dest if it's a
+// directory, without pulling the whole image. Both the layer blob digest and the artifact digest
+// the image is labeled with are verified, and interrupted downloads are resumed. It returns the
+// path the artifact was written to. Extra artifacts are fetched by their path, e.g.
+// extra/example.com/license.bin, and verified against the digest the seed manifest records.
+func FetchArtifact(client *registry.Client, ref registry.Reference, artifact, dest string) (string, error) {
+	layer, digest, err := findArtifact(client, ref, artifact)
+	if err != nil {
+		return "", err
+	}
+
+	if info, err := os.Stat(dest); err == nil && info.IsDir() {
+		dest = filepath.Join(dest, path.Base(artifact))
+	}
+	partial := dest + partialSuffix
+	if err = downloadBlob(client, ref, layer, partial); err != nil {
+		return "", err
+	}
+	if err = verifyFile(partial, layer.Digest); err != nil {
+		// A corrupted partial download can't be resumed
+		_ = os.Remove(partial)
+		return "", errors.Wrapf(err, "Layer %s of %s", layer.Digest, artifact)
+	}
+	if err = extractArtifact(partial, layer.MediaType, artifact, digest, dest); err != nil {
+		return "", err
+	}
+	return dest, os.Remove(partial)
+}
+
+// ReadArtifact downloads a small file artifact of a remote seed image, e.g. its manifest, verifying
+// both the layer blob digest and the artifact digest
+func ReadArtifact(client *registry.Client, ref registry.Reference, artifact string) ([]byte, error) {
+	layer, digest, err := findArtifact(client, ref, artifact)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := client.GetBlob(ref, layer.Digest)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+	data, err := io.ReadAll(blob)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to download layer %s", layer.Digest)
+	}
+	if err = verifyReader(bytes.NewReader(data), layer.Digest); err != nil {
+		return nil, errors.Wrapf(err, "Layer %s of %s", layer.Digest, artifact)
+	}
+
+	content, err := readLayerArtifact(bytes.NewReader(data), layer.MediaType, artifact)
+	if err != nil {
+		return nil, err
+	}
+	if err = verifyReader(bytes.NewReader(content), digest); err != nil {
+		return nil, errors.Wrapf(err, "Artifact %s", artifact)
+	}
+	return content, nil
+}
+
+// findArtifact returns the layer holding a file artifact of a remote seed image, and its digest
+func findArtifact(client *registry.Client, ref registry.Reference, artifact string) (registry.Descriptor, string, error) {
+	manifest, err := client.GetManifest(ref)
+	if err != nil {
+		return registry.Descriptor{}, "", err
+	}
+	config, err := client.GetImageConfig(ref, manifest)
+	if err != nil {
+		return registry.Descriptor{}, "", err
+	}
+	artifacts, digests, err := artifactLabels(config.Config.Labels)
+	if err != nil {
+		return registry.Descriptor{}, "", err
+	}
+	if len(artifacts) != len(manifest.Layers) {
+		return registry.Descriptor{}, "", errors.Errorf("%s has %d layers for %d artifacts", ref, len(manifest.Layers), len(artifacts))
+	}
+	for i, name := range artifacts {
+		if name != artifact {
+			continue
+		}
+		if digests[artifact] == "" {
+			return registry.Descriptor{}, "", errors.Errorf("Artifact %s is a directory, only file artifacts can be fetched", artifact)
+		}
+		return manifest.Layers[i], digests[artifact], nil
+	}
+	if strings.HasPrefix(artifact, seedmanifest.ExtraArtifactsDir+"/") {
+		return findExtraArtifact(client, ref, artifact, artifacts, manifest.Layers)
+	}
+	return registry.Descriptor{}, "", errors.Errorf("%s has no artifact %s, it has: %s", ref, artifact, strings.Join(artifacts, ", "))
+}
+
+// findExtraArtifact returns the layer of the extra artifacts dir holding an extra artifact, and its digest
+// recorded in the seed manifest
+func findExtraArtifact(client *registry.Client, ref registry.Reference, artifact string, artifacts []string,
+	layers []registry.Descriptor) (registry.Descriptor, string, error) {
+	data, err := ReadArtifact(client, ref, seedmanifest.FileName)
+	if err != nil {
+		return registry.Descriptor{}, "", err
+	}
+	seedManifest, err := seedmanifest.Parse(data)
+	if err != nil {
+		return registry.Descriptor{}, "", err
+	}
+	var digest string
+	var attached []string
+	for _, extra := range seedManifest.ExtraArtifacts {
+		if extra.Path == artifact {
+			digest = extra.Digest
+		}
+		attached = append(attached, extra.Path)
+	}
+	if digest == "" {
+		return registry.Descriptor{}, "", errors.Errorf("%s has no extra artifact %s, it has: %s", ref, artifact, strings.Join(attached, ", "))
+	}
+	for i, name := range artifacts {
+		if name == seedmanifest.ExtraArtifactsDir {
+			return layers[i], digest, nil
+		}
+	}
+	return registry.Descriptor{}, "", errors.Errorf("%s has no %s layer for its extra artifacts", ref, seedmanifest.ExtraArtifactsDir)
+}
+
+// downloadBlob downloads the blob to file, resuming from the file content if any
+func downloadBlob(client *registry.Client, ref registry.Reference, layer registry.Descriptor, file string) error {
+	var offset int64
+	if info, err := os.Stat(file); err == nil && info.Size() <= layer.Size {
+		offset = info.Size()
+	}
+	if offset == layer.Size {
+		return nil
+	}
+
+	blob, served, err := client.GetBlobFrom(ref, layer.Digest, offset)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if served == 0 {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(file, flags, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, blob); err != nil {
+		_ = f.Close()
+		return errors.Wrapf(err, "Failed to download layer %s, fetch again to resume", layer.Digest)
+	}
+	return f.Close()
+}
+
+// extractArtifact extracts the artifact out of the layer blob to dest, verifying its digest
+func extractArtifact(layerFile, mediaType, artifact, digest, dest string) error {
+	f, err := os.Open(layerFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reader, err := layerArtifactReader(f, mediaType, artifact)
+	if err != nil {
+		return err
+	}
+
+	tmp := dest + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if err = verifyReader(io.TeeReader(reader, out), digest); err != nil {
+		_ = out.Close()
+		return errors.Wrapf(err, "Artifact %s", artifact)
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// readLayerArtifact returns the content of the artifact in the layer blob
+func readLayerArtifact(layer io.Reader, mediaType, artifact string) ([]byte, error) {
+	reader, err := layerArtifactReader(layer, mediaType, artifact)
+	if err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(reader)
+	return content, errors.Wrapf(err, "Failed to read %s", artifact)
+}
+
+// layerArtifactReader returns a reader of the artifact in the layer blob
+func layerArtifactReader(layer io.Reader, mediaType, artifact string) (io.Reader, error) {
+	if strings.HasSuffix(mediaType, "gzip") {
+		gzipReader, err := gzip.NewReader(layer)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to decompress layer of %s", artifact)
+		}
+		layer = gzipReader
+	}
+
+	tarReader := tar.NewReader(layer)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, errors.Errorf("Layer doesn't contain %s", artifact)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read layer of %s", artifact)
+		}
+		if strings.TrimPrefix(path.Clean("/"+header.Name), "/") == artifact && header.Typeflag == tar.TypeReg {
+			return tarReader, nil
+		}
+	}
+}
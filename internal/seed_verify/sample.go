@@ -0,0 +1,220 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package seed_verify
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+
+	containers "ibu-imager/internal/container_runtime"
+	seed "ibu-imager/internal/seed_creator"
+)
+
+// SampleConfig configures the sampling verification of the backup dir archives
+type SampleConfig struct {
+	// Files is the number of files sampled out of every archive
+	Files int
+	// HostRoot is the host root filesystem, the sampled files are compared with their sources below it
+	HostRoot string
+	// Seed seeds the random sampling, so a failed sample can be drawn again
+	Seed int64
+}
+
+// SampledFile is the verification outcome of a file sampled out of an archive
+type SampledFile struct {
+	Archive string
+	Name    string
+	// Digest is the content digest of the archived file, empty for symlinks
+	Digest string
+	// HostVerified is true when the file was compared with its host source. Files whose source is gone or
+	// changed since they were archived are only covered by the archive digest.
+	HostVerified bool
+	Error        error
+}
+
+// sample is a file drawn out of an archive, with the digest of its archived content
+type sample struct {
+	header *tar.Header
+	digest string
+}
+
+// VerifySample verifies the artifacts of the backup dir against the digests the locally built seed
+// image is labeled with, and compares a random sample of the files of every archive with their host
+// sources. Archives are read once, without extracting them: the sample is drawn as the archive is
+// streamed, hashing only the files drawn, so verification takes little more than hashing the archive.
+func VerifySample(runtime containers.Runtime, image, backupDir string, config SampleConfig) ([]Check, []SampledFile, error) {
+	if config.Files < 1 {
+		return nil, nil, errors.Errorf("At least one file must be sampled per archive, got %d", config.Files)
+	}
+	artifacts, digests, err := localArtifactLabels(runtime, image)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	random := rand.New(rand.NewSource(config.Seed))
+	checks := make([]Check, 0, len(artifacts))
+	var sampled []SampledFile
+	for _, artifact := range artifacts {
+		check := Check{Artifact: artifact, Digest: digests[artifact]}
+		switch {
+		case strings.HasSuffix(artifact, ".tgz"):
+			var samples []sample
+			samples, check.Error = sampleArchive(path.Join(backupDir, artifact), check.Digest, config.Files, random)
+			for _, drawn := range samples {
+				sampled = append(sampled, compareSample(config.HostRoot, backupDir, artifact, drawn))
+			}
+		case check.Digest != "":
+			check.Error = verifyFile(path.Join(backupDir, artifact), check.Digest)
+		default:
+			_, check.Error = os.Stat(path.Join(backupDir, artifact))
+		}
+		check.ContentVerified = check.Error == nil && check.Digest != ""
+		checks = append(checks, check)
+	}
+	return checks, sampled, nil
+}
+
+// sampleArchive streams the archive, checking its digest, and draws up to files regular files and
+// symlinks out of it by reservoir sampling
+func sampleArchive(archive, digest string, files int, random *rand.Rand) ([]sample, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	archiveHash := sha256.New()
+	reader := io.TeeReader(f, archiveHash)
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to decompress %s", archive)
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	var (
+		samples []sample
+		seen    int
+	)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read %s", archive)
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeSymlink {
+			continue
+		}
+		seen++
+		slot := len(samples)
+		if seen > files {
+			// Keeps every file with the same files/seen probability, only the files kept get hashed
+			if slot = random.Intn(seen); slot >= files {
+				continue
+			}
+		}
+
+		drawn := sample{header: header}
+		if header.Typeflag == tar.TypeReg {
+			h := sha256.New()
+			if _, err = io.Copy(h, tarReader); err != nil {
+				return nil, errors.Wrapf(err, "Failed to read %s out of %s", header.Name, archive)
+			}
+			drawn.digest = "sha256:" + hex.EncodeToString(h.Sum(nil))
+		}
+		if slot == len(samples) {
+			samples = append(samples, drawn)
+		} else {
+			samples[slot] = drawn
+		}
+	}
+	// Drain the archive so its digest covers all of it
+	if _, err = io.Copy(io.Discard, reader); err != nil {
+		return nil, errors.Wrapf(err, "Failed to read %s", archive)
+	}
+	if digest != "" {
+		if actual := "sha256:" + hex.EncodeToString(archiveHash.Sum(nil)); actual != digest {
+			return samples, errors.Errorf("digest mismatch: expected %s, got %s", digest, actual)
+		}
+	}
+	return samples, nil
+}
+
+// compareSample compares the file drawn out of the archive with its host source. Sources that are
+// gone or were modified since they were archived can't be compared, the file is then left to the
+// archive digest.
+func compareSample(hostRoot, backupDir, archive string, drawn sample) SampledFile {
+	header := drawn.header
+	file := SampledFile{Archive: archive, Name: header.Name, Digest: drawn.digest}
+	source := filepath.Join(hostRoot, seed.ArchiveSourceRoot(backupDir, archive), path.Clean("/"+header.Name))
+	info, err := os.Lstat(source)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			file.Error = err
+		}
+		return file
+	}
+	// tar records whole seconds only
+	if !info.ModTime().Truncate(time.Second).Equal(header.ModTime.Truncate(time.Second)) {
+		return file
+	}
+
+	file.HostVerified = true
+	file.Error = compareMetadata(source, header, info)
+	if file.Error == nil && drawn.digest != "" {
+		file.Error = verifyFile(source, drawn.digest)
+	}
+	return file
+}
+
+// compareMetadata compares the type, mode, ownership, size and symlink target of the archived file with its source
+func compareMetadata(source string, header *tar.Header, info os.FileInfo) error {
+	const modeMask = os.ModeType | os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	if archived, actual := header.FileInfo().Mode()&modeMask, info.Mode()&modeMask; archived != actual {
+		return errors.Errorf("mode mismatch: archived %s, host %s", archived, actual)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && (int(stat.Uid) != header.Uid || int(stat.Gid) != header.Gid) {
+		return errors.Errorf("ownership mismatch: archived %d:%d, host %d:%d", header.Uid, header.Gid, stat.Uid, stat.Gid)
+	}
+	if header.Typeflag == tar.TypeSymlink {
+		target, err := os.Readlink(source)
+		if err != nil {
+			return err
+		}
+		if target != header.Linkname {
+			return errors.Errorf("symlink target mismatch: archived %s, host %s", header.Linkname, target)
+		}
+		return nil
+	}
+	if info.Size() != header.Size {
+		return errors.Errorf("size mismatch: archived %d bytes, host %d", header.Size, info.Size())
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package seed_verify
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	containers "ibu-imager/internal/container_runtime"
+	registry "ibu-imager/internal/registry_client"
+	seed "ibu-imager/internal/seed_creator"
+	"ibu-imager/internal/version"
+)
+
+// Check is the verification outcome of a single seed artifact
+type Check struct {
+	Artifact string
+	// Digest is the artifact content digest the seed image is labeled with, empty for directories
+	Digest string
+	// ContentVerified is true when the artifact content was hashed, rather than only its layer checked
+	ContentVerified bool
+	Error           error
+}
+
+// artifactLabels returns the artifacts, in layer order, and their digests out of the seed image labels
+func artifactLabels(labels map[string]string) ([]string, map[string]string, error) {
+	if err := CheckSeedFormat(labels); err != nil {
+		return nil, nil, err
+	}
+	list, ok := labels[seed.ArtifactsLabel]
+	if !ok || list == "" {
+		return nil, nil, errors.Errorf("Image has no %s label, it was built by an ibu-imager version not labeling artifacts", seed.ArtifactsLabel)
+	}
+	digests := map[string]string{}
+	for key, value := range labels {
+		if strings.HasPrefix(key, seed.ArtifactLabelPrefix) {
+			digests[strings.TrimPrefix(key, seed.ArtifactLabelPrefix)] = value
+		}
+	}
+	return strings.Split(list, ","), digests, nil
+}
+
+// CheckSeedFormat refuses seed images labeled with a seed format newer than this imager supports.
+// Seeds built before the label was introduced are of the first format.
+func CheckSeedFormat(labels map[string]string) error {
+	return version.CheckSeedFormat(labels[seed.SeedFormatLabel], labels[seed.ImagerVersionLabel])
+}
+
+// VerifyLocal verifies the artifacts of the backup dir against the digests the locally built seed image is labeled with
+func VerifyLocal(runtime containers.Runtime, image, backupDir string) ([]Check, error) {
+	artifacts, digests, err := localArtifactLabels(runtime, image)
+	if err != nil {
+		return nil, err
+	}
+
+	checks := make([]Check, 0, len(artifacts))
+	for _, artifact := range artifacts {
+		check := Check{Artifact: artifact, Digest: digests[artifact]}
+		if check.Digest != "" {
+			check.Error = verifyFile(path.Join(backupDir, artifact), check.Digest)
+			check.ContentVerified = check.Error == nil
+		} else if _, err = os.Stat(path.Join(backupDir, artifact)); err != nil {
+			check.Error = err
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// localArtifactLabels returns the artifacts and their digests out of the labels of the locally built seed image
+func localArtifactLabels(runtime containers.Runtime, image string) ([]string, map[string]string, error) {
+	labels, err := runtime.ImageLabels(image)
+	if err != nil {
+		return nil, nil, err
+	}
+	return artifactLabels(labels)
+}
+
+// VerifyRemote verifies the seed image in the registry. By default only the manifest and the config
+// blob are downloaded: every artifact must have a layer, whose blob the registry holds at the size
+// the manifest records. With content, the layers are downloaded and the artifacts hashed.
+func VerifyRemote(client *registry.Client, ref registry.Reference, content bool) ([]Check, error) {
+	manifest, err := client.GetManifest(ref)
+	if err != nil {
+		return nil, err
+	}
+	config, err := client.GetImageConfig(ref, manifest)
+	if err != nil {
+		return nil, err
+	}
+	artifacts, digests, err := artifactLabels(config.Config.Labels)
+	if err != nil {
+		return nil, err
+	}
+	if len(artifacts) != len(manifest.Layers) {
+		return nil, errors.Errorf("%s has %d layers for %d artifacts", ref, len(manifest.Layers), len(artifacts))
+	}
+
+	checks := make([]Check, 0, len(artifacts))
+	for i, artifact := range artifacts {
+		layer := manifest.Layers[i]
+		check := Check{Artifact: artifact, Digest: digests[artifact]}
+		if content {
+			check.Error = verifyLayerContent(client, ref, layer, artifact, check.Digest)
+			check.ContentVerified = check.Error == nil && check.Digest != ""
+		} else {
+			size, err := client.BlobSize(ref, layer.Digest)
+			if err == nil && size != layer.Size {
+				err = errors.Errorf("layer %s is %d bytes in the registry, the manifest records %d", layer.Digest, size, layer.Size)
+			}
+			check.Error = err
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// verifyLayerContent downloads the layer, checking both its blob digest and the digest of the artifact in it
+func verifyLayerContent(client *registry.Client, ref registry.Reference, layer registry.Descriptor, artifact, digest string) error {
+	blob, err := client.GetBlob(ref, layer.Digest)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	blobHash := sha256.New()
+	reader := io.TeeReader(blob, blobHash)
+	if strings.HasSuffix(layer.MediaType, "gzip") {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to decompress layer %s", layer.Digest)
+		}
+		reader = gzipReader
+	}
+
+	found := false
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Failed to read layer %s", layer.Digest)
+		}
+		if strings.TrimPrefix(path.Clean("/"+header.Name), "/") != artifact || header.Typeflag != tar.TypeReg {
+			continue
+		}
+		found = true
+		if digest != "" {
+			if err = verifyReader(tarReader, digest); err != nil {
+				return err
+			}
+		}
+	}
+	// Drain the blob so its digest covers all of it
+	if _, err = io.Copy(io.Discard, reader); err != nil {
+		return errors.Wrapf(err, "Failed to read layer %s", layer.Digest)
+	}
+	if _, err = io.Copy(io.Discard, blob); err != nil {
+		return errors.Wrapf(err, "Failed to read layer %s", layer.Digest)
+	}
+	if actual := "sha256:" + hex.EncodeToString(blobHash.Sum(nil)); actual != layer.Digest {
+		return errors.Errorf("layer digest mismatch: expected %s, got %s", layer.Digest, actual)
+	}
+	if digest != "" && !found {
+		return errors.Errorf("layer %s doesn't contain %s", layer.Digest, artifact)
+	}
+	return nil
+}
+
+func verifyFile(filePath, digest string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return verifyReader(f, digest)
+}
+
+func verifyReader(r io.Reader, digest string) error {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return errors.Wrap(err, "Failed to compute digest")
+	}
+	if actual := "sha256:" + hex.EncodeToString(h.Sum(nil)); actual != digest {
+		return errors.Errorf("digest mismatch: expected %s, got %s", digest, actual)
+	}
+	return nil
+}
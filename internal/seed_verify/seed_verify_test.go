@@ -0,0 +1,219 @@
+package seed_verify
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	containers "ibu-imager/internal/container_runtime"
+	"ibu-imager/internal/ops"
+)
+
+func TestSeedVerify(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Seed Verify Suite")
+}
+
+var _ = Describe("Local seed verification", func() {
+	var (
+		ctrl    *gomock.Controller
+		opsMock *ops.MockOps
+		tmpDir  string
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		opsMock = ops.NewMockOps(ctrl)
+		tmpDir, _ = os.MkdirTemp("", "test")
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("Verifies the artifacts against the image labels", func() {
+		Expect(os.WriteFile(filepath.Join(tmpDir, "etc.tgz"), []byte("etc"), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(tmpDir, "var.tgz"), []byte("tampered"), 0600)).To(Succeed())
+		opsMock.EXPECT().RunInHostNamespace("podman", "image", "inspect", "--format", "json", "quay.io/org/seed:oneimage").
+			Return(`[{"Labels": {
+				"io.openshift.ibu.artifacts": "etc.tgz,var.tgz",
+				"io.openshift.ibu.artifact.etc.tgz": "sha256:812de6e718f869feb16b45c6bbcfdb1269fe6f6fffdc2420166482e3cd0aa647",
+				"io.openshift.ibu.artifact.var.tgz": "sha256:a1e4d2e3ab7f5c1b4fc8d1a26db8e5b4bb4b3a2bb588f6872bc55a3bb62c7a7a"
+			}}]`, nil)
+
+		checks, err := VerifyLocal(containers.NewPodman(opsMock), "quay.io/org/seed:oneimage", tmpDir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(checks).To(HaveLen(2))
+		Expect(checks[0].Error).ToNot(HaveOccurred())
+		Expect(checks[0].ContentVerified).To(BeTrue())
+		Expect(checks[1].Error).To(MatchError(ContainSubstring("digest mismatch")))
+	})
+
+	It("Fails on images without artifact labels", func() {
+		opsMock.EXPECT().RunInHostNamespace("podman", gomock.Any()).Return(`[{"Labels": {}}]`, nil)
+		_, err := VerifyLocal(containers.NewPodman(opsMock), "quay.io/org/seed:oneimage", tmpDir)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Refuses seeds of a newer seed format", func() {
+		opsMock.EXPECT().RunInHostNamespace("podman", gomock.Any()).Return(`[{"Labels": {
+			"io.openshift.ibu.artifacts": "etc.tgz",
+			"io.openshift.ibu.imager-version": "4.16.0",
+			"io.openshift.ibu.seed-format": "99"
+		}}]`, nil)
+		_, err := VerifyLocal(containers.NewPodman(opsMock), "quay.io/org/seed:oneimage", tmpDir)
+		Expect(err).To(MatchError(ContainSubstring("created by ibu-imager 4.16.0")))
+	})
+})
+
+var _ = Describe("Artifact fetch", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		tmpDir, _ = os.MkdirTemp("", "test")
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	writeLayer := func(name, content string) string {
+		layer := filepath.Join(tmpDir, "layer")
+		f, err := os.Create(layer)
+		Expect(err).ToNot(HaveOccurred())
+		gzipWriter := gzip.NewWriter(f)
+		tarWriter := tar.NewWriter(gzipWriter)
+		Expect(tarWriter.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(content))})).To(Succeed())
+		_, err = tarWriter.Write([]byte(content))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tarWriter.Close()).To(Succeed())
+		Expect(gzipWriter.Close()).To(Succeed())
+		Expect(f.Close()).To(Succeed())
+		return layer
+	}
+
+	It("Extracts the artifact of a layer, verifying its digest", func() {
+		layer := writeLayer("etc.tgz", "etc")
+		dest := filepath.Join(tmpDir, "etc.tgz")
+		Expect(extractArtifact(layer, "application/vnd.oci.image.layer.v1.tar+gzip", "etc.tgz",
+			"sha256:812de6e718f869feb16b45c6bbcfdb1269fe6f6fffdc2420166482e3cd0aa647", dest)).To(Succeed())
+		Expect(os.ReadFile(dest)).To(Equal([]byte("etc")))
+	})
+
+	It("Refuses artifacts not matching their digest", func() {
+		layer := writeLayer("etc.tgz", "tampered")
+		dest := filepath.Join(tmpDir, "etc.tgz")
+		Expect(extractArtifact(layer, "application/vnd.oci.image.layer.v1.tar+gzip", "etc.tgz",
+			"sha256:812de6e718f869feb16b45c6bbcfdb1269fe6f6fffdc2420166482e3cd0aa647", dest)).
+			To(MatchError(ContainSubstring("digest mismatch")))
+		Expect(dest).NotTo(BeAnExistingFile())
+		Expect(dest + ".tmp").NotTo(BeAnExistingFile())
+	})
+
+	It("Fails on layers without the artifact", func() {
+		layer := writeLayer("var.tgz", "var")
+		Expect(extractArtifact(layer, "application/vnd.oci.image.layer.v1.tar+gzip", "etc.tgz", "sha256:0",
+			filepath.Join(tmpDir, "etc.tgz"))).To(MatchError(ContainSubstring("doesn't contain")))
+	})
+})
+
+var _ = Describe("Sampling verification", func() {
+	var (
+		ctrl    *gomock.Controller
+		opsMock *ops.MockOps
+		tmpDir  string
+		created = time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		opsMock = ops.NewMockOps(ctrl)
+		tmpDir, _ = os.MkdirTemp("", "test")
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	// writeArchive writes the files as a var.tgz archive, returning its digest
+	writeArchive := func(files map[string]string) string {
+		f, err := os.Create(filepath.Join(tmpDir, "var.tgz"))
+		Expect(err).ToNot(HaveOccurred())
+		h := sha256.New()
+		gzipWriter := gzip.NewWriter(io.MultiWriter(f, h))
+		tarWriter := tar.NewWriter(gzipWriter)
+		Expect(tarWriter.WriteHeader(&tar.Header{Name: "var/lib/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: created})).To(Succeed())
+		for name, content := range files {
+			Expect(tarWriter.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(content)),
+				ModTime: created, Uid: os.Getuid(), Gid: os.Getgid()})).To(Succeed())
+			_, err = tarWriter.Write([]byte(content))
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(tarWriter.Close()).To(Succeed())
+		Expect(gzipWriter.Close()).To(Succeed())
+		Expect(f.Close()).To(Succeed())
+		return "sha256:" + hex.EncodeToString(h.Sum(nil))
+	}
+
+	writeHostFile := func(name, content string, modTime time.Time) {
+		file := filepath.Join(tmpDir, "host", name)
+		Expect(os.MkdirAll(filepath.Dir(file), 0755)).To(Succeed())
+		Expect(os.WriteFile(file, []byte(content), 0600)).To(Succeed())
+		Expect(os.Chtimes(file, modTime, modTime)).To(Succeed())
+	}
+
+	It("Compares the sampled files with their host sources", func() {
+		digest := writeArchive(map[string]string{"var/lib/same": "same", "var/lib/tampered": "archived",
+			"var/lib/changed": "old", "var/lib/gone": "gone"})
+		writeHostFile("var/lib/same", "same", created)
+		writeHostFile("var/lib/tampered", "modified", created)
+		writeHostFile("var/lib/changed", "new", created.Add(time.Hour))
+		opsMock.EXPECT().RunInHostNamespace("podman", gomock.Any()).Return(`[{"Labels": {
+			"io.openshift.ibu.artifacts": "var.tgz",
+			"io.openshift.ibu.artifact.var.tgz": "`+digest+`"
+		}}]`, nil)
+
+		checks, sampled, err := VerifySample(containers.NewPodman(opsMock), "quay.io/org/seed:oneimage", tmpDir,
+			SampleConfig{Files: 10, HostRoot: filepath.Join(tmpDir, "host")})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(checks).To(HaveLen(1))
+		Expect(checks[0].ContentVerified).To(BeTrue())
+		Expect(sampled).To(HaveLen(4))
+		results := map[string]SampledFile{}
+		for _, file := range sampled {
+			results[file.Name] = file
+		}
+		Expect(results["var/lib/same"].HostVerified).To(BeTrue())
+		Expect(results["var/lib/same"].Error).ToNot(HaveOccurred())
+		Expect(results["var/lib/tampered"].Error).To(MatchError(ContainSubstring("digest mismatch")))
+		Expect(results["var/lib/changed"].HostVerified).To(BeFalse())
+		Expect(results["var/lib/changed"].Error).ToNot(HaveOccurred())
+		Expect(results["var/lib/gone"].HostVerified).To(BeFalse())
+	})
+
+	It("Draws a sample of the requested size", func() {
+		files := map[string]string{}
+		for i := 0; i < 100; i++ {
+			files[fmt.Sprintf("var/lib/%d", i)] = fmt.Sprint(i)
+		}
+		writeArchive(files)
+		samples, err := sampleArchive(filepath.Join(tmpDir, "var.tgz"), "sha256:0", 5, rand.New(rand.NewSource(1)))
+		Expect(err).To(MatchError(ContainSubstring("digest mismatch")))
+		Expect(samples).To(HaveLen(5))
+		names := map[string]bool{}
+		for _, drawn := range samples {
+			names[drawn.header.Name] = true
+			Expect(drawn.digest).To(HavePrefix("sha256:"))
+		}
+		Expect(names).To(HaveLen(5))
+	})
+})
@@ -0,0 +1,265 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package selinux
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// labelXattr is the extended attribute holding the SELinux label of a file
+	labelXattr = "security.selinux"
+	// noContext leaves the files a specification matches unlabeled
+	noContext = "<<none>>"
+	// fileContextsDir holds the file contexts of a policy, relative to the policy dir
+	fileContextsDir = "contexts/files"
+	// relabeledSample is how many relabeled paths a summary keeps
+	relabeledSample = 20
+	// metaChars are the regex characters ending the stem of a specification
+	metaChars = `.^$?*+|[({\`
+)
+
+var (
+	// fileContextsFiles are the file contexts of a policy, in precedence order
+	fileContextsFiles = []string{"file_contexts", "file_contexts.homedirs", "file_contexts.local"}
+	// substitutionFiles map path prefixes to the equivalent ones whose contexts apply
+	substitutionFiles = []string{"file_contexts.subs_dist", "file_contexts.subs"}
+
+	// fileTypes are the file types the specifications can be restricted to
+	fileTypes = map[string]os.FileMode{
+		"--": 0,
+		"-d": os.ModeDir,
+		"-l": os.ModeSymlink,
+		"-c": os.ModeDevice | os.ModeCharDevice,
+		"-b": os.ModeDevice,
+		"-s": os.ModeSocket,
+		"-p": os.ModeNamedPipe,
+	}
+
+	// getLabel and setLabel read and write the label of a file, without following symlinks
+	getLabel = func(path string) (string, error) {
+		buf := make([]byte, 256)
+		size, err := unix.Lgetxattr(path, labelXattr, buf)
+		if err == unix.ERANGE {
+			if size, err = unix.Lgetxattr(path, labelXattr, nil); err == nil {
+				buf = make([]byte, size)
+				size, err = unix.Lgetxattr(path, labelXattr, buf)
+			}
+		}
+		if err == unix.ENODATA {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(buf[:size]), "\x00"), nil
+	}
+	setLabel = func(path, label string) error {
+		return unix.Lsetxattr(path, labelXattr, []byte(label), 0)
+	}
+)
+
+// fileContext is a file context specification, labeling the paths matching its regex
+type fileContext struct {
+	regex *regexp.Regexp
+	// stem is the leading path component of the regex, only paths under it can match
+	stem string
+	// fileType restricts the specification to a file type, any when nil
+	fileType *os.FileMode
+	context  string
+}
+
+// FileContexts are the file context specifications of a policy, telling the label of every path like
+// setfiles and restorecon
+type FileContexts struct {
+	// specs are ordered by increasing precedence: regexes first, exact paths last
+	specs         []fileContext
+	substitutions [][2]string
+}
+
+// LoadFileContexts loads the file contexts of the policy the host whose filesystem is mounted at root boots with
+func LoadFileContexts(root string) (*FileContexts, error) {
+	config, err := os.ReadFile(filepath.Join(root, configFile))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read SELinux config")
+	}
+	_, policyType := ParseConfig(string(config))
+	if policyType == "" {
+		return nil, errors.New("SELinux config has no policy type")
+	}
+
+	dir := filepath.Join(root, "etc", "selinux", policyType, fileContextsDir)
+	contents := map[string]string{}
+	for _, name := range append(fileContextsFiles, substitutionFiles...) {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) && name != fileContextsFiles[0] {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read %s file contexts", policyType)
+		}
+		contents[name] = string(data)
+	}
+	return ParseFileContexts(contents)
+}
+
+// ParseFileContexts parses the file contexts and substitutions of a policy, by file name
+func ParseFileContexts(contents map[string]string) (*FileContexts, error) {
+	contexts := &FileContexts{}
+	var regexes, exact []fileContext
+	for _, name := range fileContextsFiles {
+		scanner := bufio.NewScanner(strings.NewReader(contents[name]))
+		for line := 1; scanner.Scan(); line++ {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			spec, err := parseFileContext(fields)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid file context at %s:%d", name, line)
+			}
+			if strings.ContainsAny(fields[0], metaChars) {
+				regexes = append(regexes, *spec)
+			} else {
+				exact = append(exact, *spec)
+			}
+		}
+	}
+	contexts.specs = append(regexes, exact...)
+
+	for _, name := range substitutionFiles {
+		scanner := bufio.NewScanner(strings.NewReader(contents[name]))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) != 2 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			contexts.substitutions = append(contexts.substitutions, [2]string{fields[0], fields[1]})
+		}
+	}
+	return contexts, nil
+}
+
+func parseFileContext(fields []string) (*fileContext, error) {
+	spec := &fileContext{}
+	switch len(fields) {
+	case 2:
+		spec.context = fields[1]
+	case 3:
+		fileType, ok := fileTypes[fields[1]]
+		if !ok {
+			return nil, errors.Errorf("unknown file type %s", fields[1])
+		}
+		spec.fileType, spec.context = &fileType, fields[2]
+	default:
+		return nil, errors.Errorf("expected a regex, an optional file type and a context, got %d fields", len(fields))
+	}
+
+	var err error
+	if spec.regex, err = regexp.Compile("^(?:" + fields[0] + ")$"); err != nil {
+		return nil, err
+	}
+	if end := strings.IndexByte(fields[0][1:], '/'); strings.HasPrefix(fields[0], "/") && end >= 0 &&
+		!strings.ContainsAny(fields[0][:end+1], metaChars) {
+		spec.stem = fields[0][:end+1]
+	}
+	return spec, nil
+}
+
+// Lookup returns the label of a path of the given file type, and false when the path is left unlabeled
+func (f *FileContexts) Lookup(path string, mode os.FileMode) (string, bool) {
+	for _, substitution := range f.substitutions {
+		if path == substitution[0] || strings.HasPrefix(path, substitution[0]+"/") {
+			path = substitution[1] + strings.TrimPrefix(path, substitution[0])
+			break
+		}
+	}
+	stem := path
+	if end := strings.IndexByte(path[1:], '/'); end >= 0 {
+		stem = path[:end+1]
+	}
+
+	for i := len(f.specs) - 1; i >= 0; i-- {
+		spec := f.specs[i]
+		if spec.stem != "" && spec.stem != stem {
+			continue
+		}
+		if spec.fileType != nil && *spec.fileType != mode.Type() {
+			continue
+		}
+		if spec.regex.MatchString(path) {
+			return spec.context, spec.context != noContext
+		}
+	}
+	return "", false
+}
+
+// RelabelSummary sums up the files a relabel checked and changed
+type RelabelSummary struct {
+	Checked   int
+	Relabeled int
+	// Unmatched files have no file context, their label is kept
+	Unmatched int
+	// Paths are the first relabeled paths
+	Paths []string
+}
+
+// Relabeler sets the labels of files to the ones of the policy file contexts, like restorecon
+type Relabeler struct {
+	contexts *FileContexts
+	Summary  RelabelSummary
+}
+
+func NewRelabeler(contexts *FileContexts) *Relabeler {
+	return &Relabeler{contexts: contexts}
+}
+
+// Relabel sets the label of file, located at path on the host, when it differs from the file contexts one
+func (r *Relabeler) Relabel(file, path string) error {
+	info, err := os.Lstat(file)
+	if err != nil {
+		return err
+	}
+	r.Summary.Checked++
+	label, ok := r.contexts.Lookup(path, info.Mode())
+	if !ok {
+		r.Summary.Unmatched++
+		return nil
+	}
+	current, err := getLabel(file)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read the SELinux label of %s", path)
+	}
+	if current == label {
+		return nil
+	}
+	if err = setLabel(file, label); err != nil {
+		return errors.Wrapf(err, "Failed to relabel %s to %s", path, label)
+	}
+	r.Summary.Relabeled++
+	if len(r.Summary.Paths) < relabeledSample {
+		r.Summary.Paths = append(r.Summary.Paths, path)
+	}
+	return nil
+}
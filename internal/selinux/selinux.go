@@ -0,0 +1,143 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package selinux
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ModeEnforcing denies and logs the accesses the policy doesn't allow
+	ModeEnforcing = "enforcing"
+	// ModePermissive only logs the accesses the policy doesn't allow
+	ModePermissive = "permissive"
+	// ModeDisabled doesn't load any policy, files created meanwhile aren't labeled
+	ModeDisabled = "disabled"
+
+	// selinuxFS is where the kernel exposes the SELinux state, relative to the root
+	selinuxFS = "sys/fs/selinux"
+	// configFile is the SELinux config applied on boot, relative to the root
+	configFile = "etc/selinux/config"
+	// autorelabelFile schedules a full relabel on next boot, relative to the root
+	autorelabelFile = ".autorelabel"
+)
+
+// State is the SELinux state of a host
+type State struct {
+	// Mode is the runtime mode
+	Mode string `json:"mode"`
+	// ConfigMode is the mode applied on boot, per /etc/selinux/config
+	ConfigMode string `json:"configMode"`
+	// PolicyType is the policy in use, e.g. targeted
+	PolicyType string `json:"policyType"`
+	// PolicyVersion is the policy version supported by the kernel, 0 when disabled
+	PolicyVersion int `json:"policyVersion"`
+}
+
+// Capture reads the SELinux state of the host whose filesystem is mounted at root
+func Capture(root string) (*State, error) {
+	config, err := os.ReadFile(filepath.Join(root, configFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "Failed to read SELinux config")
+	}
+	state := &State{Mode: ModeDisabled}
+	state.ConfigMode, state.PolicyType = ParseConfig(string(config))
+
+	enforce, err := os.ReadFile(filepath.Join(root, selinuxFS, "enforce"))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read SELinux mode")
+	}
+	state.Mode = ModePermissive
+	if strings.TrimSpace(string(enforce)) == "1" {
+		state.Mode = ModeEnforcing
+	}
+
+	version, err := os.ReadFile(filepath.Join(root, selinuxFS, "policyvers"))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read SELinux policy version")
+	}
+	if state.PolicyVersion, err = strconv.Atoi(strings.TrimSpace(string(version))); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse SELinux policy version")
+	}
+	return state, nil
+}
+
+// ParseConfig returns the boot mode and policy type of an /etc/selinux/config content. A missing
+// config disables SELinux.
+func ParseConfig(content string) (mode, policyType string) {
+	mode = ModeDisabled
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !found || strings.HasPrefix(key, "#") {
+			continue
+		}
+		value = strings.ToLower(strings.Trim(strings.TrimSpace(value), `"`))
+		switch strings.TrimSpace(key) {
+		case "SELINUX":
+			mode = value
+		case "SELINUXTYPE":
+			policyType = value
+		}
+	}
+	return mode, policyType
+}
+
+// Plan is what the restore has to do for the SELinux labels of the seed to be valid on the target
+type Plan struct {
+	// Relabel schedules a full relabel on the first boot of the restored target
+	Relabel bool
+	// Reasons explain why a relabel is needed
+	Reasons []string
+}
+
+// Compare checks the seed SELinux state is compatible with the target one. Restoring an
+// enforcing seed to a permissive target, or vice versa, is refused unless allowModeChange is set,
+// since the mix is a known cause of boot loops.
+func Compare(seed, target *State, allowModeChange bool) (*Plan, error) {
+	if seed.Mode != target.Mode && !allowModeChange {
+		return nil, errors.Errorf("SELinux mode mismatch: seed is %s, target is %s", seed.Mode, target.Mode)
+	}
+
+	plan := &Plan{}
+	if seed.Mode == ModeDisabled && target.Mode != ModeDisabled {
+		plan.Reasons = append(plan.Reasons, "seed files were created with SELinux disabled and carry no labels")
+	}
+	if seed.PolicyType != target.PolicyType {
+		plan.Reasons = append(plan.Reasons, "policy type changes from "+seed.PolicyType+" to "+target.PolicyType)
+	}
+	if seed.PolicyVersion != target.PolicyVersion && seed.Mode != ModeDisabled && target.Mode != ModeDisabled {
+		plan.Reasons = append(plan.Reasons, "policy version changes from "+strconv.Itoa(seed.PolicyVersion)+
+			" to "+strconv.Itoa(target.PolicyVersion))
+	}
+	plan.Relabel = len(plan.Reasons) > 0
+	return plan, nil
+}
+
+// ScheduleRelabel schedules a full relabel on next boot of the host whose filesystem is mounted at root
+func ScheduleRelabel(root string) error {
+	return errors.Wrap(os.WriteFile(filepath.Join(root, autorelabelFile), nil, 0644), "Failed to schedule SELinux relabel")
+}
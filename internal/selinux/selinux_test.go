@@ -0,0 +1,127 @@
+package selinux
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSELinux(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SELinux Suite")
+}
+
+var _ = Describe("SELinux state", func() {
+	var root string
+
+	BeforeEach(func() {
+		root, _ = os.MkdirTemp("", "test")
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(root)).To(Succeed())
+	})
+
+	writeFile := func(name, content string) {
+		Expect(os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, name), []byte(content), 0644)).To(Succeed())
+	}
+
+	It("Captures the runtime and boot state", func() {
+		writeFile(configFile, "# comment\nSELINUX=enforcing\nSELINUXTYPE=targeted\n")
+		writeFile(filepath.Join(selinuxFS, "enforce"), "1")
+		writeFile(filepath.Join(selinuxFS, "policyvers"), "33\n")
+		Expect(Capture(root)).To(Equal(&State{Mode: ModeEnforcing, ConfigMode: ModeEnforcing, PolicyType: "targeted", PolicyVersion: 33}))
+	})
+
+	It("Reports SELinux disabled without selinuxfs", func() {
+		Expect(Capture(root)).To(Equal(&State{Mode: ModeDisabled, ConfigMode: ModeDisabled}))
+	})
+
+	It("Refuses mixing enforcing and permissive", func() {
+		seed := &State{Mode: ModeEnforcing, PolicyType: "targeted", PolicyVersion: 33}
+		target := &State{Mode: ModePermissive, PolicyType: "targeted", PolicyVersion: 33}
+		_, err := Compare(seed, target, false)
+		Expect(err).To(HaveOccurred())
+
+		plan, err := Compare(seed, target, true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(plan.Relabel).To(BeFalse())
+	})
+
+	It("Relabels when the policy changes", func() {
+		seed := &State{Mode: ModeEnforcing, PolicyType: "targeted", PolicyVersion: 33}
+		plan, err := Compare(seed, &State{Mode: ModeEnforcing, PolicyType: "targeted", PolicyVersion: 31}, false)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(plan.Relabel).To(BeTrue())
+
+		Expect(ScheduleRelabel(root)).To(Succeed())
+		Expect(filepath.Join(root, autorelabelFile)).To(BeAnExistingFile())
+	})
+
+	Context("Relabel", func() {
+		var labels map[string]string
+
+		BeforeEach(func() {
+			writeFile(configFile, "SELINUX=enforcing\nSELINUXTYPE=targeted\n")
+			writeFile("etc/selinux/targeted/contexts/files/file_contexts", `
+/.*                        system_u:object_r:default_t:s0
+/etc(/.*)?                 system_u:object_r:etc_t:s0
+/etc/hosts                 system_u:object_r:net_conf_t:s0
+/var/lib/kubelet(/.*)?     system_u:object_r:container_var_lib_t:s0
+/var/lib/kubelet/pods      -d system_u:object_r:container_file_t:s0
+/var/lib/kubelet/cache(/.*)?  <<none>>
+`)
+			writeFile("etc/selinux/targeted/contexts/files/file_contexts.subs_dist", "/var/home /home\n")
+			writeFile("etc/selinux/targeted/contexts/files/file_contexts.homedirs", "/home/[^/]+(/.*)?  unconfined_u:object_r:user_home_t:s0\n")
+
+			labels = map[string]string{}
+			getLabel = func(path string) (string, error) { return labels[path], nil }
+			setLabel = func(path, label string) error {
+				labels[path] = label
+				return nil
+			}
+		})
+
+		It("Looks the labels up like restorecon", func() {
+			contexts, err := LoadFileContexts(root)
+			Expect(err).ToNot(HaveOccurred())
+
+			lookup := func(path string, mode os.FileMode) string {
+				label, _ := contexts.Lookup(path, mode)
+				return label
+			}
+			Expect(lookup("/etc/hosts", 0)).To(Equal("system_u:object_r:net_conf_t:s0"))
+			Expect(lookup("/etc/hostname", 0)).To(Equal("system_u:object_r:etc_t:s0"))
+			Expect(lookup("/var/lib/kubelet/pods", os.ModeDir)).To(Equal("system_u:object_r:container_file_t:s0"))
+			Expect(lookup("/var/lib/kubelet/pods", 0)).To(Equal("system_u:object_r:container_var_lib_t:s0"))
+			Expect(lookup("/var/home/core/.ssh", os.ModeDir)).To(Equal("unconfined_u:object_r:user_home_t:s0"))
+			Expect(lookup("/opt/agent", 0)).To(Equal("system_u:object_r:default_t:s0"))
+			_, ok := contexts.Lookup("/var/lib/kubelet/cache/entry", 0)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("Relabels only the files whose label differs", func() {
+			contexts, err := LoadFileContexts(root)
+			Expect(err).ToNot(HaveOccurred())
+			writeFile("seed/etc/hosts", "")
+			writeFile("seed/etc/hostname", "")
+			hosts, hostname := filepath.Join(root, "seed/etc/hosts"), filepath.Join(root, "seed/etc/hostname")
+			labels[hosts] = "system_u:object_r:unknown_seed_t:s0"
+			labels[hostname] = "system_u:object_r:etc_t:s0"
+
+			relabeler := NewRelabeler(contexts)
+			Expect(relabeler.Relabel(hosts, "/etc/hosts")).To(Succeed())
+			Expect(relabeler.Relabel(hostname, "/etc/hostname")).To(Succeed())
+			Expect(labels[hosts]).To(Equal("system_u:object_r:net_conf_t:s0"))
+			Expect(relabeler.Summary).To(Equal(RelabelSummary{Checked: 2, Relabeled: 1, Paths: []string{"/etc/hosts"}}))
+		})
+
+		It("Refuses invalid file contexts", func() {
+			_, err := ParseFileContexts(map[string]string{"file_contexts": "/etc(/.*)? -x system_u:object_r:etc_t:s0\n"})
+			Expect(err).To(MatchError(ContainSubstring("file_contexts:1")))
+		})
+	})
+})
@@ -0,0 +1,120 @@
+package simulate
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// localMounts are the paths of the local host the simulation needs, bind mounted into the fake root when
+// they exist: the commands, the runtime storage and sockets, and the user and name resolution of /etc
+var localMounts = []string{
+	"/usr", "/dev", "/sys",
+	"/var/lib/containers", "/run/containers", "/run/podman", "/run/docker.sock",
+	"/etc/containers", "/etc/alternatives", "/etc/ld.so.cache", "/etc/passwd", "/etc/group", "/etc/nsswitch.conf",
+	"/etc/resolv.conf", "/etc/hosts", "/etc/ssl", "/etc/pki", "/etc/localtime",
+}
+
+// readOnlyMounts are the local mounts the simulation must never write to
+var readOnlyMounts = map[string]bool{"/usr": true, "/sys": true}
+
+// preservedFlags are the mount flags a read-only remount of a bind mount has to keep, the kernel refuses
+// dropping them in a user namespace
+const preservedFlags = unix.ST_NOSUID | unix.ST_NODEV | unix.ST_NOEXEC | unix.ST_NOATIME | unix.ST_NODIRATIME |
+	unix.ST_RELATIME
+
+// Run re-executes the imager with the given arguments in new mount and PID namespaces, where it enters
+// the fake root. Users other than root are mapped to root of a new user namespace, root keeps its
+// credentials for the container runtime sockets.
+func Run(root string, args []string) error {
+	cmd := exec.Command("/proc/self/exe", args...)
+	cmd.Env = append(os.Environ(), RootEnv+"="+root)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWNS | syscall.CLONE_NEWPID}
+	if uid, gid := os.Getuid(), os.Getgid(); uid != 0 {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER
+		cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: uid, Size: 1}}
+		cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: gid, Size: 1}}
+	}
+	return errors.Wrap(cmd.Run(), "Simulated seed creation failed")
+}
+
+// Enter mounts the local commands and a new /proc into the fake root and chroots into it, with the host
+// command stubs first in the PATH. It must only be called by the imager Run re-executes.
+func Enter(root string) error {
+	// The mounts must not propagate back to the local host
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return errors.Wrap(err, "Failed to make the mounts private")
+	}
+	for _, dir := range systemDirs {
+		if info, err := os.Lstat(filepath.Join(root, dir)); err == nil && info.IsDir() {
+			if err = bindMount("/"+dir, filepath.Join(root, dir), true); err != nil {
+				return err
+			}
+		}
+	}
+	for _, source := range localMounts {
+		if _, err := os.Stat(source); err != nil {
+			continue
+		}
+		if err := bindMount(source, filepath.Join(root, source), readOnlyMounts[source]); err != nil {
+			return err
+		}
+	}
+
+	// /usr/local is carried by /var on CoreOS
+	if err := bindMount(filepath.Join(root, "var/usrlocal"), filepath.Join(root, "usr/local"), false); err != nil {
+		return err
+	}
+	if err := unix.Mount("proc", filepath.Join(root, "proc"), "proc", 0, ""); err != nil {
+		return errors.Wrap(err, "Failed to mount /proc")
+	}
+	// The kernel command line is the one of the fake host, matching its bootloader entries
+	if err := bindMount(filepath.Join(root, "simulate/fixtures/cmdline"), filepath.Join(root, "proc/cmdline"), true); err != nil {
+		return err
+	}
+
+	if err := unix.Chroot(root); err != nil {
+		return errors.Wrapf(err, "Failed to chroot into %s", root)
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+	return os.Setenv("PATH", strings.Join([]string{"/" + binDir, os.Getenv("PATH")}, ":"))
+}
+
+// bindMount mounts source at target, creating the target like the source
+func bindMount(source, target string, readOnly bool) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		err = os.MkdirAll(target, 0755)
+	} else if _, err = os.Stat(target); os.IsNotExist(err) {
+		if err = os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+			err = os.WriteFile(target, nil, 0644)
+		}
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create the mount point of %s", source)
+	}
+
+	if err = unix.Mount(source, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return errors.Wrapf(err, "Failed to bind mount %s", source)
+	}
+	if !readOnly {
+		return nil
+	}
+	var stat unix.Statfs_t
+	if err = unix.Statfs(target, &stat); err != nil {
+		return err
+	}
+	flags := uintptr(stat.Flags&preservedFlags) | unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY
+	return errors.Wrapf(unix.Mount("", target, "", flags, ""), "Failed to make %s read-only", source)
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package simulate generates the fake single-node OpenShift host the simulate command creates a seed
+// from: a /etc, /var, ostree repo and bootloader tree, and stubs answering the crictl, oc, systemctl and
+// rpm-ostree queries of the seed creation from fixtures. The seed creation runs chrooted into it, so the
+// whole orchestration runs on laptops and CI runners and builds a real seed image.
+package simulate
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cp "github.com/otiai10/copy"
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/archive"
+)
+
+const (
+	// RootEnv holds the fake root the re-executed imager enters, it's only set within the simulation
+	RootEnv = "IBU_IMAGER_SIMULATE_ROOT"
+	// OutputDir is where the simulated seed image is exported to, within the fake root
+	OutputDir = "/output"
+
+	// treeDir is the embedded host tree
+	treeDir = "host"
+	// binDir holds the host command stubs, relative to the root
+	binDir = "simulate/bin"
+)
+
+// SkippedSteps are the seed creation steps needing a live etcd or the recert containers, which the fake
+// host doesn't run
+var SkippedSteps = []string{"etcd-sanity", "etcd-summary", "resolve-recert-image", "recert-dry-run"}
+
+//go:embed all:host
+var hostTree embed.FS
+
+// emptyDirs are the directories of the fake root the host tree has no files in, relative to the root
+var emptyDirs = []string{"var/tmp", "var/log", "var/lib/containers", "var/usrlocal", "usr", "dev", "proc", "sys",
+	"tmp", "simulate/state"}
+
+// symlinks are the CoreOS symlinks of the fake root, relative to the root
+var symlinks = map[string]string{
+	"ostree":  "sysroot/ostree",
+	"var/run": "../run",
+}
+
+// systemDirs are the directories of the local host the commands run from, bind mounted unless they are
+// symlinks to /usr, like on merged /usr distributions
+var systemDirs = []string{"bin", "sbin", "lib", "lib32", "lib64", "libx32"}
+
+// Generate writes the fake host tree to root, which must be missing or empty, along with the installation
+// configuration files the seed creation copies, at the same relative path
+func Generate(root, installationFiles string) error {
+	entries, err := os.ReadDir(root)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(entries) > 0 {
+		return errors.Errorf("The simulation root %s isn't empty", root)
+	}
+
+	err = fs.WalkDir(hostTree, treeDir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(root, strings.TrimPrefix(name, treeDir))
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := hostTree.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		mode := os.FileMode(0644)
+		if filepath.Dir(name) == filepath.Join(treeDir, binDir) {
+			mode = 0755
+		}
+		return os.WriteFile(target, data, mode)
+	})
+	if err != nil {
+		return errors.Wrap(err, "Failed to write the fake host tree")
+	}
+
+	for _, dir := range emptyDirs {
+		if err = os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			return err
+		}
+	}
+	for link, target := range symlinks {
+		if err = os.Symlink(target, filepath.Join(root, link)); err != nil {
+			return err
+		}
+	}
+	for _, dir := range systemDirs {
+		if err = mirrorSystemDir(root, dir); err != nil {
+			return err
+		}
+	}
+
+	if !filepath.IsLocal(installationFiles) {
+		return errors.Errorf("The installation configuration files %s must be relative to the working directory", installationFiles)
+	}
+	return errors.Wrapf(cp.Copy(installationFiles, filepath.Join(root, installationFiles)),
+		"Failed to copy the installation configuration files, simulate runs from the imager source or image dir")
+}
+
+// mirrorSystemDir creates the mount point of the local system dir in root, or the same symlink
+func mirrorSystemDir(root, dir string) error {
+	info, err := os.Lstat("/" + dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return os.MkdirAll(filepath.Join(root, dir), 0755)
+	}
+	target, err := os.Readlink("/" + dir)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(target, filepath.Join(root, dir))
+}
+
+// Collect moves the files exported by the simulation out of the fake root, to dir
+func Collect(root, dir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(root, OutputDir))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list the simulation output")
+	}
+	var collected []string
+	for _, entry := range entries {
+		source, target := filepath.Join(root, OutputDir, entry.Name()), filepath.Join(dir, entry.Name())
+		// The fake root is usually a temporary dir, on another filesystem
+		if err = os.Rename(source, target); err != nil {
+			if err = archive.CopyFile(source, target); err != nil {
+				return nil, errors.Wrapf(err, "Failed to collect %s", entry.Name())
+			}
+		}
+		collected = append(collected, target)
+	}
+	return collected, nil
+}
@@ -0,0 +1,65 @@
+package simulate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSimulate(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Simulate Suite")
+}
+
+var _ = Describe("Fake host", func() {
+	var (
+		tmpDir string
+		root   string
+		cwd    string
+	)
+
+	BeforeEach(func() {
+		tmpDir, _ = os.MkdirTemp("", "test")
+		root = filepath.Join(tmpDir, "root")
+		cwd, _ = os.Getwd()
+		Expect(os.MkdirAll(filepath.Join(tmpDir, "installation_configuration_files", "scripts"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(tmpDir, "installation_configuration_files", "scripts", "run.sh"), []byte("#!/bin/bash\n"), 0755)).To(Succeed())
+		Expect(os.Chdir(tmpDir)).To(Succeed())
+	})
+	AfterEach(func() {
+		Expect(os.Chdir(cwd)).To(Succeed())
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("Generates the host tree with the command stubs", func() {
+		Expect(Generate(root, "installation_configuration_files")).To(Succeed())
+
+		Expect(filepath.Join(root, "etc", "machine-config-daemon", "currentconfig")).To(BeAnExistingFile())
+		Expect(filepath.Join(root, "var", "home", "core", ".bashrc")).To(BeAnExistingFile())
+		Expect(filepath.Join(root, "installation_configuration_files", "scripts", "run.sh")).To(BeAnExistingFile())
+		Expect(filepath.Join(root, "var", "tmp")).To(BeADirectory())
+		info, err := os.Stat(filepath.Join(root, binDir, "crictl"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
+
+		Expect(os.Readlink(filepath.Join(root, "ostree"))).To(Equal("sysroot/ostree"))
+		Expect(filepath.Join(root, "ostree", "repo", "config")).To(BeAnExistingFile())
+	})
+
+	It("Refuses a root that isn't empty", func() {
+		Expect(os.MkdirAll(filepath.Join(root, "etc"), 0755)).To(Succeed())
+		Expect(Generate(root, "installation_configuration_files")).To(MatchError(ContainSubstring("isn't empty")))
+	})
+
+	It("Collects the exported seed image", func() {
+		Expect(os.MkdirAll(filepath.Join(root, OutputDir), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, OutputDir, "seed.tar"), []byte("image"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, OutputDir, "seed.tar.sha256"), []byte("sum  seed.tar\n"), 0644)).To(Succeed())
+
+		Expect(Collect(root, tmpDir)).To(Equal([]string{filepath.Join(tmpDir, "seed.tar"), filepath.Join(tmpDir, "seed.tar.sha256")}))
+		Expect(filepath.Join(tmpDir, "seed.tar")).To(BeAnExistingFile())
+	})
+})
@@ -0,0 +1,129 @@
+package site_config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ClusterConfigurationDir holds the manifests installation-configuration.sh applies on first boot
+	ClusterConfigurationDir = "var/opt/openshift/cluster-configuration"
+	// NetworkConfigurationDir holds the connections prepare-installation-configuration.sh installs on first boot
+	NetworkConfigurationDir = "var/opt/openshift/network-configuration"
+
+	// clusterRelocationAPIVersion is the API of the ClusterRelocation reconfiguring the cluster domain and mirrors
+	clusterRelocationAPIVersion = "rhsyseng.github.io/v1beta1"
+)
+
+// File is a file rendered out of the site config, its path relative to the root of the new
+// deployment: /etc files belong in the deployment, /var ones in the stateroot
+type File struct {
+	Path    string
+	Content []byte
+	Mode    os.FileMode
+}
+
+// metadata is the object metadata of the rendered manifests
+type metadata struct {
+	Name string `yaml:"name"`
+}
+
+type clusterRelocation struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Metadata   metadata `yaml:"metadata"`
+	Spec       struct {
+		Domain             string           `yaml:"domain"`
+		ImageDigestMirrors []RegistryMirror `yaml:"imageDigestMirrors,omitempty"`
+	} `yaml:"spec"`
+}
+
+type proxy struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Metadata   metadata `yaml:"metadata"`
+	Spec       struct {
+		HTTPProxy  string `yaml:"httpProxy,omitempty"`
+		HTTPSProxy string `yaml:"httpsProxy,omitempty"`
+		NoProxy    string `yaml:"noProxy,omitempty"`
+	} `yaml:"spec"`
+}
+
+// Render returns the files reconfiguring the node to the site on first boot of the new stateroot:
+// the ClusterRelocation renaming the cluster and adding the mirrors, the cluster proxy, the static
+// network connection, hostname and chrony configuration
+func (c *SiteConfig) Render() ([]File, error) {
+	relocation := clusterRelocation{APIVersion: clusterRelocationAPIVersion, Kind: "ClusterRelocation", Metadata: metadata{Name: "cluster"}}
+	relocation.Spec.Domain = c.Domain()
+	relocation.Spec.ImageDigestMirrors = c.RegistryMirrors
+	data, err := yaml.Marshal(relocation)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to render the cluster relocation")
+	}
+	files := []File{{Path: path.Join(ClusterConfigurationDir, "cluster-relocation.yaml"), Content: data, Mode: 0600}}
+
+	if c.Proxy != nil {
+		clusterProxy := proxy{APIVersion: "config.openshift.io/v1", Kind: "Proxy", Metadata: metadata{Name: "cluster"}}
+		clusterProxy.Spec.HTTPProxy = c.Proxy.HTTPProxy
+		clusterProxy.Spec.HTTPSProxy = c.Proxy.HTTPSProxy
+		clusterProxy.Spec.NoProxy = strings.Join(c.Proxy.NoProxy, ",")
+		if data, err = yaml.Marshal(clusterProxy); err != nil {
+			return nil, errors.Wrap(err, "Failed to render the cluster proxy")
+		}
+		files = append(files, File{Path: path.Join(ClusterConfigurationDir, "proxy.yaml"), Content: data, Mode: 0600})
+	}
+	if c.Network != nil {
+		// NetworkManager ignores keyfiles readable by others
+		files = append(files, File{
+			Path:    path.Join(NetworkConfigurationDir, c.Network.Interface+".nmconnection"),
+			Content: []byte(c.Network.keyfile()),
+			Mode:    0600,
+		})
+	}
+	if c.Hostname != "" {
+		files = append(files, File{Path: "etc/hostname", Content: []byte(c.Hostname + "\n"), Mode: 0644})
+	}
+	if c.NTP != nil {
+		files = append(files, File{Path: "etc/chrony.conf", Content: []byte(c.NTP.chronyConf()), Mode: 0644})
+	}
+	return files, nil
+}
+
+// keyfile returns the NetworkManager keyfile of the static ethernet connection
+func (n *Network) keyfile() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[connection]\nid=%s\ntype=ethernet\ninterface-name=%s\nautoconnect=true\n", n.Interface, n.Interface)
+
+	ip, _, _ := net.ParseCIDR(n.Address)
+	static, other := "ipv4", "ipv6"
+	if ip.To4() == nil {
+		static, other = "ipv6", "ipv4"
+	}
+	fmt.Fprintf(&b, "\n[%s]\nmethod=manual\naddress1=%s", static, n.Address)
+	if n.Gateway != "" {
+		fmt.Fprintf(&b, ",%s", n.Gateway)
+	}
+	b.WriteString("\n")
+	if len(n.DNSServers) > 0 {
+		fmt.Fprintf(&b, "dns=%s;\n", strings.Join(n.DNSServers, ";"))
+	}
+	fmt.Fprintf(&b, "\n[%s]\nmethod=disabled\n", other)
+	return b.String()
+}
+
+// chronyConf returns the chrony configuration of the RHCOS default, with the site servers
+func (n *NTP) chronyConf() string {
+	var b strings.Builder
+	b.WriteString("# Generated by ibu-imager from the site config\n")
+	for _, server := range n.Servers {
+		fmt.Fprintf(&b, "server %s iburst\n", server)
+	}
+	b.WriteString("driftfile /var/lib/chrony/drift\nmakestep 1.0 3\nrtcsync\nkeyfile /etc/chrony.keys\nleapsectz right/UTC\nlogdir /var/log/chrony\n")
+	return b.String()
+}
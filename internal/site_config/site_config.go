@@ -0,0 +1,294 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package site_config reads the site config bundle describing the target site of a relocated seed:
+// its cluster name and domain, node network, proxy, NTP servers and registry mirrors. The bundle
+// is the single input of a restore, rendered to the files first boot reconfigures the node from.
+package site_config
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// APIVersion is the site config schema version read by this version of the imager
+	APIVersion = "ibu-imager/v1"
+	// Kind is the kind of a site config bundle
+	Kind = "SiteConfig"
+
+	maxLabelLength     = 63
+	maxSubdomainLength = 253
+)
+
+// dnsLabel is an RFC 1123 DNS label, as cluster names must be
+var dnsLabel = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// SiteConfig is the site config bundle. Only the cluster name and base domain are required, the
+// node keeps the seed configuration for the sections left out.
+type SiteConfig struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	// ClusterName and BaseDomain make the new cluster domain, <clusterName>.<baseDomain>
+	ClusterName string `yaml:"clusterName"`
+	BaseDomain  string `yaml:"baseDomain"`
+	// Hostname is the new node hostname
+	Hostname        string           `yaml:"hostname,omitempty"`
+	Network         *Network         `yaml:"network,omitempty"`
+	Proxy           *Proxy           `yaml:"proxy,omitempty"`
+	NTP             *NTP             `yaml:"ntp,omitempty"`
+	RegistryMirrors []RegistryMirror `yaml:"registryMirrors,omitempty"`
+	// Restore selects the seed image restored, instead of the restore flags
+	Restore *Restore `yaml:"restore,omitempty"`
+}
+
+// Network is the static configuration of the node interface, DHCP is kept without it
+type Network struct {
+	Interface string `yaml:"interface"`
+	// Address is the node IP address in CIDR notation, e.g. 192.168.122.10/24
+	Address    string   `yaml:"address"`
+	Gateway    string   `yaml:"gateway,omitempty"`
+	DNSServers []string `yaml:"dnsServers,omitempty"`
+}
+
+// Proxy is the cluster-wide egress proxy
+type Proxy struct {
+	HTTPProxy  string   `yaml:"httpProxy,omitempty"`
+	HTTPSProxy string   `yaml:"httpsProxy,omitempty"`
+	NoProxy    []string `yaml:"noProxy,omitempty"`
+}
+
+// NTP are the time sources of the node, replacing the seed chrony configuration
+type NTP struct {
+	Servers []string `yaml:"servers"`
+}
+
+// RegistryMirror mirrors the images of a source repository, e.g. for disconnected sites
+type RegistryMirror struct {
+	Source  string   `yaml:"source"`
+	Mirrors []string `yaml:"mirrors"`
+}
+
+// Restore are the restore settings of the bundle, the restore flags take precedence over them
+type Restore struct {
+	SeedImage     string `yaml:"seedImage,omitempty"`
+	Stateroot     string `yaml:"stateroot,omitempty"`
+	SSHKeysPolicy string `yaml:"sshKeysPolicy,omitempty"`
+}
+
+// ValidationError lists every field of a site config not matching the schema
+type ValidationError struct {
+	Fields []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid site config:\n  " + strings.Join(e.Fields, "\n  ")
+}
+
+// Load reads and validates a site config bundle
+func Load(file string) (*SiteConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read site config %s", file)
+	}
+	config, err := Parse(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Site config %s", file)
+	}
+	return config, nil
+}
+
+// Parse parses and validates a site config bundle. Unknown fields are refused, so a misspelled
+// setting fails the restore rather than being silently left out.
+func Parse(data []byte) (*SiteConfig, error) {
+	var config SiteConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse site config")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Domain returns the new cluster domain
+func (c *SiteConfig) Domain() string {
+	return c.ClusterName + "." + c.BaseDomain
+}
+
+// Validate checks the bundle against the site config schema, reporting every invalid field at once
+func (c *SiteConfig) Validate() error {
+	var v validator
+	if c.APIVersion != APIVersion {
+		v.fail("apiVersion", "must be %s, got %q", APIVersion, c.APIVersion)
+	}
+	if c.Kind != Kind {
+		v.fail("kind", "must be %s, got %q", Kind, c.Kind)
+	}
+	v.label("clusterName", c.ClusterName)
+	v.subdomain("baseDomain", c.BaseDomain)
+	if len(c.Domain()) > maxSubdomainLength {
+		v.fail("baseDomain", "the cluster domain %s is longer than %d characters", c.Domain(), maxSubdomainLength)
+	}
+	if c.Hostname != "" {
+		v.subdomain("hostname", c.Hostname)
+	}
+
+	if c.Network != nil {
+		c.Network.validate(&v)
+	}
+	if c.Proxy != nil {
+		c.Proxy.validate(&v)
+	}
+	if c.NTP != nil {
+		if len(c.NTP.Servers) == 0 {
+			v.fail("ntp.servers", "at least one server is required")
+		}
+		for i, server := range c.NTP.Servers {
+			if net.ParseIP(server) == nil {
+				v.subdomain(fmt.Sprintf("ntp.servers[%d]", i), server)
+			}
+		}
+	}
+	for i, mirror := range c.RegistryMirrors {
+		field := fmt.Sprintf("registryMirrors[%d]", i)
+		v.repository(field+".source", mirror.Source)
+		if len(mirror.Mirrors) == 0 {
+			v.fail(field+".mirrors", "at least one mirror is required")
+		}
+		for j, m := range mirror.Mirrors {
+			v.repository(fmt.Sprintf("%s.mirrors[%d]", field, j), m)
+		}
+	}
+
+	if len(v.fields) > 0 {
+		return &ValidationError{Fields: v.fields}
+	}
+	return nil
+}
+
+func (n *Network) validate(v *validator) {
+	if n.Interface == "" {
+		v.fail("network.interface", "is required")
+	} else if strings.ContainsAny(n.Interface, "/ \t") {
+		v.fail("network.interface", "invalid interface name %q", n.Interface)
+	}
+	ip, _, err := net.ParseCIDR(n.Address)
+	if err != nil {
+		v.fail("network.address", "must be an IP address in CIDR notation, got %q", n.Address)
+	}
+	if n.Gateway != "" {
+		gateway := net.ParseIP(n.Gateway)
+		switch {
+		case gateway == nil:
+			v.fail("network.gateway", "invalid IP address %q", n.Gateway)
+		case ip != nil && (gateway.To4() == nil) != (ip.To4() == nil):
+			v.fail("network.gateway", "%s is not of the address family of %s", n.Gateway, n.Address)
+		}
+	}
+	for i, server := range n.DNSServers {
+		if net.ParseIP(server) == nil {
+			v.fail(fmt.Sprintf("network.dnsServers[%d]", i), "invalid IP address %q", server)
+		}
+	}
+}
+
+func (p *Proxy) validate(v *validator) {
+	if p.HTTPProxy == "" && p.HTTPSProxy == "" {
+		v.fail("proxy", "httpProxy or httpsProxy is required")
+	}
+	if p.HTTPProxy != "" {
+		v.proxyURL("proxy.httpProxy", p.HTTPProxy, "http")
+	}
+	if p.HTTPSProxy != "" {
+		v.proxyURL("proxy.httpsProxy", p.HTTPSProxy, "http", "https")
+	}
+	for i, entry := range p.NoProxy {
+		if entry == "" || strings.ContainsAny(entry, ", \t") {
+			v.fail(fmt.Sprintf("proxy.noProxy[%d]", i), "invalid entry %q", entry)
+		}
+	}
+}
+
+// validator collects the invalid fields of a site config
+type validator struct {
+	fields []string
+}
+
+func (v *validator) fail(field, format string, args ...interface{}) {
+	v.fields = append(v.fields, field+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validator) label(field, value string) {
+	if value == "" {
+		v.fail(field, "is required")
+	} else if len(value) > maxLabelLength || !dnsLabel.MatchString(value) {
+		v.fail(field, "%q is not a valid DNS label", value)
+	}
+}
+
+func (v *validator) subdomain(field, value string) {
+	if value == "" {
+		v.fail(field, "is required")
+		return
+	}
+	if len(value) > maxSubdomainLength {
+		v.fail(field, "%q is longer than %d characters", value, maxSubdomainLength)
+		return
+	}
+	for _, label := range strings.Split(value, ".") {
+		if len(label) > maxLabelLength || !dnsLabel.MatchString(label) {
+			v.fail(field, "%q is not a valid DNS name", value)
+			return
+		}
+	}
+}
+
+func (v *validator) proxyURL(field, value string, schemes ...string) {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		v.fail(field, "invalid URL %q", value)
+		return
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return
+		}
+	}
+	v.fail(field, "%q must use one of the schemes: %s", value, strings.Join(schemes, ", "))
+}
+
+// repository checks an image repository reference, without scheme, tag nor digest
+func (v *validator) repository(field, value string) {
+	switch {
+	case value == "":
+		v.fail(field, "is required")
+	case strings.Contains(value, "://"):
+		v.fail(field, "%q must not have a scheme", value)
+	case strings.ContainsAny(value, "@ \t"):
+		v.fail(field, "%q must be a repository, without digest", value)
+	}
+}
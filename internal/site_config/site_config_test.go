@@ -0,0 +1,93 @@
+package site_config
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSiteConfig(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Site Config Suite")
+}
+
+const bundle = `apiVersion: ibu-imager/v1
+kind: SiteConfig
+clusterName: sno2
+baseDomain: example.com
+hostname: sno2
+network:
+  interface: ens3
+  address: 192.168.122.10/24
+  gateway: 192.168.122.1
+  dnsServers: [192.168.122.1]
+proxy:
+  httpProxy: http://proxy.example.com:3128
+  noProxy: [.cluster.local, 10.0.0.0/8]
+ntp:
+  servers: [clock.example.com, 192.168.122.1]
+registryMirrors:
+  - source: quay.io/openshift-release-dev/ocp-release
+    mirrors: [registry.example.com:5000/ocp-release]
+restore:
+  seedImage: quay.io/org/seed:oneimage
+`
+
+var _ = Describe("Site config", func() {
+	It("Parses and renders a full bundle", func() {
+		config, err := Parse([]byte(bundle))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(config.Domain()).To(Equal("sno2.example.com"))
+		Expect(config.Restore.SeedImage).To(Equal("quay.io/org/seed:oneimage"))
+
+		files, err := config.Render()
+		Expect(err).ToNot(HaveOccurred())
+		contents := map[string]string{}
+		for _, file := range files {
+			contents[file.Path] = string(file.Content)
+		}
+		Expect(contents).To(HaveLen(5))
+		Expect(contents[ClusterConfigurationDir+"/cluster-relocation.yaml"]).To(And(
+			ContainSubstring("domain: sno2.example.com"),
+			ContainSubstring("- registry.example.com:5000/ocp-release")))
+		Expect(contents[ClusterConfigurationDir+"/proxy.yaml"]).To(ContainSubstring("noProxy: .cluster.local,10.0.0.0/8"))
+		Expect(contents[NetworkConfigurationDir+"/ens3.nmconnection"]).To(And(
+			ContainSubstring("[ipv4]\nmethod=manual\naddress1=192.168.122.10/24,192.168.122.1\ndns=192.168.122.1;\n"),
+			ContainSubstring("[ipv6]\nmethod=disabled")))
+		Expect(contents["etc/chrony.conf"]).To(ContainSubstring("server clock.example.com iburst\nserver 192.168.122.1 iburst\n"))
+	})
+
+	It("Only renders the cluster relocation of a minimal bundle", func() {
+		config, err := Parse([]byte("apiVersion: ibu-imager/v1\nkind: SiteConfig\nclusterName: sno2\nbaseDomain: example.com\n"))
+		Expect(err).ToNot(HaveOccurred())
+		files, err := config.Render()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(HaveLen(1))
+	})
+
+	It("Refuses unknown fields", func() {
+		_, err := Parse([]byte(strings.Replace(bundle, "hostname:", "hostName:", 1)))
+		Expect(err).To(MatchError(ContainSubstring("field hostName not found")))
+	})
+
+	It("Reports every invalid field", func() {
+		invalid := strings.NewReplacer(
+			"clusterName: sno2", "clusterName: SNO_2",
+			"192.168.122.10/24", "192.168.122.10",
+			"gateway: 192.168.122.1", "gateway: fd00::1",
+			"http://proxy", "ftp://proxy",
+			"mirrors: [registry", "mirrors: [https://registry",
+		).Replace(bundle)
+		_, err := Parse([]byte(invalid))
+		var validationErr *ValidationError
+		Expect(err).To(BeAssignableToTypeOf(validationErr))
+		Expect(err.(*ValidationError).Fields).To(ConsistOf(
+			HavePrefix("clusterName:"),
+			HavePrefix("network.address:"),
+			HavePrefix("proxy.httpProxy:"),
+			HavePrefix("registryMirrors[0].mirrors[0]:"),
+		))
+	})
+})
@@ -0,0 +1,344 @@
+package support_bundle
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"ibu-imager/internal/ops"
+)
+
+// s3Credentials are the AWS credentials the S3 requests are signed with
+type s3Credentials struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// s3Uploader sends the bundle as an S3 multipart upload, whose parts already uploaded are listed to resume it
+type s3Uploader struct {
+	log         *logrus.Logger
+	client      *http.Client
+	limit       *limiter
+	credentials s3Credentials
+	region      string
+	// object is the path-style URL of the object, <endpoint>/<bucket>/<key>
+	object   *url.URL
+	partSize int64
+}
+
+// s3Part is a part of a multipart upload, as listed and completed
+type s3Part struct {
+	PartNumber int
+	ETag       string
+	Size       int64 `xml:",omitempty"`
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type listPartsResult struct {
+	Parts                []s3Part `xml:"Part"`
+	IsTruncated          bool
+	NextPartNumberMarker int
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []s3Part `xml:"Part"`
+}
+
+// errNoSuchUpload is returned when the multipart upload to resume expired or was aborted
+var errNoSuchUpload = errors.New("No such upload")
+
+// newS3Uploader returns the uploader of the s3://bucket/key target, signing its requests with the
+// credentials of the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN variables
+func newS3Uploader(log *logrus.Logger, client *http.Client, limit *limiter, target *url.URL, config UploadConfig) (*s3Uploader, error) {
+	credentials := s3Credentials{
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if credentials.accessKey == "" || credentials.secretKey == "" {
+		return nil, errors.New("S3 uploads need the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY variables")
+	}
+	region := config.S3Region
+	if region == "" {
+		region = DefaultS3Region
+	}
+	endpoint := config.S3Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	object, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid S3 endpoint %s", endpoint)
+	}
+	object.Path = strings.TrimSuffix(object.Path, "/") + "/" + target.Host + "/" + strings.TrimPrefix(target.Path, "/")
+	object.RawPath = uriEncode(object.Path, false)
+	return &s3Uploader{log: log, client: client, limit: limit, credentials: credentials, region: region,
+		object: object, partSize: config.ChunkSize}, nil
+}
+
+func (u *s3Uploader) upload(bundle *os.File, state *uploadState, save func() error) error {
+	var uploaded map[int]s3Part
+	if state.UploadID != "" {
+		var err error
+		uploaded, err = u.listParts(state.UploadID)
+		if errors.Is(err, errNoSuchUpload) {
+			u.log.Warnf("The upload to resume expired, starting over")
+			state.UploadID = ""
+		} else if err != nil {
+			return err
+		}
+	}
+	if state.UploadID == "" {
+		uploadID, err := u.initiate()
+		if err != nil {
+			return err
+		}
+		state.UploadID = uploadID
+		if err = save(); err != nil {
+			return err
+		}
+	}
+
+	var parts []s3Part
+	for number, offset := 1, int64(0); offset < state.Size; number++ {
+		length := min64(u.partSize, state.Size-offset)
+		part, ok := uploaded[number]
+		if ok && part.Size == length {
+			u.log.Debugf("Part %d was uploaded already", number)
+		} else {
+			etag, err := u.uploadPart(state.UploadID, number, io.NewSectionReader(bundle, offset, length), length)
+			if err != nil {
+				return err
+			}
+			part = s3Part{PartNumber: number, ETag: etag}
+			u.log.Infof("Uploaded %s of %s", ops.FormatBytes(uint64(offset+length)), ops.FormatBytes(uint64(state.Size)))
+		}
+		parts = append(parts, s3Part{PartNumber: number, ETag: part.ETag})
+		offset += length
+	}
+	if err := u.complete(state.UploadID, parts); err != nil {
+		return err
+	}
+	u.log.Info("Upload complete")
+	return nil
+}
+
+// initiate starts a multipart upload of the object, returning its ID
+func (u *s3Uploader) initiate() (string, error) {
+	var result initiateMultipartUploadResult
+	if err := u.do(http.MethodPost, url.Values{"uploads": {""}}, nil, 0, &result); err != nil {
+		return "", errors.Wrap(err, "Failed to start S3 multipart upload")
+	}
+	if result.UploadID == "" {
+		return "", errors.New("Failed to start S3 multipart upload, no upload ID returned")
+	}
+	return result.UploadID, nil
+}
+
+// listParts returns the parts of the multipart upload received already, by number
+func (u *s3Uploader) listParts(uploadID string) (map[int]s3Part, error) {
+	parts := map[int]s3Part{}
+	query := url.Values{"uploadId": {uploadID}}
+	for {
+		var result listPartsResult
+		if err := u.do(http.MethodGet, query, nil, 0, &result); err != nil {
+			return nil, err
+		}
+		for _, part := range result.Parts {
+			parts[part.PartNumber] = part
+		}
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		query.Set("part-number-marker", strconv.Itoa(result.NextPartNumberMarker))
+	}
+}
+
+// uploadPart uploads a part of the multipart upload, returning its ETag
+func (u *s3Uploader) uploadPart(uploadID string, number int, part io.ReadSeeker, length int64) (string, error) {
+	query := url.Values{"uploadId": {uploadID}, "partNumber": {strconv.Itoa(number)}}
+	resp, err := u.request(http.MethodPut, query, part, length)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to upload part %d", number)
+	}
+	defer resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		return "", errors.Errorf("Failed to upload part %d, no ETag returned", number)
+	}
+	return etag, nil
+}
+
+// complete assembles the uploaded parts into the object
+func (u *s3Uploader) complete(uploadID string, parts []s3Part) error {
+	body, err := xml.Marshal(completeMultipartUpload{Parts: parts})
+	if err != nil {
+		return err
+	}
+	// S3 may answer 200 with an error document once the parts are assembled
+	var result struct {
+		XMLName xml.Name
+		Message string
+	}
+	if err = u.do(http.MethodPost, url.Values{"uploadId": {uploadID}}, bytes.NewReader(body), int64(len(body)), &result); err != nil {
+		return errors.Wrap(err, "Failed to complete S3 multipart upload")
+	}
+	if result.XMLName.Local == "Error" {
+		return errors.Errorf("Failed to complete S3 multipart upload: %s", result.Message)
+	}
+	return nil
+}
+
+// do sends the request and decodes its XML answer into the result
+func (u *s3Uploader) do(method string, query url.Values, body io.ReadSeeker, length int64, result interface{}) error {
+	resp, err := u.request(method, query, body, length)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return errors.Wrap(xml.NewDecoder(resp.Body).Decode(result), "Failed to parse S3 answer")
+}
+
+// request sends the signed request, failing on the error answers
+func (u *s3Uploader) request(method string, query url.Values, body io.ReadSeeker, length int64) (*http.Response, error) {
+	payloadHash := hex.EncodeToString(sha256.New().Sum(nil))
+	var reader io.Reader
+	if body != nil {
+		hash := sha256.New()
+		if _, err := io.Copy(hash, body); err != nil {
+			return nil, err
+		}
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		payloadHash = hex.EncodeToString(hash.Sum(nil))
+		reader = u.limit.reader(body)
+	}
+
+	target := *u.object
+	target.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequest(method, target.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = length
+	u.credentials.sign(req, u.region, payloadHash, time.Now())
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	var s3Error struct {
+		Code    string
+		Message string
+	}
+	_ = xml.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&s3Error)
+	if s3Error.Code == "NoSuchUpload" {
+		return nil, errNoSuchUpload
+	}
+	return nil, errors.Errorf("S3 answered %s: %s %s", resp.Status, s3Error.Code, s3Error.Message)
+}
+
+// sign signs the request with AWS Signature Version 4, over the host and the headers of the request
+func (c *s3Credentials) sign(req *http.Request, region, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery,
+		canonicalHeaders.String(), signedHeaders, payloadHash}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + c.secretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery returns the query sorted and encoded the way AWS signs it
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters, and the slashes unless told to
+func uriEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			encoded.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
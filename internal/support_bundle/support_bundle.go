@@ -0,0 +1,164 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package support_bundle packages the reports of the seed creation runs, and uploads them for the
+// support cases of failed runs at disconnected sites. The bundle carries the run transcript, status and
+// history, the preflight report, and the manifest and recert summary of the backup dir, never the archives.
+package support_bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	seed "ibu-imager/internal/seed_creator"
+	"ibu-imager/pkg/seedmanifest"
+)
+
+const (
+	// TranscriptFile is the log of the last seed creation
+	TranscriptFile = "/var/lib/ibu-imager/transcript.log"
+	// DefaultBundleFile is where the bundle is packaged and kept until it's uploaded, in /var/tmp so an
+	// interrupted upload can be resumed after a reboot
+	DefaultBundleFile = "/var/tmp/ibu-imager-support-bundle.tar.gz"
+
+	// maxFileSize limits the size of every bundled file, the larger ones are cut to their end
+	maxFileSize = 16 << 20
+	// historyReports is the number of the latest run reports bundled
+	historyReports = 5
+)
+
+// File is a file of the bundle
+type File struct {
+	// Name is the path of the file in the bundle
+	Name string
+	// Source is the host file bundled
+	Source string
+}
+
+// Files returns the files of the bundle: the transcript, status and latest reports of the runs, the last
+// preflight report, and the manifest and recert summary of the backup dir
+func Files(backupDir string) ([]File, error) {
+	files := []File{
+		{Name: "transcript.log", Source: TranscriptFile},
+		{Name: "status.json", Source: seed.StatusFile},
+		{Name: "preflight.json", Source: seed.PreflightFile},
+		{Name: seedmanifest.FileName, Source: path.Join(backupDir, seedmanifest.FileName)},
+		{Name: seed.RecertSummaryFile, Source: path.Join(backupDir, seed.RecertSummaryFile)},
+	}
+
+	entries, err := os.ReadDir(seed.HistoryDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "Failed to list run history")
+	}
+	var reports []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".json") {
+			reports = append(reports, entry.Name())
+		}
+	}
+	sort.Strings(reports)
+	if len(reports) > historyReports {
+		reports = reports[len(reports)-historyReports:]
+	}
+	for _, report := range reports {
+		files = append(files, File{Name: path.Join("history", report), Source: path.Join(seed.HistoryDir, report)})
+	}
+	return files, nil
+}
+
+// Create packages the files into the bundle, a gzipped tarball. The missing files are skipped, those
+// larger than the size limit cut to their end. The bundle is written next to its path first, so it's
+// either missing or complete.
+func Create(log *logrus.Logger, bundle string, files []File) error {
+	output, err := os.OpenFile(bundle+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create support bundle")
+	}
+	defer output.Close()
+
+	gz := gzip.NewWriter(output)
+	tw := tar.NewWriter(gz)
+	bundled := 0
+	for _, file := range files {
+		added, err := addFile(log, tw, file)
+		if err != nil {
+			return err
+		}
+		if added {
+			bundled++
+		}
+	}
+	if bundled == 0 {
+		return errors.New("Nothing to bundle, no seed creation run recorded on this host")
+	}
+	if err = tw.Close(); err != nil {
+		return errors.Wrap(err, "Failed to write support bundle")
+	}
+	if err = gz.Close(); err != nil {
+		return errors.Wrap(err, "Failed to write support bundle")
+	}
+	if err = output.Close(); err != nil {
+		return errors.Wrap(err, "Failed to write support bundle")
+	}
+	log.Infof("Bundled %d files in %s", bundled, bundle)
+	return errors.Wrap(os.Rename(bundle+".tmp", bundle), "Failed to write support bundle")
+}
+
+// addFile adds the file to the tarball, returning false when it doesn't exist
+func addFile(log *logrus.Logger, tw *tar.Writer, file File) (bool, error) {
+	input, err := os.Open(file.Source)
+	if os.IsNotExist(err) {
+		log.Debugf("Skipping %s, not found", file.Source)
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "Failed to bundle %s", file.Source)
+	}
+	defer input.Close()
+	info, err := input.Stat()
+	if err != nil {
+		return false, errors.Wrapf(err, "Failed to bundle %s", file.Source)
+	}
+	if !info.Mode().IsRegular() {
+		return false, errors.Errorf("Failed to bundle %s, not a regular file", file.Source)
+	}
+
+	size := info.Size()
+	if size > maxFileSize {
+		log.Warnf("%s is %d MiB, only its last %d MiB are bundled", file.Source, size>>20, maxFileSize>>20)
+		if _, err = input.Seek(size-maxFileSize, io.SeekStart); err != nil {
+			return false, errors.Wrapf(err, "Failed to bundle %s", file.Source)
+		}
+		size = maxFileSize
+	}
+	header := &tar.Header{Name: file.Name, Mode: 0600, Size: size, ModTime: info.ModTime().Truncate(time.Second)}
+	if err = tw.WriteHeader(header); err != nil {
+		return false, errors.Wrapf(err, "Failed to bundle %s", file.Source)
+	}
+	if _, err = io.CopyN(tw, input, size); err != nil {
+		return false, errors.Wrapf(err, "Failed to bundle %s", file.Source)
+	}
+	return true, nil
+}
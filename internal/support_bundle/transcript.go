@@ -0,0 +1,53 @@
+package support_bundle
+
+import (
+	"os"
+	"path"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Transcript is a logrus hook writing the log of the run to a file, without colors whatever the terminal
+type Transcript struct {
+	mu        sync.Mutex
+	file      *os.File
+	formatter logrus.Formatter
+}
+
+// OpenTranscript truncates the transcript file, which then holds the log of the current run only
+func OpenTranscript(file string) (*Transcript, error) {
+	if err := os.MkdirAll(path.Dir(file), 0700); err != nil {
+		return nil, errors.Wrap(err, "Failed to create transcript dir")
+	}
+	output, err := os.OpenFile(file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to open transcript")
+	}
+	return &Transcript{
+		file:      output,
+		formatter: &logrus.TextFormatter{DisableColors: true, FullTimestamp: true, TimestampFormat: "2006-01-02 15:04:05"},
+	}, nil
+}
+
+func (t *Transcript) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire writes the entry to the transcript
+func (t *Transcript) Fire(entry *logrus.Entry) error {
+	line, err := t.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err = t.file.Write(line)
+	return err
+}
+
+// Close closes the transcript file
+func (t *Transcript) Close() error {
+	return t.file.Close()
+}
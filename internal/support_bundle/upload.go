@@ -0,0 +1,332 @@
+package support_bundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"ibu-imager/internal/ops"
+)
+
+const (
+	// DefaultChunkSize is the size of the uploaded chunks, an interrupted upload resumes after the last one
+	// received. It's above the 5 MiB minimum of the S3 multipart upload parts.
+	DefaultChunkSize = 8 << 20
+	// minS3PartSize is the minimum size of the S3 multipart upload parts but the last one
+	minS3PartSize = 5 << 20
+	// DefaultS3Region is the region the S3 requests are signed for by default
+	DefaultS3Region = "us-east-1"
+
+	// httpTimeout is the timeout of a single upload request
+	httpTimeout = 5 * time.Minute
+	// stateSuffix names the upload state file after the bundle
+	stateSuffix = ".upload.json"
+)
+
+// UploadConfig configures the upload of a bundle
+type UploadConfig struct {
+	// Target is the s3://bucket/key object or the http(s) URL of the resumable upload the bundle is sent to
+	Target string
+	// S3Endpoint is the S3 API endpoint, e.g. an on-premise object store, the AWS one of the region when empty
+	S3Endpoint string
+	// S3Region is the region the S3 requests are signed for
+	S3Region string
+	// ChunkSize is the size of the uploaded chunks
+	ChunkSize int64
+	// MaxRate limits the upload rate in bytes per second, not limited when 0
+	MaxRate int64
+}
+
+// Validate checks the target and the limits of the upload
+func (c *UploadConfig) Validate() error {
+	target, err := url.Parse(c.Target)
+	if err != nil {
+		return errors.Wrapf(err, "Invalid upload target %s", c.Target)
+	}
+	switch target.Scheme {
+	case "s3":
+		if target.Host == "" || strings.Trim(target.Path, "/") == "" {
+			return errors.Errorf("Invalid upload target %s, expected s3://<bucket>/<key>", c.Target)
+		}
+		if c.ChunkSize < minS3PartSize {
+			return errors.Errorf("The chunks of S3 uploads must be at least %d MiB", minS3PartSize>>20)
+		}
+	case "http", "https":
+		if target.Host == "" {
+			return errors.Errorf("Invalid upload target %s, no host", c.Target)
+		}
+	default:
+		return errors.Errorf("Unsupported upload target %s, use s3://<bucket>/<key> or an http(s) URL", c.Target)
+	}
+	if c.ChunkSize <= 0 {
+		return errors.New("The upload chunk size must be positive")
+	}
+	if c.MaxRate < 0 {
+		return errors.New("The upload rate limit can't be negative")
+	}
+	return nil
+}
+
+// uploadState records the upload of a bundle next to it, so an interrupted upload resumes where it stopped
+type uploadState struct {
+	Target string `json:"target"`
+	Size   int64  `json:"size"`
+	Digest string `json:"digest"`
+	// UploadID is the S3 multipart upload of the bundle
+	UploadID string `json:"uploadID,omitempty"`
+}
+
+// uploader sends the bundle to a target, skipping what the target received already
+type uploader interface {
+	upload(bundle *os.File, state *uploadState, save func() error) error
+}
+
+// Resumable returns true if the bundle is the one an interrupted upload to the target was sending
+func Resumable(bundle, target string) bool {
+	state, err := loadState(bundle)
+	if err != nil || state == nil || state.Target != target {
+		return false
+	}
+	size, digest, err := fileDigest(bundle)
+	return err == nil && size == state.Size && digest == state.Digest
+}
+
+// Upload uploads the bundle to the target, resuming the interrupted upload of the same bundle. The upload
+// state is removed once the target received the whole bundle.
+func Upload(log *logrus.Logger, bundle string, config UploadConfig) error {
+	size, digest, err := fileDigest(bundle)
+	if err != nil {
+		return err
+	}
+	state, err := loadState(bundle)
+	if err != nil {
+		return err
+	}
+	if state == nil || state.Target != config.Target || state.Size != size || state.Digest != digest {
+		state = &uploadState{Target: config.Target, Size: size, Digest: digest}
+	}
+	save := func() error { return saveState(bundle, state) }
+	if err = save(); err != nil {
+		return err
+	}
+
+	up, err := newUploader(log, config)
+	if err != nil {
+		return err
+	}
+	input, err := os.Open(bundle)
+	if err != nil {
+		return errors.Wrap(err, "Failed to read support bundle")
+	}
+	defer input.Close()
+
+	log.Infof("Uploading %s (%s) to %s", bundle, ops.FormatBytes(uint64(size)), config.Target)
+	if err = up.upload(input, state, save); err != nil {
+		return errors.Wrap(err, "Failed to upload support bundle, run the upload again to resume it")
+	}
+	return errors.Wrap(os.Remove(bundle+stateSuffix), "Failed to remove upload state")
+}
+
+// newUploader returns the uploader of the target
+func newUploader(log *logrus.Logger, config UploadConfig) (uploader, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: httpTimeout}
+	limit := newLimiter(config.MaxRate)
+	target, _ := url.Parse(config.Target)
+	if target.Scheme == "s3" {
+		return newS3Uploader(log, client, limit, target, config)
+	}
+	return &httpUploader{log: log, client: client, limit: limit, url: config.Target, chunkSize: config.ChunkSize}, nil
+}
+
+// httpUploader sends the bundle in chunks with ranged PUT requests, the resumable upload protocol of
+// object stores such as Google Cloud Storage: the target answers 308 with the Range it received until
+// the last chunk, and tells it when asked with an empty PUT of the bytes */<size> range.
+type httpUploader struct {
+	log       *logrus.Logger
+	client    *http.Client
+	limit     *limiter
+	url       string
+	chunkSize int64
+}
+
+func (u *httpUploader) upload(bundle *os.File, state *uploadState, save func() error) error {
+	offset, done, err := u.put(nil, 0, 0, state.Size)
+	if err != nil {
+		return err
+	}
+	if offset > 0 && !done {
+		u.log.Infof("Resuming the upload after %s", ops.FormatBytes(uint64(offset)))
+	}
+	for !done {
+		length := min64(u.chunkSize, state.Size-offset)
+		body := u.limit.reader(io.NewSectionReader(bundle, offset, length))
+		if offset, done, err = u.put(body, offset, length, state.Size); err != nil {
+			return err
+		}
+		if !done {
+			u.log.Infof("Uploaded %s of %s", ops.FormatBytes(uint64(offset)), ops.FormatBytes(uint64(state.Size)))
+		}
+	}
+	u.log.Info("Upload complete")
+	return nil
+}
+
+// put sends the chunk of the bundle at the offset, or asks for the received range when the body is nil.
+// It returns the offset the next chunk starts at, and whether the target received the whole bundle.
+func (u *httpUploader) put(body io.Reader, offset, length, size int64) (int64, bool, error) {
+	req, err := http.NewRequest(http.MethodPut, u.url, body)
+	if err != nil {
+		return 0, false, err
+	}
+	if body == nil {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	} else {
+		req.ContentLength = length
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size))
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return size, true, nil
+	case http.StatusPermanentRedirect:
+		received, err := parseReceived(resp.Header.Get("Range"))
+		return received, false, err
+	case http.StatusNotFound:
+		// The target has no upload of the bundle yet
+		if body == nil {
+			return 0, false, nil
+		}
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return 0, false, errors.Errorf("%s answered %s: %s", u.url, resp.Status, strings.TrimSpace(string(message)))
+}
+
+// parseReceived returns the number of bytes of the bytes=0-<last> range the target received, none when empty
+func parseReceived(received string) (int64, error) {
+	if received == "" {
+		return 0, nil
+	}
+	last, found := strings.CutPrefix(received, "bytes=0-")
+	if !found {
+		return 0, errors.Errorf("Unexpected received range %q", received)
+	}
+	end, err := strconv.ParseInt(last, 10, 64)
+	if err != nil {
+		return 0, errors.Errorf("Unexpected received range %q", received)
+	}
+	return end + 1, nil
+}
+
+// limiter paces the reads of the uploaded chunks to a rate in bytes per second
+type limiter struct {
+	rate  int64
+	start time.Time
+	sent  int64
+}
+
+// newLimiter returns the limiter of the rate, nil when the rate isn't limited
+func newLimiter(rate int64) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &limiter{rate: rate}
+}
+
+// reader returns the reader paced by the limiter
+func (l *limiter) reader(r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &throttledReader{reader: r, limit: l}
+}
+
+// wait sleeps until sending n more bytes keeps the average rate under the limit
+func (l *limiter) wait(n int) {
+	if l.start.IsZero() {
+		l.start = time.Now()
+	}
+	l.sent += int64(n)
+	due := l.start.Add(time.Duration(float64(l.sent) / float64(l.rate) * float64(time.Second)))
+	time.Sleep(time.Until(due))
+}
+
+type throttledReader struct {
+	reader io.Reader
+	limit  *limiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	// Small reads keep the rate smooth, e.g. ten per second
+	if most := int(t.limit.rate/10) + 1; len(p) > most {
+		p = p[:most]
+	}
+	n, err := t.reader.Read(p)
+	t.limit.wait(n)
+	return n, err
+}
+
+// loadState returns the upload state of the bundle, nil when no upload was started
+func loadState(bundle string) (*uploadState, error) {
+	data, err := os.ReadFile(bundle + stateSuffix)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read upload state")
+	}
+	var state uploadState
+	if err = json.Unmarshal(data, &state); err != nil {
+		// A corrupted state only loses the resume
+		return nil, nil
+	}
+	return &state, nil
+}
+
+func saveState(bundle string, state *uploadState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal upload state")
+	}
+	return errors.Wrap(os.WriteFile(bundle+stateSuffix, data, 0600), "Failed to write upload state")
+}
+
+// fileDigest returns the size and the sha256 digest of the file
+func fileDigest(file string) (int64, string, error) {
+	input, err := os.Open(file)
+	if err != nil {
+		return 0, "", errors.Wrap(err, "Failed to read support bundle")
+	}
+	defer input.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, input)
+	if err != nil {
+		return 0, "", errors.Wrap(err, "Failed to read support bundle")
+	}
+	return size, "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
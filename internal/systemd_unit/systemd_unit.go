@@ -0,0 +1,194 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemd_unit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/internal/host_mounts"
+)
+
+const (
+	// DefaultName is the name of the generated units, without their .service and .timer suffixes
+	DefaultName = "ibu-imager-refresh"
+	// DefaultBinary is the ibu-imager binary run by the service when no imager image is set
+	DefaultBinary = "/usr/local/bin/ibu-imager"
+	// podman is the podman binary on the host
+	podman = "/usr/bin/podman"
+)
+
+// containerMounts are the host paths mounted into the imager container besides the required host mounts
+var containerMounts = []string{"/var/run", "/run/systemd/journal/socket"}
+
+// Config describes the service running an imager command, and the timer scheduling it
+type Config struct {
+	// Name is the name of the units, without their .service and .timer suffixes
+	Name string
+	// ImagerImage is the ibu-imager container image the service runs, Binary runs on the host when empty
+	ImagerImage string
+	// Binary is the ibu-imager binary run on the host when no imager image is set
+	Binary string
+	// AuthFile is the registry credentials podman pulls the imager image with
+	AuthFile string
+	// Args are the imager command line, e.g. create --registry quay.io/org/seed
+	Args []string
+	// Environment are the KEY=VALUE variables of the service, e.g. the proxy settings, passed to the container
+	Environment []string
+	// Schedule is the OnCalendar expression of the timer, no timer is generated when empty
+	Schedule string
+	// RandomizedDelay spreads the runs of the timer, so the sites don't all refresh their seed at once
+	RandomizedDelay time.Duration
+}
+
+// Validate checks the unit config
+func (c *Config) Validate() error {
+	if c.Name == "" || strings.ContainsAny(c.Name, "/ ") {
+		return errors.Errorf("Invalid unit name %q", c.Name)
+	}
+	if len(c.Args) == 0 {
+		return errors.New("The imager command the service runs is required, e.g. create --registry quay.io/org/seed")
+	}
+	if c.ImagerImage == "" && c.Binary == "" {
+		return errors.New("Either the imager image or the imager binary is required")
+	}
+	for _, variable := range c.Environment {
+		if key, _, found := strings.Cut(variable, "="); !found || key == "" {
+			return errors.Errorf("Invalid environment variable %q, expected KEY=VALUE", variable)
+		}
+	}
+	if c.RandomizedDelay < 0 {
+		return errors.New("The randomized delay can't be negative")
+	}
+	return nil
+}
+
+// Unit is a generated systemd unit file
+type Unit struct {
+	Name     string
+	Contents string
+}
+
+// Generate returns the oneshot service running the imager command, followed by its timer when scheduled
+func Generate(config *Config) ([]Unit, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	units := []Unit{{Name: config.Name + ".service", Contents: service(config)}}
+	if config.Schedule != "" {
+		units = append(units, Unit{Name: config.Name + ".timer", Contents: timer(config)})
+	}
+	return units, nil
+}
+
+// service returns the oneshot service running the imager command, in a container sharing the host
+// PID namespace nsenter needs or straight on the host
+func service(config *Config) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `[Unit]
+Description=Run ibu-imager %s
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+`, config.Args[0])
+	for _, variable := range config.Environment {
+		fmt.Fprintf(&b, "Environment=%s\n", quote(strings.ReplaceAll(variable, "%", "%%")))
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", execCommandLine(command(config)))
+	if config.Schedule == "" {
+		// Without a timer the service is only started on demand, the seed creation mustn't run on every boot
+		return b.String()
+	}
+	fmt.Fprintf(&b, "\n[Install]\nAlso=%s.timer\n", config.Name)
+	return b.String()
+}
+
+// command returns the command line of the service
+func command(config *Config) []string {
+	if config.ImagerImage == "" {
+		return append([]string{config.Binary}, config.Args...)
+	}
+	command := []string{podman, "run", "--rm", "--privileged", "--pid=host", "--net=host"}
+	if config.AuthFile != "" {
+		command = append(command, "--authfile", config.AuthFile)
+	}
+	for _, mount := range hostMounts() {
+		command = append(command, "-v", mount+":"+mount)
+	}
+	for _, variable := range config.Environment {
+		// The values are only set by the Environment= lines of the service
+		key, _, _ := strings.Cut(variable, "=")
+		command = append(command, "--env", key)
+	}
+	return append(append(command, config.ImagerImage), config.Args...)
+}
+
+// hostMounts returns the host paths mounted into the imager container
+func hostMounts() []string {
+	var mounts []string
+	for mount := range host_mounts.RequiredHostMounts {
+		mounts = append(mounts, mount)
+	}
+	sort.Strings(mounts)
+	return append(mounts, containerMounts...)
+}
+
+// timer returns the timer starting the service on the schedule, catching up on the runs missed while
+// the node was down
+func timer(config *Config) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `[Unit]
+Description=Schedule ibu-imager %s
+
+[Timer]
+OnCalendar=%s
+Persistent=true
+`, config.Args[0], config.Schedule)
+	if config.RandomizedDelay > 0 {
+		fmt.Fprintf(&b, "RandomizedDelaySec=%d\n", int64(config.RandomizedDelay.Seconds()))
+	}
+	b.WriteString("\n[Install]\nWantedBy=timers.target\n")
+	return b.String()
+}
+
+// execCommandLine returns the command line quoted for an ExecStart= setting
+func execCommandLine(command []string) string {
+	quoted := make([]string, 0, len(command))
+	for _, arg := range command {
+		quoted = append(quoted, quoteArg(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// quoteArg escapes the systemd specifiers and variable expansions of the command line argument
+func quoteArg(arg string) string {
+	return quote(strings.NewReplacer("%", "%%", "$", "$$").Replace(arg))
+}
+
+// quote double quotes the value when it's empty or holds whitespace, quotes or backslashes
+func quote(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\n\"'\\") {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`).Replace(value) + `"`
+}
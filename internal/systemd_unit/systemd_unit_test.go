@@ -0,0 +1,65 @@
+package systemd_unit
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSystemdUnit(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Systemd Unit Suite")
+}
+
+var _ = Describe("Unit generation", func() {
+	It("Runs the imager container on a schedule", func() {
+		units, err := Generate(&Config{
+			Name:            DefaultName,
+			ImagerImage:     "quay.io/org/ibu-imager:4.14.0",
+			AuthFile:        "/var/lib/kubelet/config.json",
+			Args:            []string{"create", "--registry", "quay.io/org/seed", "--tag", "refresh $(date)"},
+			Environment:     []string{"HTTPS_PROXY=http://proxy:3128", "NO_PROXY=.cluster.local, 10.0.0.0/8"},
+			Schedule:        "monthly",
+			RandomizedDelay: time.Hour,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(units).To(HaveLen(2))
+		Expect(units[0].Name).To(Equal("ibu-imager-refresh.service"))
+		Expect(units[0].Contents).To(Equal(`[Unit]
+Description=Run ibu-imager create
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+Environment=HTTPS_PROXY=http://proxy:3128
+Environment="NO_PROXY=.cluster.local, 10.0.0.0/8"
+ExecStart=/usr/bin/podman run --rm --privileged --pid=host --net=host --authfile /var/lib/kubelet/config.json ` +
+			`-v /etc:/etc -v /ostree:/ostree -v /sysroot:/sysroot -v /var:/var -v /var/lib/etcd:/var/lib/etcd -v /var/run:/var/run ` +
+			`-v /run/systemd/journal/socket:/run/systemd/journal/socket --env HTTPS_PROXY --env NO_PROXY ` +
+			`quay.io/org/ibu-imager:4.14.0 create --registry quay.io/org/seed --tag "refresh $$(date)"
+
+[Install]
+Also=ibu-imager-refresh.timer
+`))
+		Expect(units[1].Name).To(Equal("ibu-imager-refresh.timer"))
+		Expect(units[1].Contents).To(ContainSubstring("OnCalendar=monthly\nPersistent=true\nRandomizedDelaySec=3600\n"))
+	})
+
+	It("Runs the host binary on demand", func() {
+		units, err := Generate(&Config{Name: "seed", Binary: DefaultBinary, Args: []string{"create", "--registry", "quay.io/org/seed"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(units).To(HaveLen(1))
+		Expect(units[0].Contents).To(ContainSubstring("ExecStart=/usr/local/bin/ibu-imager create --registry quay.io/org/seed\n"))
+		Expect(units[0].Contents).ToNot(ContainSubstring("[Install]"))
+	})
+
+	It("Refuses incomplete configs", func() {
+		_, err := Generate(&Config{Name: DefaultName, Binary: DefaultBinary})
+		Expect(err).To(MatchError(ContainSubstring("imager command")))
+		_, err = Generate(&Config{Name: DefaultName, Binary: DefaultBinary, Args: []string{"create"}, Environment: []string{"PROXY"}})
+		Expect(err).To(MatchError(ContainSubstring("expected KEY=VALUE")))
+	})
+})
@@ -0,0 +1,113 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package version holds the build information of the imager, embedded at build time with:
+//
+//	go build -ldflags "-X ibu-imager/internal/version.Version=<version> \
+//	    -X ibu-imager/internal/version.GitCommit=<sha> -X ibu-imager/internal/version.BuildDate=<date>"
+//
+// Without ldflags, the git SHA and build date fall back to the VCS information Go embeds in the binary.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"ibu-imager/pkg/seedmanifest"
+)
+
+// unknown is reported for the build information that was neither embedded nor recorded by Go
+const unknown = "unknown"
+
+// Set at build time with -ldflags -X
+var (
+	Version   string
+	GitCommit string
+	BuildDate string
+)
+
+// Info is the build information of the imager
+type Info struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+	// SeedFormatVersion is the highest seed manifest schema version the imager creates and restores
+	SeedFormatVersion int `json:"seedFormatVersion"`
+}
+
+// Get returns the build information of the running imager
+func Get() Info {
+	info := Info{
+		Version:           Version,
+		GitCommit:         GitCommit,
+		BuildDate:         BuildDate,
+		GoVersion:         runtime.Version(),
+		Platform:          runtime.GOOS + "/" + runtime.GOARCH,
+		SeedFormatVersion: seedmanifest.SchemaVersion,
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.GitCommit == "":
+				info.GitCommit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+	for _, field := range []*string{&info.Version, &info.GitCommit, &info.BuildDate} {
+		if *field == "" {
+			*field = unknown
+		}
+	}
+	return info
+}
+
+// String returns the one line summary of the build information, as printed by --version
+func (i Info) String() string {
+	return fmt.Sprintf("%s (commit %s, built %s, seed format %d)", i.Version, shortCommit(i.GitCommit), i.BuildDate, i.SeedFormatVersion)
+}
+
+// CheckSeedFormat refuses a seed format, as labeled on the seed images, newer than the imager supports.
+// Seeds labeled by the given imager version, when known, are refused with the version to use instead.
+// Seeds built before the label was introduced have an empty format, the first one.
+func CheckSeedFormat(format, imagerVersion string) error {
+	if format == "" {
+		return nil
+	}
+	schemaVersion, err := strconv.Atoi(format)
+	if err != nil || schemaVersion < 1 {
+		return errors.Errorf("Invalid seed format %q", format)
+	}
+	if supported := Get().SeedFormatVersion; schemaVersion > supported {
+		return &seedmanifest.UnsupportedSchemaError{SchemaVersion: schemaVersion, Supported: supported, ImagerVersion: imagerVersion}
+	}
+	return nil
+}
+
+// shortCommit abbreviates a full git SHA
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
@@ -0,0 +1,95 @@
+package version
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"ibu-imager/pkg/seedmanifest"
+)
+
+func TestVersion(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Version Suite")
+}
+
+var _ = Describe("Version", func() {
+	AfterEach(func() {
+		Version, GitCommit, BuildDate = "", "", ""
+	})
+
+	It("Reports the embedded build information", func() {
+		Version, GitCommit, BuildDate = "4.14.0", "0123456789abcdef0123", "2023-10-01T00:00:00Z"
+		info := Get()
+		Expect(info.Version).To(Equal("4.14.0"))
+		Expect(info.SeedFormatVersion).To(Equal(seedmanifest.SchemaVersion))
+		Expect(info.String()).To(Equal(fmt.Sprintf("4.14.0 (commit 0123456789ab, built 2023-10-01T00:00:00Z, seed format %d)",
+			seedmanifest.SchemaVersion)))
+	})
+
+	It("Reports the build information neither embedded nor recorded as unknown", func() {
+		// Test binaries carry no VCS information
+		info := Get()
+		Expect(info.Version).To(Equal(unknown))
+		Expect(info.GitCommit).To(Equal(unknown))
+		Expect(info.BuildDate).To(Equal(unknown))
+	})
+
+	It("Abbreviates the full commits only", func() {
+		for commit, short := range map[string]string{
+			"0123456789abcdef0123": "0123456789ab",
+			"0123456789ab":         "0123456789ab",
+			"0123456":              "0123456",
+			unknown:                unknown,
+		} {
+			Expect(shortCommit(commit)).To(Equal(short), commit)
+		}
+	})
+
+	It("Refuses the seed formats newer than the supported one", func() {
+		newer := fmt.Sprint(seedmanifest.SchemaVersion + 1)
+		for _, test := range []struct {
+			format        string
+			imagerVersion string
+			err           string
+		}{
+			{format: ""},
+			{format: "1"},
+			{format: fmt.Sprint(seedmanifest.SchemaVersion)},
+			{format: newer, err: fmt.Sprintf("seed manifest schema version %s is not supported, up to %d is", newer, seedmanifest.SchemaVersion)},
+			{format: newer, imagerVersion: "4.16.0", err: fmt.Sprintf("seed manifest schema version %s is not supported, up to %d is: "+
+				"the seed was created by ibu-imager 4.16.0, restore it with that version or newer", newer, seedmanifest.SchemaVersion)},
+			{format: "0", err: `Invalid seed format "0"`},
+			{format: "v2", err: `Invalid seed format "v2"`},
+		} {
+			err := CheckSeedFormat(test.format, test.imagerVersion)
+			if test.err == "" {
+				Expect(err).ToNot(HaveOccurred(), test.format)
+			} else {
+				Expect(err).To(MatchError(test.err), test.format)
+			}
+		}
+	})
+
+	It("Refuses restoring the manifests newer than the supported seed format", func() {
+		for _, test := range []struct {
+			manifest  string
+			supported bool
+		}{
+			{manifest: fmt.Sprintf(`{"schemaVersion": %d, "imager": {"version": "4.16.0"}}`, Get().SeedFormatVersion+1)},
+			{manifest: fmt.Sprintf(`{"schemaVersion": %d, "imager": {"version": "4.14.0"}, "kind": "%s", "nodeRole": "%s"}`,
+				Get().SeedFormatVersion, seedmanifest.KindSeed, seedmanifest.NodeRoleMaster), supported: true},
+		} {
+			_, err := seedmanifest.Parse([]byte(test.manifest))
+			if test.supported {
+				Expect(err).ToNot(HaveOccurred(), test.manifest)
+				continue
+			}
+			var unsupported *seedmanifest.UnsupportedSchemaError
+			Expect(err).To(BeAssignableToTypeOf(unsupported), test.manifest)
+			Expect(err.Error()).To(ContainSubstring("created by ibu-imager 4.16.0, restore it with that version or newer"))
+		}
+	})
+})
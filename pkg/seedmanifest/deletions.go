@@ -0,0 +1,119 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package seedmanifest
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DeletionsFileName is the artifact listing the files deleted from the seed /etc
+	DeletionsFileName = "deletions.json"
+	// LegacyDeletionsFileName is the plain text deletions artifact of older seeds, one path per line
+	LegacyDeletionsFileName = "etc.deletions"
+
+	// DeletionsSchemaVersion is the deletions schema version written by this version of the imager
+	DeletionsSchemaVersion = 1
+
+	// DeletionReasonConfigDiff marks the files ostree admin config-diff reports deleted from the default /etc
+	DeletionReasonConfigDiff = "ostree-config-diff"
+
+	// etcDir is the only directory deletions may apply to
+	etcDir = "/etc"
+)
+
+// DeletionType is the type of a deleted file, as found in the default /etc
+type DeletionType string
+
+const (
+	DeletionTypeFile      DeletionType = "file"
+	DeletionTypeDirectory DeletionType = "directory"
+	DeletionTypeSymlink   DeletionType = "symlink"
+)
+
+// Deletion is a file of the default /etc the seed deleted, and a restorer has to delete from the target /etc
+type Deletion struct {
+	Path string       `json:"path"`
+	Type DeletionType `json:"type"`
+	// Reason tells why the file is deleted, e.g. DeletionReasonConfigDiff
+	Reason string `json:"reason"`
+}
+
+// Deletions is the content of the deletions artifact
+type Deletions struct {
+	SchemaVersion int        `json:"schemaVersion"`
+	Deletions     []Deletion `json:"deletions"`
+}
+
+// ParseDeletions parses and validates a deletions artifact, refusing schema versions newer than DeletionsSchemaVersion
+func ParseDeletions(data []byte) (*Deletions, error) {
+	var deletions Deletions
+	if err := json.Unmarshal(data, &deletions); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse deletions")
+	}
+	if deletions.SchemaVersion > DeletionsSchemaVersion {
+		return nil, errors.Errorf("deletions schema version %d is not supported, up to %d is",
+			deletions.SchemaVersion, DeletionsSchemaVersion)
+	}
+	for _, deletion := range deletions.Deletions {
+		if err := deletion.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &deletions, nil
+}
+
+// ParseLegacyDeletions parses the plain text deletions of older seeds, which don't record the file types
+func ParseLegacyDeletions(data []byte) ([]Deletion, error) {
+	var deletions []Deletion
+	for _, line := range strings.Split(string(data), "\n") {
+		deleted := strings.TrimSpace(line)
+		if deleted == "" {
+			continue
+		}
+		if err := ValidateDeletionPath(deleted); err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, Deletion{Path: deleted, Reason: DeletionReasonConfigDiff})
+	}
+	return deletions, nil
+}
+
+// Validate checks the deletion is of a known type and stays in /etc
+func (d *Deletion) Validate() error {
+	switch d.Type {
+	case DeletionTypeFile, DeletionTypeDirectory, DeletionTypeSymlink:
+	default:
+		return errors.Errorf("deletion of %s has unsupported type %q", d.Path, d.Type)
+	}
+	if d.Reason == "" {
+		return errors.Errorf("deletion of %s has no reason", d.Path)
+	}
+	return ValidateDeletionPath(d.Path)
+}
+
+// ValidateDeletionPath refuses deleting anything but a clean absolute path below /etc
+func ValidateDeletionPath(deleted string) error {
+	if path.Clean(deleted) != deleted || !strings.HasPrefix(deleted, etcDir+"/") {
+		return errors.Errorf("refusing to delete %q, deletions must be clean paths below %s", deleted, etcDir)
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package seedmanifest reads the manifest describing the content of a seed image, so tools
+// consuming seed images don't have to copy its types.
+//
+// The module path of the imager, ibu-imager, isn't a go-gettable one: other modules can only import
+// the package through a replace directive pointing to a checkout of the repository, e.g.
+//
+//	require ibu-imager v0.0.0
+//	replace ibu-imager => ../ibu-imager
+package seedmanifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// FileName is the name of the seed manifest stored at the root of the seed image
+	FileName = "manifest.json"
+
+	// SchemaVersion is the manifest schema version written by this version of the imager, bumped when
+	// fields or artifacts are added. Manifests without a version were written before versioning and are
+	// read as version 1. Version 2 adds the deletions.json artifact, the etcd summary, the imager version,
+	// the extra artifacts and the feature gates.
+	SchemaVersion = 2
+
+	// KindSeed is the manifest kind of a regular single-node (master) seed
+	KindSeed = "SeedImage"
+	// KindWorkerSeed is the manifest kind of an experimental worker-node seed
+	KindWorkerSeed = "WorkerSeedImage"
+
+	// NodeRoleMaster is the default node role, capturing a full single-node OpenShift seed
+	NodeRoleMaster = "master"
+	// NodeRoleWorker is the experimental node role, capturing kubelet state only
+	NodeRoleWorker = "worker"
+
+	// ExtraArtifactsDir is the directory of the seed image holding the extra artifacts, by namespace
+	ExtraArtifactsDir = "extra"
+)
+
+// Manifest describes the content of a seed image
+type Manifest struct {
+	SchemaVersion int           `json:"schemaVersion"`
+	Kind          string        `json:"kind"`
+	NodeRole      string        `json:"nodeRole"`
+	CreatedAt     time.Time     `json:"createdAt"`
+	RestoreSteps  []RestoreStep `json:"restoreSteps"`
+	// CoreUser is only set when the seed carries the core user's SSH keys
+	CoreUser *CoreUserArtifact `json:"coreUser,omitempty"`
+	// ClusterVersion summarizes the seed cluster version, unset for worker seeds
+	ClusterVersion *ClusterVersionSummary `json:"clusterVersion,omitempty"`
+	// Etcd summarizes the size of the seed cluster etcd, unset for worker seeds and seeds of older imagers
+	Etcd *EtcdSummary `json:"etcd,omitempty"`
+	// AuditLogs is the audit log policy the seed was created with, so sites can tell whether it carries audit trails
+	AuditLogs string `json:"auditLogs"`
+	// ImageStore is the additional image store image, only set when one is pushed along the seed
+	ImageStore string `json:"imageStore,omitempty"`
+	// Imager is the version of the imager that created the seed, unset for seeds of older imagers
+	Imager *ImagerVersion `json:"imager,omitempty"`
+	// ExtraArtifacts are the third-party files attached to the seed, not used by the restore
+	ExtraArtifacts []ExtraArtifact `json:"extraArtifacts,omitempty"`
+	// FeatureGates are the states of the feature gates the seed was created with, unset for seeds of older imagers
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+}
+
+// ExtraArtifact is a third-party file attached to a seed, e.g. a vendor license blob or site calibration
+// data, stored as ExtraArtifactsDir/<namespace>/<name> in the seed image
+type ExtraArtifact struct {
+	// Namespace is the owner of the file, e.g. the vendor domain, so attachments of different owners don't clash
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Path is the path of the file in the seed image
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Digest string `json:"digest"`
+}
+
+// ImagerVersion is the build of the imager that created a seed
+type ImagerVersion struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+}
+
+// RestoreStep is a single step a restorer has to apply to bring a target host to the seed state.
+// Steps are declared in the seed manifest so newer seed formats can add steps, and restorers
+// order them by their dependencies rather than by a hardcoded sequence.
+type RestoreStep struct {
+	Name      string   `json:"name"`
+	Artifact  string   `json:"artifact,omitempty"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// CoreUserArtifact flags the presence of the core user artifact in the manifest
+type CoreUserArtifact struct {
+	Artifact string `json:"artifact"`
+	// RestorePolicy is the default authorized_keys restore policy, which can be overridden at restore time
+	RestorePolicy string `json:"restorePolicy"`
+}
+
+// ClusterVersionUpdate is an entry of the cluster version update history
+type ClusterVersionUpdate struct {
+	Version        string     `json:"version"`
+	Image          string     `json:"image"`
+	State          string     `json:"state"`
+	StartedTime    time.Time  `json:"startedTime"`
+	CompletionTime *time.Time `json:"completionTime,omitempty"`
+}
+
+// ClusterVersionSummary is the version of the seed cluster, summarized from its ClusterVersion
+type ClusterVersionSummary struct {
+	// Version is the last completed version, i.e. the exact z-stream of the seed
+	Version string `json:"version"`
+	// Image is the release image of the version
+	Image   string `json:"image"`
+	Channel string `json:"channel,omitempty"`
+	// History is the update history, most recent first
+	History []ClusterVersionUpdate `json:"history"`
+	// AvailableUpdates are the versions the cluster could update to at seed time
+	AvailableUpdates []string `json:"availableUpdates,omitempty"`
+}
+
+// EtcdSummary is the size of the seed cluster etcd, telling how long its restore takes and whether the
+// cluster is bloated
+type EtcdSummary struct {
+	// Revision is the etcd revision at seed time
+	Revision int64 `json:"revision"`
+	// DBSize is the size of the etcd database file, DBSizeInUse the part of it not freed by compactions
+	DBSize      int64 `json:"dbSize"`
+	DBSizeInUse int64 `json:"dbSizeInUse"`
+	Keys        int   `json:"keys"`
+	// LargestResources are the resource types with the most keys, most first
+	LargestResources []EtcdResourceCount `json:"largestResources,omitempty"`
+}
+
+// EtcdResourceCount is the number of etcd keys of a resource type, e.g. secrets or machineconfigs.machineconfiguration.openshift.io
+type EtcdResourceCount struct {
+	Resource string `json:"resource"`
+	Keys     int    `json:"keys"`
+}
+
+// UnsupportedSchemaError is returned for manifests written by a newer imager, with a schema the
+// reader doesn't know
+type UnsupportedSchemaError struct {
+	SchemaVersion int
+	Supported     int
+	// ImagerVersion is the version of the imager that created the seed, when it's recorded
+	ImagerVersion string
+}
+
+func (e *UnsupportedSchemaError) Error() string {
+	msg := fmt.Sprintf("seed manifest schema version %d is not supported, up to %d is", e.SchemaVersion, e.Supported)
+	if e.ImagerVersion != "" {
+		msg += fmt.Sprintf(": the seed was created by ibu-imager %s, restore it with that version or newer", e.ImagerVersion)
+	}
+	return msg
+}
+
+// Parse parses and validates a seed manifest, refusing schema versions newer than SchemaVersion
+func Parse(data []byte) (*Manifest, error) {
+	return ParseVersion(data, SchemaVersion)
+}
+
+// ParseVersion parses and validates a seed manifest, refusing schema versions newer than
+// maxSupported. Consumers pin the highest schema they were written against.
+func ParseVersion(data []byte, maxSupported int) (*Manifest, error) {
+	var versioned struct {
+		SchemaVersion int            `json:"schemaVersion"`
+		Imager        *ImagerVersion `json:"imager"`
+	}
+	if err := json.Unmarshal(data, &versioned); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse seed manifest")
+	}
+	if versioned.SchemaVersion == 0 {
+		versioned.SchemaVersion = 1
+	}
+	if versioned.SchemaVersion > maxSupported {
+		err := &UnsupportedSchemaError{SchemaVersion: versioned.SchemaVersion, Supported: maxSupported}
+		if versioned.Imager != nil {
+			err.ImagerVersion = versioned.Imager.Version
+		}
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse seed manifest")
+	}
+	manifest.SchemaVersion = versioned.SchemaVersion
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// Validate checks the manifest kind matches its node role and its restore steps can be ordered
+func (m *Manifest) Validate() error {
+	if err := ValidateNodeRole(m.NodeRole); err != nil {
+		return err
+	}
+	if expected := KindForNodeRole(m.NodeRole); m.Kind != expected {
+		return errors.Errorf("seed manifest kind %q doesn't match node role %s, expected %q", m.Kind, m.NodeRole, expected)
+	}
+	_, err := OrderRestoreSteps(m.RestoreSteps)
+	return err
+}
+
+// KindForNodeRole returns the manifest kind matching the given node role
+func KindForNodeRole(nodeRole string) string {
+	if nodeRole == NodeRoleWorker {
+		return KindWorkerSeed
+	}
+	return KindSeed
+}
+
+// ValidateNodeRole checks that the given node role is supported
+func ValidateNodeRole(nodeRole string) error {
+	switch nodeRole {
+	case NodeRoleMaster, NodeRoleWorker:
+		return nil
+	default:
+		return errors.Errorf("unsupported node role %q, must be one of: %s, %s", nodeRole, NodeRoleMaster, NodeRoleWorker)
+	}
+}
+
+// OrderRestoreSteps topologically sorts the restore steps by their dependencies. Steps without
+// ordering constraints between them keep the order they were declared in.
+func OrderRestoreSteps(steps []RestoreStep) ([]RestoreStep, error) {
+	byName := make(map[string]RestoreStep, len(steps))
+	for _, step := range steps {
+		if _, ok := byName[step.Name]; ok {
+			return nil, errors.Errorf("duplicated restore step %q", step.Name)
+		}
+		byName[step.Name] = step
+	}
+	for _, step := range steps {
+		for _, dep := range step.DependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, errors.Errorf("restore step %q depends on unknown step %q", step.Name, dep)
+			}
+		}
+	}
+
+	var (
+		ordered = make([]RestoreStep, 0, len(steps))
+		done    = map[string]bool{}
+	)
+	for len(ordered) < len(steps) {
+		progressed := false
+		for _, step := range steps {
+			if done[step.Name] || !dependenciesDone(step, done) {
+				continue
+			}
+			ordered = append(ordered, step)
+			done[step.Name] = true
+			progressed = true
+		}
+		if !progressed {
+			return nil, errors.New("restore steps have a dependency cycle")
+		}
+	}
+	return ordered, nil
+}
+
+func dependenciesDone(step RestoreStep, done map[string]bool) bool {
+	for _, dep := range step.DependsOn {
+		if !done[dep] {
+			return false
+		}
+	}
+	return true
+}
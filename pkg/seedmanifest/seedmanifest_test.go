@@ -0,0 +1,94 @@
+package seedmanifest
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSeedManifest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Seed Manifest Suite")
+}
+
+var _ = Describe("Seed manifest", func() {
+	It("Parses a versioned manifest", func() {
+		manifest, err := Parse([]byte(`{"schemaVersion": 1, "kind": "SeedImage", "nodeRole": "master",
+			"restoreSteps": [{"name": "var", "dependsOn": ["ostree"]}, {"name": "ostree"}],
+			"clusterVersion": {"version": "4.14.1", "image": "quay.io/release:4.14.1"}, "auditLogs": "exclude"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.SchemaVersion).To(Equal(1))
+		Expect(manifest.RestoreSteps).To(HaveLen(2))
+		Expect(manifest.ClusterVersion.Version).To(Equal("4.14.1"))
+
+		manifest, err = Parse([]byte(`{"schemaVersion": 2, "kind": "SeedImage", "nodeRole": "master",
+			"imager": {"version": "4.16.0"}, "featureGates": {"workerSeeds": false}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.SchemaVersion).To(Equal(2))
+	})
+
+	It("Reads unversioned manifests as the first schema", func() {
+		manifest, err := Parse([]byte(`{"kind": "WorkerSeedImage", "nodeRole": "worker"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.SchemaVersion).To(Equal(1))
+	})
+
+	It("Refuses manifests with a newer schema", func() {
+		_, err := Parse([]byte(`{"schemaVersion": 3, "kind": "SeedImage", "nodeRole": "master"}`))
+		Expect(err).To(MatchError(&UnsupportedSchemaError{SchemaVersion: 3, Supported: SchemaVersion}))
+
+		_, err = ParseVersion([]byte(`{"schemaVersion": 2, "kind": "SeedImage", "nodeRole": "master", "imager": {"version": "4.16.0"}}`), 1)
+		Expect(err).To(MatchError(ContainSubstring("created by ibu-imager 4.16.0")))
+	})
+
+	It("Refuses invalid manifests", func() {
+		_, err := Parse([]byte(`{"kind": "SeedImage", "nodeRole": "worker"}`))
+		Expect(err).To(MatchError(ContainSubstring("doesn't match node role")))
+		_, err = Parse([]byte(`{"kind": "SeedImage", "nodeRole": "infra"}`))
+		Expect(err).To(MatchError(ContainSubstring("unsupported node role")))
+		_, err = Parse([]byte(`{"kind": "SeedImage", "nodeRole": "master", "restoreSteps": [{"name": "var", "dependsOn": ["ostree"]}]}`))
+		Expect(err).To(MatchError(ContainSubstring("unknown step")))
+		_, err = Parse([]byte(`not json`))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Orders restore steps by their dependencies", func() {
+		ordered, err := OrderRestoreSteps([]RestoreStep{
+			{Name: "recert", DependsOn: []string{"etc", "var"}},
+			{Name: "var", DependsOn: []string{"ostree"}},
+			{Name: "etc", DependsOn: []string{"ostree"}},
+			{Name: "ostree"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		var names []string
+		for _, step := range ordered {
+			names = append(names, step.Name)
+		}
+		Expect(names).To(Equal([]string{"ostree", "var", "etc", "recert"}))
+	})
+})
+
+var _ = Describe("Deletions", func() {
+	It("Parses the deletions", func() {
+		deletions, err := ParseDeletions([]byte(`{"schemaVersion": 1, "deletions": [
+			{"path": "/etc/systemd/system/multi-user.target.wants/ptp4l.service", "type": "symlink", "reason": "ostree-config-diff"}]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deletions.Deletions).To(Equal([]Deletion{{Path: "/etc/systemd/system/multi-user.target.wants/ptp4l.service",
+			Type: DeletionTypeSymlink, Reason: DeletionReasonConfigDiff}}))
+	})
+
+	It("Refuses deletions outside /etc", func() {
+		for _, deleted := range []string{"/etc", "/var/lib/etcd", "/etc/../boot", "etc/hosts", "/etc//hosts"} {
+			_, err := ParseDeletions([]byte(`{"deletions": [{"path": "` + deleted + `", "type": "file", "reason": "ostree-config-diff"}]}`))
+			Expect(err).To(HaveOccurred(), deleted)
+		}
+	})
+
+	It("Refuses unknown types and newer schemas", func() {
+		_, err := ParseDeletions([]byte(`{"deletions": [{"path": "/etc/hosts", "type": "fifo", "reason": "ostree-config-diff"}]}`))
+		Expect(err).To(MatchError(ContainSubstring("unsupported type")))
+		_, err = ParseDeletions([]byte(`{"schemaVersion": 2, "deletions": []}`))
+		Expect(err).To(MatchError(ContainSubstring("not supported")))
+	})
+})